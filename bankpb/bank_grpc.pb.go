@@ -0,0 +1,528 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v29.3.0
+// source: bank.proto
+
+package bankpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BrokeBank_GetMe_FullMethodName                    = "/brokebank.v1.BrokeBank/GetMe"
+	BrokeBank_ListAccounts_FullMethodName             = "/brokebank.v1.BrokeBank/ListAccounts"
+	BrokeBank_GetAccount_FullMethodName               = "/brokebank.v1.BrokeBank/GetAccount"
+	BrokeBank_CreateAccount_FullMethodName            = "/brokebank.v1.BrokeBank/CreateAccount"
+	BrokeBank_DisableAccount_FullMethodName           = "/brokebank.v1.BrokeBank/DisableAccount"
+	BrokeBank_GetTransaction_FullMethodName           = "/brokebank.v1.BrokeBank/GetTransaction"
+	BrokeBank_ListAccountTransactions_FullMethodName  = "/brokebank.v1.BrokeBank/ListAccountTransactions"
+	BrokeBank_Deposit_FullMethodName                  = "/brokebank.v1.BrokeBank/Deposit"
+	BrokeBank_Withdraw_FullMethodName                 = "/brokebank.v1.BrokeBank/Withdraw"
+	BrokeBank_Transfer_FullMethodName                 = "/brokebank.v1.BrokeBank/Transfer"
+	BrokeBank_WatchAccountTransactions_FullMethodName = "/brokebank.v1.BrokeBank/WatchAccountTransactions"
+)
+
+// BrokeBankClient is the client API for BrokeBank service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// The gRPC API of Broke Bank. It exposes the same operations as the /v2 REST API, with the
+// same authorization rules: every call is authenticated with an API key sent in the
+// "x-api-key" metadata, and only reaches the calling user's accounts.
+type BrokeBankClient interface {
+	// The user the API key belongs to, like GET /me.
+	GetMe(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*User, error)
+	// Accounts, like GET /myAccounts, GET /account/:id, POST /account/create and
+	// PATCH /account/disable/:id.
+	ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error)
+	GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*Account, error)
+	CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DisableAccount(ctx context.Context, in *DisableAccountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Transactions, like GET /transaction/:id and GET /account/:id/transactions.
+	GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*Transaction, error)
+	ListAccountTransactions(ctx context.Context, in *ListAccountTransactionsRequest, opts ...grpc.CallOption) (*ListAccountTransactionsResponse, error)
+	// Money movements, like POST /transaction/deposit, /withdrawal and /transfer.
+	Deposit(ctx context.Context, in *DepositRequest, opts ...grpc.CallOption) (*MovementResponse, error)
+	Withdraw(ctx context.Context, in *WithdrawRequest, opts ...grpc.CallOption) (*MovementResponse, error)
+	Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*MovementResponse, error)
+	// Streams the transactions of an account as they are issued, oldest first, until the
+	// call is canceled.
+	WatchAccountTransactions(ctx context.Context, in *WatchAccountTransactionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Transaction], error)
+}
+
+type brokeBankClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBrokeBankClient(cc grpc.ClientConnInterface) BrokeBankClient {
+	return &brokeBankClient{cc}
+}
+
+func (c *brokeBankClient) GetMe(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, BrokeBank_GetMe_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAccountsResponse)
+	err := c.cc.Invoke(ctx, BrokeBank_ListAccounts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*Account, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Account)
+	err := c.cc.Invoke(ctx, BrokeBank_GetAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, BrokeBank_CreateAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) DisableAccount(ctx context.Context, in *DisableAccountRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, BrokeBank_DisableAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*Transaction, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, BrokeBank_GetTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) ListAccountTransactions(ctx context.Context, in *ListAccountTransactionsRequest, opts ...grpc.CallOption) (*ListAccountTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAccountTransactionsResponse)
+	err := c.cc.Invoke(ctx, BrokeBank_ListAccountTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) Deposit(ctx context.Context, in *DepositRequest, opts ...grpc.CallOption) (*MovementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MovementResponse)
+	err := c.cc.Invoke(ctx, BrokeBank_Deposit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) Withdraw(ctx context.Context, in *WithdrawRequest, opts ...grpc.CallOption) (*MovementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MovementResponse)
+	err := c.cc.Invoke(ctx, BrokeBank_Withdraw_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) Transfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*MovementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MovementResponse)
+	err := c.cc.Invoke(ctx, BrokeBank_Transfer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokeBankClient) WatchAccountTransactions(ctx context.Context, in *WatchAccountTransactionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Transaction], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BrokeBank_ServiceDesc.Streams[0], BrokeBank_WatchAccountTransactions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchAccountTransactionsRequest, Transaction]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BrokeBank_WatchAccountTransactionsClient = grpc.ServerStreamingClient[Transaction]
+
+// BrokeBankServer is the server API for BrokeBank service.
+// All implementations must embed UnimplementedBrokeBankServer
+// for forward compatibility.
+//
+// The gRPC API of Broke Bank. It exposes the same operations as the /v2 REST API, with the
+// same authorization rules: every call is authenticated with an API key sent in the
+// "x-api-key" metadata, and only reaches the calling user's accounts.
+type BrokeBankServer interface {
+	// The user the API key belongs to, like GET /me.
+	GetMe(context.Context, *emptypb.Empty) (*User, error)
+	// Accounts, like GET /myAccounts, GET /account/:id, POST /account/create and
+	// PATCH /account/disable/:id.
+	ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error)
+	GetAccount(context.Context, *GetAccountRequest) (*Account, error)
+	CreateAccount(context.Context, *CreateAccountRequest) (*emptypb.Empty, error)
+	DisableAccount(context.Context, *DisableAccountRequest) (*emptypb.Empty, error)
+	// Transactions, like GET /transaction/:id and GET /account/:id/transactions.
+	GetTransaction(context.Context, *GetTransactionRequest) (*Transaction, error)
+	ListAccountTransactions(context.Context, *ListAccountTransactionsRequest) (*ListAccountTransactionsResponse, error)
+	// Money movements, like POST /transaction/deposit, /withdrawal and /transfer.
+	Deposit(context.Context, *DepositRequest) (*MovementResponse, error)
+	Withdraw(context.Context, *WithdrawRequest) (*MovementResponse, error)
+	Transfer(context.Context, *TransferRequest) (*MovementResponse, error)
+	// Streams the transactions of an account as they are issued, oldest first, until the
+	// call is canceled.
+	WatchAccountTransactions(*WatchAccountTransactionsRequest, grpc.ServerStreamingServer[Transaction]) error
+	mustEmbedUnimplementedBrokeBankServer()
+}
+
+// UnimplementedBrokeBankServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBrokeBankServer struct{}
+
+func (UnimplementedBrokeBankServer) GetMe(context.Context, *emptypb.Empty) (*User, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetMe not implemented")
+}
+func (UnimplementedBrokeBankServer) ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListAccounts not implemented")
+}
+func (UnimplementedBrokeBankServer) GetAccount(context.Context, *GetAccountRequest) (*Account, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetAccount not implemented")
+}
+func (UnimplementedBrokeBankServer) CreateAccount(context.Context, *CreateAccountRequest) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateAccount not implemented")
+}
+func (UnimplementedBrokeBankServer) DisableAccount(context.Context, *DisableAccountRequest) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method DisableAccount not implemented")
+}
+func (UnimplementedBrokeBankServer) GetTransaction(context.Context, *GetTransactionRequest) (*Transaction, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (UnimplementedBrokeBankServer) ListAccountTransactions(context.Context, *ListAccountTransactionsRequest) (*ListAccountTransactionsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListAccountTransactions not implemented")
+}
+func (UnimplementedBrokeBankServer) Deposit(context.Context, *DepositRequest) (*MovementResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Deposit not implemented")
+}
+func (UnimplementedBrokeBankServer) Withdraw(context.Context, *WithdrawRequest) (*MovementResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Withdraw not implemented")
+}
+func (UnimplementedBrokeBankServer) Transfer(context.Context, *TransferRequest) (*MovementResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedBrokeBankServer) WatchAccountTransactions(*WatchAccountTransactionsRequest, grpc.ServerStreamingServer[Transaction]) error {
+	return status.Error(codes.Unimplemented, "method WatchAccountTransactions not implemented")
+}
+func (UnimplementedBrokeBankServer) mustEmbedUnimplementedBrokeBankServer() {}
+func (UnimplementedBrokeBankServer) testEmbeddedByValue()                   {}
+
+// UnsafeBrokeBankServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BrokeBankServer will
+// result in compilation errors.
+type UnsafeBrokeBankServer interface {
+	mustEmbedUnimplementedBrokeBankServer()
+}
+
+func RegisterBrokeBankServer(s grpc.ServiceRegistrar, srv BrokeBankServer) {
+	// If the following call panics, it indicates UnimplementedBrokeBankServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BrokeBank_ServiceDesc, srv)
+}
+
+func _BrokeBank_GetMe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).GetMe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_GetMe_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).GetMe(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_ListAccounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAccountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).ListAccounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_ListAccounts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).ListAccounts(ctx, req.(*ListAccountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_GetAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).GetAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_GetAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).GetAccount(ctx, req.(*GetAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_CreateAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).CreateAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_CreateAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).CreateAccount(ctx, req.(*CreateAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_DisableAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).DisableAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_DisableAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).DisableAccount(ctx, req.(*DisableAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_GetTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).GetTransaction(ctx, req.(*GetTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_ListAccountTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAccountTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).ListAccountTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_ListAccountTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).ListAccountTransactions(ctx, req.(*ListAccountTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_Deposit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DepositRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).Deposit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_Deposit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).Deposit(ctx, req.(*DepositRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_Withdraw_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WithdrawRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).Withdraw(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_Withdraw_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).Withdraw(ctx, req.(*WithdrawRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_Transfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokeBankServer).Transfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BrokeBank_Transfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokeBankServer).Transfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BrokeBank_WatchAccountTransactions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAccountTransactionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BrokeBankServer).WatchAccountTransactions(m, &grpc.GenericServerStream[WatchAccountTransactionsRequest, Transaction]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BrokeBank_WatchAccountTransactionsServer = grpc.ServerStreamingServer[Transaction]
+
+// BrokeBank_ServiceDesc is the grpc.ServiceDesc for BrokeBank service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BrokeBank_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "brokebank.v1.BrokeBank",
+	HandlerType: (*BrokeBankServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMe",
+			Handler:    _BrokeBank_GetMe_Handler,
+		},
+		{
+			MethodName: "ListAccounts",
+			Handler:    _BrokeBank_ListAccounts_Handler,
+		},
+		{
+			MethodName: "GetAccount",
+			Handler:    _BrokeBank_GetAccount_Handler,
+		},
+		{
+			MethodName: "CreateAccount",
+			Handler:    _BrokeBank_CreateAccount_Handler,
+		},
+		{
+			MethodName: "DisableAccount",
+			Handler:    _BrokeBank_DisableAccount_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _BrokeBank_GetTransaction_Handler,
+		},
+		{
+			MethodName: "ListAccountTransactions",
+			Handler:    _BrokeBank_ListAccountTransactions_Handler,
+		},
+		{
+			MethodName: "Deposit",
+			Handler:    _BrokeBank_Deposit_Handler,
+		},
+		{
+			MethodName: "Withdraw",
+			Handler:    _BrokeBank_Withdraw_Handler,
+		},
+		{
+			MethodName: "Transfer",
+			Handler:    _BrokeBank_Transfer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAccountTransactions",
+			Handler:       _BrokeBank_WatchAccountTransactions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "bank.proto",
+}
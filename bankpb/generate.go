@@ -0,0 +1,4 @@
+// Package bankpb holds the protobuf messages and gRPC stubs generated from bank.proto.
+package bankpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bank.proto
@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/server"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const account_usage = `Usage:
+  broke-bank account list EMAIL|USER_ID [--limit N] [--offset N]   list a user's accounts
+  broke-bank account show ID [--transactions N]                    show an account and its latest transactions
+  broke-bank account freeze ID --code C --reason R                 freeze an active account
+      [--debit-only] [--until TIME]                                only block debits, lift the freeze at TIME (RFC 3339)
+  broke-bank account unfreeze ID --reason R                        make a frozen account active again
+  broke-bank account adjust ID AMOUNT --reason R --evidence E      propose to credit (positive) or debit (negative) an
+      --staff EMAIL|USER_ID                                        account, posted once other staff approve it`
+
+func runAccount(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(account_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		return accountList(ctx, args[1:])
+	case "show":
+		return accountShow(ctx, args[1:])
+	case "freeze":
+		return accountFreeze(ctx, args[1:])
+	case "unfreeze":
+		return accountUnfreeze(ctx, args[1:])
+	case "adjust":
+		return accountAdjust(ctx, args[1:])
+	default:
+		fmt.Println(account_usage)
+		return 2
+	}
+}
+
+func accountRows(accounts []model.Account) [][]string {
+	rows := [][]string{}
+	for _, account := range accounts {
+		frozen_until := ""
+		if account.FrozenUntil != nil {
+			frozen_until = account.FrozenUntil.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{account.Id.String(), account.UserId.String(), account.Name, account.Balance.StringFixed(2), account.Status, frozen_until})
+	}
+
+	return rows
+}
+
+var account_headers = []string{"ID", "USER ID", "NAME", "BALANCE", "STATUS", "FROZEN UNTIL"}
+
+func getAccount(ctx context.Context, repos *repository.Repositories, account_id string) (*model.Account, error) {
+	if _, err := uuid.Parse(account_id); err != nil {
+		return nil, fmt.Errorf("invalid account id %q", account_id)
+	}
+
+	account, err := repos.AccountRepository.GetAccount(ctx, account_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("account %s not found", account_id)
+	}
+
+	return account, err
+}
+
+func paginationFlags(fs *flag.FlagSet) (*int, *int) {
+	return fs.Int("limit", 20, "maximum number of rows"), fs.Int("offset", 0, "rows to skip")
+}
+
+func accountList(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("account list", false)
+	limit, offset := paginationFlags(fs)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("account list", err, account_usage)
+	}
+
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("account list", err)
+	}
+
+	accounts, err := repos.AccountRepository.GetMyAccounts(ctx, user.Id.String(), *limit, *offset)
+	if err != nil {
+		return fail("account list", err)
+	}
+
+	if err = render(opts, accounts, account_headers, accountRows(*accounts)); err != nil {
+		return fail("account list", err)
+	}
+
+	return 0
+}
+
+type AccountShowOutput struct {
+	Account      model.Account       `json:"account"`
+	Transactions []model.Transaction `json:"transactions"`
+}
+
+func accountShow(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("account show", false)
+	transactions_limit := fs.Int("transactions", 10, "number of latest transactions to show")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("account show", err, account_usage)
+	}
+
+	repos := repository.New()
+
+	account, err := getAccount(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("account show", err)
+	}
+
+	transactions, err := repos.TransactionRepository.GetAccountTransactions(ctx, account.Id.String(), *transactions_limit, 0)
+	if err != nil {
+		return fail("account show", err)
+	}
+
+	if opts.output == "json" {
+		err = render(opts, AccountShowOutput{Account: *account, Transactions: *transactions}, nil, nil)
+	} else {
+		if err = render(opts, nil, account_headers, accountRows([]model.Account{*account})); err != nil {
+			return fail("account show", err)
+		}
+		fmt.Println()
+		err = render(opts, nil, transaction_headers, transactionRows(*transactions))
+	}
+	if err != nil {
+		return fail("account show", err)
+	}
+
+	return 0
+}
+
+func accountFreeze(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("account freeze", true)
+	code := fs.String("code", "", "reason code: "+strings.Join(model.AccountStatusReasons, " | "))
+	debit_only := fs.Bool("debit-only", false, "only block money leaving the account")
+	until := fs.String("until", "", "end of the freeze (RFC 3339), indefinite when empty")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("account freeze", err, account_usage)
+	}
+
+	if !slices.Contains(model.AccountStatusReasons, *code) {
+		return usageError("account freeze", fmt.Errorf("invalid reason code %q", *code), account_usage)
+	}
+
+	change := repository.AccountStatusChange{From: []string{model.AccountActive}, Status: model.AccountFrozenAll, StatusReason: code}
+	if *debit_only {
+		change.Status = model.AccountFrozenDebit
+	}
+	if *until != "" {
+		frozen_until, err := time.Parse(time.RFC3339, *until)
+		if err != nil || !frozen_until.After(time.Now()) {
+			return usageError("account freeze", fmt.Errorf("invalid --until %q, expected a future RFC 3339 time", *until), account_usage)
+		}
+		change.FrozenUntil = &frozen_until
+	}
+
+	return accountSetStatus(ctx, "account freeze", opts, positional[0], change)
+}
+
+func accountUnfreeze(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("account unfreeze", true)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("account unfreeze", err, account_usage)
+	}
+
+	change := repository.AccountStatusChange{From: []string{model.AccountFrozenDebit, model.AccountFrozenAll}, Status: model.AccountActive}
+	return accountSetStatus(ctx, "account unfreeze", opts, positional[0], change)
+}
+
+func accountSetStatus(ctx context.Context, command string, opts *options, account_id string, change repository.AccountStatusChange) int {
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	account, err := getAccount(ctx, &repos, account_id)
+	if err != nil {
+		return fail(command, err)
+	}
+
+	updated, err := repos.AccountRepository.SetAccountStatus(ctx, account.Id.String(), change)
+	if errors.Is(err, repository.ErrAccountStatus) {
+		return fail(command, fmt.Errorf("account is %s, expected %s", account.Status, strings.Join(change.From, " or ")))
+	}
+	if err != nil {
+		return fail(command, err)
+	}
+
+	if err = render(opts, updated, account_headers, accountRows([]model.Account{*updated})); err != nil {
+		return fail(command, err)
+	}
+
+	return 0
+}
+
+var adjustment_headers = []string{"ID", "ACCOUNT ID", "AMOUNT", "STATUS", "REQUIRED APPROVALS", "PROPOSED BY", "REVERSAL OF"}
+
+func adjustmentRows(adjustments []model.Adjustment) [][]string {
+	rows := [][]string{}
+	for _, adjustment := range adjustments {
+		rows = append(rows, []string{
+			adjustment.Id.String(),
+			adjustment.AccountId.String(),
+			adjustment.Amount.StringFixed(2),
+			adjustment.Status,
+			fmt.Sprint(adjustment.RequiredApprovals),
+			adjustment.ProposedBy.String(),
+			optionalUUID(adjustment.ReversalOf),
+		})
+	}
+
+	return rows
+}
+
+/*
+proposeAdjustment files an adjustment on behalf of a staff member like POST /v2/admin/adjustments
+does, so that an operator can't move money without other staff approving it through the API.
+*/
+func proposeAdjustment(ctx context.Context, repos *repository.Repositories, staff_ref string, adjustment model.Adjustment) (*model.Adjustment, error) {
+	staff, err := findUser(ctx, repos, staff_ref)
+	if err != nil {
+		return nil, err
+	}
+	if !server.CanProposeAdjustments(staff.Role) {
+		return nil, fmt.Errorf("%s can't propose adjustments with the %s role", staff.Email, staff.Role)
+	}
+
+	adjustment.ProposedBy = staff.Id
+	adjustment.RequiredApprovals = server.AdjustmentRequiredApprovals(adjustment.Amount, server.AdjustmentDualApprovalThresholdFromEnv())
+
+	return repos.AdjustmentRepository.CreateAdjustment(ctx, adjustment)
+}
+
+// accountAdjust proposes an adjustment, posted as an 'adjustment' transaction once approved.
+func accountAdjust(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("account adjust", true)
+	evidence := fs.String("evidence", "", "what supports the adjustment, such as a ticket (required)")
+	staff_ref := fs.String("staff", "", "email or id of the staff member proposing it (required)")
+	positional, err := parseArgs(fs, opts, args, 2)
+	if err != nil {
+		return usageError("account adjust", err, account_usage)
+	}
+
+	amount, err := decimal.NewFromString(positional[1])
+	if err != nil || amount.IsZero() || !amount.Equal(amount.Round(2)) {
+		return usageError("account adjust", fmt.Errorf("invalid amount %q", positional[1]), account_usage)
+	}
+	if strings.TrimSpace(*evidence) == "" || *staff_ref == "" {
+		return usageError("account adjust", errors.New("--evidence and --staff are required"), account_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	account, err := getAccount(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("account adjust", err)
+	}
+
+	adjustment, err := proposeAdjustment(ctx, &repos, *staff_ref, model.Adjustment{
+		AccountId: account.Id,
+		Amount:    amount,
+		Reason:    strings.TrimSpace(opts.reason),
+		Evidence:  strings.TrimSpace(*evidence),
+	})
+	if err != nil {
+		return fail("account adjust", err)
+	}
+
+	if err = render(opts, adjustment, adjustment_headers, adjustmentRows([]model.Adjustment{*adjustment})); err != nil {
+		return fail("account adjust", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const apikey_usage = `Usage:
+  broke-bank apikey create EMAIL|USER_ID --name N   issue an API key (printed once, only its hash is stored)
+  broke-bank apikey list EMAIL|USER_ID              list a user's API keys
+  broke-bank apikey revoke ID --reason R            revoke an API key`
+
+func runApiKey(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(apikey_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		return apiKeyCreate(ctx, args[1:])
+	case "list":
+		return apiKeyList(ctx, args[1:])
+	case "revoke":
+		return apiKeyRevoke(ctx, args[1:])
+	default:
+		fmt.Println(apikey_usage)
+		return 2
+	}
+}
+
+type ApiKeyOutput struct {
+	model.ApiKey
+	// Only set by `apikey create`.
+	Key string `json:"key,omitempty"`
+}
+
+var apikey_headers = []string{"ID", "USER ID", "NAME", "PREFIX", "CREATED AT", "REVOKED AT"}
+
+func apiKeyRows(api_keys []model.ApiKey) [][]string {
+	rows := [][]string{}
+	for _, api_key := range api_keys {
+		rows = append(rows, []string{api_key.Id.String(), api_key.UserId.String(), api_key.Name, api_key.Prefix, api_key.CreatedAt.Format(time_format), optionalTime(api_key.RevokedAt)})
+	}
+
+	return rows
+}
+
+func apiKeyCreate(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("apikey create", false)
+	name := fs.String("name", "", "what the key is used for")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err == nil && *name == "" {
+		err = errors.New("--name is required")
+	}
+	if err != nil {
+		return usageError("apikey create", err, apikey_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("apikey create", err)
+	}
+
+	key, prefix, hash, err := utils.GenerateApiKey()
+	if err != nil {
+		return fail("apikey create", err)
+	}
+
+	api_key, err := repos.ApiKeyRepository.CreateApiKey(ctx, user.Id, *name, hash, prefix)
+	if err != nil {
+		return fail("apikey create", err)
+	}
+
+	rows := apiKeyRows([]model.ApiKey{*api_key})
+	rows[0] = append(rows[0], key)
+	if err = render(opts, ApiKeyOutput{ApiKey: *api_key, Key: key}, append(apikey_headers, "KEY"), rows); err != nil {
+		return fail("apikey create", err)
+	}
+
+	return 0
+}
+
+func apiKeyList(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("apikey list", false)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("apikey list", err, apikey_usage)
+	}
+
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("apikey list", err)
+	}
+
+	api_keys, err := repos.ApiKeyRepository.GetUserApiKeys(ctx, user.Id)
+	if err != nil {
+		return fail("apikey list", err)
+	}
+
+	if err = render(opts, api_keys, apikey_headers, apiKeyRows(*api_keys)); err != nil {
+		return fail("apikey list", err)
+	}
+
+	return 0
+}
+
+func apiKeyRevoke(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("apikey revoke", true)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("apikey revoke", err, apikey_usage)
+	}
+
+	id, err := uuid.Parse(positional[0])
+	if err != nil {
+		return usageError("apikey revoke", fmt.Errorf("invalid api key id %q", positional[0]), apikey_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	err = repos.ApiKeyRepository.RevokeApiKey(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail("apikey revoke", fmt.Errorf("api key %s not found or already revoked", id))
+	}
+	if err != nil {
+		return fail("apikey revoke", err)
+	}
+
+	result := map[string]any{"id": id, "revoked": true}
+	if err = render(opts, result, []string{"ID", "REVOKED"}, [][]string{{id.String(), "true"}}); err != nil {
+		return fail("apikey revoke", err)
+	}
+
+	return 0
+}
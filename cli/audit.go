@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const audit_usage = `Usage:
+  broke-bank audit list [--user EMAIL|USER_ID] [--by ACTOR] [--action A] [--target TYPE:ID]
+                        [--since T] [--until T] [--limit N] [--offset N]   search the audit trail, newest first
+
+ACTOR is e.g. user:<id>, anonymous, processor or cli:<name>, T an RFC 3339 time.`
+
+func runAudit(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Println(audit_usage)
+		return 2
+	}
+
+	return auditList(ctx, args[1:])
+}
+
+var audit_headers = []string{"CREATED AT", "ACTOR", "ACTION", "TARGET", "REASON", "IP", "REQUEST ID"}
+
+func auditRows(events []model.AuditEvent) [][]string {
+	optional := func(value *string) string {
+		if value == nil {
+			return "-"
+		}
+		return *value
+	}
+
+	rows := [][]string{}
+	for _, event := range events {
+		rows = append(rows, []string{
+			event.CreatedAt.Format(time_format),
+			event.Actor,
+			event.Action,
+			event.TargetType + ":" + event.TargetId,
+			optional(event.Reason),
+			optional(event.Ip),
+			optional(event.RequestId),
+		})
+	}
+
+	return rows
+}
+
+func parseTimeFlag(name string, raw string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s %q, expected an RFC 3339 time", name, raw)
+	}
+
+	return &value, nil
+}
+
+func auditList(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("audit list", false)
+	user_ref := fs.String("user", "", "only events about this user")
+	by := fs.String("by", "", "only events of this actor")
+	action := fs.String("action", "", "only events of this action, e.g. account.set_status")
+	target := fs.String("target", "", "only events about this target, as TYPE:ID")
+	raw_since := fs.String("since", "", "only events created at or after this time")
+	raw_until := fs.String("until", "", "only events created before this time")
+	limit, offset := paginationFlags(fs)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("audit list", err, audit_usage)
+	}
+
+	filter := repository.AuditFilter{Actor: *by, Action: *action}
+	if *target != "" {
+		target_type, target_id, ok := strings.Cut(*target, ":")
+		if !ok || target_type == "" || target_id == "" {
+			return usageError("audit list", fmt.Errorf("invalid --target %q, expected TYPE:ID", *target), audit_usage)
+		}
+		filter.TargetType, filter.TargetId = target_type, target_id
+	}
+
+	var err error
+	if filter.Since, err = parseTimeFlag("since", *raw_since); err != nil {
+		return usageError("audit list", err, audit_usage)
+	}
+	if filter.Until, err = parseTimeFlag("until", *raw_until); err != nil {
+		return usageError("audit list", err, audit_usage)
+	}
+
+	repos := repository.New()
+
+	if *user_ref != "" {
+		user, err := findUser(ctx, &repos, *user_ref)
+		if err != nil {
+			return fail("audit list", err)
+		}
+		filter.UserId = &user.Id
+	}
+
+	events, err := repos.AuditRepository.SearchAuditEvents(ctx, filter, *limit, *offset)
+	if err != nil {
+		return fail("audit list", err)
+	}
+
+	if err = render(opts, events, audit_headers, auditRows(*events)); err != nil {
+		return fail("audit list", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	osuser "os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const usage = `Usage: broke-bank [command]
+
+Without a command the API server is started.
+
+Commands:
+  migrate    up | down N | status | create NAME
+  user       create | find | disable
+  account    list | show | freeze | unfreeze | adjust
+  tx         show | list | reverse
+  session    revoke
+  apikey     create | list | revoke
+  audit      list
+  ledger     verify | checkpoint | export | keygen
+  receipts   keygen | keys
+  reconcile  check every balance against its transactions
+  seed       create demo users and accounts
+
+Run 'broke-bank <command>' without arguments for its usage.
+Changes are recorded in the audit trail as made by --actor, along with the --reason that
+destructive commands require.`
+
+/*
+Run dispatches an admin command and returns the process exit code. Ctrl-C cancels the
+command's context, which aborts in-flight queries and rolls back open transactions.
+*/
+func Run(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, args[1:])
+	case "user":
+		return runUser(ctx, args[1:])
+	case "account":
+		return runAccount(ctx, args[1:])
+	case "tx":
+		return runTx(ctx, args[1:])
+	case "session":
+		return runSession(ctx, args[1:])
+	case "apikey":
+		return runApiKey(ctx, args[1:])
+	case "audit":
+		return runAudit(ctx, args[1:])
+	case "ledger":
+		return runLedger(ctx, args[1:])
+	case "receipts":
+		return runReceipts(ctx, args[1:])
+	case "reconcile":
+		return runReconcile(ctx, args[1:])
+	case "seed":
+		return runSeed(ctx, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+}
+
+type options struct {
+	output string
+	reason string
+	actor  string
+	// Destructive commands refuse to run without a reason.
+	destructive bool
+}
+
+func newFlagSet(name string, destructive bool) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &options{destructive: destructive}
+
+	fs.StringVar(&opts.output, "output", "table", "output format: table | json")
+	fs.StringVar(&opts.output, "o", "table", "shorthand for --output")
+	fs.StringVar(&opts.actor, "actor", defaultActor(), "operator recorded in the audit trail")
+	if destructive {
+		fs.StringVar(&opts.reason, "reason", "", "why this is being done (required, recorded in the audit trail)")
+	}
+
+	return fs, opts
+}
+
+/*
+parseArgs parses flags wherever they appear, so that `account freeze <id> --reason x`
+works as well as `account freeze --reason x <id>`. It returns the positional arguments;
+a positional_count of -1 leaves checking their number to the caller.
+*/
+func parseArgs(fs *flag.FlagSet, opts *options, args []string, positional_count int) ([]string, error) {
+	positional := []string{}
+	for len(args) > 0 {
+		// Negative amounts such as `-25.00` are arguments, not flags.
+		if _, err := decimal.NewFromString(args[0]); err == nil {
+			positional = append(positional, args[0])
+			args = args[1:]
+			continue
+		}
+
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if positional_count >= 0 && len(positional) != positional_count {
+		return nil, fmt.Errorf("expected %d argument(s), got %d", positional_count, len(positional))
+	}
+
+	if opts.output != "table" && opts.output != "json" {
+		return nil, fmt.Errorf("invalid --output %q, expected table or json", opts.output)
+	}
+
+	if opts.destructive && strings.TrimSpace(opts.reason) == "" {
+		return nil, errors.New("--reason is required for this command")
+	}
+
+	return positional, nil
+}
+
+func defaultActor() string {
+	if u, err := osuser.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+
+	return "cli"
+}
+
+/*
+render prints value as JSON, or rows as an aligned table. Callers pass both so every
+command supports both formats without knowing which one was requested.
+*/
+func render(opts *options, value any, headers []string, rows [][]string) error {
+	if opts.output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func fail(command string, err error) int {
+	fmt.Fprintf(os.Stderr, "[ERROR] [%s] %s\n", command, err)
+	return 1
+}
+
+func usageError(command string, err error, command_usage string) int {
+	fmt.Fprintf(os.Stderr, "[ERROR] [%s] %s\n\n%s\n", command, err, command_usage)
+	return 2
+}
+
+/*
+actorContext records the operator and the --reason of a command in ctx, for the audit events
+the repositories write along with each change.
+*/
+func actorContext(ctx context.Context, opts *options) context.Context {
+	return repository.WithAuditActor(ctx, model.AuditActor{Actor: opts.actor, Reason: opts.reason})
+}
+
+/*
+audit records a change the repositories don't audit themselves, such as revoking sessions,
+which live in Valkey. Failing to write it is reported as a command failure.
+*/
+func audit(ctx context.Context, repos *repository.Repositories, event model.AuditEvent, details any) error {
+	event, err := repository.NewAuditEvent(ctx, event, details, nil, nil)
+	if err == nil {
+		err = repos.AuditRepository.CreateAuditEvent(ctx, event)
+	}
+	if err != nil {
+		return fmt.Errorf("action succeeded but writing the audit event failed: %w", err)
+	}
+
+	return nil
+}
+
+// findUser accepts either a user id or an email.
+func findUser(ctx context.Context, repos *repository.Repositories, ref string) (*model.User, error) {
+	var (
+		found *model.User
+		err   error
+	)
+	if id, parse_err := uuid.Parse(ref); parse_err == nil {
+		found, err = repos.UserRepository.GetUserById(ctx, id)
+	} else {
+		found, err = repos.UserRepository.GetUserByEmail(ctx, ref)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %q not found", ref)
+	}
+
+	return found, err
+}
+
+const time_format = "2006-01-02 15:04:05 MST"
+
+func optionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time_format)
+}
+
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return "-"
+	}
+
+	return id.String()
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const ledger_usage = `Usage:
+  broke-bank ledger verify [--account ID] [--checkpoints FILE] [--key KEY_ID]
+                                      walk the hash chains of the transaction table (exits 1 if broken)
+  broke-bank ledger checkpoint        sign a checkpoint of every chain now, with LEDGER_SIGNING_KEY
+  broke-bank ledger export [--limit N] [--offset N]
+                                      print checkpoints as JSON, newest first, to keep them offline
+  broke-bank ledger keygen            print a new LEDGER_SIGNING_KEY and its key id
+
+Chains are checked against the checkpoints of FILE, as printed by export, or against the
+stored ones. Only checkpoints signed by KEY_ID are trusted, by default LEDGER_SIGNING_KEY's.`
+
+func runLedger(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(ledger_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "verify":
+		return ledgerVerify(ctx, args[1:])
+	case "checkpoint":
+		return ledgerCheckpoint(ctx, args[1:])
+	case "export":
+		return ledgerExport(ctx, args[1:])
+	case "keygen":
+		return ledgerKeygen(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown ledger command %q\n\n%s\n", args[0], ledger_usage)
+		return 2
+	}
+}
+
+// trustedCheckpoints checks the signature of every checkpoint, and that it was made with key_id.
+func trustedCheckpoints(checkpoints []model.LedgerCheckpoint, key_id string) error {
+	for _, checkpoint := range checkpoints {
+		if err := repository.VerifyCheckpoint(checkpoint); err != nil {
+			return fmt.Errorf("checkpoint %s: %w", checkpoint.Id, err)
+		}
+		if checkpoint.KeyId != key_id {
+			return fmt.Errorf("checkpoint %s is signed by key %s, not the trusted %s", checkpoint.Id, checkpoint.KeyId, key_id)
+		}
+	}
+
+	return nil
+}
+
+func ledgerVerify(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("ledger verify", false)
+	raw_account_id := fs.String("account", "", "only verify this account's chain")
+	checkpoints_file := fs.String("checkpoints", "", "JSON file of checkpoints, as printed by ledger export")
+	key_id := fs.String("key", "", "id of the key trusted to sign checkpoints")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("ledger verify", err, ledger_usage)
+	}
+
+	account_ids := []uuid.UUID{}
+	if *raw_account_id != "" {
+		account_id, err := uuid.Parse(*raw_account_id)
+		if err != nil {
+			return usageError("ledger verify", fmt.Errorf("invalid --account %q", *raw_account_id), ledger_usage)
+		}
+		account_ids = append(account_ids, account_id)
+	}
+
+	if *key_id == "" {
+		signer, err := utils.SignerFromEnv("LEDGER_SIGNING_KEY")
+		if err != nil {
+			return fail("ledger verify", err)
+		}
+		if signer != nil {
+			*key_id = signer.KeyId
+		}
+	}
+
+	repos := repository.New()
+
+	checkpoints := []model.LedgerCheckpoint{}
+	if *checkpoints_file != "" {
+		raw, err := os.ReadFile(*checkpoints_file)
+		if err != nil {
+			return fail("ledger verify", err)
+		}
+		if err = json.Unmarshal(raw, &checkpoints); err != nil {
+			return fail("ledger verify", fmt.Errorf("invalid checkpoints file: %w", err))
+		}
+	} else if *key_id != "" {
+		stored, err := repos.LedgerRepository.GetLedgerCheckpoints(ctx, 1000, 0)
+		if err != nil {
+			return fail("ledger verify", err)
+		}
+		checkpoints = *stored
+	}
+
+	if len(checkpoints) > 0 && *key_id == "" {
+		return usageError("ledger verify", errors.New("--key is required to trust checkpoints when LEDGER_SIGNING_KEY is not set"), ledger_usage)
+	}
+	if err := trustedCheckpoints(checkpoints, *key_id); err != nil {
+		return fail("ledger verify", err)
+	}
+
+	report, err := repository.VerifyLedger(ctx, repos.LedgerRepository, account_ids, checkpoints)
+	if err != nil {
+		return fail("ledger verify", err)
+	}
+
+	rows := [][]string{}
+	for _, broken := range report.Broken {
+		rows = append(rows, []string{broken.AccountId.String(), strconv.FormatInt(broken.Position, 10), optionalUUID(broken.TransactionId), broken.Problem})
+	}
+
+	if opts.output == "table" && len(rows) == 0 {
+		fmt.Printf("%d chain(s) of %d link(s) intact, checked against %d checkpoint(s)\n", report.Accounts, report.Links, len(checkpoints))
+		return 0
+	}
+
+	if err = render(opts, report, []string{"ACCOUNT ID", "LINK", "TRANSACTION ID", "PROBLEM"}, rows); err != nil {
+		return fail("ledger verify", err)
+	}
+
+	if len(rows) > 0 {
+		fmt.Fprintf(os.Stderr, "%d broken chain(s)\n", len(rows))
+		return 1
+	}
+
+	return 0
+}
+
+var checkpoint_headers = []string{"ID", "CREATED AT", "ACCOUNTS", "LINKS", "ROOT", "KEY ID"}
+
+func checkpointRows(checkpoints []model.LedgerCheckpoint) [][]string {
+	rows := [][]string{}
+	for _, checkpoint := range checkpoints {
+		rows = append(rows, []string{
+			checkpoint.Id.String(),
+			checkpoint.CreatedAt.Format(time_format),
+			strconv.Itoa(checkpoint.Accounts),
+			strconv.FormatInt(checkpoint.Links, 10),
+			checkpoint.Root.String(),
+			checkpoint.KeyId,
+		})
+	}
+
+	return rows
+}
+
+func ledgerCheckpoint(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("ledger checkpoint", false)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("ledger checkpoint", err, ledger_usage)
+	}
+
+	signer, err := utils.SignerFromEnv("LEDGER_SIGNING_KEY")
+	if err != nil {
+		return fail("ledger checkpoint", err)
+	}
+	if signer == nil {
+		return fail("ledger checkpoint", errors.New("missing LEDGER_SIGNING_KEY env"))
+	}
+
+	repos := repository.New()
+
+	checkpoint, err := repository.CreateLedgerCheckpoint(ctx, repos.LedgerRepository, signer)
+	if err != nil {
+		return fail("ledger checkpoint", err)
+	}
+
+	if err = render(opts, checkpoint, checkpoint_headers, checkpointRows([]model.LedgerCheckpoint{*checkpoint})); err != nil {
+		return fail("ledger checkpoint", err)
+	}
+
+	return 0
+}
+
+func ledgerExport(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("ledger export", false)
+	limit, offset := paginationFlags(fs)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("ledger export", err, ledger_usage)
+	}
+
+	repos := repository.New()
+
+	checkpoints, err := repos.LedgerRepository.GetLedgerCheckpoints(ctx, *limit, *offset)
+	if err != nil {
+		return fail("ledger export", err)
+	}
+
+	// Always JSON: the output is meant to be fed back to ledger verify.
+	opts.output = "json"
+	if err = render(opts, checkpoints, checkpoint_headers, checkpointRows(*checkpoints)); err != nil {
+		return fail("ledger export", err)
+	}
+
+	return 0
+}
+
+func ledgerKeygen(args []string) int {
+	fs, opts := newFlagSet("ledger keygen", false)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("ledger keygen", err, ledger_usage)
+	}
+
+	seed, err := utils.GenerateSigningKey()
+	if err != nil {
+		return fail("ledger keygen", err)
+	}
+	signer, err := utils.ParseSigningKey(seed)
+	if err != nil {
+		return fail("ledger keygen", err)
+	}
+
+	fmt.Printf("LEDGER_SIGNING_KEY=%s\n", seed)
+	fmt.Fprintf(os.Stderr, "key id: %s\n", signer.KeyId)
+	return 0
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"broke-bank/migrations"
+	"broke-bank/repository"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrate_usage = `Usage:
+  broke-bank migrate up             apply every pending migration, adopting schemas created before migrations
+  broke-bank migrate down N         revert the last N applied migrations
+  broke-bank migrate status         list migrations and whether they are applied
+  broke-bank migrate create NAME    create an empty up/down pair under ./migrations`
+
+func runMigrate(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrate_usage)
+		return 2
+	}
+
+	// `create` only touches the filesystem, so it doesn't need a database.
+	if args[0] == "create" {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrate_usage)
+			return 2
+		}
+
+		up_path, down_path, err := migrations.Create("migrations", args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] failed to create migration:", err)
+			return 1
+		}
+
+		fmt.Println("Created", up_path)
+		fmt.Println("Created", down_path)
+		return 0
+	}
+
+	pg := repository.NewPostgres()
+	defer pg.Close()
+
+	migrator, err := migrations.NewMigrator(pg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[ERROR] [migrate] failed to load embedded migrations:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		adopted, err := migrator.Adopt(ctx)
+		for _, migration := range adopted {
+			fmt.Printf("Adopted %d_%s, created before migrations\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] adopting the existing schema failed:", err)
+			return 1
+		}
+
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] up failed:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "down":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrate_usage)
+			return 2
+		}
+		steps, err := strconv.Atoi(args[1])
+		if err != nil || steps < 1 {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] N must be a positive integer")
+			return 2
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] down failed:", err)
+			return 1
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] [migrate] status failed:", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			applied_at := "-"
+			if status.AppliedAt != nil {
+				applied_at = status.AppliedAt.Format(time_format)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, status.State, applied_at)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrate_usage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"broke-bank/utils"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const receipts_usage = `Usage:
+  broke-bank receipts keygen   print a new RECEIPT_SIGNING_KEY, with its key id and public key
+  broke-bank receipts keys     print the key id and public key of the current RECEIPT_SIGNING_KEY
+
+To rotate the signing key, append the current public key to RECEIPT_RETIRED_KEYS, so that the
+receipts it signed stay verifiable, then replace RECEIPT_SIGNING_KEY with a new one.`
+
+func runReceipts(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(receipts_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "keygen":
+		return receiptsKeygen(args[1:])
+	case "keys":
+		return receiptsKeys(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown receipts command %q\n\n%s\n", args[0], receipts_usage)
+		return 2
+	}
+}
+
+type signingKey struct {
+	KeyId     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+func renderSigningKey(opts *options, signer *utils.Signer) error {
+	key := signingKey{KeyId: signer.KeyId, PublicKey: base64.StdEncoding.EncodeToString(signer.PublicKey())}
+	return render(opts, key, []string{"KEY ID", "PUBLIC KEY"}, [][]string{{key.KeyId, key.PublicKey}})
+}
+
+func receiptsKeygen(args []string) int {
+	fs, opts := newFlagSet("receipts keygen", false)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("receipts keygen", err, receipts_usage)
+	}
+
+	seed, err := utils.GenerateSigningKey()
+	if err != nil {
+		return fail("receipts keygen", err)
+	}
+	signer, err := utils.ParseSigningKey(seed)
+	if err != nil {
+		return fail("receipts keygen", err)
+	}
+
+	// The secret goes to stderr, so that the output can be shared.
+	fmt.Fprintf(os.Stderr, "RECEIPT_SIGNING_KEY=%s\n", seed)
+	if err = renderSigningKey(opts, signer); err != nil {
+		return fail("receipts keygen", err)
+	}
+
+	return 0
+}
+
+func receiptsKeys(args []string) int {
+	fs, opts := newFlagSet("receipts keys", false)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("receipts keys", err, receipts_usage)
+	}
+
+	signer, err := utils.SignerFromEnv("RECEIPT_SIGNING_KEY")
+	if err != nil {
+		return fail("receipts keys", err)
+	}
+	if signer == nil {
+		return fail("receipts keys", errors.New("missing RECEIPT_SIGNING_KEY env"))
+	}
+
+	if err = renderSigningKey(opts, signer); err != nil {
+		return fail("receipts keys", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"broke-bank/repository"
+	"context"
+	"fmt"
+	"os"
+)
+
+const reconcile_usage = `Usage:
+  broke-bank reconcile   list accounts whose balance doesn't match their transactions (exits 1 if any)`
+
+func runReconcile(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("reconcile", false)
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("reconcile", err, reconcile_usage)
+	}
+
+	repos := repository.New()
+
+	mismatches, err := repos.TransactionRepository.Reconcile(ctx)
+	if err != nil {
+		return fail("reconcile", err)
+	}
+
+	rows := [][]string{}
+	for _, mismatch := range *mismatches {
+		rows = append(rows, []string{
+			mismatch.Id.String(),
+			mismatch.Balance.StringFixed(2),
+			mismatch.ExpectedBalance.StringFixed(2),
+			mismatch.Balance.Sub(mismatch.ExpectedBalance).StringFixed(2),
+		})
+	}
+
+	if opts.output == "table" && len(rows) == 0 {
+		fmt.Println("All balances match their transactions")
+		return 0
+	}
+
+	if err = render(opts, mismatches, []string{"ACCOUNT ID", "BALANCE", "EXPECTED", "DIFFERENCE"}, rows); err != nil {
+		return fail("reconcile", err)
+	}
+
+	if len(rows) > 0 {
+		fmt.Fprintf(os.Stderr, "%d account(s) out of balance\n", len(rows))
+		return 1
+	}
+
+	return 0
+}
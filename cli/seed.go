@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"broke-bank/repository"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const seed_usage = `Usage:
+  broke-bank seed [--users N] [--accounts N] [--balance AMOUNT] [--password P]
+      create demo users, each with accounts funded through regular deposits`
+
+type SeededAccount struct {
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	UserId    uuid.UUID `json:"user_id"`
+	AccountId uuid.UUID `json:"account_id"`
+	Balance   string    `json:"balance"`
+}
+
+func runSeed(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("seed", false)
+	users := fs.Int("users", 3, "number of users to create")
+	accounts := fs.Int("accounts", 2, "accounts per user")
+	raw_balance := fs.String("balance", "1000.00", "initial balance of each account")
+	password := fs.String("password", "password123", "password of every seeded user")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("seed", err, seed_usage)
+	}
+
+	balance, err := decimal.NewFromString(*raw_balance)
+	if err != nil || balance.IsNegative() {
+		return usageError("seed", fmt.Errorf("invalid --balance %q", *raw_balance), seed_usage)
+	}
+	if *users < 1 || *accounts < 1 || len(*password) < 8 {
+		return usageError("seed", fmt.Errorf("--users must be positive, --accounts positive and --password at least 8 characters"), seed_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	encrypted_password, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return fail("seed", err)
+	}
+
+	// Suffix emails with the current time so seeding can be run repeatedly against the same database.
+	batch := strconv.FormatInt(time.Now().Unix(), 10)
+	seeded := []SeededAccount{}
+
+	for i := 1; i <= *users; i++ {
+		email := fmt.Sprintf("seed-%s-%d@broke.bank", batch, i)
+		if err = repos.UserRepository.CreateUser(ctx, email, string(encrypted_password)); err != nil {
+			return fail("seed", err)
+		}
+
+		user, err := repos.UserRepository.GetUserByEmail(ctx, email)
+		if err != nil {
+			return fail("seed", err)
+		}
+
+		for j := 1; j <= *accounts; j++ {
+			if err = repos.AccountRepository.CreateAccount(ctx, user.Id.String(), fmt.Sprintf("Seed account %d", j), "active"); err != nil {
+				return fail("seed", err)
+			}
+		}
+
+		created, err := repos.AccountRepository.GetMyAccounts(ctx, user.Id.String(), *accounts, 0)
+		if err != nil {
+			return fail("seed", err)
+		}
+
+		for _, account := range *created {
+			if balance.IsPositive() {
+				transaction_id, err := uuid.NewV7()
+				if err != nil {
+					return fail("seed", err)
+				}
+				if err = repos.TransactionRepository.DepositTransaction(ctx, transaction_id, account.Id.String(), balance); err != nil {
+					return fail("seed", err)
+				}
+			}
+
+			seeded = append(seeded, SeededAccount{Email: email, Password: *password, UserId: user.Id, AccountId: account.Id, Balance: balance.StringFixed(2)})
+		}
+	}
+
+	rows := [][]string{}
+	for _, account := range seeded {
+		rows = append(rows, []string{account.Email, account.UserId.String(), account.AccountId.String(), account.Balance})
+	}
+
+	if err = render(opts, seeded, []string{"EMAIL", "USER ID", "ACCOUNT ID", "BALANCE"}, rows); err != nil {
+		return fail("seed", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const session_usage = `Usage:
+  broke-bank session revoke SESSION_ID --reason R          revoke a single session
+  broke-bank session revoke --user EMAIL|ID --reason R     revoke every session of a user`
+
+func runSession(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] != "revoke" {
+		fmt.Println(session_usage)
+		return 2
+	}
+
+	fs, opts := newFlagSet("session revoke", true)
+	user_ref := fs.String("user", "", "revoke every session of this user instead of a single one")
+
+	positional, err := parseArgs(fs, opts, args[1:], -1)
+	single := *user_ref == "" && len(positional) == 1
+	all := *user_ref != "" && len(positional) == 0
+	if err == nil && !single && !all {
+		err = errors.New("expected either a SESSION_ID or --user")
+	}
+	if err != nil {
+		return usageError("session revoke", err, session_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	if *user_ref != "" {
+		user, err := findUser(ctx, &repos, *user_ref)
+		if err != nil {
+			return fail("session revoke", err)
+		}
+
+		revoked, err := repos.SessionRepository.RevokeUserSessions(ctx, user.Id.String())
+		if err != nil {
+			return fail("session revoke", err)
+		}
+
+		if err = audit(ctx, &repos, model.AuditEvent{Action: "session.revoke_all", TargetType: "user", TargetId: user.Id.String(), UserId: &user.Id}, map[string]any{"revoked_sessions": revoked}); err != nil {
+			return fail("session revoke", err)
+		}
+
+		result := map[string]any{"user_id": user.Id, "revoked_sessions": revoked}
+		if err = render(opts, result, []string{"USER ID", "REVOKED SESSIONS"}, [][]string{{user.Id.String(), strconv.Itoa(revoked)}}); err != nil {
+			return fail("session revoke", err)
+		}
+
+		return 0
+	}
+
+	session_id := positional[0]
+	user_id, err := repos.SessionRepository.GetSessionUserId(ctx, session_id)
+	if err != nil {
+		return fail("session revoke", errors.New("session not found or already expired"))
+	}
+
+	if err = repos.SessionRepository.RevokeSession(ctx, session_id); err != nil {
+		return fail("session revoke", err)
+	}
+
+	event := model.AuditEvent{Action: "session.revoke", TargetType: "session", TargetId: session_id}
+	if id, err := uuid.Parse(user_id); err == nil {
+		event.UserId = &id
+	}
+	if err = audit(ctx, &repos, event, map[string]any{"user_id": user_id}); err != nil {
+		return fail("session revoke", err)
+	}
+
+	result := map[string]any{"session_id": session_id, "user_id": user_id}
+	if err = render(opts, result, []string{"SESSION ID", "USER ID"}, [][]string{{session_id, user_id}}); err != nil {
+		return fail("session revoke", err)
+	}
+
+	return 0
+}
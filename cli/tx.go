@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const tx_usage = `Usage:
+  broke-bank tx show ID                                    show a transaction
+  broke-bank tx list ACCOUNT_ID [--limit N] [--offset N]   list an account's transactions, newest first
+  broke-bank tx reverse ID --reason R --evidence E         propose a compensating transaction, posted once other
+      --staff EMAIL|USER_ID                                staff approve it`
+
+func runTx(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(tx_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "show":
+		return txShow(ctx, args[1:])
+	case "list":
+		return txList(ctx, args[1:])
+	case "reverse":
+		return txReverse(ctx, args[1:])
+	default:
+		fmt.Println(tx_usage)
+		return 2
+	}
+}
+
+var transaction_headers = []string{"ID", "TYPE", "FROM", "TO", "AMOUNT", "DATE ISSUED", "REVERSAL OF"}
+
+func transactionRows(transactions []model.Transaction) [][]string {
+	rows := [][]string{}
+	for _, tx := range transactions {
+		rows = append(rows, []string{
+			tx.Id.String(),
+			tx.Type,
+			optionalUUID(tx.FromAccountId),
+			optionalUUID(tx.ToAccountId),
+			tx.Amount.StringFixed(2),
+			tx.DateIssued.Format(time_format),
+			optionalUUID(tx.ReversalOf),
+		})
+	}
+
+	return rows
+}
+
+func getTransaction(ctx context.Context, repos *repository.Repositories, transaction_id string) (*model.Transaction, error) {
+	if _, err := uuid.Parse(transaction_id); err != nil {
+		return nil, fmt.Errorf("invalid transaction id %q", transaction_id)
+	}
+
+	transaction, err := repos.TransactionRepository.GetTransaction(ctx, transaction_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("transaction %s not found", transaction_id)
+	}
+
+	return transaction, err
+}
+
+func txShow(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("tx show", false)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("tx show", err, tx_usage)
+	}
+
+	repos := repository.New()
+
+	transaction, err := getTransaction(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("tx show", err)
+	}
+
+	if err = render(opts, transaction, transaction_headers, transactionRows([]model.Transaction{*transaction})); err != nil {
+		return fail("tx show", err)
+	}
+
+	return 0
+}
+
+func txList(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("tx list", false)
+	limit, offset := paginationFlags(fs)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("tx list", err, tx_usage)
+	}
+
+	repos := repository.New()
+
+	account, err := getAccount(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("tx list", err)
+	}
+
+	transactions, err := repos.TransactionRepository.GetAccountTransactions(ctx, account.Id.String(), *limit, *offset)
+	if err != nil {
+		return fail("tx list", err)
+	}
+
+	if err = render(opts, transactions, transaction_headers, transactionRows(*transactions)); err != nil {
+		return fail("tx list", err)
+	}
+
+	return 0
+}
+
+// txReverse proposes an adjustment that, once approved, posts the reversal of a transaction.
+func txReverse(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("tx reverse", true)
+	evidence := fs.String("evidence", "", "what supports the reversal, such as a ticket (required)")
+	staff_ref := fs.String("staff", "", "email or id of the staff member proposing it (required)")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("tx reverse", err, tx_usage)
+	}
+	if strings.TrimSpace(*evidence) == "" || *staff_ref == "" {
+		return usageError("tx reverse", errors.New("--evidence and --staff are required"), tx_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	original, err := getTransaction(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("tx reverse", err)
+	}
+	if original.ReversalOf != nil {
+		return fail("tx reverse", repository.ErrReversalOfReversal)
+	}
+	if _, err = repos.TransactionRepository.GetReversal(ctx, original.Id.String()); err == nil {
+		return fail("tx reverse", repository.ErrAlreadyReversed)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fail("tx reverse", err)
+	}
+
+	// The adjustment records the reversal's effect on the account it takes the money back from, or gives it back to for withdrawals.
+	adjustment := model.Adjustment{
+		Reason:     strings.TrimSpace(opts.reason),
+		Evidence:   strings.TrimSpace(*evidence),
+		ReversalOf: &original.Id,
+	}
+	if original.ToAccountId != nil {
+		adjustment.AccountId, adjustment.Amount = *original.ToAccountId, original.Amount.Neg()
+	} else {
+		adjustment.AccountId, adjustment.Amount = *original.FromAccountId, original.Amount
+	}
+
+	proposed, err := proposeAdjustment(ctx, &repos, *staff_ref, adjustment)
+	if err != nil {
+		return fail("tx reverse", err)
+	}
+
+	if err = render(opts, proposed, adjustment_headers, adjustmentRows([]model.Adjustment{*proposed})); err != nil {
+		return fail("tx reverse", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const user_usage = `Usage:
+  broke-bank user create EMAIL [--password P]     create a user (a random password is printed when omitted)
+  broke-bank user find EMAIL|ID                   show a user
+  broke-bank user disable EMAIL|ID --reason R     block the user from logging in and revoke their sessions
+  broke-bank user role EMAIL|ID ROLE --reason R   set the role of a user: customer, support, compliance or admin`
+
+func runUser(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(user_usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		return userCreate(ctx, args[1:])
+	case "find":
+		return userFind(ctx, args[1:])
+	case "disable":
+		return userDisable(ctx, args[1:])
+	case "role":
+		return userRole(ctx, args[1:])
+	default:
+		fmt.Println(user_usage)
+		return 2
+	}
+}
+
+type UserOutput struct {
+	model.User
+	// Only set by `user create` when the password was generated.
+	Password string `json:"password,omitempty"`
+}
+
+func renderUser(opts *options, user UserOutput) error {
+	row := []string{user.Id.String(), user.Email, user.Role, optionalTime(user.DisabledAt), user.CreatedAt.Format(time_format)}
+	headers := []string{"ID", "EMAIL", "ROLE", "DISABLED AT", "CREATED AT"}
+	if user.Password != "" {
+		headers = append(headers, "PASSWORD")
+		row = append(row, user.Password)
+	}
+
+	return render(opts, user, headers, [][]string{row})
+}
+
+func userCreate(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("user create", false)
+	password := fs.String("password", "", "password, at least 8 characters")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("user create", err, user_usage)
+	}
+	email := positional[0]
+
+	generated := ""
+	if *password == "" {
+		raw := make([]byte, 12)
+		if _, err = rand.Read(raw); err != nil {
+			return fail("user create", err)
+		}
+		generated = base64.RawURLEncoding.EncodeToString(raw)
+		*password = generated
+	}
+	if len(*password) < 8 {
+		return usageError("user create", errors.New("--password must have at least 8 characters"), user_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	_, err = repos.UserRepository.GetUserByEmail(ctx, email)
+	if err == nil {
+		return fail("user create", fmt.Errorf("email %q is already registered", email))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fail("user create", err)
+	}
+
+	encrypted_password, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return fail("user create", err)
+	}
+
+	if err = repos.UserRepository.CreateUser(ctx, email, string(encrypted_password)); err != nil {
+		return fail("user create", err)
+	}
+
+	user, err := repos.UserRepository.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fail("user create", err)
+	}
+
+	if err = renderUser(opts, UserOutput{User: *user, Password: generated}); err != nil {
+		return fail("user create", err)
+	}
+
+	return 0
+}
+
+func userFind(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("user find", false)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("user find", err, user_usage)
+	}
+
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("user find", err)
+	}
+
+	if err = renderUser(opts, UserOutput{User: *user}); err != nil {
+		return fail("user find", err)
+	}
+
+	return 0
+}
+
+func userDisable(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("user disable", true)
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("user disable", err, user_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("user disable", err)
+	}
+
+	if user.DisabledAt != nil {
+		return fail("user disable", fmt.Errorf("user %s is already disabled", user.Email))
+	}
+
+	if err = repos.UserRepository.DisableUser(ctx, user.Id); err != nil {
+		return fail("user disable", err)
+	}
+
+	revoked, err := repos.SessionRepository.RevokeUserSessions(ctx, user.Id.String())
+	if err != nil {
+		return fail("user disable", fmt.Errorf("user disabled but revoking sessions failed: %w", err))
+	}
+
+	if err = audit(ctx, &repos, model.AuditEvent{Action: "session.revoke_all", TargetType: "user", TargetId: user.Id.String(), UserId: &user.Id}, map[string]any{"revoked_sessions": revoked}); err != nil {
+		return fail("user disable", err)
+	}
+
+	user, err = repos.UserRepository.GetUserById(ctx, user.Id)
+	if err != nil {
+		return fail("user disable", err)
+	}
+
+	if err = renderUser(opts, UserOutput{User: *user}); err != nil {
+		return fail("user disable", err)
+	}
+
+	return 0
+}
+
+// userRole is how the first admin is made, later ones can be made through the admin API.
+func userRole(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("user role", true)
+	positional, err := parseArgs(fs, opts, args, 2)
+	if err != nil {
+		return usageError("user role", err, user_usage)
+	}
+	role := positional[1]
+	if !slices.Contains(model.Roles, role) {
+		return usageError("user role", fmt.Errorf("unknown role %q", role), user_usage)
+	}
+
+	ctx = actorContext(ctx, opts)
+	repos := repository.New()
+
+	user, err := findUser(ctx, &repos, positional[0])
+	if err != nil {
+		return fail("user role", err)
+	}
+
+	if user.Role == role {
+		return fail("user role", fmt.Errorf("user %s already has role %s", user.Email, role))
+	}
+
+	if err = repos.UserRepository.SetUserRole(ctx, user.Id, role); err != nil {
+		return fail("user role", err)
+	}
+
+	user.Role = role
+	if err = renderUser(opts, UserOutput{User: *user}); err != nil {
+		return fail("user role", err)
+	}
+
+	return 0
+}
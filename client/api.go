@@ -0,0 +1,117 @@
+package client
+
+import (
+	"broke-bank/server"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+func (c *Client) Register(ctx context.Context, req server.RegisterRequest) error {
+	_, err := c.do(ctx, request{method: "POST", path: "/register", body: req})
+	return err
+}
+
+// Login starts a session used by the following requests, see SessionId.
+func (c *Client) Login(ctx context.Context, req server.LoginRequest) error {
+	resp, err := c.do(ctx, request{method: "POST", path: "/login", body: req})
+	if err != nil {
+		return err
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "sessionId" {
+			c.SetSessionId(cookie.Value)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("login response did not set a session")
+}
+
+func (c *Client) Me(ctx context.Context) (*server.MeResponse, error) {
+	me := new(server.MeResponse)
+	_, err := c.do(ctx, request{method: "GET", path: "/me", out: me})
+	return me, err
+}
+
+func (c *Client) GetMyAccounts(ctx context.Context, limit int, offset int) ([]server.GetAccountsResponse, error) {
+	query := url.Values{"limit": {fmt.Sprint(limit)}, "offset": {fmt.Sprint(offset)}}
+	accounts := []server.GetAccountsResponse{}
+	_, err := c.do(ctx, request{method: "GET", path: "/myAccounts?" + query.Encode(), out: &accounts})
+	return accounts, err
+}
+
+func (c *Client) GetAccount(ctx context.Context, account_id string) (*server.GetAccountResponse, error) {
+	account := new(server.GetAccountResponse)
+	_, err := c.do(ctx, request{method: "GET", path: "/account/" + url.PathEscape(account_id), out: account})
+	return account, err
+}
+
+// CreateAccount isn't retried: the API has no way to tell whether a failed attempt created the account.
+func (c *Client) CreateAccount(ctx context.Context, req server.CreateAccountRequest) error {
+	_, err := c.do(ctx, request{method: "POST", path: "/account/create", body: req})
+	return err
+}
+
+func (c *Client) DisableAccount(ctx context.Context, account_id string) error {
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: "/account/disable/" + url.PathEscape(account_id)})
+	return err
+}
+
+// CloseAccount isn't retried: when a failed attempt went through anyway, a retry would fail with ErrConflict.
+func (c *Client) CloseAccount(ctx context.Context, account_id string, req server.CloseAccountRequest) (*server.CloseAccountResponse, error) {
+	closed := new(server.CloseAccountResponse)
+	_, err := c.do(ctx, request{method: "POST", path: "/account/" + url.PathEscape(account_id) + "/close", body: req, out: closed})
+	return closed, err
+}
+
+func (c *Client) ReopenAccount(ctx context.Context, account_id string) (*server.GetAccountResponse, error) {
+	account := new(server.GetAccountResponse)
+	_, err := c.do(ctx, request{method: "POST", path: "/account/" + url.PathEscape(account_id) + "/reopen", out: account})
+	return account, err
+}
+
+// GetAccountTransactions returns an account's transactions, newest first.
+func (c *Client) GetAccountTransactions(ctx context.Context, account_id string, limit int, offset int) ([]server.GetTransactionResponse, error) {
+	query := url.Values{"limit": {fmt.Sprint(limit)}, "offset": {fmt.Sprint(offset)}}
+	transactions := []server.GetTransactionResponse{}
+	_, err := c.do(ctx, request{method: "GET", path: "/account/" + url.PathEscape(account_id) + "/transactions?" + query.Encode(), out: &transactions})
+	return transactions, err
+}
+
+// GetTransaction returns the /v2 representation of a transaction.
+func (c *Client) GetTransaction(ctx context.Context, transaction_id string) (*server.GetTransactionResponse, error) {
+	transaction := new(server.GetTransactionResponse)
+	_, err := c.do(ctx, request{method: "GET", path: "/transaction/" + url.PathEscape(transaction_id), out: transaction})
+	return transaction, err
+}
+
+/*
+Money movements are sent with an idempotency key, so they are retried on network errors and
+503s without risking moving money twice. An empty idempotency_key generates one per call;
+pass your own to also make retries across calls (or process restarts) safe.
+*/
+func (c *Client) movement(ctx context.Context, kind string, body any, idempotency_key string) error {
+	if idempotency_key == "" {
+		idempotency_key = uuid.NewString()
+	}
+
+	_, err := c.do(ctx, request{method: "POST", path: "/transaction/" + kind, body: body, idempotency_key: idempotency_key})
+	return err
+}
+
+func (c *Client) DepositTransaction(ctx context.Context, req server.DepositTransactionRequest, idempotency_key string) error {
+	return c.movement(ctx, "deposit", req, idempotency_key)
+}
+
+func (c *Client) WithdrawalTransaction(ctx context.Context, req server.WithdrawalTransactionRequest, idempotency_key string) error {
+	return c.movement(ctx, "withdrawal", req, idempotency_key)
+}
+
+func (c *Client) TransferTransaction(ctx context.Context, req server.TransferTransactionRequest, idempotency_key string) error {
+	return c.movement(ctx, "transfer", req, idempotency_key)
+}
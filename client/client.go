@@ -0,0 +1,191 @@
+/*
+Package client is a Go SDK for the Broke Bank API.
+
+	c := client.New("http://localhost:5000")
+	if err := c.Login(ctx, server.LoginRequest{Email: email, Password: password}); err != nil {
+		...
+	}
+	accounts, err := c.GetMyAccounts(ctx, 10, 0)
+
+Requests authenticate with an API key when ApiKey is set, and with the session started by
+Login otherwise. Failed requests return an *Error, which can be matched against the Err*
+values with errors.Is.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	// Scheme and host of the API, e.g. "http://localhost:5000".
+	BaseURL string
+	// API version prefix. Typed responses match "/v2".
+	Version string
+	// Sent as X-Api-Key when set, in place of the session cookie.
+	ApiKey     string
+	HTTPClient *http.Client
+	// Attempts after the first one, for requests that are safe to retry.
+	MaxRetries int
+	// First delay of the exponential backoff between attempts, unless the server sends Retry-After.
+	RetryBackoff time.Duration
+
+	mu         sync.Mutex
+	session_id string
+}
+
+func New(base_url string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(base_url, "/"),
+		Version:      "/v2",
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   3,
+		RetryBackoff: 200 * time.Millisecond,
+	}
+}
+
+// SessionId returns the session started by Login, e.g. to persist it between runs.
+func (c *Client) SessionId() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.session_id
+}
+
+// SetSessionId resumes a session returned by SessionId.
+func (c *Client) SetSessionId(session_id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.session_id = session_id
+}
+
+type request struct {
+	method string
+	path   string
+	body   any
+	// Sent as Idempotency-Key, which makes retrying a POST safe.
+	idempotency_key string
+	// Decoded from the "payload" of the response.
+	out any
+}
+
+// retryable reports whether req may be sent again after a failed attempt, where err is a transport error.
+func (req *request) retryable(resp *http.Response, err error) bool {
+	// Rate limited requests are rejected before reaching any handler.
+	if resp != nil && resp.StatusCode == 429 {
+		return true
+	}
+
+	if req.method != "GET" && req.idempotency_key == "" {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case 502, 503, 504:
+		return true
+	}
+
+	return false
+}
+
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	delay := c.RetryBackoff << attempt
+	// Up to 20% of jitter, so that clients failing together don't retry together.
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	var raw_body []byte
+	if req.body != nil {
+		var err error
+		if raw_body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, raw_body)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, c.decode(resp, req.out)
+		}
+
+		retry := attempt < c.MaxRetries && ctx.Err() == nil && req.retryable(resp, err)
+		if err == nil {
+			err = newError(resp)
+		}
+		if !retry {
+			return resp, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(c.backoff(attempt, resp)):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, raw_body []byte) (*http.Response, error) {
+	http_req, err := http.NewRequestWithContext(ctx, req.method, c.BaseURL+c.Version+req.path, bytes.NewReader(raw_body))
+	if err != nil {
+		return nil, err
+	}
+
+	http_req.Header.Set("Accept", "application/json")
+	if raw_body != nil {
+		http_req.Header.Set("Content-Type", "application/json")
+	}
+	if req.idempotency_key != "" {
+		http_req.Header.Set("Idempotency-Key", req.idempotency_key)
+	}
+	if c.ApiKey != "" {
+		http_req.Header.Set("X-Api-Key", c.ApiKey)
+	} else if session_id := c.SessionId(); session_id != "" {
+		http_req.AddCookie(&http.Cookie{Name: "sessionId", Value: session_id})
+	}
+
+	return c.HTTPClient.Do(http_req)
+}
+
+func (c *Client) decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	body := struct {
+		Payload json.RawMessage `json:"payload"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid response body: %w", err)
+	}
+	if len(body.Payload) == 0 {
+		return errors.New("invalid response body: missing payload")
+	}
+
+	return json.Unmarshal(body.Payload, out)
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"broke-bank/repository/memory"
+	"broke-bank/server"
+	"broke-bank/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+func newTestServer(t *testing.T) (*server.Server, *httptest.Server) {
+	t.Helper()
+	t.Setenv("ACCESS_CONTROL_ORIGIN", "http://localhost")
+	gin.SetMode(gin.TestMode)
+
+	s := &server.Server{Repositories: memory.New(), Sandbox: true}
+	ts := httptest.NewServer(s.SetupRouter())
+	t.Cleanup(ts.Close)
+
+	return s, ts
+}
+
+func signUp(t *testing.T, base_url string, email string) *Client {
+	t.Helper()
+
+	c := New(base_url)
+	credentials := server.RegisterRequest{Email: email, Password: "password123"}
+	if err := c.Register(context.Background(), credentials); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login(context.Background(), server.LoginRequest(credentials)); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func createAccount(t *testing.T, c *Client, name string) string {
+	t.Helper()
+
+	if err := c.CreateAccount(context.Background(), server.CreateAccountRequest{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := c.GetMyAccounts(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if account.Name == name {
+			return account.Id.String()
+		}
+	}
+
+	t.Fatalf("account %q not found", name)
+	return ""
+}
+
+func TestSession(t *testing.T) {
+	_, ts := newTestServer(t)
+	ctx := context.Background()
+	c := signUp(t, ts.URL, "alice@broke.bank")
+
+	me, err := c.Me(ctx)
+	if err != nil || me.Email != "alice@broke.bank" {
+		t.Fatalf("Me = %+v, %v", me, err)
+	}
+
+	// A session can be handed over to another client, e.g. one started by a later run.
+	resumed := New(ts.URL)
+	resumed.SetSessionId(c.SessionId())
+	if _, err = resumed.Me(ctx); err != nil {
+		t.Fatalf("Me with a resumed session = %v", err)
+	}
+
+	anonymous := New(ts.URL)
+	if _, err = anonymous.Me(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Me without session = %v, want ErrUnauthorized", err)
+	}
+	if err = anonymous.Register(ctx, server.RegisterRequest{Email: "alice@broke.bank", Password: "password123"}); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("Register with a taken email = %v, want ErrEmailTaken", err)
+	}
+	if err = anonymous.Login(ctx, server.LoginRequest{Email: "alice@broke.bank", Password: "wrong-password"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login with a wrong password = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestMoneyMovements(t *testing.T) {
+	_, ts := newTestServer(t)
+	ctx := context.Background()
+	alice := signUp(t, ts.URL, "alice@broke.bank")
+	bob := signUp(t, ts.URL, "bob@broke.bank")
+
+	checking := createAccount(t, alice, "Checking")
+	savings := createAccount(t, bob, "Savings")
+
+	if err := alice.DepositTransaction(ctx, server.DepositTransactionRequest{Amount: decimal.RequireFromString("100"), ToAccountId: checking}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.WithdrawalTransaction(ctx, server.WithdrawalTransactionRequest{Amount: decimal.RequireFromString("10"), FromAccountId: checking}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.TransferTransaction(ctx, server.TransferTransactionRequest{Amount: decimal.RequireFromString("25.50"), FromAccountId: checking, ToAccountId: savings}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := alice.GetAccount(ctx, checking)
+	if err != nil || account.Balance != "64.50" {
+		t.Fatalf("GetAccount = %+v, %v", account, err)
+	}
+
+	history, err := alice.GetAccountTransactions(ctx, checking, 10, 0)
+	if err != nil || len(history) != 3 || history[0].Type != "transfer" || history[2].Amount != "100.00" {
+		t.Fatalf("GetAccountTransactions = %+v, %v", history, err)
+	}
+	if _, err = bob.GetAccountTransactions(ctx, checking, 10, 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAccountTransactions of someone else's account = %v, want ErrNotFound", err)
+	}
+
+	err = alice.TransferTransaction(ctx, server.TransferTransactionRequest{Amount: decimal.RequireFromString("1000"), FromAccountId: checking, ToAccountId: savings}, "")
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("transfer above the balance = %v, want ErrInsufficientBalance", err)
+	}
+	err = bob.WithdrawalTransaction(ctx, server.WithdrawalTransactionRequest{Amount: decimal.RequireFromString("1"), FromAccountId: checking}, "")
+	if !errors.Is(err, ErrNotAccountOwner) {
+		t.Fatalf("withdrawal from someone else's account = %v, want ErrNotAccountOwner", err)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	_, ts := newTestServer(t)
+	ctx := context.Background()
+	alice := signUp(t, ts.URL, "alice@broke.bank")
+	checking := createAccount(t, alice, "Checking")
+
+	deposit := server.DepositTransactionRequest{Amount: decimal.RequireFromString("40"), ToAccountId: checking}
+	for i := 0; i < 2; i++ {
+		if err := alice.DepositTransaction(ctx, deposit, "salary-2026-10"); err != nil {
+			t.Fatalf("deposit attempt %d = %v", i+1, err)
+		}
+	}
+
+	account, err := alice.GetAccount(ctx, checking)
+	if err != nil || account.Balance != "40.00" {
+		t.Fatalf("balance after a replayed deposit = %+v, %v", account, err)
+	}
+
+	deposit.Amount = decimal.RequireFromString("41")
+	if err = alice.DepositTransaction(ctx, deposit, "salary-2026-10"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("deposit with a reused key = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestApiKey(t *testing.T) {
+	s, ts := newTestServer(t)
+	ctx := context.Background()
+	signUp(t, ts.URL, "alice@broke.bank")
+
+	user, err := s.Repositories.UserRepository.GetUserByEmail(ctx, "alice@broke.bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, prefix, hash, err := utils.GenerateApiKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api_key, err := s.Repositories.ApiKeyRepository.CreateApiKey(ctx, user.Id, "ci", hash, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(ts.URL)
+	c.ApiKey = key
+	if me, err := c.Me(ctx); err != nil || me.Email != "alice@broke.bank" {
+		t.Fatalf("Me with an API key = %+v, %v", me, err)
+	}
+
+	if err = s.Repositories.ApiKeyRepository.RevokeApiKey(ctx, api_key.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Me(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Me with a revoked API key = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(429)
+			w.Write([]byte(`{"error": "Too many requests"}`))
+		case 2:
+			w.WriteHeader(503)
+		default:
+			w.Write([]byte(`{"payload": {"user_email": "alice@broke.bank"}}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL)
+	c.RetryBackoff = time.Millisecond
+	if me, err := c.Me(context.Background()); err != nil || me.Email != "alice@broke.bank" || attempts.Load() != 3 {
+		t.Fatalf("Me = %+v, %v after %d attempts", me, err, attempts.Load())
+	}
+
+	// Without an idempotency key a failed POST may have been applied, so it isn't retried.
+	attempts.Store(1)
+	err := c.CreateAccount(context.Background(), server.CreateAccountRequest{Name: "Checking"})
+	if !errors.Is(err, ErrUnavailable) || attempts.Load() != 2 {
+		t.Fatalf("CreateAccount = %v after %d attempts, want a single ErrUnavailable", err, attempts.Load()-1)
+	}
+
+	attempts.Store(1)
+	err = c.DepositTransaction(context.Background(), server.DepositTransactionRequest{}, "")
+	if err != nil || attempts.Load() != 3 {
+		t.Fatalf("DepositTransaction = %v after %d attempts", err, attempts.Load()-1)
+	}
+
+	c.MaxRetries = 0
+	attempts.Store(0)
+	var client_err *Error
+	if _, err = c.Me(context.Background()); !errors.As(err, &client_err) || !errors.Is(err, ErrRateLimited) || client_err.Message != "Too many requests" {
+		t.Fatalf("Me without retries = %#v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error is returned for every response with a 4xx or 5xx status.
+type Error struct {
+	StatusCode int
+	// The server's "error" (or "message") field.
+	Message string
+	// Set from the Retry-After header of 429 and 503 responses.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("broke bank: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("broke bank: %d %s", e.StatusCode, e.Message)
+}
+
+// Errors matched by status code.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrGone         = errors.New("api version is no longer available")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// Errors matched by the server's error message, which is more specific than the status code.
+var (
+	ErrEmailTaken           = errors.New("email already registered")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrUserDisabled         = errors.New("user is disabled")
+	ErrNotAccountOwner      = errors.New("account does not belong to the user")
+	ErrInsufficientBalance  = errors.New("insufficient account balance")
+	ErrAccountBusy          = errors.New("account is busy")
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+)
+
+var status_errors = map[int]error{
+	401: ErrUnauthorized,
+	403: ErrForbidden,
+	404: ErrNotFound,
+	409: ErrConflict,
+	410: ErrGone,
+	422: ErrInvalidInput,
+	429: ErrRateLimited,
+	503: ErrUnavailable,
+}
+
+var message_errors = map[string]error{
+	"Email already registered":                        ErrEmailTaken,
+	"Email not registered":                            ErrInvalidCredentials,
+	"Wrong password":                                  ErrInvalidCredentials,
+	"User is disabled":                                ErrUserDisabled,
+	"This account does not belongs to the user":       ErrNotAccountOwner,
+	"Insufficient account balance":                    ErrInsufficientBalance,
+	"Account is busy, try again later":                ErrAccountBusy,
+	"Idempotency key reused with a different request": ErrIdempotencyKeyReused,
+}
+
+func (e *Error) Is(target error) bool {
+	return status_errors[e.StatusCode] == target || message_errors[e.Message] == target
+}
+
+func newError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	e := &Error{StatusCode: resp.StatusCode}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	body := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{}
+	if raw, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(raw, &body) == nil {
+		e.Message = body.Error
+		if e.Message == "" {
+			e.Message = body.Message
+		}
+	}
+
+	return e
+}
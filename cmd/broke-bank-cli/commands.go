@@ -0,0 +1,329 @@
+package main
+
+import (
+	"broke-bank/server"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const credentials_usage = `Usage:
+  broke-bank-cli register|login [--email EMAIL] [--password-stdin]
+
+The password is read from BROKE_BANK_PASSWORD, from stdin with --password-stdin, or prompted for.`
+
+// credentials reads the email and password from flags, the environment or the terminal.
+func credentials(email string, password_stdin bool) (string, string, error) {
+	var err error
+	if email == "" {
+		if email, err = prompt("Email: "); err != nil {
+			return "", "", err
+		}
+	}
+
+	password, ok := os.LookupEnv("BROKE_BANK_PASSWORD")
+	if password_stdin {
+		password, err = prompt("")
+	} else if !ok {
+		password, err = prompt("Password: ")
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if email == "" || password == "" {
+		return "", "", errors.New("email and password are required")
+	}
+
+	return email, password, nil
+}
+
+func runRegister(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("register")
+	email := fs.String("email", "", "email of the new user")
+	password_stdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("register", err, credentials_usage)
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("register", err)
+	}
+
+	address, password, err := credentials(*email, *password_stdin)
+	if err != nil {
+		return fail("register", err)
+	}
+
+	if err = c.Register(ctx, server.RegisterRequest{Email: address, Password: password}); err != nil {
+		return fail("register", err)
+	}
+
+	if err = render(opts, map[string]any{"email": address}, []string{"REGISTERED"}, [][]string{{address}}); err != nil {
+		return fail("register", err)
+	}
+
+	return 0
+}
+
+func runLogin(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("login")
+	email := fs.String("email", "", "email of the user")
+	password_stdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("login", err, credentials_usage)
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("login", err)
+	}
+
+	address, password, err := credentials(*email, *password_stdin)
+	if err != nil {
+		return fail("login", err)
+	}
+
+	if err = c.Login(ctx, server.LoginRequest{Email: address, Password: password}); err != nil {
+		return fail("login", err)
+	}
+
+	if err = saveSession(&session{URL: c.BaseURL, Email: address, SessionId: c.SessionId()}); err != nil {
+		return fail("login", err)
+	}
+
+	if err = render(opts, map[string]any{"email": address, "url": c.BaseURL}, []string{"LOGGED IN AS", "URL"}, [][]string{{address, c.BaseURL}}); err != nil {
+		return fail("login", err)
+	}
+
+	return 0
+}
+
+// runLogout only forgets the session locally; it expires on the server on its own.
+func runLogout(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("logout")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("logout", err, "Usage:\n  broke-bank-cli logout")
+	}
+
+	if err := removeSession(); err != nil {
+		return fail("logout", err)
+	}
+
+	return 0
+}
+
+func runMe(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("me")
+	if _, err := parseArgs(fs, opts, args, 0); err != nil {
+		return usageError("me", err, "Usage:\n  broke-bank-cli me")
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("me", err)
+	}
+
+	me, err := c.Me(ctx)
+	if err != nil {
+		return fail("me", err)
+	}
+
+	if err = render(opts, me, []string{"EMAIL"}, [][]string{{me.Email}}); err != nil {
+		return fail("me", err)
+	}
+
+	return 0
+}
+
+const accounts_usage = `Usage:
+  broke-bank-cli accounts [--limit N] [--offset N]    list your accounts
+  broke-bank-cli accounts create NAME                 open an account`
+
+func runAccounts(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("accounts")
+	limit := fs.Int("limit", 100, "maximum number of accounts")
+	offset := fs.Int("offset", 0, "accounts to skip")
+
+	positional, err := parseArgs(fs, opts, args, -1)
+	create := len(positional) == 2 && positional[0] == "create"
+	if err == nil && len(positional) != 0 && !create {
+		err = errors.New("expected no argument, or create NAME")
+	}
+	if err != nil {
+		return usageError("accounts", err, accounts_usage)
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("accounts", err)
+	}
+
+	if create {
+		if err = c.CreateAccount(ctx, server.CreateAccountRequest{Name: positional[1]}); err != nil {
+			return fail("accounts create", err)
+		}
+	}
+
+	accounts, err := c.GetMyAccounts(ctx, *limit, *offset)
+	if err != nil {
+		return fail("accounts", err)
+	}
+
+	// After create, only the new account is shown.
+	shown := accounts[:0]
+	rows := [][]string{}
+	for _, account := range accounts {
+		if create && account.Name != positional[1] {
+			continue
+		}
+		shown = append(shown, account)
+		rows = append(rows, []string{account.Id.String(), account.Name, account.Balance, account.Status})
+	}
+
+	if err = render(opts, shown, []string{"ID", "NAME", "BALANCE", "STATUS"}, rows); err != nil {
+		return fail("accounts", err)
+	}
+
+	return 0
+}
+
+func runBalance(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("balance")
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("balance", err, "Usage:\n  broke-bank-cli balance ACCOUNT_ID")
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("balance", err)
+	}
+
+	account, err := c.GetAccount(ctx, positional[0])
+	if err != nil {
+		return fail("balance", err)
+	}
+
+	if err = render(opts, account, []string{"ID", "NAME", "BALANCE", "STATUS"}, [][]string{{account.Id.String(), account.Name, account.Balance, account.Status}}); err != nil {
+		return fail("balance", err)
+	}
+
+	return 0
+}
+
+const transfer_usage = `Usage:
+  broke-bank-cli transfer --from ACCOUNT_ID --to ACCOUNT_ID AMOUNT [--yes] [--idempotency-key KEY]
+
+Asks for confirmation unless --yes is given. Passing the same --idempotency-key again
+never moves the money twice, so a transfer that timed out can safely be re-run.`
+
+func runTransfer(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("transfer")
+	from := fs.String("from", "", "account to take the money from")
+	to := fs.String("to", "", "account to send the money to")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	idempotency_key := fs.String("idempotency-key", "", "makes re-running the same transfer safe, a random one by default")
+
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err == nil && (*from == "" || *to == "") {
+		err = errors.New("--from and --to are required")
+	}
+	if err != nil {
+		return usageError("transfer", err, transfer_usage)
+	}
+
+	amount, err := decimal.NewFromString(positional[0])
+	if err != nil || !amount.IsPositive() {
+		return usageError("transfer", fmt.Errorf("invalid amount %q", positional[0]), transfer_usage)
+	}
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("transfer", err)
+	}
+
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Transfer %s from %s to %s?", amount.StringFixed(2), *from, *to))
+		if err != nil {
+			return fail("transfer", fmt.Errorf("%w, pass --yes to skip the confirmation", err))
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Transfer cancelled")
+			return 1
+		}
+	}
+
+	if *idempotency_key == "" {
+		*idempotency_key = uuid.NewString()
+	}
+
+	req := server.TransferTransactionRequest{Amount: amount, FromAccountId: *from, ToAccountId: *to}
+	if err = c.TransferTransaction(ctx, req, *idempotency_key); err != nil {
+		return fail("transfer", err)
+	}
+
+	result := map[string]any{"amount": amount.StringFixed(2), "from_account_id": *from, "to_account_id": *to, "idempotency_key": *idempotency_key}
+	if err = render(opts, result, []string{"AMOUNT", "FROM", "TO", "IDEMPOTENCY KEY"}, [][]string{{amount.StringFixed(2), *from, *to, *idempotency_key}}); err != nil {
+		return fail("transfer", err)
+	}
+
+	return 0
+}
+
+func runHistory(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("history")
+	limit := fs.Int("limit", 20, "maximum number of transactions")
+	offset := fs.Int("offset", 0, "transactions to skip")
+
+	positional, err := parseArgs(fs, opts, args, 1)
+	if err != nil {
+		return usageError("history", err, "Usage:\n  broke-bank-cli history ACCOUNT_ID [--limit N] [--offset N]")
+	}
+	account_id := positional[0]
+
+	c, err := newClient(opts)
+	if err != nil {
+		return fail("history", err)
+	}
+
+	transactions, err := c.GetAccountTransactions(ctx, account_id, *limit, *offset)
+	if err != nil {
+		return fail("history", err)
+	}
+
+	rows := [][]string{}
+	for _, transaction := range transactions {
+		// Money leaving the account is shown as a negative amount.
+		amount := transaction.Amount
+		if transaction.FromAccountId != nil && transaction.FromAccountId.String() == account_id {
+			amount = "-" + amount
+		}
+
+		counterpart := ""
+		for _, id := range []*uuid.UUID{transaction.FromAccountId, transaction.ToAccountId} {
+			if id != nil && id.String() != account_id {
+				counterpart = id.String()
+			}
+		}
+
+		rows = append(rows, []string{
+			transaction.IssuedAt.Local().Format("2006-01-02 15:04:05"),
+			transaction.Id.String(),
+			transaction.Type,
+			amount,
+			counterpart,
+		})
+	}
+
+	if err = render(opts, transactions, []string{"DATE", "ID", "TYPE", "AMOUNT", "COUNTERPART"}, rows); err != nil {
+		return fail("history", err)
+	}
+
+	return 0
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"broke-bank/client"
+	"broke-bank/server"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const load_usage = `Usage:
+  broke-bank-cli load [--users N] [--concurrency N] [--requests N] [--amount A] [--deposit A]
+
+Registers --users users with one funded account each, then sends --requests transfers between
+random pairs of them, --concurrency at a time. The report includes the latency percentiles, the
+errors by kind, and whether the total balance is unchanged afterwards.
+
+Transfers aren't retried, so rate limiting shows up in the report: relax the server's limits
+with the RATE_LIMIT_* envs (e.g. RATE_LIMIT_TRANSACTION_USER=off) to measure throughput.
+
+Accounts are funded with deposits, which the server only accepts with SANDBOX=true.`
+
+type loadUser struct {
+	client     *client.Client
+	account_id string
+}
+
+type loadReport struct {
+	Users             int                `json:"users"`
+	Concurrency       int                `json:"concurrency"`
+	Requests          int                `json:"requests"`
+	Succeeded         int                `json:"succeeded"`
+	Failed            int                `json:"failed"`
+	Errors            map[string]int     `json:"errors"`
+	DurationSeconds   float64            `json:"duration_seconds"`
+	RequestsPerSecond float64            `json:"requests_per_second"`
+	LatencyMs         map[string]float64 `json:"latency_ms"`
+	// The sum of every account's balance, which transfers must not change.
+	ExpectedBalance string `json:"expected_balance"`
+	TotalBalance    string `json:"total_balance"`
+	Consistent      bool   `json:"consistent"`
+}
+
+func runLoad(ctx context.Context, args []string) int {
+	fs, opts := newFlagSet("load")
+	user_count := fs.Int("users", 10, "users to create")
+	concurrency := fs.Int("concurrency", 10, "transfers in flight at once")
+	requests := fs.Int("requests", 100, "transfers to send")
+	raw_amount := fs.String("amount", "1.00", "amount of each transfer")
+	raw_deposit := fs.String("deposit", "1000.00", "initial balance of each account")
+
+	_, err := parseArgs(fs, opts, args, 0)
+	amount, amount_err := decimal.NewFromString(*raw_amount)
+	deposit, deposit_err := decimal.NewFromString(*raw_deposit)
+	if err == nil && (*user_count < 2 || *concurrency < 1 || *requests < 1) {
+		err = errors.New("--users must be at least 2, --concurrency and --requests at least 1")
+	}
+	if err == nil && (amount_err != nil || !amount.IsPositive() || deposit_err != nil || deposit.IsNegative()) {
+		err = errors.New("invalid --amount or --deposit")
+	}
+	if err != nil {
+		return usageError("load", err, load_usage)
+	}
+
+	base, err := newClient(opts)
+	if err != nil {
+		return fail("load", err)
+	}
+
+	users, err := setupLoadUsers(ctx, base.BaseURL, *user_count, *concurrency, deposit)
+	if err != nil {
+		return fail("load", fmt.Errorf("setting up users: %w", err))
+	}
+
+	latencies := make([]time.Duration, *requests)
+	errs := make([]error, *requests)
+	started := time.Now()
+
+	parallel(*requests, *concurrency, func(i int) {
+		from := rand.Intn(len(users))
+		to := (from + 1 + rand.Intn(len(users)-1)) % len(users)
+
+		request_started := time.Now()
+		errs[i] = users[from].client.TransferTransaction(ctx, server.TransferTransactionRequest{
+			Amount:        amount,
+			FromAccountId: users[from].account_id,
+			ToAccountId:   users[to].account_id,
+		}, uuid.NewString())
+		latencies[i] = time.Since(request_started)
+	})
+
+	duration := time.Since(started)
+
+	report := loadReport{
+		Users:             len(users),
+		Concurrency:       *concurrency,
+		Requests:          *requests,
+		Errors:            map[string]int{},
+		DurationSeconds:   duration.Seconds(),
+		RequestsPerSecond: float64(*requests) / duration.Seconds(),
+		LatencyMs:         percentiles(latencies),
+		ExpectedBalance:   deposit.Mul(decimal.NewFromInt(int64(len(users)))).StringFixed(2),
+	}
+	for _, err := range errs {
+		if err == nil {
+			report.Succeeded++
+			continue
+		}
+		report.Failed++
+		report.Errors[err.Error()]++
+	}
+
+	total := decimal.Zero
+	for _, user := range users {
+		account, err := user.client.GetAccount(ctx, user.account_id)
+		if err != nil {
+			return fail("load", fmt.Errorf("checking balances: %w", err))
+		}
+		total = total.Add(decimal.RequireFromString(account.Balance))
+	}
+	report.TotalBalance = total.StringFixed(2)
+	report.Consistent = report.TotalBalance == report.ExpectedBalance
+
+	rows := [][]string{
+		{"Requests", strconv.Itoa(report.Requests)},
+		{"Succeeded", strconv.Itoa(report.Succeeded)},
+		{"Failed", strconv.Itoa(report.Failed)},
+		{"Duration", duration.Round(time.Millisecond).String()},
+		{"Requests/s", strconv.FormatFloat(report.RequestsPerSecond, 'f', 1, 64)},
+	}
+	for _, p := range []string{"p50", "p95", "p99", "max"} {
+		rows = append(rows, []string{"Latency " + p, strconv.FormatFloat(report.LatencyMs[p], 'f', 1, 64) + "ms"})
+	}
+	rows = append(rows, []string{"Total balance", report.TotalBalance + " (expected " + report.ExpectedBalance + ")"})
+
+	messages := []string{}
+	for message := range report.Errors {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	for _, message := range messages {
+		rows = append(rows, []string{"Error", fmt.Sprintf("%dx %s", report.Errors[message], message)})
+	}
+
+	if err = render(opts, report, []string{"METRIC", "VALUE"}, rows); err != nil {
+		return fail("load", err)
+	}
+
+	if !report.Consistent {
+		return fail("load", errors.New("the total balance changed, money was created or lost"))
+	}
+
+	return 0
+}
+
+// setupLoadUsers registers, logs in and funds count users, concurrency at a time.
+func setupLoadUsers(ctx context.Context, base_url string, count int, concurrency int, deposit decimal.Decimal) ([]loadUser, error) {
+	run := uuid.NewString()[:8]
+	users := make([]loadUser, count)
+	errs := make([]error, count)
+
+	parallel(count, concurrency, func(i int) {
+		c := client.New(base_url)
+		credentials := server.RegisterRequest{Email: fmt.Sprintf("load-%s-%d@broke.bank", run, i), Password: uuid.NewString()}
+
+		if errs[i] = c.Register(ctx, credentials); errs[i] != nil {
+			return
+		}
+		if errs[i] = c.Login(ctx, server.LoginRequest(credentials)); errs[i] != nil {
+			return
+		}
+		if errs[i] = c.CreateAccount(ctx, server.CreateAccountRequest{Name: "Load"}); errs[i] != nil {
+			return
+		}
+
+		accounts, err := c.GetMyAccounts(ctx, 1, 0)
+		if err == nil && len(accounts) == 0 {
+			err = errors.New("created account not found")
+		}
+		if errs[i] = err; err != nil {
+			return
+		}
+
+		if deposit.IsPositive() {
+			errs[i] = c.DepositTransaction(ctx, server.DepositTransactionRequest{Amount: deposit, ToAccountId: accounts[0].Id.String()}, "")
+		}
+
+		// Transfers are measured as sent, without retrying.
+		c.MaxRetries = 0
+		users[i] = loadUser{client: c, account_id: accounts[0].Id.String()}
+	})
+
+	return users, errors.Join(errs...)
+}
+
+// parallel calls fn for 0..n-1, with at most concurrency calls running at once.
+func parallel(n int, concurrency int, fn func(i int)) {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, concurrency)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func percentiles(latencies []time.Duration) map[string]float64 {
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at := func(p float64) float64 {
+		return float64(sorted[int(p*float64(len(sorted)-1))].Microseconds()) / 1000
+	}
+
+	return map[string]float64{"p50": at(0.50), "p95": at(0.95), "p99": at(0.99), "max": at(1)}
+}
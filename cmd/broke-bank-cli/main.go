@@ -0,0 +1,157 @@
+/*
+broke-bank-cli is a terminal client for the Broke Bank API, for people and scripts rather
+than operators (see `broke-bank help` for the admin commands).
+
+	broke-bank-cli login --email alice@broke.bank
+	broke-bank-cli accounts
+	broke-bank-cli transfer --from ID --to ID 10.00
+	broke-bank-cli history ID -o json | jq '.[].amount'
+*/
+package main
+
+import (
+	"broke-bank/client"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Usage: broke-bank-cli [command]
+
+Commands:
+  register  create a user
+  login     start a session, stored in ` + "`$XDG_CONFIG_HOME/broke-bank/session.json`" + `
+  logout    forget the stored session
+  me        show the logged in user
+  accounts  list | create NAME
+  balance   ACCOUNT_ID
+  transfer  --from ACCOUNT_ID --to ACCOUNT_ID AMOUNT
+  history   ACCOUNT_ID
+  load      run concurrent transfers between generated users and report the results
+
+Every command accepts:
+  --url URL      API address, BROKE_BANK_URL or the logged in one by default
+  -o, --output   table | json
+
+BROKE_BANK_API_KEY authenticates with an API key instead of the stored session, and
+BROKE_BANK_SESSION_FILE overrides where the session is stored.`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	os.Exit(run(os.Args[1], os.Args[2:]))
+}
+
+func run(command string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "register":
+		return runRegister(ctx, args)
+	case "login":
+		return runLogin(ctx, args)
+	case "logout":
+		return runLogout(ctx, args)
+	case "me":
+		return runMe(ctx, args)
+	case "accounts":
+		return runAccounts(ctx, args)
+	case "balance":
+		return runBalance(ctx, args)
+	case "transfer":
+		return runTransfer(ctx, args)
+	case "history":
+		return runHistory(ctx, args)
+	case "load":
+		return runLoad(ctx, args)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s\n", command, usage)
+		return 2
+	}
+}
+
+type options struct {
+	url    string
+	output string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &options{}
+
+	fs.StringVar(&opts.url, "url", os.Getenv("BROKE_BANK_URL"), "API address")
+	fs.StringVar(&opts.output, "output", "table", "output format: table | json")
+	fs.StringVar(&opts.output, "o", "table", "shorthand for --output")
+
+	return fs, opts
+}
+
+// parseArgs parses flags wherever they appear and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, opts *options, args []string, positional_count int) ([]string, error) {
+	positional := []string{}
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if positional_count >= 0 && len(positional) != positional_count {
+		return nil, fmt.Errorf("expected %d argument(s), got %d", positional_count, len(positional))
+	}
+
+	if opts.output != "table" && opts.output != "json" {
+		return nil, fmt.Errorf("invalid --output %q, expected table or json", opts.output)
+	}
+
+	return positional, nil
+}
+
+// render prints value as JSON, or rows as an aligned table.
+func render(opts *options, value any, headers []string, rows [][]string) error {
+	if opts.output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func fail(command string, err error) int {
+	if errors.Is(err, client.ErrUnauthorized) {
+		err = fmt.Errorf("%w, run 'broke-bank-cli login' first", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "[ERROR] [%s] %s\n", command, err)
+	return 1
+}
+
+func usageError(command string, err error, command_usage string) int {
+	fmt.Fprintf(os.Stderr, "[ERROR] [%s] %s\n\n%s\n", command, err, command_usage)
+	return 2
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"broke-bank/client"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const default_url = "http://localhost:5000"
+
+// session is what login stores on disk, so that following commands don't need credentials.
+type session struct {
+	URL       string `json:"url"`
+	Email     string `json:"email"`
+	SessionId string `json:"session_id"`
+}
+
+func sessionPath() (string, error) {
+	if path, ok := os.LookupEnv("BROKE_BANK_SESSION_FILE"); ok {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "broke-bank", "session.json"), nil
+}
+
+// loadSession returns an empty session when nobody is logged in.
+func loadSession() (*session, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{}
+	if err = json.Unmarshal(raw, s); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// saveSession writes the session readable by the current user only, as it grants access to their accounts.
+func saveSession(s *session) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0o600)
+}
+
+func removeSession() error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+/*
+newClient returns a client for --url, falling back to the logged in API and then to
+default_url. The stored session is only sent to the API it was started on.
+*/
+func newClient(opts *options) (*client.Client, error) {
+	s, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+
+	url := opts.url
+	if url == "" {
+		url = s.URL
+	}
+	if url == "" {
+		url = default_url
+	}
+
+	c := client.New(url)
+	c.ApiKey = os.Getenv("BROKE_BANK_API_KEY")
+	if s.SessionId != "" && strings.TrimSuffix(s.URL, "/") == c.BaseURL {
+		c.SetSessionId(s.SessionId)
+	}
+
+	return c, nil
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks for a line on the terminal. Prompts go to stderr so that stdout stays parseable.
+func prompt(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+
+	answer, err := stdin.ReadString('\n')
+	if errors.Is(err, io.EOF) && answer == "" {
+		return "", errors.New("no answer, stdin is closed")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimSpace(answer), nil
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func confirm(question string) (bool, error) {
+	answer, err := prompt(question + " [y/N] ")
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,177 @@
+/*
+fake-processor plays the payment processor for local testing: it sends the signed webhooks of a
+charge to a Broke Bank server, as the real processor does once a customer pays.
+
+	fake-processor --account ID --amount 25.00
+	fake-processor --account ID --amount 25.00 --fail card_declined
+	fake-processor --account ID --amount 25.00 --replay
+
+The server must share PROCESSOR_WEBHOOK_SECRET with it.
+*/
+package main
+
+import (
+	"broke-bank/server"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const usage = `Usage: fake-processor --account ID --amount AMOUNT [flags]
+
+Sends charge.pending, then charge.succeeded or charge.failed, to POST /v2/processor/webhook.
+
+Flags:
+  --url URL          server address, BROKE_BANK_URL or http://localhost:5000 by default
+  --secret SECRET    PROCESSOR_WEBHOOK_SECRET by default
+  --charge ID        charge id, a new one by default
+  --fail MESSAGE     fail the charge with MESSAGE instead of succeeding
+  --delay DURATION   wait between the events, 1s by default
+  --replay           send every event twice, like a retry after a lost answer`
+
+// Attempts per event, as the real processor retries failed webhooks.
+const max_attempts = 5
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:]))
+}
+
+func run(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("fake-processor", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+
+	url := fs.String("url", os.Getenv("BROKE_BANK_URL"), "server address")
+	secret := fs.String("secret", os.Getenv("PROCESSOR_WEBHOOK_SECRET"), "webhook secret")
+	account_id := fs.String("account", "", "account to top up")
+	raw_amount := fs.String("amount", "", "charge amount")
+	charge_id := fs.String("charge", "", "charge id")
+	failure := fs.String("fail", "", "failure message")
+	delay := fs.Duration("delay", time.Second, "wait between the events")
+	replay := fs.Bool("replay", false, "send every event twice")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	amount, err := decimal.NewFromString(*raw_amount)
+	if err != nil || *account_id == "" || *secret == "" {
+		fmt.Fprintln(os.Stderr, "--account, --amount and --secret are required")
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if *url == "" {
+		*url = "http://localhost:5000"
+	}
+	if *charge_id == "" {
+		*charge_id = "ch_" + randomId()
+	}
+
+	data := server.ProcessorChargeData{Id: *charge_id, Amount: amount, AccountId: *account_id}
+	final := "charge.succeeded"
+	if *failure != "" {
+		final = "charge.failed"
+	}
+
+	for i, event_type := range []string{"charge.pending", final} {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return 1
+			case <-time.After(*delay):
+			}
+		}
+
+		event := server.ProcessorEvent{Id: "evt_" + randomId(), Type: event_type, Created: time.Now().Unix(), Data: data}
+		if event_type == "charge.failed" {
+			event.Data.FailureMessage = failure
+		}
+
+		sends := 1
+		if *replay {
+			sends = 2
+		}
+		for range sends {
+			if err := send(ctx, strings.TrimSuffix(*url, "/")+"/v2/processor/webhook", *secret, event); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", event.Type, event.Id, err)
+				return 1
+			}
+		}
+	}
+
+	return 0
+}
+
+// send posts a signed event, retrying with a backoff until it's answered with a 2xx or a 4xx.
+func send(ctx context.Context, url string, secret string, event server.ProcessorEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		status, err := post(ctx, url, secret, body)
+		if err == nil {
+			fmt.Printf("%s %s (%s): %d\n", event.Type, event.Id, event.Data.Id, status)
+			if status >= 400 && status < 500 {
+				return fmt.Errorf("refused with %d", status)
+			}
+			if status < 300 {
+				return nil
+			}
+		}
+		if attempt == max_attempts {
+			return errors.Join(errors.New("giving up"), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func post(ctx context.Context, url string, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Signed again on every attempt, so that retries aren't refused as too old.
+	req.Header.Set(server.ProcessorSignatureHeader, utils.SignWebhook(secret, time.Now(), body))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	return res.StatusCode, nil
+}
+
+func randomId() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"broke-bank/cli"
 	"broke-bank/server"
+	"context"
 	"log"
 	"os"
 
@@ -15,11 +17,30 @@ func main() {
 		log.Fatal("Error loading .env file:", err)
 	}
 
+	// Any argument means an admin command; without arguments the binary runs the API server.
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	addr, ok := os.LookupEnv("SERVER_ADDRESS")
 	if !ok {
 		log.Fatal("Missing SERVER_ADDRESS env")
 	}
 
 	s := server.New()
+
+	// The gRPC API is optional, for internal services.
+	if grpc_addr, ok := os.LookupEnv("GRPC_ADDRESS"); ok {
+		go func() {
+			log.Fatal(s.RunGRPC(grpc_addr))
+		}()
+	}
+
+	// Every instance delivers webhooks, they share the work through the database.
+	go s.RunWebhooks(context.Background())
+	go s.RunLedgerCheckpoints(context.Background())
+	go s.RunAccountFreezeExpiry(context.Background())
+	go s.RunPaymentRequests(context.Background())
+
 	s.Run(addr)
 }
@@ -0,0 +1 @@
+DROP EXTENSION IF EXISTS "pg_uuidv7";
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "account";
+
+DROP TYPE IF EXISTS account_status;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "transaction";
+
+DROP TYPE IF EXISTS transaction_type;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "audit_event";
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE "audit_event" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  actor VARCHAR(255) NOT NULL,
+  action VARCHAR(100) NOT NULL,
+  target_type VARCHAR(50) NOT NULL,
+  target_id VARCHAR(255) NOT NULL,
+  reason TEXT,
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_event_target ON "audit_event" (target_type, target_id);
@@ -0,0 +1,10 @@
+ALTER TABLE "transaction" DROP COLUMN IF EXISTS reversal_of;
+
+-- Postgres can't drop a value from an enum, so 'frozen' accounts go back to 'inactive' and the type is rebuilt.
+UPDATE "account" SET status = 'inactive' WHERE status = 'frozen';
+ALTER TYPE account_status RENAME TO account_status_old;
+CREATE TYPE account_status AS ENUM ('active', 'inactive');
+ALTER TABLE "account" ALTER COLUMN status TYPE account_status USING status::text::account_status;
+DROP TYPE account_status_old;
+
+ALTER TABLE "user" DROP COLUMN IF EXISTS disabled_at;
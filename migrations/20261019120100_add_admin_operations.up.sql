@@ -0,0 +1,6 @@
+ALTER TABLE "user" ADD COLUMN disabled_at TIMESTAMPTZ;
+
+ALTER TYPE account_status ADD VALUE IF NOT EXISTS 'frozen';
+
+ALTER TABLE "transaction" ADD COLUMN reversal_of UUID UNIQUE;
+ALTER TABLE "transaction" ADD CONSTRAINT fk_reversal_of FOREIGN KEY(reversal_of) REFERENCES "transaction"(id);
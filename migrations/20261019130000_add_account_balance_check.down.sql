@@ -0,0 +1 @@
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS chk_balance_not_negative;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- NOT VALID checks every new write without aborting on accounts already overdrawn, which
+-- can't be closed until their balance is paid back. The constraint is validated right away
+-- when there are none, and otherwise the warning lists them so it can be validated later.
+ALTER TABLE "account" ADD CONSTRAINT chk_balance_not_negative CHECK (balance >= 0) NOT VALID;
+
+DO $$
+DECLARE
+  overdrawn TEXT;
+BEGIN
+  SELECT string_agg(id::TEXT || ' (' || balance || ')', ', ' ORDER BY id) INTO overdrawn FROM "account" WHERE balance < 0;
+
+  IF overdrawn IS NULL THEN
+    ALTER TABLE "account" VALIDATE CONSTRAINT chk_balance_not_negative;
+  ELSE
+    RAISE WARNING 'chk_balance_not_negative is NOT VALID, fix these overdrawn accounts then run ALTER TABLE "account" VALIDATE CONSTRAINT chk_balance_not_negative: %', overdrawn;
+  END IF;
+END $$;
@@ -0,0 +1,12 @@
+CREATE TABLE "api_key" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  name VARCHAR(255) NOT NULL,
+  -- Only the SHA-256 of a key is stored, the prefix is kept to recognize it in listings.
+  key_hash CHAR(64) UNIQUE NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_key_user_id ON "api_key" (user_id);
@@ -0,0 +1,52 @@
+CREATE TABLE "webhook_endpoint" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  url TEXT NOT NULL,
+  -- Deliveries are signed with it, so it can't be hashed like API keys.
+  secret VARCHAR(100) NOT NULL,
+  -- Empty means every event type.
+  event_types TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_endpoint_user_id ON "webhook_endpoint" (user_id);
+
+-- Written in the same transaction as the movement or change an event describes.
+CREATE TABLE "outbox_event" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  type VARCHAR(50) NOT NULL,
+  data JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  -- Set once the event was turned into deliveries.
+  dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_event_pending ON "outbox_event" (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE "webhook_delivery" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  endpoint_id UUID NOT NULL REFERENCES "webhook_endpoint" (id),
+  event_id UUID NOT NULL REFERENCES "outbox_event" (id),
+  status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'dead')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX idx_webhook_delivery_due ON "webhook_delivery" (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE "webhook_delivery_attempt" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  delivery_id UUID NOT NULL REFERENCES "webhook_delivery" (id),
+  attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  -- NULL when no response was received.
+  status_code INTEGER,
+  error TEXT,
+  duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX idx_webhook_delivery_attempt_delivery_id ON "webhook_delivery_attempt" (delivery_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "processor_event";
+DROP TABLE IF EXISTS "processor_charge";
+DROP TYPE IF EXISTS processor_charge_status;
@@ -0,0 +1,23 @@
+CREATE TYPE processor_charge_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE "processor_charge" (
+  -- The payment processor's id, so that a charge is deposited once however often it's notified.
+  id VARCHAR(255) PRIMARY KEY,
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+  status processor_charge_status NOT NULL DEFAULT 'pending',
+  failure_message TEXT,
+  transaction_id UUID UNIQUE REFERENCES "transaction" (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_processor_charge_account_id ON "processor_charge" (account_id);
+
+-- Events already applied, so that a replayed request is ignored.
+CREATE TABLE "processor_event" (
+  id VARCHAR(255) PRIMARY KEY,
+  charge_id VARCHAR(255) NOT NULL REFERENCES "processor_charge" (id),
+  type VARCHAR(64) NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
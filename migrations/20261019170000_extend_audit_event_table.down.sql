@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS audit_event_no_truncate ON "audit_event";
+DROP TRIGGER IF EXISTS audit_event_no_update_or_delete ON "audit_event";
+DROP FUNCTION IF EXISTS audit_event_append_only();
+
+DROP INDEX IF EXISTS idx_audit_event_created_at;
+DROP INDEX IF EXISTS idx_audit_event_user_id;
+
+ALTER TABLE "audit_event"
+  DROP COLUMN IF EXISTS after,
+  DROP COLUMN IF EXISTS before,
+  DROP COLUMN IF EXISTS request_id,
+  DROP COLUMN IF EXISTS user_agent,
+  DROP COLUMN IF EXISTS ip,
+  DROP COLUMN IF EXISTS user_id;
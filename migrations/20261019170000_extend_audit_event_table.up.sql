@@ -0,0 +1,25 @@
+ALTER TABLE "audit_event"
+  ADD COLUMN user_id UUID REFERENCES "user" (id),
+  ADD COLUMN ip VARCHAR(64),
+  ADD COLUMN user_agent TEXT,
+  ADD COLUMN request_id VARCHAR(255),
+  ADD COLUMN before JSONB,
+  ADD COLUMN after JSONB;
+
+CREATE INDEX idx_audit_event_user_id ON "audit_event" (user_id, created_at DESC);
+CREATE INDEX idx_audit_event_created_at ON "audit_event" (created_at DESC);
+
+-- The audit trail is append-only, even for the application's own role.
+CREATE FUNCTION audit_event_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_event is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_event_no_update_or_delete
+  BEFORE UPDATE OR DELETE ON "audit_event"
+  FOR EACH ROW EXECUTE FUNCTION audit_event_append_only();
+
+CREATE TRIGGER audit_event_no_truncate
+  BEFORE TRUNCATE ON "audit_event"
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_event_append_only();
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS "ledger_checkpoint";
+
+ALTER TABLE "account"
+  DROP COLUMN IF EXISTS chain_length,
+  DROP COLUMN IF EXISTS chain_head;
+
+ALTER TABLE "transaction"
+  DROP COLUMN IF EXISTS chain_hash,
+  DROP COLUMN IF EXISTS to_prev_hash,
+  DROP COLUMN IF EXISTS from_prev_hash;
@@ -0,0 +1,59 @@
+ALTER TABLE "transaction"
+  ADD COLUMN from_prev_hash BYTEA,
+  ADD COLUMN to_prev_hash BYTEA,
+  ADD COLUMN chain_hash BYTEA;
+
+ALTER TABLE "account"
+  ADD COLUMN chain_head BYTEA,
+  ADD COLUMN chain_length BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE "ledger_checkpoint" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  accounts INTEGER NOT NULL,
+  links BIGINT NOT NULL,
+  root BYTEA NOT NULL,
+  heads JSONB NOT NULL,
+  key_id VARCHAR(32) NOT NULL,
+  public_key BYTEA NOT NULL,
+  signature BYTEA NOT NULL
+);
+
+CREATE INDEX idx_ledger_checkpoint_created_at ON "ledger_checkpoint" (created_at DESC);
+
+-- Mirrors repository.LedgerHash, to chain the transactions issued before this migration.
+CREATE FUNCTION ledger_hash(tx "transaction") RETURNS BYTEA AS $$
+  SELECT sha256(convert_to(concat_ws(E'\n',
+    'broke-bank/ledger/v1',
+    tx.id::text,
+    tx.type::text,
+    coalesce(tx.from_account_id::text, ''),
+    coalesce(tx.to_account_id::text, ''),
+    tx.amount::text,
+    (extract(epoch FROM tx.date_issued) * 1000000)::bigint::text,
+    coalesce(tx.reversal_of::text, ''),
+    coalesce(encode(tx.from_prev_hash, 'hex'), ''),
+    coalesce(encode(tx.to_prev_hash, 'hex'), '')
+  ), 'UTF8'));
+$$ LANGUAGE sql IMMUTABLE;
+
+DO $$
+DECLARE
+  tx "transaction";
+BEGIN
+  FOR tx IN SELECT * FROM "transaction" ORDER BY date_issued, id LOOP
+    SELECT acc.chain_head INTO tx.from_prev_hash FROM "account" acc WHERE acc.id = tx.from_account_id;
+    SELECT acc.chain_head INTO tx.to_prev_hash FROM "account" acc WHERE acc.id = tx.to_account_id;
+    tx.chain_hash := ledger_hash(tx);
+
+    UPDATE "transaction"
+      SET from_prev_hash = tx.from_prev_hash, to_prev_hash = tx.to_prev_hash, chain_hash = tx.chain_hash
+      WHERE id = tx.id;
+    UPDATE "account"
+      SET chain_head = tx.chain_hash, chain_length = chain_length + 1
+      WHERE id IN (tx.from_account_id, tx.to_account_id);
+  END LOOP;
+END;
+$$;
+
+DROP FUNCTION ledger_hash("transaction");
@@ -0,0 +1,3 @@
+ALTER TABLE "user" DROP COLUMN IF EXISTS role;
+
+DROP TYPE IF EXISTS user_role;
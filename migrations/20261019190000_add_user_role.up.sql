@@ -0,0 +1,3 @@
+CREATE TYPE user_role AS ENUM ('customer', 'support', 'compliance', 'admin');
+
+ALTER TABLE "user" ADD COLUMN role user_role NOT NULL DEFAULT 'customer';
@@ -0,0 +1,19 @@
+-- Posted adjustments are part of the ledger, so rolling back is refused rather than rewriting them.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM "transaction" WHERE type = 'adjustment') THEN
+    RAISE EXCEPTION 'adjustment transactions exist, they must be kept';
+  END IF;
+END
+$$;
+
+DROP TABLE IF EXISTS "adjustment_decision";
+DROP TYPE IF EXISTS adjustment_decision;
+DROP TABLE IF EXISTS "adjustment";
+DROP TYPE IF EXISTS adjustment_status;
+
+-- Postgres can't drop a value from an enum, so the type is rebuilt.
+ALTER TYPE transaction_type RENAME TO transaction_type_old;
+CREATE TYPE transaction_type AS ENUM ('deposit', 'withdrawal', 'transfer');
+ALTER TABLE "transaction" ALTER COLUMN type TYPE transaction_type USING type::text::transaction_type;
+DROP TYPE transaction_type_old;
@@ -0,0 +1,35 @@
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'adjustment';
+
+CREATE TYPE adjustment_status AS ENUM ('pending', 'approved', 'rejected');
+
+CREATE TABLE "adjustment" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  -- Positive credits the account, negative debits it.
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount <> 0),
+  reason TEXT NOT NULL,
+  evidence TEXT NOT NULL,
+  status adjustment_status NOT NULL DEFAULT 'pending',
+  required_approvals INTEGER NOT NULL CHECK (required_approvals > 0),
+  proposed_by UUID NOT NULL REFERENCES "user" (id),
+  transaction_id UUID UNIQUE REFERENCES "transaction" (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_adjustment_account_id ON "adjustment" (account_id);
+CREATE INDEX idx_adjustment_pending ON "adjustment" (created_at) WHERE status = 'pending';
+
+CREATE TYPE adjustment_decision AS ENUM ('approved', 'rejected');
+
+CREATE TABLE "adjustment_decision" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  adjustment_id UUID NOT NULL REFERENCES "adjustment" (id),
+  staff_id UUID NOT NULL REFERENCES "user" (id),
+  decision adjustment_decision NOT NULL,
+  comment TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  -- Each staff member decides once, so two approvals come from two people.
+  UNIQUE (adjustment_id, staff_id)
+);
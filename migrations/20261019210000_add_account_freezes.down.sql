@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS account_frozen_until_idx;
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS account_frozen_until_check;
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS account_status_reason_check;
+ALTER TABLE "account" DROP COLUMN IF EXISTS frozen_until;
+ALTER TABLE "account" DROP COLUMN IF EXISTS status_reason;
+DROP TYPE IF EXISTS account_status_reason;
+
+-- Both kinds of freeze become 'frozen' again, and closed accounts 'inactive' like the ones their owners disabled.
+ALTER TYPE account_status RENAME TO account_status_new;
+CREATE TYPE account_status AS ENUM ('active', 'inactive', 'frozen');
+ALTER TABLE "account" ALTER COLUMN status TYPE account_status
+  USING (CASE status::text WHEN 'frozen_debit' THEN 'frozen' WHEN 'frozen_all' THEN 'frozen' WHEN 'closed' THEN 'inactive' ELSE status::text END)::account_status;
+DROP TYPE account_status_new;
@@ -0,0 +1,21 @@
+-- The type is rebuilt rather than extended: values added by ALTER TYPE can't be used in the same transaction, and 'frozen' goes away.
+ALTER TYPE account_status RENAME TO account_status_old;
+CREATE TYPE account_status AS ENUM ('active', 'inactive', 'frozen_debit', 'frozen_all', 'closed');
+ALTER TABLE "account" ALTER COLUMN status TYPE account_status
+  USING (CASE status::text WHEN 'frozen' THEN 'frozen_all' ELSE status::text END)::account_status;
+DROP TYPE account_status_old;
+
+CREATE TYPE account_status_reason AS ENUM ('fraud_suspected', 'sanctions_screening', 'court_order', 'kyc_review', 'customer_request', 'deceased', 'other');
+
+ALTER TABLE "account" ADD COLUMN status_reason account_status_reason;
+ALTER TABLE "account" ADD COLUMN frozen_until TIMESTAMPTZ;
+
+-- Accounts frozen before reason codes existed stay frozen indefinitely.
+UPDATE "account" SET status_reason = 'other' WHERE status = 'frozen_all';
+
+ALTER TABLE "account" ADD CONSTRAINT account_status_reason_check
+  CHECK ((status_reason IS NOT NULL) = (status IN ('frozen_debit', 'frozen_all', 'closed')));
+ALTER TABLE "account" ADD CONSTRAINT account_frozen_until_check
+  CHECK (frozen_until IS NULL OR status IN ('frozen_debit', 'frozen_all'));
+
+CREATE INDEX account_frozen_until_idx ON "account" (frozen_until) WHERE frozen_until IS NOT NULL;
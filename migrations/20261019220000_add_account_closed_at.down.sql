@@ -0,0 +1,2 @@
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS account_closed_at_check;
+ALTER TABLE "account" DROP COLUMN IF EXISTS closed_at;
@@ -0,0 +1,7 @@
+-- When an account was closed, which bounds how long its owner can still reopen it.
+ALTER TABLE "account" ADD COLUMN closed_at TIMESTAMPTZ;
+
+UPDATE "account" SET closed_at = updated_at WHERE status = 'closed';
+
+ALTER TABLE "account" ADD CONSTRAINT account_closed_at_check
+  CHECK ((closed_at IS NOT NULL) = (status = 'closed'));
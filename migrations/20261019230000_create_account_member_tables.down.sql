@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "account_member_removal";
+DROP TYPE IF EXISTS account_member_removal_status;
+DROP TABLE IF EXISTS "account_invitation";
+DROP TYPE IF EXISTS account_invitation_status;
+DROP TABLE IF EXISTS "account_member";
+DROP TYPE IF EXISTS account_member_role;
@@ -0,0 +1,62 @@
+CREATE TYPE account_member_role AS ENUM ('owner', 'spender', 'viewer');
+
+CREATE TABLE "account_member" (
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  role account_member_role NOT NULL,
+  -- Largest amount a spender can move out of the account in one transaction.
+  spend_limit DECIMAL(15, 2) CHECK (spend_limit > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (account_id, user_id),
+  CONSTRAINT account_member_spend_limit_check CHECK ((spend_limit IS NOT NULL) = (role = 'spender'))
+);
+
+CREATE INDEX idx_account_member_user_id ON "account_member" (user_id);
+
+-- Every existing account is owned by its user alone.
+INSERT INTO "account_member" (account_id, user_id, role, created_at)
+SELECT acc.id, acc.user_id, 'owner', acc.created_at FROM "account" acc WHERE acc.user_id IS NOT NULL;
+
+CREATE TYPE account_invitation_status AS ENUM ('pending', 'accepted', 'declined');
+
+CREATE TABLE "account_invitation" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  -- Lowercased, the invitee may not have signed up yet.
+  email VARCHAR(255) NOT NULL CHECK (email = lower(email)),
+  role account_member_role NOT NULL,
+  spend_limit DECIMAL(15, 2) CHECK (spend_limit > 0),
+  invited_by UUID NOT NULL REFERENCES "user" (id),
+  status account_invitation_status NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  decided_at TIMESTAMPTZ,
+
+  CONSTRAINT account_invitation_spend_limit_check CHECK ((spend_limit IS NOT NULL) = (role = 'spender')),
+  CONSTRAINT account_invitation_decided_at_check CHECK ((decided_at IS NULL) = (status = 'pending'))
+);
+
+CREATE INDEX idx_account_invitation_account_id ON "account_invitation" (account_id);
+-- At most one pending invitation per account and email.
+CREATE UNIQUE INDEX idx_account_invitation_pending ON "account_invitation" (account_id, email) WHERE status = 'pending';
+CREATE INDEX idx_account_invitation_email ON "account_invitation" (email) WHERE status = 'pending';
+
+CREATE TYPE account_member_removal_status AS ENUM ('pending', 'approved', 'rejected');
+
+CREATE TABLE "account_member_removal" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  -- The member to remove, who may have left already.
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  requested_by UUID NOT NULL REFERENCES "user" (id),
+  status account_member_removal_status NOT NULL DEFAULT 'pending',
+  decided_by UUID REFERENCES "user" (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  decided_at TIMESTAMPTZ,
+
+  CONSTRAINT account_member_removal_decided_check CHECK ((decided_at IS NULL) = (status = 'pending') AND (decided_by IS NULL) = (status = 'pending'))
+);
+
+CREATE INDEX idx_account_member_removal_account_id ON "account_member_removal" (account_id);
+-- At most one pending removal per member.
+CREATE UNIQUE INDEX idx_account_member_removal_pending ON "account_member_removal" (account_id, user_id) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "payment_request_decision";
+DROP TYPE IF EXISTS payment_request_decision;
+DROP TABLE IF EXISTS "payment_request";
+DROP TYPE IF EXISTS payment_request_kind;
+DROP TYPE IF EXISTS payment_request_status;
+DROP TABLE IF EXISTS "account_approval_policy";
@@ -0,0 +1,54 @@
+CREATE TABLE "account_approval_policy" (
+  account_id UUID PRIMARY KEY REFERENCES "account" (id),
+  -- Debits of more than the threshold out of the account need approvals: transfers, withdrawals and closure sweeps.
+  threshold DECIMAL(15, 2) NOT NULL CHECK (threshold >= 0),
+  required_approvals INTEGER NOT NULL CHECK (required_approvals > 0),
+  updated_by UUID NOT NULL REFERENCES "user" (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TYPE payment_request_status AS ENUM ('pending', 'approved', 'executed', 'failed', 'rejected', 'expired');
+CREATE TYPE payment_request_kind AS ENUM ('transfer', 'withdrawal', 'closure');
+
+CREATE TABLE "payment_request" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  -- Closures sweep the balance of the account, up to amount, to to_account_id and close it.
+  kind payment_request_kind NOT NULL DEFAULT 'transfer',
+  -- Id of the movement once executed, known from the start so that a retried submission finds its request.
+  transaction_id UUID NOT NULL UNIQUE,
+  from_account_id UUID NOT NULL REFERENCES "account" (id),
+  -- Null for withdrawals.
+  to_account_id UUID REFERENCES "account" (id),
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+  requested_by UUID NOT NULL REFERENCES "user" (id),
+  -- Copied from the policy when submitted, so that later changes don't affect pending requests.
+  required_approvals INTEGER NOT NULL CHECK (required_approvals > 0),
+  status payment_request_status NOT NULL DEFAULT 'pending',
+  -- Why the approved debit couldn't execute, such as 'insufficient_balance'.
+  failure_reason TEXT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT payment_request_failure_reason_check CHECK ((failure_reason IS NOT NULL) = (status = 'failed')),
+  CONSTRAINT payment_request_to_account_id_check CHECK ((to_account_id IS NULL) = (kind = 'withdrawal'))
+);
+
+CREATE INDEX idx_payment_request_from_account_id ON "payment_request" (from_account_id, created_at);
+CREATE INDEX idx_payment_request_pending ON "payment_request" (expires_at) WHERE status = 'pending';
+CREATE INDEX idx_payment_request_approved ON "payment_request" (updated_at) WHERE status = 'approved';
+
+CREATE TYPE payment_request_decision AS ENUM ('approved', 'rejected');
+
+CREATE TABLE "payment_request_decision" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  payment_request_id UUID NOT NULL REFERENCES "payment_request" (id),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  decision payment_request_decision NOT NULL,
+  comment TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  -- Each owner decides once, so N approvals come from N people.
+  UNIQUE (payment_request_id, user_id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE "payee" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL REFERENCES "user" (id),
+  account_id UUID NOT NULL REFERENCES "account" (id),
+  nickname VARCHAR(50) NOT NULL CHECK (nickname <> ''),
+  -- Transfers to the payee are limited during the cooling-off period that starts here.
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  UNIQUE (user_id, account_id)
+);
+
+-- Nicknames tell payees apart, so they're unique per user whatever their case.
+CREATE UNIQUE INDEX idx_payee_user_id_nickname ON "payee" (user_id, lower(nickname));
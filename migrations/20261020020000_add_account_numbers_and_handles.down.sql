@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "handle";
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS account_number_key;
+ALTER TABLE "account" DROP COLUMN IF EXISTS number;
+DROP SEQUENCE IF EXISTS account_number_seq;
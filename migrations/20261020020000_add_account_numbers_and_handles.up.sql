@@ -0,0 +1,25 @@
+-- Serial of the account number, which the server formats with the bank code and check digits.
+CREATE SEQUENCE account_number_seq;
+ALTER TABLE "account" ADD COLUMN number BIGINT;
+
+-- Existing accounts are numbered in creation order.
+UPDATE "account" acc SET number = numbered.number
+FROM (SELECT id, row_number() OVER (ORDER BY created_at, id) AS number FROM "account") numbered
+WHERE acc.id = numbered.id;
+SELECT setval('account_number_seq', COALESCE((SELECT MAX(number) FROM "account"), 0) + 1, false);
+
+ALTER TABLE "account"
+  ALTER COLUMN number SET DEFAULT nextval('account_number_seq'),
+  ALTER COLUMN number SET NOT NULL,
+  ADD CONSTRAINT account_number_key UNIQUE (number);
+ALTER SEQUENCE account_number_seq OWNED BY "account".number;
+
+-- A handle such as @alice lets a user be paid into an account they hold, which has one handle at most.
+CREATE TABLE "handle" (
+  -- Stored lowercase and without its @.
+  handle VARCHAR(30) PRIMARY KEY CHECK (handle ~ '^[a-z][a-z0-9_]{2,29}$'),
+  user_id UUID NOT NULL UNIQUE REFERENCES "user" (id),
+  account_id UUID NOT NULL UNIQUE REFERENCES "account" (id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
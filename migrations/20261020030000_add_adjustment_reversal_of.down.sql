@@ -0,0 +1 @@
+ALTER TABLE "adjustment" DROP COLUMN IF EXISTS reversal_of;
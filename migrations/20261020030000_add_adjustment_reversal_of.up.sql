@@ -0,0 +1,2 @@
+-- An adjustment reversing a transaction posts its reversal once approved, rather than an 'adjustment' transaction.
+ALTER TABLE "adjustment" ADD COLUMN reversal_of UUID REFERENCES "transaction" (id);
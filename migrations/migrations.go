@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// sha256 of the up script, used to detect migrations edited after being applied.
+	Checksum string
+}
+
+/*
+Load reads every embedded migration.
+
+Files are named `<version>_<name>.up.sql` and `<version>_<name>.down.sql`, where version is
+the creation timestamp (YYYYMMDDHHMMSS). A down script is optional, but without one the
+migration cannot be rolled back.
+*/
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	by_version := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, name, direction, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := by_version[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			by_version[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names: %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range by_version {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up script", migration.Version, migration.Name)
+		}
+		migration.Checksum = checksum(migration.Up)
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func parseFileName(file_name string) (int64, string, string, error) {
+	base := strings.TrimSuffix(file_name, ".sql")
+
+	direction := ""
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		direction = "up"
+	case strings.HasSuffix(base, ".down"):
+		direction = "down"
+	default:
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: expected .up.sql or .down.sql suffix", file_name)
+	}
+	base = strings.TrimSuffix(base, "."+direction)
+
+	raw_version, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: expected <version>_<name>", file_name)
+	}
+
+	version, err := strconv.ParseInt(raw_version, 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: version must be numeric", file_name)
+	}
+
+	return version, name, direction, nil
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseFileName(t *testing.T) {
+	cases := []struct {
+		file_name string
+		version   int64
+		name      string
+		direction string
+		err       string
+	}{
+		{file_name: "20240619210728_create_user_table.up.sql", version: 20240619210728, name: "create_user_table", direction: "up"},
+		{file_name: "20240619210728_create_user_table.down.sql", version: 20240619210728, name: "create_user_table", direction: "down"},
+		{file_name: "1_x.up.sql", version: 1, name: "x", direction: "up"},
+		{file_name: "20240619210728_create_user_table.sql", err: "expected .up.sql or .down.sql suffix"},
+		{file_name: "20240619210728.up.sql", err: "expected <version>_<name>"},
+		{file_name: "20240619210728_.up.sql", err: "expected <version>_<name>"},
+		{file_name: "v1_create_user_table.up.sql", err: "version must be numeric"},
+	}
+
+	for _, c := range cases {
+		version, name, direction, err := parseFileName(c.file_name)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("parseFileName(%q) error = %v, want %q", c.file_name, err, c.err)
+			}
+			continue
+		}
+
+		if err != nil || version != c.version || name != c.name || direction != c.direction {
+			t.Errorf("parseFileName(%q) = %d, %q, %q, %v", c.file_name, version, name, direction, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		title string
+		fsys  fstest.MapFS
+		want  []int64
+		err   string
+	}{
+		{
+			title: "migrations are ordered by version, not by file name",
+			fsys: fstest.MapFS{
+				"3_c.up.sql":    {Data: []byte("SELECT 3;")},
+				"10_a.up.sql":   {Data: []byte("SELECT 10;")},
+				"10_a.down.sql": {Data: []byte("SELECT -10;")},
+				"2_b.up.sql":    {Data: []byte("SELECT 2;")},
+				"README.md":     {Data: []byte("not a migration")},
+				"nested":        {Mode: fs.ModeDir | 0o755},
+			},
+			want: []int64{2, 3, 10},
+		},
+		{
+			title: "down scripts are optional",
+			fsys:  fstest.MapFS{"1_a.up.sql": {Data: []byte("SELECT 1;")}},
+			want:  []int64{1},
+		},
+		{
+			title: "up scripts are not",
+			fsys:  fstest.MapFS{"1_a.up.sql": {Data: []byte("SELECT 1;")}, "2_b.down.sql": {Data: []byte("SELECT -2;")}},
+			err:   "migration 2_b is missing its up script",
+		},
+		{
+			title: "both scripts share a name",
+			fsys:  fstest.MapFS{"1_a.up.sql": {Data: []byte("SELECT 1;")}, "1_b.down.sql": {Data: []byte("SELECT -1;")}},
+			err:   "conflicting names",
+		},
+		{
+			title: "every .sql file is a migration",
+			fsys:  fstest.MapFS{"1_a.up.sql": {Data: []byte("SELECT 1;")}, "seed.sql": {Data: []byte("SELECT 0;")}},
+			err:   "invalid migration file name",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			migrations, err := load(c.fsys)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("load error = %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			versions := []int64{}
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+				if migration.Checksum != checksum(migration.Up) {
+					t.Errorf("migration %d checksum = %s, want the sha256 of its up script", migration.Version, migration.Checksum)
+				}
+			}
+			if len(versions) != len(c.want) {
+				t.Fatalf("versions = %v, want %v", versions, c.want)
+			}
+			for i := range versions {
+				if versions[i] != c.want[i] {
+					t.Fatalf("versions = %v, want %v", versions, c.want)
+				}
+			}
+		})
+	}
+
+	migrations, err := load(fstest.MapFS{"1_a.up.sql": {Data: []byte("SELECT 1;")}, "1_a.down.sql": {Data: []byte("SELECT -1;")}})
+	if err != nil || len(migrations) != 1 || migrations[0].Up != "SELECT 1;" || migrations[0].Down != "SELECT -1;" {
+		t.Errorf("up and down scripts aren't paired: %+v, %v", migrations, err)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"1_a.up.sql": {Data: []byte("SELECT 1;")},
+		"2_b.up.sql": {Data: []byte("SELECT 2;")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migrator{Migrations: migrations}
+
+	records := map[int64]AppliedMigration{1: {Version: 1, Name: "a", Checksum: checksum("SELECT 1;")}}
+	if err = m.verifyChecksums(records); err != nil {
+		t.Errorf("verifyChecksums of unchanged migrations = %v", err)
+	}
+
+	// Pending migrations and applied ones unknown to this binary aren't checked.
+	records[3] = AppliedMigration{Version: 3, Name: "c", Checksum: checksum("SELECT 3;")}
+	if err = m.verifyChecksums(records); err != nil {
+		t.Errorf("verifyChecksums with an unknown migration = %v", err)
+	}
+
+	records[1] = AppliedMigration{Version: 1, Name: "a", Checksum: checksum("SELECT 1; -- edited")}
+	mismatch := &ChecksumMismatchError{}
+	if err = m.verifyChecksums(records); !errors.As(err, &mismatch) || mismatch.Version != 1 || mismatch.Name != "a" {
+		t.Errorf("verifyChecksums of an edited migration = %v, want a ChecksumMismatchError for 1_a", err)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, migration := range migrations {
+		if _, err := time.Parse("20060102150405", strconv.FormatInt(migration.Version, 10)); err != nil {
+			t.Errorf("migration %d_%s isn't versioned with a YYYYMMDDHHMMSS timestamp: %v", migration.Version, migration.Name, err)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			t.Errorf("migration %d_%s isn't after %d_%s", migration.Version, migration.Name, migrations[i-1].Version, migrations[i-1].Name)
+		}
+	}
+
+	baseline := (&Migrator{Migrations: migrations}).baseline()
+	if len(baseline) != 4 || baseline[len(baseline)-1].Version != baseline_version {
+		t.Errorf("baseline = %d migrations, want the 4 up to %d", len(baseline), baseline_version)
+	}
+}
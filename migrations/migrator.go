@@ -0,0 +1,410 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Arbitrary key for pg_advisory_lock, shared by every instance running migrations.
+const advisory_lock_id = 8_675_309_2024
+
+/*
+baseline_version is the last of the migrations that docker-compose used to run as initdb
+scripts, before the migrator existed. Databases created that way have their tables but no
+schema_migrations rows, so they are adopted up to it instead of failing with "relation already
+exists" on the first migration.
+*/
+const baseline_version = 20240619211419
+
+var ErrMissingUuidv7 = errors.New(
+	"the pg_uuidv7 extension is not available on the Postgres server: " +
+		"install pg_uuidv7.so, pg_uuidv7.control and pg_uuidv7--1.5.sql from pg_uuidv7/ into the server (see docker-compose.yml)",
+)
+
+type ChecksumMismatchError struct {
+	Version int64
+	Name    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("migration %d_%s was edited after being applied (checksum mismatch)", e.Version, e.Name)
+}
+
+type AppliedMigration struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// 'applied' | 'pending' | 'modified' | 'missing'
+	State     string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	Pg         *sqlx.DB
+	Migrations []Migration
+}
+
+func NewMigrator(pg *sqlx.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{Pg: pg, Migrations: migrations}, nil
+}
+
+// Up applies every pending migration, each one in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		if _, err := m.adoptBaseline(ctx, conn); err != nil {
+			return err
+		}
+
+		records, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err = m.verifyChecksums(records); err != nil {
+			return err
+		}
+
+		pending := []Migration{}
+		for _, migration := range m.Migrations {
+			if _, ok := records[migration.Version]; !ok {
+				pending = append(pending, migration)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if err = checkUuidv7(ctx, conn); err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			if err = apply(ctx, conn, migration); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+/*
+Adopt records the baseline migrations as applied on a database whose schema was created
+before the migrator, without running them. It does nothing on a database that has applied
+migrations already, or that is empty; Up adopts by itself, Adopt only reports it ahead.
+*/
+func (m *Migrator) Adopt(ctx context.Context) ([]Migration, error) {
+	adopted := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sqlx.Conn) (err error) {
+		adopted, err = m.adoptBaseline(ctx, conn)
+		return err
+	})
+
+	return adopted, err
+}
+
+func (m *Migrator) adoptBaseline(ctx context.Context, conn *sqlx.Conn) ([]Migration, error) {
+	adopted := []Migration{}
+
+	recorded := false
+	if err := conn.GetContext(ctx, &recorded, `SELECT EXISTS (SELECT 1 FROM schema_migrations)`); err != nil {
+		return nil, err
+	}
+	if recorded {
+		return adopted, nil
+	}
+
+	// The tables the initdb scripts created; with none of them the database is new and migrated from scratch.
+	initialized := false
+	if err := conn.GetContext(ctx, &initialized, `
+		SELECT to_regclass('"user"') IS NOT NULL
+			AND to_regclass('"account"') IS NOT NULL
+			AND to_regclass('"transaction"') IS NOT NULL`,
+	); err != nil {
+		return nil, err
+	}
+	if !initialized {
+		return adopted, nil
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, migration := range m.baseline() {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, migration.Version, migration.Name, migration.Checksum); err != nil {
+			return nil, err
+		}
+		adopted = append(adopted, migration)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return adopted, nil
+}
+
+// baseline returns the migrations up to baseline_version, oldest first.
+func (m *Migrator) baseline() []Migration {
+	baseline := []Migration{}
+	for _, migration := range m.Migrations {
+		if migration.Version <= baseline_version {
+			baseline = append(baseline, migration)
+		}
+	}
+
+	return baseline
+}
+
+// Down rolls back the last `steps` applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		records, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err = m.verifyChecksums(records); err != nil {
+			return err
+		}
+
+		// Newer migrations unknown to this binary would have to be reverted first, and we have no down script for them.
+		for _, record := range records {
+			if m.find(record.Version) == nil {
+				return fmt.Errorf("migration %d_%s is applied but not embedded in this binary", record.Version, record.Name)
+			}
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.Migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+
+			if err = revert(ctx, conn, migration); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists embedded migrations alongside the ones recorded in the database. It never writes.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.Pg.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	records := map[int64]AppliedMigration{}
+
+	exists := false
+	if err = conn.GetContext(ctx, &exists, `SELECT to_regclass('schema_migrations') IS NOT NULL`); err != nil {
+		return nil, err
+	}
+	if exists {
+		if records, err = appliedMigrations(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, State: "pending"}
+
+		if record, ok := records[migration.Version]; ok {
+			status.State = "applied"
+			status.AppliedAt = &record.AppliedAt
+			if record.Checksum != migration.Checksum {
+				status.State = "modified"
+			}
+			delete(records, migration.Version)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range records {
+		applied_at := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: record.Version, Name: record.Name, State: "missing", AppliedAt: &applied_at})
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.Migrations {
+		if m.Migrations[i].Version == version {
+			return &m.Migrations[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) verifyChecksums(records map[int64]AppliedMigration) error {
+	for _, migration := range m.Migrations {
+		record, ok := records[migration.Version]
+		if ok && record.Checksum != migration.Checksum {
+			return &ChecksumMismatchError{Version: migration.Version, Name: migration.Name}
+		}
+	}
+
+	return nil
+}
+
+/*
+withLock runs fn on a single connection holding a session-level advisory lock, so that
+concurrent instances wait for each other instead of applying the same migration twice.
+*/
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.Pg.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisory_lock_id); err != nil {
+		return err
+	}
+	// Use a fresh context so the lock is released even if ctx was cancelled.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisory_lock_id)
+
+	if _, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+	); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sqlx.Conn) (map[int64]AppliedMigration, error) {
+	rows := []AppliedMigration{}
+	if err := conn.SelectContext(ctx, &rows, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`); err != nil {
+		return nil, err
+	}
+
+	records := map[int64]AppliedMigration{}
+	for _, row := range rows {
+		records[row.Version] = row
+	}
+
+	return records, nil
+}
+
+func checkUuidv7(ctx context.Context, conn *sqlx.Conn) error {
+	available := false
+	if err := conn.GetContext(ctx, &available, `SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'pg_uuidv7')`); err != nil {
+		return err
+	}
+
+	if !available {
+		return ErrMissingUuidv7
+	}
+
+	return nil
+}
+
+func apply(ctx context.Context, conn *sqlx.Conn, migration Migration) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, migration.Up); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, migration.Version, migration.Name, migration.Checksum); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func revert(ctx context.Context, conn *sqlx.Conn, migration Migration) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, migration.Down); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var invalid_name_chars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create writes an empty up/down pair to dir, versioned with the current UTC timestamp.
+func Create(dir string, name string) (string, string, error) {
+	name = strings.Trim(invalid_name_chars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name must contain at least one letter or digit")
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+	up_path := filepath.Join(dir, fmt.Sprintf("%s_%s.up.sql", version, name))
+	down_path := filepath.Join(dir, fmt.Sprintf("%s_%s.down.sql", version, name))
+
+	if err := os.WriteFile(up_path, []byte("-- Write the "+name+" migration here.\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down_path, []byte("-- Revert the "+name+" migration here.\n"), 0o644); err != nil {
+		return "", "", err
+	}
+
+	return up_path, down_path, nil
+}
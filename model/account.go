@@ -12,8 +12,31 @@ type Account struct {
 	UserId  uuid.UUID       `db:"user_id" json:"user_id"`
 	Name    string          `db:"name" json:"name"`
 	Balance decimal.Decimal `db:"balance" json:"balance"`
-	// 'active' | 'inactive'
-	Status    string    `db:"status" json:"status"`
+	// One of the Account* statuses.
+	Status string `db:"status" json:"status"`
+	// One of AccountStatusReasons, set for frozen and closed accounts.
+	StatusReason *string `db:"status_reason" json:"status_reason"`
+	// End of a time-bounded freeze, nil for indefinite ones.
+	FrozenUntil *time.Time `db:"frozen_until" json:"frozen_until"`
+	// When a closed account was closed, nil for every other status.
+	ClosedAt *time.Time `db:"closed_at" json:"closed_at"`
+	// Serial of the account number, unique and assigned in creation order.
+	Number    int64     `db:"number" json:"number"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+/*
+Frozen accounts can't be debited (frozen_debit) or can't move money at all (frozen_all).
+Inactive accounts were disabled by their owner, closed ones by the bank or on request.
+*/
+const (
+	AccountActive      = "active"
+	AccountInactive    = "inactive"
+	AccountFrozenDebit = "frozen_debit"
+	AccountFrozenAll   = "frozen_all"
+	AccountClosed      = "closed"
+)
+
+// Why an account was frozen or closed.
+var AccountStatusReasons = []string{"fraud_suspected", "sanctions_screening", "court_order", "kyc_review", "customer_request", "deceased", "other"}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Adjustment is a request by staff to credit or debit an account, posted once other staff approve it.
+type Adjustment struct {
+	Id        uuid.UUID `db:"id" json:"id"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	// Positive credits the account, negative debits it.
+	Amount decimal.Decimal `db:"amount" json:"amount"`
+	Reason string          `db:"reason" json:"reason"`
+	// What supports the adjustment, such as a ticket or a statement reference.
+	Evidence string `db:"evidence" json:"evidence"`
+	// 'pending' | 'approved' | 'rejected'
+	Status string `db:"status" json:"status"`
+	// Approvals needed before it's posted, set when it's proposed.
+	RequiredApprovals int       `db:"required_approvals" json:"required_approvals"`
+	ProposedBy        uuid.UUID `db:"proposed_by" json:"proposed_by"`
+	// The transaction it reverses, if any. AccountId and Amount are then the effect of the reversal on the
+	// account it debits, or credits for withdrawals, and the reversal is posted instead of an adjustment.
+	ReversalOf *uuid.UUID `db:"reversal_of" json:"reversal_of"`
+	// The adjustment transaction, or the reversal, set once approved.
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// AdjustmentDecision is an approval or rejection of an adjustment by a staff member other than its proposer.
+type AdjustmentDecision struct {
+	Id           uuid.UUID `db:"id" json:"id"`
+	AdjustmentId uuid.UUID `db:"adjustment_id" json:"adjustment_id"`
+	StaffId      uuid.UUID `db:"staff_id" json:"staff_id"`
+	// 'approved' | 'rejected'
+	Decision  string    `db:"decision" json:"decision"`
+	Comment   *string   `db:"comment" json:"comment"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
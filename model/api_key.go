@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ApiKey struct {
+	Id      uuid.UUID `db:"id" json:"id"`
+	UserId  uuid.UUID `db:"user_id" json:"user_id"`
+	Name    string    `db:"name" json:"name"`
+	KeyHash string    `db:"key_hash" json:"-"`
+	// First characters of the key, to tell keys apart without storing them.
+	Prefix    string     `db:"prefix" json:"prefix"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+)
+
+type AuditEvent struct {
+	Id         uuid.UUID      `db:"id" json:"id"`
+	Actor      string         `db:"actor" json:"actor"`
+	Action     string         `db:"action" json:"action"`
+	TargetType string         `db:"target_type" json:"target_type"`
+	TargetId   string         `db:"target_id" json:"target_id"`
+	Reason     *string        `db:"reason" json:"reason"`
+	Details    types.JSONText `db:"details" json:"details"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	// The user the event is about, who can read it.
+	UserId    *uuid.UUID `db:"user_id" json:"user_id"`
+	Ip        *string    `db:"ip" json:"ip"`
+	UserAgent *string    `db:"user_agent" json:"user_agent"`
+	RequestId *string    `db:"request_id" json:"request_id"`
+	// Snapshots of the target, null when it didn't exist before or doesn't anymore.
+	Before *types.JSONText `db:"before" json:"before"`
+	After  *types.JSONText `db:"after" json:"after"`
+}
+
+// AuditActor is who makes changes, and from where, see repository.WithAuditActor.
+type AuditActor struct {
+	// 'user:<id>' | 'cli:<name>' | 'processor' | 'anonymous' | 'system'
+	Actor     string
+	Ip        string
+	UserAgent string
+	RequestId string
+	Reason    string
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// Event is a change pushed to a user's clients, see the EventStore.
+type Event struct {
+	// Ordered per user, "<milliseconds>-<sequence>" like Valkey stream ids.
+	Id string `json:"id"`
+	// 'transaction.created' | 'account.balance_changed' | 'account.disabled' | 'account.status_changed'
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Handle is a name such as @alice lets others pay AccountId, one of the accounts of UserId, without knowing its id.
+type Handle struct {
+	// Lowercase and without its @.
+	Handle    string    `db:"handle" json:"handle"`
+	UserId    uuid.UUID `db:"user_id" json:"user_id"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
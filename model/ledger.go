@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HexBytes are stored as BYTEA and shown in hex, like the hashes and signatures of the ledger.
+type HexBytes []byte
+
+func (h HexBytes) String() string {
+	return hex.EncodeToString(h)
+}
+
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	if h == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(h.String())
+}
+
+func (h *HexBytes) UnmarshalJSON(raw []byte) error {
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	if value == nil {
+		*h = nil
+		return nil
+	}
+
+	decoded, err := hex.DecodeString(*value)
+	if err != nil {
+		return err
+	}
+
+	*h = decoded
+	return nil
+}
+
+func (h *HexBytes) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*h = nil
+	case []byte:
+		*h = append(HexBytes{}, value...)
+	default:
+		return fmt.Errorf("cannot scan %T into HexBytes", src)
+	}
+
+	return nil
+}
+
+func (h HexBytes) Value() (driver.Value, error) {
+	if h == nil {
+		return nil, nil
+	}
+
+	return []byte(h), nil
+}
+
+// LedgerHead is the end of an account's chain of transactions.
+type LedgerHead struct {
+	AccountId uuid.UUID `db:"id" json:"account_id"`
+	// Number of transactions in the chain.
+	Length int64 `db:"chain_length" json:"length"`
+	// Hash of the latest transaction of the chain, null while it's empty.
+	Head HexBytes `db:"chain_head" json:"head"`
+}
+
+// LedgerHeads are stored as JSONB.
+type LedgerHeads []LedgerHead
+
+func (h *LedgerHeads) Scan(src any) error {
+	raw, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into LedgerHeads", src)
+	}
+
+	return json.Unmarshal(raw, h)
+}
+
+func (h LedgerHeads) Value() (driver.Value, error) {
+	return json.Marshal(h)
+}
+
+/*
+LedgerCheckpoint is a signed snapshot of the head of every account's chain. Exported
+checkpoints let the ledger be checked offline: the chains must still lead to the same heads.
+*/
+type LedgerCheckpoint struct {
+	Id        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	Accounts  int       `db:"accounts" json:"accounts"`
+	// Sum of the lengths of the chains; transfers are in two of them.
+	Links int64 `db:"links" json:"links"`
+	// Hash of Heads, which is what is signed along with the counts.
+	Root  HexBytes    `db:"root" json:"root"`
+	Heads LedgerHeads `db:"heads" json:"heads"`
+	// Ed25519 key the checkpoint is signed with, see utils.KeyId.
+	KeyId     string   `db:"key_id" json:"key_id"`
+	PublicKey HexBytes `db:"public_key" json:"public_key"`
+	Signature HexBytes `db:"signature" json:"signature"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+/*
+Owners can do anything with an account, spenders move money out of it up to their spend limit
+per transaction, and viewers only see it.
+*/
+const (
+	MemberOwner   = "owner"
+	MemberSpender = "spender"
+	MemberViewer  = "viewer"
+)
+
+var MemberRoles = []string{MemberOwner, MemberSpender, MemberViewer}
+
+// AccountMember is a user sharing an account. Its creator is its first owner.
+type AccountMember struct {
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	UserId    uuid.UUID `db:"user_id" json:"user_id"`
+	// One of MemberRoles.
+	Role string `db:"role" json:"role"`
+	// Largest amount a spender can move out of the account in one transaction, nil for other roles.
+	SpendLimit *decimal.Decimal `db:"spend_limit" json:"spend_limit"`
+	CreatedAt  time.Time        `db:"created_at" json:"created_at"`
+}
+
+// AccountInvitation offers a role on an account to whoever has an email, who accepts or declines it.
+type AccountInvitation struct {
+	Id        uuid.UUID `db:"id" json:"id"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	// Lowercased.
+	Email      string           `db:"email" json:"email"`
+	Role       string           `db:"role" json:"role"`
+	SpendLimit *decimal.Decimal `db:"spend_limit" json:"spend_limit"`
+	InvitedBy  uuid.UUID        `db:"invited_by" json:"invited_by"`
+	// 'pending' | 'accepted' | 'declined'
+	Status    string     `db:"status" json:"status"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	DecidedAt *time.Time `db:"decided_at" json:"decided_at"`
+}
+
+// MemberRemoval is a request to remove a member from an account, carried out once an owner approves it.
+type MemberRemoval struct {
+	Id        uuid.UUID `db:"id" json:"id"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	// The member to remove.
+	UserId      uuid.UUID `db:"user_id" json:"user_id"`
+	RequestedBy uuid.UUID `db:"requested_by" json:"requested_by"`
+	// 'pending' | 'approved' | 'rejected'
+	Status    string     `db:"status" json:"status"`
+	DecidedBy *uuid.UUID `db:"decided_by" json:"decided_by"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	DecidedAt *time.Time `db:"decided_at" json:"decided_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payee is an account a user saved under a nickname to transfer money to.
+type Payee struct {
+	Id        uuid.UUID `db:"id" json:"id"`
+	UserId    uuid.UUID `db:"user_id" json:"user_id"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	Nickname  string    `db:"nickname" json:"nickname"`
+	// Start of the cooling-off period, which a payee deleted and saved again goes through anew.
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
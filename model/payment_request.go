@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ApprovalPolicy holds the debits of more than Threshold out of an account for the approval of its owners.
+type ApprovalPolicy struct {
+	AccountId uuid.UUID       `db:"account_id" json:"account_id"`
+	Threshold decimal.Decimal `db:"threshold" json:"threshold"`
+	// Approvals of owners, other than the requester, a held debit needs to execute.
+	RequiredApprovals int       `db:"required_approvals" json:"required_approvals"`
+	UpdatedBy         uuid.UUID `db:"updated_by" json:"updated_by"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+}
+
+/*
+PaymentRequest is a transfer, withdrawal or closure held by the approval policy of its account.
+Once approved it's executed as TransactionId, ending executed or failed; a rejection or its
+expiry end it instead.
+*/
+type PaymentRequest struct {
+	Id uuid.UUID `db:"id" json:"id"`
+	// 'transfer' | 'withdrawal' | 'closure', which sweeps the balance, up to Amount, to ToAccountId.
+	Kind          string    `db:"kind" json:"kind"`
+	TransactionId uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	FromAccountId uuid.UUID `db:"from_account_id" json:"from_account_id"`
+	// Nil for withdrawals.
+	ToAccountId *uuid.UUID      `db:"to_account_id" json:"to_account_id"`
+	Amount      decimal.Decimal `db:"amount" json:"amount"`
+	RequestedBy uuid.UUID       `db:"requested_by" json:"requested_by"`
+	// Copied from the policy when submitted.
+	RequiredApprovals int `db:"required_approvals" json:"required_approvals"`
+	// 'pending' | 'approved' | 'executed' | 'failed' | 'rejected' | 'expired'
+	Status string `db:"status" json:"status"`
+	// Why the approved debit couldn't execute, set when failed.
+	FailureReason *string   `db:"failure_reason" json:"failure_reason"`
+	ExpiresAt     time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// PaymentRequestDecision is an approval or rejection of a payment request by an owner other than its requester.
+type PaymentRequestDecision struct {
+	Id               uuid.UUID `db:"id" json:"id"`
+	PaymentRequestId uuid.UUID `db:"payment_request_id" json:"payment_request_id"`
+	UserId           uuid.UUID `db:"user_id" json:"user_id"`
+	// 'approved' | 'rejected'
+	Decision  string    `db:"decision" json:"decision"`
+	Comment   *string   `db:"comment" json:"comment"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
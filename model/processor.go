@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ProcessorCharge is a payment received by the payment processor, deposited once it succeeds.
+type ProcessorCharge struct {
+	// The processor's charge id.
+	Id        string          `db:"id" json:"id"`
+	AccountId uuid.UUID       `db:"account_id" json:"account_id"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	// 'pending' | 'succeeded' | 'failed'
+	Status         string  `db:"status" json:"status"`
+	FailureMessage *string `db:"failure_message" json:"failure_message"`
+	// The deposit, set once the charge succeeded.
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
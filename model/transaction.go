@@ -9,10 +9,17 @@ import (
 
 type Transaction struct {
 	Id uuid.UUID `db:"id" json:"id"`
-	// 'deposit' | 'withdrawal' | 'transfer'
+	// 'deposit' | 'withdrawal' | 'transfer' | 'adjustment'
 	Type          string          `db:"type" json:"type"`
 	FromAccountId *uuid.UUID      `db:"from_account_id" json:"from_account_id"`
 	ToAccountId   *uuid.UUID      `db:"to_account_id" json:"to_account_id"`
 	DateIssued    time.Time       `db:"date_issued" json:"date_issued"`
 	Amount        decimal.Decimal `db:"amount" json:"amount"`
+	// Set when this transaction reverses another one.
+	ReversalOf *uuid.UUID `db:"reversal_of" json:"reversal_of"`
+	// Hashes of the previous transactions of the from and to accounts, see repository.LedgerHash.
+	FromPrevHash HexBytes `db:"from_prev_hash" json:"-"`
+	ToPrevHash   HexBytes `db:"to_prev_hash" json:"-"`
+	// Covers the fields above, so editing any of them breaks the chain.
+	ChainHash HexBytes `db:"chain_hash" json:"-"`
 }
@@ -7,9 +7,22 @@ import (
 )
 
 type User struct {
-	Id                uuid.UUID `db:"id" json:"id"`
-	Email             string    `db:"email" json:"email"`
-	EncryptedPassword string    `db:"password" json:"-"`
-	CreatedAt         time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+	Id                uuid.UUID  `db:"id" json:"id"`
+	Email             string     `db:"email" json:"email"`
+	EncryptedPassword string     `db:"password" json:"-"`
+	DisabledAt        *time.Time `db:"disabled_at" json:"disabled_at"`
+	// One of Roles.
+	Role      string    `db:"role" json:"role"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+// Customers own accounts, the other roles are staff with access to the admin API.
+const (
+	RoleCustomer   = "customer"
+	RoleSupport    = "support"
+	RoleCompliance = "compliance"
+	RoleAdmin      = "admin"
+)
+
+var Roles = []string{RoleCustomer, RoleSupport, RoleCompliance, RoleAdmin}
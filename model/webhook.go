@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+type WebhookEndpoint struct {
+	Id     uuid.UUID `db:"id" json:"id"`
+	UserId uuid.UUID `db:"user_id" json:"user_id"`
+	Url    string    `db:"url" json:"url"`
+	// Signs the deliveries, so unlike API keys it is stored as is.
+	Secret string `db:"secret" json:"-"`
+	// Event types delivered to the endpoint, every type when empty.
+	EventTypes pq.StringArray `db:"event_types" json:"event_types"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	DeletedAt  *time.Time     `db:"deleted_at" json:"deleted_at"`
+}
+
+/*
+OutboxEvent is written in the same database transaction as the change it describes, so that
+no event is lost when the server stops before delivering it. Data has the same shape as the
+matching event pushed on GET /v2/events.
+*/
+type OutboxEvent struct {
+	Id     uuid.UUID `db:"id" json:"id"`
+	UserId uuid.UUID `db:"user_id" json:"user_id"`
+	// 'transaction.created' | 'account.balance_changed' | 'account.disabled' | 'account.status_changed'
+	Type         string         `db:"type" json:"type"`
+	Data         types.JSONText `db:"data" json:"data"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+	DispatchedAt *time.Time     `db:"dispatched_at" json:"dispatched_at"`
+}
+
+// WebhookDelivery is an outbox event to send to one endpoint.
+type WebhookDelivery struct {
+	Id         uuid.UUID `db:"id" json:"id"`
+	EndpointId uuid.UUID `db:"endpoint_id" json:"endpoint_id"`
+	EventId    uuid.UUID `db:"event_id" json:"event_id"`
+	// Type and data of the event, joined from outbox_event.
+	EventType      string         `db:"event_type" json:"event_type"`
+	EventData      types.JSONText `db:"event_data" json:"event_data"`
+	EventCreatedAt time.Time      `db:"event_created_at" json:"event_created_at"`
+	// 'pending' | 'succeeded' | 'dead'
+	Status        string    `db:"status" json:"status"`
+	Attempts      int       `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type WebhookDeliveryAttempt struct {
+	Id          uuid.UUID `db:"id" json:"id"`
+	DeliveryId  uuid.UUID `db:"delivery_id" json:"delivery_id"`
+	AttemptedAt time.Time `db:"attempted_at" json:"attempted_at"`
+	// Nil when no response was received.
+	StatusCode *int    `db:"status_code" json:"status_code"`
+	Error      *string `db:"error" json:"error"`
+	DurationMs int     `db:"duration_ms" json:"duration_ms"`
+}
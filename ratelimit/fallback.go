@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+/*
+FallbackLimiter uses Primary and switches to Fallback while Primary fails, e.g. while Valkey
+is unreachable. Clients are never rejected because the limiter itself is down.
+*/
+type FallbackLimiter struct {
+	Primary  Limiter
+	Fallback Limiter
+	// Unix nanoseconds of the last fallback warning, to log once per minute at most.
+	warned atomic.Int64
+}
+
+func (fl *FallbackLimiter) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	result, err := fl.Primary.Take(ctx, key, limit)
+	if err == nil {
+		return result, nil
+	}
+
+	now := time.Now().UnixNano()
+	if last := fl.warned.Load(); now-last > int64(time.Minute) && fl.warned.CompareAndSwap(last, now) {
+		log.Println("[ERROR] [FallbackLimiter] primary limiter failed, using in-memory limits: ", err)
+	}
+
+	return fl.Fallback.Take(ctx, key, limit)
+}
+
+// New returns a Valkey limiter that falls back to per-instance memory limits.
+func New(v valkey.Client) Limiter {
+	return &FallbackLimiter{Primary: &ValkeyLimiter{Valkey: v}, Fallback: NewMemoryLimiter()}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// Buckets untouched for longer than their window are full again and can be dropped.
+	window time.Duration
+}
+
+// MemoryLimiter keeps buckets in the process, so its limits apply per instance.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// Calls since the last sweep of idle buckets.
+	calls int
+	now   func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// SetClock makes the limiter read the time from now, so that tests don't depend on the wall clock.
+func (ml *MemoryLimiter) SetClock(now func() time.Time) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.now = now
+}
+
+func (ml *MemoryLimiter) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := ml.now()
+	ml.sweep(now)
+
+	capacity := float64(limit.Requests)
+	b, ok := ml.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		ml.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)*capacity/float64(limit.Window))
+	}
+	b.updated = now
+	b.window = limit.Window
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return newResult(limit, allowed, b.tokens), nil
+}
+
+// sweep drops idle buckets every 1000 calls so the map doesn't grow with every client ever seen.
+func (ml *MemoryLimiter) sweep(now time.Time) {
+	ml.calls++
+	if ml.calls < 1000 {
+		return
+	}
+	ml.calls = 0
+
+	for key, b := range ml.buckets {
+		if now.Sub(b.updated) > b.window {
+			delete(ml.buckets, key)
+		}
+	}
+}
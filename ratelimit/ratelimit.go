@@ -0,0 +1,150 @@
+/*
+Package ratelimit implements token bucket rate limits. Buckets live in Valkey so that every
+API instance shares them, with a per-instance in-memory fallback for when Valkey is down.
+*/
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Window. Bursts of up to Requests are allowed, and tokens refill continuously.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// ParseLimit parses limits written as "<requests>/<window>", e.g. "10/1m" or "300/1h".
+func ParseLimit(raw string) (Limit, error) {
+	requests, window, ok := strings.Cut(strings.TrimSpace(raw), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected <requests>/<window>", raw)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q, requests must be a positive integer", raw)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q, window must be a positive duration", raw)
+	}
+
+	return Limit{Requests: n, Window: d}, nil
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Time until the bucket is full again.
+	Reset time.Duration
+	// Time until the next request is allowed, zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// newResult derives a Result from what is left in a bucket after taking a token (or failing to).
+func newResult(limit Limit, allowed bool, tokens float64) Result {
+	per_token := float64(limit.Window) / float64(limit.Requests)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) * per_token),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * per_token)
+	}
+
+	return result
+}
+
+type Limiter interface {
+	// Take takes a token from the bucket identified by key, which holds at most limit.Requests tokens.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type Scope string
+
+const (
+	ScopeIP     Scope = "ip"
+	ScopeUser   Scope = "user"
+	ScopeApiKey Scope = "api_key"
+)
+
+var Scopes = []Scope{ScopeIP, ScopeApiKey, ScopeUser}
+
+// Policy holds the limits of a route group. Scopes without a limit aren't limited.
+type Policy map[Scope]Limit
+
+// Config maps route groups to their policy.
+type Config map[string]Policy
+
+const (
+	GroupAuth        = "auth"
+	GroupTransaction = "transaction"
+	GroupDefault     = "default"
+)
+
+func DefaultConfig() Config {
+	return Config{
+		GroupAuth: {
+			ScopeIP:     {Requests: 10, Window: time.Minute},
+			ScopeApiKey: {Requests: 10, Window: time.Minute},
+		},
+		GroupTransaction: {
+			ScopeIP:     {Requests: 60, Window: time.Minute},
+			ScopeApiKey: {Requests: 60, Window: time.Minute},
+			ScopeUser:   {Requests: 30, Window: time.Minute},
+		},
+		GroupDefault: {
+			ScopeIP:     {Requests: 600, Window: time.Minute},
+			ScopeApiKey: {Requests: 600, Window: time.Minute},
+			ScopeUser:   {Requests: 300, Window: time.Minute},
+		},
+	}
+}
+
+/*
+ConfigFromEnv overrides the default limits with RATE_LIMIT_<GROUP>_<SCOPE> envs, e.g.
+RATE_LIMIT_AUTH_IP="5/1m" or RATE_LIMIT_TRANSACTION_USER="off" to lift a limit.
+*/
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	for group, policy := range config {
+		for _, scope := range Scopes {
+			env := "RATE_LIMIT_" + strings.ToUpper(group) + "_" + strings.ToUpper(string(scope))
+			raw, ok := os.LookupEnv(env)
+			if !ok || raw == "" {
+				continue
+			}
+
+			if raw == "off" {
+				delete(policy, scope)
+				continue
+			}
+
+			limit, err := ParseLimit(raw)
+			if err != nil {
+				log.Fatalf("Invalid %s env: %s", env, err)
+			}
+			policy[scope] = limit
+		}
+	}
+
+	return config
+}
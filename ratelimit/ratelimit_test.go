@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/1m")
+	if err != nil || limit != (Limit{Requests: 10, Window: time.Minute}) {
+		t.Fatalf("ParseLimit(10/1m) = %v, %v", limit, err)
+	}
+
+	for _, raw := range []string{"", "10", "0/1m", "-1/1m", "10/0s", "ten/1m", "10/minute"} {
+		if _, err := ParseLimit(raw); err == nil {
+			t.Errorf("ParseLimit(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+	ml := NewMemoryLimiter()
+	ml.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Window: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		result, err := ml.Take(context.Background(), "key", limit)
+		if err != nil || !result.Allowed || result.Remaining != i {
+			t.Fatalf("Take = %+v, %v, want allowed with %d remaining", result, err, i)
+		}
+	}
+
+	result, _ := ml.Take(context.Background(), "key", limit)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("Take on an empty bucket = %+v, want rejected, retry after 1s, reset in 3s", result)
+	}
+
+	// Other keys have their own bucket.
+	if result, _ = ml.Take(context.Background(), "other", limit); !result.Allowed {
+		t.Fatal("Take on another key was rejected")
+	}
+
+	now = now.Add(time.Second)
+	if result, _ = ml.Take(context.Background(), "key", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Take after refilling one token = %+v, want allowed with 0 remaining", result)
+	}
+
+	// Buckets never hold more than the limit.
+	now = now.Add(time.Hour)
+	if result, _ = ml.Take(context.Background(), "key", limit); result.Remaining != 2 {
+		t.Fatalf("Take after a long pause = %+v, want 2 remaining", result)
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	fl := &FallbackLimiter{Primary: failingLimiter{}, Fallback: NewMemoryLimiter()}
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	if result, err := fl.Take(context.Background(), "key", limit); err != nil || !result.Allowed {
+		t.Fatalf("first Take = %+v, %v, want allowed by the fallback", result, err)
+	}
+	if result, err := fl.Take(context.Background(), "key", limit); err != nil || result.Allowed {
+		t.Fatalf("second Take = %+v, %v, want rejected by the fallback", result, err)
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+/*
+take_script refills and takes from a bucket atomically. It uses the Valkey clock so that
+instances with skewed clocks still agree. Buckets expire once they would be full again.
+
+Times are in milliseconds: Lua formats numbers with 14 significant digits, which is too
+few for microsecond timestamps.
+*/
+var take_script = valkey.NewLuaScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * capacity / window)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], window)
+
+return {allowed, tostring(tokens)}
+`)
+
+type ValkeyLimiter struct {
+	Valkey valkey.Client
+}
+
+func bucketKey(key string) string {
+	return "rate_limit:" + key
+}
+
+func (vl *ValkeyLimiter) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	args := []string{strconv.Itoa(limit.Requests), strconv.FormatInt(limit.Window.Milliseconds(), 10)}
+	reply, err := take_script.Exec(ctx, vl.Valkey, []string{bucketKey(key)}, args).ToArray()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, err := reply[0].AsInt64()
+	if err != nil {
+		return Result{}, err
+	}
+	raw_tokens, err := reply[1].ToString()
+	if err != nil {
+		return Result{}, err
+	}
+	tokens, err := strconv.ParseFloat(raw_tokens, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, allowed == 1, tokens), nil
+}
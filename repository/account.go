@@ -2,32 +2,76 @@ package repository
 
 import (
 	"broke-bank/model"
+	"broke-bank/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
 )
 
 type AccountRepository struct {
-	Pg *sqlx.DB
+	Pg       *sqlx.DB
+	Timeouts Timeouts
 }
 
-func (ac *AccountRepository) CreateAccount(user_id string, name string, status string) error {
-	_, err := ac.Pg.Exec(
-		`INSERT INTO "account" (user_id, name, balance, status)
-		VALUES ($1, $2, 0, $3)
-		`,
-		user_id,
-		name,
-		status,
-	)
+const account_columns = `id, user_id, name, balance, status, status_reason, frozen_until, closed_at, number, created_at, updated_at`
 
-	return err
+func (ac *AccountRepository) CreateAccount(ctx context.Context, user_id string, name string, status string) error {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, ac.Pg, func(tx *sqlx.Tx) error {
+		account := new(model.Account)
+		err := tx.GetContext(
+			ctx,
+			account,
+			`INSERT INTO "account" (user_id, name, balance, status)
+			VALUES ($1, $2, 0, $3)
+			RETURNING `+account_columns,
+			user_id,
+			name,
+			status,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := AccountAuditEvent(ctx, "account.create", nil, account)
+		if err != nil {
+			return err
+		}
+		if err = insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		member := new(model.AccountMember)
+		err = tx.GetContext(ctx, member, `INSERT INTO "account_member" (account_id, user_id, role) VALUES ($1, $2, 'owner') RETURNING *`, account.Id, user_id)
+		if err != nil {
+			return err
+		}
+
+		if event, err = AccountMemberAuditEvent(ctx, "account.add_member", nil, member); err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
 }
 
-func (ac *AccountRepository) GetAccount(acc_id string) (*model.Account, error) {
+func (ac *AccountRepository) GetAccount(ctx context.Context, acc_id string) (*model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
 	account := new(model.Account)
-	err := ac.Pg.Get(
+	err := ac.Pg.GetContext(
+		ctx,
 		account,
-		`SELECT acc.id, acc.user_id, acc.name, acc.balance, acc.status, acc.created_at, acc.updated_at 
+		`SELECT acc.id, acc.user_id, acc.name, acc.balance, acc.status, acc.status_reason, acc.frozen_until, acc.closed_at, acc.number, acc.created_at, acc.updated_at 
 		FROM "account" acc WHERE acc.id = $1`,
 		acc_id,
 	)
@@ -35,19 +79,35 @@ func (ac *AccountRepository) GetAccount(acc_id string) (*model.Account, error) {
 	return account, err
 }
 
-func (ac *AccountRepository) GetMyAccounts(user_id string, limit int, offset int) (*[]model.Account, error) {
+func (ac *AccountRepository) GetAccountByNumber(ctx context.Context, number int64) (*model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
+	account := new(model.Account)
+	err := ac.Pg.GetContext(ctx, account, `SELECT `+account_columns+` FROM "account" WHERE number = $1`, number)
+
+	return account, err
+}
+
+func (ac *AccountRepository) GetMyAccounts(ctx context.Context, user_id string, limit int, offset int) (*[]model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
 	accounts := new([]model.Account)
-	err := ac.Pg.Select(
+	err := ac.Pg.SelectContext(
+		ctx,
 		accounts,
 		`
 		SELECT 
-			acc.id, acc.user_id, acc.name, acc.balance, acc.status, acc.created_at, acc.updated_at 
+			acc.id, acc.user_id, acc.name, acc.balance, acc.status, acc.status_reason, acc.frozen_until, acc.closed_at, acc.number, acc.created_at, acc.updated_at 
 		FROM 
 			"account" acc 
+		JOIN
+			"account_member" am ON am.account_id = acc.id
 		WHERE 
-			acc.user_id = $1
+			am.user_id = $1
 		ORDER BY
-			acc.status
+			acc.status, acc.id
 		LIMIT 
 			$2
 		OFFSET 
@@ -61,13 +121,304 @@ func (ac *AccountRepository) GetMyAccounts(user_id string, limit int, offset int
 	return accounts, err
 }
 
-func (ac *AccountRepository) DisableAccount(acc_id string) error {
-	_, err := ac.Pg.Exec(
-		`UPDATE "account"
-		SET status = 'inactive'
-		WHERE id = $1`,
+/*
+updateAccount applies update, a statement on the account acc_id returning account_columns, and
+audits it as action. Unknown accounts are left alone, like by a plain UPDATE.
+*/
+func updateAccount(ctx context.Context, tx *sqlx.Tx, action string, acc_id string, update string, args ...any) (*model.Account, error) {
+	before := new(model.Account)
+	err := tx.GetContext(ctx, before, `SELECT `+account_columns+` FROM "account" WHERE id = $1 FOR UPDATE`, acc_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	after := new(model.Account)
+	if err = tx.GetContext(ctx, after, update, append([]any{acc_id}, args...)...); err != nil {
+		return nil, err
+	}
+
+	event, err := AccountAuditEvent(ctx, action, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return after, insertAuditEvent(ctx, tx, event)
+}
+
+func (ac *AccountRepository) DisableAccount(ctx context.Context, acc_id string) error {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, ac.Pg, func(tx *sqlx.Tx) error {
+		account, err := updateAccount(ctx, tx, "account.disable", acc_id, `UPDATE "account" SET status = 'inactive', status_reason = NULL, frozen_until = NULL, closed_at = NULL WHERE id = $1 RETURNING `+account_columns)
+		if err != nil || account == nil {
+			return err
+		}
+
+		// The outbox event is written in the same transaction, so it can't be lost.
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO "outbox_event" (user_id, type, data)
+			SELECT mem.user_id, 'account.disabled', jsonb_build_object('account_id', mem.account_id)
+			FROM "account_member" mem WHERE mem.account_id = $1`,
+			account.Id,
+		)
+
+		return err
+	})
+}
+
+func (ac *AccountRepository) SetAccountStatus(ctx context.Context, acc_id string, change AccountStatusChange) (*model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
+	var account *model.Account
+	err := inTransaction(ctx, ac.Pg, func(tx *sqlx.Tx) error {
+		current := ""
+		err := tx.GetContext(ctx, &current, `SELECT acc.status FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, acc_id)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(change.From, current) {
+			return ErrAccountStatus
+		}
+
+		account, err = updateAccount(
+			ctx,
+			tx,
+			"account.set_status",
+			acc_id,
+			`UPDATE "account" SET status = $2, status_reason = $3, frozen_until = $4, closed_at = CASE WHEN $2 = 'closed' THEN NOW() END, updated_at = NOW() WHERE id = $1 RETURNING `+account_columns,
+			change.Status, change.StatusReason, change.FrozenUntil,
+		)
+		if err != nil {
+			return err
+		}
+
+		return writeAccountStatusOutbox(ctx, tx, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (ac *AccountRepository) ExpireAccountFreezes(ctx context.Context) (*[]model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Transaction)
+	defer cancel()
+
+	accounts := []model.Account{}
+	err := inTransaction(ctx, ac.Pg, func(tx *sqlx.Tx) error {
+		// Accounts being refrozen are left for the next run rather than waited for.
+		expired := []string{}
+		err := tx.SelectContext(
+			ctx,
+			&expired,
+			`SELECT acc.id FROM "account" acc WHERE acc.frozen_until <= NOW() ORDER BY acc.id FOR UPDATE SKIP LOCKED`,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, acc_id := range expired {
+			account, err := updateAccount(
+				ctx,
+				tx,
+				"account.set_status",
+				acc_id,
+				`UPDATE "account" SET status = 'active', status_reason = NULL, frozen_until = NULL, updated_at = NOW() WHERE id = $1 RETURNING `+account_columns,
+			)
+			if err != nil {
+				return err
+			}
+			if err = writeAccountStatusOutbox(ctx, tx, account); err != nil {
+				return err
+			}
+			accounts = append(accounts, *account)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &accounts, nil
+}
+
+func (ac *AccountRepository) CloseAccount(ctx context.Context, transaction_id uuid.UUID, acc_id string, to_account_id string) (account *model.Account, sweep *model.Transaction, err error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, ac.Pg, ac.Timeouts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock in the same order as TransferTransaction to avoid deadlocks.
+	first_id_lock, second_id_lock := utils.SortStringUUIDs(acc_id, to_account_id)
+	balances := map[string]*AccountBalance{}
+	for _, lock_id := range []string{first_id_lock, second_id_lock} {
+		account_balance := new(AccountBalance)
+		if err = tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, lock_id); err != nil {
+			return nil, nil, err
+		}
+		if err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, lock_id == acc_id); err != nil {
+			return nil, nil, err
+		}
+		balances[lock_id] = account_balance
+	}
+
+	from, to := balances[acc_id], balances[to_account_id]
+	if from.Balance.IsNegative() {
+		return nil, nil, ErrAccountOverdrawn
+	}
+
+	if from.Balance.IsPositive() {
+		if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = 0 WHERE id = $1`, from.Id); err != nil {
+			return nil, nil, err
+		}
+
+		if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, to.Balance.Add(from.Balance), to.Id); err != nil {
+			return nil, nil, err
+		}
+
+		sweep = new(model.Transaction)
+		if err = tx.GetContext(ctx,
+			sweep,
+			`INSERT INTO "transaction" (id, type, from_account_id, to_account_id, amount) VALUES ($1, 'transfer', $2, $3, $4) RETURNING *`,
+			transaction_id, from.Id, to.Id, from.Balance,
+		); err != nil {
+			return nil, nil, err
+		}
+
+		if err = chainTransaction(ctx, tx, transaction_id); err != nil {
+			return nil, nil, err
+		}
+
+		if err = writeMovementOutbox(ctx, tx, transaction_id); err != nil {
+			return nil, nil, err
+		}
+
+		if err = writeMovementAudit(ctx, tx, transaction_id, map[uuid.UUID]decimal.Decimal{from.Id: from.Balance, to.Id: to.Balance}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	account, err = updateAccount(
+		ctx,
+		tx,
+		"account.close",
 		acc_id,
+		`UPDATE "account" SET status = 'closed', status_reason = 'customer_request', frozen_until = NULL, closed_at = NOW(), updated_at = NOW() WHERE id = $1 RETURNING `+account_columns,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = writeAccountStatusOutbox(ctx, tx, account); err != nil {
+		return nil, nil, err
+	}
+
+	// Requests waiting on approvals would only fail once approved, and the handle would point payers at a closed account.
+	if err = failPaymentRequests(ctx, tx, account.Id, "account_closed"); err != nil {
+		return nil, nil, err
+	}
+	err = deleteHandle(ctx, tx, `DELETE FROM "handle" WHERE account_id = $1 RETURNING *`, account.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return account, sweep, nil
+}
+
+func (ac *AccountRepository) ReopenAccount(ctx context.Context, acc_id string, since time.Time) (*model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, ac.Timeouts.Query)
+	defer cancel()
+
+	var account *model.Account
+	err := inTransaction(ctx, ac.Pg, func(tx *sqlx.Tx) error {
+		current := new(model.Account)
+		err := tx.GetContext(ctx, current, `SELECT `+account_columns+` FROM "account" WHERE id = $1 FOR UPDATE`, acc_id)
+		if err != nil {
+			return err
+		}
+		if !AccountReopenable(current, since) {
+			return ErrAccountStatus
+		}
+
+		account, err = updateAccount(
+			ctx,
+			tx,
+			"account.reopen",
+			acc_id,
+			`UPDATE "account" SET status = 'active', status_reason = NULL, closed_at = NULL, updated_at = NOW() WHERE id = $1 RETURNING `+account_columns,
+		)
+		if err != nil {
+			return err
+		}
+
+		return writeAccountStatusOutbox(ctx, tx, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// AccountReopenable reports whether account was closed by its owner at or after since. Accounts closed by the bank stay closed.
+func AccountReopenable(account *model.Account, since time.Time) bool {
+	return account.Status == model.AccountClosed &&
+		account.StatusReason != nil && *account.StatusReason == "customer_request" &&
+		account.ClosedAt != nil && !account.ClosedAt.Before(since)
+}
+
+/*
+writeAccountStatusOutbox tells the members of account about its new status. The reason is left out:
+telling customers that they are suspected of fraud or being screened would tip them off.
+*/
+func writeAccountStatusOutbox(ctx context.Context, tx *sqlx.Tx, account *model.Account) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO "outbox_event" (user_id, type, data)
+		SELECT mem.user_id, 'account.status_changed', jsonb_build_object('account_id', mem.account_id, 'status', $2::TEXT, 'frozen_until', $3::TIMESTAMPTZ)
+		FROM "account_member" mem WHERE mem.account_id = $1`,
+		account.Id,
+		account.Status,
+		account.FrozenUntil,
 	)
 
 	return err
 }
+
+/*
+CheckAccountStatus reports whether an account in status can be debited, or credited when debit
+is false: frozen_debit accounts can only be credited, while frozen_all, inactive and closed
+accounts can be neither. A freeze is over at frozen_until, even before ExpireAccountFreezes runs.
+*/
+func CheckAccountStatus(status string, frozen_until *time.Time, debit bool) error {
+	switch status {
+	case model.AccountFrozenDebit, model.AccountFrozenAll:
+		if frozen_until != nil && !time.Now().Before(*frozen_until) {
+			return nil
+		}
+		if debit || status == model.AccountFrozenAll {
+			return ErrAccountFrozen
+		}
+	case model.AccountInactive, model.AccountClosed:
+		return ErrAccountClosed
+	}
+
+	return nil
+}
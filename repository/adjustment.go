@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+type AdjustmentRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+func (ar *AdjustmentRepository) CreateAdjustment(ctx context.Context, adjustment model.Adjustment) (*model.Adjustment, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	created := new(model.Adjustment)
+	err := inTransaction(ctx, ar.Pg, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(
+			ctx,
+			created,
+			`
+			INSERT INTO "adjustment" (account_id, amount, reason, evidence, required_approvals, proposed_by, reversal_of)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING *
+			`,
+			adjustment.AccountId, adjustment.Amount, adjustment.Reason, adjustment.Evidence, adjustment.RequiredApprovals, adjustment.ProposedBy, adjustment.ReversalOf,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := AdjustmentAuditEvent(ctx, "adjustment.propose", nil, nil, created)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (ar *AdjustmentRepository) GetAdjustment(ctx context.Context, id uuid.UUID) (*model.Adjustment, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	adjustment := new(model.Adjustment)
+	err := ar.Pg.GetContext(ctx, adjustment, `SELECT * FROM "adjustment" adj WHERE adj.id = $1`, id)
+
+	return adjustment, err
+}
+
+func (ar *AdjustmentRepository) GetAdjustments(ctx context.Context, filter AdjustmentFilter, limit int, offset int) (*[]model.Adjustment, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	adjustments := new([]model.Adjustment)
+	err := ar.Pg.SelectContext(
+		ctx,
+		adjustments,
+		`
+		SELECT
+			*
+		FROM
+			"adjustment" adj
+		WHERE
+			($1::UUID IS NULL OR adj.account_id = $1)
+			AND ($2 = '' OR adj.status::TEXT = $2)
+		ORDER BY
+			adj.created_at DESC, adj.id DESC
+		LIMIT
+			$3
+		OFFSET
+			$4
+		`,
+		filter.AccountId,
+		filter.Status,
+		limit,
+		offset,
+	)
+
+	return adjustments, err
+}
+
+func (ar *AdjustmentRepository) GetAdjustmentDecisions(ctx context.Context, adjustment_id uuid.UUID) (*[]model.AdjustmentDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	decisions := new([]model.AdjustmentDecision)
+	err := ar.Pg.SelectContext(
+		ctx,
+		decisions,
+		`SELECT * FROM "adjustment_decision" ad WHERE ad.adjustment_id = $1 ORDER BY ad.created_at, ad.id`,
+		adjustment_id,
+	)
+
+	return decisions, err
+}
+
+func (ar *AdjustmentRepository) DecideAdjustment(ctx context.Context, decision model.AdjustmentDecision, transaction_id uuid.UUID) (_ *model.Adjustment, err error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, ar.Pg, ar.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before := new(model.Adjustment)
+	if err = tx.GetContext(ctx, before, `SELECT * FROM "adjustment" adj WHERE adj.id = $1 FOR UPDATE`, decision.AdjustmentId); err != nil {
+		return nil, err
+	}
+
+	if before.Status != "pending" {
+		return nil, ErrAdjustmentDecided
+	}
+	if before.ProposedBy == decision.StaffId {
+		return nil, ErrSelfApproval
+	}
+
+	already_decided := false
+	if err = tx.GetContext(ctx, &already_decided, `SELECT EXISTS (SELECT 1 FROM "adjustment_decision" ad WHERE ad.adjustment_id = $1 AND ad.staff_id = $2)`, before.Id, decision.StaffId); err != nil {
+		return nil, err
+	}
+	if already_decided {
+		return nil, ErrAlreadyDecided
+	}
+
+	recorded := new(model.AdjustmentDecision)
+	if err = tx.GetContext(ctx,
+		recorded,
+		`INSERT INTO "adjustment_decision" (adjustment_id, staff_id, decision, comment) VALUES ($1, $2, $3, $4) RETURNING *`,
+		before.Id, decision.StaffId, decision.Decision, decision.Comment,
+	); err != nil {
+		return nil, err
+	}
+
+	status := before.Status
+	var posted_id *uuid.UUID
+	if recorded.Decision == "rejected" {
+		status = "rejected"
+	} else {
+		approvals := 0
+		if err = tx.GetContext(ctx, &approvals, `SELECT COUNT(*) FROM "adjustment_decision" ad WHERE ad.adjustment_id = $1 AND ad.decision = 'approved'`, before.Id); err != nil {
+			return nil, err
+		}
+
+		if approvals >= before.RequiredApprovals {
+			if before.ReversalOf != nil {
+				_, err = reverseTransaction(ctx, tx, transaction_id, before.ReversalOf.String())
+			} else {
+				err = postAdjustment(ctx, tx, transaction_id, before.AccountId, before.Amount)
+			}
+			if err != nil {
+				return nil, err
+			}
+			status, posted_id = "approved", &transaction_id
+		}
+	}
+
+	after := new(model.Adjustment)
+	if err = tx.GetContext(ctx,
+		after,
+		`UPDATE "adjustment" SET status = $2, transaction_id = $3, updated_at = NOW() WHERE id = $1 RETURNING *`,
+		before.Id, status, posted_id,
+	); err != nil {
+		return nil, err
+	}
+
+	action := "adjustment.approve"
+	if recorded.Decision == "rejected" {
+		action = "adjustment.reject"
+	}
+	event, err := AdjustmentAuditEvent(ctx, action, recorded, before, after)
+	if err != nil {
+		return nil, err
+	}
+	if err = insertAuditEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// postAdjustment credits or debits account_id by amount within tx, as an 'adjustment' transaction of its absolute value.
+func postAdjustment(ctx context.Context, tx *sqlx.Tx, transaction_id uuid.UUID, account_id uuid.UUID, amount decimal.Decimal) error {
+	account_balance := new(AccountBalance)
+	if err := tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, account_id); err != nil {
+		return err
+	}
+
+	// The account may have been frozen or closed since the adjustment was proposed.
+	if err := CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, amount.IsNegative()); err != nil {
+		return err
+	}
+
+	if account_balance.Balance.Add(amount).IsNegative() {
+		return ErrInsufficientBalance
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Add(amount), account_id); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO "transaction" (id, type, to_account_id, amount) VALUES ($1, 'adjustment', $2, $3)`
+	if amount.IsNegative() {
+		query = `INSERT INTO "transaction" (id, type, from_account_id, amount) VALUES ($1, 'adjustment', $2, $3)`
+	}
+	if _, err := tx.ExecContext(ctx, query, transaction_id, account_id, amount.Abs()); err != nil {
+		return err
+	}
+
+	if err := chainTransaction(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	if err := writeMovementOutbox(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	return writeMovementAudit(ctx, tx, transaction_id, map[uuid.UUID]decimal.Decimal{account_balance.Id: account_balance.Balance})
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type ApiKeyRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+func (akr *ApiKeyRepository) CreateApiKey(ctx context.Context, user_id uuid.UUID, name string, key_hash string, prefix string) (*model.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, akr.Timeouts.Query)
+	defer cancel()
+
+	api_key := new(model.ApiKey)
+	err := inTransaction(ctx, akr.Pg, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(
+			ctx,
+			api_key,
+			`INSERT INTO "api_key" (user_id, name, key_hash, prefix)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, user_id, name, key_hash, prefix, created_at, revoked_at`,
+			user_id,
+			name,
+			key_hash,
+			prefix,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := ApiKeyAuditEvent(ctx, "api_key.create", nil, api_key)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+
+	return api_key, err
+}
+
+func (akr *ApiKeyRepository) GetApiKeyByHash(ctx context.Context, key_hash string) (*model.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, akr.Timeouts.Query)
+	defer cancel()
+
+	api_key := new(model.ApiKey)
+	err := akr.Pg.GetContext(
+		ctx,
+		api_key,
+		`SELECT ak.id, ak.user_id, ak.name, ak.key_hash, ak.prefix, ak.created_at, ak.revoked_at
+		FROM "api_key" ak WHERE ak.key_hash=$1`,
+		key_hash,
+	)
+
+	return api_key, err
+}
+
+func (akr *ApiKeyRepository) GetUserApiKeys(ctx context.Context, user_id uuid.UUID) (*[]model.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, akr.Timeouts.Query)
+	defer cancel()
+
+	api_keys := new([]model.ApiKey)
+	err := akr.Pg.SelectContext(
+		ctx,
+		api_keys,
+		`SELECT ak.id, ak.user_id, ak.name, ak.key_hash, ak.prefix, ak.created_at, ak.revoked_at
+		FROM "api_key" ak WHERE ak.user_id=$1
+		ORDER BY ak.created_at DESC, ak.id DESC`,
+		user_id,
+	)
+
+	return api_keys, err
+}
+
+// RevokeApiKey revokes an active key, and returns sql.ErrNoRows for unknown or already revoked keys.
+func (akr *ApiKeyRepository) RevokeApiKey(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, akr.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, akr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.ApiKey)
+		err := tx.GetContext(
+			ctx,
+			before,
+			`SELECT ak.id, ak.user_id, ak.name, ak.key_hash, ak.prefix, ak.created_at, ak.revoked_at
+			FROM "api_key" ak WHERE ak.id = $1 AND ak.revoked_at IS NULL FOR UPDATE`,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		after := new(model.ApiKey)
+		err = tx.GetContext(
+			ctx,
+			after,
+			`UPDATE "api_key" SET revoked_at = NOW()
+			WHERE id = $1
+			RETURNING id, user_id, name, key_hash, prefix, created_at, revoked_at`,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := ApiKeyAuditEvent(ctx, "api_key.revoke", before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+}
@@ -0,0 +1,656 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/shopspring/decimal"
+)
+
+type AuditRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+type auditActorKey struct{}
+
+/*
+WithAuditActor returns a context whose changes are recorded in the audit trail as made by
+actor. Every store method that changes state writes its audit event along with the change, in
+the same database transaction, so that one can't happen without the other.
+*/
+func WithAuditActor(ctx context.Context, actor model.AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFrom returns the actor of ctx, "system" for changes made outside of any request or command.
+func AuditActorFrom(ctx context.Context) model.AuditActor {
+	if actor, ok := ctx.Value(auditActorKey{}).(model.AuditActor); ok {
+		return actor
+	}
+
+	return model.AuditActor{Actor: "system"}
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func optionalJSON(value any) (*types.JSONText, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	text := types.JSONText(raw)
+	return &text, nil
+}
+
+/*
+NewAuditEvent completes event with the actor of ctx and the JSON encoding of details and of the
+before and after snapshots, nil ones being left null.
+*/
+func NewAuditEvent(ctx context.Context, event model.AuditEvent, details any, before any, after any) (model.AuditEvent, error) {
+	actor := AuditActorFrom(ctx)
+	event.Actor = actor.Actor
+	event.Reason = optionalString(actor.Reason)
+	event.Ip = optionalString(actor.Ip)
+	event.UserAgent = optionalString(actor.UserAgent)
+	event.RequestId = optionalString(actor.RequestId)
+
+	event.Details = types.JSONText("{}")
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return event, err
+		}
+		event.Details = raw
+	}
+
+	var err error
+	if event.Before, err = optionalJSON(before); err != nil {
+		return event, err
+	}
+	if event.After, err = optionalJSON(after); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
+
+/*
+The snapshots below are what audit events record of their target. They are shared by every
+backend, and leave out secrets such as password and API key hashes.
+*/
+
+type userSnapshot struct {
+	Id         uuid.UUID  `json:"id"`
+	Email      string     `json:"email"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	Role       string     `json:"role"`
+}
+
+// UserAuditEvent describes a change to a user, from before to after, either of which may be nil.
+func UserAuditEvent(ctx context.Context, action string, before *model.User, after *model.User) (model.AuditEvent, error) {
+	snapshot := func(user *model.User) any {
+		if user == nil {
+			return nil
+		}
+		return userSnapshot{Id: user.Id, Email: user.Email, DisabledAt: user.DisabledAt, Role: user.Role}
+	}
+
+	user := after
+	if user == nil {
+		user = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "user", TargetId: user.Id.String(), UserId: &user.Id}, nil, snapshot(before), snapshot(after))
+}
+
+type accountSnapshot struct {
+	Id           uuid.UUID  `json:"id"`
+	UserId       uuid.UUID  `json:"user_id"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	StatusReason *string    `json:"status_reason,omitempty"`
+	FrozenUntil  *time.Time `json:"frozen_until,omitempty"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	Balance      string     `json:"balance"`
+}
+
+// AccountAuditEvent describes a change to an account, from before to after, either of which may be nil.
+func AccountAuditEvent(ctx context.Context, action string, before *model.Account, after *model.Account) (model.AuditEvent, error) {
+	snapshot := func(account *model.Account) any {
+		if account == nil {
+			return nil
+		}
+		return accountSnapshot{
+			Id:           account.Id,
+			UserId:       account.UserId,
+			Name:         account.Name,
+			Status:       account.Status,
+			StatusReason: account.StatusReason,
+			FrozenUntil:  account.FrozenUntil,
+			ClosedAt:     account.ClosedAt,
+			Balance:      account.Balance.StringFixed(2),
+		}
+	}
+
+	account := after
+	if account == nil {
+		account = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "account", TargetId: account.Id.String(), UserId: &account.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type apiKeySnapshot struct {
+	Id        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// ApiKeyAuditEvent describes a change to an API key, from before to after, either of which may be nil.
+func ApiKeyAuditEvent(ctx context.Context, action string, before *model.ApiKey, after *model.ApiKey) (model.AuditEvent, error) {
+	snapshot := func(key *model.ApiKey) any {
+		if key == nil {
+			return nil
+		}
+		return apiKeySnapshot{Id: key.Id, Name: key.Name, Prefix: key.Prefix, RevokedAt: key.RevokedAt}
+	}
+
+	key := after
+	if key == nil {
+		key = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "api_key", TargetId: key.Id.String(), UserId: &key.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type adjustmentSnapshot struct {
+	Id                uuid.UUID  `json:"id"`
+	AccountId         uuid.UUID  `json:"account_id"`
+	Amount            string     `json:"amount"`
+	Status            string     `json:"status"`
+	RequiredApprovals int        `json:"required_approvals"`
+	TransactionId     *uuid.UUID `json:"transaction_id"`
+}
+
+type adjustmentDecisionDetails struct {
+	DecisionId uuid.UUID `json:"decision_id"`
+	StaffId    uuid.UUID `json:"staff_id"`
+	Comment    *string   `json:"comment"`
+}
+
+/*
+AdjustmentAuditEvent describes a change to an adjustment, from before to after, either of which
+may be nil, made by decision when there's one. It's about no user: the owner of the account only
+sees the transaction the adjustment is posted as.
+*/
+func AdjustmentAuditEvent(ctx context.Context, action string, decision *model.AdjustmentDecision, before *model.Adjustment, after *model.Adjustment) (model.AuditEvent, error) {
+	snapshot := func(adjustment *model.Adjustment) any {
+		if adjustment == nil {
+			return nil
+		}
+		return adjustmentSnapshot{
+			Id:                adjustment.Id,
+			AccountId:         adjustment.AccountId,
+			Amount:            adjustment.Amount.StringFixed(2),
+			Status:            adjustment.Status,
+			RequiredApprovals: adjustment.RequiredApprovals,
+			TransactionId:     adjustment.TransactionId,
+		}
+	}
+
+	var details any
+	if decision != nil {
+		details = adjustmentDecisionDetails{DecisionId: decision.Id, StaffId: decision.StaffId, Comment: decision.Comment}
+	}
+
+	adjustment := after
+	if adjustment == nil {
+		adjustment = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "adjustment", TargetId: adjustment.Id.String()}, details, snapshot(before), snapshot(after))
+}
+
+type memberSnapshot struct {
+	UserId     uuid.UUID `json:"user_id"`
+	Role       string    `json:"role"`
+	SpendLimit *string   `json:"spend_limit"`
+}
+
+func optionalAmount(amount *decimal.Decimal) *string {
+	if amount == nil {
+		return nil
+	}
+
+	return optionalString(amount.StringFixed(2))
+}
+
+// AccountMemberAuditEvent describes a change to a member of an account, from before to after, either of which may be nil.
+func AccountMemberAuditEvent(ctx context.Context, action string, before *model.AccountMember, after *model.AccountMember) (model.AuditEvent, error) {
+	snapshot := func(member *model.AccountMember) any {
+		if member == nil {
+			return nil
+		}
+		return memberSnapshot{UserId: member.UserId, Role: member.Role, SpendLimit: optionalAmount(member.SpendLimit)}
+	}
+
+	member := after
+	if member == nil {
+		member = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "account", TargetId: member.AccountId.String(), UserId: &member.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type invitationSnapshot struct {
+	Id         uuid.UUID `json:"id"`
+	AccountId  uuid.UUID `json:"account_id"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	SpendLimit *string   `json:"spend_limit"`
+	Status     string    `json:"status"`
+}
+
+/*
+InvitationAuditEvent describes a change to an invitation, from before to after, either of which
+may be nil. It's about user_id, the inviter or the invitee, since the invitee may not have
+signed up yet.
+*/
+func InvitationAuditEvent(ctx context.Context, action string, user_id uuid.UUID, before *model.AccountInvitation, after *model.AccountInvitation) (model.AuditEvent, error) {
+	snapshot := func(invitation *model.AccountInvitation) any {
+		if invitation == nil {
+			return nil
+		}
+		return invitationSnapshot{
+			Id:         invitation.Id,
+			AccountId:  invitation.AccountId,
+			Email:      invitation.Email,
+			Role:       invitation.Role,
+			SpendLimit: optionalAmount(invitation.SpendLimit),
+			Status:     invitation.Status,
+		}
+	}
+
+	invitation := after
+	if invitation == nil {
+		invitation = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "account_invitation", TargetId: invitation.Id.String(), UserId: &user_id}, nil, snapshot(before), snapshot(after))
+}
+
+type removalSnapshot struct {
+	Id          uuid.UUID  `json:"id"`
+	AccountId   uuid.UUID  `json:"account_id"`
+	UserId      uuid.UUID  `json:"user_id"`
+	RequestedBy uuid.UUID  `json:"requested_by"`
+	Status      string     `json:"status"`
+	DecidedBy   *uuid.UUID `json:"decided_by"`
+}
+
+// MemberRemovalAuditEvent describes a change to a removal request, from before to after, either of which may be nil. It's about the member to remove.
+func MemberRemovalAuditEvent(ctx context.Context, action string, before *model.MemberRemoval, after *model.MemberRemoval) (model.AuditEvent, error) {
+	snapshot := func(removal *model.MemberRemoval) any {
+		if removal == nil {
+			return nil
+		}
+		return removalSnapshot{
+			Id:          removal.Id,
+			AccountId:   removal.AccountId,
+			UserId:      removal.UserId,
+			RequestedBy: removal.RequestedBy,
+			Status:      removal.Status,
+			DecidedBy:   removal.DecidedBy,
+		}
+	}
+
+	removal := after
+	if removal == nil {
+		removal = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "account_member_removal", TargetId: removal.Id.String(), UserId: &removal.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type approvalPolicySnapshot struct {
+	Threshold         string `json:"threshold"`
+	RequiredApprovals int    `json:"required_approvals"`
+}
+
+// ApprovalPolicyAuditEvent describes a change to the approval policy of an account by user_id, from before to after, either of which may be nil.
+func ApprovalPolicyAuditEvent(ctx context.Context, action string, user_id uuid.UUID, before *model.ApprovalPolicy, after *model.ApprovalPolicy) (model.AuditEvent, error) {
+	snapshot := func(policy *model.ApprovalPolicy) any {
+		if policy == nil {
+			return nil
+		}
+		return approvalPolicySnapshot{Threshold: policy.Threshold.StringFixed(2), RequiredApprovals: policy.RequiredApprovals}
+	}
+
+	policy := after
+	if policy == nil {
+		policy = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "account", TargetId: policy.AccountId.String(), UserId: &user_id}, nil, snapshot(before), snapshot(after))
+}
+
+type paymentRequestSnapshot struct {
+	Id            uuid.UUID  `json:"id"`
+	Kind          string     `json:"kind"`
+	TransactionId uuid.UUID  `json:"transaction_id"`
+	FromAccountId uuid.UUID  `json:"from_account_id"`
+	ToAccountId   *uuid.UUID `json:"to_account_id"`
+	Amount        string     `json:"amount"`
+	Status        string     `json:"status"`
+	FailureReason *string    `json:"failure_reason"`
+}
+
+type paymentRequestDecisionDetails struct {
+	DecisionId uuid.UUID `json:"decision_id"`
+	UserId     uuid.UUID `json:"user_id"`
+	Comment    *string   `json:"comment"`
+}
+
+/*
+PaymentRequestAuditEvent describes a change to a payment request, from before to after, either
+of which may be nil, made by decision when there's one. It's about the member who submitted it.
+*/
+func PaymentRequestAuditEvent(ctx context.Context, action string, decision *model.PaymentRequestDecision, before *model.PaymentRequest, after *model.PaymentRequest) (model.AuditEvent, error) {
+	snapshot := func(request *model.PaymentRequest) any {
+		if request == nil {
+			return nil
+		}
+		return paymentRequestSnapshot{
+			Id:            request.Id,
+			Kind:          request.Kind,
+			TransactionId: request.TransactionId,
+			FromAccountId: request.FromAccountId,
+			ToAccountId:   request.ToAccountId,
+			Amount:        request.Amount.StringFixed(2),
+			Status:        request.Status,
+			FailureReason: request.FailureReason,
+		}
+	}
+
+	var details any
+	if decision != nil {
+		details = paymentRequestDecisionDetails{DecisionId: decision.Id, UserId: decision.UserId, Comment: decision.Comment}
+	}
+
+	request := after
+	if request == nil {
+		request = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "payment_request", TargetId: request.Id.String(), UserId: &request.RequestedBy}, details, snapshot(before), snapshot(after))
+}
+
+type payeeSnapshot struct {
+	AccountId uuid.UUID `json:"account_id"`
+	Nickname  string    `json:"nickname"`
+}
+
+// PayeeAuditEvent describes a change to a payee of a user, from before to after, either of which may be nil.
+func PayeeAuditEvent(ctx context.Context, action string, before *model.Payee, after *model.Payee) (model.AuditEvent, error) {
+	snapshot := func(payee *model.Payee) any {
+		if payee == nil {
+			return nil
+		}
+		return payeeSnapshot{AccountId: payee.AccountId, Nickname: payee.Nickname}
+	}
+
+	payee := after
+	if payee == nil {
+		payee = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "payee", TargetId: payee.Id.String(), UserId: &payee.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type handleSnapshot struct {
+	Handle    string    `json:"handle"`
+	AccountId uuid.UUID `json:"account_id"`
+}
+
+// HandleAuditEvent describes a change to the handle of a user, from before to after, either of which may be nil.
+func HandleAuditEvent(ctx context.Context, action string, before *model.Handle, after *model.Handle) (model.AuditEvent, error) {
+	snapshot := func(handle *model.Handle) any {
+		if handle == nil {
+			return nil
+		}
+		return handleSnapshot{Handle: handle.Handle, AccountId: handle.AccountId}
+	}
+
+	handle := after
+	if handle == nil {
+		handle = before
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "user", TargetId: handle.UserId.String(), UserId: &handle.UserId}, nil, snapshot(before), snapshot(after))
+}
+
+type movementDetails struct {
+	Type          string     `json:"type"`
+	Amount        string     `json:"amount"`
+	FromAccountId *uuid.UUID `json:"from_account_id"`
+	ToAccountId   *uuid.UUID `json:"to_account_id"`
+	ReversalOf    *uuid.UUID `json:"reversal_of"`
+}
+
+type balancesSnapshot struct {
+	// Balance of each account the movement touched, by account id.
+	Balances map[string]string `json:"balances"`
+}
+
+/*
+MovementAuditEvent describes a money movement, with the balances of its accounts before and
+after it. The event is about user_id, the owner of the account money left, or of the account
+it went to for deposits, so that the other party's balance isn't shown to them.
+*/
+func MovementAuditEvent(ctx context.Context, transaction model.Transaction, user_id *uuid.UUID, before map[uuid.UUID]decimal.Decimal, after map[uuid.UUID]decimal.Decimal) (model.AuditEvent, error) {
+	action := "transaction." + transaction.Type
+	if transaction.ReversalOf != nil {
+		action = "transaction.reverse"
+	}
+
+	snapshot := func(balances map[uuid.UUID]decimal.Decimal) balancesSnapshot {
+		snapshot := balancesSnapshot{Balances: map[string]string{}}
+		for id, balance := range balances {
+			snapshot.Balances[id.String()] = balance.StringFixed(2)
+		}
+		return snapshot
+	}
+
+	details := movementDetails{
+		Type:          transaction.Type,
+		Amount:        transaction.Amount.StringFixed(2),
+		FromAccountId: transaction.FromAccountId,
+		ToAccountId:   transaction.ToAccountId,
+		ReversalOf:    transaction.ReversalOf,
+	}
+
+	return NewAuditEvent(ctx, model.AuditEvent{Action: action, TargetType: "transaction", TargetId: transaction.Id.String(), UserId: user_id}, details, snapshot(before), snapshot(after))
+}
+
+// insertAuditEvent writes event with db, which is the transaction of the change it describes.
+func insertAuditEvent(ctx context.Context, db sqlx.ExtContext, event model.AuditEvent) error {
+	if len(event.Details) == 0 {
+		event.Details = []byte("{}")
+	}
+
+	_, err := db.ExecContext(
+		ctx,
+		`INSERT INTO "audit_event" (actor, action, target_type, target_id, reason, details, user_id, ip, user_agent, request_id, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		event.Actor,
+		event.Action,
+		event.TargetType,
+		event.TargetId,
+		event.Reason,
+		event.Details,
+		event.UserId,
+		event.Ip,
+		event.UserAgent,
+		event.RequestId,
+		event.Before,
+		event.After,
+	)
+
+	return err
+}
+
+/*
+writeMovementAudit records the movement transaction_id made within tx, with the balances of its
+accounts before it. The movement and the balances after it are read back from tx.
+*/
+func writeMovementAudit(ctx context.Context, tx *sqlx.Tx, transaction_id uuid.UUID, before map[uuid.UUID]decimal.Decimal) error {
+	transaction := model.Transaction{}
+	if err := tx.GetContext(ctx, &transaction, `SELECT * FROM "transaction" tx WHERE tx.id = $1`, transaction_id); err != nil {
+		return err
+	}
+
+	after := map[uuid.UUID]decimal.Decimal{}
+	for id := range before {
+		balance := decimal.Decimal{}
+		if err := tx.GetContext(ctx, &balance, `SELECT acc.balance FROM "account" acc WHERE acc.id = $1`, id); err != nil {
+			return err
+		}
+		after[id] = balance
+	}
+
+	owner_account_id := transaction.FromAccountId
+	if owner_account_id == nil {
+		owner_account_id = transaction.ToAccountId
+	}
+
+	var user_id *uuid.UUID
+	if err := tx.GetContext(ctx, &user_id, `SELECT acc.user_id FROM "account" acc WHERE acc.id = $1`, owner_account_id); err != nil {
+		return err
+	}
+
+	event, err := MovementAuditEvent(ctx, transaction, user_id, before, after)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEvent(ctx, tx, event)
+}
+
+/*
+inTransaction runs change in a database transaction, committed if it returns nil, so that the
+audit event it writes can't be lost or written without the change.
+*/
+func inTransaction(ctx context.Context, pg *sqlx.DB, change func(tx *sqlx.Tx) error) error {
+	tx, err := pg.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = change(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ar *AuditRepository) CreateAuditEvent(ctx context.Context, event model.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	return insertAuditEvent(ctx, ar.Pg, event)
+}
+
+const audit_event_columns = `ae.id, ae.actor, ae.action, ae.target_type, ae.target_id, ae.reason, ae.details, ae.created_at,
+	ae.user_id, ae.ip, ae.user_agent, ae.request_id, ae.before, ae.after`
+
+func (ar *AuditRepository) GetAuditEvents(ctx context.Context, target_type string, target_id string, limit int, offset int) (*[]model.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	events := new([]model.AuditEvent)
+	err := ar.Pg.SelectContext(
+		ctx,
+		events,
+		`
+		SELECT
+			`+audit_event_columns+`
+		FROM
+			"audit_event" ae
+		WHERE
+			ae.target_type = $1 AND ae.target_id = $2
+		ORDER BY
+			ae.created_at DESC, ae.id DESC
+		LIMIT
+			$3
+		OFFSET
+			$4
+		`,
+		target_type,
+		target_id,
+		limit,
+		offset,
+	)
+
+	return events, err
+}
+
+func (ar *AuditRepository) SearchAuditEvents(ctx context.Context, filter AuditFilter, limit int, offset int) (*[]model.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ar.Timeouts.Query)
+	defer cancel()
+
+	events := new([]model.AuditEvent)
+	err := ar.Pg.SelectContext(
+		ctx,
+		events,
+		`
+		SELECT
+			`+audit_event_columns+`
+		FROM
+			"audit_event" ae
+		WHERE
+			($1::UUID IS NULL OR ae.user_id = $1)
+			AND ($2 = '' OR ae.actor = $2)
+			AND ($3 = '' OR ae.action = $3)
+			AND ($4 = '' OR ae.target_type = $4)
+			AND ($5 = '' OR ae.target_id = $5)
+			AND ($6::TIMESTAMPTZ IS NULL OR ae.created_at >= $6)
+			AND ($7::TIMESTAMPTZ IS NULL OR ae.created_at < $7)
+		ORDER BY
+			ae.created_at DESC, ae.id DESC
+		LIMIT
+			$8
+		OFFSET
+			$9
+		`,
+		filter.UserId,
+		filter.Actor,
+		filter.Action,
+		filter.TargetType,
+		filter.TargetId,
+		filter.Since,
+		filter.Until,
+		limit,
+		offset,
+	)
+
+	return events, err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyReversed     = errors.New("transaction has already been reversed")
+	ErrReversalOfReversal  = errors.New("a reversal cannot be reversed")
+	ErrInsufficientBalance = errors.New("insufficient account balance")
+	ErrSameAccount         = errors.New("money can't move from an account to itself")
+	ErrLockTimeout         = errors.New("timed out waiting for the account lock, the account is busy")
+	ErrQueryTimeout        = errors.New("database query timed out")
+	ErrEventReplayed       = errors.New("processor event was already applied")
+	ErrChargeMismatch      = errors.New("charge doesn't match its earlier events")
+	ErrChargeTransition    = errors.New("a succeeded or failed charge can't change status")
+	ErrAdjustmentDecided   = errors.New("adjustment was already approved or rejected")
+	ErrSelfApproval        = errors.New("staff can't decide on their own adjustment")
+	ErrAlreadyDecided      = errors.New("staff already decided on this adjustment")
+	ErrAccountFrozen       = errors.New("account is frozen")
+	ErrAccountClosed       = errors.New("account is closed or inactive")
+	ErrAccountStatus       = errors.New("account status doesn't allow this change")
+	ErrAccountOverdrawn    = errors.New("account balance is negative")
+	ErrNotOwner            = errors.New("only owners of the account can do this")
+	ErrNotMember           = errors.New("user isn't a member of the account")
+	ErrAlreadyMember       = errors.New("user is already a member of the account")
+	ErrAlreadyInvited      = errors.New("an invitation to this email is already pending")
+	ErrInvitationDecided   = errors.New("invitation was already accepted or declined")
+	ErrLastOwner           = errors.New("the last owner of an account can't be removed")
+	ErrRemovalPending      = errors.New("a removal of this member is already pending")
+	ErrRemovalDecided      = errors.New("removal was already approved or rejected")
+	ErrOwnRemoval          = errors.New("another owner must approve the removal of an owner")
+	ErrRequestDecided      = errors.New("payment request isn't pending anymore")
+	ErrRequestExpired      = errors.New("payment request expired")
+	ErrOwnRequest          = errors.New("members can't decide on their own payment request")
+	ErrRequestTwice        = errors.New("owner already decided on this payment request")
+	ErrPayeeExists         = errors.New("account is already one of the user's payees")
+	ErrNicknameTaken       = errors.New("another payee of the user has this nickname")
+	ErrHandleTaken         = errors.New("handle belongs to another user")
+)
+
+// IsRetryable reports whether err is a transient conflict between concurrent transactions, worth retrying as is.
+func IsRetryable(err error) bool {
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) {
+		// serialization_failure | deadlock_detected
+		return pq_err.Code == "40001" || pq_err.Code == "40P01"
+	}
+
+	return false
+}
+
+// IsDeadlock reports whether Postgres aborted the transaction to break a deadlock.
+func IsDeadlock(err error) bool {
+	var pq_err *pq.Error
+	return errors.As(err, &pq_err) && pq_err.Code == "40P01"
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Events kept per user for clients resuming after a disconnect, older ones are trimmed.
+const EventRetention = 1000
+
+/*
+EventRepository keeps each user's events in a Valkey stream. Every instance reads the streams
+of its connected users, so an event published by one instance reaches clients connected to any
+other, and stream ids let clients resume where they left off.
+*/
+type EventRepository struct {
+	Valkey   valkey.Client
+	Timeouts Timeouts
+}
+
+func userEventsKey(user_id string) string {
+	return "user_events:" + user_id
+}
+
+func (er *EventRepository) PublishEvent(ctx context.Context, user_id string, event_type string, data json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, er.Timeouts.Query)
+	defer cancel()
+
+	v := er.Valkey
+	cmd := v.B().Xadd().Key(userEventsKey(user_id)).Maxlen().Almost().Threshold(strconv.Itoa(EventRetention)).Id("*").
+		FieldValue().FieldValue("type", event_type).FieldValue("data", string(data)).Build()
+
+	return v.Do(ctx, cmd).ToString()
+}
+
+func (er *EventRepository) GetLatestEventId(ctx context.Context, user_id string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, er.Timeouts.Query)
+	defer cancel()
+
+	v := er.Valkey
+	entries, err := v.Do(ctx, v.B().Xrevrange().Key(userEventsKey(user_id)).End("+").Start("-").Count(1).Build()).AsXRange()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+
+	return entries[0].ID, nil
+}
+
+func (er *EventRepository) ReadEvents(ctx context.Context, user_id string, after_id string, limit int, wait time.Duration) ([]model.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, er.Timeouts.Query+wait)
+	defer cancel()
+
+	v := er.Valkey
+	read := v.B().Xread().Count(int64(limit))
+	var cmd valkey.Completed
+	if wait > 0 {
+		cmd = read.Block(wait.Milliseconds()).Streams().Key(userEventsKey(user_id)).Id(after_id).Build()
+	} else {
+		cmd = read.Streams().Key(userEventsKey(user_id)).Id(after_id).Build()
+	}
+
+	streams, err := v.Do(ctx, cmd).AsXRead()
+	// Nothing arrived in time.
+	if valkey.IsValkeyNil(err) {
+		return []model.Event{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := []model.Event{}
+	for _, entry := range streams[userEventsKey(user_id)] {
+		events = append(events, model.Event{
+			Id:   entry.ID,
+			Type: entry.FieldValues["type"],
+			Data: json.RawMessage(entry.FieldValues["data"]),
+		})
+	}
+
+	return events, nil
+}
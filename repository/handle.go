@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type HandleRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+func (hr *HandleRepository) SetHandle(ctx context.Context, handle model.Handle) (*model.Handle, error) {
+	ctx, cancel := context.WithTimeout(ctx, hr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.Handle)
+	err := inTransaction(ctx, hr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.Handle)
+		err := tx.GetContext(ctx, before, `SELECT * FROM "handle" h WHERE h.user_id = $1 FOR UPDATE`, handle.UserId)
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+
+		err = tx.GetContext(ctx,
+			after,
+			`INSERT INTO "handle" (handle, user_id, account_id) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET handle = EXCLUDED.handle, account_id = EXCLUDED.account_id, updated_at = NOW()
+			RETURNING *`,
+			handle.Handle, handle.UserId, handle.AccountId,
+		)
+		// Handles are their primary key, so the one of another user can only conflict there.
+		var pq_err *pq.Error
+		if errors.As(err, &pq_err) && pq_err.Code == "23505" && pq_err.Constraint == "handle_pkey" {
+			return ErrHandleTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		event, err := HandleAuditEvent(ctx, "user.set_handle", before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (hr *HandleRepository) GetHandle(ctx context.Context, handle string) (*model.Handle, error) {
+	ctx, cancel := context.WithTimeout(ctx, hr.Timeouts.Query)
+	defer cancel()
+
+	found := new(model.Handle)
+	err := hr.Pg.GetContext(ctx, found, `SELECT * FROM "handle" h WHERE h.handle = $1`, handle)
+
+	return found, err
+}
+
+func (hr *HandleRepository) GetUserHandle(ctx context.Context, user_id uuid.UUID) (*model.Handle, error) {
+	ctx, cancel := context.WithTimeout(ctx, hr.Timeouts.Query)
+	defer cancel()
+
+	handle := new(model.Handle)
+	err := hr.Pg.GetContext(ctx, handle, `SELECT * FROM "handle" h WHERE h.user_id = $1`, user_id)
+
+	return handle, err
+}
+
+func (hr *HandleRepository) GetAccountHandle(ctx context.Context, account_id uuid.UUID) (*model.Handle, error) {
+	ctx, cancel := context.WithTimeout(ctx, hr.Timeouts.Query)
+	defer cancel()
+
+	handle := new(model.Handle)
+	err := hr.Pg.GetContext(ctx, handle, `SELECT * FROM "handle" h WHERE h.account_id = $1`, account_id)
+
+	return handle, err
+}
+
+func (hr *HandleRepository) DeleteHandle(ctx context.Context, user_id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, hr.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, hr.Pg, func(tx *sqlx.Tx) error {
+		return deleteHandle(ctx, tx, `DELETE FROM "handle" WHERE user_id = $1 RETURNING *`, user_id)
+	})
+}
+
+// deleteHandle audits the deletion of the handle that statement returns, and fails with sql.ErrNoRows when there's none.
+func deleteHandle(ctx context.Context, tx *sqlx.Tx, statement string, args ...any) error {
+	before := new(model.Handle)
+	if err := tx.GetContext(ctx, before, statement, args...); err != nil {
+		return err
+	}
+
+	event, err := HandleAuditEvent(ctx, "user.delete_handle", before, nil)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEvent(ctx, tx, event)
+}
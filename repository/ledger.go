@@ -0,0 +1,416 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+Every account's transactions form a hash chain: each transaction stores the hash of the
+previous transaction of its from and to accounts, and a hash covering its own fields and those
+previous hashes. Editing, deleting or inserting a row of the transaction table directly breaks
+the chain of the accounts it touches, and signed checkpoints of the heads of every chain catch
+whole chains being rewritten.
+
+The chains are per account rather than global, so that extending them only needs the account
+row locks movements already take.
+*/
+
+type LedgerRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+func optionalId(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+
+	return id.String()
+}
+
+/*
+LedgerHash is the hash of transaction in its accounts' chains. The encoding is versioned, and
+mirrored by the ledger_hash() SQL function of the migration that chained existing rows.
+*/
+func LedgerHash(transaction model.Transaction) model.HexBytes {
+	encoded := strings.Join([]string{
+		"broke-bank/ledger/v1",
+		transaction.Id.String(),
+		transaction.Type,
+		optionalId(transaction.FromAccountId),
+		optionalId(transaction.ToAccountId),
+		transaction.Amount.StringFixed(2),
+		strconv.FormatInt(transaction.DateIssued.UnixMicro(), 10),
+		optionalId(transaction.ReversalOf),
+		transaction.FromPrevHash.String(),
+		transaction.ToPrevHash.String(),
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(encoded))
+	return hash[:]
+}
+
+/*
+chainTransaction appends transaction_id, inserted within tx, to the chains of its accounts.
+Their rows must already be locked by tx, so that no other transaction extends them meanwhile.
+*/
+func chainTransaction(ctx context.Context, tx *sqlx.Tx, transaction_id uuid.UUID) error {
+	transaction := model.Transaction{}
+	if err := tx.GetContext(ctx, &transaction, `SELECT * FROM "transaction" tx WHERE tx.id = $1`, transaction_id); err != nil {
+		return err
+	}
+
+	head := func(account_id *uuid.UUID) (model.HexBytes, error) {
+		if account_id == nil {
+			return nil, nil
+		}
+		var hash model.HexBytes
+		err := tx.GetContext(ctx, &hash, `SELECT acc.chain_head FROM "account" acc WHERE acc.id = $1`, account_id)
+		return hash, err
+	}
+
+	var err error
+	if transaction.FromPrevHash, err = head(transaction.FromAccountId); err != nil {
+		return err
+	}
+	if transaction.ToPrevHash, err = head(transaction.ToAccountId); err != nil {
+		return err
+	}
+	transaction.ChainHash = LedgerHash(transaction)
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE "transaction" SET from_prev_hash = $2, to_prev_hash = $3, chain_hash = $4 WHERE id = $1`,
+		transaction.Id, transaction.FromPrevHash, transaction.ToPrevHash, transaction.ChainHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE "account" SET chain_head = $1, chain_length = chain_length + 1 WHERE id IN ($2, $3)`,
+		transaction.ChainHash, transaction.FromAccountId, transaction.ToAccountId,
+	)
+
+	return err
+}
+
+func (lr *LedgerRepository) GetLedgerHeads(ctx context.Context) (*[]model.LedgerHead, error) {
+	ctx, cancel := context.WithTimeout(ctx, lr.Timeouts.Query)
+	defer cancel()
+
+	heads := new([]model.LedgerHead)
+	err := lr.Pg.SelectContext(ctx, heads, `SELECT acc.id, acc.chain_length, acc.chain_head FROM "account" acc ORDER BY acc.id`)
+
+	return heads, err
+}
+
+func (lr *LedgerRepository) GetLedgerHead(ctx context.Context, account_id uuid.UUID) (*model.LedgerHead, error) {
+	ctx, cancel := context.WithTimeout(ctx, lr.Timeouts.Query)
+	defer cancel()
+
+	head := new(model.LedgerHead)
+	err := lr.Pg.GetContext(ctx, head, `SELECT acc.id, acc.chain_length, acc.chain_head FROM "account" acc WHERE acc.id = $1`, account_id)
+
+	return head, err
+}
+
+func (lr *LedgerRepository) GetAccountLedger(ctx context.Context, account_id uuid.UUID) (*[]model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, lr.Timeouts.Transaction)
+	defer cancel()
+
+	transactions := new([]model.Transaction)
+	err := lr.Pg.SelectContext(
+		ctx,
+		transactions,
+		`SELECT * FROM "transaction" tx WHERE tx.from_account_id = $1 OR tx.to_account_id = $1 ORDER BY tx.date_issued, tx.id`,
+		account_id,
+	)
+
+	return transactions, err
+}
+
+func (lr *LedgerRepository) CreateLedgerCheckpoint(ctx context.Context, checkpoint model.LedgerCheckpoint) error {
+	ctx, cancel := context.WithTimeout(ctx, lr.Timeouts.Query)
+	defer cancel()
+
+	_, err := lr.Pg.NamedExecContext(
+		ctx,
+		`INSERT INTO "ledger_checkpoint" (id, created_at, accounts, links, root, heads, key_id, public_key, signature)
+		VALUES (:id, :created_at, :accounts, :links, :root, :heads, :key_id, :public_key, :signature)`,
+		checkpoint,
+	)
+
+	return err
+}
+
+func (lr *LedgerRepository) GetLedgerCheckpoints(ctx context.Context, limit int, offset int) (*[]model.LedgerCheckpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, lr.Timeouts.Query)
+	defer cancel()
+
+	checkpoints := new([]model.LedgerCheckpoint)
+	err := lr.Pg.SelectContext(
+		ctx,
+		checkpoints,
+		`SELECT * FROM "ledger_checkpoint" lc ORDER BY lc.created_at DESC, lc.id DESC LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+
+	return checkpoints, err
+}
+
+// BrokenLink is where an account's chain stops matching its transactions.
+type BrokenLink struct {
+	AccountId uuid.UUID `json:"account_id"`
+	// 1-based position of the link in the chain.
+	Position int64 `json:"position"`
+	// Transaction found at Position, if any.
+	TransactionId *uuid.UUID `json:"transaction_id"`
+	Problem       string     `json:"problem"`
+}
+
+func (b BrokenLink) Error() string {
+	transaction := "no transaction"
+	if b.TransactionId != nil {
+		transaction = "transaction " + b.TransactionId.String()
+	}
+
+	return fmt.Sprintf("account %s, link %d (%s): %s", b.AccountId, b.Position, transaction, b.Problem)
+}
+
+/*
+walkChain follows the chain of head's account through transactions, which are all the
+transactions of the account, oldest first. It returns the hash at each position of the chain,
+up to its first broken link.
+*/
+func walkChain(head model.LedgerHead, transactions []model.Transaction) ([]model.HexBytes, *BrokenLink) {
+	next := map[string]*model.Transaction{}
+	for i := range transactions {
+		transaction := &transactions[i]
+		prev := transaction.ToPrevHash
+		if transaction.FromAccountId != nil && *transaction.FromAccountId == head.AccountId {
+			prev = transaction.FromPrevHash
+		}
+		// Two transactions claiming the same previous one: the second is found unvisited below.
+		if _, ok := next[prev.String()]; !ok {
+			next[prev.String()] = transaction
+		}
+	}
+
+	hashes := []model.HexBytes{}
+	visited := map[uuid.UUID]bool{}
+	current := model.HexBytes(nil)
+	for {
+		transaction, ok := next[current.String()]
+		if !ok || visited[transaction.Id] {
+			break
+		}
+
+		position := int64(len(hashes)) + 1
+		if transaction.ChainHash == nil {
+			return hashes, &BrokenLink{head.AccountId, position, &transaction.Id, "transaction has no hash"}
+		}
+		if !bytes.Equal(LedgerHash(*transaction), transaction.ChainHash) {
+			return hashes, &BrokenLink{head.AccountId, position, &transaction.Id, "transaction doesn't match its hash, it was changed"}
+		}
+
+		visited[transaction.Id] = true
+		hashes = append(hashes, transaction.ChainHash)
+		current = transaction.ChainHash
+	}
+
+	position := int64(len(hashes)) + 1
+	for i := range transactions {
+		if !visited[transactions[i].Id] {
+			return hashes, &BrokenLink{head.AccountId, position, &transactions[i].Id, "transaction doesn't follow the previous link, one before it was deleted or changed"}
+		}
+	}
+
+	if int64(len(hashes)) != head.Length || !bytes.Equal(current, head.Head) {
+		return hashes, &BrokenLink{head.AccountId, position, nil, fmt.Sprintf("chain ends after %d links but the account's head is at %d, transactions were deleted", len(hashes), head.Length)}
+	}
+
+	return hashes, nil
+}
+
+// VerifyChain returns the first broken link of the chain of head's account, nil when it's intact.
+func VerifyChain(head model.LedgerHead, transactions []model.Transaction) *BrokenLink {
+	_, broken := walkChain(head, transactions)
+	return broken
+}
+
+type LedgerReport struct {
+	Accounts int          `json:"accounts"`
+	Links    int64        `json:"links"`
+	Broken   []BrokenLink `json:"broken"`
+}
+
+/*
+VerifyLedger walks the chains of account_ids, or of every account when none are given, and
+checks that they still lead to the heads recorded by checkpoints. At most one broken link is
+reported per account, the first one.
+*/
+func VerifyLedger(ctx context.Context, store LedgerStore, account_ids []uuid.UUID, checkpoints []model.LedgerCheckpoint) (*LedgerReport, error) {
+	heads := []model.LedgerHead{}
+	if len(account_ids) == 0 {
+		all, err := store.GetLedgerHeads(ctx)
+		if err != nil {
+			return nil, err
+		}
+		heads = *all
+	}
+	for _, account_id := range account_ids {
+		head, err := store.GetLedgerHead(ctx, account_id)
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, *head)
+	}
+
+	// What each checkpoint recorded of the verified accounts, by account.
+	recorded := map[uuid.UUID][]model.LedgerHead{}
+	checkpoint_ids := map[uuid.UUID][]uuid.UUID{}
+	for _, checkpoint := range checkpoints {
+		for _, head := range checkpoint.Heads {
+			recorded[head.AccountId] = append(recorded[head.AccountId], head)
+			checkpoint_ids[head.AccountId] = append(checkpoint_ids[head.AccountId], checkpoint.Id)
+		}
+	}
+
+	report := &LedgerReport{Broken: []BrokenLink{}}
+	known := map[uuid.UUID]bool{}
+	for _, head := range heads {
+		known[head.AccountId] = true
+
+		transactions, err := store.GetAccountLedger(ctx, head.AccountId)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Accounts++
+		hashes, broken := walkChain(head, *transactions)
+		report.Links += int64(len(hashes))
+		if broken != nil {
+			report.Broken = append(report.Broken, *broken)
+			continue
+		}
+
+		for i, checkpointed := range recorded[head.AccountId] {
+			if checkpointed.Length > int64(len(hashes)) || (checkpointed.Length > 0 && !bytes.Equal(hashes[checkpointed.Length-1], checkpointed.Head)) {
+				problem := fmt.Sprintf("chain no longer leads to the head recorded by checkpoint %s, it was rewritten", checkpoint_ids[head.AccountId][i])
+				report.Broken = append(report.Broken, BrokenLink{head.AccountId, checkpointed.Length, nil, problem})
+				break
+			}
+		}
+	}
+
+	// Accounts can't be deleted, so every checkpointed account must still be there when verifying them all.
+	if len(account_ids) == 0 {
+		for account_id, heads := range recorded {
+			if !known[account_id] {
+				problem := fmt.Sprintf("account recorded by checkpoint %s no longer exists", checkpoint_ids[account_id][0])
+				report.Broken = append(report.Broken, BrokenLink{account_id, heads[0].Length, nil, problem})
+			}
+		}
+	}
+
+	sort.Slice(report.Broken, func(i, j int) bool {
+		return report.Broken[i].AccountId.String() < report.Broken[j].AccountId.String()
+	})
+
+	return report, nil
+}
+
+func checkpointRoot(heads model.LedgerHeads) model.HexBytes {
+	hash := sha256.New()
+	for _, head := range heads {
+		fmt.Fprintf(hash, "%s %d %s\n", head.AccountId, head.Length, head.Head)
+	}
+
+	return hash.Sum(nil)
+}
+
+// checkpointMessage is what checkpoints are signed over; Heads are covered by Root.
+func checkpointMessage(checkpoint model.LedgerCheckpoint) []byte {
+	return []byte(strings.Join([]string{
+		"broke-bank/ledger-checkpoint/v1",
+		checkpoint.Id.String(),
+		strconv.FormatInt(checkpoint.CreatedAt.UnixMicro(), 10),
+		strconv.Itoa(checkpoint.Accounts),
+		strconv.FormatInt(checkpoint.Links, 10),
+		checkpoint.Root.String(),
+	}, "\n"))
+}
+
+// CreateLedgerCheckpoint signs the current head of every account's chain with signer, and stores it.
+func CreateLedgerCheckpoint(ctx context.Context, store LedgerStore, signer *utils.Signer) (*model.LedgerCheckpoint, error) {
+	heads, err := store.GetLedgerHeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := model.LedgerCheckpoint{
+		Id:        id,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		Accounts:  len(*heads),
+		Heads:     *heads,
+		KeyId:     signer.KeyId,
+		PublicKey: model.HexBytes(signer.PublicKey()),
+	}
+	for _, head := range *heads {
+		checkpoint.Links += head.Length
+	}
+	checkpoint.Root = checkpointRoot(checkpoint.Heads)
+	checkpoint.Signature = signer.Sign(checkpointMessage(checkpoint))
+
+	if err = store.CreateLedgerCheckpoint(ctx, checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+/*
+VerifyCheckpoint checks that checkpoint is signed by its key and that its heads match what was
+signed. Whether the key is trusted is up to the caller, e.g. by comparing KeyId to a published one.
+*/
+func VerifyCheckpoint(checkpoint model.LedgerCheckpoint) error {
+	if !bytes.Equal(checkpointRoot(checkpoint.Heads), checkpoint.Root) {
+		return errors.New("checkpoint heads don't match its root")
+	}
+
+	links := int64(0)
+	for _, head := range checkpoint.Heads {
+		links += head.Length
+	}
+	if len(checkpoint.Heads) != checkpoint.Accounts || links != checkpoint.Links {
+		return errors.New("checkpoint heads don't match its counts")
+	}
+
+	if utils.KeyId(ed25519.PublicKey(checkpoint.PublicKey)) != checkpoint.KeyId {
+		return errors.New("checkpoint key id doesn't match its public key")
+	}
+
+	return utils.VerifySignature(checkpoint.PublicKey, checkpointMessage(checkpoint), checkpoint.Signature)
+}
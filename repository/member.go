@@ -0,0 +1,492 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type MemberRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+/*
+lockMembers locks the account, so that the membership changes of an account are serialized:
+checks like "is there another owner" then hold until the change commits.
+*/
+func lockMembers(ctx context.Context, tx *sqlx.Tx, account_id uuid.UUID) error {
+	locked := uuid.UUID{}
+	return tx.GetContext(ctx, &locked, `SELECT acc.id FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, account_id)
+}
+
+// getMember returns nil when user_id isn't a member of the account.
+func getMember(ctx context.Context, tx *sqlx.Tx, account_id uuid.UUID, user_id uuid.UUID) (*model.AccountMember, error) {
+	member := new(model.AccountMember)
+	err := tx.GetContext(ctx, member, `SELECT * FROM "account_member" am WHERE am.account_id = $1 AND am.user_id = $2`, account_id, user_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return member, err
+}
+
+func (mr *MemberRepository) GetAccountMember(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) (*model.AccountMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	member := new(model.AccountMember)
+	err := mr.Pg.GetContext(ctx, member, `SELECT * FROM "account_member" am WHERE am.account_id = $1 AND am.user_id = $2`, account_id, user_id)
+
+	return member, err
+}
+
+func (mr *MemberRepository) GetAccountMembers(ctx context.Context, account_id uuid.UUID) (*[]model.AccountMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	members := new([]model.AccountMember)
+	err := mr.Pg.SelectContext(ctx, members, `SELECT * FROM "account_member" am WHERE am.account_id = $1 ORDER BY am.created_at, am.user_id`, account_id)
+
+	return members, err
+}
+
+func (mr *MemberRepository) GetUserMemberships(ctx context.Context, user_id uuid.UUID) (*[]model.AccountMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	members := new([]model.AccountMember)
+	err := mr.Pg.SelectContext(ctx, members, `SELECT * FROM "account_member" am WHERE am.user_id = $1 ORDER BY am.account_id`, user_id)
+
+	return members, err
+}
+
+func (mr *MemberRepository) CreateInvitation(ctx context.Context, invitation model.AccountInvitation) (*model.AccountInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	created := new(model.AccountInvitation)
+	err := inTransaction(ctx, mr.Pg, func(tx *sqlx.Tx) error {
+		if err := lockMembers(ctx, tx, invitation.AccountId); err != nil {
+			return err
+		}
+
+		member := false
+		err := tx.GetContext(ctx,
+			&member,
+			`SELECT EXISTS (SELECT 1 FROM "account_member" am JOIN "user" u ON u.id = am.user_id WHERE am.account_id = $1 AND lower(u.email) = $2)`,
+			invitation.AccountId, invitation.Email,
+		)
+		if err != nil {
+			return err
+		}
+		if member {
+			return ErrAlreadyMember
+		}
+
+		invited := false
+		err = tx.GetContext(ctx,
+			&invited,
+			`SELECT EXISTS (SELECT 1 FROM "account_invitation" ai WHERE ai.account_id = $1 AND ai.email = $2 AND ai.status = 'pending')`,
+			invitation.AccountId, invitation.Email,
+		)
+		if err != nil {
+			return err
+		}
+		if invited {
+			return ErrAlreadyInvited
+		}
+
+		err = tx.GetContext(ctx,
+			created,
+			`INSERT INTO "account_invitation" (account_id, email, role, spend_limit, invited_by) VALUES ($1, $2, $3, $4, $5) RETURNING *`,
+			invitation.AccountId, invitation.Email, invitation.Role, invitation.SpendLimit, invitation.InvitedBy,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := InvitationAuditEvent(ctx, "account_invitation.create", created.InvitedBy, nil, created)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (mr *MemberRepository) GetInvitation(ctx context.Context, id uuid.UUID) (*model.AccountInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	invitation := new(model.AccountInvitation)
+	err := mr.Pg.GetContext(ctx, invitation, `SELECT * FROM "account_invitation" ai WHERE ai.id = $1`, id)
+
+	return invitation, err
+}
+
+func (mr *MemberRepository) GetAccountInvitations(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.AccountInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	invitations := new([]model.AccountInvitation)
+	err := mr.Pg.SelectContext(
+		ctx,
+		invitations,
+		`SELECT * FROM "account_invitation" ai WHERE ai.account_id = $1 ORDER BY ai.created_at DESC, ai.id DESC LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return invitations, err
+}
+
+func (mr *MemberRepository) GetPendingInvitations(ctx context.Context, email string) (*[]model.AccountInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	invitations := new([]model.AccountInvitation)
+	err := mr.Pg.SelectContext(
+		ctx,
+		invitations,
+		`SELECT * FROM "account_invitation" ai WHERE ai.email = $1 AND ai.status = 'pending' ORDER BY ai.created_at DESC, ai.id DESC`,
+		email,
+	)
+
+	return invitations, err
+}
+
+func (mr *MemberRepository) DecideInvitation(ctx context.Context, id uuid.UUID, user_id uuid.UUID, accept bool) (*model.AccountInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.AccountInvitation)
+	err := inTransaction(ctx, mr.Pg, func(tx *sqlx.Tx) error {
+		account_id := uuid.UUID{}
+		if err := tx.GetContext(ctx, &account_id, `SELECT ai.account_id FROM "account_invitation" ai WHERE ai.id = $1`, id); err != nil {
+			return err
+		}
+		if err := lockMembers(ctx, tx, account_id); err != nil {
+			return err
+		}
+
+		before := new(model.AccountInvitation)
+		if err := tx.GetContext(ctx, before, `SELECT * FROM "account_invitation" ai WHERE ai.id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+		if before.Status != "pending" {
+			return ErrInvitationDecided
+		}
+
+		status, action := "declined", "account_invitation.decline"
+		if accept {
+			status, action = "accepted", "account_invitation.accept"
+		}
+
+		err := tx.GetContext(ctx, after, `UPDATE "account_invitation" SET status = $2, decided_at = NOW() WHERE id = $1 RETURNING *`, id, status)
+		if err != nil {
+			return err
+		}
+
+		event, err := InvitationAuditEvent(ctx, action, user_id, before, after)
+		if err != nil {
+			return err
+		}
+		if err = insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		if !accept {
+			return nil
+		}
+
+		existing, err := getMember(ctx, tx, account_id, user_id)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrAlreadyMember
+		}
+
+		member := new(model.AccountMember)
+		err = tx.GetContext(ctx,
+			member,
+			`INSERT INTO "account_member" (account_id, user_id, role, spend_limit) VALUES ($1, $2, $3, $4) RETURNING *`,
+			account_id, user_id, after.Role, after.SpendLimit,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err = AccountMemberAuditEvent(ctx, "account.add_member", nil, member)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (mr *MemberRepository) RequestMemberRemoval(ctx context.Context, removal model.MemberRemoval) (*model.MemberRemoval, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	created := new(model.MemberRemoval)
+	err := inTransaction(ctx, mr.Pg, func(tx *sqlx.Tx) error {
+		if err := lockMembers(ctx, tx, removal.AccountId); err != nil {
+			return err
+		}
+
+		member, err := getMember(ctx, tx, removal.AccountId, removal.UserId)
+		if err != nil {
+			return err
+		}
+		requester, err := getMember(ctx, tx, removal.AccountId, removal.RequestedBy)
+		if err != nil {
+			return err
+		}
+		owners := 0
+		if err = tx.GetContext(ctx, &owners, `SELECT COUNT(*) FROM "account_member" am WHERE am.account_id = $1 AND am.role = 'owner'`, removal.AccountId); err != nil {
+			return err
+		}
+		if err = CheckRemovalRequest(member, requester, owners); err != nil {
+			return err
+		}
+
+		pending := false
+		err = tx.GetContext(ctx,
+			&pending,
+			`SELECT EXISTS (SELECT 1 FROM "account_member_removal" amr WHERE amr.account_id = $1 AND amr.user_id = $2 AND amr.status = 'pending')`,
+			removal.AccountId, removal.UserId,
+		)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return ErrRemovalPending
+		}
+
+		err = tx.GetContext(ctx,
+			created,
+			`INSERT INTO "account_member_removal" (account_id, user_id, requested_by) VALUES ($1, $2, $3) RETURNING *`,
+			removal.AccountId, removal.UserId, removal.RequestedBy,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := MemberRemovalAuditEvent(ctx, "account_member_removal.request", nil, created)
+		if err != nil {
+			return err
+		}
+		if err = insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		// The request of an owner approves the removal of members who aren't owners.
+		if requester.Role != model.MemberOwner || member.Role == model.MemberOwner {
+			return nil
+		}
+
+		return decideRemoval(ctx, tx, created, removal.RequestedBy, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+/*
+CheckRemovalRequest applies the rules of RequestMemberRemoval to the member to remove and the
+requester, nil when they aren't members, given the number of owners of the account.
+*/
+func CheckRemovalRequest(member *model.AccountMember, requester *model.AccountMember, owners int) error {
+	if member == nil || requester == nil {
+		return ErrNotMember
+	}
+	if requester.Role != model.MemberOwner && requester.UserId != member.UserId {
+		return ErrNotOwner
+	}
+	if member.Role == model.MemberOwner && owners <= 1 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+/*
+CheckRemovalDecision applies the rules of DecideMemberRemoval to the decider and the member to
+remove, nil when they aren't members anymore, given the number of owners of the account.
+*/
+func CheckRemovalDecision(removal *model.MemberRemoval, decider *model.AccountMember, member *model.AccountMember, owners int, approve bool) error {
+	if removal.Status != "pending" {
+		return ErrRemovalDecided
+	}
+	if decider == nil || decider.Role != model.MemberOwner {
+		return ErrNotOwner
+	}
+	if !approve || member == nil {
+		return nil
+	}
+	if member.Role == model.MemberOwner && removal.RequestedBy == decider.UserId {
+		return ErrOwnRemoval
+	}
+	if member.Role == model.MemberOwner && owners <= 1 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+func (mr *MemberRepository) GetMemberRemoval(ctx context.Context, id uuid.UUID) (*model.MemberRemoval, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	removal := new(model.MemberRemoval)
+	err := mr.Pg.GetContext(ctx, removal, `SELECT * FROM "account_member_removal" amr WHERE amr.id = $1`, id)
+
+	return removal, err
+}
+
+func (mr *MemberRepository) GetMemberRemovals(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.MemberRemoval, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	removals := new([]model.MemberRemoval)
+	err := mr.Pg.SelectContext(
+		ctx,
+		removals,
+		`SELECT * FROM "account_member_removal" amr WHERE amr.account_id = $1 ORDER BY amr.created_at DESC, amr.id DESC LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return removals, err
+}
+
+func (mr *MemberRepository) DecideMemberRemoval(ctx context.Context, id uuid.UUID, owner_id uuid.UUID, approve bool) (*model.MemberRemoval, error) {
+	ctx, cancel := context.WithTimeout(ctx, mr.Timeouts.Query)
+	defer cancel()
+
+	removal := new(model.MemberRemoval)
+	err := inTransaction(ctx, mr.Pg, func(tx *sqlx.Tx) error {
+		account_id := uuid.UUID{}
+		if err := tx.GetContext(ctx, &account_id, `SELECT amr.account_id FROM "account_member_removal" amr WHERE amr.id = $1`, id); err != nil {
+			return err
+		}
+		if err := lockMembers(ctx, tx, account_id); err != nil {
+			return err
+		}
+
+		if err := tx.GetContext(ctx, removal, `SELECT * FROM "account_member_removal" amr WHERE amr.id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+
+		return decideRemoval(ctx, tx, removal, owner_id, approve)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return removal, nil
+}
+
+/*
+decideRemoval records the decision of owner_id on removal, whose account is locked, and carries
+it out when approving. removal is updated in place.
+*/
+func decideRemoval(ctx context.Context, tx *sqlx.Tx, removal *model.MemberRemoval, owner_id uuid.UUID, approve bool) error {
+	decider, err := getMember(ctx, tx, removal.AccountId, owner_id)
+	if err != nil {
+		return err
+	}
+	member, err := getMember(ctx, tx, removal.AccountId, removal.UserId)
+	if err != nil {
+		return err
+	}
+	owners := 0
+	if err = tx.GetContext(ctx, &owners, `SELECT COUNT(*) FROM "account_member" am WHERE am.account_id = $1 AND am.role = 'owner'`, removal.AccountId); err != nil {
+		return err
+	}
+	if err = CheckRemovalDecision(removal, decider, member, owners, approve); err != nil {
+		return err
+	}
+
+	status, action := "rejected", "account_member_removal.reject"
+	if approve {
+		status, action = "approved", "account_member_removal.approve"
+	}
+
+	before := *removal
+	if err = tx.GetContext(ctx,
+		removal,
+		`UPDATE "account_member_removal" SET status = $2, decided_by = $3, decided_at = NOW() WHERE id = $1 RETURNING *`,
+		removal.Id, status, owner_id,
+	); err != nil {
+		return err
+	}
+
+	event, err := MemberRemovalAuditEvent(ctx, action, &before, removal)
+	if err != nil {
+		return err
+	}
+	if err = insertAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	// The member may have left meanwhile through another removal.
+	if !approve || member == nil {
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM "account_member" WHERE account_id = $1 AND user_id = $2`, member.AccountId, member.UserId); err != nil {
+		return err
+	}
+
+	if event, err = AccountMemberAuditEvent(ctx, "account.remove_member", member, nil); err != nil {
+		return err
+	}
+	if err = insertAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	// Their handle can't go on paying into an account they left.
+	err = deleteHandle(ctx, tx, `DELETE FROM "handle" WHERE account_id = $1 AND user_id = $2 RETURNING *`, member.AccountId, member.UserId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// account.user_id goes to the oldest remaining owner, when it was the removed member.
+	_, err = updateAccount(
+		ctx,
+		tx,
+		"account.change_owner",
+		member.AccountId.String(),
+		`UPDATE "account" acc SET user_id = (
+			SELECT am.user_id FROM "account_member" am WHERE am.account_id = acc.id AND am.role = 'owner' ORDER BY am.created_at, am.user_id LIMIT 1
+		), updated_at = NOW() WHERE acc.id = $1 AND acc.user_id = $2 RETURNING `+account_columns,
+		member.UserId,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,374 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Values of the account_status enum, in declaration order (which is how Postgres sorts them).
+var account_statuses = map[string]int{"active": 0, "inactive": 1, "frozen_debit": 2, "frozen_all": 3, "closed": 4}
+
+type AccountRepository struct {
+	Store *Store
+}
+
+func (ac *AccountRepository) CreateAccount(ctx context.Context, user_id string, name string, status string) error {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	owner_id, err := uuid.Parse(user_id)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.users[owner_id]; !ok {
+		return fmt.Errorf("insert or update on table \"account\" violates foreign key constraint \"fk_user\": user %s does not exist", user_id)
+	}
+	if _, ok := account_statuses[status]; !ok {
+		return fmt.Errorf("invalid input value for enum account_status: %q", status)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.account_number++
+	account := model.Account{
+		Id:        id,
+		UserId:    owner_id,
+		Name:      name,
+		Balance:   decimal.Zero,
+		Status:    status,
+		Number:    s.account_number,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	event, err := repository.AccountAuditEvent(ctx, "account.create", nil, &account)
+	if err != nil {
+		return err
+	}
+	s.accounts[id] = account
+	if err = s.appendAuditEvent(event); err != nil {
+		return err
+	}
+
+	return s.addMember(ctx, model.AccountMember{AccountId: id, UserId: owner_id, Role: model.MemberOwner})
+}
+
+func (ac *AccountRepository) GetAccount(ctx context.Context, acc_id string) (*model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, err := uuid.Parse(acc_id)
+	if err != nil {
+		return new(model.Account), err
+	}
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return new(model.Account), sql.ErrNoRows
+	}
+
+	return &account, nil
+}
+
+func (ac *AccountRepository) GetAccountByNumber(ctx context.Context, number int64) (*model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if account.Number == number {
+			return &account, nil
+		}
+	}
+
+	return new(model.Account), sql.ErrNoRows
+}
+
+func (ac *AccountRepository) GetMyAccounts(ctx context.Context, user_id string, limit int, offset int) (*[]model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	owner_id, err := uuid.Parse(user_id)
+	if err != nil {
+		return new([]model.Account), err
+	}
+
+	accounts := []model.Account{}
+	for account_id, members := range s.members {
+		if _, ok := members[owner_id]; ok {
+			accounts = append(accounts, s.accounts[account_id])
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Status != accounts[j].Status {
+			return account_statuses[accounts[i].Status] < account_statuses[accounts[j].Status]
+		}
+		return accounts[i].Id.String() < accounts[j].Id.String()
+	})
+
+	accounts = paginate(accounts, limit, offset)
+	return &accounts, nil
+}
+
+// DisableAccount writes the account.disabled outbox event along with the status, like the Postgres statement.
+func (ac *AccountRepository) DisableAccount(ctx context.Context, acc_id string) error {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	account, err := s.setAccountStatus(ctx, "account.disable", acc_id, repository.AccountStatusChange{Status: model.AccountInactive})
+	if err != nil || account == nil {
+		return err
+	}
+
+	for _, member := range s.memberIds(account.Id) {
+		if err = s.writeOutboxEvent(member, "account.disabled", map[string]any{"account_id": account.Id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ac *AccountRepository) SetAccountStatus(ctx context.Context, acc_id string, change repository.AccountStatusChange) (*model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	current, err := s.lookupAccount(acc_id)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(change.From, current.Status) {
+		return nil, repository.ErrAccountStatus
+	}
+
+	account, err := s.setAccountStatus(ctx, "account.set_status", acc_id, change)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, s.writeAccountStatusOutbox(account)
+}
+
+func (ac *AccountRepository) ExpireAccountFreezes(ctx context.Context) (*[]model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	expired := []string{}
+	now := time.Now()
+	for id, account := range s.accounts {
+		if account.FrozenUntil != nil && !account.FrozenUntil.After(now) {
+			expired = append(expired, id.String())
+		}
+	}
+	sort.Strings(expired)
+
+	accounts := []model.Account{}
+	for _, acc_id := range expired {
+		account, err := s.setAccountStatus(ctx, "account.set_status", acc_id, repository.AccountStatusChange{Status: model.AccountActive})
+		if err != nil {
+			return nil, err
+		}
+		if err = s.writeAccountStatusOutbox(account); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+
+	return &accounts, nil
+}
+
+func (ac *AccountRepository) CloseAccount(ctx context.Context, transaction_id uuid.UUID, acc_id string, to_account_id string) (*model.Account, *model.Transaction, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer s.mu.Unlock()
+
+	from_account, err := s.lookupAccount(acc_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	to_account, err := s.lookupAccount(to_account_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = repository.CheckAccountStatus(from_account.Status, from_account.FrozenUntil, true); err != nil {
+		return nil, nil, err
+	}
+	if err = repository.CheckAccountStatus(to_account.Status, to_account.FrozenUntil, false); err != nil {
+		return nil, nil, err
+	}
+
+	if from_account.Balance.IsNegative() {
+		return nil, nil, repository.ErrAccountOverdrawn
+	}
+
+	var sweep *model.Transaction
+	if from_account.Balance.IsPositive() {
+		if err = s.post(
+			ctx,
+			model.Transaction{Id: transaction_id, Type: "transfer", FromAccountId: &from_account.Id, ToAccountId: &to_account.Id, Amount: from_account.Balance},
+			map[uuid.UUID]decimal.Decimal{from_account.Id: from_account.Balance.Neg(), to_account.Id: from_account.Balance},
+		); err != nil {
+			return nil, nil, err
+		}
+		transaction := s.transactions[transaction_id]
+		sweep = &transaction
+	}
+
+	reason := "customer_request"
+	account, err := s.setAccountStatus(ctx, "account.close", acc_id, repository.AccountStatusChange{Status: model.AccountClosed, StatusReason: &reason})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = s.writeAccountStatusOutbox(account); err != nil {
+		return nil, nil, err
+	}
+
+	// Requests waiting on approvals would only fail once approved, and the handle would point payers at a closed account.
+	if err = s.failPaymentRequests(ctx, account.Id, "account_closed"); err != nil {
+		return nil, nil, err
+	}
+	for _, handle := range s.handles {
+		if handle.AccountId == account.Id {
+			if err = s.deleteHandle(ctx, handle); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return account, sweep, nil
+}
+
+func (ac *AccountRepository) ReopenAccount(ctx context.Context, acc_id string, since time.Time) (*model.Account, error) {
+	s := ac.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	current, err := s.lookupAccount(acc_id)
+	if err != nil {
+		return nil, err
+	}
+	if !repository.AccountReopenable(&current, since) {
+		return nil, repository.ErrAccountStatus
+	}
+
+	account, err := s.setAccountStatus(ctx, "account.reopen", acc_id, repository.AccountStatusChange{Status: model.AccountActive})
+	if err != nil {
+		return nil, err
+	}
+
+	return account, s.writeAccountStatusOutbox(account)
+}
+
+// writeAccountStatusOutbox writes the same event as the Postgres one. Must be called with the store locked.
+func (s *Store) writeAccountStatusOutbox(account *model.Account) error {
+	for _, member := range s.memberIds(account.Id) {
+		err := s.writeOutboxEvent(member, "account.status_changed", map[string]any{
+			"account_id":   account.Id,
+			"status":       account.Status,
+			"frozen_until": account.FrozenUntil,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+setAccountStatus returns the updated account, or nil when there is none: like an UPDATE
+matching no rows, unknown accounts are not an error. The change is audited as action.
+Must be called with the store locked.
+*/
+func (s *Store) setAccountStatus(ctx context.Context, action string, acc_id string, change repository.AccountStatusChange) (*model.Account, error) {
+	id, err := uuid.Parse(acc_id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := account_statuses[change.Status]; !ok {
+		return nil, fmt.Errorf("invalid input value for enum account_status: %q", change.Status)
+	}
+	if change.StatusReason != nil && !slices.Contains(model.AccountStatusReasons, *change.StatusReason) {
+		return nil, fmt.Errorf("invalid input value for enum account_status_reason: %q", *change.StatusReason)
+	}
+	frozen := change.Status == model.AccountFrozenDebit || change.Status == model.AccountFrozenAll
+	if (change.StatusReason != nil) != (frozen || change.Status == model.AccountClosed) || (change.FrozenUntil != nil && !frozen) {
+		return nil, fmt.Errorf("new row for relation \"account\" violates check constraint: status %s", change.Status)
+	}
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+
+	before := account
+	account.Status = change.Status
+	account.StatusReason = change.StatusReason
+	account.FrozenUntil = change.FrozenUntil
+	account.ClosedAt = nil
+	account.UpdatedAt = time.Now()
+	if change.Status == model.AccountClosed {
+		closed_at := account.UpdatedAt
+		account.ClosedAt = &closed_at
+	}
+
+	event, err := repository.AccountAuditEvent(ctx, action, &before, &account)
+	if err != nil {
+		return nil, err
+	}
+	s.accounts[id] = account
+
+	return &account, s.appendAuditEvent(event)
+}
+
+func paginate[T any](rows []T, limit int, offset int) []T {
+	if offset >= len(rows) {
+		return []T{}
+	}
+	rows = rows[offset:]
+
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	return rows
+}
@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type AdjustmentRepository struct {
+	Store *Store
+}
+
+func (ar *AdjustmentRepository) CreateAdjustment(ctx context.Context, adjustment model.Adjustment) (*model.Adjustment, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	amount, err := toDecimal(adjustment.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.accounts[adjustment.AccountId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"adjustment\" violates foreign key constraint: account %s", adjustment.AccountId)
+	}
+	if _, ok := s.users[adjustment.ProposedBy]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"adjustment\" violates foreign key constraint: user %s", adjustment.ProposedBy)
+	}
+	if adjustment.ReversalOf != nil {
+		if _, ok := s.transactions[*adjustment.ReversalOf]; !ok {
+			return nil, fmt.Errorf("insert or update on table \"adjustment\" violates foreign key constraint: transaction %s", adjustment.ReversalOf)
+		}
+	}
+	if amount.IsZero() || adjustment.RequiredApprovals <= 0 {
+		return nil, fmt.Errorf("new row for relation \"adjustment\" violates check constraint: amount %s, required approvals %d", amount, adjustment.RequiredApprovals)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := adjustment
+	created.Id = id
+	created.Amount = amount
+	created.Status = "pending"
+	created.TransactionId = nil
+	created.CreatedAt, created.UpdatedAt = now, now
+
+	event, err := repository.AdjustmentAuditEvent(ctx, "adjustment.propose", nil, nil, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	s.adjustments[created.Id] = created
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (ar *AdjustmentRepository) GetAdjustment(ctx context.Context, id uuid.UUID) (*model.Adjustment, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	adjustment, ok := s.adjustments[id]
+	if !ok {
+		return new(model.Adjustment), sql.ErrNoRows
+	}
+
+	return &adjustment, nil
+}
+
+func (ar *AdjustmentRepository) GetAdjustments(ctx context.Context, filter repository.AdjustmentFilter, limit int, offset int) (*[]model.Adjustment, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	adjustments := []model.Adjustment{}
+	for _, adjustment := range s.adjustments {
+		if filter.AccountId != nil && adjustment.AccountId != *filter.AccountId {
+			continue
+		}
+		if filter.Status != "" && adjustment.Status != filter.Status {
+			continue
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+
+	sort.Slice(adjustments, func(i, j int) bool {
+		if !adjustments[i].CreatedAt.Equal(adjustments[j].CreatedAt) {
+			return adjustments[i].CreatedAt.After(adjustments[j].CreatedAt)
+		}
+		return adjustments[i].Id.String() > adjustments[j].Id.String()
+	})
+
+	adjustments = paginate(adjustments, limit, offset)
+	return &adjustments, nil
+}
+
+func (ar *AdjustmentRepository) GetAdjustmentDecisions(ctx context.Context, adjustment_id uuid.UUID) (*[]model.AdjustmentDecision, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	decisions := append([]model.AdjustmentDecision{}, s.adjustment_decisions[adjustment_id]...)
+	return &decisions, nil
+}
+
+func (ar *AdjustmentRepository) DecideAdjustment(ctx context.Context, decision model.AdjustmentDecision, transaction_id uuid.UUID) (*model.Adjustment, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.adjustments[decision.AdjustmentId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	if before.Status != "pending" {
+		return nil, repository.ErrAdjustmentDecided
+	}
+	if before.ProposedBy == decision.StaffId {
+		return nil, repository.ErrSelfApproval
+	}
+	if _, ok := s.users[decision.StaffId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"adjustment_decision\" violates foreign key constraint: user %s", decision.StaffId)
+	}
+
+	approvals := 0
+	for _, earlier := range s.adjustment_decisions[before.Id] {
+		if earlier.StaffId == decision.StaffId {
+			return nil, repository.ErrAlreadyDecided
+		}
+		if earlier.Decision == "approved" {
+			approvals++
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	recorded := decision
+	recorded.Id = id
+	recorded.AdjustmentId = before.Id
+	recorded.CreatedAt = now
+
+	after := before
+	after.UpdatedAt = now
+	action := "adjustment.approve"
+	switch recorded.Decision {
+	case "rejected":
+		after.Status = "rejected"
+		action = "adjustment.reject"
+	case "approved":
+		approvals++
+	default:
+		return nil, fmt.Errorf("invalid input value for enum adjustment_decision: %q", recorded.Decision)
+	}
+
+	// Posting is last to change the store but checked first, so a failure leaves nothing behind.
+	post := after.Status == "pending" && approvals >= before.RequiredApprovals
+	var transaction model.Transaction
+	if post && before.ReversalOf != nil {
+		// The reversal checks everything itself before changing the store.
+		after.Status, after.TransactionId = "approved", &transaction_id
+	} else if post {
+		account := s.accounts[before.AccountId]
+		if err := repository.CheckAccountStatus(account.Status, account.FrozenUntil, before.Amount.IsNegative()); err != nil {
+			return nil, err
+		}
+		if account.Balance.Add(before.Amount).IsNegative() {
+			return nil, repository.ErrInsufficientBalance
+		}
+
+		transaction = model.Transaction{Id: transaction_id, Type: "adjustment", Amount: before.Amount.Abs()}
+		if before.Amount.IsNegative() {
+			transaction.FromAccountId = &account.Id
+		} else {
+			transaction.ToAccountId = &account.Id
+		}
+		after.Status, after.TransactionId = "approved", &transaction_id
+	}
+
+	event, err := repository.AdjustmentAuditEvent(ctx, action, &recorded, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	if post && before.ReversalOf != nil {
+		if _, err = s.reverse(ctx, transaction_id, *before.ReversalOf); err != nil {
+			return nil, err
+		}
+	} else if post {
+		if err = s.post(ctx, transaction, map[uuid.UUID]decimal.Decimal{before.AccountId: before.Amount}); err != nil {
+			return nil, err
+		}
+	}
+
+	s.adjustments[after.Id] = after
+	s.adjustment_decisions[after.Id] = append(s.adjustment_decisions[after.Id], recorded)
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
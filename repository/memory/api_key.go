@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ApiKeyRepository struct {
+	Store *Store
+}
+
+func (akr *ApiKeyRepository) CreateApiKey(ctx context.Context, user_id uuid.UUID, name string, key_hash string, prefix string) (*model.ApiKey, error) {
+	s := akr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user_id]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"api_key\" violates foreign key constraint: user %s", user_id)
+	}
+	for _, api_key := range s.api_keys {
+		if api_key.KeyHash == key_hash {
+			return nil, fmt.Errorf("duplicate key value violates unique constraint \"api_key_key_hash_key\"")
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	api_key := model.ApiKey{Id: id, UserId: user_id, Name: name, KeyHash: key_hash, Prefix: prefix, CreatedAt: time.Now()}
+	event, err := repository.ApiKeyAuditEvent(ctx, "api_key.create", nil, &api_key)
+	if err != nil {
+		return nil, err
+	}
+	s.api_keys[id] = api_key
+
+	return &api_key, s.appendAuditEvent(event)
+}
+
+func (akr *ApiKeyRepository) GetApiKeyByHash(ctx context.Context, key_hash string) (*model.ApiKey, error) {
+	s := akr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, api_key := range s.api_keys {
+		if api_key.KeyHash == key_hash {
+			return &api_key, nil
+		}
+	}
+
+	return new(model.ApiKey), sql.ErrNoRows
+}
+
+func (akr *ApiKeyRepository) GetUserApiKeys(ctx context.Context, user_id uuid.UUID) (*[]model.ApiKey, error) {
+	s := akr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	api_keys := []model.ApiKey{}
+	for _, api_key := range s.api_keys {
+		if api_key.UserId == user_id {
+			api_keys = append(api_keys, api_key)
+		}
+	}
+
+	sort.Slice(api_keys, func(i, j int) bool {
+		if !api_keys[i].CreatedAt.Equal(api_keys[j].CreatedAt) {
+			return api_keys[i].CreatedAt.After(api_keys[j].CreatedAt)
+		}
+		return api_keys[i].Id.String() > api_keys[j].Id.String()
+	})
+
+	return &api_keys, nil
+}
+
+func (akr *ApiKeyRepository) RevokeApiKey(ctx context.Context, id uuid.UUID) error {
+	s := akr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	api_key, ok := s.api_keys[id]
+	if !ok || api_key.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	before := api_key
+	now := time.Now()
+	api_key.RevokedAt = &now
+
+	event, err := repository.ApiKeyAuditEvent(ctx, "api_key.revoke", &before, &api_key)
+	if err != nil {
+		return err
+	}
+	s.api_keys[id] = api_key
+
+	return s.appendAuditEvent(event)
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditRepository struct {
+	Store *Store
+}
+
+// appendAuditEvent records event, the caller holding the lock of the change it describes.
+func (s *Store) appendAuditEvent(event model.AuditEvent) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	event.Id = id
+	event.CreatedAt = time.Now()
+	if len(event.Details) == 0 {
+		event.Details = []byte("{}")
+	}
+	s.audit_events = append(s.audit_events, event)
+
+	return nil
+}
+
+func (ar *AuditRepository) CreateAuditEvent(ctx context.Context, event model.AuditEvent) error {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	return s.appendAuditEvent(event)
+}
+
+func (ar *AuditRepository) GetAuditEvents(ctx context.Context, target_type string, target_id string, limit int, offset int) (*[]model.AuditEvent, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	events := []model.AuditEvent{}
+	// Newest first, like the Postgres query.
+	for i := len(s.audit_events) - 1; i >= 0; i-- {
+		event := s.audit_events[i]
+		if event.TargetType == target_type && event.TargetId == target_id {
+			events = append(events, event)
+		}
+	}
+
+	events = paginate(events, limit, offset)
+	return &events, nil
+}
+
+func (ar *AuditRepository) SearchAuditEvents(ctx context.Context, filter repository.AuditFilter, limit int, offset int) (*[]model.AuditEvent, error) {
+	s := ar.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	matches := func(event model.AuditEvent) bool {
+		switch {
+		case filter.UserId != nil && (event.UserId == nil || *event.UserId != *filter.UserId):
+			return false
+		case filter.Actor != "" && event.Actor != filter.Actor:
+			return false
+		case filter.Action != "" && event.Action != filter.Action:
+			return false
+		case filter.TargetType != "" && event.TargetType != filter.TargetType:
+			return false
+		case filter.TargetId != "" && event.TargetId != filter.TargetId:
+			return false
+		case filter.Since != nil && event.CreatedAt.Before(*filter.Since):
+			return false
+		case filter.Until != nil && !event.CreatedAt.Before(*filter.Until):
+			return false
+		}
+		return true
+	}
+
+	events := []model.AuditEvent{}
+	for i := len(s.audit_events) - 1; i >= 0; i-- {
+		if matches(s.audit_events[i]) {
+			events = append(events, s.audit_events[i])
+		}
+	}
+
+	events = paginate(events, limit, offset)
+	return &events, nil
+}
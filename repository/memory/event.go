@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type EventRepository struct {
+	Store *Store
+}
+
+type eventId struct {
+	ms  int64
+	seq int64
+}
+
+func parseEventId(id string) (eventId, error) {
+	parsed := eventId{}
+	if _, err := fmt.Sscanf(id, "%d-%d", &parsed.ms, &parsed.seq); err != nil {
+		return eventId{}, fmt.Errorf("invalid stream ID %q", id)
+	}
+
+	return parsed, nil
+}
+
+func (a eventId) after(b eventId) bool {
+	return a.ms > b.ms || (a.ms == b.ms && a.seq > b.seq)
+}
+
+// PublishEvent assigns ids like XADD does: the current time in milliseconds, with a sequence for ties.
+func (er *EventRepository) PublishEvent(ctx context.Context, user_id string, event_type string, data json.RawMessage) (string, error) {
+	s := er.Store
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	id := eventId{ms: time.Now().UnixMilli()}
+	if last := s.last_event_id; !id.after(last) {
+		id = eventId{ms: last.ms, seq: last.seq + 1}
+	}
+	s.last_event_id = id
+
+	event := model.Event{Id: fmt.Sprintf("%d-%d", id.ms, id.seq), Type: event_type, Data: data}
+	s.events[user_id] = append(s.events[user_id], event)
+	if len(s.events[user_id]) > repository.EventRetention {
+		s.events[user_id] = s.events[user_id][len(s.events[user_id])-repository.EventRetention:]
+	}
+
+	// Wake up every waiting reader.
+	close(s.events_published)
+	s.events_published = make(chan struct{})
+
+	return event.Id, nil
+}
+
+func (er *EventRepository) GetLatestEventId(ctx context.Context, user_id string) (string, error) {
+	s := er.Store
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	events := s.events[user_id]
+	if len(events) == 0 {
+		return "0-0", nil
+	}
+
+	return events[len(events)-1].Id, nil
+}
+
+func (er *EventRepository) ReadEvents(ctx context.Context, user_id string, after_id string, limit int, wait time.Duration) ([]model.Event, error) {
+	after, err := parseEventId(after_id)
+	if err != nil {
+		return nil, err
+	}
+
+	s := er.Store
+	timeout := time.After(wait)
+	for {
+		if err := s.lock(ctx); err != nil {
+			return nil, err
+		}
+
+		events := []model.Event{}
+		for _, event := range s.events[user_id] {
+			if id, _ := parseEventId(event.Id); id.after(after) && len(events) < limit {
+				events = append(events, event)
+			}
+		}
+		published := s.events_published
+		s.mu.Unlock()
+
+		if len(events) > 0 || wait <= 0 {
+			return events, nil
+		}
+
+		select {
+		case <-published:
+		case <-timeout:
+			return events, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mirrors the check constraint of handle.handle.
+var handle_pattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,29}$`)
+
+type HandleRepository struct {
+	Store *Store
+}
+
+// userHandle returns the handle of the user, and nil when they have none.
+func (s *Store) userHandle(user_id uuid.UUID) *model.Handle {
+	for _, handle := range s.handles {
+		if handle.UserId == user_id {
+			return &handle
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) deleteHandle(ctx context.Context, handle model.Handle) error {
+	event, err := repository.HandleAuditEvent(ctx, "user.delete_handle", &handle, nil)
+	if err != nil {
+		return err
+	}
+
+	delete(s.handles, handle.Handle)
+	return s.appendAuditEvent(event)
+}
+
+func (hr *HandleRepository) SetHandle(ctx context.Context, handle model.Handle) (*model.Handle, error) {
+	s := hr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[handle.UserId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"handle\" violates foreign key constraint: user %s", handle.UserId)
+	}
+	if _, ok := s.accounts[handle.AccountId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"handle\" violates foreign key constraint: account %s", handle.AccountId)
+	}
+	if !handle_pattern.MatchString(handle.Handle) {
+		return nil, fmt.Errorf("new row for relation \"handle\" violates check constraint: handle %q", handle.Handle)
+	}
+
+	if existing, ok := s.handles[handle.Handle]; ok && existing.UserId != handle.UserId {
+		return nil, repository.ErrHandleTaken
+	}
+	for _, existing := range s.handles {
+		if existing.AccountId == handle.AccountId && existing.UserId != handle.UserId {
+			return nil, fmt.Errorf("duplicate key value violates unique constraint \"handle_account_id_key\": account %s", handle.AccountId)
+		}
+	}
+
+	now := time.Now()
+	before := s.userHandle(handle.UserId)
+	after := handle
+	after.CreatedAt, after.UpdatedAt = now, now
+	if before != nil {
+		after.CreatedAt = before.CreatedAt
+	}
+
+	event, err := repository.HandleAuditEvent(ctx, "user.set_handle", before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil {
+		delete(s.handles, before.Handle)
+	}
+	s.handles[after.Handle] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+func (hr *HandleRepository) GetHandle(ctx context.Context, handle string) (*model.Handle, error) {
+	s := hr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	found, ok := s.handles[handle]
+	if !ok {
+		return new(model.Handle), sql.ErrNoRows
+	}
+
+	return &found, nil
+}
+
+func (hr *HandleRepository) GetUserHandle(ctx context.Context, user_id uuid.UUID) (*model.Handle, error) {
+	s := hr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	handle := s.userHandle(user_id)
+	if handle == nil {
+		return new(model.Handle), sql.ErrNoRows
+	}
+
+	return handle, nil
+}
+
+func (hr *HandleRepository) GetAccountHandle(ctx context.Context, account_id uuid.UUID) (*model.Handle, error) {
+	s := hr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, handle := range s.handles {
+		if handle.AccountId == account_id {
+			return &handle, nil
+		}
+	}
+
+	return new(model.Handle), sql.ErrNoRows
+}
+
+func (hr *HandleRepository) DeleteHandle(ctx context.Context, user_id uuid.UUID) error {
+	s := hr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	handle := s.userHandle(user_id)
+	if handle == nil {
+		return sql.ErrNoRows
+	}
+
+	return s.deleteHandle(ctx, *handle)
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+type LedgerRepository struct {
+	*Store
+}
+
+// chainTransaction appends transaction, about to be stored, to the chains of its accounts.
+func (s *Store) chainTransaction(transaction *model.Transaction) {
+	if transaction.FromAccountId != nil {
+		transaction.FromPrevHash = s.ledger_heads[*transaction.FromAccountId].Head
+	}
+	if transaction.ToAccountId != nil {
+		transaction.ToPrevHash = s.ledger_heads[*transaction.ToAccountId].Head
+	}
+	transaction.ChainHash = repository.LedgerHash(*transaction)
+
+	for _, account_id := range []*uuid.UUID{transaction.FromAccountId, transaction.ToAccountId} {
+		if account_id == nil {
+			continue
+		}
+		head := s.ledger_heads[*account_id]
+		s.ledger_heads[*account_id] = model.LedgerHead{AccountId: *account_id, Length: head.Length + 1, Head: transaction.ChainHash}
+	}
+}
+
+func (s *Store) ledgerHead(account_id uuid.UUID) model.LedgerHead {
+	head := s.ledger_heads[account_id]
+	head.AccountId = account_id
+
+	return head
+}
+
+func (lr *LedgerRepository) GetLedgerHeads(ctx context.Context) (*[]model.LedgerHead, error) {
+	s := lr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	heads := []model.LedgerHead{}
+	for id := range s.accounts {
+		heads = append(heads, s.ledgerHead(id))
+	}
+
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].AccountId.String() < heads[j].AccountId.String()
+	})
+
+	return &heads, nil
+}
+
+func (lr *LedgerRepository) GetLedgerHead(ctx context.Context, account_id uuid.UUID) (*model.LedgerHead, error) {
+	s := lr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[account_id]; !ok {
+		return new(model.LedgerHead), sql.ErrNoRows
+	}
+
+	head := s.ledgerHead(account_id)
+	return &head, nil
+}
+
+func (lr *LedgerRepository) GetAccountLedger(ctx context.Context, account_id uuid.UUID) (*[]model.Transaction, error) {
+	s := lr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	transactions := []model.Transaction{}
+	for _, transaction := range s.transactions {
+		if (transaction.FromAccountId != nil && *transaction.FromAccountId == account_id) || (transaction.ToAccountId != nil && *transaction.ToAccountId == account_id) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].DateIssued.Equal(transactions[j].DateIssued) {
+			return transactions[i].DateIssued.Before(transactions[j].DateIssued)
+		}
+		return transactions[i].Id.String() < transactions[j].Id.String()
+	})
+
+	return &transactions, nil
+}
+
+func (lr *LedgerRepository) CreateLedgerCheckpoint(ctx context.Context, checkpoint model.LedgerCheckpoint) error {
+	s := lr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, existing := range s.ledger_checkpoints {
+		if existing.Id == checkpoint.Id {
+			return fmt.Errorf("duplicate key value violates unique constraint \"ledger_checkpoint_pkey\": %s", checkpoint.Id)
+		}
+	}
+
+	s.ledger_checkpoints = append(s.ledger_checkpoints, checkpoint)
+	return nil
+}
+
+func (lr *LedgerRepository) GetLedgerCheckpoints(ctx context.Context, limit int, offset int) (*[]model.LedgerCheckpoint, error) {
+	s := lr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	checkpoints := []model.LedgerCheckpoint{}
+	for i := len(s.ledger_checkpoints) - 1; i >= 0; i-- {
+		checkpoints = append(checkpoints, s.ledger_checkpoints[i])
+	}
+
+	checkpoints = paginate(checkpoints, limit, offset)
+	return &checkpoints, nil
+}
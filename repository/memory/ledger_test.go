@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/repository/repositorytest"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ledgerFixture makes an account with 4 links, and returns it with its transactions oldest first.
+func ledgerFixture(t *testing.T) (*Store, repository.Repositories, uuid.UUID, []model.Transaction) {
+	store := NewStore()
+	repos := store.Repositories()
+	account := repositorytest.CreateAccount(t, repos, repositorytest.CreateUser(t, repos), "100")
+	for range 3 {
+		if err := repos.TransactionRepository.WithdrawalTransaction(context.Background(), uuid.New(), account.Id.String(), decimal.NewFromInt(10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ledger, err := repos.LedgerRepository.GetAccountLedger(context.Background(), account.Id)
+	if err != nil || len(*ledger) != 4 {
+		t.Fatalf("GetAccountLedger = %+v, %v, want 4 transactions", ledger, err)
+	}
+
+	return store, repos, account.Id, *ledger
+}
+
+func verifyBroken(t *testing.T, repos repository.Repositories, checkpoints []model.LedgerCheckpoint) repository.BrokenLink {
+	t.Helper()
+
+	report, err := repository.VerifyLedger(context.Background(), repos.LedgerRepository, nil, checkpoints)
+	if err != nil {
+		t.Fatalf("VerifyLedger: %s", err)
+	}
+	if len(report.Broken) != 1 {
+		t.Fatalf("VerifyLedger broken links = %+v, want one", report.Broken)
+	}
+
+	return report.Broken[0]
+}
+
+func TestLedgerPinpointsTampering(t *testing.T) {
+	t.Run("Changed", func(t *testing.T) {
+		store, repos, _, ledger := ledgerFixture(t)
+		changed := store.transactions[ledger[2].Id]
+		changed.Amount = decimal.NewFromInt(1)
+		store.transactions[changed.Id] = changed
+
+		broken := verifyBroken(t, repos, nil)
+		if broken.Position != 3 || broken.TransactionId == nil || *broken.TransactionId != changed.Id || !strings.Contains(broken.Problem, "changed") {
+			t.Fatalf("changed amount reported as %+v, want link 3", broken)
+		}
+	})
+
+	t.Run("DeletedInTheMiddle", func(t *testing.T) {
+		store, repos, _, ledger := ledgerFixture(t)
+		delete(store.transactions, ledger[1].Id)
+
+		broken := verifyBroken(t, repos, nil)
+		if broken.Position != 2 || broken.TransactionId == nil || *broken.TransactionId != ledger[2].Id {
+			t.Fatalf("deleted transaction reported as %+v, want link 2, where its successor no longer follows", broken)
+		}
+	})
+
+	t.Run("DeletedLatest", func(t *testing.T) {
+		store, repos, _, ledger := ledgerFixture(t)
+		delete(store.transactions, ledger[3].Id)
+
+		broken := verifyBroken(t, repos, nil)
+		if broken.Position != 4 || broken.TransactionId != nil || !strings.Contains(broken.Problem, "deleted") {
+			t.Fatalf("deleted latest transaction reported as %+v, want link 4", broken)
+		}
+	})
+
+	// Rewriting a chain with consistent hashes is only caught by the checkpoints it no longer matches.
+	t.Run("Rewritten", func(t *testing.T) {
+		store, repos, account_id, ledger := ledgerFixture(t)
+		signer, err := utils.NewSigner(bytes.Repeat([]byte{1}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkpoint, err := repository.CreateLedgerCheckpoint(context.Background(), repos.LedgerRepository, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store.ledger_heads[account_id] = model.LedgerHead{}
+		for i, transaction := range ledger {
+			if i == 1 {
+				transaction.Amount = decimal.NewFromInt(1)
+			}
+			store.chainTransaction(&transaction)
+			store.transactions[transaction.Id] = transaction
+		}
+
+		if report, err := repository.VerifyLedger(context.Background(), repos.LedgerRepository, nil, nil); err != nil || len(report.Broken) != 0 {
+			t.Fatalf("VerifyLedger without checkpoints = %+v, %v, want the rewritten chain to look intact", report, err)
+		}
+
+		broken := verifyBroken(t, repos, []model.LedgerCheckpoint{*checkpoint})
+		if broken.AccountId != account_id || broken.Position != 4 || !strings.Contains(broken.Problem, checkpoint.Id.String()) {
+			t.Fatalf("rewritten chain reported as %+v, want the checkpoint's head", broken)
+		}
+	})
+}
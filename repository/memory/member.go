@@ -0,0 +1,509 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MemberRepository struct {
+	Store *Store
+}
+
+// addMember inserts member and audits it, like the INSERT INTO "account_member" statements.
+func (s *Store) addMember(ctx context.Context, member model.AccountMember) error {
+	if !slices.Contains(model.MemberRoles, member.Role) {
+		return fmt.Errorf("invalid input value for enum account_member_role: %q", member.Role)
+	}
+	if (member.SpendLimit != nil) != (member.Role == model.MemberSpender) || (member.SpendLimit != nil && !member.SpendLimit.IsPositive()) {
+		return fmt.Errorf("new row for relation \"account_member\" violates check constraint: role %s, spend limit %v", member.Role, member.SpendLimit)
+	}
+	if member.SpendLimit != nil {
+		limit, err := toDecimal(*member.SpendLimit)
+		if err != nil {
+			return err
+		}
+		member.SpendLimit = &limit
+	}
+	if _, ok := s.members[member.AccountId][member.UserId]; ok {
+		return fmt.Errorf("duplicate key value violates unique constraint \"account_member_pkey\"")
+	}
+
+	member.CreatedAt = time.Now()
+	event, err := repository.AccountMemberAuditEvent(ctx, "account.add_member", nil, &member)
+	if err != nil {
+		return err
+	}
+
+	if s.members[member.AccountId] == nil {
+		s.members[member.AccountId] = map[uuid.UUID]model.AccountMember{}
+	}
+	s.members[member.AccountId][member.UserId] = member
+
+	return s.appendAuditEvent(event)
+}
+
+// getMember returns nil when user_id isn't a member of the account.
+func (s *Store) getMember(account_id uuid.UUID, user_id uuid.UUID) *model.AccountMember {
+	member, ok := s.members[account_id][user_id]
+	if !ok {
+		return nil
+	}
+
+	return &member
+}
+
+// memberIds returns the members of an account ordered by user id, whom its outbox events are written for.
+func (s *Store) memberIds(account_id uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for id := range s.members[account_id] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	return ids
+}
+
+func (s *Store) countOwners(account_id uuid.UUID) int {
+	owners := 0
+	for _, member := range s.members[account_id] {
+		if member.Role == model.MemberOwner {
+			owners++
+		}
+	}
+
+	return owners
+}
+
+func (mr *MemberRepository) GetAccountMember(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) (*model.AccountMember, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	member := s.getMember(account_id, user_id)
+	if member == nil {
+		return new(model.AccountMember), sql.ErrNoRows
+	}
+
+	return member, nil
+}
+
+func (mr *MemberRepository) GetAccountMembers(ctx context.Context, account_id uuid.UUID) (*[]model.AccountMember, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	members := []model.AccountMember{}
+	for _, member := range s.members[account_id] {
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].UserId.String() < members[j].UserId.String()
+	})
+
+	return &members, nil
+}
+
+func (mr *MemberRepository) GetUserMemberships(ctx context.Context, user_id uuid.UUID) (*[]model.AccountMember, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	members := []model.AccountMember{}
+	for _, account_members := range s.members {
+		if member, ok := account_members[user_id]; ok {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].AccountId.String() < members[j].AccountId.String()
+	})
+
+	return &members, nil
+}
+
+func (mr *MemberRepository) CreateInvitation(ctx context.Context, invitation model.AccountInvitation) (*model.AccountInvitation, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[invitation.AccountId]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := s.users[invitation.InvitedBy]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"account_invitation\" violates foreign key constraint: user %s", invitation.InvitedBy)
+	}
+	if !slices.Contains(model.MemberRoles, invitation.Role) {
+		return nil, fmt.Errorf("invalid input value for enum account_member_role: %q", invitation.Role)
+	}
+	if invitation.Email != strings.ToLower(invitation.Email) ||
+		(invitation.SpendLimit != nil) != (invitation.Role == model.MemberSpender) ||
+		(invitation.SpendLimit != nil && !invitation.SpendLimit.IsPositive()) {
+		return nil, fmt.Errorf("new row for relation \"account_invitation\" violates check constraint: email %s, role %s, spend limit %v", invitation.Email, invitation.Role, invitation.SpendLimit)
+	}
+
+	for user_id := range s.members[invitation.AccountId] {
+		if strings.ToLower(s.users[user_id].Email) == invitation.Email {
+			return nil, repository.ErrAlreadyMember
+		}
+	}
+	for _, existing := range s.invitations {
+		if existing.AccountId == invitation.AccountId && existing.Email == invitation.Email && existing.Status == "pending" {
+			return nil, repository.ErrAlreadyInvited
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	created := invitation
+	created.Id = id
+	created.Status = "pending"
+	created.CreatedAt = time.Now()
+	created.DecidedAt = nil
+	if created.SpendLimit != nil {
+		limit, err := toDecimal(*created.SpendLimit)
+		if err != nil {
+			return nil, err
+		}
+		created.SpendLimit = &limit
+	}
+
+	event, err := repository.InvitationAuditEvent(ctx, "account_invitation.create", created.InvitedBy, nil, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invitations[id] = created
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (mr *MemberRepository) GetInvitation(ctx context.Context, id uuid.UUID) (*model.AccountInvitation, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	invitation, ok := s.invitations[id]
+	if !ok {
+		return new(model.AccountInvitation), sql.ErrNoRows
+	}
+
+	return &invitation, nil
+}
+
+// newestInvitationsFirst orders invitations like ORDER BY created_at DESC, id DESC.
+func newestInvitationsFirst(invitations []model.AccountInvitation) {
+	sort.Slice(invitations, func(i, j int) bool {
+		if !invitations[i].CreatedAt.Equal(invitations[j].CreatedAt) {
+			return invitations[i].CreatedAt.After(invitations[j].CreatedAt)
+		}
+		return invitations[i].Id.String() > invitations[j].Id.String()
+	})
+}
+
+func (mr *MemberRepository) GetAccountInvitations(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.AccountInvitation, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	invitations := []model.AccountInvitation{}
+	for _, invitation := range s.invitations {
+		if invitation.AccountId == account_id {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	newestInvitationsFirst(invitations)
+	invitations = paginate(invitations, limit, offset)
+	return &invitations, nil
+}
+
+func (mr *MemberRepository) GetPendingInvitations(ctx context.Context, email string) (*[]model.AccountInvitation, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	invitations := []model.AccountInvitation{}
+	for _, invitation := range s.invitations {
+		if invitation.Email == email && invitation.Status == "pending" {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	newestInvitationsFirst(invitations)
+	return &invitations, nil
+}
+
+func (mr *MemberRepository) DecideInvitation(ctx context.Context, id uuid.UUID, user_id uuid.UUID, accept bool) (*model.AccountInvitation, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.invitations[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if before.Status != "pending" {
+		return nil, repository.ErrInvitationDecided
+	}
+	if _, ok := s.users[user_id]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"account_member\" violates foreign key constraint: user %s", user_id)
+	}
+	if accept && s.getMember(before.AccountId, user_id) != nil {
+		return nil, repository.ErrAlreadyMember
+	}
+
+	status, action := "declined", "account_invitation.decline"
+	if accept {
+		status, action = "accepted", "account_invitation.accept"
+	}
+
+	now := time.Now()
+	after := before
+	after.Status = status
+	after.DecidedAt = &now
+
+	event, err := repository.InvitationAuditEvent(ctx, action, user_id, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.invitations[id] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	if accept {
+		member := model.AccountMember{AccountId: after.AccountId, UserId: user_id, Role: after.Role, SpendLimit: after.SpendLimit}
+		if err = s.addMember(ctx, member); err != nil {
+			return nil, err
+		}
+	}
+
+	return &after, nil
+}
+
+func (mr *MemberRepository) RequestMemberRemoval(ctx context.Context, removal model.MemberRemoval) (*model.MemberRemoval, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[removal.AccountId]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	member := s.getMember(removal.AccountId, removal.UserId)
+	requester := s.getMember(removal.AccountId, removal.RequestedBy)
+	if err := repository.CheckRemovalRequest(member, requester, s.countOwners(removal.AccountId)); err != nil {
+		return nil, err
+	}
+	for _, existing := range s.member_removals {
+		if existing.AccountId == removal.AccountId && existing.UserId == removal.UserId && existing.Status == "pending" {
+			return nil, repository.ErrRemovalPending
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	created := removal
+	created.Id = id
+	created.Status = "pending"
+	created.DecidedBy = nil
+	created.CreatedAt = time.Now()
+	created.DecidedAt = nil
+
+	event, err := repository.MemberRemovalAuditEvent(ctx, "account_member_removal.request", nil, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	s.member_removals[id] = created
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	// The request of an owner approves the removal of members who aren't owners.
+	if requester.Role != model.MemberOwner || member.Role == model.MemberOwner {
+		return &created, nil
+	}
+
+	return s.decideRemoval(ctx, created, removal.RequestedBy, true)
+}
+
+func (mr *MemberRepository) GetMemberRemoval(ctx context.Context, id uuid.UUID) (*model.MemberRemoval, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	removal, ok := s.member_removals[id]
+	if !ok {
+		return new(model.MemberRemoval), sql.ErrNoRows
+	}
+
+	return &removal, nil
+}
+
+func (mr *MemberRepository) GetMemberRemovals(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.MemberRemoval, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	removals := []model.MemberRemoval{}
+	for _, removal := range s.member_removals {
+		if removal.AccountId == account_id {
+			removals = append(removals, removal)
+		}
+	}
+
+	sort.Slice(removals, func(i, j int) bool {
+		if !removals[i].CreatedAt.Equal(removals[j].CreatedAt) {
+			return removals[i].CreatedAt.After(removals[j].CreatedAt)
+		}
+		return removals[i].Id.String() > removals[j].Id.String()
+	})
+
+	removals = paginate(removals, limit, offset)
+	return &removals, nil
+}
+
+func (mr *MemberRepository) DecideMemberRemoval(ctx context.Context, id uuid.UUID, owner_id uuid.UUID, approve bool) (*model.MemberRemoval, error) {
+	s := mr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	removal, ok := s.member_removals[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.decideRemoval(ctx, removal, owner_id, approve)
+}
+
+// decideRemoval records the decision of owner_id on removal and carries it out when approving.
+func (s *Store) decideRemoval(ctx context.Context, removal model.MemberRemoval, owner_id uuid.UUID, approve bool) (*model.MemberRemoval, error) {
+	decider := s.getMember(removal.AccountId, owner_id)
+	member := s.getMember(removal.AccountId, removal.UserId)
+	if err := repository.CheckRemovalDecision(&removal, decider, member, s.countOwners(removal.AccountId), approve); err != nil {
+		return nil, err
+	}
+
+	status, action := "rejected", "account_member_removal.reject"
+	if approve {
+		status, action = "approved", "account_member_removal.approve"
+	}
+
+	now := time.Now()
+	after := removal
+	after.Status = status
+	after.DecidedBy = &owner_id
+	after.DecidedAt = &now
+
+	event, err := repository.MemberRemovalAuditEvent(ctx, action, &removal, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.member_removals[after.Id] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	// The member may have left meanwhile through another removal.
+	if !approve || member == nil {
+		return &after, nil
+	}
+
+	delete(s.members[member.AccountId], member.UserId)
+	if event, err = repository.AccountMemberAuditEvent(ctx, "account.remove_member", member, nil); err != nil {
+		return nil, err
+	}
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	// Their handle can't go on paying into an account they left.
+	for _, handle := range s.handles {
+		if handle.UserId == member.UserId && handle.AccountId == member.AccountId {
+			if err = s.deleteHandle(ctx, handle); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// account.user_id goes to the oldest remaining owner, when it was the removed member.
+	account := s.accounts[member.AccountId]
+	if account.UserId != member.UserId {
+		return &after, nil
+	}
+
+	var next *model.AccountMember
+	for _, candidate := range s.members[member.AccountId] {
+		if candidate.Role != model.MemberOwner {
+			continue
+		}
+		if next == nil || candidate.CreatedAt.Before(next.CreatedAt) ||
+			(candidate.CreatedAt.Equal(next.CreatedAt) && candidate.UserId.String() < next.UserId.String()) {
+			next = &candidate
+		}
+	}
+
+	changed := account
+	changed.UserId = next.UserId
+	changed.UpdatedAt = now
+	if event, err = repository.AccountAuditEvent(ctx, "account.change_owner", &account, &changed); err != nil {
+		return nil, err
+	}
+
+	s.accounts[changed.Id] = changed
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
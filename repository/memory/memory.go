@@ -0,0 +1,148 @@
+/*
+Package memory is an in-memory implementation of the repository stores, meant for tests.
+
+It mirrors the Postgres backend: missing rows are reported with sql.ErrNoRows, foreign keys
+and unique constraints are enforced, amounts are rounded to the 2 decimal places of the
+DECIMAL(15, 2) columns, and every money movement is applied atomically. A single lock
+serializes all writes, which is stricter than the row locks taken by Postgres but gives the
+same guarantees to callers.
+*/
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	mu            sync.Mutex
+	users         map[uuid.UUID]model.User
+	user_emails   map[string]uuid.UUID
+	accounts      map[uuid.UUID]model.Account
+	transactions  map[uuid.UUID]model.Transaction
+	reversals     map[uuid.UUID]uuid.UUID
+	sessions      map[string]session
+	user_sessions map[string]map[string]struct{}
+	audit_events  []model.AuditEvent
+	api_keys      map[uuid.UUID]model.ApiKey
+	events        map[string][]model.Event
+	last_event_id eventId
+	// Closed and replaced whenever an event is published.
+	events_published chan struct{}
+
+	// Oldest first, like the ids of the outbox_event table.
+	outbox             []model.OutboxEvent
+	webhook_endpoints  map[uuid.UUID]model.WebhookEndpoint
+	webhook_deliveries map[uuid.UUID]webhookDelivery
+	webhook_attempts   map[uuid.UUID][]model.WebhookDeliveryAttempt
+
+	processor_charges map[string]model.ProcessorCharge
+	processor_events  map[string]struct{}
+
+	// Accounts without transactions have no head yet.
+	ledger_heads map[uuid.UUID]model.LedgerHead
+	// Oldest first.
+	ledger_checkpoints []model.LedgerCheckpoint
+
+	adjustments map[uuid.UUID]model.Adjustment
+	// Oldest first, by adjustment id.
+	adjustment_decisions map[uuid.UUID][]model.AdjustmentDecision
+
+	// By account id, then user id.
+	members         map[uuid.UUID]map[uuid.UUID]model.AccountMember
+	invitations     map[uuid.UUID]model.AccountInvitation
+	member_removals map[uuid.UUID]model.MemberRemoval
+
+	// By account id.
+	approval_policies map[uuid.UUID]model.ApprovalPolicy
+	payment_requests  map[uuid.UUID]model.PaymentRequest
+	// Oldest first, by payment request id.
+	payment_request_decisions map[uuid.UUID][]model.PaymentRequestDecision
+
+	payees map[uuid.UUID]model.Payee
+	// By handle.
+	handles map[string]model.Handle
+
+	// Serial of the last account number given out.
+	account_number int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:         map[uuid.UUID]model.User{},
+		user_emails:   map[string]uuid.UUID{},
+		accounts:      map[uuid.UUID]model.Account{},
+		transactions:  map[uuid.UUID]model.Transaction{},
+		reversals:     map[uuid.UUID]uuid.UUID{},
+		sessions:      map[string]session{},
+		user_sessions: map[string]map[string]struct{}{},
+		api_keys:      map[uuid.UUID]model.ApiKey{},
+		events:        map[string][]model.Event{},
+
+		events_published: make(chan struct{}),
+
+		webhook_endpoints:  map[uuid.UUID]model.WebhookEndpoint{},
+		webhook_deliveries: map[uuid.UUID]webhookDelivery{},
+		webhook_attempts:   map[uuid.UUID][]model.WebhookDeliveryAttempt{},
+
+		processor_charges: map[string]model.ProcessorCharge{},
+		processor_events:  map[string]struct{}{},
+
+		ledger_heads: map[uuid.UUID]model.LedgerHead{},
+
+		adjustments:          map[uuid.UUID]model.Adjustment{},
+		adjustment_decisions: map[uuid.UUID][]model.AdjustmentDecision{},
+
+		members:         map[uuid.UUID]map[uuid.UUID]model.AccountMember{},
+		invitations:     map[uuid.UUID]model.AccountInvitation{},
+		member_removals: map[uuid.UUID]model.MemberRemoval{},
+
+		approval_policies:         map[uuid.UUID]model.ApprovalPolicy{},
+		payment_requests:          map[uuid.UUID]model.PaymentRequest{},
+		payment_request_decisions: map[uuid.UUID][]model.PaymentRequestDecision{},
+
+		payees:  map[uuid.UUID]model.Payee{},
+		handles: map[string]model.Handle{},
+	}
+}
+
+// New returns repositories backed by a fresh, empty Store.
+func New() repository.Repositories {
+	return NewStore().Repositories()
+}
+
+// Repositories returns repositories backed by s.
+func (store *Store) Repositories() repository.Repositories {
+	return repository.Repositories{
+		UserRepository:           &UserRepository{store},
+		AccountRepository:        &AccountRepository{store},
+		TransactionRepository:    &TransactionRepository{store},
+		SessionRepository:        &SessionRepository{store},
+		AuditRepository:          &AuditRepository{store},
+		ApiKeyRepository:         &ApiKeyRepository{store},
+		EventRepository:          &EventRepository{store},
+		WebhookRepository:        &WebhookRepository{store},
+		ProcessorRepository:      &ProcessorRepository{store},
+		LedgerRepository:         &LedgerRepository{store},
+		AdjustmentRepository:     &AdjustmentRepository{store},
+		MemberRepository:         &MemberRepository{store},
+		PaymentRequestRepository: &PaymentRequestRepository{store},
+		PayeeRepository:          &PayeeRepository{store},
+		HandleRepository:         &HandleRepository{store},
+	}
+}
+
+// lock takes the store lock, unless ctx is already done: like a cancelled query, the call then fails without any effect.
+func (s *Store) lock(ctx context.Context) error {
+	s.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
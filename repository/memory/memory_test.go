@@ -0,0 +1,16 @@
+package memory_test
+
+import (
+	"broke-bank/repository"
+	"broke-bank/repository/memory"
+	"broke-bank/repository/repositorytest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repositories { return memory.New() })
+}
+
+func TestInvariants(t *testing.T) {
+	repositorytest.RunInvariants(t, memory.New(), repositorytest.DefaultInvariantConfig())
+}
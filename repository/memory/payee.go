@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+type PayeeRepository struct {
+	Store *Store
+}
+
+// nicknameTaken reports whether a payee of the user other than except has the nickname, ignoring case.
+func (s *Store) nicknameTaken(user_id uuid.UUID, nickname string, except uuid.UUID) bool {
+	for _, payee := range s.payees {
+		if payee.UserId == user_id && payee.Id != except && strings.EqualFold(payee.Nickname, nickname) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (pr *PayeeRepository) CreatePayee(ctx context.Context, payee model.Payee) (*model.Payee, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[payee.UserId]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := s.accounts[payee.AccountId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"payee\" violates foreign key constraint: account %s", payee.AccountId)
+	}
+	if payee.Nickname == "" || utf8.RuneCountInString(payee.Nickname) > 50 {
+		return nil, fmt.Errorf("new row for relation \"payee\" violates check constraint: nickname %q", payee.Nickname)
+	}
+
+	for _, existing := range s.payees {
+		if existing.UserId == payee.UserId && existing.AccountId == payee.AccountId {
+			return nil, repository.ErrPayeeExists
+		}
+	}
+	if s.nicknameTaken(payee.UserId, payee.Nickname, uuid.Nil) {
+		return nil, repository.ErrNicknameTaken
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := payee
+	created.Id = id
+	created.CreatedAt, created.UpdatedAt = now, now
+
+	event, err := repository.PayeeAuditEvent(ctx, "payee.create", nil, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	s.payees[created.Id] = created
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (pr *PayeeRepository) GetPayee(ctx context.Context, id uuid.UUID) (*model.Payee, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	payee, ok := s.payees[id]
+	if !ok {
+		return new(model.Payee), sql.ErrNoRows
+	}
+
+	return &payee, nil
+}
+
+func (pr *PayeeRepository) GetPayeeByAccount(ctx context.Context, user_id uuid.UUID, account_id uuid.UUID) (*model.Payee, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, payee := range s.payees {
+		if payee.UserId == user_id && payee.AccountId == account_id {
+			return &payee, nil
+		}
+	}
+
+	return new(model.Payee), sql.ErrNoRows
+}
+
+func (pr *PayeeRepository) GetUserPayees(ctx context.Context, user_id uuid.UUID, limit int, offset int) (*[]model.Payee, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	payees := []model.Payee{}
+	for _, payee := range s.payees {
+		if payee.UserId == user_id {
+			payees = append(payees, payee)
+		}
+	}
+
+	sort.Slice(payees, func(i, j int) bool {
+		left, right := strings.ToLower(payees[i].Nickname), strings.ToLower(payees[j].Nickname)
+		if left != right {
+			return left < right
+		}
+		return payees[i].Id.String() < payees[j].Id.String()
+	})
+
+	payees = paginate(payees, limit, offset)
+	return &payees, nil
+}
+
+func (pr *PayeeRepository) RenamePayee(ctx context.Context, id uuid.UUID, nickname string) (*model.Payee, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.payees[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if nickname == "" || utf8.RuneCountInString(nickname) > 50 {
+		return nil, fmt.Errorf("new row for relation \"payee\" violates check constraint: nickname %q", nickname)
+	}
+	if s.nicknameTaken(before.UserId, nickname, before.Id) {
+		return nil, repository.ErrNicknameTaken
+	}
+
+	after := before
+	after.Nickname, after.UpdatedAt = nickname, time.Now()
+
+	event, err := repository.PayeeAuditEvent(ctx, "payee.rename", &before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.payees[after.Id] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+func (pr *PayeeRepository) DeletePayee(ctx context.Context, id uuid.UUID) error {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.payees[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	event, err := repository.PayeeAuditEvent(ctx, "payee.delete", &before, nil)
+	if err != nil {
+		return err
+	}
+
+	delete(s.payees, id)
+	return s.appendAuditEvent(event)
+}
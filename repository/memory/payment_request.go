@@ -0,0 +1,439 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PaymentRequestRepository struct {
+	Store *Store
+}
+
+func (pr *PaymentRequestRepository) GetApprovalPolicy(ctx context.Context, account_id uuid.UUID) (*model.ApprovalPolicy, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	policy, ok := s.approval_policies[account_id]
+	if !ok {
+		return new(model.ApprovalPolicy), sql.ErrNoRows
+	}
+
+	return &policy, nil
+}
+
+func (pr *PaymentRequestRepository) SetApprovalPolicy(ctx context.Context, policy model.ApprovalPolicy) (*model.ApprovalPolicy, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	threshold, err := toDecimal(policy.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.accounts[policy.AccountId]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"account_approval_policy\" violates foreign key constraint: account %s", policy.AccountId)
+	}
+	if _, ok := s.users[policy.UpdatedBy]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"account_approval_policy\" violates foreign key constraint: user %s", policy.UpdatedBy)
+	}
+	if threshold.IsNegative() || policy.RequiredApprovals <= 0 {
+		return nil, fmt.Errorf("new row for relation \"account_approval_policy\" violates check constraint: threshold %s, required approvals %d", threshold, policy.RequiredApprovals)
+	}
+
+	now := time.Now()
+	after := policy
+	after.Threshold = threshold
+	after.CreatedAt, after.UpdatedAt = now, now
+
+	var before *model.ApprovalPolicy
+	if existing, ok := s.approval_policies[policy.AccountId]; ok {
+		before = &existing
+		after.CreatedAt = existing.CreatedAt
+	}
+
+	event, err := repository.ApprovalPolicyAuditEvent(ctx, "account.set_approval_policy", after.UpdatedBy, before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.approval_policies[after.AccountId] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+func (pr *PaymentRequestRepository) DeleteApprovalPolicy(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) error {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.approval_policies[account_id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	event, err := repository.ApprovalPolicyAuditEvent(ctx, "account.delete_approval_policy", user_id, &before, nil)
+	if err != nil {
+		return err
+	}
+
+	delete(s.approval_policies, account_id)
+	return s.appendAuditEvent(event)
+}
+
+func (pr *PaymentRequestRepository) CreatePaymentRequest(ctx context.Context, request model.PaymentRequest) (*model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	amount, err := toDecimal(request.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if request.Kind == "" {
+		request.Kind = "transfer"
+	}
+	switch request.Kind {
+	case "transfer", "withdrawal", "closure":
+	default:
+		return nil, fmt.Errorf("invalid input value for enum payment_request_kind: %q", request.Kind)
+	}
+	if (request.ToAccountId == nil) != (request.Kind == "withdrawal") {
+		return nil, fmt.Errorf("new row for relation \"payment_request\" violates check constraint \"payment_request_to_account_id_check\"")
+	}
+	account_ids := []uuid.UUID{request.FromAccountId}
+	if request.ToAccountId != nil {
+		account_ids = append(account_ids, *request.ToAccountId)
+	}
+	for _, account_id := range account_ids {
+		if _, ok := s.accounts[account_id]; !ok {
+			return nil, fmt.Errorf("insert or update on table \"payment_request\" violates foreign key constraint: account %s", account_id)
+		}
+	}
+	if _, ok := s.users[request.RequestedBy]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"payment_request\" violates foreign key constraint: user %s", request.RequestedBy)
+	}
+	if !amount.IsPositive() || request.RequiredApprovals <= 0 {
+		return nil, fmt.Errorf("new row for relation \"payment_request\" violates check constraint: amount %s, required approvals %d", amount, request.RequiredApprovals)
+	}
+	for _, existing := range s.payment_requests {
+		if existing.TransactionId == request.TransactionId {
+			return nil, fmt.Errorf("duplicate key value violates unique constraint \"payment_request_transaction_id_key\"")
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := request
+	created.Id = id
+	created.Amount = amount
+	created.Status = "pending"
+	created.FailureReason = nil
+	created.CreatedAt, created.UpdatedAt = now, now
+
+	event, err := repository.PaymentRequestAuditEvent(ctx, "payment_request.create", nil, nil, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	s.payment_requests[created.Id] = created
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequest(ctx context.Context, id uuid.UUID) (*model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	request, ok := s.payment_requests[id]
+	if !ok {
+		return new(model.PaymentRequest), sql.ErrNoRows
+	}
+
+	return &request, nil
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequestByTransaction(ctx context.Context, transaction_id uuid.UUID) (*model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	for _, request := range s.payment_requests {
+		if request.TransactionId == transaction_id {
+			return &request, nil
+		}
+	}
+
+	return new(model.PaymentRequest), sql.ErrNoRows
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequests(ctx context.Context, account_id uuid.UUID, status string, limit int, offset int) (*[]model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	requests := []model.PaymentRequest{}
+	for _, request := range s.payment_requests {
+		if request.FromAccountId != account_id || (status != "" && request.Status != status) {
+			continue
+		}
+		requests = append(requests, request)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].CreatedAt.Equal(requests[j].CreatedAt) {
+			return requests[i].CreatedAt.After(requests[j].CreatedAt)
+		}
+		return requests[i].Id.String() > requests[j].Id.String()
+	})
+
+	requests = paginate(requests, limit, offset)
+	return &requests, nil
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequestDecisions(ctx context.Context, request_id uuid.UUID) (*[]model.PaymentRequestDecision, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	decisions := append([]model.PaymentRequestDecision{}, s.payment_request_decisions[request_id]...)
+	return &decisions, nil
+}
+
+func (pr *PaymentRequestRepository) DecidePaymentRequest(ctx context.Context, decision model.PaymentRequestDecision) (*model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.payment_requests[decision.PaymentRequestId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	switch {
+	case before.Status != "pending":
+		return nil, repository.ErrRequestDecided
+	case !time.Now().Before(before.ExpiresAt):
+		return nil, repository.ErrRequestExpired
+	case before.RequestedBy == decision.UserId:
+		return nil, repository.ErrOwnRequest
+	}
+
+	member := s.getMember(before.FromAccountId, decision.UserId)
+	if member == nil || member.Role != model.MemberOwner {
+		return nil, repository.ErrNotOwner
+	}
+
+	approvals := 0
+	for _, earlier := range s.payment_request_decisions[before.Id] {
+		if earlier.UserId == decision.UserId {
+			return nil, repository.ErrRequestTwice
+		}
+		if earlier.Decision == "approved" {
+			approvals++
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	recorded := decision
+	recorded.Id = id
+	recorded.PaymentRequestId = before.Id
+	recorded.CreatedAt = now
+
+	after := before
+	after.UpdatedAt = now
+	action := "payment_request.approve"
+	switch recorded.Decision {
+	case "rejected":
+		after.Status = "rejected"
+		action = "payment_request.reject"
+	case "approved":
+		if approvals+1 >= before.RequiredApprovals {
+			after.Status = "approved"
+		}
+	default:
+		return nil, fmt.Errorf("invalid input value for enum payment_request_decision: %q", recorded.Decision)
+	}
+
+	event, err := repository.PaymentRequestAuditEvent(ctx, action, &recorded, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.payment_request_decisions[before.Id] = append(s.payment_request_decisions[before.Id], recorded)
+	s.payment_requests[after.Id] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+func (pr *PaymentRequestRepository) CompletePaymentRequest(ctx context.Context, id uuid.UUID, failure_reason *string) (*model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	before, ok := s.payment_requests[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if before.Status != "approved" {
+		return nil, repository.ErrRequestDecided
+	}
+
+	after := before
+	after.Status, after.FailureReason, after.UpdatedAt = "executed", nil, time.Now()
+	action := "payment_request.execute"
+	if failure_reason != nil {
+		reason := *failure_reason
+		after.Status, after.FailureReason = "failed", &reason
+		action = "payment_request.fail"
+	}
+
+	event, err := repository.PaymentRequestAuditEvent(ctx, action, nil, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	s.payment_requests[after.Id] = after
+	if err = s.appendAuditEvent(event); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+// failPaymentRequests fails the pending requests moving money out of or into account_id. Must be called with the store locked.
+func (s *Store) failPaymentRequests(ctx context.Context, account_id uuid.UUID, reason string) error {
+	pending := []model.PaymentRequest{}
+	for _, request := range s.payment_requests {
+		if request.Status == "pending" && (request.FromAccountId == account_id || (request.ToAccountId != nil && *request.ToAccountId == account_id)) {
+			pending = append(pending, request)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Id.String() < pending[j].Id.String() })
+
+	now := time.Now()
+	for i := range pending {
+		failure_reason := reason
+		after := pending[i]
+		after.Status, after.FailureReason, after.UpdatedAt = "failed", &failure_reason, now
+
+		event, err := repository.PaymentRequestAuditEvent(ctx, "payment_request.fail", nil, &pending[i], &after)
+		if err != nil {
+			return err
+		}
+
+		s.payment_requests[after.Id] = after
+		if err = s.appendAuditEvent(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pr *PaymentRequestRepository) ExpirePaymentRequests(ctx context.Context) (*[]model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	expired := []model.PaymentRequest{}
+	now := time.Now()
+	for _, request := range s.payment_requests {
+		if request.Status == "pending" && !now.Before(request.ExpiresAt) {
+			expired = append(expired, request)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Id.String() < expired[j].Id.String() })
+
+	requests := []model.PaymentRequest{}
+	for i := range expired {
+		after := expired[i]
+		after.Status, after.UpdatedAt = "expired", now
+
+		event, err := repository.PaymentRequestAuditEvent(ctx, "payment_request.expire", nil, &expired[i], &after)
+		if err != nil {
+			return nil, err
+		}
+
+		s.payment_requests[after.Id] = after
+		if err = s.appendAuditEvent(event); err != nil {
+			return nil, err
+		}
+		requests = append(requests, after)
+	}
+
+	return &requests, nil
+}
+
+func (pr *PaymentRequestRepository) GetApprovedPaymentRequests(ctx context.Context, limit int) (*[]model.PaymentRequest, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	requests := []model.PaymentRequest{}
+	for _, request := range s.payment_requests {
+		if request.Status == "approved" {
+			requests = append(requests, request)
+		}
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].UpdatedAt.Equal(requests[j].UpdatedAt) {
+			return requests[i].UpdatedAt.Before(requests[j].UpdatedAt)
+		}
+		return requests[i].Id.String() < requests[j].Id.String()
+	})
+
+	requests = paginate(requests, limit, 0)
+	return &requests, nil
+}
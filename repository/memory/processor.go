@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type ProcessorRepository struct {
+	Store *Store
+}
+
+func (pr *ProcessorRepository) GetProcessorCharge(ctx context.Context, id string) (*model.ProcessorCharge, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	charge, ok := s.processor_charges[id]
+	if !ok {
+		return new(model.ProcessorCharge), sql.ErrNoRows
+	}
+
+	return &charge, nil
+}
+
+func (pr *ProcessorRepository) ApplyChargeEvent(ctx context.Context, event_id string, event_type string, charge model.ProcessorCharge, transaction_id uuid.UUID) (*model.ProcessorCharge, bool, error) {
+	s := pr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer s.mu.Unlock()
+
+	amount, err := toDecimal(charge.Amount)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current, ok := s.processor_charges[charge.Id]
+	if !ok {
+		if _, ok := s.accounts[charge.AccountId]; !ok {
+			return nil, false, fmt.Errorf("insert or update on table \"processor_charge\" violates foreign key constraint: account %s", charge.AccountId)
+		}
+		if !amount.IsPositive() {
+			return nil, false, fmt.Errorf("new row for relation \"processor_charge\" violates check constraint: amount %s", amount)
+		}
+
+		now := time.Now()
+		current = model.ProcessorCharge{Id: charge.Id, AccountId: charge.AccountId, Amount: amount, Status: "pending", CreatedAt: now, UpdatedAt: now}
+	}
+
+	if current.AccountId != charge.AccountId || !current.Amount.Equal(amount) {
+		return &current, false, repository.ErrChargeMismatch
+	}
+
+	if _, ok := s.processor_events[event_id]; ok {
+		return &current, false, repository.ErrEventReplayed
+	}
+
+	changed, err := repository.ChargeTransition(current.Status, charge.Status)
+	if err != nil {
+		return &current, false, err
+	}
+
+	status, failure_message := charge.Status, charge.FailureMessage
+	if changed && charge.Status == "succeeded" {
+		account := s.accounts[charge.AccountId]
+		err = repository.CheckAccountStatus(account.Status, account.FrozenUntil, false)
+		if errors.Is(err, repository.ErrAccountClosed) {
+			refund := repository.ChargeRefundMessage
+			status, failure_message = "failed", &refund
+		} else if err != nil {
+			return &current, false, err
+		}
+	}
+	if changed && status == "succeeded" {
+		err = s.post(
+			ctx,
+			model.Transaction{Id: transaction_id, Type: "deposit", ToAccountId: &charge.AccountId, Amount: amount},
+			map[uuid.UUID]decimal.Decimal{charge.AccountId: amount},
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		current.TransactionId = &transaction_id
+	}
+	if changed {
+		current.Status = status
+		current.FailureMessage = failure_message
+		current.UpdatedAt = time.Now()
+	}
+
+	s.processor_charges[charge.Id] = current
+	s.processor_events[event_id] = struct{}{}
+
+	return &current, changed, nil
+}
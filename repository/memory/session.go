@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"broke-bank/repository"
+	"context"
+	"fmt"
+	"time"
+)
+
+type session struct {
+	user_id    string
+	expires_at time.Time
+}
+
+type SessionRepository struct {
+	Store *Store
+}
+
+func (sr *SessionRepository) CreateSession(ctx context.Context, session_id string, user_id string) error {
+	s := sr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if existing, ok := s.sessions[session_id]; ok && time.Now().Before(existing.expires_at) {
+		return fmt.Errorf("session %s already exists", session_id)
+	}
+
+	s.sessions[session_id] = session{user_id: user_id, expires_at: time.Now().Add(repository.SessionTTL)}
+	if _, ok := s.user_sessions[user_id]; !ok {
+		s.user_sessions[user_id] = map[string]struct{}{}
+	}
+	s.user_sessions[user_id][session_id] = struct{}{}
+
+	return nil
+}
+
+func (sr *SessionRepository) GetSessionUserId(ctx context.Context, session_id string) (string, error) {
+	s := sr.Store
+	if err := s.lock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+
+	existing, ok := s.sessions[session_id]
+	if !ok || !time.Now().Before(existing.expires_at) {
+		return "", repository.ErrSessionNotFound
+	}
+
+	return existing.user_id, nil
+}
+
+func (sr *SessionRepository) RevokeSession(ctx context.Context, session_id string) error {
+	s := sr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	existing, ok := s.sessions[session_id]
+	if !ok || !time.Now().Before(existing.expires_at) {
+		return repository.ErrSessionNotFound
+	}
+
+	delete(s.sessions, session_id)
+	delete(s.user_sessions[existing.user_id], session_id)
+
+	return nil
+}
+
+func (sr *SessionRepository) RevokeUserSessions(ctx context.Context, user_id string) (int, error) {
+	s := sr.Store
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for session_id := range s.user_sessions[user_id] {
+		if existing, ok := s.sessions[session_id]; ok && time.Now().Before(existing.expires_at) {
+			revoked++
+		}
+		delete(s.sessions, session_id)
+	}
+	delete(s.user_sessions, user_id)
+
+	return revoked, nil
+}
@@ -0,0 +1,373 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// DECIMAL(15, 2) holds at most 13 digits before the decimal point.
+var max_numeric = decimal.New(1, 13)
+
+var ErrNumericOverflow = errors.New("numeric field overflow")
+
+type TransactionRepository struct {
+	Store *Store
+}
+
+// toDecimal rounds like a DECIMAL(15, 2) column and rejects values it couldn't hold.
+func toDecimal(value decimal.Decimal) (decimal.Decimal, error) {
+	value = value.Round(2)
+	if value.Abs().GreaterThanOrEqual(max_numeric) {
+		return value, ErrNumericOverflow
+	}
+
+	return value, nil
+}
+
+// lookupAccount must be called with the store locked.
+func (s *Store) lookupAccount(acc_id string) (model.Account, error) {
+	id, err := uuid.Parse(acc_id)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return model.Account{}, sql.ErrNoRows
+	}
+
+	return account, nil
+}
+
+/*
+post applies balance deltas and records the transaction along with its outbox events and
+audit event, validating everything first so that a failure leaves the store untouched, just like a rolled
+back database transaction.
+Must be called with the store locked.
+*/
+func (s *Store) post(ctx context.Context, transaction model.Transaction, deltas map[uuid.UUID]decimal.Decimal) error {
+	if _, ok := s.transactions[transaction.Id]; ok {
+		return fmt.Errorf("duplicate key value violates unique constraint \"transaction_pkey\": %s", transaction.Id)
+	}
+
+	amount, err := toDecimal(transaction.Amount)
+	if err != nil {
+		return err
+	}
+	transaction.Amount = amount
+
+	balances := map[uuid.UUID]decimal.Decimal{}
+	for id, delta := range deltas {
+		balance, err := toDecimal(s.accounts[id].Balance.Add(delta.Round(2)))
+		if err != nil {
+			return err
+		}
+		balances[id] = balance
+	}
+
+	before := map[uuid.UUID]decimal.Decimal{}
+	for id := range balances {
+		before[id] = s.accounts[id].Balance
+	}
+
+	owner_account_id := transaction.FromAccountId
+	if owner_account_id == nil {
+		owner_account_id = transaction.ToAccountId
+	}
+	owner_id := s.accounts[*owner_account_id].UserId
+
+	event, err := repository.MovementAuditEvent(ctx, transaction, &owner_id, before, balances)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, balance := range balances {
+		account := s.accounts[id]
+		account.Balance = balance
+		account.UpdatedAt = now
+		s.accounts[id] = account
+	}
+
+	transaction.DateIssued = now
+	s.chainTransaction(&transaction)
+	s.transactions[transaction.Id] = transaction
+	if transaction.ReversalOf != nil {
+		s.reversals[*transaction.ReversalOf] = transaction.Id
+	}
+
+	if err = s.writeMovementOutbox(transaction); err != nil {
+		return err
+	}
+
+	return s.appendAuditEvent(event)
+}
+
+func (tr *TransactionRepository) GetTransaction(ctx context.Context, transaction_id string) (*model.Transaction, error) {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, err := uuid.Parse(transaction_id)
+	if err != nil {
+		return new(model.Transaction), err
+	}
+
+	transaction, ok := s.transactions[id]
+	if !ok {
+		return new(model.Transaction), sql.ErrNoRows
+	}
+
+	return &transaction, nil
+}
+
+func (tr *TransactionRepository) GetReversal(ctx context.Context, transaction_id string) (*model.Transaction, error) {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, err := uuid.Parse(transaction_id)
+	if err != nil {
+		return new(model.Transaction), err
+	}
+
+	reversal_id, ok := s.reversals[id]
+	if !ok {
+		return new(model.Transaction), sql.ErrNoRows
+	}
+
+	reversal := s.transactions[reversal_id]
+	return &reversal, nil
+}
+
+func (tr *TransactionRepository) GetAccountTransactions(ctx context.Context, account_id string, limit int, offset int) (*[]model.Transaction, error) {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, err := uuid.Parse(account_id)
+	if err != nil {
+		return new([]model.Transaction), err
+	}
+
+	transactions := []model.Transaction{}
+	for _, transaction := range s.transactions {
+		if (transaction.FromAccountId != nil && *transaction.FromAccountId == id) || (transaction.ToAccountId != nil && *transaction.ToAccountId == id) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].DateIssued.Equal(transactions[j].DateIssued) {
+			return transactions[i].DateIssued.After(transactions[j].DateIssued)
+		}
+		return transactions[i].Id.String() > transactions[j].Id.String()
+	})
+
+	transactions = paginate(transactions, limit, offset)
+	return &transactions, nil
+}
+
+func (tr *TransactionRepository) DepositTransaction(ctx context.Context, transaction_id uuid.UUID, to_account_id string, amount decimal.Decimal) error {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	to_account, err := s.lookupAccount(to_account_id)
+	if err != nil {
+		return err
+	}
+
+	if err = repository.CheckAccountStatus(to_account.Status, to_account.FrozenUntil, false); err != nil {
+		return err
+	}
+
+	return s.post(
+		ctx,
+		model.Transaction{Id: transaction_id, Type: "deposit", ToAccountId: &to_account.Id, Amount: amount},
+		map[uuid.UUID]decimal.Decimal{to_account.Id: amount},
+	)
+}
+
+func (tr *TransactionRepository) WithdrawalTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, amount decimal.Decimal) error {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	from_account, err := s.lookupAccount(from_account_id)
+	if err != nil {
+		return err
+	}
+
+	if err = repository.CheckAccountStatus(from_account.Status, from_account.FrozenUntil, true); err != nil {
+		return err
+	}
+
+	if from_account.Balance.LessThan(amount) {
+		return repository.ErrInsufficientBalance
+	}
+
+	return s.post(
+		ctx,
+		model.Transaction{Id: transaction_id, Type: "withdrawal", FromAccountId: &from_account.Id, Amount: amount},
+		map[uuid.UUID]decimal.Decimal{from_account.Id: amount.Neg()},
+	)
+}
+
+func (tr *TransactionRepository) TransferTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, to_account_id string, amount decimal.Decimal) error {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	from_account, err := s.lookupAccount(from_account_id)
+	if err != nil {
+		return err
+	}
+	to_account, err := s.lookupAccount(to_account_id)
+	if err != nil {
+		return err
+	}
+	if from_account.Id == to_account.Id {
+		return repository.ErrSameAccount
+	}
+
+	if err = repository.CheckAccountStatus(from_account.Status, from_account.FrozenUntil, true); err != nil {
+		return err
+	}
+	if err = repository.CheckAccountStatus(to_account.Status, to_account.FrozenUntil, false); err != nil {
+		return err
+	}
+
+	if from_account.Balance.LessThan(amount) {
+		return repository.ErrInsufficientBalance
+	}
+
+	return s.post(
+		ctx,
+		model.Transaction{Id: transaction_id, Type: "transfer", FromAccountId: &from_account.Id, ToAccountId: &to_account.Id, Amount: amount},
+		map[uuid.UUID]decimal.Decimal{from_account.Id: amount.Neg(), to_account.Id: amount},
+	)
+}
+
+func (tr *TransactionRepository) ReverseTransaction(ctx context.Context, reversal_id uuid.UUID, original_id string) (*model.Transaction, error) {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, err := uuid.Parse(original_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reverse(ctx, reversal_id, id)
+}
+
+// reverse posts the reversal reversal_id of original_id, see ReverseTransaction. Must be called with the store locked.
+func (s *Store) reverse(ctx context.Context, reversal_id uuid.UUID, original_id uuid.UUID) (*model.Transaction, error) {
+	original, ok := s.transactions[original_id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if original.ReversalOf != nil {
+		return nil, repository.ErrReversalOfReversal
+	}
+	if _, ok := s.reversals[original_id]; ok {
+		return nil, repository.ErrAlreadyReversed
+	}
+
+	reversal := model.Transaction{
+		Id:            reversal_id,
+		Type:          original.Type,
+		FromAccountId: original.ToAccountId,
+		ToAccountId:   original.FromAccountId,
+		Amount:        original.Amount,
+		ReversalOf:    &original.Id,
+	}
+	switch original.Type {
+	case "deposit":
+		reversal.Type = "withdrawal"
+	case "withdrawal":
+		reversal.Type = "deposit"
+	}
+	if reversal.FromAccountId != nil && reversal.ToAccountId != nil && *reversal.FromAccountId == *reversal.ToAccountId {
+		return nil, repository.ErrSameAccount
+	}
+
+	deltas := map[uuid.UUID]decimal.Decimal{}
+	if reversal.FromAccountId != nil {
+		from_account := s.accounts[*reversal.FromAccountId]
+		if err := repository.CheckAccountStatus(from_account.Status, from_account.FrozenUntil, true); err != nil {
+			return nil, err
+		}
+		if from_account.Balance.LessThan(reversal.Amount) {
+			return nil, repository.ErrInsufficientBalance
+		}
+		deltas[*reversal.FromAccountId] = reversal.Amount.Neg()
+	}
+	if reversal.ToAccountId != nil {
+		to_account := s.accounts[*reversal.ToAccountId]
+		if err := repository.CheckAccountStatus(to_account.Status, to_account.FrozenUntil, false); err != nil {
+			return nil, err
+		}
+		deltas[*reversal.ToAccountId] = reversal.Amount
+	}
+
+	if err := s.post(ctx, reversal, deltas); err != nil {
+		return nil, err
+	}
+
+	reversal = s.transactions[reversal_id]
+	return &reversal, nil
+}
+
+func (tr *TransactionRepository) Reconcile(ctx context.Context) (*[]repository.AccountReconciliation, error) {
+	s := tr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	expected := map[uuid.UUID]decimal.Decimal{}
+	for _, transaction := range s.transactions {
+		if transaction.ToAccountId != nil {
+			expected[*transaction.ToAccountId] = expected[*transaction.ToAccountId].Add(transaction.Amount)
+		}
+		if transaction.FromAccountId != nil {
+			expected[*transaction.FromAccountId] = expected[*transaction.FromAccountId].Sub(transaction.Amount)
+		}
+	}
+
+	mismatches := []repository.AccountReconciliation{}
+	for id, account := range s.accounts {
+		if !account.Balance.Equal(expected[id]) {
+			mismatches = append(mismatches, repository.AccountReconciliation{Id: id, Balance: account.Balance, ExpectedBalance: expected[id]})
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Id.String() < mismatches[j].Id.String() })
+
+	return &mismatches, nil
+}
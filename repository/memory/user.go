@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserRepository struct {
+	Store *Store
+}
+
+func (ur *UserRepository) CreateUser(ctx context.Context, email string, password string) error {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.user_emails[email]; ok {
+		return fmt.Errorf("duplicate key value violates unique constraint: email %q already exists", email)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user := model.User{Id: id, Email: email, EncryptedPassword: password, Role: model.RoleCustomer, CreatedAt: now, UpdatedAt: now}
+	event, err := repository.UserAuditEvent(ctx, "user.register", nil, &user)
+	if err != nil {
+		return err
+	}
+
+	s.users[id] = user
+	s.user_emails[email] = id
+
+	return s.appendAuditEvent(event)
+}
+
+func (ur *UserRepository) GetUserById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return new(model.User), sql.ErrNoRows
+	}
+
+	return &user, nil
+}
+
+func (ur *UserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	id, ok := s.user_emails[email]
+	if !ok {
+		return new(model.User), sql.ErrNoRows
+	}
+
+	user := s.users[id]
+	return &user, nil
+}
+
+func (ur *UserRepository) DisableUser(ctx context.Context, id uuid.UUID) error {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok || user.DisabledAt != nil {
+		return nil
+	}
+
+	before := user
+	now := time.Now()
+	user.DisabledAt = &now
+	user.UpdatedAt = now
+
+	event, err := repository.UserAuditEvent(ctx, "user.disable", &before, &user)
+	if err != nil {
+		return err
+	}
+	s.users[id] = user
+
+	return s.appendAuditEvent(event)
+}
+
+func (ur *UserRepository) SetUserRole(ctx context.Context, id uuid.UUID, role string) error {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if !slices.Contains(model.Roles, role) {
+		return fmt.Errorf("invalid input value for enum user_role: %q", role)
+	}
+
+	before := user
+	user.Role = role
+	user.UpdatedAt = time.Now()
+
+	event, err := repository.UserAuditEvent(ctx, "user.set_role", &before, &user)
+	if err != nil {
+		return err
+	}
+	s.users[id] = user
+
+	return s.appendAuditEvent(event)
+}
+
+func (ur *UserRepository) SearchUsers(ctx context.Context, query string, limit int, offset int) (*[]model.User, error) {
+	s := ur.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	users := []model.User{}
+	for _, user := range s.users {
+		if user.Id.String() == query || strings.Contains(strings.ToLower(user.Email), query) {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if a, b := strings.ToLower(users[i].Email), strings.ToLower(users[j].Email); a != b {
+			return a < b
+		}
+		return users[i].Id.String() < users[j].Id.String()
+	})
+
+	users = paginate(users, limit, offset)
+	return &users, nil
+}
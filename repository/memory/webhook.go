@@ -0,0 +1,371 @@
+package memory
+
+import (
+	"broke-bank/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	Store *Store
+}
+
+// webhookDelivery is a delivery row, the event fields of model.WebhookDelivery are joined when reading.
+type webhookDelivery struct {
+	Id            uuid.UUID
+	EndpointId    uuid.UUID
+	EventId       uuid.UUID
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// writeOutboxEvent must be called with the store locked, along with the change the event describes.
+func (s *Store) writeOutboxEvent(user_id uuid.UUID, event_type string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	s.outbox = append(s.outbox, model.OutboxEvent{Id: id, UserId: user_id, Type: event_type, Data: types.JSONText(raw), CreatedAt: time.Now()})
+	return nil
+}
+
+// writeMovementOutbox writes the same events as the Postgres writeMovementOutbox. Must be called with the store locked.
+func (s *Store) writeMovementOutbox(transaction model.Transaction) error {
+	accounts := []model.Account{}
+	members := []uuid.UUID{}
+	for _, account_id := range []*uuid.UUID{transaction.FromAccountId, transaction.ToAccountId} {
+		if account_id == nil {
+			continue
+		}
+
+		accounts = append(accounts, s.accounts[*account_id])
+		for _, member := range s.memberIds(*account_id) {
+			if !slices.Contains(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+
+	for _, member := range members {
+		err := s.writeOutboxEvent(member, "transaction.created", map[string]any{
+			"id":              transaction.Id,
+			"type":            transaction.Type,
+			"amount":          transaction.Amount.StringFixed(2),
+			"from_account_id": transaction.FromAccountId,
+			"to_account_id":   transaction.ToAccountId,
+			"issued_at":       transaction.DateIssued,
+			"reversal_of":     transaction.ReversalOf,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, account := range accounts {
+		for _, member := range s.memberIds(account.Id) {
+			err := s.writeOutboxEvent(member, "account.balance_changed", map[string]any{
+				"account_id":     account.Id,
+				"balance":        account.Balance.StringFixed(2),
+				"transaction_id": transaction.Id,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (wr *WebhookRepository) CreateWebhookEndpoint(ctx context.Context, user_id uuid.UUID, url string, secret string, event_types []string) (*model.WebhookEndpoint, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user_id]; !ok {
+		return nil, fmt.Errorf("insert or update on table \"webhook_endpoint\" violates foreign key constraint: user %s", user_id)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := model.WebhookEndpoint{Id: id, UserId: user_id, Url: url, Secret: secret, EventTypes: pq.StringArray(append([]string{}, event_types...)), CreatedAt: time.Now()}
+	s.webhook_endpoints[id] = endpoint
+
+	return &endpoint, nil
+}
+
+func (wr *WebhookRepository) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (*model.WebhookEndpoint, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	endpoint, ok := s.webhook_endpoints[id]
+	if !ok || endpoint.DeletedAt != nil {
+		return new(model.WebhookEndpoint), sql.ErrNoRows
+	}
+
+	return &endpoint, nil
+}
+
+func (wr *WebhookRepository) GetUserWebhookEndpoints(ctx context.Context, user_id uuid.UUID) (*[]model.WebhookEndpoint, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	endpoints := []model.WebhookEndpoint{}
+	for _, endpoint := range s.webhook_endpoints {
+		if endpoint.UserId == user_id && endpoint.DeletedAt == nil {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if !endpoints[i].CreatedAt.Equal(endpoints[j].CreatedAt) {
+			return endpoints[i].CreatedAt.After(endpoints[j].CreatedAt)
+		}
+		return endpoints[i].Id.String() > endpoints[j].Id.String()
+	})
+
+	return &endpoints, nil
+}
+
+func (wr *WebhookRepository) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	endpoint, ok := s.webhook_endpoints[id]
+	if !ok || endpoint.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	endpoint.DeletedAt = &now
+	s.webhook_endpoints[id] = endpoint
+
+	return nil
+}
+
+func (wr *WebhookRepository) DispatchOutboxEvents(ctx context.Context, limit int) (int, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	dispatched := 0
+	now := time.Now()
+	for i := range s.outbox {
+		event := &s.outbox[i]
+		if event.DispatchedAt != nil {
+			continue
+		}
+		if dispatched == limit {
+			break
+		}
+
+		for _, endpoint := range s.webhook_endpoints {
+			if endpoint.UserId != event.UserId || endpoint.DeletedAt != nil {
+				continue
+			}
+			if len(endpoint.EventTypes) > 0 && !slices.Contains(endpoint.EventTypes, event.Type) {
+				continue
+			}
+
+			id, err := uuid.NewV7()
+			if err != nil {
+				return dispatched, err
+			}
+			s.webhook_deliveries[id] = webhookDelivery{Id: id, EndpointId: endpoint.Id, EventId: event.Id, Status: "pending", NextAttemptAt: now, CreatedAt: now, UpdatedAt: now}
+		}
+
+		event.DispatchedAt = &now
+		dispatched++
+	}
+
+	return dispatched, nil
+}
+
+// deliveryModel joins a delivery with its event. Must be called with the store locked.
+func (s *Store) deliveryModel(delivery webhookDelivery) model.WebhookDelivery {
+	result := model.WebhookDelivery{
+		Id:            delivery.Id,
+		EndpointId:    delivery.EndpointId,
+		EventId:       delivery.EventId,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreatedAt:     delivery.CreatedAt,
+		UpdatedAt:     delivery.UpdatedAt,
+	}
+
+	for _, event := range s.outbox {
+		if event.Id == delivery.EventId {
+			result.EventType, result.EventData, result.EventCreatedAt = event.Type, event.Data, event.CreatedAt
+		}
+	}
+
+	return result
+}
+
+func (wr *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]model.WebhookDelivery, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	due := []webhookDelivery{}
+	for _, delivery := range s.webhook_deliveries {
+		if delivery.Status == "pending" && !delivery.NextAttemptAt.After(now) && s.webhook_endpoints[delivery.EndpointId].DeletedAt == nil {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	due = paginate(due, limit, 0)
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].CreatedAt.Equal(due[j].CreatedAt) {
+			return due[i].CreatedAt.Before(due[j].CreatedAt)
+		}
+		return due[i].Id.String() < due[j].Id.String()
+	})
+
+	deliveries := []model.WebhookDelivery{}
+	for _, delivery := range due {
+		delivery.NextAttemptAt, delivery.UpdatedAt = now.Add(lease), now
+		s.webhook_deliveries[delivery.Id] = delivery
+		deliveries = append(deliveries, s.deliveryModel(delivery))
+	}
+
+	return &deliveries, nil
+}
+
+func (wr *WebhookRepository) RecordDeliveryAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, next_attempt_at time.Time) error {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhook_deliveries[attempt.DeliveryId]
+	if !ok {
+		return fmt.Errorf("insert or update on table \"webhook_delivery_attempt\" violates foreign key constraint: delivery %s", attempt.DeliveryId)
+	}
+	if status != "pending" && status != "succeeded" && status != "dead" {
+		return fmt.Errorf("new row for relation \"webhook_delivery\" violates check constraint: status %q", status)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	attempt.Id, attempt.AttemptedAt = id, time.Now()
+	s.webhook_attempts[delivery.Id] = append(s.webhook_attempts[delivery.Id], attempt)
+
+	delivery.Status, delivery.NextAttemptAt, delivery.UpdatedAt = status, next_attempt_at, time.Now()
+	delivery.Attempts++
+	s.webhook_deliveries[delivery.Id] = delivery
+
+	return nil
+}
+
+func (wr *WebhookRepository) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhook_deliveries[id]
+	if !ok {
+		return new(model.WebhookDelivery), sql.ErrNoRows
+	}
+
+	result := s.deliveryModel(delivery)
+	return &result, nil
+}
+
+func (wr *WebhookRepository) GetEndpointDeliveries(ctx context.Context, endpoint_id uuid.UUID, limit int, offset int) (*[]model.WebhookDelivery, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	deliveries := []model.WebhookDelivery{}
+	for _, delivery := range s.webhook_deliveries {
+		if delivery.EndpointId == endpoint_id {
+			deliveries = append(deliveries, s.deliveryModel(delivery))
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].Id.String() > deliveries[j].Id.String()
+	})
+
+	deliveries = paginate(deliveries, limit, offset)
+	return &deliveries, nil
+}
+
+func (wr *WebhookRepository) GetDeliveryAttempts(ctx context.Context, delivery_id uuid.UUID) (*[]model.WebhookDeliveryAttempt, error) {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	attempts := append([]model.WebhookDeliveryAttempt{}, s.webhook_attempts[delivery_id]...)
+	return &attempts, nil
+}
+
+func (wr *WebhookRepository) RedeliverWebhook(ctx context.Context, delivery_id uuid.UUID) error {
+	s := wr.Store
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhook_deliveries[delivery_id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	delivery.Status, delivery.NextAttemptAt, delivery.UpdatedAt = "pending", time.Now(), time.Now()
+	s.webhook_deliveries[delivery_id] = delivery
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PayeeRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+// lockPayees serializes the changes to the payees of a user, so that the checks of CreatePayee and RenamePayee hold until they commit.
+func lockPayees(ctx context.Context, tx *sqlx.Tx, user_id uuid.UUID) error {
+	locked := uuid.UUID{}
+	return tx.GetContext(ctx, &locked, `SELECT u.id FROM "user" u WHERE u.id = $1 FOR UPDATE`, user_id)
+}
+
+// nicknameTaken reports whether a payee of the user other than except has the nickname, ignoring case.
+func nicknameTaken(ctx context.Context, tx *sqlx.Tx, user_id uuid.UUID, nickname string, except uuid.UUID) (bool, error) {
+	taken := false
+	err := tx.GetContext(ctx,
+		&taken,
+		`SELECT EXISTS (SELECT 1 FROM "payee" p WHERE p.user_id = $1 AND lower(p.nickname) = $2 AND p.id <> $3)`,
+		user_id, strings.ToLower(nickname), except,
+	)
+
+	return taken, err
+}
+
+func (pr *PayeeRepository) CreatePayee(ctx context.Context, payee model.Payee) (*model.Payee, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	created := new(model.Payee)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		if err := lockPayees(ctx, tx, payee.UserId); err != nil {
+			return err
+		}
+
+		exists := false
+		err := tx.GetContext(ctx,
+			&exists,
+			`SELECT EXISTS (SELECT 1 FROM "payee" p WHERE p.user_id = $1 AND p.account_id = $2)`,
+			payee.UserId, payee.AccountId,
+		)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPayeeExists
+		}
+
+		taken, err := nicknameTaken(ctx, tx, payee.UserId, payee.Nickname, uuid.Nil)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNicknameTaken
+		}
+
+		err = tx.GetContext(ctx,
+			created,
+			`INSERT INTO "payee" (user_id, account_id, nickname) VALUES ($1, $2, $3) RETURNING *`,
+			payee.UserId, payee.AccountId, payee.Nickname,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := PayeeAuditEvent(ctx, "payee.create", nil, created)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (pr *PayeeRepository) GetPayee(ctx context.Context, id uuid.UUID) (*model.Payee, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	payee := new(model.Payee)
+	err := pr.Pg.GetContext(ctx, payee, `SELECT * FROM "payee" p WHERE p.id = $1`, id)
+
+	return payee, err
+}
+
+func (pr *PayeeRepository) GetPayeeByAccount(ctx context.Context, user_id uuid.UUID, account_id uuid.UUID) (*model.Payee, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	payee := new(model.Payee)
+	err := pr.Pg.GetContext(ctx, payee, `SELECT * FROM "payee" p WHERE p.user_id = $1 AND p.account_id = $2`, user_id, account_id)
+
+	return payee, err
+}
+
+func (pr *PayeeRepository) GetUserPayees(ctx context.Context, user_id uuid.UUID, limit int, offset int) (*[]model.Payee, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	payees := new([]model.Payee)
+	err := pr.Pg.SelectContext(
+		ctx,
+		payees,
+		`SELECT * FROM "payee" p WHERE p.user_id = $1
+		ORDER BY lower(p.nickname), p.id
+		LIMIT $2 OFFSET $3`,
+		user_id, limit, offset,
+	)
+
+	return payees, err
+}
+
+func (pr *PayeeRepository) RenamePayee(ctx context.Context, id uuid.UUID, nickname string) (*model.Payee, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.Payee)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.Payee)
+		if err := tx.GetContext(ctx, before, `SELECT * FROM "payee" p WHERE p.id = $1`, id); err != nil {
+			return err
+		}
+		if err := lockPayees(ctx, tx, before.UserId); err != nil {
+			return err
+		}
+
+		taken, err := nicknameTaken(ctx, tx, before.UserId, nickname, before.Id)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNicknameTaken
+		}
+
+		err = tx.GetContext(ctx,
+			after,
+			`UPDATE "payee" SET nickname = $2, updated_at = NOW() WHERE id = $1 RETURNING *`,
+			id, nickname,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := PayeeAuditEvent(ctx, "payee.rename", before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (pr *PayeeRepository) DeletePayee(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.Payee)
+		if err := tx.GetContext(ctx, before, `DELETE FROM "payee" WHERE id = $1 RETURNING *`, id); err != nil {
+			return err
+		}
+
+		event, err := PayeeAuditEvent(ctx, "payee.delete", before, nil)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+}
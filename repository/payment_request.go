@@ -0,0 +1,421 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PaymentRequestRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+func (pr *PaymentRequestRepository) GetApprovalPolicy(ctx context.Context, account_id uuid.UUID) (*model.ApprovalPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	policy := new(model.ApprovalPolicy)
+	err := pr.Pg.GetContext(ctx, policy, `SELECT * FROM "account_approval_policy" aap WHERE aap.account_id = $1`, account_id)
+
+	return policy, err
+}
+
+func (pr *PaymentRequestRepository) SetApprovalPolicy(ctx context.Context, policy model.ApprovalPolicy) (*model.ApprovalPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.ApprovalPolicy)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		var before *model.ApprovalPolicy
+		existing := new(model.ApprovalPolicy)
+		err := tx.GetContext(ctx, existing, `SELECT * FROM "account_approval_policy" aap WHERE aap.account_id = $1 FOR UPDATE`, policy.AccountId)
+		switch {
+		case err == nil:
+			before = existing
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		err = tx.GetContext(ctx,
+			after,
+			`
+			INSERT INTO "account_approval_policy" (account_id, threshold, required_approvals, updated_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (account_id) DO UPDATE SET
+				threshold = EXCLUDED.threshold,
+				required_approvals = EXCLUDED.required_approvals,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = NOW()
+			RETURNING *
+			`,
+			policy.AccountId, policy.Threshold, policy.RequiredApprovals, policy.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := ApprovalPolicyAuditEvent(ctx, "account.set_approval_policy", after.UpdatedBy, before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (pr *PaymentRequestRepository) DeleteApprovalPolicy(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.ApprovalPolicy)
+		if err := tx.GetContext(ctx, before, `DELETE FROM "account_approval_policy" WHERE account_id = $1 RETURNING *`, account_id); err != nil {
+			return err
+		}
+
+		event, err := ApprovalPolicyAuditEvent(ctx, "account.delete_approval_policy", user_id, before, nil)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+}
+
+func (pr *PaymentRequestRepository) CreatePaymentRequest(ctx context.Context, request model.PaymentRequest) (*model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	created := new(model.PaymentRequest)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(
+			ctx,
+			created,
+			`
+			INSERT INTO "payment_request" (kind, transaction_id, from_account_id, to_account_id, amount, requested_by, required_approvals, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING *
+			`,
+			request.Kind, request.TransactionId, request.FromAccountId, request.ToAccountId, request.Amount, request.RequestedBy, request.RequiredApprovals, request.ExpiresAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := PaymentRequestAuditEvent(ctx, "payment_request.create", nil, nil, created)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequest(ctx context.Context, id uuid.UUID) (*model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	request := new(model.PaymentRequest)
+	err := pr.Pg.GetContext(ctx, request, `SELECT * FROM "payment_request" pr WHERE pr.id = $1`, id)
+
+	return request, err
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequestByTransaction(ctx context.Context, transaction_id uuid.UUID) (*model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	request := new(model.PaymentRequest)
+	err := pr.Pg.GetContext(ctx, request, `SELECT * FROM "payment_request" pr WHERE pr.transaction_id = $1`, transaction_id)
+
+	return request, err
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequests(ctx context.Context, account_id uuid.UUID, status string, limit int, offset int) (*[]model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	requests := new([]model.PaymentRequest)
+	err := pr.Pg.SelectContext(
+		ctx,
+		requests,
+		`
+		SELECT
+			*
+		FROM
+			"payment_request" pr
+		WHERE
+			pr.from_account_id = $1
+			AND ($2 = '' OR pr.status::TEXT = $2)
+		ORDER BY
+			pr.created_at DESC, pr.id DESC
+		LIMIT
+			$3
+		OFFSET
+			$4
+		`,
+		account_id,
+		status,
+		limit,
+		offset,
+	)
+
+	return requests, err
+}
+
+func (pr *PaymentRequestRepository) GetPaymentRequestDecisions(ctx context.Context, request_id uuid.UUID) (*[]model.PaymentRequestDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	decisions := new([]model.PaymentRequestDecision)
+	err := pr.Pg.SelectContext(
+		ctx,
+		decisions,
+		`SELECT * FROM "payment_request_decision" prd WHERE prd.payment_request_id = $1 ORDER BY prd.created_at, prd.id`,
+		request_id,
+	)
+
+	return decisions, err
+}
+
+func (pr *PaymentRequestRepository) DecidePaymentRequest(ctx context.Context, decision model.PaymentRequestDecision) (*model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.PaymentRequest)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.PaymentRequest)
+		if err := tx.GetContext(ctx, before, `SELECT * FROM "payment_request" pr WHERE pr.id = $1 FOR UPDATE`, decision.PaymentRequestId); err != nil {
+			return err
+		}
+
+		expired := false
+		if err := tx.GetContext(ctx, &expired, `SELECT $1::TIMESTAMPTZ <= NOW()`, before.ExpiresAt); err != nil {
+			return err
+		}
+
+		switch {
+		case before.Status != "pending":
+			return ErrRequestDecided
+		case expired:
+			return ErrRequestExpired
+		case before.RequestedBy == decision.UserId:
+			return ErrOwnRequest
+		}
+
+		member, err := getMember(ctx, tx, before.FromAccountId, decision.UserId)
+		if err != nil {
+			return err
+		}
+		if member == nil || member.Role != model.MemberOwner {
+			return ErrNotOwner
+		}
+
+		already_decided := false
+		err = tx.GetContext(ctx,
+			&already_decided,
+			`SELECT EXISTS (SELECT 1 FROM "payment_request_decision" prd WHERE prd.payment_request_id = $1 AND prd.user_id = $2)`,
+			before.Id, decision.UserId,
+		)
+		if err != nil {
+			return err
+		}
+		if already_decided {
+			return ErrRequestTwice
+		}
+
+		recorded := new(model.PaymentRequestDecision)
+		err = tx.GetContext(ctx,
+			recorded,
+			`INSERT INTO "payment_request_decision" (payment_request_id, user_id, decision, comment) VALUES ($1, $2, $3, $4) RETURNING *`,
+			before.Id, decision.UserId, decision.Decision, decision.Comment,
+		)
+		if err != nil {
+			return err
+		}
+
+		status := before.Status
+		if recorded.Decision == "rejected" {
+			status = "rejected"
+		} else {
+			approvals := 0
+			err = tx.GetContext(ctx,
+				&approvals,
+				`SELECT COUNT(*) FROM "payment_request_decision" prd WHERE prd.payment_request_id = $1 AND prd.decision = 'approved'`,
+				before.Id,
+			)
+			if err != nil {
+				return err
+			}
+			if approvals >= before.RequiredApprovals {
+				status = "approved"
+			}
+		}
+
+		if err = tx.GetContext(ctx, after, `UPDATE "payment_request" SET status = $2, updated_at = NOW() WHERE id = $1 RETURNING *`, before.Id, status); err != nil {
+			return err
+		}
+
+		action := "payment_request.approve"
+		if recorded.Decision == "rejected" {
+			action = "payment_request.reject"
+		}
+		event, err := PaymentRequestAuditEvent(ctx, action, recorded, before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (pr *PaymentRequestRepository) CompletePaymentRequest(ctx context.Context, id uuid.UUID, failure_reason *string) (*model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	after := new(model.PaymentRequest)
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.PaymentRequest)
+		if err := tx.GetContext(ctx, before, `SELECT * FROM "payment_request" pr WHERE pr.id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+		if before.Status != "approved" {
+			return ErrRequestDecided
+		}
+
+		status, action := "executed", "payment_request.execute"
+		if failure_reason != nil {
+			status, action = "failed", "payment_request.fail"
+		}
+
+		err := tx.GetContext(ctx,
+			after,
+			`UPDATE "payment_request" SET status = $2, failure_reason = $3, updated_at = NOW() WHERE id = $1 RETURNING *`,
+			id, status, failure_reason,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := PaymentRequestAuditEvent(ctx, action, nil, before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// failPaymentRequests fails, within tx, the pending requests moving money out of or into account_id.
+func failPaymentRequests(ctx context.Context, tx *sqlx.Tx, account_id uuid.UUID, reason string) error {
+	pending := []model.PaymentRequest{}
+	err := tx.SelectContext(
+		ctx,
+		&pending,
+		`SELECT * FROM "payment_request" pr WHERE pr.status = 'pending' AND (pr.from_account_id = $1 OR pr.to_account_id = $1) ORDER BY pr.id FOR UPDATE`,
+		account_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		after := new(model.PaymentRequest)
+		err = tx.GetContext(ctx, after, `UPDATE "payment_request" SET status = 'failed', failure_reason = $2, updated_at = NOW() WHERE id = $1 RETURNING *`, pending[i].Id, reason)
+		if err != nil {
+			return err
+		}
+
+		event, err := PaymentRequestAuditEvent(ctx, "payment_request.fail", nil, &pending[i], after)
+		if err != nil {
+			return err
+		}
+		if err = insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pr *PaymentRequestRepository) ExpirePaymentRequests(ctx context.Context) (*[]model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Transaction)
+	defer cancel()
+
+	requests := []model.PaymentRequest{}
+	err := inTransaction(ctx, pr.Pg, func(tx *sqlx.Tx) error {
+		// Requests being decided are left for the next run rather than waited for.
+		expired := []model.PaymentRequest{}
+		err := tx.SelectContext(
+			ctx,
+			&expired,
+			`SELECT * FROM "payment_request" pr WHERE pr.status = 'pending' AND pr.expires_at <= NOW() ORDER BY pr.id FOR UPDATE SKIP LOCKED`,
+		)
+		if err != nil {
+			return err
+		}
+
+		for i := range expired {
+			after := new(model.PaymentRequest)
+			if err = tx.GetContext(ctx, after, `UPDATE "payment_request" SET status = 'expired', updated_at = NOW() WHERE id = $1 RETURNING *`, expired[i].Id); err != nil {
+				return err
+			}
+
+			event, err := PaymentRequestAuditEvent(ctx, "payment_request.expire", nil, &expired[i], after)
+			if err != nil {
+				return err
+			}
+			if err = insertAuditEvent(ctx, tx, event); err != nil {
+				return err
+			}
+			requests = append(requests, *after)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &requests, nil
+}
+
+func (pr *PaymentRequestRepository) GetApprovedPaymentRequests(ctx context.Context, limit int) (*[]model.PaymentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	requests := new([]model.PaymentRequest)
+	err := pr.Pg.SelectContext(
+		ctx,
+		requests,
+		`SELECT * FROM "payment_request" pr WHERE pr.status = 'approved' ORDER BY pr.updated_at, pr.id LIMIT $1`,
+		limit,
+	)
+
+	return requests, err
+}
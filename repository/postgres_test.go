@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"broke-bank/migrations"
+	"broke-bank/repository"
+	"broke-bank/repository/repositorytest"
+	"context"
+	"os"
+	"testing"
+)
+
+/*
+TestPostgresConformance runs the conformance suite against Postgres and Valkey, configured
+through the same envs as the server (see .env.sample). It applies the migrations first, so it
+only runs when BROKE_BANK_INTEGRATION is set.
+*/
+func TestPostgresConformance(t *testing.T) {
+	if os.Getenv("BROKE_BANK_INTEGRATION") == "" {
+		t.Skip("BROKE_BANK_INTEGRATION not set")
+	}
+
+	repos := repository.New()
+	t.Cleanup(func() {
+		repos.Pg.Close()
+		repos.Valkey.Close()
+	})
+
+	migrator, err := migrations.NewMigrator(repos.Pg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repository.Repositories { return repos })
+}
+
+func TestPostgresInvariants(t *testing.T) {
+	if os.Getenv("BROKE_BANK_INTEGRATION") == "" {
+		t.Skip("BROKE_BANK_INTEGRATION not set")
+	}
+
+	repos := repository.New()
+	t.Cleanup(func() {
+		repos.Pg.Close()
+		repos.Valkey.Close()
+	})
+
+	repositorytest.RunInvariants(t, repos, repositorytest.DefaultInvariantConfig())
+}
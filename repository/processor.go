@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+// ChargeRefundMessage fails the succeeded charges of closed accounts, which the processor has to refund.
+const ChargeRefundMessage = "Account is closed, the charge has to be refunded"
+
+type ProcessorRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+/*
+ChargeTransition reports whether a charge in status from changes when notified of status to.
+Succeeded and failed charges are final: a late pending notification is ignored, since the
+processor doesn't guarantee their order, but turning one into the other is refused.
+*/
+func ChargeTransition(from string, to string) (bool, error) {
+	switch {
+	case from == to:
+		return false, nil
+	case from == "pending":
+		return true, nil
+	case to == "pending":
+		return false, nil
+	default:
+		return false, ErrChargeTransition
+	}
+}
+
+func (pr *ProcessorRepository) GetProcessorCharge(ctx context.Context, id string) (*model.ProcessorCharge, error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Query)
+	defer cancel()
+
+	charge := new(model.ProcessorCharge)
+	err := pr.Pg.GetContext(ctx, charge, `SELECT * FROM "processor_charge" pc WHERE pc.id = $1`, id)
+
+	return charge, err
+}
+
+func (pr *ProcessorRepository) ApplyChargeEvent(ctx context.Context, event_id string, event_type string, charge model.ProcessorCharge, transaction_id uuid.UUID) (_ *model.ProcessorCharge, changed bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, pr.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, pr.Pg, pr.Timeouts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Every charge starts pending, whichever event tells about it first.
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO "processor_charge" (id, account_id, amount) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`,
+		charge.Id, charge.AccountId, charge.Amount,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current := new(model.ProcessorCharge)
+	if err = tx.GetContext(ctx, current, `SELECT * FROM "processor_charge" pc WHERE pc.id = $1 FOR UPDATE`, charge.Id); err != nil {
+		return nil, false, err
+	}
+
+	if current.AccountId != charge.AccountId || !current.Amount.Equal(charge.Amount) {
+		return current, false, ErrChargeMismatch
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO "processor_event" (id, charge_id, type) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`,
+		event_id, charge.Id, event_type,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if inserted == 0 {
+		return current, false, ErrEventReplayed
+	}
+
+	changed, err = ChargeTransition(current.Status, charge.Status)
+	if err != nil {
+		return current, false, err
+	}
+	if !changed {
+		// The event is still recorded, so that it's recognized as a replay next time.
+		return current, false, tx.Commit()
+	}
+
+	status, failure_message := charge.Status, charge.FailureMessage
+	account_balance := new(AccountBalance)
+	if charge.Status == "succeeded" {
+		if err = tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, charge.AccountId); err != nil {
+			return nil, false, err
+		}
+
+		// The money can't reach a closed account, so the charge fails for the processor to refund it.
+		// Frozen accounts fail the event instead until they're unfrozen, so that the processor retries it.
+		err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, false)
+		if errors.Is(err, ErrAccountClosed) {
+			refund := ChargeRefundMessage
+			status, failure_message = "failed", &refund
+		} else if err != nil {
+			return current, false, err
+		}
+	}
+
+	var deposit_id *uuid.UUID
+	if status == "succeeded" {
+		if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Add(charge.Amount), charge.AccountId); err != nil {
+			return nil, false, err
+		}
+
+		if _, err = tx.ExecContext(ctx, `INSERT INTO "transaction" (id, type, to_account_id, amount) VALUES ($1, 'deposit', $2, $3)`, transaction_id, charge.AccountId, charge.Amount); err != nil {
+			return nil, false, err
+		}
+
+		if err = chainTransaction(ctx, tx, transaction_id); err != nil {
+			return nil, false, err
+		}
+
+		if err = writeMovementOutbox(ctx, tx, transaction_id); err != nil {
+			return nil, false, err
+		}
+
+		if err = writeMovementAudit(ctx, tx, transaction_id, map[uuid.UUID]decimal.Decimal{account_balance.Id: account_balance.Balance}); err != nil {
+			return nil, false, err
+		}
+		deposit_id = &transaction_id
+	}
+
+	updated := new(model.ProcessorCharge)
+	err = tx.GetContext(
+		ctx,
+		updated,
+		`
+		UPDATE "processor_charge"
+		SET status = $2, failure_message = $3, transaction_id = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING *
+		`,
+		charge.Id, status, failure_message, deposit_id,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	return updated, true, nil
+}
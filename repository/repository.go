@@ -11,15 +11,67 @@ import (
 	_ "github.com/lib/pq"
 )
 
+/*
+Repositories groups every store the server depends on. New wires the Postgres and Valkey
+implementations; repository/memory provides an in-memory one, in which case Pg and Valkey are nil.
+*/
 type Repositories struct {
-	Pg                    *sqlx.DB
-	Valkey                valkey.Client
-	UserRepository        UserRepository
-	AccountRepository     AccountRepository
-	TransactionRepository TransactionRepository
+	Pg                       *sqlx.DB
+	Valkey                   valkey.Client
+	UserRepository           UserStore
+	AccountRepository        AccountStore
+	TransactionRepository    TransactionStore
+	SessionRepository        SessionStore
+	AuditRepository          AuditStore
+	ApiKeyRepository         ApiKeyStore
+	EventRepository          EventStore
+	WebhookRepository        WebhookStore
+	ProcessorRepository      ProcessorStore
+	LedgerRepository         LedgerStore
+	AdjustmentRepository     AdjustmentStore
+	MemberRepository         MemberStore
+	PaymentRequestRepository PaymentRequestStore
+	PayeeRepository          PayeeStore
+	HandleRepository         HandleStore
 }
 
 func New() Repositories {
+	valkey_addr, ok := os.LookupEnv("VALKEY_ADDRESS")
+	if !ok {
+		log.Fatal("Missing VALKEY_ADDRESS env")
+	}
+
+	pg := NewPostgres()
+	timeouts := TimeoutsFromEnv()
+
+	valkey, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{valkey_addr}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return Repositories{
+		Pg:                       pg,
+		Valkey:                   valkey,
+		UserRepository:           &UserRepository{Pg: pg, Timeouts: timeouts},
+		AccountRepository:        &AccountRepository{Pg: pg, Timeouts: timeouts},
+		TransactionRepository:    &TransactionRepository{Pg: pg, Timeouts: timeouts},
+		SessionRepository:        &SessionRepository{Valkey: valkey, Timeouts: timeouts},
+		AuditRepository:          &AuditRepository{Pg: pg, Timeouts: timeouts},
+		ApiKeyRepository:         &ApiKeyRepository{Pg: pg, Timeouts: timeouts},
+		EventRepository:          &EventRepository{Valkey: valkey, Timeouts: timeouts},
+		WebhookRepository:        &WebhookRepository{Pg: pg, Timeouts: timeouts},
+		ProcessorRepository:      &ProcessorRepository{Pg: pg, Timeouts: timeouts},
+		LedgerRepository:         &LedgerRepository{Pg: pg, Timeouts: timeouts},
+		AdjustmentRepository:     &AdjustmentRepository{Pg: pg, Timeouts: timeouts},
+		MemberRepository:         &MemberRepository{Pg: pg, Timeouts: timeouts},
+		PaymentRequestRepository: &PaymentRequestRepository{Pg: pg, Timeouts: timeouts},
+		PayeeRepository:          &PayeeRepository{Pg: pg, Timeouts: timeouts},
+		HandleRepository:         &HandleRepository{Pg: pg, Timeouts: timeouts},
+	}
+}
+
+// NewPostgres connects to Postgres using the POSTGRES_* envs, without touching Valkey.
+func NewPostgres() *sqlx.DB {
 	pg_user, ok := os.LookupEnv("POSTGRES_USER")
 	if !ok {
 		log.Fatal("Missing POSTGRES_USER env")
@@ -36,10 +88,6 @@ func New() Repositories {
 	if !ok {
 		log.Fatal("Missing POSTGRES_SSLMODE env")
 	}
-	valkey_addr, ok := os.LookupEnv("VALKEY_ADDRESS")
-	if !ok {
-		log.Fatal("Missing VALKEY_ADDRESS env")
-	}
 
 	pg, err := sqlx.Connect("postgres", fmt.Sprintf("user=%s dbname=%s password=%s sslmode=%s", pg_user, pg_dbname, pg_password, pg_sslmode))
 	if err != nil {
@@ -49,16 +97,5 @@ func New() Repositories {
 
 	pg.SetMaxOpenConns(50)
 
-	valkey, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{valkey_addr}})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return Repositories{
-		Pg:                    pg,
-		Valkey:                valkey,
-		UserRepository:        UserRepository{pg},
-		AccountRepository:     AccountRepository{pg},
-		TransactionRepository: TransactionRepository{pg},
-	}
+	return pg
 }
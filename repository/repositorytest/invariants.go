@@ -0,0 +1,358 @@
+package repositorytest
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type InvariantConfig struct {
+	Users           int
+	AccountsPerUser int
+	// Initial balance of every account.
+	InitialBalance decimal.Decimal
+	Workers        int
+	// Operations run by each worker.
+	Operations int
+	// Amounts are drawn uniformly from 0.01 up to MaxAmount.
+	MaxAmount decimal.Decimal
+	// Attempts per operation while the backend reports retryable conflicts.
+	MaxRetries int
+	// The run fails if the workers haven't finished by then, which usually means a deadlock.
+	Timeout time.Duration
+	Seed    int64
+}
+
+func DefaultInvariantConfig() InvariantConfig {
+	return InvariantConfig{
+		Users:           3,
+		AccountsPerUser: 2,
+		InitialBalance:  decimal.NewFromInt(500),
+		Workers:         16,
+		Operations:      50,
+		MaxAmount:       decimal.NewFromInt(80),
+		MaxRetries:      10,
+		Timeout:         time.Minute,
+		Seed:            time.Now().UnixNano(),
+	}
+}
+
+type OperationStats struct {
+	Succeeded int
+	// Rejected for lack of funds, which is expected under contention.
+	Insufficient int
+	// Retries caused by serialization failures or deadlocks.
+	Retries   int
+	Deadlocks int
+	Failed    int
+	P50       time.Duration
+	P99       time.Duration
+	latencies []time.Duration
+}
+
+type InvariantReport struct {
+	Seed       int64
+	Duration   time.Duration
+	Operations map[string]*OperationStats
+}
+
+func (r *InvariantReport) String() string {
+	types := []string{}
+	for operation := range r.Operations {
+		types = append(types, operation)
+	}
+	sort.Strings(types)
+
+	out := fmt.Sprintf("seed=%d duration=%s\n", r.Seed, r.Duration.Round(time.Millisecond))
+	for _, operation := range types {
+		stats := r.Operations[operation]
+		out += fmt.Sprintf(
+			"%-10s ok=%-5d insufficient=%-5d failed=%-3d retries=%-4d deadlocks=%-3d p50=%-10s p99=%s\n",
+			operation, stats.Succeeded, stats.Insufficient, stats.Failed, stats.Retries, stats.Deadlocks, stats.P50, stats.P99,
+		)
+	}
+
+	return out
+}
+
+type operation struct {
+	kind   string
+	id     uuid.UUID
+	from   *uuid.UUID
+	to     *uuid.UUID
+	amount decimal.Decimal
+}
+
+/*
+RunInvariants hammers repos with concurrent deposits, withdrawals and transfers (in both
+directions between the same accounts) with random amounts, then checks that:
+
+  - no money was created or lost: the final total equals the initial total plus successful
+    deposits minus successful withdrawals,
+  - no balance is negative,
+  - every account's balance delta matches the transaction rows written during the run, and
+    every successful operation (and only those) wrote a row,
+  - no deadlock was reported and every worker finished before the timeout.
+
+Operations are retried while the backend reports repository.IsRetryable errors. The latency
+of each operation includes its retries. The report is logged and returned.
+*/
+func RunInvariants(t *testing.T, repos repository.Repositories, config InvariantConfig) *InvariantReport {
+	t.Helper()
+	t.Logf("invariants seed: %d", config.Seed)
+
+	accounts := []uuid.UUID{}
+	initial := map[uuid.UUID]decimal.Decimal{}
+	for i := 0; i < config.Users; i++ {
+		user := CreateUser(t, repos)
+		for j := 0; j < config.AccountsPerUser; j++ {
+			account := CreateAccount(t, repos, user, config.InitialBalance.String())
+			accounts = append(accounts, account.Id)
+			initial[account.Id] = account.Balance
+		}
+	}
+	if len(accounts) < 2 {
+		t.Fatal("RunInvariants needs at least 2 accounts")
+	}
+
+	// Rows written before the run, such as the deposits funding the accounts.
+	existing := map[uuid.UUID]bool{}
+	for _, id := range accounts {
+		transactions, err := repos.TransactionRepository.GetAccountTransactions(context.Background(), id.String(), 1000, 0)
+		if err != nil {
+			t.Fatalf("GetAccountTransactions: %s", err)
+		}
+		for _, transaction := range *transactions {
+			existing[transaction.Id] = true
+		}
+	}
+
+	report := &InvariantReport{Seed: config.Seed, Operations: map[string]*OperationStats{}}
+	for _, kind := range []string{"deposit", "withdrawal", "transfer"} {
+		report.Operations[kind] = &OperationStats{}
+	}
+
+	var (
+		mu        sync.Mutex
+		succeeded = []operation{}
+		failures  = []error{}
+	)
+
+	record := func(op operation, latency time.Duration, retries int, deadlocks int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		stats := report.Operations[op.kind]
+		stats.latencies = append(stats.latencies, latency)
+		stats.Retries += retries
+		stats.Deadlocks += deadlocks
+
+		switch {
+		case err == nil:
+			stats.Succeeded++
+			succeeded = append(succeeded, op)
+		case errors.Is(err, repository.ErrInsufficientBalance):
+			stats.Insufficient++
+		default:
+			stats.Failed++
+			failures = append(failures, fmt.Errorf("%s %s: %w", op.kind, op.amount, err))
+		}
+	}
+
+	run := func(op operation) error {
+		switch op.kind {
+		case "deposit":
+			return repos.TransactionRepository.DepositTransaction(context.Background(), op.id, op.to.String(), op.amount)
+		case "withdrawal":
+			return repos.TransactionRepository.WithdrawalTransaction(context.Background(), op.id, op.from.String(), op.amount)
+		default:
+			return repos.TransactionRepository.TransferTransaction(context.Background(), op.id, op.from.String(), op.to.String(), op.amount)
+		}
+	}
+
+	max_cents := config.MaxAmount.Shift(2).IntPart()
+	started := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < config.Workers; worker++ {
+		random := rand.New(rand.NewSource(config.Seed + int64(worker)))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < config.Operations; i++ {
+				op := operation{amount: decimal.New(random.Int63n(max_cents)+1, -2)}
+				first := accounts[random.Intn(len(accounts))]
+				second := accounts[random.Intn(len(accounts)-1)]
+				if second == first {
+					second = accounts[len(accounts)-1]
+				}
+
+				switch roll := random.Intn(10); {
+				case roll < 2:
+					op.kind, op.to = "deposit", &first
+				case roll < 4:
+					op.kind, op.from = "withdrawal", &first
+				default:
+					op.kind, op.from, op.to = "transfer", &first, &second
+				}
+
+				id, err := uuid.NewV7()
+				if err != nil {
+					record(op, 0, 0, 0, err)
+					continue
+				}
+				op.id = id
+
+				retries, deadlocks := 0, 0
+				op_started := time.Now()
+				for attempt := 1; ; attempt++ {
+					err = run(op)
+					if repository.IsDeadlock(err) {
+						deadlocks++
+					}
+					if !repository.IsRetryable(err) || attempt == config.MaxRetries {
+						break
+					}
+					retries++
+				}
+				record(op, time.Since(op_started), retries, deadlocks, err)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(config.Timeout):
+		t.Fatalf("workers did not finish within %s, transfers are probably deadlocked", config.Timeout)
+	}
+	report.Duration = time.Since(started)
+
+	for _, stats := range report.Operations {
+		stats.P50, stats.P99 = percentile(stats.latencies, 0.50), percentile(stats.latencies, 0.99)
+	}
+	t.Logf("invariants report:\n%s", report)
+
+	for _, err := range failures {
+		t.Errorf("unexpected failure: %s", err)
+	}
+	for kind, stats := range report.Operations {
+		if stats.Deadlocks > 0 {
+			t.Errorf("%d %s(s) hit a deadlock", stats.Deadlocks, kind)
+		}
+	}
+
+	checkInvariants(t, repos, accounts, initial, existing, succeeded)
+
+	return report
+}
+
+func checkInvariants(t *testing.T, repos repository.Repositories, accounts []uuid.UUID, initial map[uuid.UUID]decimal.Decimal, existing map[uuid.UUID]bool, succeeded []operation) {
+	t.Helper()
+
+	expected_total := decimal.Zero
+	for _, balance := range initial {
+		expected_total = expected_total.Add(balance)
+	}
+	successful := map[uuid.UUID]operation{}
+	for _, op := range succeeded {
+		successful[op.id] = op
+		switch op.kind {
+		case "deposit":
+			expected_total = expected_total.Add(op.amount)
+		case "withdrawal":
+			expected_total = expected_total.Sub(op.amount)
+		}
+	}
+
+	total := decimal.Zero
+	seen := map[uuid.UUID]bool{}
+	for _, id := range accounts {
+		account := GetAccount(t, repos, id)
+		total = total.Add(account.Balance)
+
+		if account.Balance.IsNegative() {
+			t.Errorf("account %s has a negative balance: %s", id, account.Balance)
+		}
+
+		// Every row touching this account that was written during the run.
+		transactions, err := repos.TransactionRepository.GetAccountTransactions(context.Background(), id.String(), len(succeeded)+1000, 0)
+		if err != nil {
+			t.Fatalf("GetAccountTransactions: %s", err)
+		}
+
+		delta := decimal.Zero
+		for _, transaction := range *transactions {
+			op, ok := successful[transaction.Id]
+			if !ok {
+				if !existing[transaction.Id] {
+					t.Errorf("transaction %s was written by an operation that failed", transaction.Id)
+				}
+				continue
+			}
+			seen[transaction.Id] = true
+
+			if !matches(transaction, op) {
+				t.Errorf("transaction %s stored as %+v, but the %s was for %s", transaction.Id, transaction, op.kind, op.amount)
+			}
+			if transaction.ToAccountId != nil && *transaction.ToAccountId == id {
+				delta = delta.Add(transaction.Amount)
+			}
+			if transaction.FromAccountId != nil && *transaction.FromAccountId == id {
+				delta = delta.Sub(transaction.Amount)
+			}
+		}
+
+		if !initial[id].Add(delta).Equal(account.Balance) {
+			t.Errorf("account %s: initial %s + transactions %s != balance %s", id, initial[id], delta, account.Balance)
+		}
+	}
+
+	if !total.Equal(expected_total) {
+		t.Errorf("money was not conserved: total balance %s, expected %s", total, expected_total)
+	}
+
+	for id, op := range successful {
+		if !seen[id] {
+			t.Errorf("successful %s %s has no transaction row", op.kind, id)
+		}
+	}
+
+	assertReconciled(t, repos, accounts...)
+}
+
+func matches(transaction model.Transaction, op operation) bool {
+	same := func(a *uuid.UUID, b *uuid.UUID) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+	}
+
+	return transaction.Type == op.kind && transaction.Amount.Equal(op.amount) && same(transaction.FromAccountId, op.from) && same(transaction.ToAccountId, op.to)
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
@@ -0,0 +1,2394 @@
+/*
+Package repositorytest is the conformance suite every repository backend must pass.
+
+Backends call Run from their own tests with a constructor for fresh repositories. The suite
+only relies on rows it creates itself (with unique emails), so it can run against a shared
+database that already holds data.
+*/
+package repositorytest
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func Run(t *testing.T, newRepositories func(t *testing.T) repository.Repositories) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepositories(t)) })
+	t.Run("UserRoles", func(t *testing.T) { testUserRoles(t, newRepositories(t)) })
+	t.Run("Accounts", func(t *testing.T) { testAccounts(t, newRepositories(t)) })
+	t.Run("AccountStatuses", func(t *testing.T) { testAccountStatuses(t, newRepositories(t)) })
+	t.Run("AccountClosures", func(t *testing.T) { testAccountClosures(t, newRepositories(t)) })
+	t.Run("Deposit", func(t *testing.T) { testDeposit(t, newRepositories(t)) })
+	t.Run("Withdrawal", func(t *testing.T) { testWithdrawal(t, newRepositories(t)) })
+	t.Run("Transfer", func(t *testing.T) { testTransfer(t, newRepositories(t)) })
+	t.Run("FailedMovementsAreAtomic", func(t *testing.T) { testFailedMovementsAreAtomic(t, newRepositories(t)) })
+	t.Run("CanceledContext", func(t *testing.T) { testCanceledContext(t, newRepositories(t)) })
+	t.Run("AccountTransactions", func(t *testing.T) { testAccountTransactions(t, newRepositories(t)) })
+	t.Run("Reverse", func(t *testing.T) { testReverse(t, newRepositories(t)) })
+	t.Run("ConcurrentTransfers", func(t *testing.T) { testConcurrentTransfers(t, newRepositories(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newRepositories(t)) })
+	t.Run("Audit", func(t *testing.T) { testAudit(t, newRepositories(t)) })
+	t.Run("AuditedChanges", func(t *testing.T) { testAuditedChanges(t, newRepositories(t)) })
+	t.Run("ApiKeys", func(t *testing.T) { testApiKeys(t, newRepositories(t)) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, newRepositories(t)) })
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, newRepositories(t)) })
+	t.Run("ProcessorCharges", func(t *testing.T) { testProcessorCharges(t, newRepositories(t)) })
+	t.Run("Ledger", func(t *testing.T) { testLedger(t, newRepositories(t)) })
+	t.Run("Adjustments", func(t *testing.T) { testAdjustments(t, newRepositories(t)) })
+	t.Run("Members", func(t *testing.T) { testMembers(t, newRepositories(t)) })
+	t.Run("PaymentRequests", func(t *testing.T) { testPaymentRequests(t, newRepositories(t)) })
+	t.Run("Payees", func(t *testing.T) { testPayees(t, newRepositories(t)) })
+	t.Run("AccountNumbers", func(t *testing.T) { testAccountNumbers(t, newRepositories(t)) })
+	t.Run("Handles", func(t *testing.T) { testHandles(t, newRepositories(t)) })
+}
+
+func uniqueEmail() string {
+	return fmt.Sprintf("conformance-%s@broke.bank", uuid.New())
+}
+
+func newUUID(t *testing.T) uuid.UUID {
+	t.Helper()
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// CreateUser creates a user with a unique email and returns it.
+func CreateUser(t *testing.T, repos repository.Repositories) *model.User {
+	t.Helper()
+
+	email := uniqueEmail()
+	if err := repos.UserRepository.CreateUser(context.Background(), email, "not-a-real-hash"); err != nil {
+		t.Fatalf("CreateUser: %s", err)
+	}
+
+	user, err := repos.UserRepository.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %s", err)
+	}
+
+	return user
+}
+
+// CreateAccount creates an active account for the user, funded with balance through a deposit.
+func CreateAccount(t *testing.T, repos repository.Repositories, user *model.User, balance string) *model.Account {
+	t.Helper()
+
+	before, err := repos.AccountRepository.GetMyAccounts(context.Background(), user.Id.String(), 1000, 0)
+	if err != nil {
+		t.Fatalf("GetMyAccounts: %s", err)
+	}
+	known := map[uuid.UUID]bool{}
+	for _, account := range *before {
+		known[account.Id] = true
+	}
+
+	if err = repos.AccountRepository.CreateAccount(context.Background(), user.Id.String(), "Conformance", "active"); err != nil {
+		t.Fatalf("CreateAccount: %s", err)
+	}
+
+	after, err := repos.AccountRepository.GetMyAccounts(context.Background(), user.Id.String(), 1000, 0)
+	if err != nil {
+		t.Fatalf("GetMyAccounts: %s", err)
+	}
+
+	var created *model.Account
+	for _, account := range *after {
+		if !known[account.Id] {
+			created = &account
+			break
+		}
+	}
+	if created == nil {
+		t.Fatal("created account not returned by GetMyAccounts")
+	}
+
+	amount := decimal.RequireFromString(balance)
+	if amount.IsPositive() {
+		if err = repos.TransactionRepository.DepositTransaction(context.Background(), newUUID(t), created.Id.String(), amount); err != nil {
+			t.Fatalf("DepositTransaction: %s", err)
+		}
+	}
+
+	return GetAccount(t, repos, created.Id)
+}
+
+func GetUser(t *testing.T, repos repository.Repositories, id uuid.UUID) *model.User {
+	t.Helper()
+
+	user, err := repos.UserRepository.GetUserById(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetUserById(%s): %s", id, err)
+	}
+
+	return user
+}
+
+func GetAccount(t *testing.T, repos repository.Repositories, id uuid.UUID) *model.Account {
+	t.Helper()
+
+	account, err := repos.AccountRepository.GetAccount(context.Background(), id.String())
+	if err != nil {
+		t.Fatalf("GetAccount(%s): %s", id, err)
+	}
+
+	return account
+}
+
+func assertBalance(t *testing.T, repos repository.Repositories, id uuid.UUID, expected string) {
+	t.Helper()
+
+	account := GetAccount(t, repos, id)
+	if !account.Balance.Equal(decimal.RequireFromString(expected)) {
+		t.Fatalf("account %s balance = %s, want %s", id, account.Balance.StringFixed(2), expected)
+	}
+}
+
+func testUsers(t *testing.T, repos repository.Repositories) {
+	email := uniqueEmail()
+	if err := repos.UserRepository.CreateUser(context.Background(), email, "hash"); err != nil {
+		t.Fatalf("CreateUser: %s", err)
+	}
+
+	if err := repos.UserRepository.CreateUser(context.Background(), email, "hash"); err == nil {
+		t.Fatal("CreateUser with a duplicated email succeeded")
+	}
+
+	by_email, err := repos.UserRepository.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %s", err)
+	}
+	if by_email.Email != email || by_email.EncryptedPassword != "hash" || by_email.DisabledAt != nil || by_email.Role != model.RoleCustomer || by_email.CreatedAt.IsZero() {
+		t.Fatalf("GetUserByEmail returned %+v", by_email)
+	}
+
+	by_id, err := repos.UserRepository.GetUserById(context.Background(), by_email.Id)
+	if err != nil {
+		t.Fatalf("GetUserById: %s", err)
+	}
+	if by_id.Email != email {
+		t.Fatalf("GetUserById email = %s, want %s", by_id.Email, email)
+	}
+
+	if _, err = repos.UserRepository.GetUserByEmail(context.Background(), uniqueEmail()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetUserByEmail(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err = repos.UserRepository.GetUserById(context.Background(), uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetUserById(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	if err = repos.UserRepository.DisableUser(context.Background(), by_id.Id); err != nil {
+		t.Fatalf("DisableUser: %s", err)
+	}
+	disabled, err := repos.UserRepository.GetUserById(context.Background(), by_id.Id)
+	if err != nil {
+		t.Fatalf("GetUserById: %s", err)
+	}
+	if disabled.DisabledAt == nil {
+		t.Fatal("DisableUser did not set DisabledAt")
+	}
+}
+
+func testUserRoles(t *testing.T, repos repository.Repositories) {
+	ctx := repository.WithAuditActor(context.Background(), model.AuditActor{Actor: "user:conformance", Reason: "promotion"})
+	user := CreateUser(t, repos)
+	// Wildcards in the query are matched literally.
+	marker := "role_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	for _, email := range []string{marker + "-a@broke.bank", strings.ToUpper(marker) + "-b@broke.bank", uniqueEmail()} {
+		if err := repos.UserRepository.CreateUser(ctx, email, "hash"); err != nil {
+			t.Fatalf("CreateUser: %s", err)
+		}
+	}
+
+	if err := repos.UserRepository.SetUserRole(ctx, user.Id, model.RoleSupport); err != nil {
+		t.Fatalf("SetUserRole: %s", err)
+	}
+	if role := GetUser(t, repos, user.Id).Role; role != model.RoleSupport {
+		t.Fatalf("role after SetUserRole = %s, want support", role)
+	}
+	if err := repos.UserRepository.SetUserRole(ctx, uuid.New(), model.RoleAdmin); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("SetUserRole(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+	if err := repos.UserRepository.SetUserRole(ctx, user.Id, "superuser"); err == nil {
+		t.Fatal("SetUserRole with an unknown role succeeded")
+	}
+
+	events, err := repos.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{UserId: &user.Id, Action: "user.set_role"}, 10, 0)
+	if err != nil || len(*events) != 1 {
+		t.Fatalf("user.set_role events = %+v, %v, want one", events, err)
+	}
+	if event := (*events)[0]; event.Reason == nil || *event.Reason != "promotion" || !strings.Contains(string(*event.After), `"role":"support"`) {
+		t.Fatalf("user.set_role recorded as %+v", event)
+	}
+
+	found, err := repos.UserRepository.SearchUsers(ctx, marker, 10, 0)
+	if err != nil || len(*found) != 2 || (*found)[0].Email != marker+"-a@broke.bank" {
+		t.Fatalf("SearchUsers(%s) = %+v, %v, want both users, by email", marker, found, err)
+	}
+	if page, err := repos.UserRepository.SearchUsers(ctx, marker, 1, 1); err != nil || len(*page) != 1 || (*page)[0].Email != strings.ToUpper(marker)+"-b@broke.bank" {
+		t.Fatalf("SearchUsers(%s) second page = %+v, %v", marker, page, err)
+	}
+	by_id, err := repos.UserRepository.SearchUsers(ctx, user.Id.String(), 10, 0)
+	if err != nil || len(*by_id) != 1 || (*by_id)[0].Id != user.Id {
+		t.Fatalf("SearchUsers(id) = %+v, %v, want the user", by_id, err)
+	}
+	if none, err := repos.UserRepository.SearchUsers(ctx, strings.ReplaceAll(marker, "_", "%"), 10, 0); err != nil || len(*none) != 0 {
+		t.Fatalf("SearchUsers with wildcards = %+v, %v, want none", none, err)
+	}
+}
+
+func testAccounts(t *testing.T, repos repository.Repositories) {
+	user := CreateUser(t, repos)
+
+	if err := repos.AccountRepository.CreateAccount(context.Background(), uuid.New().String(), "Orphan", "active"); err == nil {
+		t.Fatal("CreateAccount for an unknown user succeeded")
+	}
+
+	first := CreateAccount(t, repos, user, "0")
+	second := CreateAccount(t, repos, user, "0")
+	third := CreateAccount(t, repos, user, "0")
+
+	if first.UserId != user.Id || first.Name != "Conformance" || first.Status != "active" || !first.Balance.IsZero() {
+		t.Fatalf("CreateAccount stored %+v", first)
+	}
+
+	if _, err := repos.AccountRepository.GetAccount(context.Background(), uuid.New().String()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetAccount(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := repos.AccountRepository.DisableAccount(context.Background(), first.Id.String()); err != nil {
+		t.Fatalf("DisableAccount: %s", err)
+	}
+	if status := GetAccount(t, repos, first.Id).Status; status != "inactive" {
+		t.Fatalf("status after DisableAccount = %s, want inactive", status)
+	}
+
+	reason := "other"
+	if _, err := repos.AccountRepository.SetAccountStatus(context.Background(), second.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus: %s", err)
+	}
+	if status := GetAccount(t, repos, second.Id).Status; status != "frozen_all" {
+		t.Fatalf("status after SetAccountStatus = %s, want frozen_all", status)
+	}
+
+	// Accounts are listed by status (active, inactive, frozen_debit, frozen_all, closed) and then by id.
+	accounts, err := repos.AccountRepository.GetMyAccounts(context.Background(), user.Id.String(), 10, 0)
+	if err != nil {
+		t.Fatalf("GetMyAccounts: %s", err)
+	}
+	got := []uuid.UUID{}
+	for _, account := range *accounts {
+		got = append(got, account.Id)
+	}
+	want := []uuid.UUID{third.Id, first.Id, second.Id}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("GetMyAccounts = %v, want %v", got, want)
+	}
+
+	page, err := repos.AccountRepository.GetMyAccounts(context.Background(), user.Id.String(), 1, 1)
+	if err != nil {
+		t.Fatalf("GetMyAccounts: %s", err)
+	}
+	if len(*page) != 1 || (*page)[0].Id != first.Id {
+		t.Fatalf("GetMyAccounts(limit 1, offset 1) = %v, want [%s]", *page, first.Id)
+	}
+
+	other, err := repos.AccountRepository.GetMyAccounts(context.Background(), CreateUser(t, repos).Id.String(), 10, 0)
+	if err != nil {
+		t.Fatalf("GetMyAccounts: %s", err)
+	}
+	if len(*other) != 0 {
+		t.Fatalf("GetMyAccounts for a user without accounts returned %d accounts", len(*other))
+	}
+}
+
+func testAccountStatuses(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	checking := CreateAccount(t, repos, alice, "100")
+	savings := CreateAccount(t, repos, alice, "100")
+	endpoint, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, alice.Id, "https://alice.example/statuses", "whsec_statuses", []string{"account.status_changed"})
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %s", err)
+	}
+
+	deposit_id := newUUID(t)
+	if err = repos.TransactionRepository.DepositTransaction(ctx, deposit_id, checking.Id.String(), decimal.NewFromInt(10)); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+
+	fraud, order := "fraud_suspected", "court_order"
+	freeze := func(account *model.Account, status string, reason *string, until *time.Time) *model.Account {
+		t.Helper()
+		frozen, err := repos.AccountRepository.SetAccountStatus(ctx, account.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: status, StatusReason: reason, FrozenUntil: until})
+		if err != nil {
+			t.Fatalf("SetAccountStatus(%s): %s", status, err)
+		}
+		return frozen
+	}
+	unfreeze := func(account *model.Account) {
+		t.Helper()
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, account.Id.String(), repository.AccountStatusChange{From: []string{"frozen_debit", "frozen_all"}, Status: "active"}); err != nil {
+			t.Fatalf("SetAccountStatus(active): %s", err)
+		}
+	}
+	expect := func(name string, err error, want error) {
+		t.Helper()
+		if !errors.Is(err, want) {
+			t.Fatalf("%s error = %v, want %v", name, err, want)
+		}
+	}
+	ten := decimal.NewFromInt(10)
+
+	t.Run("changes are checked against the current status", func(t *testing.T) {
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, checking.Id.String(), repository.AccountStatusChange{From: []string{"frozen_all"}, Status: "active"}); !errors.Is(err, repository.ErrAccountStatus) {
+			t.Fatalf("SetAccountStatus(wrong from) error = %v, want ErrAccountStatus", err)
+		}
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, uuid.NewString(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all", StatusReason: &fraud}); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("SetAccountStatus(unknown) error = %v, want sql.ErrNoRows", err)
+		}
+		// Frozen and closed accounts need a reason, and only freezes can end.
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, checking.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all"}); err == nil {
+			t.Fatal("SetAccountStatus(frozen_all without a reason) succeeded")
+		}
+		until := time.Now().Add(time.Hour)
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, checking.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "closed", StatusReason: &order, FrozenUntil: &until}); err == nil {
+			t.Fatal("SetAccountStatus(closed until) succeeded")
+		}
+		if status := GetAccount(t, repos, checking.Id).Status; status != "active" {
+			t.Fatalf("status after failed changes = %s, want active", status)
+		}
+	})
+
+	t.Run("frozen_debit only blocks debits", func(t *testing.T) {
+		frozen := freeze(checking, "frozen_debit", &fraud, nil)
+		if frozen.Status != "frozen_debit" || frozen.StatusReason == nil || *frozen.StatusReason != fraud || frozen.FrozenUntil != nil {
+			t.Fatalf("SetAccountStatus returned %+v", frozen)
+		}
+
+		expect("WithdrawalTransaction", repos.TransactionRepository.WithdrawalTransaction(ctx, newUUID(t), checking.Id.String(), ten), repository.ErrAccountFrozen)
+		expect("TransferTransaction(out)", repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), checking.Id.String(), savings.Id.String(), ten), repository.ErrAccountFrozen)
+		_, err := repos.TransactionRepository.ReverseTransaction(ctx, newUUID(t), deposit_id.String())
+		expect("ReverseTransaction(deposit)", err, repository.ErrAccountFrozen)
+
+		expect("DepositTransaction", repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), checking.Id.String(), ten), nil)
+		expect("TransferTransaction(in)", repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), savings.Id.String(), checking.Id.String(), ten), nil)
+		assertBalance(t, repos, checking.Id, "130")
+		unfreeze(checking)
+	})
+
+	t.Run("frozen_all blocks every movement", func(t *testing.T) {
+		freeze(savings, "frozen_all", &order, nil)
+
+		expect("DepositTransaction", repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), savings.Id.String(), ten), repository.ErrAccountFrozen)
+		expect("WithdrawalTransaction", repos.TransactionRepository.WithdrawalTransaction(ctx, newUUID(t), savings.Id.String(), ten), repository.ErrAccountFrozen)
+		expect("TransferTransaction(in)", repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), checking.Id.String(), savings.Id.String(), ten), repository.ErrAccountFrozen)
+		assertBalance(t, repos, checking.Id, "130")
+		assertBalance(t, repos, savings.Id, "90")
+		unfreeze(savings)
+	})
+
+	t.Run("closed and inactive accounts don't move money", func(t *testing.T) {
+		closed := CreateAccount(t, repos, alice, "0")
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, closed.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "closed", StatusReason: &order}); err != nil {
+			t.Fatalf("SetAccountStatus(closed): %s", err)
+		}
+		inactive := CreateAccount(t, repos, alice, "0")
+		if err := repos.AccountRepository.DisableAccount(ctx, inactive.Id.String()); err != nil {
+			t.Fatalf("DisableAccount: %s", err)
+		}
+
+		for _, account := range []*model.Account{closed, inactive} {
+			expect("DepositTransaction", repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), account.Id.String(), ten), repository.ErrAccountClosed)
+			expect("TransferTransaction(in)", repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), checking.Id.String(), account.Id.String(), ten), repository.ErrAccountClosed)
+		}
+	})
+
+	t.Run("freezes end at frozen_until", func(t *testing.T) {
+		until := time.Now().Add(-time.Second)
+		freeze(checking, "frozen_all", &fraud, &until)
+
+		// Movements don't wait for the freeze to be lifted.
+		expect("WithdrawalTransaction", repos.TransactionRepository.WithdrawalTransaction(ctx, newUUID(t), checking.Id.String(), ten), nil)
+
+		expired, err := repos.AccountRepository.ExpireAccountFreezes(ctx)
+		if err != nil {
+			t.Fatalf("ExpireAccountFreezes: %s", err)
+		}
+		found := false
+		for _, account := range *expired {
+			if account.Id == checking.Id {
+				found = account.Status == "active" && account.StatusReason == nil && account.FrozenUntil == nil
+			}
+		}
+		if !found {
+			t.Fatalf("ExpireAccountFreezes = %+v, want checking active again", *expired)
+		}
+		if account := GetAccount(t, repos, checking.Id); account.Status != "active" || account.FrozenUntil != nil {
+			t.Fatalf("account after ExpireAccountFreezes = %+v", account)
+		}
+
+		later := time.Now().Add(time.Hour)
+		freeze(savings, "frozen_debit", &fraud, &later)
+		again, err := repos.AccountRepository.ExpireAccountFreezes(ctx)
+		if err != nil {
+			t.Fatalf("ExpireAccountFreezes: %s", err)
+		}
+		for _, account := range *again {
+			if account.Id == checking.Id || account.Id == savings.Id {
+				t.Fatalf("ExpireAccountFreezes expired %s again or too early", account.Id)
+			}
+		}
+		if account := GetAccount(t, repos, savings.Id); account.Status != "frozen_debit" || account.FrozenUntil == nil || !account.FrozenUntil.Round(time.Second).Equal(later.Round(time.Second)) {
+			t.Fatalf("savings = %+v, want frozen_debit until %s", account, later)
+		}
+	})
+
+	t.Run("owners are notified without the reason", func(t *testing.T) {
+		dispatchOutbox(t, repos)
+		deliveries := endpointDeliveries(t, repos, endpoint.Id)["account.status_changed"]
+		// Two freezes and unfreezes, the closing, the expired freeze and its expiry, and the last freeze.
+		if len(deliveries) != 8 {
+			t.Fatalf("account.status_changed deliveries = %d, want 8", len(deliveries))
+		}
+
+		latest := map[string]any{}
+		if err := json.Unmarshal(deliveries[0].EventData, &latest); err != nil {
+			t.Fatal(err)
+		}
+		if latest["account_id"] != savings.Id.String() || latest["status"] != "frozen_debit" || latest["frozen_until"] == nil {
+			t.Fatalf("latest account.status_changed data %s", deliveries[0].EventData)
+		}
+		if _, ok := latest["status_reason"]; ok {
+			t.Fatalf("account.status_changed data %s tells the reason", deliveries[0].EventData)
+		}
+	})
+}
+
+func testAccountClosures(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	checking := CreateAccount(t, repos, alice, "100")
+	savings := CreateAccount(t, repos, alice, "25.50")
+
+	t.Run("the balance is swept along with the closing", func(t *testing.T) {
+		sweep_id := newUUID(t)
+		closed, sweep, err := repos.AccountRepository.CloseAccount(ctx, sweep_id, savings.Id.String(), checking.Id.String())
+		if err != nil {
+			t.Fatalf("CloseAccount: %s", err)
+		}
+		if closed.Status != "closed" || closed.StatusReason == nil || *closed.StatusReason != "customer_request" || closed.ClosedAt == nil || !closed.Balance.IsZero() {
+			t.Fatalf("CloseAccount = %+v, want a closed empty account", closed)
+		}
+		if sweep == nil || sweep.Id != sweep_id || sweep.Type != "transfer" || *sweep.FromAccountId != savings.Id || *sweep.ToAccountId != checking.Id || !sweep.Amount.Equal(decimal.RequireFromString("25.50")) {
+			t.Fatalf("CloseAccount sweep = %+v", sweep)
+		}
+		assertBalance(t, repos, savings.Id, "0")
+		assertBalance(t, repos, checking.Id, "125.50")
+		assertReconciled(t, repos, savings.Id, checking.Id)
+
+		if err = repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), savings.Id.String(), decimal.NewFromInt(1)); !errors.Is(err, repository.ErrAccountClosed) {
+			t.Fatalf("DepositTransaction(closed) error = %v, want ErrAccountClosed", err)
+		}
+		if _, _, err = repos.AccountRepository.CloseAccount(ctx, newUUID(t), savings.Id.String(), checking.Id.String()); !errors.Is(err, repository.ErrAccountClosed) {
+			t.Fatalf("CloseAccount(closed) error = %v, want ErrAccountClosed", err)
+		}
+	})
+
+	t.Run("empty accounts are closed without a sweep", func(t *testing.T) {
+		empty := CreateAccount(t, repos, alice, "0")
+		closed, sweep, err := repos.AccountRepository.CloseAccount(ctx, newUUID(t), empty.Id.String(), checking.Id.String())
+		if err != nil || closed.Status != "closed" || sweep != nil {
+			t.Fatalf("CloseAccount(empty) = %+v, %+v, %v", closed, sweep, err)
+		}
+		transactions, err := repos.TransactionRepository.GetAccountTransactions(ctx, empty.Id.String(), 10, 0)
+		if err != nil || len(*transactions) != 0 {
+			t.Fatalf("transactions of the empty account = %+v, %v", transactions, err)
+		}
+	})
+
+	t.Run("pending requests and the handle go with the account", func(t *testing.T) {
+		closing := CreateAccount(t, repos, alice, "10")
+		submit := func(from uuid.UUID, to uuid.UUID) *model.PaymentRequest {
+			t.Helper()
+			request, err := repos.PaymentRequestRepository.CreatePaymentRequest(ctx, model.PaymentRequest{
+				Kind:              "transfer",
+				TransactionId:     newUUID(t),
+				FromAccountId:     from,
+				ToAccountId:       &to,
+				Amount:            decimal.NewFromInt(5),
+				RequestedBy:       alice.Id,
+				RequiredApprovals: 1,
+				ExpiresAt:         time.Now().Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("CreatePaymentRequest: %s", err)
+			}
+			return request
+		}
+		out, in := submit(closing.Id, checking.Id), submit(checking.Id, closing.Id)
+		unrelated := submit(checking.Id, CreateAccount(t, repos, alice, "0").Id)
+
+		handle := "c" + strings.ReplaceAll(uuid.NewString(), "-", "")[:20]
+		if _, err := repos.HandleRepository.SetHandle(ctx, model.Handle{Handle: handle, UserId: alice.Id, AccountId: closing.Id}); err != nil {
+			t.Fatalf("SetHandle: %s", err)
+		}
+
+		if _, _, err := repos.AccountRepository.CloseAccount(ctx, newUUID(t), closing.Id.String(), checking.Id.String()); err != nil {
+			t.Fatalf("CloseAccount: %s", err)
+		}
+
+		for _, request := range []*model.PaymentRequest{out, in} {
+			failed, err := repos.PaymentRequestRepository.GetPaymentRequest(ctx, request.Id)
+			if err != nil || failed.Status != "failed" || failed.FailureReason == nil || *failed.FailureReason != "account_closed" {
+				t.Fatalf("request of the closed account = %+v, %v, want it failed with account_closed", failed, err)
+			}
+		}
+		if pending, err := repos.PaymentRequestRepository.GetPaymentRequest(ctx, unrelated.Id); err != nil || pending.Status != "pending" {
+			t.Fatalf("request of another account = %+v, %v, want it still pending", pending, err)
+		}
+		if _, err := repos.HandleRepository.GetHandle(ctx, handle); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetHandle of the closed account = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("frozen accounts can't be closed nor swept into", func(t *testing.T) {
+		frozen := CreateAccount(t, repos, alice, "10")
+		reason := "court_order"
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, frozen.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all", StatusReason: &reason}); err != nil {
+			t.Fatalf("SetAccountStatus: %s", err)
+		}
+
+		if _, _, err := repos.AccountRepository.CloseAccount(ctx, newUUID(t), frozen.Id.String(), checking.Id.String()); !errors.Is(err, repository.ErrAccountFrozen) {
+			t.Fatalf("CloseAccount(frozen) error = %v, want ErrAccountFrozen", err)
+		}
+		open := CreateAccount(t, repos, alice, "5")
+		if _, _, err := repos.AccountRepository.CloseAccount(ctx, newUUID(t), open.Id.String(), frozen.Id.String()); !errors.Is(err, repository.ErrAccountFrozen) {
+			t.Fatalf("CloseAccount(to frozen) error = %v, want ErrAccountFrozen", err)
+		}
+		assertBalance(t, repos, frozen.Id, "10")
+		assertBalance(t, repos, open.Id, "5")
+		if _, _, err := repos.AccountRepository.CloseAccount(ctx, newUUID(t), uuid.NewString(), checking.Id.String()); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("CloseAccount(unknown) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("accounts are reopened within the grace period", func(t *testing.T) {
+		if _, err := repos.AccountRepository.ReopenAccount(ctx, savings.Id.String(), time.Now().Add(time.Minute)); !errors.Is(err, repository.ErrAccountStatus) {
+			t.Fatalf("ReopenAccount(after the grace period) error = %v, want ErrAccountStatus", err)
+		}
+		if _, err := repos.AccountRepository.ReopenAccount(ctx, checking.Id.String(), time.Now().Add(-time.Minute)); !errors.Is(err, repository.ErrAccountStatus) {
+			t.Fatalf("ReopenAccount(active) error = %v, want ErrAccountStatus", err)
+		}
+
+		reopened, err := repos.AccountRepository.ReopenAccount(ctx, savings.Id.String(), time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("ReopenAccount: %s", err)
+		}
+		if reopened.Status != "active" || reopened.StatusReason != nil || reopened.ClosedAt != nil || !reopened.Balance.IsZero() {
+			t.Fatalf("ReopenAccount = %+v, want an active empty account", reopened)
+		}
+		if err = repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), savings.Id.String(), decimal.NewFromInt(1)); err != nil {
+			t.Fatalf("DepositTransaction(reopened): %s", err)
+		}
+	})
+
+	t.Run("accounts closed by the bank can't be reopened", func(t *testing.T) {
+		closed := CreateAccount(t, repos, alice, "0")
+		reason := "deceased"
+		if _, err := repos.AccountRepository.SetAccountStatus(ctx, closed.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "closed", StatusReason: &reason}); err != nil {
+			t.Fatalf("SetAccountStatus: %s", err)
+		}
+		if account := GetAccount(t, repos, closed.Id); account.ClosedAt == nil {
+			t.Fatalf("account closed by the bank = %+v, want closed_at", account)
+		}
+		if _, err := repos.AccountRepository.ReopenAccount(ctx, closed.Id.String(), time.Now().Add(-time.Minute)); !errors.Is(err, repository.ErrAccountStatus) {
+			t.Fatalf("ReopenAccount(closed by the bank) error = %v, want ErrAccountStatus", err)
+		}
+	})
+
+	t.Run("closings and reopenings are audited", func(t *testing.T) {
+		for _, action := range []string{"account.close", "account.reopen"} {
+			events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{Action: action, TargetId: savings.Id.String()}, 10, 0)
+			if err != nil {
+				t.Fatalf("SearchAuditEvents: %s", err)
+			}
+			if len(*events) != 1 {
+				t.Fatalf("%s events = %+v, want one", action, *events)
+			}
+		}
+	})
+}
+
+func testDeposit(t *testing.T, repos repository.Repositories) {
+	account := CreateAccount(t, repos, CreateUser(t, repos), "0")
+
+	transaction_id := newUUID(t)
+	if err := repos.TransactionRepository.DepositTransaction(context.Background(), transaction_id, account.Id.String(), decimal.RequireFromString("10.50")); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	assertBalance(t, repos, account.Id, "10.50")
+
+	transaction, err := repos.TransactionRepository.GetTransaction(context.Background(), transaction_id.String())
+	if err != nil {
+		t.Fatalf("GetTransaction: %s", err)
+	}
+	if transaction.Type != "deposit" || transaction.FromAccountId != nil || transaction.ToAccountId == nil || *transaction.ToAccountId != account.Id {
+		t.Fatalf("deposit stored as %+v", transaction)
+	}
+	if !transaction.Amount.Equal(decimal.RequireFromString("10.50")) || transaction.DateIssued.IsZero() {
+		t.Fatalf("deposit stored as %+v", transaction)
+	}
+
+	// Amounts are stored with 2 decimal places.
+	if err = repos.TransactionRepository.DepositTransaction(context.Background(), newUUID(t), account.Id.String(), decimal.RequireFromString("0.004")); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	assertBalance(t, repos, account.Id, "10.50")
+
+	if err = repos.TransactionRepository.DepositTransaction(context.Background(), newUUID(t), uuid.New().String(), decimal.NewFromInt(1)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("DepositTransaction(unknown account) error = %v, want sql.ErrNoRows", err)
+	}
+
+	if _, err = repos.TransactionRepository.GetTransaction(context.Background(), uuid.New().String()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetTransaction(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testWithdrawal(t *testing.T, repos repository.Repositories) {
+	account := CreateAccount(t, repos, CreateUser(t, repos), "20")
+
+	transaction_id := newUUID(t)
+	if err := repos.TransactionRepository.WithdrawalTransaction(context.Background(), transaction_id, account.Id.String(), decimal.RequireFromString("7.25")); err != nil {
+		t.Fatalf("WithdrawalTransaction: %s", err)
+	}
+	assertBalance(t, repos, account.Id, "12.75")
+
+	transaction, err := repos.TransactionRepository.GetTransaction(context.Background(), transaction_id.String())
+	if err != nil {
+		t.Fatalf("GetTransaction: %s", err)
+	}
+	if transaction.Type != "withdrawal" || transaction.ToAccountId != nil || transaction.FromAccountId == nil || *transaction.FromAccountId != account.Id {
+		t.Fatalf("withdrawal stored as %+v", transaction)
+	}
+
+	if err = repos.TransactionRepository.WithdrawalTransaction(context.Background(), newUUID(t), uuid.New().String(), decimal.NewFromInt(1)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("WithdrawalTransaction(unknown account) error = %v, want sql.ErrNoRows", err)
+	}
+
+	if err = repos.TransactionRepository.WithdrawalTransaction(context.Background(), newUUID(t), account.Id.String(), decimal.RequireFromString("12.76")); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("WithdrawalTransaction(above balance) error = %v, want ErrInsufficientBalance", err)
+	}
+	assertBalance(t, repos, account.Id, "12.75")
+}
+
+func testTransfer(t *testing.T, repos repository.Repositories) {
+	from := CreateAccount(t, repos, CreateUser(t, repos), "100")
+	to := CreateAccount(t, repos, CreateUser(t, repos), "5")
+
+	transaction_id := newUUID(t)
+	if err := repos.TransactionRepository.TransferTransaction(context.Background(), transaction_id, from.Id.String(), to.Id.String(), decimal.RequireFromString("30")); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+	assertBalance(t, repos, from.Id, "70")
+	assertBalance(t, repos, to.Id, "35")
+
+	transaction, err := repos.TransactionRepository.GetTransaction(context.Background(), transaction_id.String())
+	if err != nil {
+		t.Fatalf("GetTransaction: %s", err)
+	}
+	if transaction.Type != "transfer" || *transaction.FromAccountId != from.Id || *transaction.ToAccountId != to.Id {
+		t.Fatalf("transfer stored as %+v", transaction)
+	}
+
+	if err = repos.TransactionRepository.TransferTransaction(context.Background(), newUUID(t), from.Id.String(), uuid.New().String(), decimal.NewFromInt(1)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("TransferTransaction(unknown receiver) error = %v, want sql.ErrNoRows", err)
+	}
+	assertBalance(t, repos, from.Id, "70")
+
+	if err = repos.TransactionRepository.TransferTransaction(context.Background(), newUUID(t), from.Id.String(), to.Id.String(), decimal.RequireFromString("70.01")); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("TransferTransaction(above balance) error = %v, want ErrInsufficientBalance", err)
+	}
+	assertBalance(t, repos, from.Id, "70")
+	assertBalance(t, repos, to.Id, "35")
+
+	// The same account spelled two ways is still one account: moving money to itself must not create any.
+	if err = repos.TransactionRepository.TransferTransaction(context.Background(), newUUID(t), strings.ToUpper(from.Id.String()), from.Id.String(), decimal.NewFromInt(10)); !errors.Is(err, repository.ErrSameAccount) {
+		t.Fatalf("TransferTransaction(same account) error = %v, want ErrSameAccount", err)
+	}
+	assertBalance(t, repos, from.Id, "70")
+
+	if err = repos.TransactionRepository.TransferTransaction(context.Background(), newUUID(t), strings.ToUpper(from.Id.String()), strings.ToUpper(to.Id.String()), decimal.NewFromInt(10)); err != nil {
+		t.Fatalf("TransferTransaction(upper-case ids): %s", err)
+	}
+	assertBalance(t, repos, from.Id, "60")
+	assertBalance(t, repos, to.Id, "45")
+}
+
+func testFailedMovementsAreAtomic(t *testing.T, repos repository.Repositories) {
+	from := CreateAccount(t, repos, CreateUser(t, repos), "50")
+	to := CreateAccount(t, repos, CreateUser(t, repos), "0")
+
+	transaction_id := newUUID(t)
+	if err := repos.TransactionRepository.TransferTransaction(context.Background(), transaction_id, from.Id.String(), to.Id.String(), decimal.NewFromInt(10)); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+
+	// Reusing a transaction id must fail without touching any balance.
+	if err := repos.TransactionRepository.TransferTransaction(context.Background(), transaction_id, from.Id.String(), to.Id.String(), decimal.NewFromInt(10)); err == nil {
+		t.Fatal("TransferTransaction with a duplicated id succeeded")
+	}
+	if err := repos.TransactionRepository.DepositTransaction(context.Background(), transaction_id, to.Id.String(), decimal.NewFromInt(10)); err == nil {
+		t.Fatal("DepositTransaction with a duplicated id succeeded")
+	}
+
+	assertBalance(t, repos, from.Id, "40")
+	assertBalance(t, repos, to.Id, "10")
+	assertReconciled(t, repos, from.Id, to.Id)
+}
+
+// testCanceledContext checks that a caller that went away doesn't move money.
+func testCanceledContext(t *testing.T, repos repository.Repositories) {
+	from := CreateAccount(t, repos, CreateUser(t, repos), "50")
+	to := CreateAccount(t, repos, CreateUser(t, repos), "0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), from.Id.String(), to.Id.String(), decimal.NewFromInt(10)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("TransferTransaction(canceled) error = %v, want context.Canceled", err)
+	}
+	if err := repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), to.Id.String(), decimal.NewFromInt(10)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("DepositTransaction(canceled) error = %v, want context.Canceled", err)
+	}
+	if _, err := repos.AccountRepository.GetAccount(ctx, from.Id.String()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAccount(canceled) error = %v, want context.Canceled", err)
+	}
+
+	assertBalance(t, repos, from.Id, "50")
+	assertBalance(t, repos, to.Id, "0")
+}
+
+func testAccountTransactions(t *testing.T, repos repository.Repositories) {
+	account := CreateAccount(t, repos, CreateUser(t, repos), "0")
+	other := CreateAccount(t, repos, CreateUser(t, repos), "100")
+
+	ids := []uuid.UUID{}
+	for i := 1; i <= 3; i++ {
+		id := newUUID(t)
+		if err := repos.TransactionRepository.TransferTransaction(context.Background(), id, other.Id.String(), account.Id.String(), decimal.NewFromInt(int64(i))); err != nil {
+			t.Fatalf("TransferTransaction: %s", err)
+		}
+		ids = append(ids, id)
+	}
+
+	transactions, err := repos.TransactionRepository.GetAccountTransactions(context.Background(), account.Id.String(), 2, 0)
+	if err != nil {
+		t.Fatalf("GetAccountTransactions: %s", err)
+	}
+	if len(*transactions) != 2 || (*transactions)[0].Id != ids[2] || (*transactions)[1].Id != ids[1] {
+		t.Fatalf("GetAccountTransactions(limit 2) = %+v, want the two latest transfers, newest first", *transactions)
+	}
+
+	// The sender also sees the initial deposit.
+	transactions, err = repos.TransactionRepository.GetAccountTransactions(context.Background(), other.Id.String(), 10, 0)
+	if err != nil {
+		t.Fatalf("GetAccountTransactions: %s", err)
+	}
+	if len(*transactions) != 4 {
+		t.Fatalf("GetAccountTransactions(sender) returned %d transactions, want 4", len(*transactions))
+	}
+}
+
+func testReverse(t *testing.T, repos repository.Repositories) {
+	from := CreateAccount(t, repos, CreateUser(t, repos), "100")
+	to := CreateAccount(t, repos, CreateUser(t, repos), "0")
+
+	transfer_id := newUUID(t)
+	if err := repos.TransactionRepository.TransferTransaction(context.Background(), transfer_id, from.Id.String(), to.Id.String(), decimal.NewFromInt(40)); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+
+	reversal, err := repos.TransactionRepository.ReverseTransaction(context.Background(), newUUID(t), transfer_id.String())
+	if err != nil {
+		t.Fatalf("ReverseTransaction: %s", err)
+	}
+	if reversal.Type != "transfer" || *reversal.FromAccountId != to.Id || *reversal.ToAccountId != from.Id || reversal.ReversalOf == nil || *reversal.ReversalOf != transfer_id {
+		t.Fatalf("reversal stored as %+v", reversal)
+	}
+	assertBalance(t, repos, from.Id, "100")
+	assertBalance(t, repos, to.Id, "0")
+	if found, err := repos.TransactionRepository.GetReversal(context.Background(), transfer_id.String()); err != nil || found.Id != reversal.Id {
+		t.Fatalf("GetReversal = %+v, %v, want %s", found, err, reversal.Id)
+	}
+	if _, err = repos.TransactionRepository.GetReversal(context.Background(), reversal.Id.String()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetReversal(not reversed) error = %v, want sql.ErrNoRows", err)
+	}
+
+	if _, err = repos.TransactionRepository.ReverseTransaction(context.Background(), newUUID(t), transfer_id.String()); !errors.Is(err, repository.ErrAlreadyReversed) {
+		t.Fatalf("second ReverseTransaction error = %v, want ErrAlreadyReversed", err)
+	}
+	if _, err = repos.TransactionRepository.ReverseTransaction(context.Background(), newUUID(t), reversal.Id.String()); !errors.Is(err, repository.ErrReversalOfReversal) {
+		t.Fatalf("ReverseTransaction(reversal) error = %v, want ErrReversalOfReversal", err)
+	}
+
+	// A deposit whose money was already spent can't be reversed.
+	deposit_id := newUUID(t)
+	if err = repos.TransactionRepository.DepositTransaction(context.Background(), deposit_id, to.Id.String(), decimal.NewFromInt(10)); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	if err = repos.TransactionRepository.WithdrawalTransaction(context.Background(), newUUID(t), to.Id.String(), decimal.NewFromInt(5)); err != nil {
+		t.Fatalf("WithdrawalTransaction: %s", err)
+	}
+	if _, err = repos.TransactionRepository.ReverseTransaction(context.Background(), newUUID(t), deposit_id.String()); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("ReverseTransaction(spent deposit) error = %v, want ErrInsufficientBalance", err)
+	}
+	assertBalance(t, repos, to.Id, "5")
+
+	assertReconciled(t, repos, from.Id, to.Id)
+}
+
+/*
+testConcurrentTransfers sends money back and forth between two accounts at the same time.
+Backends may reject conflicting movements (e.g. serialization failures), so each transfer is
+retried, but the final balances must account for every successful one.
+*/
+func testConcurrentTransfers(t *testing.T, repos repository.Repositories) {
+	first := CreateAccount(t, repos, CreateUser(t, repos), "1000")
+	second := CreateAccount(t, repos, CreateUser(t, repos), "1000")
+
+	const transfers = 40
+	var wg sync.WaitGroup
+	errs := make(chan error, transfers)
+
+	for i := 0; i < transfers; i++ {
+		from, to := first.Id, second.Id
+		if i%2 == 1 {
+			from, to = to, from
+		}
+		amount := decimal.NewFromInt(int64(i + 1))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id, err := uuid.NewV7()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for attempt := 0; attempt < 20; attempt++ {
+				if err = repos.TransactionRepository.TransferTransaction(context.Background(), id, from.String(), to.String(), amount); err == nil {
+					return
+				}
+			}
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+
+	// Transfers of 1, 3, 5... go first -> second and transfers of 2, 4, 6... come back, so first gains 20 overall.
+	assertBalance(t, repos, first.Id, "1020")
+	assertBalance(t, repos, second.Id, "980")
+	assertReconciled(t, repos, first.Id, second.Id)
+}
+
+func assertReconciled(t *testing.T, repos repository.Repositories, account_ids ...uuid.UUID) {
+	t.Helper()
+
+	mismatches, err := repos.TransactionRepository.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile: %s", err)
+	}
+
+	for _, mismatch := range *mismatches {
+		for _, id := range account_ids {
+			if mismatch.Id == id {
+				t.Fatalf("account %s balance %s doesn't match its transactions (%s)", id, mismatch.Balance, mismatch.ExpectedBalance)
+			}
+		}
+	}
+}
+
+func testSessions(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	user_id := uuid.New().String()
+	first, second := uuid.New().String(), uuid.New().String()
+
+	for _, session_id := range []string{first, second} {
+		if err := repos.SessionRepository.CreateSession(ctx, session_id, user_id); err != nil {
+			t.Fatalf("CreateSession: %s", err)
+		}
+	}
+
+	got, err := repos.SessionRepository.GetSessionUserId(ctx, first)
+	if err != nil || got != user_id {
+		t.Fatalf("GetSessionUserId = %q, %v, want %q", got, err, user_id)
+	}
+
+	if _, err = repos.SessionRepository.GetSessionUserId(ctx, uuid.New().String()); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Fatalf("GetSessionUserId(unknown) error = %v, want ErrSessionNotFound", err)
+	}
+
+	if err = repos.SessionRepository.RevokeSession(ctx, first); err != nil {
+		t.Fatalf("RevokeSession: %s", err)
+	}
+	if _, err = repos.SessionRepository.GetSessionUserId(ctx, first); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Fatalf("GetSessionUserId(revoked) error = %v, want ErrSessionNotFound", err)
+	}
+	if err = repos.SessionRepository.RevokeSession(ctx, first); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Fatalf("RevokeSession(revoked) error = %v, want ErrSessionNotFound", err)
+	}
+
+	third := uuid.New().String()
+	if err = repos.SessionRepository.CreateSession(ctx, third, user_id); err != nil {
+		t.Fatalf("CreateSession: %s", err)
+	}
+
+	revoked, err := repos.SessionRepository.RevokeUserSessions(ctx, user_id)
+	if err != nil || revoked != 2 {
+		t.Fatalf("RevokeUserSessions = %d, %v, want 2", revoked, err)
+	}
+	for _, session_id := range []string{second, third} {
+		if _, err = repos.SessionRepository.GetSessionUserId(ctx, session_id); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetSessionUserId after RevokeUserSessions error = %v, want ErrSessionNotFound", err)
+		}
+	}
+}
+
+func testAudit(t *testing.T, repos repository.Repositories) {
+	target_id := uuid.New().String()
+	reason := "conformance"
+
+	for _, action := range []string{"account.freeze", "account.unfreeze"} {
+		err := repos.AuditRepository.CreateAuditEvent(context.Background(), model.AuditEvent{
+			Actor:      "conformance",
+			Action:     action,
+			TargetType: "account",
+			TargetId:   target_id,
+			Reason:     &reason,
+			Details:    []byte(`{"key": "value"}`),
+		})
+		if err != nil {
+			t.Fatalf("CreateAuditEvent: %s", err)
+		}
+	}
+
+	events, err := repos.AuditRepository.GetAuditEvents(context.Background(), "account", target_id, 10, 0)
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %s", err)
+	}
+	if len(*events) != 2 || (*events)[0].Action != "account.unfreeze" || (*events)[1].Action != "account.freeze" {
+		t.Fatalf("GetAuditEvents = %+v, want both events, newest first", *events)
+	}
+	if event := (*events)[0]; event.Actor != "conformance" || event.Reason == nil || *event.Reason != reason || event.CreatedAt.IsZero() {
+		t.Fatalf("audit event stored as %+v", event)
+	}
+}
+
+func testAuditedChanges(t *testing.T, repos repository.Repositories) {
+	actor := model.AuditActor{Actor: "user:conformance", Ip: "203.0.113.7", UserAgent: "conformance/1.0", RequestId: uuid.NewString(), Reason: "conformance"}
+	ctx := repository.WithAuditActor(context.Background(), actor)
+
+	user := CreateUser(t, repos)
+	account := CreateAccount(t, repos, user, "100.00")
+	other := CreateAccount(t, repos, user, "0.00")
+
+	transaction_id := newUUID(t)
+	if err := repos.TransactionRepository.TransferTransaction(ctx, transaction_id, account.Id.String(), other.Id.String(), decimal.RequireFromString("40.00")); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+	reason := "kyc_review"
+	if _, err := repos.AccountRepository.SetAccountStatus(ctx, other.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_debit", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus: %s", err)
+	}
+	if err := repos.UserRepository.DisableUser(ctx, user.Id); err != nil {
+		t.Fatalf("DisableUser: %s", err)
+	}
+
+	// A failed movement leaves no trace in the audit trail either.
+	if err := repos.TransactionRepository.WithdrawalTransaction(ctx, newUUID(t), account.Id.String(), decimal.RequireFromString("1000.00")); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("WithdrawalTransaction error = %v, want ErrInsufficientBalance", err)
+	}
+
+	events, err := repos.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{UserId: &user.Id}, 100, 0)
+	if err != nil {
+		t.Fatalf("SearchAuditEvents: %s", err)
+	}
+
+	actions := []string{}
+	for _, event := range *events {
+		actions = append(actions, event.Action)
+	}
+	// Newest first; the setup wasn't made by any actor, so it's recorded as the system's.
+	want := []string{
+		"user.disable", "account.set_status", "transaction.transfer", "account.add_member", "account.create", "transaction.deposit", "account.add_member", "account.create", "user.register",
+	}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("audited actions = %v, want %v", actions, want)
+	}
+
+	for _, event := range (*events)[:3] {
+		if event.Actor != actor.Actor || event.Ip == nil || *event.Ip != actor.Ip || event.UserAgent == nil || *event.UserAgent != actor.UserAgent ||
+			event.RequestId == nil || *event.RequestId != actor.RequestId || event.Reason == nil || *event.Reason != actor.Reason {
+			t.Errorf("%s recorded as %+v, want the actor of its context", event.Action, event)
+		}
+	}
+	if event := (*events)[len(*events)-1]; event.Actor != "system" || event.Ip != nil || event.Before != nil || event.After == nil {
+		t.Errorf("user.register recorded as %+v", event)
+	}
+
+	transfer := (*events)[2]
+	if transfer.TargetType != "transaction" || transfer.TargetId != transaction_id.String() || transfer.Before == nil || transfer.After == nil {
+		t.Fatalf("transfer recorded as %+v", transfer)
+	}
+	before, after := map[string]map[string]string{}, map[string]map[string]string{}
+	if err = transfer.Before.Unmarshal(&before); err != nil {
+		t.Fatal(err)
+	}
+	if err = transfer.After.Unmarshal(&after); err != nil {
+		t.Fatal(err)
+	}
+	if before["balances"][account.Id.String()] != "100.00" || before["balances"][other.Id.String()] != "0.00" ||
+		after["balances"][account.Id.String()] != "60.00" || after["balances"][other.Id.String()] != "40.00" {
+		t.Fatalf("transfer balances recorded as %s -> %s", *transfer.Before, *transfer.After)
+	}
+
+	status := (*events)[1]
+	if status.TargetId != other.Id.String() || !strings.Contains(string(*status.Before), `"status":"active"`) || !strings.Contains(string(*status.After), `"status":"frozen_debit","status_reason":"kyc_review"`) {
+		t.Fatalf("account.set_status recorded as %s -> %s", *status.Before, *status.After)
+	}
+
+	filtered, err := repos.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Actor: actor.Actor, Action: "account.set_status", TargetType: "account", TargetId: other.Id.String()}, 10, 0)
+	if err != nil || len(*filtered) != 1 || (*filtered)[0].Id != status.Id {
+		t.Fatalf("SearchAuditEvents by actor, action and target = %+v, %v", filtered, err)
+	}
+	since := time.Now().Add(time.Hour)
+	if later, err := repos.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{UserId: &user.Id, Since: &since}, 10, 0); err != nil || len(*later) != 0 {
+		t.Fatalf("SearchAuditEvents since an hour from now = %+v, %v", later, err)
+	}
+	if page, err := repos.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{UserId: &user.Id}, 2, 1); err != nil || len(*page) != 2 || (*page)[0].Action != "account.set_status" {
+		t.Fatalf("SearchAuditEvents page = %+v, %v", page, err)
+	}
+}
+
+func testApiKeys(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	user := CreateUser(t, repos)
+	key_hash := strings.Repeat("a", 64)
+
+	if _, err := repos.ApiKeyRepository.CreateApiKey(ctx, uuid.New(), "orphan", strings.Repeat("b", 64), "bb_orphan"); err == nil {
+		t.Fatal("CreateApiKey for an unknown user succeeded")
+	}
+
+	created, err := repos.ApiKeyRepository.CreateApiKey(ctx, user.Id, "ci", key_hash, "bb_aaaaaaaa")
+	if err != nil {
+		t.Fatalf("CreateApiKey: %s", err)
+	}
+	if created.UserId != user.Id || created.Name != "ci" || created.Prefix != "bb_aaaaaaaa" || created.RevokedAt != nil || created.CreatedAt.IsZero() {
+		t.Fatalf("CreateApiKey stored %+v", created)
+	}
+
+	if _, err = repos.ApiKeyRepository.CreateApiKey(ctx, user.Id, "duplicate", key_hash, "bb_aaaaaaaa"); err == nil {
+		t.Fatal("CreateApiKey with a duplicated hash succeeded")
+	}
+
+	found, err := repos.ApiKeyRepository.GetApiKeyByHash(ctx, key_hash)
+	if err != nil || found.Id != created.Id {
+		t.Fatalf("GetApiKeyByHash = %+v, %v", found, err)
+	}
+	if _, err = repos.ApiKeyRepository.GetApiKeyByHash(ctx, strings.Repeat("c", 64)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetApiKeyByHash(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	second, err := repos.ApiKeyRepository.CreateApiKey(ctx, user.Id, "cron", strings.Repeat("d", 64), "bb_dddddddd")
+	if err != nil {
+		t.Fatalf("CreateApiKey: %s", err)
+	}
+	keys, err := repos.ApiKeyRepository.GetUserApiKeys(ctx, user.Id)
+	if err != nil || len(*keys) != 2 || (*keys)[0].Id != second.Id || (*keys)[1].Id != created.Id {
+		t.Fatalf("GetUserApiKeys = %+v, %v, want both keys, newest first", keys, err)
+	}
+
+	if err = repos.ApiKeyRepository.RevokeApiKey(ctx, created.Id); err != nil {
+		t.Fatalf("RevokeApiKey: %s", err)
+	}
+	if found, err = repos.ApiKeyRepository.GetApiKeyByHash(ctx, key_hash); err != nil || found.RevokedAt == nil {
+		t.Fatalf("GetApiKeyByHash(revoked) = %+v, %v, want RevokedAt set", found, err)
+	}
+	if err = repos.ApiKeyRepository.RevokeApiKey(ctx, created.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("RevokeApiKey(revoked) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testEvents(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	user_id := CreateUser(t, repos).Id.String()
+	other_user_id := CreateUser(t, repos).Id.String()
+
+	latest, err := repos.EventRepository.GetLatestEventId(ctx, user_id)
+	if err != nil || latest != "0-0" {
+		t.Fatalf("GetLatestEventId(no events) = %q, %v, want 0-0", latest, err)
+	}
+
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		id, err := repos.EventRepository.PublishEvent(ctx, user_id, "test.event", json.RawMessage(fmt.Sprintf(`{"n":%d}`, i)))
+		if err != nil {
+			t.Fatalf("PublishEvent: %s", err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err = repos.EventRepository.PublishEvent(ctx, other_user_id, "test.event", json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("PublishEvent: %s", err)
+	}
+
+	if latest, err = repos.EventRepository.GetLatestEventId(ctx, user_id); err != nil || latest != ids[2] {
+		t.Fatalf("GetLatestEventId = %q, %v, want %q", latest, err, ids[2])
+	}
+
+	events, err := repos.EventRepository.ReadEvents(ctx, user_id, "0-0", 10, 0)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("ReadEvents(0-0) = %+v, %v, want the user's 3 events", events, err)
+	}
+	for i, event := range events {
+		if event.Id != ids[i] || event.Type != "test.event" || string(event.Data) != fmt.Sprintf(`{"n":%d}`, i) {
+			t.Fatalf("ReadEvents()[%d] = %+v, want event %q", i, event, ids[i])
+		}
+	}
+
+	if events, err = repos.EventRepository.ReadEvents(ctx, user_id, ids[0], 1, 0); err != nil || len(events) != 1 || events[0].Id != ids[1] {
+		t.Fatalf("ReadEvents(after first, limit 1) = %+v, %v, want the second event", events, err)
+	}
+
+	start := time.Now()
+	if events, err = repos.EventRepository.ReadEvents(ctx, user_id, ids[2], 10, 100*time.Millisecond); err != nil || len(events) != 0 {
+		t.Fatalf("ReadEvents(after latest) = %+v, %v, want no events", events, err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("ReadEvents(after latest) returned before waiting")
+	}
+
+	// A waiting reader is woken up by the next event.
+	published := make(chan string, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		id, _ := repos.EventRepository.PublishEvent(ctx, user_id, "test.later", json.RawMessage(`{}`))
+		published <- id
+	}()
+
+	if events, err = repos.EventRepository.ReadEvents(ctx, user_id, ids[2], 10, 5*time.Second); err != nil || len(events) != 1 || events[0].Type != "test.later" {
+		t.Fatalf("ReadEvents(waiting) = %+v, %v, want the later event", events, err)
+	}
+	if id := <-published; events[0].Id != id {
+		t.Fatalf("ReadEvents(waiting) returned id %q, want %q", events[0].Id, id)
+	}
+}
+
+// dispatchOutbox dispatches every pending outbox event, including those of other tests sharing the database.
+func dispatchOutbox(t *testing.T, repos repository.Repositories) {
+	t.Helper()
+
+	for {
+		dispatched, err := repos.WebhookRepository.DispatchOutboxEvents(context.Background(), 100)
+		if err != nil {
+			t.Fatalf("DispatchOutboxEvents: %s", err)
+		}
+		if dispatched == 0 {
+			return
+		}
+	}
+}
+
+func endpointDeliveries(t *testing.T, repos repository.Repositories, endpoint_id uuid.UUID) map[string][]model.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := repos.WebhookRepository.GetEndpointDeliveries(context.Background(), endpoint_id, 100, 0)
+	if err != nil {
+		t.Fatalf("GetEndpointDeliveries: %s", err)
+	}
+
+	by_type := map[string][]model.WebhookDelivery{}
+	for _, delivery := range *deliveries {
+		if delivery.EndpointId != endpoint_id {
+			t.Fatalf("GetEndpointDeliveries(%s) returned %+v", endpoint_id, delivery)
+		}
+		by_type[delivery.EventType] = append(by_type[delivery.EventType], delivery)
+	}
+
+	return by_type
+}
+
+func testWebhooks(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	bob := CreateUser(t, repos)
+
+	if _, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, uuid.New(), "https://orphan.example", "secret", nil); err == nil {
+		t.Fatal("CreateWebhookEndpoint for an unknown user succeeded")
+	}
+
+	all, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, alice.Id, "https://alice.example/all", "whsec_all", nil)
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %s", err)
+	}
+	if all.UserId != alice.Id || all.Url != "https://alice.example/all" || all.Secret != "whsec_all" || len(all.EventTypes) != 0 || all.CreatedAt.IsZero() {
+		t.Fatalf("CreateWebhookEndpoint stored %+v", all)
+	}
+	disabled_only, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, alice.Id, "https://alice.example/disabled", "whsec_disabled", []string{"account.disabled"})
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %s", err)
+	}
+	bobs, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, bob.Id, "https://bob.example", "whsec_bob", nil)
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint: %s", err)
+	}
+
+	endpoints, err := repos.WebhookRepository.GetUserWebhookEndpoints(ctx, alice.Id)
+	if err != nil || len(*endpoints) != 2 || (*endpoints)[0].Id != disabled_only.Id || (*endpoints)[1].Id != all.Id {
+		t.Fatalf("GetUserWebhookEndpoints = %+v, %v, want both endpoints, newest first", endpoints, err)
+	}
+	if found, err := repos.WebhookRepository.GetWebhookEndpoint(ctx, disabled_only.Id); err != nil || found.Secret != "whsec_disabled" || fmt.Sprint(found.EventTypes) != "[account.disabled]" {
+		t.Fatalf("GetWebhookEndpoint = %+v, %v", found, err)
+	}
+
+	checking := CreateAccount(t, repos, alice, "0")
+	empty := CreateAccount(t, repos, alice, "0")
+	savings := CreateAccount(t, repos, bob, "0")
+
+	transaction_id := newUUID(t)
+	if err = repos.TransactionRepository.DepositTransaction(ctx, transaction_id, checking.Id.String(), decimal.RequireFromString("100")); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	transfer_id := newUUID(t)
+	if err = repos.TransactionRepository.TransferTransaction(ctx, transfer_id, checking.Id.String(), savings.Id.String(), decimal.RequireFromString("25.5")); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+	// Failed movements don't leave events behind.
+	if err = repos.TransactionRepository.WithdrawalTransaction(ctx, newUUID(t), checking.Id.String(), decimal.RequireFromString("1000")); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("WithdrawalTransaction error = %v, want ErrInsufficientBalance", err)
+	}
+	if err = repos.AccountRepository.DisableAccount(ctx, empty.Id.String()); err != nil {
+		t.Fatalf("DisableAccount: %s", err)
+	}
+
+	dispatchOutbox(t, repos)
+
+	deliveries := endpointDeliveries(t, repos, all.Id)
+	if len(deliveries["transaction.created"]) != 2 || len(deliveries["account.balance_changed"]) != 2 || len(deliveries["account.disabled"]) != 1 || len(deliveries) != 3 {
+		t.Fatalf("deliveries to the catch-all endpoint = %+v", deliveries)
+	}
+	for _, delivery := range deliveries["transaction.created"] {
+		if delivery.Status != "pending" || delivery.Attempts != 0 || delivery.EventCreatedAt.IsZero() {
+			t.Fatalf("new delivery %+v", delivery)
+		}
+	}
+
+	created := map[string]string{}
+	for _, delivery := range deliveries["transaction.created"] {
+		data := map[string]any{}
+		if err = json.Unmarshal(delivery.EventData, &data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = time.Parse(time.RFC3339Nano, fmt.Sprint(data["issued_at"])); err != nil || data["reversal_of"] != nil {
+			t.Fatalf("transaction.created data %s", delivery.EventData)
+		}
+		created[fmt.Sprint(data["id"])] = fmt.Sprint(data["type"], " ", data["amount"], " ", data["from_account_id"], " ", data["to_account_id"])
+	}
+	if created[transaction_id.String()] != fmt.Sprint("deposit 100.00 <nil> ", checking.Id) || created[transfer_id.String()] != fmt.Sprint("transfer 25.50 ", checking.Id, " ", savings.Id) {
+		t.Fatalf("transaction.created data = %v", created)
+	}
+
+	balances := map[string]bool{}
+	for _, delivery := range deliveries["account.balance_changed"] {
+		data := map[string]string{}
+		if err = json.Unmarshal(delivery.EventData, &data); err != nil {
+			t.Fatal(err)
+		}
+		balances[data["account_id"]+" "+data["balance"]+" "+data["transaction_id"]] = true
+	}
+	if !balances[fmt.Sprint(checking.Id, " 100.00 ", transaction_id)] || !balances[fmt.Sprint(checking.Id, " 74.50 ", transfer_id)] {
+		t.Fatalf("account.balance_changed deliveries = %v", balances)
+	}
+
+	disabled := map[string]string{}
+	if err = json.Unmarshal(deliveries["account.disabled"][0].EventData, &disabled); err != nil || fmt.Sprint(disabled) != fmt.Sprint(map[string]string{"account_id": empty.Id.String()}) {
+		t.Fatalf("account.disabled data %s", deliveries["account.disabled"][0].EventData)
+	}
+
+	if filtered := endpointDeliveries(t, repos, disabled_only.Id); len(filtered) != 1 || len(filtered["account.disabled"]) != 1 {
+		t.Fatalf("deliveries to the account.disabled endpoint = %+v", filtered)
+	}
+
+	// Bob only hears about the transfer to his account.
+	bob_deliveries := endpointDeliveries(t, repos, bobs.Id)
+	if len(bob_deliveries["transaction.created"]) != 1 || len(bob_deliveries["account.balance_changed"]) != 1 || len(bob_deliveries) != 2 {
+		t.Fatalf("deliveries to bob's endpoint = %+v", bob_deliveries)
+	}
+
+	// Dispatching again doesn't duplicate deliveries.
+	dispatchOutbox(t, repos)
+	if again := endpointDeliveries(t, repos, all.Id); len(again["transaction.created"]) != 2 {
+		t.Fatalf("deliveries after dispatching again = %+v", again)
+	}
+
+	// Claimed deliveries are postponed by the lease, so they aren't claimed twice.
+	claimed := map[uuid.UUID]bool{}
+	for {
+		due, err := repos.WebhookRepository.ClaimDueDeliveries(ctx, 100, time.Hour)
+		if err != nil {
+			t.Fatalf("ClaimDueDeliveries: %s", err)
+		}
+		if len(*due) == 0 {
+			break
+		}
+		for _, delivery := range *due {
+			if claimed[delivery.Id] {
+				t.Fatalf("delivery %s claimed twice", delivery.Id)
+			}
+			claimed[delivery.Id] = true
+		}
+	}
+
+	delivery := deliveries["account.disabled"][0]
+	if !claimed[delivery.Id] {
+		t.Fatal("ClaimDueDeliveries skipped a due delivery")
+	}
+
+	status_code := 500
+	failure := "Internal Server Error"
+	retry_at := time.Now().Add(time.Minute)
+	if err = repos.WebhookRepository.RecordDeliveryAttempt(ctx, model.WebhookDeliveryAttempt{DeliveryId: delivery.Id, StatusCode: &status_code, Error: &failure, DurationMs: 12}, "pending", retry_at); err != nil {
+		t.Fatalf("RecordDeliveryAttempt: %s", err)
+	}
+	if err = repos.WebhookRepository.RecordDeliveryAttempt(ctx, model.WebhookDeliveryAttempt{DeliveryId: delivery.Id, DurationMs: 3}, "dead", retry_at); err != nil {
+		t.Fatalf("RecordDeliveryAttempt: %s", err)
+	}
+
+	found, err := repos.WebhookRepository.GetWebhookDelivery(ctx, delivery.Id)
+	if err != nil || found.Status != "dead" || found.Attempts != 2 || found.EventType != "account.disabled" {
+		t.Fatalf("GetWebhookDelivery = %+v, %v, want a dead delivery after 2 attempts", found, err)
+	}
+	attempts, err := repos.WebhookRepository.GetDeliveryAttempts(ctx, delivery.Id)
+	if err != nil || len(*attempts) != 2 {
+		t.Fatalf("GetDeliveryAttempts = %+v, %v, want 2 attempts", attempts, err)
+	}
+	if first := (*attempts)[0]; first.StatusCode == nil || *first.StatusCode != 500 || first.Error == nil || *first.Error != failure || first.DurationMs != 12 || first.AttemptedAt.IsZero() {
+		t.Fatalf("first attempt %+v", first)
+	}
+	if second := (*attempts)[1]; second.StatusCode != nil || second.Error != nil {
+		t.Fatalf("second attempt %+v", second)
+	}
+
+	if err = repos.WebhookRepository.RedeliverWebhook(ctx, delivery.Id); err != nil {
+		t.Fatalf("RedeliverWebhook: %s", err)
+	}
+	due, err := repos.WebhookRepository.ClaimDueDeliveries(ctx, 100, time.Hour)
+	if err != nil || len(*due) != 1 || (*due)[0].Id != delivery.Id || (*due)[0].Attempts != 2 {
+		t.Fatalf("ClaimDueDeliveries after RedeliverWebhook = %+v, %v, want the redelivered delivery", due, err)
+	}
+	if err = repos.WebhookRepository.RedeliverWebhook(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("RedeliverWebhook(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Deleted endpoints are hidden and get no more deliveries.
+	if err = repos.WebhookRepository.DeleteWebhookEndpoint(ctx, all.Id); err != nil {
+		t.Fatalf("DeleteWebhookEndpoint: %s", err)
+	}
+	if err = repos.WebhookRepository.DeleteWebhookEndpoint(ctx, all.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("DeleteWebhookEndpoint(deleted) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err = repos.WebhookRepository.GetWebhookEndpoint(ctx, all.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetWebhookEndpoint(deleted) error = %v, want sql.ErrNoRows", err)
+	}
+	if err = repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), checking.Id.String(), decimal.NewFromInt(1)); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	dispatchOutbox(t, repos)
+	if after := endpointDeliveries(t, repos, all.Id); len(after["transaction.created"]) != 2 {
+		t.Fatalf("deliveries to a deleted endpoint = %+v", after)
+	}
+}
+
+func testProcessorCharges(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	checking := CreateAccount(t, repos, alice, "0")
+
+	charge := model.ProcessorCharge{Id: "ch_" + newUUID(t).String(), AccountId: checking.Id, Amount: decimal.RequireFromString("40.00"), Status: "pending"}
+	deposit_id := newUUID(t)
+
+	applied, changed, err := repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+charge.Id, "charge.pending", charge, deposit_id)
+	if err != nil || changed || applied.Status != "pending" || applied.TransactionId != nil {
+		t.Fatalf("ApplyChargeEvent(pending) = %+v, %v, %v, want a new pending charge", applied, changed, err)
+	}
+	assertBalance(t, repos, checking.Id, "0")
+
+	if _, _, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+charge.Id, "charge.pending", charge, deposit_id); !errors.Is(err, repository.ErrEventReplayed) {
+		t.Fatalf("ApplyChargeEvent of a replayed event = %v, want ErrEventReplayed", err)
+	}
+
+	tampered := charge
+	tampered.Amount = decimal.RequireFromString("400.00")
+	tampered.Status = "succeeded"
+	if _, _, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_2"+charge.Id, "charge.succeeded", tampered, deposit_id); !errors.Is(err, repository.ErrChargeMismatch) {
+		t.Fatalf("ApplyChargeEvent with another amount = %v, want ErrChargeMismatch", err)
+	}
+
+	charge.Status = "succeeded"
+	applied, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_3"+charge.Id, "charge.succeeded", charge, deposit_id)
+	if err != nil || !changed || applied.Status != "succeeded" || applied.TransactionId == nil || *applied.TransactionId != deposit_id {
+		t.Fatalf("ApplyChargeEvent(succeeded) = %+v, %v, %v, want the charge deposited", applied, changed, err)
+	}
+	assertBalance(t, repos, checking.Id, "40")
+	if deposit, err := repos.TransactionRepository.GetTransaction(ctx, deposit_id.String()); err != nil || deposit.Type != "deposit" || deposit.ToAccountId == nil || *deposit.ToAccountId != checking.Id {
+		t.Fatalf("GetTransaction of the deposit = %+v, %v", deposit, err)
+	}
+
+	// The processor may notify a charge again, or late, with a new event id: it's only deposited once.
+	if _, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_4"+charge.Id, "charge.succeeded", charge, newUUID(t)); err != nil || changed {
+		t.Fatalf("ApplyChargeEvent(succeeded) again = %v, %v, want no change", changed, err)
+	}
+	late := charge
+	late.Status = "pending"
+	if _, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_5"+charge.Id, "charge.pending", late, newUUID(t)); err != nil || changed {
+		t.Fatalf("ApplyChargeEvent(pending) after succeeded = %v, %v, want no change", changed, err)
+	}
+	failed := charge
+	failed.Status = "failed"
+	if _, _, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_6"+charge.Id, "charge.failed", failed, newUUID(t)); !errors.Is(err, repository.ErrChargeTransition) {
+		t.Fatalf("ApplyChargeEvent(failed) after succeeded = %v, want ErrChargeTransition", err)
+	}
+	assertBalance(t, repos, checking.Id, "40")
+
+	// A charge first heard of when it fails is never deposited.
+	message := "card_declined"
+	declined := model.ProcessorCharge{Id: "ch_" + newUUID(t).String(), AccountId: checking.Id, Amount: decimal.RequireFromString("5.00"), Status: "failed", FailureMessage: &message}
+	if applied, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+declined.Id, "charge.failed", declined, newUUID(t)); err != nil || !changed || applied.Status != "failed" || applied.FailureMessage == nil || *applied.FailureMessage != message {
+		t.Fatalf("ApplyChargeEvent(failed) = %+v, %v, %v", applied, changed, err)
+	}
+	if found, err := repos.ProcessorRepository.GetProcessorCharge(ctx, declined.Id); err != nil || found.Status != "failed" || found.TransactionId != nil {
+		t.Fatalf("GetProcessorCharge = %+v, %v", found, err)
+	}
+	assertBalance(t, repos, checking.Id, "40")
+
+	// Charges wait for frozen accounts, with their event applied again once retried, and closed ones are refunded.
+	reason := "court_order"
+	frozen := CreateAccount(t, repos, alice, "0")
+	if _, err = repos.AccountRepository.SetAccountStatus(ctx, frozen.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus(frozen_all): %s", err)
+	}
+	held := model.ProcessorCharge{Id: "ch_" + newUUID(t).String(), AccountId: frozen.Id, Amount: decimal.RequireFromString("7.00"), Status: "succeeded"}
+	if _, _, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+held.Id, "charge.succeeded", held, newUUID(t)); !errors.Is(err, repository.ErrAccountFrozen) {
+		t.Fatalf("ApplyChargeEvent(succeeded) for a frozen account = %v, want ErrAccountFrozen", err)
+	}
+	if _, err = repos.AccountRepository.SetAccountStatus(ctx, frozen.Id.String(), repository.AccountStatusChange{From: []string{"frozen_all"}, Status: "active"}); err != nil {
+		t.Fatalf("SetAccountStatus(active): %s", err)
+	}
+	if applied, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+held.Id, "charge.succeeded", held, newUUID(t)); err != nil || !changed || applied.Status != "succeeded" {
+		t.Fatalf("retried ApplyChargeEvent(succeeded) once unfrozen = %+v, %v, %v", applied, changed, err)
+	}
+	assertBalance(t, repos, frozen.Id, "7")
+
+	closed := CreateAccount(t, repos, alice, "0")
+	if _, err = repos.AccountRepository.SetAccountStatus(ctx, closed.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "closed", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus(closed): %s", err)
+	}
+	refunded := model.ProcessorCharge{Id: "ch_" + newUUID(t).String(), AccountId: closed.Id, Amount: decimal.RequireFromString("3.00"), Status: "succeeded"}
+	applied, changed, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+refunded.Id, "charge.succeeded", refunded, newUUID(t))
+	if err != nil || !changed || applied.Status != "failed" || applied.TransactionId != nil || applied.FailureMessage == nil || *applied.FailureMessage != repository.ChargeRefundMessage {
+		t.Fatalf("ApplyChargeEvent(succeeded) for a closed account = %+v, %v, %v, want it failed for a refund", applied, changed, err)
+	}
+	assertBalance(t, repos, closed.Id, "0")
+
+	if _, err = repos.ProcessorRepository.GetProcessorCharge(ctx, "ch_unknown"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetProcessorCharge of an unknown charge = %v, want sql.ErrNoRows", err)
+	}
+
+	orphan := model.ProcessorCharge{Id: "ch_" + newUUID(t).String(), AccountId: uuid.New(), Amount: decimal.RequireFromString("1.00"), Status: "pending"}
+	if _, _, err = repos.ProcessorRepository.ApplyChargeEvent(ctx, "evt_1"+orphan.Id, "charge.pending", orphan, newUUID(t)); err == nil {
+		t.Fatal("ApplyChargeEvent for an unknown account succeeded")
+	}
+}
+
+func testLedger(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	checking := CreateAccount(t, repos, CreateUser(t, repos), "100")
+	savings := CreateAccount(t, repos, CreateUser(t, repos), "0")
+
+	if err := repos.TransactionRepository.TransferTransaction(ctx, newUUID(t), checking.Id.String(), savings.Id.String(), decimal.NewFromInt(40)); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+	withdrawal_id := newUUID(t)
+	if err := repos.TransactionRepository.WithdrawalTransaction(ctx, withdrawal_id, savings.Id.String(), decimal.NewFromInt(10)); err != nil {
+		t.Fatalf("WithdrawalTransaction: %s", err)
+	}
+	if _, err := repos.TransactionRepository.ReverseTransaction(ctx, newUUID(t), withdrawal_id.String()); err != nil {
+		t.Fatalf("ReverseTransaction: %s", err)
+	}
+
+	// The transfer links both chains.
+	checking_head, err := repos.LedgerRepository.GetLedgerHead(ctx, checking.Id)
+	if err != nil || checking_head.Length != 2 || checking_head.Head == nil {
+		t.Fatalf("GetLedgerHead(checking) = %+v, %v, want 2 links", checking_head, err)
+	}
+	savings_head, err := repos.LedgerRepository.GetLedgerHead(ctx, savings.Id)
+	if err != nil || savings_head.Length != 3 {
+		t.Fatalf("GetLedgerHead(savings) = %+v, %v, want 3 links", savings_head, err)
+	}
+	if _, err = repos.LedgerRepository.GetLedgerHead(ctx, newUUID(t)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetLedgerHead(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	ledger, err := repos.LedgerRepository.GetAccountLedger(ctx, savings.Id)
+	if err != nil || len(*ledger) != 3 {
+		t.Fatalf("GetAccountLedger(savings) = %+v, %v, want 3 transactions", ledger, err)
+	}
+	for i, transaction := range *ledger {
+		if !bytes.Equal(repository.LedgerHash(transaction), transaction.ChainHash) {
+			t.Errorf("transaction %d of the ledger isn't hashed: %+v", i, transaction)
+		}
+	}
+	if last := (*ledger)[2]; !bytes.Equal(last.ChainHash, savings_head.Head) || !bytes.Equal(last.ToPrevHash, (*ledger)[1].ChainHash) {
+		t.Errorf("savings chain ends with %+v, want it linked to the withdrawal and at the head", last)
+	}
+
+	account_ids := []uuid.UUID{checking.Id, savings.Id}
+	report, err := repository.VerifyLedger(ctx, repos.LedgerRepository, account_ids, nil)
+	if err != nil || report.Accounts != 2 || report.Links != 5 || len(report.Broken) != 0 {
+		t.Fatalf("VerifyLedger = %+v, %v, want 2 intact chains of 5 links", report, err)
+	}
+
+	signer, err := utils.NewSigner(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := repository.CreateLedgerCheckpoint(ctx, repos.LedgerRepository, signer)
+	if err != nil {
+		t.Fatalf("CreateLedgerCheckpoint: %s", err)
+	}
+
+	checkpoints, err := repos.LedgerRepository.GetLedgerCheckpoints(ctx, 100, 0)
+	if err != nil {
+		t.Fatalf("GetLedgerCheckpoints: %s", err)
+	}
+	var stored *model.LedgerCheckpoint
+	for _, candidate := range *checkpoints {
+		if candidate.Id == checkpoint.Id {
+			stored = &candidate
+		}
+	}
+	if stored == nil || !stored.CreatedAt.Equal(checkpoint.CreatedAt) || stored.KeyId != signer.KeyId || len(stored.Heads) != checkpoint.Accounts {
+		t.Fatalf("checkpoint stored as %+v, want %+v", stored, checkpoint)
+	}
+	if err = repository.VerifyCheckpoint(*stored); err != nil {
+		t.Fatalf("VerifyCheckpoint: %s", err)
+	}
+	forged := *stored
+	forged.Heads = append(model.LedgerHeads{}, stored.Heads...)
+	for i, head := range forged.Heads {
+		if head.AccountId == checking.Id {
+			forged.Heads[i].Head = savings_head.Head
+		}
+	}
+	if err = repository.VerifyCheckpoint(forged); err == nil {
+		t.Fatal("VerifyCheckpoint accepted a checkpoint with a forged head")
+	}
+
+	// Chains keep growing past checkpoints.
+	if err = repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), checking.Id.String(), decimal.NewFromInt(5)); err != nil {
+		t.Fatalf("DepositTransaction: %s", err)
+	}
+	report, err = repository.VerifyLedger(ctx, repos.LedgerRepository, account_ids, []model.LedgerCheckpoint{*stored})
+	if err != nil || report.Links != 6 || len(report.Broken) != 0 {
+		t.Fatalf("VerifyLedger after the checkpoint = %+v, %v, want 6 intact links", report, err)
+	}
+}
+
+func testAdjustments(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	checking := CreateAccount(t, repos, alice, "50")
+	maker, first_checker, second_checker := CreateUser(t, repos), CreateUser(t, repos), CreateUser(t, repos)
+
+	propose := func(amount string, required_approvals int) *model.Adjustment {
+		t.Helper()
+		adjustment, err := repos.AdjustmentRepository.CreateAdjustment(ctx, model.Adjustment{
+			AccountId:         checking.Id,
+			Amount:            decimal.RequireFromString(amount),
+			Reason:            "Fee charged twice",
+			Evidence:          "Ticket #7",
+			RequiredApprovals: required_approvals,
+			ProposedBy:        maker.Id,
+		})
+		if err != nil {
+			t.Fatalf("CreateAdjustment: %s", err)
+		}
+		return adjustment
+	}
+	decide := func(adjustment *model.Adjustment, staff *model.User, decision string, transaction_id uuid.UUID) (*model.Adjustment, error) {
+		return repos.AdjustmentRepository.DecideAdjustment(ctx, model.AdjustmentDecision{AdjustmentId: adjustment.Id, StaffId: staff.Id, Decision: decision}, transaction_id)
+	}
+
+	debit := propose("-20.00", 2)
+	if debit.Status != "pending" || debit.TransactionId != nil || !debit.Amount.Equal(decimal.RequireFromString("-20")) {
+		t.Fatalf("CreateAdjustment = %+v, want a pending adjustment", debit)
+	}
+
+	if _, err := decide(debit, maker, "approved", newUUID(t)); !errors.Is(err, repository.ErrSelfApproval) {
+		t.Fatalf("approving one's own adjustment = %v, want ErrSelfApproval", err)
+	}
+
+	transaction_id := newUUID(t)
+	approved, err := decide(debit, first_checker, "approved", newUUID(t))
+	if err != nil || approved.Status != "pending" {
+		t.Fatalf("first of 2 approvals = %+v, %v, want still pending", approved, err)
+	}
+	assertBalance(t, repos, checking.Id, "50")
+
+	if _, err = decide(debit, first_checker, "approved", newUUID(t)); !errors.Is(err, repository.ErrAlreadyDecided) {
+		t.Fatalf("approving twice = %v, want ErrAlreadyDecided", err)
+	}
+
+	approved, err = decide(debit, second_checker, "approved", transaction_id)
+	if err != nil || approved.Status != "approved" || approved.TransactionId == nil || *approved.TransactionId != transaction_id {
+		t.Fatalf("second approval = %+v, %v, want it posted", approved, err)
+	}
+	assertBalance(t, repos, checking.Id, "30")
+	assertReconciled(t, repos, checking.Id)
+
+	posted, err := repos.TransactionRepository.GetTransaction(ctx, transaction_id.String())
+	if err != nil || posted.Type != "adjustment" || posted.FromAccountId == nil || *posted.FromAccountId != checking.Id || posted.ToAccountId != nil || !posted.Amount.Equal(decimal.RequireFromString("20")) {
+		t.Fatalf("GetTransaction of the adjustment = %+v, %v, want a debit of 20", posted, err)
+	}
+
+	if _, err = decide(debit, CreateUser(t, repos), "rejected", newUUID(t)); !errors.Is(err, repository.ErrAdjustmentDecided) {
+		t.Fatalf("deciding an approved adjustment = %v, want ErrAdjustmentDecided", err)
+	}
+
+	decisions, err := repos.AdjustmentRepository.GetAdjustmentDecisions(ctx, debit.Id)
+	if err != nil || len(*decisions) != 2 || (*decisions)[0].StaffId != first_checker.Id || (*decisions)[1].StaffId != second_checker.Id {
+		t.Fatalf("GetAdjustmentDecisions = %+v, %v, want both approvals in order", decisions, err)
+	}
+
+	// A debit beyond the balance can't be posted, and its approval isn't recorded.
+	overdraft := propose("-100.00", 1)
+	if _, err = decide(overdraft, first_checker, "approved", newUUID(t)); !errors.Is(err, repository.ErrInsufficientBalance) {
+		t.Fatalf("approving an overdraft = %v, want ErrInsufficientBalance", err)
+	}
+	if decisions, err = repos.AdjustmentRepository.GetAdjustmentDecisions(ctx, overdraft.Id); err != nil || len(*decisions) != 0 {
+		t.Fatalf("GetAdjustmentDecisions after a failed approval = %+v, %v, want none", decisions, err)
+	}
+
+	rejected, err := decide(overdraft, second_checker, "rejected", newUUID(t))
+	if err != nil || rejected.Status != "rejected" || rejected.TransactionId != nil {
+		t.Fatalf("rejection = %+v, %v", rejected, err)
+	}
+	assertBalance(t, repos, checking.Id, "30")
+
+	pending := propose("5.00", 1)
+	adjustments, err := repos.AdjustmentRepository.GetAdjustments(ctx, repository.AdjustmentFilter{AccountId: &checking.Id}, 10, 0)
+	if err != nil || len(*adjustments) != 3 || (*adjustments)[0].Id != pending.Id || (*adjustments)[2].Id != debit.Id {
+		t.Fatalf("GetAdjustments = %+v, %v, want the 3 adjustments, newest first", adjustments, err)
+	}
+	adjustments, err = repos.AdjustmentRepository.GetAdjustments(ctx, repository.AdjustmentFilter{AccountId: &checking.Id, Status: "pending"}, 10, 0)
+	if err != nil || len(*adjustments) != 1 || (*adjustments)[0].Id != pending.Id {
+		t.Fatalf("GetAdjustments(pending) = %+v, %v, want the pending one", adjustments, err)
+	}
+
+	if _, err = decide(pending, first_checker, "approved", newUUID(t)); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, repos, checking.Id, "35")
+
+	events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{TargetType: "adjustment", TargetId: debit.Id.String()}, 10, 0)
+	if err != nil || len(*events) != 3 || (*events)[0].Action != "adjustment.approve" || (*events)[2].Action != "adjustment.propose" {
+		t.Fatalf("audit events of the adjustment = %+v, %v, want propose and 2 approvals", events, err)
+	}
+
+	// Accounts frozen since an adjustment was proposed only take what their status allows.
+	reason := "fraud_suspected"
+	if _, err = repos.AccountRepository.SetAccountStatus(ctx, checking.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_debit", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus: %s", err)
+	}
+	frozen_debit := propose("-5.00", 1)
+	if _, err = decide(frozen_debit, first_checker, "approved", newUUID(t)); !errors.Is(err, repository.ErrAccountFrozen) {
+		t.Fatalf("approving a debit of a frozen_debit account = %v, want ErrAccountFrozen", err)
+	}
+	if decisions, err = repos.AdjustmentRepository.GetAdjustmentDecisions(ctx, frozen_debit.Id); err != nil || len(*decisions) != 0 {
+		t.Fatalf("GetAdjustmentDecisions after a refused debit = %+v, %v, want none", decisions, err)
+	}
+	if _, err = decide(propose("5.00", 1), first_checker, "approved", newUUID(t)); err != nil {
+		t.Fatalf("approving a credit of a frozen_debit account: %s", err)
+	}
+	assertBalance(t, repos, checking.Id, "40")
+
+	if _, err = repos.AccountRepository.SetAccountStatus(ctx, checking.Id.String(), repository.AccountStatusChange{From: []string{"frozen_debit"}, Status: "frozen_all", StatusReason: &reason}); err != nil {
+		t.Fatalf("SetAccountStatus: %s", err)
+	}
+	if _, err = decide(propose("5.00", 1), first_checker, "approved", newUUID(t)); !errors.Is(err, repository.ErrAccountFrozen) {
+		t.Fatalf("approving a credit of a frozen_all account = %v, want ErrAccountFrozen", err)
+	}
+	assertBalance(t, repos, checking.Id, "40")
+	assertReconciled(t, repos, checking.Id)
+
+	// Adjustments reversing a transaction post the reversal once approved.
+	savings := CreateAccount(t, repos, alice, "50")
+	bobs := CreateAccount(t, repos, CreateUser(t, repos), "0")
+	transfer_id := newUUID(t)
+	if err = repos.TransactionRepository.TransferTransaction(ctx, transfer_id, savings.Id.String(), bobs.Id.String(), decimal.RequireFromString("20")); err != nil {
+		t.Fatalf("TransferTransaction: %s", err)
+	}
+	reversing, err := repos.AdjustmentRepository.CreateAdjustment(ctx, model.Adjustment{
+		AccountId:         bobs.Id,
+		Amount:            decimal.RequireFromString("-20"),
+		Reason:            "Sent to the wrong account",
+		Evidence:          "Ticket #8",
+		RequiredApprovals: 1,
+		ProposedBy:        maker.Id,
+		ReversalOf:        &transfer_id,
+	})
+	if err != nil || reversing.ReversalOf == nil || *reversing.ReversalOf != transfer_id {
+		t.Fatalf("CreateAdjustment(reversal) = %+v, %v, want it to reverse the transfer", reversing, err)
+	}
+	reversal_id := newUUID(t)
+	approved, err = decide(reversing, first_checker, "approved", reversal_id)
+	if err != nil || approved.Status != "approved" || approved.TransactionId == nil || *approved.TransactionId != reversal_id {
+		t.Fatalf("approving the reversal = %+v, %v, want it posted", approved, err)
+	}
+	reversal, err := repos.TransactionRepository.GetReversal(ctx, transfer_id.String())
+	if err != nil || reversal.Id != reversal_id || reversal.Type != "transfer" || *reversal.FromAccountId != bobs.Id || *reversal.ToAccountId != savings.Id {
+		t.Fatalf("GetReversal after the approval = %+v, %v, want the reversal of the transfer", reversal, err)
+	}
+	assertBalance(t, repos, savings.Id, "50")
+	assertBalance(t, repos, bobs.Id, "0")
+	assertReconciled(t, repos, savings.Id)
+
+	again, err := repos.AdjustmentRepository.CreateAdjustment(ctx, model.Adjustment{
+		AccountId:         bobs.Id,
+		Amount:            decimal.RequireFromString("-20"),
+		Reason:            "Sent to the wrong account",
+		Evidence:          "Ticket #8",
+		RequiredApprovals: 1,
+		ProposedBy:        maker.Id,
+		ReversalOf:        &transfer_id,
+	})
+	if err != nil {
+		t.Fatalf("CreateAdjustment(reversal): %s", err)
+	}
+	if _, err = decide(again, first_checker, "approved", newUUID(t)); !errors.Is(err, repository.ErrAlreadyReversed) {
+		t.Fatalf("approving a second reversal = %v, want ErrAlreadyReversed", err)
+	}
+
+	if _, err = repos.AdjustmentRepository.GetAdjustment(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetAdjustment of an unknown adjustment = %v, want sql.ErrNoRows", err)
+	}
+}
+
+// invite has invited join account_id as role, and returns the accepted invitation.
+func invite(t *testing.T, repos repository.Repositories, account_id uuid.UUID, invited_by *model.User, invited *model.User, role string, spend_limit *decimal.Decimal) *model.AccountInvitation {
+	t.Helper()
+
+	invitation, err := repos.MemberRepository.CreateInvitation(context.Background(), model.AccountInvitation{
+		AccountId:  account_id,
+		Email:      strings.ToLower(invited.Email),
+		Role:       role,
+		SpendLimit: spend_limit,
+		InvitedBy:  invited_by.Id,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %s", err)
+	}
+
+	accepted, err := repos.MemberRepository.DecideInvitation(context.Background(), invitation.Id, invited.Id, true)
+	if err != nil {
+		t.Fatalf("DecideInvitation: %s", err)
+	}
+
+	return accepted
+}
+
+func testMembers(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice := CreateUser(t, repos)
+	bob := CreateUser(t, repos)
+	carol := CreateUser(t, repos)
+	joint := CreateAccount(t, repos, alice, "100")
+
+	t.Run("creators are the first owners", func(t *testing.T) {
+		member, err := repos.MemberRepository.GetAccountMember(ctx, joint.Id, alice.Id)
+		if err != nil || member.Role != model.MemberOwner || member.SpendLimit != nil {
+			t.Fatalf("GetAccountMember(creator) = %+v, %v, want an owner", member, err)
+		}
+		if _, err = repos.MemberRepository.GetAccountMember(ctx, joint.Id, bob.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetAccountMember(stranger) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("invitations are accepted or declined once", func(t *testing.T) {
+		limit := decimal.RequireFromString("20")
+		invitation := invite(t, repos, joint.Id, alice, bob, model.MemberSpender, &limit)
+		if invitation.Status != "accepted" || invitation.DecidedAt == nil {
+			t.Fatalf("accepted invitation = %+v", invitation)
+		}
+		member, err := repos.MemberRepository.GetAccountMember(ctx, joint.Id, bob.Id)
+		if err != nil || member.Role != model.MemberSpender || member.SpendLimit == nil || !member.SpendLimit.Equal(limit) {
+			t.Fatalf("GetAccountMember(spender) = %+v, %v", member, err)
+		}
+		if _, err = repos.MemberRepository.DecideInvitation(ctx, invitation.Id, bob.Id, false); !errors.Is(err, repository.ErrInvitationDecided) {
+			t.Fatalf("DecideInvitation(decided) error = %v, want ErrInvitationDecided", err)
+		}
+
+		again := model.AccountInvitation{AccountId: joint.Id, Email: strings.ToLower(bob.Email), Role: model.MemberViewer, InvitedBy: alice.Id}
+		if _, err = repos.MemberRepository.CreateInvitation(ctx, again); !errors.Is(err, repository.ErrAlreadyMember) {
+			t.Fatalf("CreateInvitation(member) error = %v, want ErrAlreadyMember", err)
+		}
+
+		pending, err := repos.MemberRepository.CreateInvitation(ctx, model.AccountInvitation{AccountId: joint.Id, Email: strings.ToLower(carol.Email), Role: model.MemberViewer, InvitedBy: alice.Id})
+		if err != nil || pending.Status != "pending" {
+			t.Fatalf("CreateInvitation = %+v, %v", pending, err)
+		}
+		if _, err = repos.MemberRepository.CreateInvitation(ctx, model.AccountInvitation{AccountId: joint.Id, Email: pending.Email, Role: model.MemberOwner, InvitedBy: alice.Id}); !errors.Is(err, repository.ErrAlreadyInvited) {
+			t.Fatalf("CreateInvitation(invited) error = %v, want ErrAlreadyInvited", err)
+		}
+		invitations, err := repos.MemberRepository.GetPendingInvitations(ctx, pending.Email)
+		if err != nil || len(*invitations) != 1 || (*invitations)[0].Id != pending.Id {
+			t.Fatalf("GetPendingInvitations = %+v, %v", invitations, err)
+		}
+
+		declined, err := repos.MemberRepository.DecideInvitation(ctx, pending.Id, carol.Id, false)
+		if err != nil || declined.Status != "declined" {
+			t.Fatalf("DecideInvitation(decline) = %+v, %v", declined, err)
+		}
+		if _, err = repos.MemberRepository.GetAccountMember(ctx, joint.Id, carol.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetAccountMember(declined) error = %v, want sql.ErrNoRows", err)
+		}
+		if invitations, err = repos.MemberRepository.GetAccountInvitations(ctx, joint.Id, 10, 0); err != nil || len(*invitations) != 2 {
+			t.Fatalf("GetAccountInvitations = %+v, %v, want both invitations", invitations, err)
+		}
+	})
+
+	t.Run("members see the accounts they share", func(t *testing.T) {
+		accounts, err := repos.AccountRepository.GetMyAccounts(ctx, bob.Id.String(), 10, 0)
+		if err != nil || len(*accounts) != 1 || (*accounts)[0].Id != joint.Id {
+			t.Fatalf("GetMyAccounts(spender) = %+v, %v, want the joint account", accounts, err)
+		}
+		memberships, err := repos.MemberRepository.GetUserMemberships(ctx, bob.Id)
+		if err != nil || len(*memberships) != 1 || (*memberships)[0].Role != model.MemberSpender {
+			t.Fatalf("GetUserMemberships = %+v, %v", memberships, err)
+		}
+		members, err := repos.MemberRepository.GetAccountMembers(ctx, joint.Id)
+		if err != nil || len(*members) != 2 || (*members)[0].UserId != alice.Id || (*members)[1].UserId != bob.Id {
+			t.Fatalf("GetAccountMembers = %+v, %v, want the owner then the spender", members, err)
+		}
+	})
+
+	t.Run("every member is notified of the account's events", func(t *testing.T) {
+		endpoint, err := repos.WebhookRepository.CreateWebhookEndpoint(ctx, bob.Id, "https://bob.example/all", "whsec_all", nil)
+		if err != nil {
+			t.Fatalf("CreateWebhookEndpoint: %s", err)
+		}
+		if err = repos.TransactionRepository.DepositTransaction(ctx, newUUID(t), joint.Id.String(), decimal.NewFromInt(1)); err != nil {
+			t.Fatalf("DepositTransaction: %s", err)
+		}
+		reason := "fraud_suspected"
+		if _, err = repos.AccountRepository.SetAccountStatus(ctx, joint.Id.String(), repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_debit", StatusReason: &reason}); err != nil {
+			t.Fatalf("SetAccountStatus(frozen_debit): %s", err)
+		}
+		if _, err = repos.AccountRepository.SetAccountStatus(ctx, joint.Id.String(), repository.AccountStatusChange{From: []string{"frozen_debit"}, Status: "active"}); err != nil {
+			t.Fatalf("SetAccountStatus(active): %s", err)
+		}
+
+		dispatchOutbox(t, repos)
+		deliveries := endpointDeliveries(t, repos, endpoint.Id)
+		if len(deliveries["transaction.created"]) != 1 || len(deliveries["account.balance_changed"]) != 1 || len(deliveries["account.status_changed"]) != 2 {
+			t.Fatalf("deliveries to a spender = %+v, want the movement and both status changes", deliveries)
+		}
+	})
+
+	t.Run("owners remove other members at once", func(t *testing.T) {
+		if _, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: alice.Id, RequestedBy: bob.Id}); !errors.Is(err, repository.ErrNotOwner) {
+			t.Fatalf("RequestMemberRemoval(by a spender) error = %v, want ErrNotOwner", err)
+		}
+		if _, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: carol.Id, RequestedBy: alice.Id}); !errors.Is(err, repository.ErrNotMember) {
+			t.Fatalf("RequestMemberRemoval(stranger) error = %v, want ErrNotMember", err)
+		}
+
+		removal, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: bob.Id, RequestedBy: alice.Id})
+		if err != nil || removal.Status != "approved" || removal.DecidedBy == nil || *removal.DecidedBy != alice.Id {
+			t.Fatalf("RequestMemberRemoval(by an owner) = %+v, %v, want it approved", removal, err)
+		}
+		if _, err = repos.MemberRepository.GetAccountMember(ctx, joint.Id, bob.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetAccountMember(removed) error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err = repos.MemberRepository.DecideMemberRemoval(ctx, removal.Id, alice.Id, false); !errors.Is(err, repository.ErrRemovalDecided) {
+			t.Fatalf("DecideMemberRemoval(decided) error = %v, want ErrRemovalDecided", err)
+		}
+	})
+
+	t.Run("removing an owner needs another owner's approval", func(t *testing.T) {
+		if _, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: alice.Id, RequestedBy: alice.Id}); !errors.Is(err, repository.ErrLastOwner) {
+			t.Fatalf("RequestMemberRemoval(last owner) error = %v, want ErrLastOwner", err)
+		}
+
+		invite(t, repos, joint.Id, alice, carol, model.MemberOwner, nil)
+		removal, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: alice.Id, RequestedBy: alice.Id})
+		if err != nil || removal.Status != "pending" {
+			t.Fatalf("RequestMemberRemoval(owner) = %+v, %v, want it pending", removal, err)
+		}
+		if _, err = repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: joint.Id, UserId: alice.Id, RequestedBy: carol.Id}); !errors.Is(err, repository.ErrRemovalPending) {
+			t.Fatalf("RequestMemberRemoval(pending) error = %v, want ErrRemovalPending", err)
+		}
+		if _, err = repos.MemberRepository.DecideMemberRemoval(ctx, removal.Id, alice.Id, true); !errors.Is(err, repository.ErrOwnRemoval) {
+			t.Fatalf("DecideMemberRemoval(by the requester) error = %v, want ErrOwnRemoval", err)
+		}
+		if _, err = repos.MemberRepository.DecideMemberRemoval(ctx, removal.Id, bob.Id, true); !errors.Is(err, repository.ErrNotOwner) {
+			t.Fatalf("DecideMemberRemoval(by a former member) error = %v, want ErrNotOwner", err)
+		}
+
+		approved, err := repos.MemberRepository.DecideMemberRemoval(ctx, removal.Id, carol.Id, true)
+		if err != nil || approved.Status != "approved" {
+			t.Fatalf("DecideMemberRemoval = %+v, %v", approved, err)
+		}
+		if account := GetAccount(t, repos, joint.Id); account.UserId != carol.Id {
+			t.Fatalf("account user_id after its creator left = %s, want the remaining owner %s", account.UserId, carol.Id)
+		}
+		removals, err := repos.MemberRepository.GetMemberRemovals(ctx, joint.Id, 10, 0)
+		if err != nil || len(*removals) != 2 || (*removals)[0].Id != removal.Id {
+			t.Fatalf("GetMemberRemovals = %+v, %v, want both removals, newest first", removals, err)
+		}
+	})
+
+	t.Run("membership changes are audited", func(t *testing.T) {
+		events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{UserId: &bob.Id}, 100, 0)
+		if err != nil {
+			t.Fatalf("SearchAuditEvents: %s", err)
+		}
+		actions := []string{}
+		for _, event := range *events {
+			actions = append(actions, event.Action)
+		}
+		want := []string{"account.remove_member", "account_member_removal.approve", "account_member_removal.request", "account.add_member", "account_invitation.accept", "user.register"}
+		if !slices.Equal(actions, want) {
+			t.Fatalf("audited actions = %v, want %v", actions, want)
+		}
+	})
+}
+
+func testPaymentRequests(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice, bob, carol, dave := CreateUser(t, repos), CreateUser(t, repos), CreateUser(t, repos), CreateUser(t, repos)
+	business := CreateAccount(t, repos, alice, "500")
+	savings := CreateAccount(t, repos, alice, "0")
+	invite(t, repos, business.Id, alice, bob, model.MemberOwner, nil)
+	invite(t, repos, business.Id, alice, carol, model.MemberOwner, nil)
+	limit := decimal.RequireFromString("1000")
+	invite(t, repos, business.Id, alice, dave, model.MemberSpender, &limit)
+
+	submit := func(amount string, required_approvals int, expires_at time.Time) *model.PaymentRequest {
+		t.Helper()
+		request, err := repos.PaymentRequestRepository.CreatePaymentRequest(ctx, model.PaymentRequest{
+			Kind:              "transfer",
+			TransactionId:     newUUID(t),
+			FromAccountId:     business.Id,
+			ToAccountId:       &savings.Id,
+			Amount:            decimal.RequireFromString(amount),
+			RequestedBy:       alice.Id,
+			RequiredApprovals: required_approvals,
+			ExpiresAt:         expires_at,
+		})
+		if err != nil {
+			t.Fatalf("CreatePaymentRequest: %s", err)
+		}
+		return request
+	}
+	decide := func(request *model.PaymentRequest, user *model.User, decision string) (*model.PaymentRequest, error) {
+		return repos.PaymentRequestRepository.DecidePaymentRequest(ctx, model.PaymentRequestDecision{PaymentRequestId: request.Id, UserId: user.Id, Decision: decision})
+	}
+
+	t.Run("policies are set, replaced and deleted", func(t *testing.T) {
+		if _, err := repos.PaymentRequestRepository.GetApprovalPolicy(ctx, business.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetApprovalPolicy(none) error = %v, want sql.ErrNoRows", err)
+		}
+
+		created, err := repos.PaymentRequestRepository.SetApprovalPolicy(ctx, model.ApprovalPolicy{AccountId: business.Id, Threshold: decimal.RequireFromString("100"), RequiredApprovals: 2, UpdatedBy: alice.Id})
+		if err != nil || created.RequiredApprovals != 2 {
+			t.Fatalf("SetApprovalPolicy = %+v, %v", created, err)
+		}
+		replaced, err := repos.PaymentRequestRepository.SetApprovalPolicy(ctx, model.ApprovalPolicy{AccountId: business.Id, Threshold: decimal.RequireFromString("50"), RequiredApprovals: 1, UpdatedBy: bob.Id})
+		if err != nil || !replaced.Threshold.Equal(decimal.RequireFromString("50")) || replaced.UpdatedBy != bob.Id || !replaced.CreatedAt.Equal(created.CreatedAt) {
+			t.Fatalf("SetApprovalPolicy(replace) = %+v, %v", replaced, err)
+		}
+		if policy, err := repos.PaymentRequestRepository.GetApprovalPolicy(ctx, business.Id); err != nil || policy.RequiredApprovals != 1 {
+			t.Fatalf("GetApprovalPolicy = %+v, %v, want the replaced policy", policy, err)
+		}
+
+		if err = repos.PaymentRequestRepository.DeleteApprovalPolicy(ctx, business.Id, alice.Id); err != nil {
+			t.Fatalf("DeleteApprovalPolicy: %s", err)
+		}
+		if err = repos.PaymentRequestRepository.DeleteApprovalPolicy(ctx, business.Id, alice.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeleteApprovalPolicy(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("quorum of other owners approves", func(t *testing.T) {
+		request := submit("200.00", 2, time.Now().Add(time.Hour))
+		if request.Status != "pending" || request.FailureReason != nil {
+			t.Fatalf("CreatePaymentRequest = %+v, want a pending request", request)
+		}
+		if found, err := repos.PaymentRequestRepository.GetPaymentRequestByTransaction(ctx, request.TransactionId); err != nil || found.Id != request.Id {
+			t.Fatalf("GetPaymentRequestByTransaction = %+v, %v", found, err)
+		}
+
+		if _, err := decide(request, alice, "approved"); !errors.Is(err, repository.ErrOwnRequest) {
+			t.Fatalf("approving one's own request = %v, want ErrOwnRequest", err)
+		}
+		if _, err := decide(request, dave, "approved"); !errors.Is(err, repository.ErrNotOwner) {
+			t.Fatalf("approving as a spender = %v, want ErrNotOwner", err)
+		}
+
+		first, err := decide(request, bob, "approved")
+		if err != nil || first.Status != "pending" {
+			t.Fatalf("first approval = %+v, %v, want it still pending", first, err)
+		}
+		if _, err = decide(request, bob, "approved"); !errors.Is(err, repository.ErrRequestTwice) {
+			t.Fatalf("approving twice = %v, want ErrRequestTwice", err)
+		}
+		approved, err := decide(request, carol, "approved")
+		if err != nil || approved.Status != "approved" {
+			t.Fatalf("second approval = %+v, %v, want it approved", approved, err)
+		}
+		if _, err = decide(request, carol, "rejected"); !errors.Is(err, repository.ErrRequestDecided) {
+			t.Fatalf("deciding an approved request = %v, want ErrRequestDecided", err)
+		}
+
+		decisions, err := repos.PaymentRequestRepository.GetPaymentRequestDecisions(ctx, request.Id)
+		if err != nil || len(*decisions) != 2 || (*decisions)[0].UserId != bob.Id || (*decisions)[1].UserId != carol.Id {
+			t.Fatalf("GetPaymentRequestDecisions = %+v, %v, want bob's then carol's", decisions, err)
+		}
+		approved_requests, err := repos.PaymentRequestRepository.GetApprovedPaymentRequests(ctx, 1000)
+		if err != nil || !slices.ContainsFunc(*approved_requests, func(r model.PaymentRequest) bool { return r.Id == request.Id }) {
+			t.Fatalf("GetApprovedPaymentRequests = %+v, %v, want the approved request", approved_requests, err)
+		}
+
+		if err = repos.TransactionRepository.TransferTransaction(ctx, request.TransactionId, business.Id.String(), savings.Id.String(), request.Amount); err != nil {
+			t.Fatalf("TransferTransaction: %s", err)
+		}
+		executed, err := repos.PaymentRequestRepository.CompletePaymentRequest(ctx, request.Id, nil)
+		if err != nil || executed.Status != "executed" {
+			t.Fatalf("CompletePaymentRequest = %+v, %v", executed, err)
+		}
+		if _, err = repos.PaymentRequestRepository.CompletePaymentRequest(ctx, request.Id, nil); !errors.Is(err, repository.ErrRequestDecided) {
+			t.Fatalf("completing twice = %v, want ErrRequestDecided", err)
+		}
+		assertBalance(t, repos, savings.Id, "200.00")
+	})
+
+	t.Run("a rejection ends the request", func(t *testing.T) {
+		request := submit("300.00", 2, time.Now().Add(time.Hour))
+		rejected, err := decide(request, bob, "rejected")
+		if err != nil || rejected.Status != "rejected" {
+			t.Fatalf("rejection = %+v, %v", rejected, err)
+		}
+		if _, err = repos.PaymentRequestRepository.CompletePaymentRequest(ctx, request.Id, nil); !errors.Is(err, repository.ErrRequestDecided) {
+			t.Fatalf("completing a rejected request = %v, want ErrRequestDecided", err)
+		}
+	})
+
+	t.Run("approved requests fail with a reason", func(t *testing.T) {
+		request := submit("400.00", 1, time.Now().Add(time.Hour))
+		if _, err := decide(request, carol, "approved"); err != nil {
+			t.Fatalf("approval: %s", err)
+		}
+		reason := "insufficient_balance"
+		failed, err := repos.PaymentRequestRepository.CompletePaymentRequest(ctx, request.Id, &reason)
+		if err != nil || failed.Status != "failed" || failed.FailureReason == nil || *failed.FailureReason != reason {
+			t.Fatalf("CompletePaymentRequest(failed) = %+v, %v", failed, err)
+		}
+	})
+
+	t.Run("withdrawals are held without a receiver", func(t *testing.T) {
+		withdrawal := model.PaymentRequest{
+			Kind:              "withdrawal",
+			TransactionId:     newUUID(t),
+			FromAccountId:     business.Id,
+			ToAccountId:       &savings.Id,
+			Amount:            decimal.RequireFromString("300.00"),
+			RequestedBy:       alice.Id,
+			RequiredApprovals: 1,
+			ExpiresAt:         time.Now().Add(time.Hour),
+		}
+		if _, err := repos.PaymentRequestRepository.CreatePaymentRequest(ctx, withdrawal); err == nil {
+			t.Fatalf("CreatePaymentRequest of a withdrawal with a receiver succeeded")
+		}
+
+		withdrawal.ToAccountId = nil
+		created, err := repos.PaymentRequestRepository.CreatePaymentRequest(ctx, withdrawal)
+		if err != nil || created.Kind != "withdrawal" || created.ToAccountId != nil || created.Status != "pending" {
+			t.Fatalf("CreatePaymentRequest(withdrawal) = %+v, %v", created, err)
+		}
+	})
+
+	t.Run("requests expire without quorum", func(t *testing.T) {
+		request := submit("10.00", 1, time.Now().Add(-time.Second))
+		if _, err := decide(request, bob, "approved"); !errors.Is(err, repository.ErrRequestExpired) {
+			t.Fatalf("approving an expired request = %v, want ErrRequestExpired", err)
+		}
+
+		expired, err := repos.PaymentRequestRepository.ExpirePaymentRequests(ctx)
+		if err != nil || !slices.ContainsFunc(*expired, func(r model.PaymentRequest) bool { return r.Id == request.Id && r.Status == "expired" }) {
+			t.Fatalf("ExpirePaymentRequests = %+v, %v, want the expired request", expired, err)
+		}
+		if _, err = decide(request, bob, "approved"); !errors.Is(err, repository.ErrRequestDecided) {
+			t.Fatalf("approving after the expiry ran = %v, want ErrRequestDecided", err)
+		}
+	})
+
+	t.Run("requests are listed by account and status", func(t *testing.T) {
+		requests, err := repos.PaymentRequestRepository.GetPaymentRequests(ctx, business.Id, "", 10, 0)
+		if err != nil || len(*requests) != 5 || (*requests)[0].Status != "expired" {
+			t.Fatalf("GetPaymentRequests = %+v, %v, want the 5 requests, newest first", requests, err)
+		}
+		if requests, err = repos.PaymentRequestRepository.GetPaymentRequests(ctx, business.Id, "executed", 10, 0); err != nil || len(*requests) != 1 {
+			t.Fatalf("GetPaymentRequests(executed) = %+v, %v", requests, err)
+		}
+	})
+
+	t.Run("payment requests are audited", func(t *testing.T) {
+		events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{UserId: &alice.Id, TargetType: "payment_request"}, 100, 0)
+		if err != nil {
+			t.Fatalf("SearchAuditEvents: %s", err)
+		}
+		counts := map[string]int{}
+		for _, event := range *events {
+			counts[event.Action]++
+		}
+		want := map[string]int{"payment_request.create": 5, "payment_request.approve": 3, "payment_request.reject": 1, "payment_request.execute": 1, "payment_request.fail": 1, "payment_request.expire": 1}
+		if fmt.Sprint(counts) != fmt.Sprint(want) {
+			t.Fatalf("audited actions = %v, want %v", counts, want)
+		}
+	})
+}
+
+func testPayees(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice, bob := CreateUser(t, repos), CreateUser(t, repos)
+	rent, groceries := CreateAccount(t, repos, bob, "0"), CreateAccount(t, repos, bob, "0")
+
+	save := func(user *model.User, account *model.Account, nickname string) (*model.Payee, error) {
+		return repos.PayeeRepository.CreatePayee(ctx, model.Payee{UserId: user.Id, AccountId: account.Id, Nickname: nickname})
+	}
+
+	landlord, err := save(alice, rent, "Landlord")
+	if err != nil || landlord.Nickname != "Landlord" || landlord.CreatedAt.IsZero() {
+		t.Fatalf("CreatePayee = %+v, %v", landlord, err)
+	}
+
+	t.Run("accounts and nicknames are saved once per user", func(t *testing.T) {
+		if _, err := save(alice, rent, "Rent"); !errors.Is(err, repository.ErrPayeeExists) {
+			t.Fatalf("saving an account twice = %v, want ErrPayeeExists", err)
+		}
+		if _, err := save(alice, groceries, "LANDLORD"); !errors.Is(err, repository.ErrNicknameTaken) {
+			t.Fatalf("reusing a nickname in another case = %v, want ErrNicknameTaken", err)
+		}
+		if _, err := save(bob, rent, "Landlord"); err != nil {
+			t.Fatalf("another user saving the same account: %s", err)
+		}
+	})
+
+	t.Run("payees are found by id and account", func(t *testing.T) {
+		if found, err := repos.PayeeRepository.GetPayee(ctx, landlord.Id); err != nil || found.AccountId != rent.Id {
+			t.Fatalf("GetPayee = %+v, %v", found, err)
+		}
+		if found, err := repos.PayeeRepository.GetPayeeByAccount(ctx, alice.Id, rent.Id); err != nil || found.Id != landlord.Id {
+			t.Fatalf("GetPayeeByAccount = %+v, %v", found, err)
+		}
+		if _, err := repos.PayeeRepository.GetPayeeByAccount(ctx, alice.Id, groceries.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetPayeeByAccount(unsaved) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("payees are renamed and listed by nickname", func(t *testing.T) {
+		shop, err := save(alice, groceries, "grocer")
+		if err != nil {
+			t.Fatalf("CreatePayee: %s", err)
+		}
+		if _, err = repos.PayeeRepository.RenamePayee(ctx, shop.Id, "landlord"); !errors.Is(err, repository.ErrNicknameTaken) {
+			t.Fatalf("renaming to a taken nickname = %v, want ErrNicknameTaken", err)
+		}
+		if renamed, err := repos.PayeeRepository.RenamePayee(ctx, landlord.Id, "landlord"); err != nil || renamed.Nickname != "landlord" || !renamed.CreatedAt.Equal(landlord.CreatedAt) {
+			t.Fatalf("RenamePayee(own nickname in another case) = %+v, %v", renamed, err)
+		}
+		if renamed, err := repos.PayeeRepository.RenamePayee(ctx, landlord.Id, "Home"); err != nil || renamed.Nickname != "Home" {
+			t.Fatalf("RenamePayee = %+v, %v", renamed, err)
+		}
+
+		payees, err := repos.PayeeRepository.GetUserPayees(ctx, alice.Id, 10, 0)
+		if err != nil || len(*payees) != 2 || (*payees)[0].Nickname != "grocer" || (*payees)[1].Nickname != "Home" {
+			t.Fatalf("GetUserPayees = %+v, %v, want grocer then Home", payees, err)
+		}
+	})
+
+	t.Run("deleted payees are gone", func(t *testing.T) {
+		if err := repos.PayeeRepository.DeletePayee(ctx, landlord.Id); err != nil {
+			t.Fatalf("DeletePayee: %s", err)
+		}
+		if err := repos.PayeeRepository.DeletePayee(ctx, landlord.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeletePayee(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := repos.PayeeRepository.GetPayee(ctx, landlord.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetPayee(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := save(alice, rent, "Landlord"); err != nil {
+			t.Fatalf("saving a deleted payee again: %s", err)
+		}
+	})
+
+	t.Run("payee changes are audited", func(t *testing.T) {
+		events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{UserId: &alice.Id, TargetType: "payee"}, 100, 0)
+		if err != nil {
+			t.Fatalf("SearchAuditEvents: %s", err)
+		}
+		counts := map[string]int{}
+		for _, event := range *events {
+			counts[event.Action]++
+		}
+		want := map[string]int{"payee.create": 3, "payee.rename": 2, "payee.delete": 1}
+		if fmt.Sprint(counts) != fmt.Sprint(want) {
+			t.Fatalf("audited actions = %v, want %v", counts, want)
+		}
+	})
+}
+
+func testAccountNumbers(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	user := CreateUser(t, repos)
+	first, second := CreateAccount(t, repos, user, "0"), CreateAccount(t, repos, user, "0")
+
+	if first.Number <= 0 || second.Number <= first.Number {
+		t.Fatalf("account numbers = %d then %d, want them positive and increasing", first.Number, second.Number)
+	}
+
+	found, err := repos.AccountRepository.GetAccountByNumber(ctx, second.Number)
+	if err != nil || found.Id != second.Id {
+		t.Fatalf("GetAccountByNumber = %+v, %v, want %s", found, err, second.Id)
+	}
+	if _, err = repos.AccountRepository.GetAccountByNumber(ctx, second.Number+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetAccountByNumber(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testHandles(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	alice, bob := CreateUser(t, repos), CreateUser(t, repos)
+	checking, savings := CreateAccount(t, repos, alice, "0"), CreateAccount(t, repos, bob, "0")
+
+	set := func(user *model.User, account *model.Account, handle string) (*model.Handle, error) {
+		return repos.HandleRepository.SetHandle(ctx, model.Handle{Handle: handle, UserId: user.Id, AccountId: account.Id})
+	}
+
+	first, err := set(alice, checking, "alice")
+	if err != nil || first.Handle != "alice" || first.CreatedAt.IsZero() {
+		t.Fatalf("SetHandle = %+v, %v", first, err)
+	}
+
+	t.Run("handles belong to one user", func(t *testing.T) {
+		if _, err := set(bob, savings, "alice"); !errors.Is(err, repository.ErrHandleTaken) {
+			t.Fatalf("taking the handle of another user = %v, want ErrHandleTaken", err)
+		}
+		if again, err := set(alice, checking, "alice"); err != nil || again.Handle != "alice" {
+			t.Fatalf("setting the same handle again = %+v, %v", again, err)
+		}
+	})
+
+	t.Run("handles are found by name, user and account", func(t *testing.T) {
+		if found, err := repos.HandleRepository.GetHandle(ctx, "alice"); err != nil || found.AccountId != checking.Id {
+			t.Fatalf("GetHandle = %+v, %v", found, err)
+		}
+		if found, err := repos.HandleRepository.GetUserHandle(ctx, alice.Id); err != nil || found.Handle != "alice" {
+			t.Fatalf("GetUserHandle = %+v, %v", found, err)
+		}
+		if found, err := repos.HandleRepository.GetAccountHandle(ctx, checking.Id); err != nil || found.UserId != alice.Id {
+			t.Fatalf("GetAccountHandle = %+v, %v", found, err)
+		}
+		if _, err := repos.HandleRepository.GetAccountHandle(ctx, savings.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetAccountHandle(without handle) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("changing a handle frees the previous one", func(t *testing.T) {
+		renamed, err := set(alice, checking, "alice_b")
+		if err != nil || renamed.Handle != "alice_b" || !renamed.CreatedAt.Equal(first.CreatedAt) {
+			t.Fatalf("SetHandle(another handle) = %+v, %v, want it created at %s", renamed, err, first.CreatedAt)
+		}
+		if _, err = repos.HandleRepository.GetHandle(ctx, "alice"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetHandle(previous handle) error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err = set(bob, savings, "alice"); err != nil {
+			t.Fatalf("taking a freed handle: %s", err)
+		}
+	})
+
+	t.Run("deleted handles are gone", func(t *testing.T) {
+		if err := repos.HandleRepository.DeleteHandle(ctx, bob.Id); err != nil {
+			t.Fatalf("DeleteHandle: %s", err)
+		}
+		if err := repos.HandleRepository.DeleteHandle(ctx, bob.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("DeleteHandle(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("members removed from an account lose its handle", func(t *testing.T) {
+		invite(t, repos, checking.Id, alice, bob, model.MemberOwner, nil)
+		removal, err := repos.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: checking.Id, UserId: alice.Id, RequestedBy: alice.Id})
+		if err != nil {
+			t.Fatalf("RequestMemberRemoval: %s", err)
+		}
+		if _, err = repos.MemberRepository.DecideMemberRemoval(ctx, removal.Id, bob.Id, true); err != nil {
+			t.Fatalf("DecideMemberRemoval: %s", err)
+		}
+
+		if _, err = repos.HandleRepository.GetUserHandle(ctx, alice.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetUserHandle(removed member) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("handle changes are audited", func(t *testing.T) {
+		events, err := repos.AuditRepository.SearchAuditEvents(ctx, repository.AuditFilter{UserId: &alice.Id, TargetType: "user"}, 100, 0)
+		if err != nil {
+			t.Fatalf("SearchAuditEvents: %s", err)
+		}
+		counts := map[string]int{}
+		for _, event := range *events {
+			counts[event.Action]++
+		}
+		if counts["user.set_handle"] != 3 || counts["user.delete_handle"] != 1 {
+			t.Fatalf("audited actions = %v, want 3 user.set_handle and 1 user.delete_handle", counts)
+		}
+	})
+}
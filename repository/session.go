@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Sessions live as long as the cookie handed out on login.
+const SessionTTL = 24 * time.Hour
+
+type SessionRepository struct {
+	Valkey   valkey.Client
+	Timeouts Timeouts
+}
+
+func userSessionsKey(user_id string) string {
+	return "user_sessions:" + user_id
+}
+
+func (sr *SessionRepository) CreateSession(ctx context.Context, session_id string, user_id string) error {
+	ctx, cancel := context.WithTimeout(ctx, sr.Timeouts.Query)
+	defer cancel()
+
+	v := sr.Valkey
+	err := v.Do(ctx, v.B().Set().Key(session_id).Value(user_id).Nx().Ex(SessionTTL).Build()).Error()
+	if err != nil {
+		return err
+	}
+
+	// Index sessions per user so they can all be revoked at once.
+	cmds := valkey.Commands{
+		v.B().Sadd().Key(userSessionsKey(user_id)).Member(session_id).Build(),
+		v.B().Expire().Key(userSessionsKey(user_id)).Seconds(int64(SessionTTL.Seconds())).Build(),
+	}
+	for _, resp := range v.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sr *SessionRepository) GetSessionUserId(ctx context.Context, session_id string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sr.Timeouts.Query)
+	defer cancel()
+
+	v := sr.Valkey
+	user_id, err := v.Do(ctx, v.B().Get().Key(session_id).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrSessionNotFound
+	}
+
+	return user_id, err
+}
+
+func (sr *SessionRepository) RevokeSession(ctx context.Context, session_id string) error {
+	ctx, cancel := context.WithTimeout(ctx, sr.Timeouts.Query)
+	defer cancel()
+
+	user_id, err := sr.GetSessionUserId(ctx, session_id)
+	if err != nil {
+		return err
+	}
+
+	v := sr.Valkey
+	cmds := valkey.Commands{
+		v.B().Del().Key(session_id).Build(),
+		v.B().Srem().Key(userSessionsKey(user_id)).Member(session_id).Build(),
+	}
+	for _, resp := range v.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserSessions deletes every session of the user and returns how many were revoked.
+func (sr *SessionRepository) RevokeUserSessions(ctx context.Context, user_id string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, sr.Timeouts.Query)
+	defer cancel()
+
+	v := sr.Valkey
+	session_ids, err := v.Do(ctx, v.B().Smembers().Key(userSessionsKey(user_id)).Build()).AsStrSlice()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := append(session_ids, userSessionsKey(user_id))
+	revoked, err := v.Do(ctx, v.B().Del().Key(keys...).Build()).AsInt64()
+	if err != nil {
+		return 0, err
+	}
+
+	// The index key itself is counted by DEL when it exists.
+	if len(session_ids) > 0 {
+		revoked--
+	}
+
+	return int(revoked), nil
+}
@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+/*
+ErrSessionNotFound is returned for unknown or expired sessions. The other stores report
+missing rows with sql.ErrNoRows whatever their backend, so callers can keep checking for it.
+*/
+var ErrSessionNotFound = errors.New("session not found")
+
+type UserStore interface {
+	CreateUser(ctx context.Context, email string, password string) error
+	GetUserById(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	DisableUser(ctx context.Context, id uuid.UUID) error
+	SetUserRole(ctx context.Context, id uuid.UUID, role string) error
+	// SearchUsers finds the user whose id is query, and the users whose email contains it, ignoring case, by lowercased email.
+	SearchUsers(ctx context.Context, query string, limit int, offset int) (*[]model.User, error)
+}
+
+type AccountStore interface {
+	CreateAccount(ctx context.Context, user_id string, name string, status string) error
+	GetAccount(ctx context.Context, acc_id string) (*model.Account, error)
+	// GetAccountByNumber returns the account with the serial number, or fails with sql.ErrNoRows.
+	GetAccountByNumber(ctx context.Context, number int64) (*model.Account, error)
+	GetMyAccounts(ctx context.Context, user_id string, limit int, offset int) (*[]model.Account, error)
+	DisableAccount(ctx context.Context, acc_id string) error
+	/*
+		SetAccountStatus applies change to an account and notifies its members with an
+		account.status_changed outbox event. It fails with sql.ErrNoRows for unknown accounts and
+		with ErrAccountStatus when the account isn't in one of change.From.
+	*/
+	SetAccountStatus(ctx context.Context, acc_id string, change AccountStatusChange) (*model.Account, error)
+	// ExpireAccountFreezes makes active again the accounts whose freeze is over, notifying their members, and returns them.
+	ExpireAccountFreezes(ctx context.Context) (*[]model.Account, error)
+	/*
+		CloseAccount closes acc_id on its owner's request: within one movement, its balance is swept
+		to to_account_id by the transfer transaction_id and it becomes closed. It returns the
+		account and the sweep, nil for empty accounts. Both accounts are checked like the ones of a
+		transfer, and overdrawn accounts fail with ErrAccountOverdrawn. The pending payment requests
+		out of or into the account fail with 'account_closed', and its handle is deleted.
+	*/
+	CloseAccount(ctx context.Context, transaction_id uuid.UUID, acc_id string, to_account_id string) (*model.Account, *model.Transaction, error)
+	// ReopenAccount makes active again an account its owner closed at or after since, and fails with ErrAccountStatus otherwise.
+	ReopenAccount(ctx context.Context, acc_id string, since time.Time) (*model.Account, error)
+}
+
+// AccountStatusChange moves an account from one of From to Status, with its reason and the end of a freeze.
+type AccountStatusChange struct {
+	From         []string
+	Status       string
+	StatusReason *string
+	FrozenUntil  *time.Time
+}
+
+/*
+TransactionStore moves money. Each movement is atomic: balances and the transaction row are
+written together or not at all, and concurrent movements on the same account are serialized.
+Withdrawals and transfers fail with ErrInsufficientBalance rather than leave a negative balance,
+and with ErrLockTimeout when an account stays locked by other movements for too long. The status
+of every account is checked once locked, see CheckAccountStatus.
+*/
+type TransactionStore interface {
+	GetTransaction(ctx context.Context, transaction_id string) (*model.Transaction, error)
+	GetAccountTransactions(ctx context.Context, account_id string, limit int, offset int) (*[]model.Transaction, error)
+	DepositTransaction(ctx context.Context, transaction_id uuid.UUID, to_account_id string, amount decimal.Decimal) error
+	WithdrawalTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, amount decimal.Decimal) error
+	TransferTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, to_account_id string, amount decimal.Decimal) error
+	ReverseTransaction(ctx context.Context, reversal_id uuid.UUID, original_id string) (*model.Transaction, error)
+	// GetReversal returns the transaction reversing transaction_id, and fails with sql.ErrNoRows when it isn't reversed.
+	GetReversal(ctx context.Context, transaction_id string) (*model.Transaction, error)
+	Reconcile(ctx context.Context) (*[]AccountReconciliation, error)
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, session_id string, user_id string) error
+	GetSessionUserId(ctx context.Context, session_id string) (string, error)
+	RevokeSession(ctx context.Context, session_id string) error
+	RevokeUserSessions(ctx context.Context, user_id string) (int, error)
+}
+
+/*
+AuditStore is the append-only audit trail. The other stores write the events of their changes
+themselves, see WithAuditActor; CreateAuditEvent is for actions that change nothing in them,
+such as logins. Events are listed newest first.
+*/
+type AuditStore interface {
+	CreateAuditEvent(ctx context.Context, event model.AuditEvent) error
+	GetAuditEvents(ctx context.Context, target_type string, target_id string, limit int, offset int) (*[]model.AuditEvent, error)
+	SearchAuditEvents(ctx context.Context, filter AuditFilter, limit int, offset int) (*[]model.AuditEvent, error)
+}
+
+// AuditFilter narrows SearchAuditEvents down, zero fields match every event.
+type AuditFilter struct {
+	UserId     *uuid.UUID
+	Actor      string
+	Action     string
+	TargetType string
+	TargetId   string
+	// Events created at or after Since and before Until.
+	Since *time.Time
+	Until *time.Time
+}
+
+// ApiKeyStore only ever sees key hashes, see utils.HashApiKey.
+type ApiKeyStore interface {
+	CreateApiKey(ctx context.Context, user_id uuid.UUID, name string, key_hash string, prefix string) (*model.ApiKey, error)
+	GetApiKeyByHash(ctx context.Context, key_hash string) (*model.ApiKey, error)
+	GetUserApiKeys(ctx context.Context, user_id uuid.UUID) (*[]model.ApiKey, error)
+	RevokeApiKey(ctx context.Context, id uuid.UUID) error
+}
+
+/*
+EventStore is a per user log of events pushed to clients. Event ids increase per user, and
+ReadEvents returns the events published after after_id, oldest first, waiting up to wait for
+one when there are none yet. The log only keeps the latest EventRetention events.
+*/
+type EventStore interface {
+	PublishEvent(ctx context.Context, user_id string, event_type string, data json.RawMessage) (string, error)
+	// GetLatestEventId returns "0-0" when the user has no events.
+	GetLatestEventId(ctx context.Context, user_id string) (string, error)
+	ReadEvents(ctx context.Context, user_id string, after_id string, limit int, wait time.Duration) ([]model.Event, error)
+}
+
+/*
+WebhookStore keeps the endpoints users register and the deliveries of the outbox events to
+them. Deleted endpoints are hidden and get no more deliveries.
+*/
+type WebhookStore interface {
+	CreateWebhookEndpoint(ctx context.Context, user_id uuid.UUID, url string, secret string, event_types []string) (*model.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (*model.WebhookEndpoint, error)
+	GetUserWebhookEndpoints(ctx context.Context, user_id uuid.UUID) (*[]model.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error
+	/*
+		DispatchOutboxEvents takes the oldest limit undispatched outbox events, creates a pending
+		delivery of each to every endpoint of its user subscribed to its type, and marks it
+		dispatched. It returns how many events were dispatched.
+	*/
+	DispatchOutboxEvents(ctx context.Context, limit int) (int, error)
+	/*
+		ClaimDueDeliveries returns up to limit pending deliveries whose next attempt is due, and
+		postpones that attempt by lease so that other instances don't send them meanwhile.
+	*/
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]model.WebhookDelivery, error)
+	// RecordDeliveryAttempt logs an attempt, counts it and sets the delivery's status and next attempt.
+	RecordDeliveryAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, next_attempt_at time.Time) error
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error)
+	// GetEndpointDeliveries returns newest deliveries first.
+	GetEndpointDeliveries(ctx context.Context, endpoint_id uuid.UUID, limit int, offset int) (*[]model.WebhookDelivery, error)
+	// GetDeliveryAttempts returns oldest attempts first.
+	GetDeliveryAttempts(ctx context.Context, delivery_id uuid.UUID) (*[]model.WebhookDeliveryAttempt, error)
+	// RedeliverWebhook makes a delivery pending and due right away, whatever its status.
+	RedeliverWebhook(ctx context.Context, delivery_id uuid.UUID) error
+}
+
+/*
+ProcessorStore keeps the charges of the payment processor, which are the only deposits outside
+of sandbox mode. Each processor event is applied once, and a charge deposits its amount in the
+same database transaction that marks it succeeded, so it can't be credited twice.
+*/
+type ProcessorStore interface {
+	GetProcessorCharge(ctx context.Context, id string) (*model.ProcessorCharge, error)
+	/*
+		ApplyChargeEvent records a processor event and moves the charge to the status of the
+		event, see ChargeTransition, depositing it with transaction_id when it succeeds. It
+		reports whether the charge changed, and fails with ErrEventReplayed for an event applied
+		before and with ErrChargeMismatch when the account or amount differ from earlier events.
+		A charge succeeding for a closed account fails with ChargeRefundMessage instead, and one
+		for an account frozen for deposits fails with ErrAccountFrozen without being recorded.
+	*/
+	ApplyChargeEvent(ctx context.Context, event_id string, event_type string, charge model.ProcessorCharge, transaction_id uuid.UUID) (*model.ProcessorCharge, bool, error)
+}
+
+// LedgerStore keeps the chains of the transaction table and their signed checkpoints.
+type LedgerStore interface {
+	// Every account's head, sorted by account id.
+	GetLedgerHeads(ctx context.Context) (*[]model.LedgerHead, error)
+	GetLedgerHead(ctx context.Context, account_id uuid.UUID) (*model.LedgerHead, error)
+	// Every transaction of the account, oldest first.
+	GetAccountLedger(ctx context.Context, account_id uuid.UUID) (*[]model.Transaction, error)
+	CreateLedgerCheckpoint(ctx context.Context, checkpoint model.LedgerCheckpoint) error
+	// Newest first.
+	GetLedgerCheckpoints(ctx context.Context, limit int, offset int) (*[]model.LedgerCheckpoint, error)
+}
+
+/*
+AdjustmentStore keeps the requests of staff to credit or debit an account, with the decisions of
+other staff on them. An adjustment is posted as an 'adjustment' transaction by the approval that
+brings it to its required approvals, in the same database transaction.
+*/
+type AdjustmentStore interface {
+	CreateAdjustment(ctx context.Context, adjustment model.Adjustment) (*model.Adjustment, error)
+	GetAdjustment(ctx context.Context, id uuid.UUID) (*model.Adjustment, error)
+	// Newest first.
+	GetAdjustments(ctx context.Context, filter AdjustmentFilter, limit int, offset int) (*[]model.Adjustment, error)
+	// Oldest first.
+	GetAdjustmentDecisions(ctx context.Context, adjustment_id uuid.UUID) (*[]model.AdjustmentDecision, error)
+	/*
+		DecideAdjustment records the decision of a staff member on a pending adjustment. A
+		rejection ends it, and the approval reaching its required approvals posts it with
+		transaction_id. It fails with ErrAdjustmentDecided when the adjustment isn't pending anymore,
+		ErrSelfApproval when the staff member proposed it and ErrAlreadyDecided when they already
+		approved it. Nothing is recorded when posting fails, such as with ErrInsufficientBalance.
+	*/
+	DecideAdjustment(ctx context.Context, decision model.AdjustmentDecision, transaction_id uuid.UUID) (*model.Adjustment, error)
+}
+
+// AdjustmentFilter narrows GetAdjustments down, zero fields match every adjustment.
+type AdjustmentFilter struct {
+	AccountId *uuid.UUID
+	Status    string
+}
+
+/*
+MemberStore keeps who shares an account, with the invitations and removal requests that change
+it. CreateAccount makes the creator of an account its first owner, and an account always keeps
+at least one owner: account.user_id is one of them, handed over when it's removed.
+*/
+type MemberStore interface {
+	GetAccountMember(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) (*model.AccountMember, error)
+	// Oldest first.
+	GetAccountMembers(ctx context.Context, account_id uuid.UUID) (*[]model.AccountMember, error)
+	// Every account the user is a member of.
+	GetUserMemberships(ctx context.Context, user_id uuid.UUID) (*[]model.AccountMember, error)
+	/*
+		CreateInvitation invites invitation.Email to the account. It fails with ErrAlreadyMember when
+		the user with this email is a member already, and with ErrAlreadyInvited when an invitation
+		to the email is pending.
+	*/
+	CreateInvitation(ctx context.Context, invitation model.AccountInvitation) (*model.AccountInvitation, error)
+	GetInvitation(ctx context.Context, id uuid.UUID) (*model.AccountInvitation, error)
+	// Newest first.
+	GetAccountInvitations(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.AccountInvitation, error)
+	// Pending invitations to email, newest first.
+	GetPendingInvitations(ctx context.Context, email string) (*[]model.AccountInvitation, error)
+	/*
+		DecideInvitation accepts or declines a pending invitation for user_id, the user with its
+		email. Accepting makes them a member. It fails with ErrInvitationDecided when the invitation
+		isn't pending anymore and with ErrAlreadyMember when they joined meanwhile.
+	*/
+	DecideInvitation(ctx context.Context, id uuid.UUID, user_id uuid.UUID, accept bool) (*model.AccountInvitation, error)
+	/*
+		RequestMemberRemoval asks for the removal of removal.UserId by removal.RequestedBy, an owner
+		or the member themselves. The request of an owner counts as their approval, so it's carried
+		out at once unless it removes an owner, which another owner must approve. It fails with
+		ErrNotMember, ErrNotOwner, ErrRemovalPending or ErrLastOwner.
+	*/
+	RequestMemberRemoval(ctx context.Context, removal model.MemberRemoval) (*model.MemberRemoval, error)
+	GetMemberRemoval(ctx context.Context, id uuid.UUID) (*model.MemberRemoval, error)
+	// Newest first.
+	GetMemberRemovals(ctx context.Context, account_id uuid.UUID, limit int, offset int) (*[]model.MemberRemoval, error)
+	/*
+		DecideMemberRemoval approves or rejects a pending removal by owner_id, which carries it out
+		when approving. It fails with ErrRemovalDecided when it isn't pending anymore, ErrNotOwner
+		when owner_id isn't an owner, ErrOwnRemoval when they requested the removal of an owner and
+		ErrLastOwner when it would leave the account without owners.
+	*/
+	DecideMemberRemoval(ctx context.Context, id uuid.UUID, owner_id uuid.UUID, approve bool) (*model.MemberRemoval, error)
+}
+
+/*
+PaymentRequestStore keeps the approval policies of accounts and the transfers they hold for the
+approval of owners. The store only records decisions: approved requests are executed with
+TransferTransaction and their id, then completed.
+*/
+type PaymentRequestStore interface {
+	GetApprovalPolicy(ctx context.Context, account_id uuid.UUID) (*model.ApprovalPolicy, error)
+	// SetApprovalPolicy creates or replaces the policy of policy.AccountId.
+	SetApprovalPolicy(ctx context.Context, policy model.ApprovalPolicy) (*model.ApprovalPolicy, error)
+	// DeleteApprovalPolicy removes the policy of an account on behalf of user_id, or fails with sql.ErrNoRows.
+	DeleteApprovalPolicy(ctx context.Context, account_id uuid.UUID, user_id uuid.UUID) error
+	CreatePaymentRequest(ctx context.Context, request model.PaymentRequest) (*model.PaymentRequest, error)
+	GetPaymentRequest(ctx context.Context, id uuid.UUID) (*model.PaymentRequest, error)
+	GetPaymentRequestByTransaction(ctx context.Context, transaction_id uuid.UUID) (*model.PaymentRequest, error)
+	// Requests out of the account, newest first. An empty status matches every status.
+	GetPaymentRequests(ctx context.Context, account_id uuid.UUID, status string, limit int, offset int) (*[]model.PaymentRequest, error)
+	// Oldest first.
+	GetPaymentRequestDecisions(ctx context.Context, request_id uuid.UUID) (*[]model.PaymentRequestDecision, error)
+	/*
+		DecidePaymentRequest records the decision of an owner of the account on a pending request. A
+		rejection ends it, and the approval reaching its required approvals makes it approved. It
+		fails with ErrRequestDecided when the request isn't pending anymore, ErrRequestExpired when
+		it's past its expiry, ErrOwnRequest when the owner submitted it, ErrRequestTwice when they
+		already approved it and ErrNotOwner when they aren't an owner of the account.
+	*/
+	DecidePaymentRequest(ctx context.Context, decision model.PaymentRequestDecision) (*model.PaymentRequest, error)
+	/*
+		CompletePaymentRequest ends an approved request as executed, or as failed with
+		failure_reason. It fails with ErrRequestDecided when the request isn't approved, such as
+		when another instance completed it first.
+	*/
+	CompletePaymentRequest(ctx context.Context, id uuid.UUID, failure_reason *string) (*model.PaymentRequest, error)
+	// ExpirePaymentRequests ends the pending requests past their expiry, and returns them.
+	ExpirePaymentRequests(ctx context.Context) (*[]model.PaymentRequest, error)
+	// Approved requests not completed yet, oldest approval first.
+	GetApprovedPaymentRequests(ctx context.Context, limit int) (*[]model.PaymentRequest, error)
+}
+
+// PayeeStore keeps the accounts users saved under a nickname, see model.Payee.
+type PayeeStore interface {
+	/*
+		CreatePayee saves payee.AccountId for payee.UserId. It fails with ErrPayeeExists when the
+		user saved the account already, and with ErrNicknameTaken when another of their payees has
+		the nickname, ignoring case.
+	*/
+	CreatePayee(ctx context.Context, payee model.Payee) (*model.Payee, error)
+	GetPayee(ctx context.Context, id uuid.UUID) (*model.Payee, error)
+	// GetPayeeByAccount returns the payee the user saved account_id as, or fails with sql.ErrNoRows.
+	GetPayeeByAccount(ctx context.Context, user_id uuid.UUID, account_id uuid.UUID) (*model.Payee, error)
+	// By lowercased nickname.
+	GetUserPayees(ctx context.Context, user_id uuid.UUID, limit int, offset int) (*[]model.Payee, error)
+	// RenamePayee changes the nickname of a payee, and fails with ErrNicknameTaken like CreatePayee.
+	RenamePayee(ctx context.Context, id uuid.UUID, nickname string) (*model.Payee, error)
+	DeletePayee(ctx context.Context, id uuid.UUID) error
+}
+
+type HandleStore interface {
+	/*
+		SetHandle gives handle.UserId the handle, pointing to handle.AccountId, in place of the one
+		they had. It fails with ErrHandleTaken when another user has the handle. Handles are left
+		to the holders of their accounts, and go away when the member they belong to is removed.
+	*/
+	SetHandle(ctx context.Context, handle model.Handle) (*model.Handle, error)
+	// GetHandle returns the handle, lowercase and without its @, or fails with sql.ErrNoRows.
+	GetHandle(ctx context.Context, handle string) (*model.Handle, error)
+	GetUserHandle(ctx context.Context, user_id uuid.UUID) (*model.Handle, error)
+	GetAccountHandle(ctx context.Context, account_id uuid.UUID) (*model.Handle, error)
+	DeleteHandle(ctx context.Context, user_id uuid.UUID) error
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Timeouts struct {
+	// Deadline of single reads and writes.
+	Query time.Duration
+	// Deadline of a whole money movement, from BEGIN to COMMIT.
+	Transaction time.Duration
+	// How long a money movement waits for an account's row lock (Postgres lock_timeout).
+	Lock time.Duration
+	// Deadline of each statement inside a money movement (Postgres statement_timeout).
+	Statement time.Duration
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Query:       5 * time.Second,
+		Transaction: 10 * time.Second,
+		Lock:        2 * time.Second,
+		Statement:   5 * time.Second,
+	}
+}
+
+// TimeoutsFromEnv reads DB_QUERY_TIMEOUT, DB_TRANSACTION_TIMEOUT, DB_LOCK_TIMEOUT and DB_STATEMENT_TIMEOUT (e.g. "2s", "500ms").
+func TimeoutsFromEnv() Timeouts {
+	timeouts := DefaultTimeouts()
+
+	for env, timeout := range map[string]*time.Duration{
+		"DB_QUERY_TIMEOUT":       &timeouts.Query,
+		"DB_TRANSACTION_TIMEOUT": &timeouts.Transaction,
+		"DB_LOCK_TIMEOUT":        &timeouts.Lock,
+		"DB_STATEMENT_TIMEOUT":   &timeouts.Statement,
+	} {
+		raw, ok := os.LookupEnv(env)
+		if !ok || raw == "" {
+			continue
+		}
+
+		value, err := time.ParseDuration(raw)
+		if err != nil || value <= 0 {
+			log.Fatalf("Invalid %s env: %q", env, raw)
+		}
+		*timeout = value
+	}
+
+	return timeouts
+}
+
+/*
+beginMovement starts the serializable transaction money movements run in. Waiting for a row
+lock is bounded by lock_timeout, so a contended account fails fast with ErrLockTimeout
+instead of piling up connections until the whole transaction times out.
+*/
+func beginMovement(ctx context.Context, pg *sqlx.DB, timeouts Timeouts) (*sqlx.Tx, error) {
+	tx, err := pg.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`SELECT set_config('lock_timeout', $1, true), set_config('statement_timeout', $2, true)`,
+		fmt.Sprintf("%dms", timeouts.Lock.Milliseconds()),
+		fmt.Sprintf("%dms", timeouts.Statement.Milliseconds()),
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// translateTimeout turns Postgres lock and statement timeouts into ErrLockTimeout and ErrQueryTimeout.
+func translateTimeout(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// The caller went away (e.g. the client disconnected): that's not a timeout.
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return context.Canceled
+	}
+
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) {
+		switch pq_err.Code {
+		// lock_not_available
+		case "55P03":
+			return ErrLockTimeout
+		// query_canceled, raised by statement_timeout and by context deadlines
+		case "57014":
+			return ErrQueryTimeout
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+
+	return err
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"broke-bank/model"
 	"broke-bank/utils"
+	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -10,12 +12,17 @@ import (
 )
 
 type TransactionRepository struct {
-	Pg *sqlx.DB
+	Pg       *sqlx.DB
+	Timeouts Timeouts
 }
 
-func (tr *TransactionRepository) GetTransaction(transaction_id string) (*model.Transaction, error) {
+func (tr *TransactionRepository) GetTransaction(ctx context.Context, transaction_id string) (*model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Query)
+	defer cancel()
+
 	transaction := new(model.Transaction)
-	err := tr.Pg.Get(
+	err := tr.Pg.GetContext(
+		ctx,
 		transaction,
 		`SELECT * FROM "transaction" tx WHERE tx.id = $1`,
 		transaction_id,
@@ -24,27 +31,53 @@ func (tr *TransactionRepository) GetTransaction(transaction_id string) (*model.T
 	return transaction, err
 }
 
-func (tr *TransactionRepository) DepositTransaction(transaction_id uuid.UUID, to_account_id string, amount decimal.Decimal) error {
-	tx, err := tr.Pg.Beginx()
+func (tr *TransactionRepository) GetReversal(ctx context.Context, transaction_id string) (*model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Query)
+	defer cancel()
+
+	reversal := new(model.Transaction)
+	err := tr.Pg.GetContext(ctx, reversal, `SELECT * FROM "transaction" tx WHERE tx.reversal_of = $1`, transaction_id)
+
+	return reversal, err
+}
+
+func (tr *TransactionRepository) DepositTransaction(ctx context.Context, transaction_id uuid.UUID, to_account_id string, amount decimal.Decimal) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, tr.Pg, tr.Timeouts)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec(`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE`); err != nil {
+	account_balance := new(AccountBalance)
+	if err = tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, to_account_id); err != nil {
 		return err
 	}
 
-	account_balance := new(AccountBalance)
-	if err = tx.Get(account_balance, `SELECT acc.id, acc.balance FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, to_account_id); err != nil {
+	if err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, false); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Add(amount), to_account_id); err != nil {
+	if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Add(amount), to_account_id); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`INSERT INTO "transaction" (id, type, to_account_id, amount) VALUES ($1, 'deposit', $2, $3)`, transaction_id, to_account_id, amount); err != nil {
+	if _, err = tx.ExecContext(ctx, `INSERT INTO "transaction" (id, type, to_account_id, amount) VALUES ($1, 'deposit', $2, $3)`, transaction_id, to_account_id, amount); err != nil {
+		return err
+	}
+
+	if err = chainTransaction(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	if err = writeMovementOutbox(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	if err = writeMovementAudit(ctx, tx, transaction_id, map[uuid.UUID]decimal.Decimal{account_balance.Id: account_balance.Balance}); err != nil {
 		return err
 	}
 
@@ -53,27 +86,47 @@ func (tr *TransactionRepository) DepositTransaction(transaction_id uuid.UUID, to
 	return err
 }
 
-func (tr *TransactionRepository) WithdrawalTransaction(transaction_id uuid.UUID, from_account_id string, amount decimal.Decimal) error {
-	tx, err := tr.Pg.Beginx()
+func (tr *TransactionRepository) WithdrawalTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, amount decimal.Decimal) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, tr.Pg, tr.Timeouts)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec(`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE`); err != nil {
+	account_balance := new(AccountBalance)
+	if err = tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, from_account_id); err != nil {
 		return err
 	}
 
-	account_balance := new(AccountBalance)
-	if err = tx.Get(account_balance, `SELECT acc.id, acc.balance FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, from_account_id); err != nil {
+	if err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, true); err != nil {
+		return err
+	}
+
+	if account_balance.Balance.LessThan(amount) {
+		return ErrInsufficientBalance
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Sub(amount), from_account_id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO "transaction" (id, type, from_account_id, amount) VALUES ($1, 'withdrawal', $2, $3)`, transaction_id, from_account_id, amount); err != nil {
+		return err
+	}
+
+	if err = chainTransaction(ctx, tx, transaction_id); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`UPDATE "account" SET balance = $1 WHERE id = $2`, account_balance.Balance.Sub(amount), from_account_id); err != nil {
+	if err = writeMovementOutbox(ctx, tx, transaction_id); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`INSERT INTO "transaction" (id, type, from_account_id, amount) VALUES ($1, 'withdrawal', $2, $3)`, transaction_id, from_account_id, amount); err != nil {
+	if err = writeMovementAudit(ctx, tx, transaction_id, map[uuid.UUID]decimal.Decimal{account_balance.Id: account_balance.Balance}); err != nil {
 		return err
 	}
 
@@ -82,9 +135,69 @@ func (tr *TransactionRepository) WithdrawalTransaction(transaction_id uuid.UUID,
 	return err
 }
 
+/*
+writeMovementOutbox records the events of a movement in the outbox, within its database
+transaction: transaction.created for every member of the accounts it touched, once per member,
+and account.balance_changed with the new balance of each account for each of its members.
+*/
+func writeMovementOutbox(ctx context.Context, tx *sqlx.Tx, transaction_id uuid.UUID) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO "outbox_event" (user_id, type, data)
+		SELECT DISTINCT
+			mem.user_id,
+			'transaction.created',
+			jsonb_build_object(
+				'id', tx.id,
+				'type', tx.type,
+				'amount', tx.amount::TEXT,
+				'from_account_id', tx.from_account_id,
+				'to_account_id', tx.to_account_id,
+				'issued_at', tx.date_issued,
+				'reversal_of', tx.reversal_of
+			)
+		FROM
+			"transaction" tx
+		JOIN
+			"account_member" mem ON mem.account_id IN (tx.from_account_id, tx.to_account_id)
+		WHERE
+			tx.id = $1
+		`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		INSERT INTO "outbox_event" (user_id, type, data)
+		SELECT
+			mem.user_id,
+			'account.balance_changed',
+			jsonb_build_object('account_id', acc.id, 'balance', acc.balance::TEXT, 'transaction_id', tx.id)
+		FROM
+			"transaction" tx
+		JOIN
+			"account" acc ON acc.id IN (tx.from_account_id, tx.to_account_id)
+		JOIN
+			"account_member" mem ON mem.account_id = acc.id
+		WHERE
+			tx.id = $1
+		`,
+		transaction_id,
+	)
+
+	return err
+}
+
 type AccountBalance struct {
-	Id      uuid.UUID       `db:"id" json:"id"`
-	Balance decimal.Decimal `db:"balance" json:"balance"`
+	Id          uuid.UUID       `db:"id" json:"id"`
+	Balance     decimal.Decimal `db:"balance" json:"balance"`
+	Status      string          `db:"status" json:"status"`
+	FrozenUntil *time.Time      `db:"frozen_until" json:"frozen_until"`
 }
 
 func GetAccountBalance(first_account_balance *AccountBalance, second_account_balance *AccountBalance, account_id string) decimal.Decimal {
@@ -95,40 +208,77 @@ func GetAccountBalance(first_account_balance *AccountBalance, second_account_bal
 	return second_account_balance.Balance
 }
 
-func (tr *TransactionRepository) TransferTransaction(transaction_id uuid.UUID, from_account_id string, to_account_id string, amount decimal.Decimal) error {
-	tx, err := tr.Pg.Beginx()
+func (tr *TransactionRepository) TransferTransaction(ctx context.Context, transaction_id uuid.UUID, from_account_id string, to_account_id string, amount decimal.Decimal) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	// Both rows are matched by their canonical ids below, so an account spelled two ways must not slip through as two accounts.
+	from_id, err := uuid.Parse(from_account_id)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	to_id, err := uuid.Parse(to_account_id)
+	if err != nil {
+		return err
+	}
+	if from_id == to_id {
+		return ErrSameAccount
+	}
+	from_account_id, to_account_id = from_id.String(), to_id.String()
 
-	if _, err := tx.Exec(`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE`); err != nil {
+	tx, err := beginMovement(ctx, tr.Pg, tr.Timeouts)
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
 	// Sort the UUIDs here before locking; this will ensure that the locks always happen in the same order to avoid deadlock issues.
 	first_id_lock, second_id_lock := utils.SortStringUUIDs(from_account_id, to_account_id)
 	first_account_balance := new(AccountBalance)
-	if err = tx.Get(first_account_balance, `SELECT acc.id, acc.balance FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, first_id_lock); err != nil {
+	if err = tx.GetContext(ctx, first_account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, first_id_lock); err != nil {
 		return err
 	}
 	second_account_balance := new(AccountBalance)
-	if err = tx.Get(second_account_balance, `SELECT acc.id, acc.balance FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, second_id_lock); err != nil {
+	if err = tx.GetContext(ctx, second_account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, second_id_lock); err != nil {
 		return err
 	}
 
 	from_account_balance := GetAccountBalance(first_account_balance, second_account_balance, from_account_id)
 	to_account_balance := GetAccountBalance(first_account_balance, second_account_balance, to_account_id)
 
-	if _, err = tx.Exec(`UPDATE "account" SET balance = $1 WHERE id = $2`, from_account_balance.Sub(amount), from_account_id); err != nil {
+	for _, account_balance := range []*AccountBalance{first_account_balance, second_account_balance} {
+		if err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, account_balance.Id.String() == from_account_id); err != nil {
+			return err
+		}
+	}
+
+	if from_account_balance.LessThan(amount) {
+		return ErrInsufficientBalance
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, from_account_balance.Sub(amount), from_account_id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, to_account_balance.Add(amount), to_account_id); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`UPDATE "account" SET balance = $1 WHERE id = $2`, to_account_balance.Add(amount), to_account_id); err != nil {
+	if _, err = tx.ExecContext(ctx, `INSERT INTO "transaction" (id, type, from_account_id, to_account_id, amount) VALUES ($1, 'transfer', $2, $3, $4)`, transaction_id, from_account_id, to_account_id, amount); err != nil {
 		return err
 	}
 
-	if _, err = tx.Exec(`INSERT INTO "transaction" (id, type, from_account_id, to_account_id, amount) VALUES ($1, 'transfer', $2, $3, $4)`, transaction_id, from_account_id, to_account_id, amount); err != nil {
+	if err = chainTransaction(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	if err = writeMovementOutbox(ctx, tx, transaction_id); err != nil {
+		return err
+	}
+
+	before := map[uuid.UUID]decimal.Decimal{first_account_balance.Id: first_account_balance.Balance, second_account_balance.Id: second_account_balance.Balance}
+	if err = writeMovementAudit(ctx, tx, transaction_id, before); err != nil {
 		return err
 	}
 
@@ -136,3 +286,195 @@ func (tr *TransactionRepository) TransferTransaction(transaction_id uuid.UUID, f
 
 	return err
 }
+
+func (tr *TransactionRepository) GetAccountTransactions(ctx context.Context, account_id string, limit int, offset int) (*[]model.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Query)
+	defer cancel()
+
+	transactions := new([]model.Transaction)
+	err := tr.Pg.SelectContext(
+		ctx,
+		transactions,
+		`
+		SELECT
+			*
+		FROM
+			"transaction" tx
+		WHERE
+			tx.from_account_id = $1 OR tx.to_account_id = $1
+		ORDER BY
+			tx.date_issued DESC, tx.id DESC
+		LIMIT
+			$2
+		OFFSET
+			$3
+		`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return transactions, err
+}
+
+/*
+ReverseTransaction posts a compensating transaction for original_id: deposits become withdrawals,
+withdrawals become deposits and transfers are sent back. The reversal is linked through
+reversal_of, whose unique constraint guarantees a transaction is reversed at most once.
+*/
+func (tr *TransactionRepository) ReverseTransaction(ctx context.Context, reversal_id uuid.UUID, original_id string) (reversal *model.Transaction, err error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Transaction)
+	defer cancel()
+	defer func() { err = translateTimeout(ctx, err) }()
+
+	tx, err := beginMovement(ctx, tr.Pg, tr.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if reversal, err = reverseTransaction(ctx, tx, reversal_id, original_id); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
+// reverseTransaction posts within tx the reversal reversal_id of original_id, see ReverseTransaction.
+func reverseTransaction(ctx context.Context, tx *sqlx.Tx, reversal_id uuid.UUID, original_id string) (reversal *model.Transaction, err error) {
+	original := new(model.Transaction)
+	if err = tx.GetContext(ctx, original, `SELECT * FROM "transaction" tx WHERE tx.id = $1 FOR UPDATE`, original_id); err != nil {
+		return nil, err
+	}
+
+	if original.ReversalOf != nil {
+		return nil, ErrReversalOfReversal
+	}
+
+	already_reversed := false
+	if err = tx.GetContext(ctx, &already_reversed, `SELECT EXISTS (SELECT 1 FROM "transaction" tx WHERE tx.reversal_of = $1)`, original_id); err != nil {
+		return nil, err
+	}
+	if already_reversed {
+		return nil, ErrAlreadyReversed
+	}
+
+	reversal = &model.Transaction{
+		Id:            reversal_id,
+		Type:          original.Type,
+		FromAccountId: original.ToAccountId,
+		ToAccountId:   original.FromAccountId,
+		Amount:        original.Amount,
+		ReversalOf:    &original.Id,
+	}
+	switch original.Type {
+	case "deposit":
+		reversal.Type = "withdrawal"
+	case "withdrawal":
+		reversal.Type = "deposit"
+	}
+
+	// Lock in the same order as TransferTransaction to avoid deadlocks.
+	lock_ids := []string{}
+	if reversal.FromAccountId != nil && reversal.ToAccountId != nil {
+		first_id_lock, second_id_lock := utils.SortUUIDs(*reversal.FromAccountId, *reversal.ToAccountId)
+		lock_ids = append(lock_ids, first_id_lock.String(), second_id_lock.String())
+	} else if reversal.FromAccountId != nil {
+		lock_ids = append(lock_ids, reversal.FromAccountId.String())
+	} else {
+		lock_ids = append(lock_ids, reversal.ToAccountId.String())
+	}
+
+	balances := map[uuid.UUID]decimal.Decimal{}
+	for _, lock_id := range lock_ids {
+		account_balance := new(AccountBalance)
+		if err = tx.GetContext(ctx, account_balance, `SELECT acc.id, acc.balance, acc.status, acc.frozen_until FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, lock_id); err != nil {
+			return nil, err
+		}
+		debit := reversal.FromAccountId != nil && *reversal.FromAccountId == account_balance.Id
+		if err = CheckAccountStatus(account_balance.Status, account_balance.FrozenUntil, debit); err != nil {
+			return nil, err
+		}
+		balances[account_balance.Id] = account_balance.Balance
+	}
+
+	if reversal.FromAccountId != nil {
+		from_balance := balances[*reversal.FromAccountId]
+		if from_balance.LessThan(reversal.Amount) {
+			return nil, ErrInsufficientBalance
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, from_balance.Sub(reversal.Amount), reversal.FromAccountId); err != nil {
+			return nil, err
+		}
+	}
+
+	if reversal.ToAccountId != nil {
+		if _, err = tx.ExecContext(ctx, `UPDATE "account" SET balance = $1 WHERE id = $2`, balances[*reversal.ToAccountId].Add(reversal.Amount), reversal.ToAccountId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.GetContext(ctx,
+		reversal,
+		`INSERT INTO "transaction" (id, type, from_account_id, to_account_id, amount, reversal_of) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`,
+		reversal.Id, reversal.Type, reversal.FromAccountId, reversal.ToAccountId, reversal.Amount, reversal.ReversalOf,
+	); err != nil {
+		return nil, err
+	}
+
+	if err = chainTransaction(ctx, tx, reversal.Id); err != nil {
+		return nil, err
+	}
+
+	if err = writeMovementOutbox(ctx, tx, reversal.Id); err != nil {
+		return nil, err
+	}
+
+	if err = writeMovementAudit(ctx, tx, reversal.Id, balances); err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
+type AccountReconciliation struct {
+	Id              uuid.UUID       `db:"id" json:"id"`
+	Balance         decimal.Decimal `db:"balance" json:"balance"`
+	ExpectedBalance decimal.Decimal `db:"expected_balance" json:"expected_balance"`
+}
+
+// Reconcile returns every account whose balance doesn't match the sum of its transactions.
+func (tr *TransactionRepository) Reconcile(ctx context.Context) (*[]AccountReconciliation, error) {
+	ctx, cancel := context.WithTimeout(ctx, tr.Timeouts.Query)
+	defer cancel()
+
+	mismatches := new([]AccountReconciliation)
+	err := tr.Pg.SelectContext(
+		ctx,
+		mismatches,
+		`
+		SELECT
+			acc.id, acc.balance, COALESCE(movements.total, 0) AS expected_balance
+		FROM
+			"account" acc
+		LEFT JOIN (
+			SELECT account_id, SUM(amount) AS total FROM (
+				SELECT tx.to_account_id AS account_id, tx.amount FROM "transaction" tx WHERE tx.to_account_id IS NOT NULL
+				UNION ALL
+				SELECT tx.from_account_id AS account_id, -tx.amount FROM "transaction" tx WHERE tx.from_account_id IS NOT NULL
+			) deltas
+			GROUP BY account_id
+		) movements ON movements.account_id = acc.id
+		WHERE
+			acc.balance <> COALESCE(movements.total, 0)
+		ORDER BY
+			acc.id
+		`,
+	)
+
+	return mismatches, err
+}
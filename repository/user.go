@@ -2,46 +2,179 @@ package repository
 
 import (
 	"broke-bank/model"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
 type UserRepository struct {
-	Pg *sqlx.DB
+	Pg       *sqlx.DB
+	Timeouts Timeouts
 }
 
-func (ur *UserRepository) CreateUser(email string, password string) error {
-	_, err := ur.Pg.Exec(
-		`INSERT INTO "user" (email, password)
-		VALUES ($1, $2)`,
-		email,
-		password,
-	)
+const user_columns = `id, email, password, disabled_at, role, created_at, updated_at`
+
+func (ur *UserRepository) CreateUser(ctx context.Context, email string, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, ur.Pg, func(tx *sqlx.Tx) error {
+		user := new(model.User)
+		err := tx.GetContext(
+			ctx,
+			user,
+			`INSERT INTO "user" (email, password)
+			VALUES ($1, $2)
+			RETURNING `+user_columns,
+			email,
+			password,
+		)
+		if err != nil {
+			return err
+		}
 
-	return err
+		event, err := UserAuditEvent(ctx, "user.register", nil, user)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
 }
 
-func (ur *UserRepository) GetUserById(id uuid.UUID) (*model.User, error) {
+func (ur *UserRepository) GetUserById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
 	user := new(model.User)
-	err := ur.Pg.Get(
+	err := ur.Pg.GetContext(
+		ctx,
 		user,
-		`SELECT u.id, u.email, u.password, u.created_at, u.updated_at
-		FROM "user" u WHERE u.id=$1`,
+		`SELECT `+user_columns+` FROM "user" u WHERE u.id=$1`,
 		id,
 	)
 
 	return user, err
 }
 
-func (ur *UserRepository) GetUserByEmail(email string) (*model.User, error) {
+func (ur *UserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
 	user := new(model.User)
-	err := ur.Pg.Get(
+	err := ur.Pg.GetContext(
+		ctx,
 		user,
-		`SELECT u.id, u.email, u.password, u.created_at, u.updated_at
-		FROM "user" u WHERE u.email=$1`,
+		`SELECT `+user_columns+` FROM "user" u WHERE u.email=$1`,
 		email,
 	)
 
 	return user, err
 }
+
+// DisableUser disables an active user, unknown and already disabled users are left as they are.
+func (ur *UserRepository) DisableUser(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, ur.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.User)
+		err := tx.GetContext(
+			ctx,
+			before,
+			`SELECT `+user_columns+` FROM "user" u WHERE u.id = $1 FOR UPDATE`,
+			id,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil || before.DisabledAt != nil {
+			return err
+		}
+
+		after := new(model.User)
+		err = tx.GetContext(
+			ctx,
+			after,
+			`UPDATE "user"
+			SET disabled_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+user_columns,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := UserAuditEvent(ctx, "user.disable", before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+}
+
+// SetUserRole changes the role of a user, and fails with sql.ErrNoRows for unknown users.
+func (ur *UserRepository) SetUserRole(ctx context.Context, id uuid.UUID, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
+	return inTransaction(ctx, ur.Pg, func(tx *sqlx.Tx) error {
+		before := new(model.User)
+		if err := tx.GetContext(ctx, before, `SELECT `+user_columns+` FROM "user" u WHERE u.id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+
+		after := new(model.User)
+		err := tx.GetContext(
+			ctx,
+			after,
+			`UPDATE "user"
+			SET role = $2, updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+user_columns,
+			id,
+			role,
+		)
+		if err != nil {
+			return err
+		}
+
+		event, err := UserAuditEvent(ctx, "user.set_role", before, after)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditEvent(ctx, tx, event)
+	})
+}
+
+func (ur *UserRepository) SearchUsers(ctx context.Context, query string, limit int, offset int) (*[]model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, ur.Timeouts.Query)
+	defer cancel()
+
+	// Emails are matched as substrings, with LIKE's wildcards escaped.
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(query)) + "%"
+
+	users := new([]model.User)
+	err := ur.Pg.SelectContext(
+		ctx,
+		users,
+		`SELECT `+user_columns+`
+		FROM "user" u
+		WHERE u.id::text = $1 OR lower(u.email) LIKE $2
+		ORDER BY lower(u.email), u.id
+		LIMIT $3 OFFSET $4`,
+		strings.ToLower(query),
+		pattern,
+		limit,
+		offset,
+	)
+
+	return users, err
+}
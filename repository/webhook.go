@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"broke-bank/model"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	Pg       *sqlx.DB
+	Timeouts Timeouts
+}
+
+const webhook_endpoint_columns = `we.id, we.user_id, we.url, we.secret, we.event_types, we.created_at, we.deleted_at`
+
+const webhook_delivery_columns = `wd.id, wd.endpoint_id, wd.event_id, oe.type AS event_type, oe.data AS event_data, oe.created_at AS event_created_at,
+	wd.status, wd.attempts, wd.next_attempt_at, wd.created_at, wd.updated_at`
+
+func (wr *WebhookRepository) CreateWebhookEndpoint(ctx context.Context, user_id uuid.UUID, url string, secret string, event_types []string) (*model.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	endpoint := new(model.WebhookEndpoint)
+	err := wr.Pg.GetContext(
+		ctx,
+		endpoint,
+		`INSERT INTO "webhook_endpoint" AS we (user_id, url, secret, event_types)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+webhook_endpoint_columns,
+		user_id,
+		url,
+		secret,
+		pq.StringArray(event_types),
+	)
+
+	return endpoint, err
+}
+
+func (wr *WebhookRepository) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (*model.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	endpoint := new(model.WebhookEndpoint)
+	err := wr.Pg.GetContext(
+		ctx,
+		endpoint,
+		`SELECT `+webhook_endpoint_columns+`
+		FROM "webhook_endpoint" we WHERE we.id = $1 AND we.deleted_at IS NULL`,
+		id,
+	)
+
+	return endpoint, err
+}
+
+func (wr *WebhookRepository) GetUserWebhookEndpoints(ctx context.Context, user_id uuid.UUID) (*[]model.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	endpoints := new([]model.WebhookEndpoint)
+	err := wr.Pg.SelectContext(
+		ctx,
+		endpoints,
+		`SELECT `+webhook_endpoint_columns+`
+		FROM "webhook_endpoint" we WHERE we.user_id = $1 AND we.deleted_at IS NULL
+		ORDER BY we.created_at DESC, we.id DESC`,
+		user_id,
+	)
+
+	return endpoints, err
+}
+
+func (wr *WebhookRepository) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	var deleted_id uuid.UUID
+	return wr.Pg.GetContext(
+		ctx,
+		&deleted_id,
+		`UPDATE "webhook_endpoint" SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id`,
+		id,
+	)
+}
+
+/*
+DispatchOutboxEvents runs as a single statement, so an event is either marked dispatched along
+with its deliveries or left for the next call. SKIP LOCKED lets every instance dispatch at once.
+*/
+func (wr *WebhookRepository) DispatchOutboxEvents(ctx context.Context, limit int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	res, err := wr.Pg.ExecContext(
+		ctx,
+		`
+		WITH events AS (
+			SELECT oe.id, oe.user_id, oe.type
+			FROM "outbox_event" oe
+			WHERE oe.dispatched_at IS NULL
+			ORDER BY oe.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), deliveries AS (
+			INSERT INTO "webhook_delivery" (endpoint_id, event_id)
+			SELECT we.id, events.id
+			FROM events
+			JOIN "webhook_endpoint" we ON we.user_id = events.user_id
+			WHERE we.deleted_at IS NULL AND (cardinality(we.event_types) = 0 OR events.type = ANY(we.event_types))
+			ON CONFLICT (endpoint_id, event_id) DO NOTHING
+		)
+		UPDATE "outbox_event" SET dispatched_at = NOW()
+		WHERE id IN (SELECT id FROM events)
+		`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	dispatched, err := res.RowsAffected()
+	return int(dispatched), err
+}
+
+func (wr *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	deliveries := new([]model.WebhookDelivery)
+	err := wr.Pg.SelectContext(
+		ctx,
+		deliveries,
+		`
+		WITH due AS (
+			SELECT wd.id
+			FROM "webhook_delivery" wd
+			JOIN "webhook_endpoint" we ON we.id = wd.endpoint_id
+			WHERE wd.status = 'pending' AND wd.next_attempt_at <= NOW() AND we.deleted_at IS NULL
+			ORDER BY wd.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF wd SKIP LOCKED
+		), wd AS (
+			UPDATE "webhook_delivery" claimed
+			SET next_attempt_at = NOW() + make_interval(secs => $2), updated_at = NOW()
+			FROM due
+			WHERE claimed.id = due.id
+			RETURNING claimed.*
+		)
+		SELECT `+webhook_delivery_columns+`
+		FROM wd
+		JOIN "outbox_event" oe ON oe.id = wd.event_id
+		ORDER BY wd.created_at, wd.id
+		`,
+		limit,
+		lease.Seconds(),
+	)
+
+	return deliveries, err
+}
+
+func (wr *WebhookRepository) RecordDeliveryAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, next_attempt_at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	var delivery_id uuid.UUID
+	return wr.Pg.GetContext(
+		ctx,
+		&delivery_id,
+		`
+		WITH attempt AS (
+			INSERT INTO "webhook_delivery_attempt" (delivery_id, status_code, error, duration_ms)
+			VALUES ($1, $2, $3, $4)
+			RETURNING delivery_id
+		)
+		UPDATE "webhook_delivery"
+		SET status = $5, attempts = attempts + 1, next_attempt_at = $6, updated_at = NOW()
+		WHERE id = (SELECT delivery_id FROM attempt)
+		RETURNING id
+		`,
+		attempt.DeliveryId,
+		attempt.StatusCode,
+		attempt.Error,
+		attempt.DurationMs,
+		status,
+		next_attempt_at,
+	)
+}
+
+func (wr *WebhookRepository) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	delivery := new(model.WebhookDelivery)
+	err := wr.Pg.GetContext(
+		ctx,
+		delivery,
+		`SELECT `+webhook_delivery_columns+`
+		FROM "webhook_delivery" wd
+		JOIN "outbox_event" oe ON oe.id = wd.event_id
+		WHERE wd.id = $1`,
+		id,
+	)
+
+	return delivery, err
+}
+
+func (wr *WebhookRepository) GetEndpointDeliveries(ctx context.Context, endpoint_id uuid.UUID, limit int, offset int) (*[]model.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	deliveries := new([]model.WebhookDelivery)
+	err := wr.Pg.SelectContext(
+		ctx,
+		deliveries,
+		`SELECT `+webhook_delivery_columns+`
+		FROM "webhook_delivery" wd
+		JOIN "outbox_event" oe ON oe.id = wd.event_id
+		WHERE wd.endpoint_id = $1
+		ORDER BY wd.created_at DESC, wd.id DESC
+		LIMIT $2
+		OFFSET $3`,
+		endpoint_id,
+		limit,
+		offset,
+	)
+
+	return deliveries, err
+}
+
+func (wr *WebhookRepository) GetDeliveryAttempts(ctx context.Context, delivery_id uuid.UUID) (*[]model.WebhookDeliveryAttempt, error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	attempts := new([]model.WebhookDeliveryAttempt)
+	err := wr.Pg.SelectContext(
+		ctx,
+		attempts,
+		`SELECT wda.id, wda.delivery_id, wda.attempted_at, wda.status_code, wda.error, wda.duration_ms
+		FROM "webhook_delivery_attempt" wda WHERE wda.delivery_id = $1
+		ORDER BY wda.attempted_at, wda.id`,
+		delivery_id,
+	)
+
+	return attempts, err
+}
+
+func (wr *WebhookRepository) RedeliverWebhook(ctx context.Context, delivery_id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, wr.Timeouts.Query)
+	defer cancel()
+
+	var redelivered_id uuid.UUID
+	return wr.Pg.GetContext(
+		ctx,
+		&redelivered_id,
+		`UPDATE "webhook_delivery" SET status = 'pending', next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING id`,
+		delivery_id,
+	)
+}
@@ -1,12 +1,13 @@
 package server
 
 import (
+	"broke-bank/model"
 	"broke-bank/utils"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
 )
 
 type CreateAccountRequest struct {
@@ -28,10 +29,8 @@ func (s *Server) CreateAccount() gin.HandlerFunc {
 			return
 		}
 
-		err = s.Repositories.AccountRepository.CreateAccount(user.Id.String(), req.Name, "active")
-		if err != nil {
-			log.Println("[ERROR] [CreateAccount] failed to create account: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to create account"})
+		if err = s.createAccount(ctx.Request.Context(), "CreateAccount", user, req.Name); err != nil {
+			restError(ctx, err)
 			return
 		}
 
@@ -43,8 +42,32 @@ type GetAccountResponse struct {
 	Id      uuid.UUID `json:"id"`
 	Name    string    `json:"name"`
 	Balance string    `json:"balance"`
-	// 'active' | 'inactive'
+	// 'active' | 'inactive' | 'frozen_debit' | 'frozen_all' | 'closed'
 	Status string `json:"status"`
+	// End of a freeze, null when indefinite or not frozen.
+	FrozenUntil *time.Time `json:"frozen_until"`
+	// Such as BRKB590000000001, accepted like the id by transfers.
+	Number string `json:"number"`
+	// Handle of the account holder paying into it, such as @alice, null when there's none.
+	Handle *string `json:"handle"`
+}
+
+// newAccountResponse shows account with handle, the one pointing to it if any.
+func (s *Server) newAccountResponse(account *model.Account, handle *model.Handle) GetAccountResponse {
+	res := GetAccountResponse{
+		Id:          account.Id,
+		Name:        account.Name,
+		Balance:     account.Balance.StringFixed(2),
+		Status:      account.Status,
+		FrozenUntil: account.FrozenUntil,
+		Number:      s.accountNumber(account),
+	}
+	if handle != nil {
+		shown := newHandleResponse(handle).Handle
+		res.Handle = &shown
+	}
+
+	return res
 }
 
 func (s *Server) GetAccount() gin.HandlerFunc {
@@ -62,24 +85,19 @@ func (s *Server) GetAccount() gin.HandlerFunc {
 			return
 		}
 
-		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		account, _, err := s.memberAccount(ctx.Request.Context(), "GetAccount", user, account_id)
 		if err != nil {
-			log.Printf("[ERROR] [GetAccount] failed to get account: %s, account ID: %s\n", err, account_id)
-			ctx.JSON(500, gin.H{"error": "Failed to get account"})
+			restError(ctx, err)
 			return
 		}
 
-		if account.UserId != user.Id {
-			ctx.JSON(500, gin.H{"error": "This account does not belongs to the user"})
+		handle, err := s.accountHandle(ctx.Request.Context(), "GetAccount", account)
+		if err != nil {
+			restError(ctx, err)
 			return
 		}
 
-		ctx.JSON(200, gin.H{"payload": GetAccountResponse{
-			Id:      account.Id,
-			Name:    account.Name,
-			Balance: account.Balance.StringFixed(2),
-			Status:  account.Status,
-		}})
+		ctx.JSON(200, gin.H{"payload": s.newAccountResponse(account, handle)})
 	}
 }
 
@@ -98,30 +116,90 @@ func (s *Server) DisableAccount() gin.HandlerFunc {
 			return
 		}
 
-		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		if err = s.disableAccount(ctx.Request.Context(), "DisableAccount", user, account_id); err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+type CloseAccountRequest struct {
+	// Receives the remaining balance, another account the user is a member of.
+	ToAccountId string `json:"to_account_id" binding:"required"`
+}
+
+type CloseAccountResponse struct {
+	Account GetAccountResponse `json:"account"`
+	// The transfer of the remaining balance, null when the account was empty.
+	Sweep *GetTransactionResponse `json:"sweep"`
+	// The account can be reopened until then.
+	ReopenUntil time.Time `json:"reopen_until"`
+}
+
+func (s *Server) CloseAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CloseAccountRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Println("[ERROR] [DisableAccount] failed to get account: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to get account"})
+			log.Println("[ERROR] [CloseAccount] failed to get user from context: ", err)
+			ctx.Status(401)
 			return
 		}
 
-		if account.UserId != user.Id {
-			ctx.JSON(500, gin.H{"error": "This account does not belongs to the user"})
+		account, sweep, err := s.closeAccount(ctx.Request.Context(), "CloseAccount", user, ctx.Param("id"), req.ToAccountId)
+		// Sweeps over the approval policy of the account close it once approved.
+		if respondHeld(ctx, err) {
+			return
+		}
+		if err != nil {
+			restError(ctx, err)
 			return
 		}
 
-		if account.Balance.GreaterThan(decimal.NewFromInt(0)) {
-			ctx.JSON(500, gin.H{"error": "Account still has balance and cannot be deleted"})
+		handle, err := s.accountHandle(ctx.Request.Context(), "CloseAccount", account)
+		if err != nil {
+			restError(ctx, err)
 			return
 		}
 
-		err = s.Repositories.AccountRepository.DisableAccount(account_id)
+		resp := CloseAccountResponse{Account: s.newAccountResponse(account, handle), ReopenUntil: account.ClosedAt.Add(s.accountReopenGracePeriod())}
+		if sweep != nil {
+			transaction := newTransactionResponse(sweep)
+			resp.Sweep = &transaction
+		}
+
+		ctx.JSON(200, gin.H{"payload": resp})
+	}
+}
+
+func (s *Server) ReopenAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Println("[ERROR] [DisableAccount] failed to disable account: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to disable account"})
+			log.Println("[ERROR] [ReopenAccount] failed to get user from context: ", err)
+			ctx.Status(401)
 			return
 		}
 
-		ctx.Status(200)
+		account, err := s.reopenAccount(ctx.Request.Context(), "ReopenAccount", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		handle, err := s.accountHandle(ctx.Request.Context(), "ReopenAccount", account)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": s.newAccountResponse(account, handle)})
 	}
 }
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"broke-bank/model"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const default_bank_code = "BRKB"
+
+var (
+	bank_code_pattern      = regexp.MustCompile(`^[A-Z]{4}$`)
+	account_number_pattern = regexp.MustCompile(`^([A-Z]{4})([0-9]{2})([0-9]{10})$`)
+)
+
+var errInvalidAccountNumber = errors.New("Account number is invalid, check it for typos")
+
+func bankCodeFromEnv() string {
+	raw := os.Getenv("BANK_CODE")
+	if raw == "" {
+		return default_bank_code
+	}
+
+	if !bank_code_pattern.MatchString(raw) {
+		log.Fatalf("Invalid BANK_CODE env: %q", raw)
+	}
+
+	return raw
+}
+
+func (s *Server) bankCode() string {
+	if s.BankCode == "" {
+		return default_bank_code
+	}
+
+	return s.BankCode
+}
+
+// mod97 is the remainder by 97 of digits, where letters stand for two digits each as in IBANs: A is 10 and Z 35.
+func mod97(digits string) int {
+	remainder := 0
+	for _, r := range digits {
+		if r >= 'A' && r <= 'Z' {
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		} else {
+			remainder = (remainder*10 + int(r-'0')) % 97
+		}
+	}
+
+	return remainder
+}
+
+/*
+accountNumber formats the number of an account like the national part of an IBAN: the bank
+code, two check digits and the serial on 10 digits, such as BRKB 5900 0000 0001 without the
+spaces. As in IBANs, the check digits make mod97 of serial + bank code + check digits 1, which
+catches every mistyped character and most swapped ones.
+*/
+func accountNumber(bank_code string, serial int64) string {
+	digits := fmt.Sprintf("%010d", serial)
+	return fmt.Sprintf("%s%02d%s", bank_code, 98-mod97(digits+bank_code+"00"), digits)
+}
+
+func (s *Server) accountNumber(account *model.Account) string {
+	return accountNumber(s.bankCode(), account.Number)
+}
+
+/*
+parseAccountNumber returns the bank code and serial of an account number, which may be spaced
+and in any case. It fails with errInvalidAccountNumber when the check digits don't match, and
+isn't ok when number doesn't look like an account number at all.
+*/
+func parseAccountNumber(number string) (bank_code string, serial int64, ok bool, err error) {
+	number = strings.ToUpper(strings.Join(strings.Fields(number), ""))
+
+	parts := account_number_pattern.FindStringSubmatch(number)
+	if parts == nil {
+		return "", 0, false, nil
+	}
+
+	if mod97(parts[3]+parts[1]+parts[2]) != 1 {
+		return "", 0, true, errInvalidAccountNumber
+	}
+
+	serial, err = strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return "", 0, true, errInvalidAccountNumber
+	}
+
+	return parts[1], serial, true, nil
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type AdjustmentResponse struct {
+	Id        uuid.UUID `json:"id"`
+	AccountId uuid.UUID `json:"account_id"`
+	// Positive credits the account, negative debits it.
+	Amount   string `json:"amount"`
+	Reason   string `json:"reason"`
+	Evidence string `json:"evidence"`
+	// 'pending' | 'approved' | 'rejected'
+	Status            string     `json:"status"`
+	RequiredApprovals int        `json:"required_approvals"`
+	ProposedBy        uuid.UUID  `json:"proposed_by"`
+	TransactionId     *uuid.UUID `json:"transaction_id"`
+	// Set when approving the adjustment reverses this transaction instead of posting an adjustment.
+	ReversalOf *uuid.UUID `json:"reversal_of"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func newAdjustmentResponse(adjustment *model.Adjustment) AdjustmentResponse {
+	return AdjustmentResponse{
+		Id:                adjustment.Id,
+		AccountId:         adjustment.AccountId,
+		Amount:            adjustment.Amount.StringFixed(2),
+		Reason:            adjustment.Reason,
+		Evidence:          adjustment.Evidence,
+		Status:            adjustment.Status,
+		RequiredApprovals: adjustment.RequiredApprovals,
+		ProposedBy:        adjustment.ProposedBy,
+		TransactionId:     adjustment.TransactionId,
+		ReversalOf:        adjustment.ReversalOf,
+		CreatedAt:         adjustment.CreatedAt,
+		UpdatedAt:         adjustment.UpdatedAt,
+	}
+}
+
+type AdjustmentDecisionResponse struct {
+	Id      uuid.UUID `json:"id"`
+	StaffId uuid.UUID `json:"staff_id"`
+	// 'approved' | 'rejected'
+	Decision  string    `json:"decision"`
+	Comment   *string   `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GetAdjustmentResponse struct {
+	AdjustmentResponse
+	// Oldest first.
+	Decisions []AdjustmentDecisionResponse `json:"decisions"`
+}
+
+type CreateAdjustmentRequest struct {
+	AccountId string `json:"account_id" binding:"required"`
+	// Positive credits the account, negative debits it.
+	Amount   decimal.Decimal `json:"amount" binding:"required"`
+	Reason   string          `json:"reason" binding:"required"`
+	Evidence string          `json:"evidence" binding:"required"`
+}
+
+// CreateAdjustment proposes to credit or debit an account, which other staff then approve or reject.
+func (s *Server) CreateAdjustment() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CreateAdjustmentRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		staff, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreateAdjustment] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		adjustment, err := s.proposeAdjustment(ctx.Request.Context(), "CreateAdjustment", staff, req.AccountId, req.Amount, req.Reason, req.Evidence)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdjustmentResponse(adjustment)})
+	}
+}
+
+type GetAdjustmentsRequest struct {
+	AccountId string `form:"account_id"`
+	// 'pending' | 'approved' | 'rejected', every status when empty.
+	Status string `form:"status"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// GetAdjustments lists adjustments, newest first.
+func (s *Server) GetAdjustments() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetAdjustmentsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		raw_adjustments, err := s.adjustments(ctx.Request.Context(), "GetAdjustments", req.AccountId, req.Status, req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		adjustments := []AdjustmentResponse{}
+		for i := range raw_adjustments {
+			adjustments = append(adjustments, newAdjustmentResponse(&raw_adjustments[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": adjustments})
+	}
+}
+
+// GetAdjustment returns an adjustment with the history of decisions on it.
+func (s *Server) GetAdjustment() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		adjustment, decisions, err := s.adjustment(ctx.Request.Context(), "GetAdjustment", ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		res := GetAdjustmentResponse{AdjustmentResponse: newAdjustmentResponse(adjustment), Decisions: []AdjustmentDecisionResponse{}}
+		for _, decision := range decisions {
+			res.Decisions = append(res.Decisions, AdjustmentDecisionResponse{decision.Id, decision.StaffId, decision.Decision, decision.Comment, decision.CreatedAt})
+		}
+
+		ctx.JSON(200, gin.H{"payload": res})
+	}
+}
+
+type DecideAdjustmentRequest struct {
+	Comment *string `json:"comment"`
+}
+
+func (s *Server) decideAdjustmentHandler(caller string, decision string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := DecideAdjustmentRequest{}
+		if ctx.Request.ContentLength != 0 && ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		staff, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get user from context: %s\n", caller, err)
+			ctx.Status(401)
+			return
+		}
+
+		adjustment, err := s.decideAdjustment(ctx.Request.Context(), caller, staff, ctx.Param("id"), decision, req.Comment)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdjustmentResponse(adjustment)})
+	}
+}
+
+// ApproveAdjustment posts the adjustment when it's the last approval it required.
+func (s *Server) ApproveAdjustment() gin.HandlerFunc {
+	return s.decideAdjustmentHandler("ApproveAdjustment", "approved")
+}
+
+func (s *Server) RejectAdjustment() gin.HandlerFunc {
+	return s.decideAdjustmentHandler("RejectAdjustment", "rejected")
+}
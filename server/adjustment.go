@@ -0,0 +1,189 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var default_adjustment_dual_approval_threshold = decimal.NewFromInt(1000)
+
+const max_adjustment_text_length = 2000
+
+var (
+	errAdjustmentNotFound  = errors.New("Adjustment not found")
+	errAdjustmentDecided   = errors.New("Adjustment was already approved or rejected")
+	errAdjustmentSelf      = errors.New("Staff can't decide on their own adjustment")
+	errAdjustmentTwice     = errors.New("Staff already decided on this adjustment")
+	errAdjustmentOverdraft = errors.New("Account balance is too low for this debit")
+	errAdjustmentReversed  = errors.New("Transaction was already reversed")
+)
+
+// AdjustmentDualApprovalThresholdFromEnv is shared with the CLI, whose proposals need the same approvals.
+func AdjustmentDualApprovalThresholdFromEnv() decimal.Decimal {
+	raw := os.Getenv("ADJUSTMENT_DUAL_APPROVAL_THRESHOLD")
+	if raw == "" {
+		return default_adjustment_dual_approval_threshold
+	}
+
+	threshold, err := decimal.NewFromString(raw)
+	if err != nil || !threshold.IsPositive() {
+		log.Fatalf("Invalid ADJUSTMENT_DUAL_APPROVAL_THRESHOLD env: %q", raw)
+	}
+
+	return threshold
+}
+
+// AdjustmentRequiredApprovals is 2 for adjustments of at least threshold either way, 1 otherwise.
+func AdjustmentRequiredApprovals(amount decimal.Decimal, threshold decimal.Decimal) int {
+	if !threshold.IsPositive() {
+		threshold = default_adjustment_dual_approval_threshold
+	}
+
+	if amount.Abs().GreaterThanOrEqual(threshold) {
+		return 2
+	}
+
+	return 1
+}
+
+func (s *Server) requiredApprovals(amount decimal.Decimal) int {
+	return AdjustmentRequiredApprovals(amount, s.AdjustmentDualApprovalThreshold)
+}
+
+func (s *Server) proposeAdjustment(ctx context.Context, caller string, staff *model.User, account_id string, amount decimal.Decimal, reason string, evidence string) (*model.Adjustment, error) {
+	reason, evidence = strings.TrimSpace(reason), strings.TrimSpace(evidence)
+	if amount.IsZero() || !amount.Equal(amount.Round(2)) || reason == "" || evidence == "" || len(reason) > max_adjustment_text_length || len(evidence) > max_adjustment_text_length {
+		return nil, errInvalidInput
+	}
+
+	account, err := s.adminAccount(ctx, caller, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	adjustment, err := s.Repositories.AdjustmentRepository.CreateAdjustment(ctx, model.Adjustment{
+		AccountId:         account.Id,
+		Amount:            amount,
+		Reason:            reason,
+		Evidence:          evidence,
+		RequiredApprovals: s.requiredApprovals(amount),
+		ProposedBy:        staff.Id,
+	})
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to create adjustment: %s, account ID: %s\n", caller, err, account.Id)
+		return nil, &failure{"Failed to create adjustment", err}
+	}
+
+	return adjustment, nil
+}
+
+func (s *Server) adjustment(ctx context.Context, caller string, adjustment_id string) (*model.Adjustment, []model.AdjustmentDecision, error) {
+	id, err := uuid.Parse(adjustment_id)
+	if err != nil {
+		return nil, nil, errAdjustmentNotFound
+	}
+
+	adjustment, err := s.Repositories.AdjustmentRepository.GetAdjustment(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errAdjustmentNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get adjustment: %s, adjustment ID: %s\n", caller, err, adjustment_id)
+		return nil, nil, &failure{"Failed to get adjustment", err}
+	}
+
+	decisions, err := s.Repositories.AdjustmentRepository.GetAdjustmentDecisions(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get adjustment decisions: %s, adjustment ID: %s\n", caller, err, adjustment_id)
+		return nil, nil, &failure{"Failed to get adjustment", err}
+	}
+
+	return adjustment, *decisions, nil
+}
+
+func (s *Server) adjustments(ctx context.Context, caller string, account_id string, status string, limit int, offset int) ([]model.Adjustment, error) {
+	if limit < 0 || offset < 0 || limit > 100 || (status != "" && status != "pending" && status != "approved" && status != "rejected") {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	filter := repository.AdjustmentFilter{Status: status}
+	if account_id != "" {
+		id, err := uuid.Parse(account_id)
+		if err != nil {
+			return nil, errInvalidInput
+		}
+		filter.AccountId = &id
+	}
+
+	adjustments, err := s.Repositories.AdjustmentRepository.GetAdjustments(ctx, filter, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get adjustments: %s\n", caller, err)
+		return nil, &failure{"Failed to get adjustments", err}
+	}
+
+	return *adjustments, nil
+}
+
+/*
+decideAdjustment approves or rejects an adjustment on behalf of staff. The approval that brings
+it to its required approvals posts it, and the owner of the account is notified like for any
+other movement.
+*/
+func (s *Server) decideAdjustment(ctx context.Context, caller string, staff *model.User, adjustment_id string, decision string, comment *string) (*model.Adjustment, error) {
+	if comment != nil && len(*comment) > max_adjustment_text_length {
+		return nil, errInvalidInput
+	}
+
+	id, err := uuid.Parse(adjustment_id)
+	if err != nil {
+		return nil, errAdjustmentNotFound
+	}
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		log.Printf("[ERROR] [%s] an unexpected error occurred while creating transaction ID: %s\n", caller, err)
+		return nil, &failure{"Failed to decide on adjustment", err}
+	}
+
+	adjustment, err := s.Repositories.AdjustmentRepository.DecideAdjustment(ctx, model.AdjustmentDecision{AdjustmentId: id, StaffId: staff.Id, Decision: decision, Comment: comment}, transaction_id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, errAdjustmentNotFound
+	case errors.Is(err, repository.ErrAdjustmentDecided):
+		return nil, errAdjustmentDecided
+	case errors.Is(err, repository.ErrSelfApproval):
+		return nil, errAdjustmentSelf
+	case errors.Is(err, repository.ErrAlreadyDecided):
+		return nil, errAdjustmentTwice
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		return nil, errAdjustmentOverdraft
+	case errors.Is(err, repository.ErrAlreadyReversed), errors.Is(err, repository.ErrReversalOfReversal):
+		return nil, errAdjustmentReversed
+	case errors.Is(err, repository.ErrAccountFrozen), errors.Is(err, repository.ErrAccountClosed):
+		return nil, err
+	case errors.Is(err, repository.ErrLockTimeout), errors.Is(err, repository.ErrQueryTimeout):
+		log.Printf("[ERROR] [%s] timed out: %s\n", caller, err)
+		return nil, errAccountBusy
+	case err != nil:
+		log.Printf("[ERROR] [%s] failed to decide on adjustment: %s, adjustment ID: %s\n", caller, err, adjustment_id)
+		return nil, &failure{"Failed to decide on adjustment", err}
+	}
+
+	if adjustment.TransactionId != nil {
+		s.publishMovementEvents(ctx, caller, *adjustment.TransactionId)
+	}
+
+	return adjustment, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"broke-bank/model"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAdjustments(t *testing.T) {
+	s, router := newTestServer(t)
+	s.AdjustmentDualApprovalThreshold = decimal.RequireFromString("100.00")
+	reason := map[string]string{AdminReasonHeader: "Ticket #7"}
+
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	checking := alice.createAccount("Checking")
+
+	staff := map[string]*testClient{}
+	for _, role := range []string{model.RoleSupport, model.RoleCompliance, model.RoleAdmin} {
+		staff[role] = signUp(t, router, role+"@broke.bank")
+		staff[role].prefix = "/v2"
+		grantRole(t, s, role+"@broke.bank", role)
+	}
+	maker, checker, admin := staff[model.RoleSupport], staff[model.RoleCompliance], staff[model.RoleAdmin]
+
+	propose := func(amount string) AdjustmentResponse {
+		t.Helper()
+		w := maker.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": amount, "reason": "Fee refunded", "evidence": "Statement 2026-10"}, reason)
+		if w.Code != 200 {
+			t.Fatalf("POST /admin/adjustments = %d: %s", w.Code, w.Body)
+		}
+		return decodePayload[AdjustmentResponse](t, w)
+	}
+	balance := func() string {
+		t.Helper()
+		return decodePayload[GetAccountResponse](t, alice.do("GET", "/account/"+checking, nil)).Balance
+	}
+
+	t.Run("makers can't approve and checkers can't propose", func(t *testing.T) {
+		adjustment := propose("5.00")
+		if w := maker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason); w.Code != 403 {
+			t.Errorf("support approving = %d, want 403", w.Code)
+		}
+		if w := checker.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "5.00", "reason": "r", "evidence": "e"}, reason); w.Code != 403 {
+			t.Errorf("compliance proposing = %d, want 403", w.Code)
+		}
+		checker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/reject", nil, reason)
+	})
+
+	t.Run("small adjustments need one approval", func(t *testing.T) {
+		adjustment := propose("40.00")
+		if adjustment.RequiredApprovals != 1 || adjustment.Status != "pending" {
+			t.Fatalf("adjustment = %+v, want 1 required approval", adjustment)
+		}
+
+		approved := decodePayload[AdjustmentResponse](t, checker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason))
+		if approved.Status != "approved" || approved.TransactionId == nil {
+			t.Fatalf("approved = %+v, want it posted", approved)
+		}
+		if got := balance(); got != "40.00" {
+			t.Errorf("balance = %s, want 40.00", got)
+		}
+
+		// The owner sees the adjustment like any other transaction.
+		transaction := decodePayload[GetTransactionResponse](t, alice.do("GET", "/transaction/"+approved.TransactionId.String(), nil))
+		if transaction.Type != "adjustment" || transaction.Amount != "40.00" {
+			t.Errorf("GET /transaction/:id = %+v, want a 40.00 adjustment", transaction)
+		}
+	})
+
+	t.Run("large adjustments need two approvers", func(t *testing.T) {
+		adjustment := propose("-100.00")
+		if w := maker.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "1.001", "reason": "r", "evidence": "e"}, reason); w.Code != 422 {
+			t.Errorf("proposing 1.001 = %d, want 422", w.Code)
+		}
+		if adjustment.RequiredApprovals != 2 {
+			t.Fatalf("adjustment = %+v, want 2 required approvals", adjustment)
+		}
+
+		first := decodePayload[AdjustmentResponse](t, checker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", map[string]string{"comment": "Matches the statement"}, reason))
+		if first.Status != "pending" {
+			t.Fatalf("after one approval = %+v, want pending", first)
+		}
+		if w := checker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason); w.Code != 409 {
+			t.Errorf("approving twice = %d, want 409", w.Code)
+		}
+
+		// Balance is 40.00, too low for the debit: the second approval fails and isn't recorded.
+		if w := admin.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason); w.Code != 409 {
+			t.Fatalf("approving an overdraft = %d, want 409", w.Code)
+		}
+
+		funding := propose("60.00")
+		checker.doWithHeaders("POST", "/admin/adjustments/"+funding.Id.String()+"/approve", nil, reason)
+
+		second := decodePayload[AdjustmentResponse](t, admin.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason))
+		if second.Status != "approved" || second.TransactionId == nil {
+			t.Fatalf("after two approvals = %+v, want it posted", second)
+		}
+		if got := balance(); got != "0.00" {
+			t.Errorf("balance = %s, want 0.00", got)
+		}
+
+		history := decodePayload[GetAdjustmentResponse](t, maker.doWithHeaders("GET", "/admin/adjustments/"+adjustment.Id.String(), nil, reason))
+		if len(history.Decisions) != 2 || history.Decisions[0].Comment == nil || *history.Decisions[0].Comment != "Matches the statement" || history.Decisions[1].Decision != "approved" {
+			t.Errorf("decisions = %+v, want both approvals in order", history.Decisions)
+		}
+	})
+
+	t.Run("rejected adjustments are never posted", func(t *testing.T) {
+		adjustment := propose("10.00")
+		rejected := decodePayload[AdjustmentResponse](t, checker.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/reject", map[string]string{"comment": "No evidence"}, reason))
+		if rejected.Status != "rejected" || rejected.TransactionId != nil {
+			t.Fatalf("rejected = %+v", rejected)
+		}
+		if w := admin.doWithHeaders("POST", "/admin/adjustments/"+adjustment.Id.String()+"/approve", nil, reason); w.Code != 409 {
+			t.Errorf("approving a rejected adjustment = %d, want 409", w.Code)
+		}
+		if got := balance(); got != "0.00" {
+			t.Errorf("balance = %s, want 0.00", got)
+		}
+
+		pending := decodePayload[[]AdjustmentResponse](t, maker.doWithHeaders("GET", "/admin/adjustments?status=rejected&account_id="+checking, nil, reason))
+		if len(pending) != 2 || pending[0].Id != adjustment.Id {
+			t.Errorf("rejected adjustments = %+v, want 2, newest first", pending)
+		}
+	})
+}
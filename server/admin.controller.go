@@ -0,0 +1,244 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AdminUserResponse struct {
+	Id    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	// 'customer' | 'support' | 'compliance' | 'admin'
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAdminUserResponse(user *model.User) AdminUserResponse {
+	return AdminUserResponse{user.Id, user.Email, user.Role, user.DisabledAt, user.CreatedAt}
+}
+
+type AdminAccountResponse struct {
+	Id      uuid.UUID `json:"id"`
+	UserId  uuid.UUID `json:"user_id"`
+	Name    string    `json:"name"`
+	Balance string    `json:"balance"`
+	// 'active' | 'inactive' | 'frozen_debit' | 'frozen_all' | 'closed'
+	Status       string     `json:"status"`
+	StatusReason *string    `json:"status_reason"`
+	FrozenUntil  *time.Time `json:"frozen_until"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func newAdminAccountResponse(account *model.Account) AdminAccountResponse {
+	return AdminAccountResponse{
+		Id:           account.Id,
+		UserId:       account.UserId,
+		Name:         account.Name,
+		Balance:      account.Balance.StringFixed(2),
+		Status:       account.Status,
+		StatusReason: account.StatusReason,
+		FrozenUntil:  account.FrozenUntil,
+		CreatedAt:    account.CreatedAt,
+		UpdatedAt:    account.UpdatedAt,
+	}
+}
+
+type AdminSearchUsersRequest struct {
+	// Part of an email, or a whole user id.
+	Query  string `form:"q"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// AdminSearchUsers finds users by email or id, ordered by email.
+func (s *Server) AdminSearchUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := AdminSearchUsersRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+		if req.Query == "" {
+			ctx.JSON(400, gin.H{"error": "Missing q query param"})
+			return
+		}
+
+		raw_users, err := s.searchUsers(ctx.Request.Context(), "AdminSearchUsers", req.Query, req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		users := []AdminUserResponse{}
+		for i := range raw_users {
+			users = append(users, newAdminUserResponse(&raw_users[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": users})
+	}
+}
+
+func (s *Server) AdminGetUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := s.viewUser(ctx.Request.Context(), "AdminGetUser", ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdminUserResponse(user)})
+	}
+}
+
+func (s *Server) AdminGetUserAccounts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetAccountTransactionsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		raw_accounts, err := s.viewUserAccounts(ctx.Request.Context(), "AdminGetUserAccounts", ctx.Param("id"), req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		accounts := []AdminAccountResponse{}
+		for i := range raw_accounts {
+			accounts = append(accounts, newAdminAccountResponse(&raw_accounts[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": accounts})
+	}
+}
+
+type AdminLogoutUserResponse struct {
+	RevokedSessions int `json:"revoked_sessions"`
+}
+
+// AdminLogoutUser ends every session of a user, who has to log in again.
+func (s *Server) AdminLogoutUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		revoked, err := s.logoutUser(ctx.Request.Context(), "AdminLogoutUser", ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": AdminLogoutUserResponse{revoked}})
+	}
+}
+
+type AdminSetUserRoleRequest struct {
+	// 'customer' | 'support' | 'compliance' | 'admin'
+	Role string `json:"role" binding:"required"`
+}
+
+func (s *Server) AdminSetUserRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := AdminSetUserRoleRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		staff, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [AdminSetUserRole] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		user, err := s.setUserRole(ctx.Request.Context(), "AdminSetUserRole", staff, ctx.Param("id"), req.Role)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdminUserResponse(user)})
+	}
+}
+
+func (s *Server) AdminGetAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account, err := s.viewAccount(ctx.Request.Context(), "AdminGetAccount", ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdminAccountResponse(account)})
+	}
+}
+
+// AdminGetAccountTransactions lists the transactions of any account, newest first.
+func (s *Server) AdminGetAccountTransactions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetAccountTransactionsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		raw_transactions, err := s.viewAccountTransactions(ctx.Request.Context(), "AdminGetAccountTransactions", ctx.Param("id"), req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		transactions := []GetTransactionResponse{}
+		for i := range raw_transactions {
+			transactions = append(transactions, newTransactionResponse(&raw_transactions[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": transactions})
+	}
+}
+
+type AdminFreezeAccountRequest struct {
+	// 'frozen_debit' only blocks money leaving the account, 'frozen_all' blocks every movement.
+	Status string `json:"status" binding:"required"`
+	// 'fraud_suspected' | 'sanctions_screening' | 'court_order' | 'kyc_review' | 'customer_request' | 'deceased' | 'other'
+	StatusReason string `json:"status_reason" binding:"required"`
+	// End of the freeze, indefinite when null.
+	FrozenUntil *time.Time `json:"frozen_until"`
+}
+
+// AdminFreezeAccount freezes an active account, and tells its owner.
+func (s *Server) AdminFreezeAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := AdminFreezeAccountRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		account, err := s.freezeAccount(ctx.Request.Context(), "AdminFreezeAccount", ctx.Param("id"), req.Status, req.StatusReason, req.FrozenUntil)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdminAccountResponse(account)})
+	}
+}
+
+func (s *Server) AdminUnfreezeAccount() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account, err := s.unfreezeAccount(ctx.Request.Context(), "AdminUnfreezeAccount", ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newAdminAccountResponse(account)})
+	}
+}
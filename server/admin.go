@@ -0,0 +1,289 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminReasonHeader carries why a staff member makes an admin request, recorded in its audit events.
+const AdminReasonHeader = "X-Admin-Reason"
+
+const max_admin_reason_length = 500
+
+// permission is what an admin route requires of the role of its caller.
+type permission string
+
+const (
+	permissionReadUsers      permission = "users:read"
+	permissionReadAccounts   permission = "accounts:read"
+	permissionFreezeAccounts permission = "accounts:freeze"
+	permissionRevokeSessions permission = "sessions:revoke"
+	permissionWriteRoles     permission = "roles:write"
+	// Proposing and approving adjustments are kept apart, so that no role but admin can do both.
+	permissionProposeAdjustments permission = "adjustments:propose"
+	permissionApproveAdjustments permission = "adjustments:approve"
+)
+
+// Customers have no permission, so they can't use any admin route.
+var role_permissions = map[string][]permission{
+	model.RoleSupport:    {permissionReadUsers, permissionReadAccounts, permissionRevokeSessions, permissionProposeAdjustments},
+	model.RoleCompliance: {permissionReadUsers, permissionReadAccounts, permissionFreezeAccounts, permissionApproveAdjustments},
+	model.RoleAdmin: {
+		permissionReadUsers, permissionReadAccounts, permissionFreezeAccounts, permissionRevokeSessions, permissionWriteRoles,
+		permissionProposeAdjustments, permissionApproveAdjustments,
+	},
+}
+
+func hasPermission(role string, required permission) bool {
+	return slices.Contains(role_permissions[role], required)
+}
+
+// CanProposeAdjustments reports whether staff with role may propose adjustments, for the CLI which files them too.
+func CanProposeAdjustments(role string) bool {
+	return hasPermission(role, permissionProposeAdjustments)
+}
+
+var (
+	errUserNotFound     = errors.New("User not found")
+	errAccountNotActive = errors.New("Account is not active")
+	errAccountNotFrozen = errors.New("Account is not frozen")
+	errInvalidRole      = errors.New("Invalid role")
+	errChangingOwnRole  = errors.New("Staff can't change their own role")
+)
+
+/*
+AdminMiddleware lets the request through when the role of its user, authenticated by
+AuthMiddleware, has the required permission. Every admin request must give a reason in the
+X-Admin-Reason header, which is recorded with the audit events of what it does.
+*/
+func (s *Server) AdminMiddleware(required permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [AdminMiddleware] failed to get user from context: ", err)
+			ctx.AbortWithStatus(401)
+			return
+		}
+
+		if !hasPermission(user.Role, required) {
+			log.Printf("[ERROR] [AdminMiddleware] user(%s) with role %s lacks permission %s for %s\n", user.Id, user.Role, required, ctx.FullPath())
+			ctx.AbortWithStatusJSON(403, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		reason := strings.TrimSpace(ctx.GetHeader(AdminReasonHeader))
+		if reason == "" || len(reason) > max_admin_reason_length {
+			ctx.AbortWithStatusJSON(400, gin.H{"error": "Missing or too long " + AdminReasonHeader + " header"})
+			return
+		}
+
+		audit_actor := repository.AuditActorFrom(ctx.Request.Context())
+		audit_actor.Reason = reason
+		ctx.Request = ctx.Request.WithContext(repository.WithAuditActor(ctx.Request.Context(), audit_actor))
+
+		ctx.Next()
+	}
+}
+
+/*
+auditAccess records that staff looked at a customer's data. Reads change nothing, so they are
+refused when they can't be audited rather than left untraced.
+*/
+func (s *Server) auditAccess(ctx context.Context, caller string, action string, target_type string, target_id string, user_id *uuid.UUID) error {
+	event := model.AuditEvent{Action: action, TargetType: target_type, TargetId: target_id, UserId: user_id}
+	if err := s.audit(ctx, caller, event, nil); err != nil {
+		return &failure{"Failed to audit the request", err}
+	}
+
+	return nil
+}
+
+func (s *Server) adminUser(ctx context.Context, caller string, user_id string) (*model.User, error) {
+	id, err := uuid.Parse(user_id)
+	if err != nil {
+		return nil, errUserNotFound
+	}
+
+	user, err := s.Repositories.UserRepository.GetUserById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user: %s, user ID: %s\n", caller, err, user_id)
+		return nil, &failure{"Failed to get user", err}
+	}
+
+	return user, nil
+}
+
+func (s *Server) adminAccount(ctx context.Context, caller string, account_id string) (*model.Account, error) {
+	if _, err := uuid.Parse(account_id); err != nil {
+		return nil, errAccountNotFound
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(ctx, account_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAccountNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get account", err}
+	}
+
+	return account, nil
+}
+
+func (s *Server) searchUsers(ctx context.Context, caller string, query string, limit int, offset int) ([]model.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" || limit < 0 || offset < 0 || limit > 100 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	if err := s.auditAccess(ctx, caller, "admin.search_users", "user", query, nil); err != nil {
+		return nil, err
+	}
+
+	users, err := s.Repositories.UserRepository.SearchUsers(ctx, query, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to search users: %s\n", caller, err)
+		return nil, &failure{"Failed to search users", err}
+	}
+
+	return *users, nil
+}
+
+func (s *Server) viewUser(ctx context.Context, caller string, user_id string) (*model.User, error) {
+	user, err := s.adminUser(ctx, caller, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.auditAccess(ctx, caller, "admin.view_user", "user", user.Id.String(), &user.Id); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *Server) viewUserAccounts(ctx context.Context, caller string, user_id string, limit int, offset int) ([]model.Account, error) {
+	if limit < 0 || offset < 0 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	user, err := s.adminUser(ctx, caller, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.auditAccess(ctx, caller, "admin.view_accounts", "user", user.Id.String(), &user.Id); err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.Repositories.AccountRepository.GetMyAccounts(ctx, user.Id.String(), limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get accounts: %s, user ID: %s\n", caller, err, user.Id)
+		return nil, &failure{"Failed to get accounts", err}
+	}
+
+	return *accounts, nil
+}
+
+func (s *Server) viewAccount(ctx context.Context, caller string, account_id string) (*model.Account, error) {
+	account, err := s.adminAccount(ctx, caller, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.auditAccess(ctx, caller, "admin.view_account", "account", account.Id.String(), &account.UserId); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *Server) viewAccountTransactions(ctx context.Context, caller string, account_id string, limit int, offset int) ([]model.Transaction, error) {
+	if limit < 0 || offset < 0 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	account, err := s.adminAccount(ctx, caller, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.auditAccess(ctx, caller, "admin.view_transactions", "account", account.Id.String(), &account.UserId); err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.Repositories.TransactionRepository.GetAccountTransactions(ctx, account.Id.String(), limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get transactions: %s, account ID: %s\n", caller, err, account.Id)
+		return nil, &failure{"Failed to get transactions", err}
+	}
+
+	return *transactions, nil
+}
+
+// logoutUser revokes every session of a user; their API keys are left alone.
+func (s *Server) logoutUser(ctx context.Context, caller string, user_id string) (int, error) {
+	user, err := s.adminUser(ctx, caller, user_id)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.Repositories.SessionRepository.RevokeUserSessions(ctx, user.Id.String())
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to revoke sessions: %s, user ID: %s\n", caller, err, user.Id)
+		return 0, &failure{"Failed to revoke sessions", err}
+	}
+
+	event := model.AuditEvent{Action: "session.revoke_all", TargetType: "user", TargetId: user.Id.String(), UserId: &user.Id}
+	if err = s.audit(ctx, caller, event, map[string]any{"revoked_sessions": revoked}); err != nil {
+		return 0, &failure{"Sessions revoked but writing the audit event failed", err}
+	}
+
+	return revoked, nil
+}
+
+func (s *Server) setUserRole(ctx context.Context, caller string, staff *model.User, user_id string, role string) (*model.User, error) {
+	if !slices.Contains(model.Roles, role) {
+		return nil, errInvalidRole
+	}
+
+	user, err := s.adminUser(ctx, caller, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	// So that the last admin can't lock everyone out by mistake.
+	if user.Id == staff.Id {
+		return nil, errChangingOwnRole
+	}
+
+	if err = s.Repositories.UserRepository.SetUserRole(ctx, user.Id, role); err != nil {
+		log.Printf("[ERROR] [%s] failed to set user role: %s, user ID: %s\n", caller, err, user.Id)
+		return nil, &failure{"Failed to update user", err}
+	}
+
+	user.Role = role
+	return user, nil
+}
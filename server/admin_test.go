@@ -0,0 +1,197 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func getUserId(t *testing.T, s *Server, email string) uuid.UUID {
+	t.Helper()
+
+	user, err := s.Repositories.UserRepository.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user.Id
+}
+
+func grantRole(t *testing.T, s *Server, email string, role string) {
+	t.Helper()
+
+	if err := s.Repositories.UserRepository.SetUserRole(context.Background(), getUserId(t, s, email), role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	s, router := newTestServer(t)
+	reason := map[string]string{AdminReasonHeader: "Ticket #42"}
+
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	checking := alice.createAccount("Checking")
+	alice_id := getUserId(t, s, "alice@broke.bank")
+
+	support := signUp(t, router, "support@broke.bank")
+	support.prefix = "/v2"
+	grantRole(t, s, "support@broke.bank", model.RoleSupport)
+	compliance := signUp(t, router, "compliance@broke.bank")
+	compliance.prefix = "/v2"
+	grantRole(t, s, "compliance@broke.bank", model.RoleCompliance)
+	admin := signUp(t, router, "admin@broke.bank")
+	admin.prefix = "/v2"
+	grantRole(t, s, "admin@broke.bank", model.RoleAdmin)
+
+	t.Run("permissions are checked per endpoint", func(t *testing.T) {
+		cases := []struct {
+			client *testClient
+			method string
+			path   string
+			want   int
+		}{
+			{alice, "GET", "/admin/users?q=alice", 403},
+			{alice, "GET", "/admin/accounts/" + checking, 403},
+			{support, "GET", "/admin/users?q=alice", 200},
+			{support, "GET", "/admin/accounts/" + checking, 200},
+			{support, "POST", "/admin/accounts/" + checking + "/freeze", 403},
+			{compliance, "POST", "/admin/users/" + alice_id.String() + "/logout", 403},
+			{compliance, "PUT", "/admin/users/" + alice_id.String() + "/role", 403},
+		}
+		for _, c := range cases {
+			if w := c.client.doWithHeaders(c.method, c.path, map[string]string{"role": model.RoleAdmin}, reason); w.Code != c.want {
+				t.Errorf("%s %s = %d, want %d: %s", c.method, c.path, w.Code, c.want, w.Body)
+			}
+		}
+	})
+
+	t.Run("a reason is mandatory", func(t *testing.T) {
+		if w := support.do("GET", "/admin/users?q=alice", nil); w.Code != 400 {
+			t.Errorf("GET /admin/users without a reason = %d, want 400", w.Code)
+		}
+		if w := support.doWithHeaders("GET", "/admin/users?q=alice", nil, map[string]string{AdminReasonHeader: "  "}); w.Code != 400 {
+			t.Errorf("GET /admin/users with a blank reason = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("staff see any user and account", func(t *testing.T) {
+		users := decodePayload[[]AdminUserResponse](t, support.doWithHeaders("GET", "/admin/users?q=ALICE", nil, reason))
+		if len(users) != 1 || users[0].Id != alice_id || users[0].Role != model.RoleCustomer {
+			t.Fatalf("GET /admin/users?q=ALICE = %+v, want alice", users)
+		}
+
+		accounts := decodePayload[[]AdminAccountResponse](t, support.doWithHeaders("GET", "/admin/users/"+alice_id.String()+"/accounts", nil, reason))
+		if len(accounts) != 1 || accounts[0].Id.String() != checking || accounts[0].UserId != alice_id {
+			t.Fatalf("GET /admin/users/:id/accounts = %+v, want the checking account", accounts)
+		}
+
+		alice.do("POST", "/transaction/deposit", map[string]string{"amount": "10.00", "to_account_id": checking})
+		transactions := decodePayload[[]GetTransactionResponse](t, support.doWithHeaders("GET", "/admin/accounts/"+checking+"/transactions", nil, reason))
+		if len(transactions) != 1 || transactions[0].Amount != "10.00" {
+			t.Fatalf("GET /admin/accounts/:id/transactions = %+v, want the deposit", transactions)
+		}
+	})
+
+	t.Run("freezing is audited with its reason", func(t *testing.T) {
+		freeze := map[string]string{"status": model.AccountFrozenAll, "status_reason": "fraud_suspected"}
+		if w := compliance.doWithHeaders("POST", "/admin/accounts/"+checking+"/freeze", map[string]string{"status": model.AccountFrozenAll}, reason); w.Code != 422 {
+			t.Errorf("freezing without a reason code = %d, want 422", w.Code)
+		}
+
+		account := decodePayload[AdminAccountResponse](t, compliance.doWithHeaders("POST", "/admin/accounts/"+checking+"/freeze", freeze, reason))
+		if account.Status != model.AccountFrozenAll || account.StatusReason == nil || *account.StatusReason != "fraud_suspected" {
+			t.Fatalf("POST /admin/accounts/:id/freeze = %+v, want a frozen account", account)
+		}
+		if w := compliance.doWithHeaders("POST", "/admin/accounts/"+checking+"/freeze", freeze, reason); w.Code != 409 {
+			t.Errorf("freezing a frozen account = %d, want 409", w.Code)
+		}
+		if w := alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1.00", "from_account_id": checking}); w.Code != 409 || !strings.Contains(w.Body.String(), "Account is frozen") {
+			t.Errorf("withdrawing from a frozen account = %d: %s, want 409", w.Code, w.Body)
+		}
+		if strings.Contains(alice.do("GET", "/account/"+checking, nil).Body.String(), "fraud_suspected") {
+			t.Error("GET /account/:id shows the reason of the freeze to its owner")
+		}
+
+		events, err := s.Repositories.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Action: "account.set_status", TargetId: checking}, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*events) != 1 || (*events)[0].Reason == nil || *(*events)[0].Reason != "Ticket #42" {
+			t.Fatalf("account.set_status events = %+v, want one with the reason", *events)
+		}
+
+		if w := compliance.doWithHeaders("POST", "/admin/accounts/"+checking+"/unfreeze", nil, reason); w.Code != 200 {
+			t.Errorf("POST /admin/accounts/:id/unfreeze = %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("reads are audited", func(t *testing.T) {
+		events, err := s.Repositories.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Action: "admin.view_account", TargetId: checking}, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*events) != 1 || (*events)[0].UserId == nil || *(*events)[0].UserId != alice_id || *(*events)[0].Reason != "Ticket #42" {
+			t.Fatalf("admin.view_account events = %+v, want one on alice's account", *events)
+		}
+	})
+
+	t.Run("debit freezes take deposits until they expire", func(t *testing.T) {
+		until := time.Now().Add(100 * time.Millisecond)
+		freeze := map[string]any{"status": model.AccountFrozenDebit, "status_reason": "kyc_review", "frozen_until": until}
+		if w := compliance.doWithHeaders("POST", "/admin/accounts/"+checking+"/freeze", freeze, reason); w.Code != 200 {
+			t.Fatalf("POST /admin/accounts/:id/freeze = %d: %s", w.Code, w.Body)
+		}
+
+		if w := alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": checking}); w.Code != 200 {
+			t.Errorf("depositing to a debit frozen account = %d: %s", w.Code, w.Body)
+		}
+		if w := alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1.00", "from_account_id": checking}); w.Code != 409 {
+			t.Errorf("withdrawing from a debit frozen account = %d, want 409", w.Code)
+		}
+
+		time.Sleep(time.Until(until))
+		s.expireAccountFreezes(context.Background())
+
+		account := decodePayload[AdminAccountResponse](t, support.doWithHeaders("GET", "/admin/accounts/"+checking, nil, reason))
+		if account.Status != model.AccountActive || account.StatusReason != nil || account.FrozenUntil != nil {
+			t.Fatalf("GET /admin/accounts/:id = %+v, want an active account once the freeze expired", account)
+		}
+	})
+
+	t.Run("force logout ends the user's sessions", func(t *testing.T) {
+		result := decodePayload[AdminLogoutUserResponse](t, support.doWithHeaders("POST", "/admin/users/"+alice_id.String()+"/logout", nil, reason))
+		if result.RevokedSessions != 1 {
+			t.Errorf("revoked_sessions = %d, want 1", result.RevokedSessions)
+		}
+		if w := alice.do("GET", "/me", nil); w.Code != 401 {
+			t.Errorf("GET /me after a forced logout = %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("admins manage roles, except their own", func(t *testing.T) {
+		admin_id := getUserId(t, s, "admin@broke.bank").String()
+		if w := admin.doWithHeaders("PUT", "/admin/users/"+admin_id+"/role", map[string]string{"role": model.RoleCustomer}, reason); w.Code != 422 {
+			t.Errorf("changing one's own role = %d, want 422", w.Code)
+		}
+
+		user := decodePayload[AdminUserResponse](t, admin.doWithHeaders("PUT", "/admin/users/"+alice_id.String()+"/role", map[string]string{"role": model.RoleCompliance}, reason))
+		if user.Role != model.RoleCompliance {
+			t.Fatalf("PUT /admin/users/:id/role = %+v, want compliance", user)
+		}
+
+		// Roles are read on every request, so demoting staff takes effect at once.
+		if w := support.doWithHeaders("GET", "/admin/users?q=alice", nil, reason); w.Code != 200 {
+			t.Fatalf("GET /admin/users as support = %d", w.Code)
+		}
+		admin.doWithHeaders("PUT", "/admin/users/"+getUserId(t, s, "support@broke.bank").String()+"/role", map[string]string{"role": model.RoleCustomer}, reason)
+		if w := support.doWithHeaders("GET", "/admin/users?q=alice", nil, reason); w.Code != 403 {
+			t.Errorf("GET /admin/users after demotion = %d, want 403", w.Code)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type GetAuditEventsRequest struct {
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+	Action string `form:"action"`
+	// RFC 3339 bounds of created_at, since being inclusive and until exclusive.
+	Since *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type AuditEventResponse struct {
+	Id     uuid.UUID `json:"id"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	// 'user' | 'account' | 'transaction' | 'api_key' | 'session' | 'adjustment'
+	TargetType string          `json:"target_type"`
+	TargetId   string          `json:"target_id"`
+	Reason     *string         `json:"reason"`
+	Details    json.RawMessage `json:"details"`
+	Ip         *string         `json:"ip"`
+	UserAgent  *string         `json:"user_agent"`
+	RequestId  *string         `json:"request_id"`
+	// Snapshots of the target, null when it didn't exist before or after the change.
+	Before    *json.RawMessage `json:"before"`
+	After     *json.RawMessage `json:"after"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+func newAuditEventResponse(event model.AuditEvent) AuditEventResponse {
+	response := AuditEventResponse{
+		Id:         event.Id,
+		Actor:      event.Actor,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetId:   event.TargetId,
+		Reason:     event.Reason,
+		Details:    json.RawMessage(event.Details),
+		Ip:         event.Ip,
+		UserAgent:  event.UserAgent,
+		RequestId:  event.RequestId,
+		CreatedAt:  event.CreatedAt,
+	}
+	if event.Before != nil {
+		before := json.RawMessage(*event.Before)
+		response.Before = &before
+	}
+	if event.After != nil {
+		after := json.RawMessage(*event.After)
+		response.After = &after
+	}
+
+	return response
+}
+
+// GetAuditEvents lists the audit events about the user, their accounts, keys and movements, newest first.
+func (s *Server) GetAuditEvents() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetAuditEventsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil || req.Limit < 0 || req.Limit > 100 || req.Offset < 0 {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if req.Limit == 0 {
+			req.Limit = 10
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetAuditEvents] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		filter := repository.AuditFilter{UserId: &user.Id, Action: req.Action, Since: req.Since, Until: req.Until}
+		raw_events, err := s.Repositories.AuditRepository.SearchAuditEvents(ctx.Request.Context(), filter, req.Limit, req.Offset)
+		if err != nil {
+			log.Printf("[ERROR] [GetAuditEvents] failed to get audit events: %s, user ID: %s\n", err, user.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to get audit events"})
+			return
+		}
+
+		events := []AuditEventResponse{}
+		for _, event := range *raw_events {
+			events = append(events, newAuditEventResponse(event))
+		}
+
+		ctx.JSON(200, gin.H{"payload": events})
+	}
+}
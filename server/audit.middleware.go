@@ -0,0 +1,70 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"log"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// Request ids sent by clients or proxies are kept when they look like one, so that logs can be correlated.
+var request_id_format = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestId returns the request id a client sent, or a new one when it sent none or an invalid one.
+func requestId(sent string) string {
+	if request_id_format.MatchString(sent) {
+		return sent
+	}
+
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+/*
+AuditMiddleware gives each request an id, echoed in the X-Request-Id header, and records in its
+context where it came from, for the audit events of the changes it makes. Requests are made by
+"anonymous" until AuthMiddleware identifies their user.
+*/
+func AuditMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		request_id := requestId(ctx.GetHeader(RequestIdHeader))
+		ctx.Header(RequestIdHeader, request_id)
+
+		ctx.Request = ctx.Request.WithContext(repository.WithAuditActor(ctx.Request.Context(), model.AuditActor{
+			Actor:     "anonymous",
+			Ip:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+			RequestId: request_id,
+		}))
+
+		ctx.Next()
+	}
+}
+
+// setAuditActor records that the changes made by the rest of the request are made by actor.
+func setAuditActor(ctx *gin.Context, actor string) {
+	audit_actor := repository.AuditActorFrom(ctx.Request.Context())
+	audit_actor.Actor = actor
+	ctx.Request = ctx.Request.WithContext(repository.WithAuditActor(ctx.Request.Context(), audit_actor))
+}
+
+/*
+audit records an event that isn't part of a database change, such as a login, with the actor
+of ctx.
+*/
+func (s *Server) audit(ctx context.Context, caller string, event model.AuditEvent, details any) error {
+	event, err := repository.NewAuditEvent(ctx, event, details, nil, nil)
+	if err == nil {
+		err = s.Repositories.AuditRepository.CreateAuditEvent(ctx, event)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to write audit event: %s, action: %s\n", caller, err, event.Action)
+	}
+
+	return err
+}
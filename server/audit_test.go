@@ -0,0 +1,168 @@
+package server
+
+import (
+	"broke-bank/bankpb"
+	"broke-bank/repository"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuditTrail(t *testing.T) {
+	_, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+	alice.prefix, bob.prefix = "/v2", "/v2"
+
+	checking := alice.createAccount("Checking")
+	savings := alice.createAccount("Savings")
+	empty := alice.createAccount("Empty")
+	if w := alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking}); w.Code != 200 {
+		t.Fatalf("POST /transaction/deposit = %d: %s", w.Code, w.Body)
+	}
+
+	w := alice.doWithHeaders("POST", "/transaction/transfer", map[string]string{"amount": "40.00", "from_account_id": checking, "to_account_id": savings}, map[string]string{
+		RequestIdHeader: "req-transfer-1",
+		"User-Agent":    "broke-bank-tests/1.0",
+	})
+	if w.Code != 200 {
+		t.Fatalf("POST /transaction/transfer = %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get(RequestIdHeader); got != "req-transfer-1" {
+		t.Fatalf("X-Request-Id = %q, want the one sent", got)
+	}
+	if w := alice.doWithHeaders("GET", "/me", nil, map[string]string{RequestIdHeader: "not a request id"}); w.Header().Get(RequestIdHeader) == "not a request id" || w.Header().Get(RequestIdHeader) == "" {
+		t.Fatalf("X-Request-Id = %q, want a new id instead of an invalid one", w.Header().Get(RequestIdHeader))
+	}
+
+	if w := alice.do("PATCH", "/account/disable/"+empty, nil); w.Code != 200 {
+		t.Fatalf("PATCH /account/disable = %d: %s", w.Code, w.Body)
+	}
+
+	events := decodePayload[[]AuditEventResponse](t, alice.do("GET", "/audit-events?limit=100", nil))
+	actions := []string{}
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	want := []string{
+		"account.disable", "transaction.transfer", "transaction.deposit",
+		"account.add_member", "account.create", "account.add_member", "account.create", "account.add_member", "account.create",
+		"user.login", "user.register",
+	}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("GET /v2/audit-events actions = %v, want %v", actions, want)
+	}
+
+	disable := events[0]
+	if disable.TargetId != empty || disable.Before == nil || disable.After == nil ||
+		!strings.Contains(string(*disable.Before), `"status":"active"`) || !strings.Contains(string(*disable.After), `"status":"inactive"`) {
+		t.Fatalf("account.disable audited as %+v", disable)
+	}
+
+	transfer := events[1]
+	if transfer.Actor == "anonymous" || !strings.HasPrefix(transfer.Actor, "user:") || transfer.RequestId == nil || *transfer.RequestId != "req-transfer-1" ||
+		transfer.Ip == nil || *transfer.Ip != "192.0.2.1" || transfer.UserAgent == nil || *transfer.UserAgent != "broke-bank-tests/1.0" {
+		t.Fatalf("transfer audited as %+v", transfer)
+	}
+	if transfer.Before == nil || transfer.After == nil || string(*transfer.Before) == string(*transfer.After) {
+		t.Fatalf("transfer audited without its balances: %+v", transfer)
+	}
+
+	// Registering and logging in happen before the user is known, through the same request context.
+	if register := events[len(events)-1]; register.Actor != "anonymous" || register.Before != nil || register.After == nil {
+		t.Fatalf("user.register audited as %+v", register)
+	}
+	if login := events[len(events)-2]; login.Actor != transfer.Actor {
+		t.Fatalf("user.login audited by %s, want %s", login.Actor, transfer.Actor)
+	}
+
+	// Bob only sees his own events.
+	for _, event := range decodePayload[[]AuditEventResponse](t, bob.do("GET", "/audit-events?limit=100", nil)) {
+		if event.Actor == transfer.Actor {
+			t.Fatalf("bob sees alice's event %+v", event)
+		}
+	}
+
+	filtered := decodePayload[[]AuditEventResponse](t, alice.do("GET", "/audit-events?action=account.create&limit=1&offset=2", nil))
+	if len(filtered) != 1 || filtered[0].Action != "account.create" || filtered[0].TargetId != checking {
+		t.Fatalf("GET /v2/audit-events?action=account.create&offset=2 = %+v, want the checking account's", filtered)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if later := decodePayload[[]AuditEventResponse](t, alice.do("GET", "/audit-events?since="+future, nil)); len(later) != 0 {
+		t.Fatalf("GET /v2/audit-events?since=%s = %+v, want none", future, later)
+	}
+	for _, query := range []string{"limit=-1", "limit=101", "offset=-1", "since=yesterday"} {
+		if w := alice.do("GET", "/audit-events?"+query, nil); w.Code != 400 {
+			t.Errorf("GET /v2/audit-events?%s = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestLoginsAreAudited(t *testing.T) {
+	s, router := newTestServer(t)
+	signUp(t, router, "alice@broke.bank")
+	anonymous := &testClient{t: t, router: router}
+
+	anonymous.do("POST", "/login", map[string]string{"email": "alice@broke.bank", "password": "wrong-password"})
+	anonymous.do("POST", "/login", map[string]string{"email": "mallory@broke.bank", "password": "password123"})
+
+	events, err := s.Repositories.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Action: "user.login_failed"}, 10, 0)
+	if err != nil {
+		t.Fatalf("SearchAuditEvents: %s", err)
+	}
+	if len(*events) != 2 {
+		t.Fatalf("user.login_failed events = %+v, want 2", *events)
+	}
+
+	unknown, wrong := (*events)[0], (*events)[1]
+	if unknown.TargetId != "mallory@broke.bank" || unknown.UserId != nil || string(unknown.Details) != `{"failure":"unknown_email"}` || unknown.Actor != "anonymous" {
+		t.Errorf("login with an unknown email audited as %+v", unknown)
+	}
+	if wrong.UserId == nil || wrong.TargetId != wrong.UserId.String() || string(wrong.Details) != `{"failure":"wrong_password"}` || wrong.Ip == nil || wrong.RequestId == nil {
+		t.Errorf("login with a wrong password audited as %+v", wrong)
+	}
+}
+
+func TestProcessorDepositsAreAudited(t *testing.T) {
+	s, router := newTestServer(t)
+	s.ProcessorSecret = "whsec_processor"
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+	processor := &testClient{t: t, router: router, prefix: "/v2"}
+
+	event := ProcessorEvent{Id: "evt_1", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_1", Amount: decimal.RequireFromString("25.00"), AccountId: checking}}
+	if w := sendProcessorEvent(processor, "whsec_processor", event); w.Code != 200 {
+		t.Fatalf("charge.succeeded = %d: %s", w.Code, w.Body)
+	}
+
+	events, err := s.Repositories.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Action: "transaction.deposit"}, 10, 0)
+	if err != nil || len(*events) != 1 || (*events)[0].Actor != "processor" {
+		t.Fatalf("deposit audit events = %+v, %v, want one by the processor", events, err)
+	}
+}
+
+func TestGRPCChangesAreAudited(t *testing.T) {
+	s, router := newTestServer(t)
+	c := newGRPCClient(t, s)
+	signUp(t, router, "alice@broke.bank")
+	alice, _ := apiKeyContext(t, s, "alice@broke.bank")
+
+	ctx := metadata.AppendToOutgoingContext(alice, "x-request-id", "grpc-create-1")
+	if _, err := c.CreateAccount(ctx, &bankpb.CreateAccountRequest{Name: "Checking"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.Repositories.AuditRepository.SearchAuditEvents(context.Background(), repository.AuditFilter{Action: "account.create"}, 10, 0)
+	if err != nil || len(*events) != 1 {
+		t.Fatalf("account.create events = %+v, %v, want one", events, err)
+	}
+	event := (*events)[0]
+	if event.UserId == nil || event.Actor != "user:"+event.UserId.String() || event.RequestId == nil || *event.RequestId != "grpc-create-1" || event.UserAgent == nil {
+		t.Fatalf("gRPC account.create audited as %+v", event)
+	}
+}
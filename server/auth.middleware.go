@@ -1,48 +1,91 @@
 package server
 
 import (
+	"broke-bank/model"
+	"broke-bank/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const ApiKeyHeader = "X-Api-Key"
+
+// apiKeyUserId returns the id of the user an API key belongs to, unless the key was revoked.
+func (s *Server) apiKeyUserId(ctx context.Context, api_key string) (string, error) {
+	key, err := s.Repositories.ApiKeyRepository.GetApiKeyByHash(ctx, utils.HashApiKey(api_key))
+	if err != nil {
+		return "", fmt.Errorf("api key not found: %w", err)
+	}
+	if key.RevokedAt != nil {
+		return "", errors.New("api key " + key.Prefix + " is revoked")
+	}
+
+	return key.UserId.String(), nil
+}
+
+/*
+authenticatedUserId returns the id of the user behind the request, taken from the X-Api-Key
+header when present and from the session cookie otherwise.
+*/
+func (s *Server) authenticatedUserId(ctx *gin.Context) (string, error) {
+	if api_key := ctx.GetHeader(ApiKeyHeader); api_key != "" {
+		return s.apiKeyUserId(ctx.Request.Context(), api_key)
+	}
+
+	sessionId, err := ctx.Cookie("sessionId")
+	if err != nil {
+		return "", fmt.Errorf("failed to get session id from cookies: %w", err)
+	}
+
+	userId, err := s.Repositories.SessionRepository.GetSessionUserId(ctx.Request.Context(), sessionId)
+	if err != nil {
+		return "", fmt.Errorf("session(%s) not found on valkey: %w", sessionId, err)
+	}
+
+	return userId, nil
+}
+
+// activeUser returns the authenticated user, who must not be disabled.
+func (s *Server) activeUser(ctx context.Context, user_id string) (*model.User, error) {
+	id, err := uuid.Parse(user_id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user id: %w", err)
+	}
+
+	user, err := s.Repositories.UserRepository.GetUserById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+
+	if user.DisabledAt != nil {
+		return nil, fmt.Errorf("user(%s) is disabled", user.Id)
+	}
+
+	return user, nil
+}
+
 func (s *Server) AuthMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		sessionId, err := ctx.Cookie("sessionId")
-		if err != nil {
-			fmt.Printf("[ERROR] [AuthMiddleware] failed to get session id from cookies: %s\n", err)
-			ctx.JSON(401, gin.H{"message": "Unauthorized"})
-			ctx.Abort()
-			return
-		}
-
-		valkey := s.Repositories.Valkey
-		userId, err := valkey.Do(context.Background(), valkey.B().Get().Key(sessionId).Build()).ToString()
+		userId, err := s.authenticatedUserId(ctx)
 		if err != nil {
-			fmt.Printf("[ERROR] [AuthMiddleware] session(%s) not found on valkey: %s\n", sessionId, err)
+			fmt.Printf("[ERROR] [AuthMiddleware] %s\n", err)
 			ctx.JSON(401, gin.H{"message": "Unauthorized"})
 			ctx.Abort()
 			return
 		}
 
-		id, err := uuid.Parse(userId)
+		user, err := s.activeUser(ctx.Request.Context(), userId)
 		if err != nil {
-			fmt.Printf("[ERROR] [AuthMiddleware] failed to parse user id: %s\n", err)
+			fmt.Printf("[ERROR] [AuthMiddleware] %s\n", err)
 			ctx.JSON(401, gin.H{"message": "Unauthorized"})
 			ctx.Abort()
 			return
 		}
 
-		user, err := s.Repositories.UserRepository.GetUserById(id)
-		if err != nil {
-			fmt.Printf("[ERROR] [AuthMiddleware] failed to get user by id: %s\n", err)
-			ctx.JSON(401, gin.H{"message": "Unauthorized"})
-			ctx.Abort()
-			return
-		}
 		b, err := json.Marshal(user)
 		if err != nil {
 			fmt.Printf("[ERROR] [AuthMiddleware] failed to fetch user: %s\n", err)
@@ -52,6 +95,7 @@ func (s *Server) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		ctx.Set("user", string(b))
+		setAuditActor(ctx, "user:"+user.Id.String())
 
 		ctx.Next()
 	}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const default_account_reopen_grace_period = 30 * 24 * time.Hour
+
+var (
+	errAccountOverdrawn     = errors.New("Account is overdrawn and cannot be closed")
+	errAccountNotReopenable = errors.New("Account can't be reopened")
+)
+
+func accountReopenGracePeriodFromEnv() time.Duration {
+	raw := os.Getenv("ACCOUNT_REOPEN_GRACE_PERIOD")
+	if raw == "" {
+		return default_account_reopen_grace_period
+	}
+
+	grace_period, err := time.ParseDuration(raw)
+	if err != nil || grace_period < 0 {
+		log.Fatalf("Invalid ACCOUNT_REOPEN_GRACE_PERIOD env: %q", raw)
+	}
+
+	return grace_period
+}
+
+func (s *Server) accountReopenGracePeriod() time.Duration {
+	if s.AccountReopenGracePeriod <= 0 {
+		return default_account_reopen_grace_period
+	}
+
+	return s.AccountReopenGracePeriod
+}
+
+/*
+closeAccount closes an account of which the user is an owner, sweeping its balance to
+to_account_id, another account they're a member of, so that no money is left unreachable. The
+sweep is nil for empty accounts. Pending payment requests out of or into the account fail and
+its handle is deleted along with the closure. Sweeps held by the approval policy of the account
+fail with a *debitHeld instead, and close it once approved.
+*/
+func (s *Server) closeAccount(ctx context.Context, caller string, user *model.User, account_id string, to_account_id string) (*model.Account, *model.Transaction, error) {
+	from_id, from_err := uuid.Parse(account_id)
+	to_id, to_err := uuid.Parse(to_account_id)
+	if from_err != nil || to_err != nil || from_id == to_id {
+		return nil, nil, errInvalidInput
+	}
+
+	from, member, err := s.visibleAccount(ctx, caller, user, from_id.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if member.Role != model.MemberOwner {
+		return nil, nil, errOwnersOnly
+	}
+	to, _, err := s.visibleAccount(ctx, caller, user, to_id.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		log.Printf("[ERROR] [%s] an unexpected error occurred while creating transaction ID: %s\n", caller, err)
+		return nil, nil, &failure{"Failed to close account", err}
+	}
+
+	// The sweep debits the account like a transfer, so the approval policy holds it the same way.
+	if from.Balance.IsPositive() {
+		policy, err := s.holdingPolicy(ctx, caller, from.Id, from.Balance)
+		if err != nil {
+			return nil, nil, err
+		}
+		if policy != nil {
+			// Only closures that could execute now are held, they're checked again once approved.
+			if err = repository.CheckAccountStatus(from.Status, from.FrozenUntil, true); err != nil {
+				return nil, nil, err
+			}
+			if err = repository.CheckAccountStatus(to.Status, to.FrozenUntil, false); err != nil {
+				return nil, nil, err
+			}
+
+			request, err := s.submitPaymentRequest(ctx, policy, model.PaymentRequest{
+				Kind:          "closure",
+				TransactionId: transaction_id,
+				FromAccountId: from.Id,
+				ToAccountId:   &to.Id,
+				Amount:        from.Balance,
+				RequestedBy:   user.Id,
+			})
+			if err != nil {
+				log.Printf("[ERROR] [%s] failed to create payment request: %s, account ID: %s\n", caller, err, account_id)
+				return nil, nil, &failure{"Failed to close account", err}
+			}
+
+			return nil, nil, &debitHeld{request: request}
+		}
+	}
+
+	account, sweep, err := s.Repositories.AccountRepository.CloseAccount(ctx, transaction_id, from_id.String(), to_id.String())
+	switch {
+	case errors.Is(err, repository.ErrAccountOverdrawn):
+		return nil, nil, errAccountOverdrawn
+	case errors.Is(err, repository.ErrAccountFrozen), errors.Is(err, repository.ErrAccountClosed):
+		return nil, nil, err
+	// Retrying is left to the client, which only has to send the same request again.
+	case errors.Is(err, repository.ErrLockTimeout), errors.Is(err, repository.ErrQueryTimeout), repository.IsRetryable(err):
+		log.Printf("[ERROR] [%s] failed to lock accounts: %s\n", caller, err)
+		return nil, nil, errAccountBusy
+	case err != nil:
+		log.Printf("[ERROR] [%s] failed to close account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to close account", err}
+	}
+
+	if sweep != nil {
+		s.publishMovementEvents(ctx, caller, sweep.Id)
+	}
+	s.publishAccountStatus(ctx, caller, account)
+
+	return account, sweep, nil
+}
+
+// reopenAccount makes active again, empty, an account closed less than the grace period ago, for one of its owners.
+func (s *Server) reopenAccount(ctx context.Context, caller string, user *model.User, account_id string) (*model.Account, error) {
+	account, member, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != model.MemberOwner {
+		return nil, errOwnersOnly
+	}
+
+	account, err = s.Repositories.AccountRepository.ReopenAccount(ctx, account.Id.String(), time.Now().Add(-s.accountReopenGracePeriod()))
+	if errors.Is(err, repository.ErrAccountStatus) {
+		return nil, errAccountNotReopenable
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to reopen account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to reopen account", err}
+	}
+
+	s.publishAccountStatus(ctx, caller, account)
+
+	return account, nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloseAccount(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	checking := alice.createAccount("Checking")
+	savings := alice.createAccount("Savings")
+	bob := signUp(t, router, "bob@broke.bank")
+	bob.prefix = "/v2"
+	bobs := bob.createAccount("Bob's")
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "42.50", "to_account_id": savings})
+
+	t.Run("the destination must be another of the user's accounts", func(t *testing.T) {
+		cases := []struct {
+			to   any
+			want int
+		}{
+			{nil, 422},
+			{savings, 422},
+			{"not-an-id", 422},
+			{bobs, 404},
+		}
+		for _, c := range cases {
+			if w := alice.do("POST", "/account/"+savings+"/close", map[string]any{"to_account_id": c.to}); w.Code != c.want {
+				t.Errorf("closing to %v = %d, want %d: %s", c.to, w.Code, c.want, w.Body)
+			}
+		}
+		if w := bob.do("POST", "/account/"+savings+"/close", map[string]string{"to_account_id": bobs}); w.Code != 404 {
+			t.Errorf("closing someone else's account = %d, want 404", w.Code)
+		}
+		if balance := alice.balance(savings); balance != "42.50" {
+			t.Errorf("balance after refused closings = %s, want 42.50", balance)
+		}
+	})
+
+	t.Run("the balance is swept and the account blocked", func(t *testing.T) {
+		w := alice.do("POST", "/account/"+savings+"/close", map[string]string{"to_account_id": checking})
+		if w.Code != 200 {
+			t.Fatalf("POST /account/:id/close = %d: %s", w.Code, w.Body)
+		}
+		closed := decodePayload[CloseAccountResponse](t, w)
+		if closed.Account.Status != "closed" || closed.Account.Balance != "0.00" || closed.Sweep == nil || closed.Sweep.Amount != "42.50" || closed.Sweep.Type != "transfer" {
+			t.Fatalf("POST /account/:id/close = %+v", closed)
+		}
+		if until := time.Until(closed.ReopenUntil); until < s.accountReopenGracePeriod()-time.Minute || until > s.accountReopenGracePeriod() {
+			t.Errorf("reopen_until = %s, want in the grace period", closed.ReopenUntil)
+		}
+		if balance := alice.balance(checking); balance != "42.50" {
+			t.Errorf("destination balance = %s, want 42.50", balance)
+		}
+
+		if w := alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": savings}); w.Code != 409 {
+			t.Errorf("depositing to a closed account = %d, want 409", w.Code)
+		}
+		if w := alice.do("POST", "/account/"+savings+"/close", map[string]string{"to_account_id": checking}); w.Code != 409 {
+			t.Errorf("closing a closed account = %d, want 409", w.Code)
+		}
+	})
+
+	t.Run("empty accounts are closed without a sweep", func(t *testing.T) {
+		empty := alice.createAccount("Empty")
+		closed := decodePayload[CloseAccountResponse](t, alice.do("POST", "/account/"+empty+"/close", map[string]string{"to_account_id": checking}))
+		if closed.Account.Status != "closed" || closed.Sweep != nil {
+			t.Fatalf("POST /account/:id/close = %+v, want no sweep", closed)
+		}
+	})
+
+	t.Run("pending requests and the handle go with the account", func(t *testing.T) {
+		business := alice.createAccount("Business")
+		holiday := alice.createAccount("Holiday")
+		alice.do("POST", "/transaction/deposit", map[string]string{"amount": "200.00", "to_account_id": business})
+		alice.do("POST", "/account/"+business+"/invitations", map[string]any{"email": "bob@broke.bank", "role": "owner"})
+		invitations := decodePayload[[]InvitationResponse](t, bob.do("GET", "/invitations", nil))
+		bob.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+		alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "50", "required_approvals": 1})
+
+		w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "100.00", "from_account_id": business, "to_account_id": holiday})
+		if w.Code != 202 {
+			t.Fatalf("transfer over the threshold = %d %s, want 202", w.Code, w.Body)
+		}
+		request := decodePayload[PaymentRequestResponse](t, w)
+		if w = alice.do("PUT", "/me/handle", map[string]string{"handle": "@alice", "account_id": holiday}); w.Code != 200 {
+			t.Fatalf("PUT /me/handle = %d: %s", w.Code, w.Body)
+		}
+
+		if w = alice.do("POST", "/account/"+holiday+"/close", map[string]string{"to_account_id": checking}); w.Code != 200 {
+			t.Fatalf("POST /account/:id/close = %d: %s", w.Code, w.Body)
+		}
+
+		failed := decodePayload[GetPaymentRequestResponse](t, alice.do("GET", "/payment-requests/"+request.Id.String(), nil))
+		if failed.Status != "failed" || failed.FailureReason == nil || *failed.FailureReason != "account_closed" {
+			t.Errorf("request into the closed account = %+v, want it failed with account_closed", failed)
+		}
+		if w = bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil); w.Code != 409 {
+			t.Errorf("approving a request of a closed account = %d, want 409", w.Code)
+		}
+		if w = alice.do("GET", "/me/handle", nil); w.Code != 404 {
+			t.Errorf("handle of the closed account = %d, want 404", w.Code)
+		}
+		if balance := alice.balance(business); balance != "200.00" {
+			t.Errorf("balance after the closure = %s, want 200.00", balance)
+		}
+	})
+
+	t.Run("accounts are reopened within the grace period", func(t *testing.T) {
+		if w := alice.do("POST", "/account/"+checking+"/reopen", nil); w.Code != 409 {
+			t.Errorf("reopening an active account = %d, want 409", w.Code)
+		}
+		if w := bob.do("POST", "/account/"+savings+"/reopen", nil); w.Code != 404 {
+			t.Errorf("reopening someone else's account = %d, want 404", w.Code)
+		}
+
+		grace_period := s.AccountReopenGracePeriod
+		s.AccountReopenGracePeriod = time.Nanosecond
+		if w := alice.do("POST", "/account/"+savings+"/reopen", nil); w.Code != 409 {
+			t.Errorf("reopening after the grace period = %d, want 409", w.Code)
+		}
+		s.AccountReopenGracePeriod = grace_period
+
+		reopened := decodePayload[GetAccountResponse](t, alice.do("POST", "/account/"+savings+"/reopen", nil))
+		if reopened.Status != "active" || reopened.Balance != "0.00" {
+			t.Fatalf("POST /account/:id/reopen = %+v, want an active empty account", reopened)
+		}
+		if w := alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": savings}); w.Code != 200 {
+			t.Errorf("depositing to a reopened account = %d: %s", w.Code, w.Body)
+		}
+	})
+}
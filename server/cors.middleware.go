@@ -16,7 +16,8 @@ func CorsMiddleware() gin.HandlerFunc {
 
 		ctx.Writer.Header().Set("Access-Control-Allow-Origin", access_control_origin)
 		ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Api-Key, Last-Event-ID, X-Request-Id, X-Admin-Reason")
+		ctx.Writer.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, Deprecation, Sunset, Link, X-Request-Id")
 		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if ctx.Request.Method == "OPTIONS" {
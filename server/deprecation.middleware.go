@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+DeprecationMiddleware marks the routes of a group as deprecated with the Deprecation (RFC 9745)
+and Sunset (RFC 8594) headers, and links to the same path under successor_prefix. After the
+sunset the routes answer 410 Gone.
+*/
+func DeprecationMiddleware(deprecated_at time.Time, sunset time.Time, successor_prefix string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.Writer.Header()
+		header.Set("Deprecation", fmt.Sprintf("@%d", deprecated_at.Unix()))
+		header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		header.Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successor_prefix, ctx.Request.URL.Path))
+
+		if time.Now().After(sunset) {
+			ctx.JSON(410, gin.H{"error": "This API version is no longer available, use " + successor_prefix})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"broke-bank/repository"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restError answers with the status and message of an error returned by the shared operations.
+func restError(ctx *gin.Context, err error) {
+	var f *failure
+
+	switch {
+	case errors.Is(err, errInvalidInput), errors.Is(err, errIdempotencyKeyReused), errors.Is(err, errTooManyWebhooks), errors.Is(err, errInvalidRole), errors.Is(err, errChangingOwnRole),
+		errors.Is(err, errInvalidMemberChange), errors.Is(err, errTooManyApprovals), errors.Is(err, errOwnAccountPayee),
+		errors.Is(err, errInvalidAccountNumber):
+		ctx.JSON(422, gin.H{"error": err.Error()})
+	case errors.Is(err, errAccountNotFound), errors.Is(err, errTransactionNotFound), errors.Is(err, errWebhookNotFound), errors.Is(err, errDeliveryNotFound), errors.Is(err, errUserNotFound), errors.Is(err, errAdjustmentNotFound),
+		errors.Is(err, errMemberNotFound), errors.Is(err, errInvitationNotFound), errors.Is(err, errRemovalNotFound), errors.Is(err, errPolicyNotFound), errors.Is(err, errPaymentRequestNotFound),
+		errors.Is(err, errPayeeNotFound), errors.Is(err, errReceiverNotFound), errors.Is(err, errHandleNotFound):
+		ctx.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, errDepositsDisabled), errors.Is(err, errAdjustmentSelf), errors.Is(err, errOwnersOnly), errors.Is(err, errViewerCantSpend), errors.Is(err, errOverSpendLimit),
+		errors.Is(err, errOwnRemovalApproval), errors.Is(err, errOwnPaymentRequest), errors.Is(err, errOverCoolingOffLimit), errors.Is(err, errNotHolder):
+		ctx.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, errAccountNotActive), errors.Is(err, errAccountNotFrozen), errors.Is(err, errAccountOverdrawn), errors.Is(err, errAccountNotReopenable), errors.Is(err, errAdjustmentDecided), errors.Is(err, errAdjustmentTwice), errors.Is(err, errAdjustmentOverdraft), errors.Is(err, errAdjustmentReversed),
+		errors.Is(err, errAlreadyMember), errors.Is(err, errAlreadyInvited), errors.Is(err, errInvitationDecided), errors.Is(err, errLastOwner), errors.Is(err, errRemovalPending), errors.Is(err, errRemovalDecided),
+		errors.Is(err, errPaymentRequestDecided), errors.Is(err, errPaymentRequestExpired), errors.Is(err, errPaymentRequestTwice), errors.Is(err, errPayeeExists), errors.Is(err, errNicknameTaken), errors.Is(err, errHandleTaken):
+		ctx.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrAccountFrozen):
+		ctx.JSON(409, gin.H{"error": "Account is frozen"})
+	case errors.Is(err, repository.ErrAccountClosed):
+		ctx.JSON(409, gin.H{"error": "Account is closed"})
+	case errors.Is(err, errAccountBusy), errors.Is(err, errReceiptsDisabled):
+		ctx.JSON(503, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		ctx.JSON(500, gin.H{"error": "Insufficient account balance"})
+	case errors.Is(err, errNotAccountOwner), errors.Is(err, errAccountHasBalance), errors.Is(err, errDuplicatedTransaction):
+		ctx.JSON(500, gin.H{"error": err.Error()})
+	case errors.As(err, &f):
+		ctx.JSON(500, gin.H{"error": f.message})
+	default:
+		ctx.JSON(500, gin.H{"error": "Unexpected error :("})
+	}
+}
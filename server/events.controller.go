@@ -0,0 +1,168 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// How long an idle event stream waits before a keepalive, the caller is authenticated again after each wait.
+var events_keepalive = 15 * time.Second
+
+// Most events read from the user's stream at once.
+const events_batch = 100
+
+// Event ids are Valkey stream ids.
+var event_id_pattern = regexp.MustCompile(`^\d+-\d+$`)
+
+/*
+Events pushes the caller's events as they happen, over Server-Sent Events or, when the request
+asks for an upgrade, over a WebSocket sending each model.Event as a JSON message.
+
+Clients resume after a disconnect with the Last-Event-ID header, which EventSource sends by
+itself, or the last_event_id query param, since browsers can't set headers on WebSockets. Events
+older than the last repository.EventRetention ones can't be resumed, and without an id the
+stream starts with the next event.
+*/
+func (s *Server) Events() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [Events] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		last_event_id := ctx.GetHeader("Last-Event-ID")
+		if last_event_id == "" {
+			last_event_id = ctx.Query("last_event_id")
+		}
+		if last_event_id != "" && !event_id_pattern.MatchString(last_event_id) {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if last_event_id == "" {
+			last_event_id, err = s.Repositories.EventRepository.GetLatestEventId(ctx.Request.Context(), user.Id.String())
+			if err != nil {
+				log.Printf("[ERROR] [Events] failed to get latest event id: %s\n", err)
+				ctx.JSON(500, gin.H{"error": "Failed to get events"})
+				return
+			}
+		}
+
+		if strings.EqualFold(ctx.GetHeader("Upgrade"), "websocket") {
+			s.eventsWebSocket(ctx, user, last_event_id)
+			return
+		}
+
+		s.eventsSSE(ctx, user, last_event_id)
+	}
+}
+
+func (s *Server) eventsSSE(ctx *gin.Context, user *model.User, last_event_id string) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	// Keeps reverse proxies from buffering the stream.
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(200)
+	ctx.Writer.Flush()
+
+	send := func(event model.Event) error {
+		_, err := fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, event.Data)
+		ctx.Writer.Flush()
+		return err
+	}
+	keepalive := func() error {
+		_, err := fmt.Fprint(ctx.Writer, ": keepalive\n\n")
+		ctx.Writer.Flush()
+		return err
+	}
+
+	s.streamEvents(ctx.Request.Context(), ctx, user, last_event_id, send, keepalive)
+}
+
+func (s *Server) eventsWebSocket(ctx *gin.Context, user *model.User, last_event_id string) {
+	server := websocket.Server{
+		// Browsers send cookies along with cross-site handshakes, so only the web app may open one.
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			if origin := req.Header.Get("Origin"); origin != "" && origin != os.Getenv("ACCESS_CONTROL_ORIGIN") {
+				return errors.New("origin " + origin + " is not allowed")
+			}
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			// The connection is hijacked, so only a failed read tells that the client went away.
+			stream_ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				defer cancel()
+				var ignored string
+				for websocket.Message.Receive(conn, &ignored) == nil {
+				}
+			}()
+
+			send := func(event model.Event) error {
+				return websocket.JSON.Send(conn, event)
+			}
+			keepalive := func() error { return nil }
+
+			s.streamEvents(stream_ctx, ctx, user, last_event_id, send, keepalive)
+		},
+	}
+
+	server.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+/*
+streamEvents sends the user's events after last_event_id until stream_ctx is done or sending
+fails. The request is authenticated again before every batch and keepalive, so that revoking
+the session or API key, or disabling the user, ends the stream.
+*/
+func (s *Server) streamEvents(stream_ctx context.Context, ctx *gin.Context, user *model.User, last_event_id string, send func(model.Event) error, keepalive func() error) {
+	for {
+		events, err := s.Repositories.EventRepository.ReadEvents(stream_ctx, user.Id.String(), last_event_id, events_batch, events_keepalive)
+		if stream_ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] [Events] failed to read events: %s, user ID: %s\n", err, user.Id)
+			return
+		}
+
+		user_id, err := s.authenticatedUserId(ctx)
+		if err == nil && user_id == user.Id.String() {
+			_, err = s.activeUser(stream_ctx, user_id)
+		}
+		if err != nil || user_id != user.Id.String() {
+			return
+		}
+
+		if len(events) == 0 {
+			if keepalive() != nil {
+				return
+			}
+			continue
+		}
+
+		for _, event := range events {
+			if send(event) != nil {
+				return
+			}
+			last_event_id = event.Id
+		}
+	}
+}
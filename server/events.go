@@ -0,0 +1,119 @@
+package server
+
+import (
+	"broke-bank/model"
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Event types pushed to the members of the accounts involved, see Events.
+const (
+	EventTransactionCreated    = "transaction.created"
+	EventAccountBalanceChanged = "account.balance_changed"
+	EventAccountDisabled       = "account.disabled"
+	EventAccountStatusChanged  = "account.status_changed"
+)
+
+type BalanceChangedEvent struct {
+	AccountId uuid.UUID `json:"account_id"`
+	// Balance with 2 decimal places, read right after the transaction.
+	Balance       string    `json:"balance"`
+	TransactionId uuid.UUID `json:"transaction_id"`
+}
+
+type AccountDisabledEvent struct {
+	AccountId uuid.UUID `json:"account_id"`
+}
+
+/*
+publishEvent is best effort: the operation it reports has already succeeded, so a failure is
+only logged. Clients that missed an event can still read the state from the REST API.
+*/
+func (s *Server) publishEvent(ctx context.Context, caller string, user_id uuid.UUID, event_type string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to encode %s event: %s\n", caller, event_type, err)
+		return
+	}
+
+	// The request may end right after answering, the event must still be published.
+	if _, err = s.Repositories.EventRepository.PublishEvent(context.WithoutCancel(ctx), user_id.String(), event_type, raw); err != nil {
+		log.Printf("[ERROR] [%s] failed to publish %s event: %s, user ID: %s\n", caller, event_type, err, user_id)
+	}
+}
+
+/*
+accountMemberIds returns the members of an account, whom its events are published to, or nil
+when they can't be read, which is only logged like the failures of publishEvent.
+*/
+func (s *Server) accountMemberIds(ctx context.Context, caller string, account_id uuid.UUID) []uuid.UUID {
+	members, err := s.Repositories.MemberRepository.GetAccountMembers(ctx, account_id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account members for events: %s, account ID: %s\n", caller, err, account_id)
+		return nil
+	}
+
+	ids := []uuid.UUID{}
+	for _, member := range *members {
+		ids = append(ids, member.UserId)
+	}
+
+	return ids
+}
+
+// publishAccountEvent publishes an event of an account to each of its members.
+func (s *Server) publishAccountEvent(ctx context.Context, caller string, account_id uuid.UUID, event_type string, data any) {
+	for _, member := range s.accountMemberIds(ctx, caller, account_id) {
+		s.publishEvent(ctx, caller, member, event_type, data)
+	}
+}
+
+/*
+publishMovementEvents sends transaction.created to the members of every account a transaction
+touched, once per member, followed by account.balance_changed for each account to its members.
+*/
+func (s *Server) publishMovementEvents(ctx context.Context, caller string, transaction_id uuid.UUID) {
+	ctx = context.WithoutCancel(ctx)
+
+	transaction, err := s.Repositories.TransactionRepository.GetTransaction(ctx, transaction_id.String())
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get transaction for events: %s, transaction ID: %s\n", caller, err, transaction_id)
+		return
+	}
+
+	accounts := []*model.Account{}
+	members := []uuid.UUID{}
+	for _, account_id := range []*uuid.UUID{transaction.FromAccountId, transaction.ToAccountId} {
+		if account_id == nil {
+			continue
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx, account_id.String())
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get account for events: %s, account ID: %s\n", caller, err, account_id)
+			continue
+		}
+
+		accounts = append(accounts, account)
+		for _, member := range s.accountMemberIds(ctx, caller, account.Id) {
+			if !slices.Contains(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+
+	for _, member := range members {
+		s.publishEvent(ctx, caller, member, EventTransactionCreated, newTransactionResponse(transaction))
+	}
+	for _, account := range accounts {
+		s.publishAccountEvent(ctx, caller, account.Id, EventAccountBalanceChanged, BalanceChangedEvent{
+			AccountId:     account.Id,
+			Balance:       account.Balance.StringFixed(2),
+			TransactionId: transaction.Id,
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"broke-bank/model"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// openEvents connects to GET /v2/events and sends the events it receives on the returned channel.
+func openEvents(t *testing.T, ts *httptest.Server, c *testClient, last_event_id string) <-chan model.Event {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/v2/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(c.cookie)
+	if last_event_id != "" {
+		req.Header.Set("Last-Event-ID", last_event_id)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /v2/events: %s", err)
+	}
+	if res.StatusCode != 200 || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("GET /v2/events = %d, Content-Type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	events := make(chan model.Event, 100)
+	go func() {
+		defer res.Body.Close()
+		defer close(events)
+
+		event := model.Event{}
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.Id != "" {
+					events <- event
+				}
+				event = model.Event{}
+			case strings.HasPrefix(line, "id: "):
+				event.Id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan model.Event, event_type string) model.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("stream ended, want a %s event", event_type)
+		}
+		if event.Type != event_type {
+			t.Fatalf("got a %s event (%s), want %s", event.Type, event.Data, event_type)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event received, want %s", event_type)
+	}
+
+	return model.Event{}
+}
+
+func noEvent(t *testing.T, events <-chan model.Event) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		t.Fatalf("got an unexpected %s event: %s", event.Type, event.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventsSSE(t *testing.T) {
+	keepalive := events_keepalive
+	events_keepalive = 50 * time.Millisecond
+	// Restored after the streams are closed, since cleanups run last in first.
+	t.Cleanup(func() { events_keepalive = keepalive })
+
+	s, router := newTestServer(t)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+	checking := alice.createAccount("Checking")
+	empty := alice.createAccount("Empty")
+	savings := bob.createAccount("Savings")
+
+	// Events from before connecting are only sent when resuming.
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": checking})
+
+	alice_events := openEvents(t, ts, alice, "")
+	bob_events := openEvents(t, ts, bob, "")
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings})
+	alice.do("PATCH", "/account/disable/"+empty, nil)
+
+	first := nextEvent(t, alice_events, EventTransactionCreated)
+	if deposit := decodeEvent[GetTransactionResponse](t, first); deposit.Type != "deposit" || deposit.Amount != "100.00" {
+		t.Fatalf("transaction.created = %+v, want the deposit", deposit)
+	}
+	if balance := decodeEvent[BalanceChangedEvent](t, nextEvent(t, alice_events, EventAccountBalanceChanged)); balance.AccountId.String() != checking || balance.Balance != "101.00" {
+		t.Fatalf("account.balance_changed = %+v, want checking at 101.00", balance)
+	}
+
+	transfer := decodeEvent[GetTransactionResponse](t, nextEvent(t, alice_events, EventTransactionCreated))
+	if transfer.Type != "transfer" {
+		t.Fatalf("transaction.created = %+v, want the transfer", transfer)
+	}
+	if balance := decodeEvent[BalanceChangedEvent](t, nextEvent(t, alice_events, EventAccountBalanceChanged)); balance.Balance != "75.50" || balance.TransactionId != transfer.Id {
+		t.Fatalf("account.balance_changed = %+v, want checking at 75.50 after the transfer", balance)
+	}
+	if disabled := decodeEvent[AccountDisabledEvent](t, nextEvent(t, alice_events, EventAccountDisabled)); disabled.AccountId.String() != empty {
+		t.Fatalf("account.disabled = %+v, want the empty account", disabled)
+	}
+	noEvent(t, alice_events)
+
+	// Bob only hears about his own account.
+	if received := decodeEvent[GetTransactionResponse](t, nextEvent(t, bob_events, EventTransactionCreated)); received.Id != transfer.Id {
+		t.Fatalf("bob's transaction.created = %+v, want the transfer", received)
+	}
+	if balance := decodeEvent[BalanceChangedEvent](t, nextEvent(t, bob_events, EventAccountBalanceChanged)); balance.AccountId.String() != savings || balance.Balance != "25.50" {
+		t.Fatalf("bob's account.balance_changed = %+v, want savings at 25.50", balance)
+	}
+	noEvent(t, bob_events)
+
+	// Resuming replays what came after the last event received.
+	resumed := openEvents(t, ts, alice, first.Id)
+	nextEvent(t, resumed, EventAccountBalanceChanged)
+	nextEvent(t, resumed, EventTransactionCreated)
+	nextEvent(t, resumed, EventAccountBalanceChanged)
+	nextEvent(t, resumed, EventAccountDisabled)
+	noEvent(t, resumed)
+
+	if w := alice.doWithHeaders("GET", "/v2/events", nil, map[string]string{"Last-Event-ID": "not-an-id"}); w.Code != 400 {
+		t.Fatalf("GET /v2/events with an invalid Last-Event-ID = %d, want 400", w.Code)
+	}
+
+	anonymous := &testClient{t: t, router: router}
+	if w := anonymous.do("GET", "/v2/events", nil); w.Code != 401 {
+		t.Fatalf("anonymous GET /v2/events = %d, want 401", w.Code)
+	}
+
+	// Revoking the session ends the stream at the next keepalive.
+	revoked := openEvents(t, ts, alice, "")
+	if err := s.Repositories.SessionRepository.RevokeSession(context.Background(), alice.cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-revoked:
+		if ok {
+			t.Fatal("got an event after revoking the session")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after revoking the session")
+	}
+}
+
+func TestEventsReachEveryMember(t *testing.T) {
+	_, router := newTestServer(t)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+
+	alice := signUp(t, router, "alice@broke.bank")
+	carol := signUp(t, router, "carol@broke.bank")
+	alice.prefix, carol.prefix = "/v2", "/v2"
+	joint := alice.createAccount("Joint")
+	empty := alice.createAccount("Empty")
+	for _, account := range []string{joint, empty} {
+		alice.do("POST", "/account/"+account+"/invitations", map[string]any{"email": "carol@broke.bank", "role": "viewer"})
+		invitations := decodePayload[[]InvitationResponse](t, carol.do("GET", "/invitations", nil))
+		carol.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+	}
+
+	carol_events := openEvents(t, ts, carol, "")
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "10.00", "to_account_id": joint})
+	alice.do("PATCH", "/account/disable/"+empty, nil)
+
+	if deposit := decodeEvent[GetTransactionResponse](t, nextEvent(t, carol_events, EventTransactionCreated)); deposit.Amount != "10.00" {
+		t.Fatalf("viewer's transaction.created = %+v, want the deposit", deposit)
+	}
+	if balance := decodeEvent[BalanceChangedEvent](t, nextEvent(t, carol_events, EventAccountBalanceChanged)); balance.AccountId.String() != joint || balance.Balance != "10.00" {
+		t.Fatalf("viewer's account.balance_changed = %+v, want the joint account at 10.00", balance)
+	}
+	if disabled := decodeEvent[AccountDisabledEvent](t, nextEvent(t, carol_events, EventAccountDisabled)); disabled.AccountId.String() != empty {
+		t.Fatalf("viewer's account.disabled = %+v, want the empty account", disabled)
+	}
+	noEvent(t, carol_events)
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	_, router := newTestServer(t)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+
+	dial := func(origin string, query string) (*websocket.Conn, error) {
+		config, err := websocket.NewConfig("ws"+strings.TrimPrefix(ts.URL, "http")+"/v2/events"+query, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Header.Set("Cookie", alice.cookie.String())
+
+		return websocket.DialConfig(config)
+	}
+
+	if _, err := dial("https://evil.example", ""); err == nil {
+		t.Fatal("WebSocket from another origin was accepted")
+	}
+
+	conn, err := dial("http://localhost", "")
+	if err != nil {
+		t.Fatalf("WebSocket: %s", err)
+	}
+	defer conn.Close()
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "10.00", "to_account_id": checking})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	created := model.Event{}
+	if err = websocket.JSON.Receive(conn, &created); err != nil || created.Type != EventTransactionCreated {
+		t.Fatalf("WebSocket message = %+v, %v, want transaction.created", created, err)
+	}
+	balance := model.Event{}
+	if err = websocket.JSON.Receive(conn, &balance); err != nil || balance.Type != EventAccountBalanceChanged {
+		t.Fatalf("WebSocket message = %+v, %v, want account.balance_changed", balance, err)
+	}
+
+	// Browsers can't set Last-Event-ID on WebSockets, so it's also read from the query.
+	resumed, err := dial("http://localhost", "?last_event_id="+created.Id)
+	if err != nil {
+		t.Fatalf("WebSocket: %s", err)
+	}
+	defer resumed.Close()
+
+	resumed.SetReadDeadline(time.Now().Add(5 * time.Second))
+	replayed := model.Event{}
+	if err = websocket.JSON.Receive(resumed, &replayed); err != nil || replayed.Id != balance.Id {
+		t.Fatalf("resumed WebSocket message = %+v, %v, want %s", replayed, err, balance.Id)
+	}
+}
+
+func decodeEvent[T any](t *testing.T, event model.Event) T {
+	t.Helper()
+
+	var data T
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatalf("%s event data %s: %s", event.Type, event.Data, err)
+	}
+
+	return data
+}
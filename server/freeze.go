@@ -0,0 +1,106 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const account_freeze_expiry_interval = time.Minute
+
+// AccountStatusChangedEvent leaves the reason of the status to staff, like the outbox event.
+type AccountStatusChangedEvent struct {
+	AccountId uuid.UUID `json:"account_id"`
+	// 'active' | 'inactive' | 'frozen_debit' | 'frozen_all' | 'closed'
+	Status      string     `json:"status"`
+	FrozenUntil *time.Time `json:"frozen_until"`
+}
+
+func (s *Server) publishAccountStatus(ctx context.Context, caller string, account *model.Account) {
+	s.publishAccountEvent(ctx, caller, account.Id, EventAccountStatusChanged, AccountStatusChangedEvent{
+		AccountId:   account.Id,
+		Status:      account.Status,
+		FrozenUntil: account.FrozenUntil,
+	})
+}
+
+/*
+changeAccountStatus applies change to an account on behalf of staff, audited by the repository
+with the request's reason, and tells the owner. wrong_status is returned when the account isn't
+in one of change.From.
+*/
+func (s *Server) changeAccountStatus(ctx context.Context, caller string, account_id string, change repository.AccountStatusChange, wrong_status error) (*model.Account, error) {
+	account, err := s.adminAccount(ctx, caller, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err = s.Repositories.AccountRepository.SetAccountStatus(ctx, account.Id.String(), change)
+	if errors.Is(err, repository.ErrAccountStatus) {
+		return nil, wrong_status
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to set account status: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to update account", err}
+	}
+
+	s.publishAccountStatus(ctx, caller, account)
+
+	return account, nil
+}
+
+// freezeAccount freezes an active account until frozen_until, or indefinitely when it's nil.
+func (s *Server) freezeAccount(ctx context.Context, caller string, account_id string, status string, reason string, frozen_until *time.Time) (*model.Account, error) {
+	if (status != model.AccountFrozenDebit && status != model.AccountFrozenAll) || !slices.Contains(model.AccountStatusReasons, reason) {
+		return nil, errInvalidInput
+	}
+	if frozen_until != nil && !frozen_until.After(time.Now()) {
+		return nil, errInvalidInput
+	}
+
+	change := repository.AccountStatusChange{From: []string{model.AccountActive}, Status: status, StatusReason: &reason, FrozenUntil: frozen_until}
+	return s.changeAccountStatus(ctx, caller, account_id, change, errAccountNotActive)
+}
+
+func (s *Server) unfreezeAccount(ctx context.Context, caller string, account_id string) (*model.Account, error) {
+	change := repository.AccountStatusChange{From: []string{model.AccountFrozenDebit, model.AccountFrozenAll}, Status: model.AccountActive}
+	return s.changeAccountStatus(ctx, caller, account_id, change, errAccountNotFrozen)
+}
+
+/*
+RunAccountFreezeExpiry makes accounts active again once their freeze is over, until ctx is done.
+Movements already ignore expired freezes, this tells the owners and shows the right status.
+Every instance can run it, an account is only unfrozen once.
+*/
+func (s *Server) RunAccountFreezeExpiry(ctx context.Context) {
+	ticker := time.NewTicker(account_freeze_expiry_interval)
+	defer ticker.Stop()
+
+	for {
+		s.expireAccountFreezes(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) expireAccountFreezes(ctx context.Context) {
+	accounts, err := s.Repositories.AccountRepository.ExpireAccountFreezes(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [RunAccountFreezeExpiry] failed to expire account freezes: %s\n", err)
+		return
+	}
+
+	for i := range *accounts {
+		s.publishAccountStatus(ctx, "RunAccountFreezeExpiry", &(*accounts)[i])
+	}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"broke-bank/bankpb"
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// How often WatchAccountTransactions looks for new transactions.
+var grpc_feed_interval = time.Second
+
+// GRPCServer serves bank.proto with the same repositories and rules as the REST API.
+func (s *Server) GRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(s.grpcAuthUnaryInterceptor),
+		grpc.StreamInterceptor(s.grpcAuthStreamInterceptor),
+	)
+	bankpb.RegisterBrokeBankServer(server, &grpcService{s: s})
+
+	return server
+}
+
+func (s *Server) RunGRPC(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.GRPCServer().Serve(listener)
+}
+
+type grpcService struct {
+	bankpb.UnimplementedBrokeBankServer
+	s *Server
+}
+
+// grpcError translates an error returned by the shared operations, keeping the REST API's messages.
+func grpcError(err error) error {
+	var f *failure
+
+	switch {
+	case errors.Is(err, errInvalidInput), errors.Is(err, errInvalidAccountNumber):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errAccountNotFound), errors.Is(err, errTransactionNotFound), errors.Is(err, errReceiverNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errNotAccountOwner), errors.Is(err, errDepositsDisabled), errors.Is(err, errOwnersOnly), errors.Is(err, errViewerCantSpend), errors.Is(err, errOverSpendLimit),
+		errors.Is(err, errOverCoolingOffLimit):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		return status.Error(codes.FailedPrecondition, "Insufficient account balance")
+	case errors.Is(err, repository.ErrAccountFrozen):
+		return status.Error(codes.FailedPrecondition, "Account is frozen")
+	case errors.Is(err, repository.ErrAccountClosed):
+		return status.Error(codes.FailedPrecondition, "Account is closed")
+	case errors.Is(err, errAccountHasBalance), errors.Is(err, errIdempotencyKeyReused):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errDuplicatedTransaction):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, errAccountBusy):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.As(err, &f) && errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, f.message)
+	case errors.As(err, &f):
+		return status.Error(codes.Internal, f.message)
+	default:
+		return status.Error(codes.Internal, "Unexpected error :(")
+	}
+}
+
+func newAccountMessage(account *model.Account) *bankpb.Account {
+	return &bankpb.Account{
+		Id:      account.Id.String(),
+		Name:    account.Name,
+		Balance: account.Balance.StringFixed(2),
+		Status:  account.Status,
+	}
+}
+
+func newTransactionMessage(transaction *model.Transaction) *bankpb.Transaction {
+	message := &bankpb.Transaction{
+		Id:       transaction.Id.String(),
+		Type:     transaction.Type,
+		Amount:   transaction.Amount.StringFixed(2),
+		IssuedAt: timestamppb.New(transaction.DateIssued),
+	}
+	if transaction.FromAccountId != nil {
+		message.FromAccountId = transaction.FromAccountId.String()
+	}
+	if transaction.ToAccountId != nil {
+		message.ToAccountId = transaction.ToAccountId.String()
+	}
+	if transaction.ReversalOf != nil {
+		message.ReversalOf = transaction.ReversalOf.String()
+	}
+
+	return message
+}
+
+func (g *grpcService) GetMe(ctx context.Context, _ *emptypb.Empty) (*bankpb.User, error) {
+	user := grpcUser(ctx)
+
+	return &bankpb.User{Id: user.Id.String(), Email: user.Email}, nil
+}
+
+func (g *grpcService) ListAccounts(ctx context.Context, req *bankpb.ListAccountsRequest) (*bankpb.ListAccountsResponse, error) {
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, grpcError(errInvalidInput)
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = 10
+	}
+
+	accounts, err := g.s.Repositories.AccountRepository.GetMyAccounts(ctx, grpcUser(ctx).Id.String(), limit, int(req.Offset))
+	if err != nil {
+		return nil, grpcError(&failure{"Failed to retrieve accounts", err})
+	}
+
+	res := &bankpb.ListAccountsResponse{Accounts: []*bankpb.Account{}}
+	for i := range *accounts {
+		res.Accounts = append(res.Accounts, newAccountMessage(&(*accounts)[i]))
+	}
+
+	return res, nil
+}
+
+func (g *grpcService) GetAccount(ctx context.Context, req *bankpb.GetAccountRequest) (*bankpb.Account, error) {
+	account, _, err := g.s.memberAccount(ctx, "GRPC.GetAccount", grpcUser(ctx), req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return newAccountMessage(account), nil
+}
+
+func (g *grpcService) CreateAccount(ctx context.Context, req *bankpb.CreateAccountRequest) (*emptypb.Empty, error) {
+	if err := g.s.createAccount(ctx, "GRPC.CreateAccount", grpcUser(ctx), req.Name); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcService) DisableAccount(ctx context.Context, req *bankpb.DisableAccountRequest) (*emptypb.Empty, error) {
+	if err := g.s.disableAccount(ctx, "GRPC.DisableAccount", grpcUser(ctx), req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcService) GetTransaction(ctx context.Context, req *bankpb.GetTransactionRequest) (*bankpb.Transaction, error) {
+	transaction, err := g.s.visibleTransaction(ctx, "GRPC.GetTransaction", grpcUser(ctx), req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return newTransactionMessage(transaction), nil
+}
+
+func (g *grpcService) ListAccountTransactions(ctx context.Context, req *bankpb.ListAccountTransactionsRequest) (*bankpb.ListAccountTransactionsResponse, error) {
+	transactions, err := g.s.accountTransactions(ctx, "GRPC.ListAccountTransactions", grpcUser(ctx), req.AccountId, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &bankpb.ListAccountTransactionsResponse{Transactions: []*bankpb.Transaction{}}
+	for i := range transactions {
+		res.Transactions = append(res.Transactions, newTransactionMessage(&transactions[i]))
+	}
+
+	return res, nil
+}
+
+func (g *grpcService) move(ctx context.Context, caller string, raw_amount string, idempotency_key string, m movement) (*bankpb.MovementResponse, error) {
+	amount, err := decimal.NewFromString(raw_amount)
+	if err != nil {
+		return nil, grpcError(errInvalidInput)
+	}
+	m.amount = amount
+
+	transaction_id, replayed, err := g.s.move(ctx, caller, grpcUser(ctx), idempotency_key, m)
+	// Held debits aren't failures, they execute as transaction_id once approved.
+	var held *debitHeld
+	if errors.As(err, &held) {
+		return &bankpb.MovementResponse{TransactionId: held.request.TransactionId.String(), Replayed: held.replayed, PaymentRequestId: held.request.Id.String()}, nil
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &bankpb.MovementResponse{TransactionId: transaction_id.String(), Replayed: replayed}, nil
+}
+
+func (g *grpcService) Deposit(ctx context.Context, req *bankpb.DepositRequest) (*bankpb.MovementResponse, error) {
+	return g.move(ctx, "GRPC.Deposit", req.Amount, req.IdempotencyKey, movement{
+		kind:          "deposit",
+		to_account_id: req.ToAccountId,
+	})
+}
+
+func (g *grpcService) Withdraw(ctx context.Context, req *bankpb.WithdrawRequest) (*bankpb.MovementResponse, error) {
+	return g.move(ctx, "GRPC.Withdraw", req.Amount, req.IdempotencyKey, movement{
+		kind:            "withdrawal",
+		from_account_id: req.FromAccountId,
+	})
+}
+
+func (g *grpcService) Transfer(ctx context.Context, req *bankpb.TransferRequest) (*bankpb.MovementResponse, error) {
+	return g.move(ctx, "GRPC.Transfer", req.Amount, req.IdempotencyKey, movement{
+		kind:            "transfer",
+		from_account_id: req.FromAccountId,
+		to_account_id:   req.ToAccountId,
+	})
+}
+
+/*
+WatchAccountTransactions polls the account's history every grpc_feed_interval and sends the
+transactions it hasn't seen yet. Transactions are compared by id rather than by date, since one
+committing late can be issued before another that was already sent. The caller is authenticated
+again on every poll, so revoking the API key or disabling the user ends the stream.
+*/
+func (g *grpcService) WatchAccountTransactions(req *bankpb.WatchAccountTransactionsRequest, stream bankpb.BrokeBank_WatchAccountTransactionsServer) error {
+	ctx := stream.Context()
+	if req.Backlog < 0 {
+		return grpcError(errInvalidInput)
+	}
+
+	seen, fresh, err := g.pollTransactions(ctx, req.AccountId, nil)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// Every transaction is new on the first poll, the backlog is the most recent of them.
+	fresh = fresh[max(0, len(fresh)-int(req.Backlog)):]
+
+	ticker := time.NewTicker(grpc_feed_interval)
+	defer ticker.Stop()
+
+	for {
+		for i := range fresh {
+			if err = stream.Send(newTransactionMessage(&fresh[i])); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if _, err = g.s.grpcAuthenticate(ctx); err != nil {
+			return err
+		}
+
+		if seen, fresh, err = g.pollTransactions(ctx, req.AccountId, seen); err != nil {
+			return grpcError(err)
+		}
+	}
+}
+
+/*
+pollTransactions returns the ids of the account's latest transactions, and those of them not in
+seen, oldest first. It reads further pages until reaching a seen transaction, so that a burst
+between two polls isn't missed.
+*/
+func (g *grpcService) pollTransactions(ctx context.Context, account_id string, seen map[string]bool) (map[string]bool, []model.Transaction, error) {
+	const page_size, max_pages = 100, 10
+
+	latest := map[string]bool{}
+	fresh := []model.Transaction{}
+
+	for page := 0; page < max_pages; page++ {
+		transactions, err := g.s.accountTransactions(ctx, "GRPC.WatchAccountTransactions", grpcUser(ctx), account_id, page_size, page*page_size)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		reached_seen := false
+		for _, transaction := range transactions {
+			id := transaction.Id.String()
+			latest[id] = true
+			if seen[id] {
+				reached_seen = true
+				continue
+			}
+			fresh = append(fresh, transaction)
+		}
+
+		// The first poll only needs the ids of the latest page, which aren't new to anyone.
+		if reached_seen || len(transactions) < page_size || seen == nil {
+			break
+		}
+	}
+
+	slices.Reverse(fresh)
+	return latest, fresh, nil
+}
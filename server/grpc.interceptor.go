@@ -0,0 +1,110 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"log"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ApiKeyHeader sent as gRPC metadata, whose keys are lowercase.
+var grpc_api_key_metadata = strings.ToLower(ApiKeyHeader)
+
+var grpc_request_id_metadata = strings.ToLower(RequestIdHeader)
+
+type grpcUserKey struct{}
+
+// grpcUser returns the user authenticated by the interceptors.
+func grpcUser(ctx context.Context) *model.User {
+	return ctx.Value(grpcUserKey{}).(*model.User)
+}
+
+/*
+grpcAuthenticate resolves the API key of a call to an active user, with the same rules as
+AuthMiddleware. Sessions are a browser concern, so the gRPC API only accepts API keys.
+*/
+func (s *Server) grpcAuthenticate(ctx context.Context) (*model.User, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(grpc_api_key_metadata)
+	if len(keys) != 1 || keys[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	user_id, err := s.apiKeyUserId(ctx, keys[0])
+	if err != nil {
+		log.Printf("[ERROR] [GRPCAuth] %s\n", err)
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	user, err := s.activeUser(ctx, user_id)
+	if err != nil {
+		log.Printf("[ERROR] [GRPCAuth] %s\n", err)
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+
+	return user, nil
+}
+
+/*
+grpcCallContext carries the user authenticated for a call and, like AuditMiddleware does for
+REST requests, where the call came from for the audit trail. The request id is taken from the
+x-request-id metadata.
+*/
+func grpcCallContext(ctx context.Context, user *model.User) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	actor := model.AuditActor{
+		Actor:     "user:" + user.Id.String(),
+		UserAgent: first("user-agent"),
+		RequestId: requestId(first(grpc_request_id_metadata)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		actor.Ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(actor.Ip); err == nil {
+			actor.Ip = host
+		}
+	}
+
+	return repository.WithAuditActor(context.WithValue(ctx, grpcUserKey{}, user), actor)
+}
+
+func (s *Server) grpcAuthUnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	user, err := s.grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(grpcCallContext(ctx, user), req)
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+func (s *Server) grpcAuthStreamInterceptor(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	user, err := s.grpcAuthenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &authenticatedStream{stream, grpcCallContext(stream.Context(), user)})
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"broke-bank/bankpb"
+	"broke-bank/utils"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// newGRPCClient serves the gRPC API of s in memory.
+func newGRPCClient(t *testing.T, s *Server) bankpb.BrokeBankClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := s.GRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return bankpb.NewBrokeBankClient(conn)
+}
+
+// apiKeyContext creates an API key for a registered user and returns a context sending it.
+func apiKeyContext(t *testing.T, s *Server, email string) (context.Context, uuid.UUID) {
+	t.Helper()
+
+	user, err := s.Repositories.UserRepository.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, prefix, hash, err := utils.GenerateApiKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api_key, err := s.Repositories.ApiKeyRepository.CreateApiKey(context.Background(), user.Id, "grpc", hash, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key), api_key.Id
+}
+
+func wantCode(t *testing.T, call string, err error, code codes.Code) {
+	t.Helper()
+
+	if status.Code(err) != code {
+		t.Fatalf("%s = %v, want %s", call, err, code)
+	}
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	s, router := newTestServer(t)
+	c := newGRPCClient(t, s)
+	signUp(t, router, "alice@broke.bank")
+	alice, key_id := apiKeyContext(t, s, "alice@broke.bank")
+
+	_, err := c.GetMe(context.Background(), &emptypb.Empty{})
+	wantCode(t, "GetMe without API key", err, codes.Unauthenticated)
+
+	bad := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "bb_unknown")
+	_, err = c.GetMe(bad, &emptypb.Empty{})
+	wantCode(t, "GetMe with an unknown API key", err, codes.Unauthenticated)
+
+	me, err := c.GetMe(alice, &emptypb.Empty{})
+	if err != nil || me.Email != "alice@broke.bank" {
+		t.Fatalf("GetMe = %v, %v", me, err)
+	}
+
+	if err = s.Repositories.ApiKeyRepository.RevokeApiKey(context.Background(), key_id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetMe(alice, &emptypb.Empty{})
+	wantCode(t, "GetMe with a revoked API key", err, codes.Unauthenticated)
+}
+
+/*
+TestGRPCMatchesREST runs the same operations through both APIs on the same accounts and checks
+that they agree, on results as well as on the errors of the authorization rules.
+*/
+func TestGRPCMatchesREST(t *testing.T) {
+	s, router := newTestServer(t)
+	c := newGRPCClient(t, s)
+
+	alice_rest := signUp(t, router, "alice@broke.bank")
+	bob_rest := signUp(t, router, "bob@broke.bank")
+	alice, _ := apiKeyContext(t, s, "alice@broke.bank")
+	bob, _ := apiKeyContext(t, s, "bob@broke.bank")
+	alice_rest.prefix, bob_rest.prefix = "/v2", "/v2"
+
+	if _, err := c.CreateAccount(alice, &bankpb.CreateAccountRequest{Name: "Checking"}); err != nil {
+		t.Fatal(err)
+	}
+	savings := bob_rest.createAccount("Savings")
+
+	accounts, err := c.ListAccounts(alice, &bankpb.ListAccountsRequest{})
+	if err != nil || len(accounts.Accounts) != 1 {
+		t.Fatalf("ListAccounts = %v, %v", accounts, err)
+	}
+	checking := accounts.Accounts[0].Id
+
+	deposit, err := c.Deposit(alice, &bankpb.DepositRequest{Amount: "100", ToAccountId: checking})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := alice_rest.do("POST", "/transaction/withdrawal", map[string]string{"amount": "10.00", "from_account_id": checking}); w.Code != 200 {
+		t.Fatalf("REST withdrawal = %d: %s", w.Code, w.Body)
+	}
+	transfer, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "25.50", FromAccountId: checking, ToAccountId: savings, IdempotencyKey: "rent"})
+	if err != nil || transfer.Replayed {
+		t.Fatalf("Transfer = %v, %v", transfer, err)
+	}
+
+	// Idempotency keys are shared: the REST retry of a gRPC transfer is a replay.
+	req := map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings}
+	w := alice_rest.doWithHeaders("POST", "/transaction/transfer", req, map[string]string{IdempotencyKeyHeader: "rent"})
+	if w.Code != 200 || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("REST retry of the gRPC transfer = %d with headers %v", w.Code, w.Header())
+	}
+
+	account, err := c.GetAccount(alice, &bankpb.GetAccountRequest{Id: checking})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rest_balance := alice_rest.balance(checking); account.Balance != rest_balance || account.Balance != "64.50" {
+		t.Fatalf("gRPC balance = %s, REST balance = %s, want 64.50", account.Balance, rest_balance)
+	}
+
+	history, err := c.ListAccountTransactions(alice, &bankpb.ListAccountTransactionsRequest{AccountId: checking})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest_history := decodePayload[[]GetTransactionResponse](t, alice_rest.do("GET", "/account/"+checking+"/transactions", nil))
+	if len(history.Transactions) != 3 || len(rest_history) != 3 {
+		t.Fatalf("ListAccountTransactions = %d transactions, REST = %d, want 3", len(history.Transactions), len(rest_history))
+	}
+	for i, transaction := range history.Transactions {
+		if transaction.Id != rest_history[i].Id.String() || transaction.Amount != rest_history[i].Amount || transaction.Type != rest_history[i].Type {
+			t.Fatalf("transaction %d: gRPC %v, REST %+v", i, transaction, rest_history[i])
+		}
+	}
+
+	got, err := c.GetTransaction(alice, &bankpb.GetTransactionRequest{Id: transfer.TransactionId})
+	if err != nil || got.Type != "transfer" || got.Amount != "25.50" || got.FromAccountId != checking {
+		t.Fatalf("GetTransaction = %v, %v", got, err)
+	}
+
+	// The rules reject the same requests through both APIs.
+	rejected := []struct {
+		call string
+		grpc func() error
+		code codes.Code
+		rest func() int
+	}{
+		{
+			"GetAccount of someone else's account",
+			func() error { _, err := c.GetAccount(bob, &bankpb.GetAccountRequest{Id: checking}); return err },
+			codes.PermissionDenied,
+			func() int { return bob_rest.do("GET", "/account/"+checking, nil).Code },
+		},
+		{
+			"Withdraw from someone else's account",
+			func() error {
+				_, err := c.Withdraw(bob, &bankpb.WithdrawRequest{Amount: "1", FromAccountId: checking})
+				return err
+			},
+			codes.PermissionDenied,
+			func() int {
+				return bob_rest.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1", "from_account_id": checking}).Code
+			},
+		},
+		{
+			"Transfer above the balance",
+			func() error {
+				_, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "1000", FromAccountId: checking, ToAccountId: savings})
+				return err
+			},
+			codes.FailedPrecondition,
+			func() int {
+				return alice_rest.do("POST", "/transaction/transfer", map[string]string{"amount": "1000", "from_account_id": checking, "to_account_id": savings}).Code
+			},
+		},
+		{
+			"Transfer to the same account",
+			func() error {
+				_, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "1", FromAccountId: checking, ToAccountId: checking})
+				return err
+			},
+			codes.InvalidArgument,
+			func() int {
+				return alice_rest.do("POST", "/transaction/transfer", map[string]string{"amount": "1", "from_account_id": checking, "to_account_id": checking}).Code
+			},
+		},
+		{
+			"Transfer to the same account in upper case",
+			func() error {
+				_, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "1", FromAccountId: checking, ToAccountId: strings.ToUpper(checking)})
+				return err
+			},
+			codes.InvalidArgument,
+			func() int {
+				return alice_rest.do("POST", "/transaction/transfer", map[string]string{"amount": "1", "from_account_id": checking, "to_account_id": strings.ToUpper(checking)}).Code
+			},
+		},
+		{
+			"Transfer to an unknown account",
+			func() error {
+				_, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "1", FromAccountId: checking, ToAccountId: uuid.NewString()})
+				return err
+			},
+			codes.NotFound,
+			func() int {
+				return alice_rest.do("POST", "/transaction/transfer", map[string]string{"amount": "1", "from_account_id": checking, "to_account_id": "not-an-account"}).Code
+			},
+		},
+		{
+			"Transfer to a mistyped account number",
+			func() error {
+				_, err := c.Transfer(alice, &bankpb.TransferRequest{Amount: "1", FromAccountId: checking, ToAccountId: "BRKB000000000001"})
+				return err
+			},
+			codes.InvalidArgument,
+			func() int {
+				return alice_rest.do("POST", "/transaction/transfer", map[string]string{"amount": "1", "from_account_id": checking, "to_account_id": "brkb 0000 0000 0000 01"}).Code
+			},
+		},
+		{
+			"GetTransaction of someone else's transaction",
+			func() error {
+				_, err := c.GetTransaction(bob, &bankpb.GetTransactionRequest{Id: deposit.TransactionId})
+				return err
+			},
+			codes.NotFound,
+			func() int { return bob_rest.do("GET", "/transaction/"+deposit.TransactionId, nil).Code },
+		},
+		{
+			"DisableAccount with a balance",
+			func() error {
+				_, err := c.DisableAccount(alice, &bankpb.DisableAccountRequest{Id: checking})
+				return err
+			},
+			codes.FailedPrecondition,
+			func() int { return alice_rest.do("PATCH", "/account/disable/"+checking, nil).Code },
+		},
+	}
+
+	for _, r := range rejected {
+		wantCode(t, r.call, r.grpc(), r.code)
+		if code := r.rest(); code < 400 {
+			t.Fatalf("%s = %d through REST", r.call, code)
+		}
+	}
+
+	if account, err = c.GetAccount(alice, &bankpb.GetAccountRequest{Id: checking}); err != nil || account.Balance != "64.50" {
+		t.Fatalf("balance after rejected requests = %v, %v", account, err)
+	}
+}
+
+// TestGRPCHeldDebits checks that debits held by an approval policy succeed with their payment request.
+func TestGRPCHeldDebits(t *testing.T) {
+	s, router := newTestServer(t)
+	c := newGRPCClient(t, s)
+
+	alice_rest := signUp(t, router, "alice@broke.bank")
+	bob_rest := signUp(t, router, "bob@broke.bank")
+	alice, _ := apiKeyContext(t, s, "alice@broke.bank")
+	alice_rest.prefix, bob_rest.prefix = "/v2", "/v2"
+
+	checking := alice_rest.createAccount("Checking")
+	savings := bob_rest.createAccount("Savings")
+	alice_rest.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	alice_rest.do("POST", "/account/"+checking+"/invitations", map[string]any{"email": "bob@broke.bank", "role": "owner"})
+	invitations := decodePayload[[]InvitationResponse](t, bob_rest.do("GET", "/invitations", nil))
+	bob_rest.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+	alice_rest.do("PUT", "/account/"+checking+"/approval-policy", map[string]any{"threshold": "10", "required_approvals": 1})
+
+	req := &bankpb.TransferRequest{Amount: "20", FromAccountId: checking, ToAccountId: savings, IdempotencyKey: "invoice"}
+	held, err := c.Transfer(alice, req)
+	if err != nil || held.PaymentRequestId == "" || held.Replayed {
+		t.Fatalf("Transfer over the threshold = %v, %v, want its payment request", held, err)
+	}
+	if retried, err := c.Transfer(alice, req); err != nil || !retried.Replayed || retried.PaymentRequestId != held.PaymentRequestId || retried.TransactionId != held.TransactionId {
+		t.Fatalf("retried Transfer = %v, %v, want %v replayed", retried, err, held)
+	}
+	if withdrawal, err := c.Withdraw(alice, &bankpb.WithdrawRequest{Amount: "30", FromAccountId: checking}); err != nil || withdrawal.PaymentRequestId == "" {
+		t.Fatalf("Withdraw over the threshold = %v, %v, want its payment request", withdrawal, err)
+	}
+
+	request := decodePayload[PaymentRequestResponse](t, bob_rest.do("POST", "/payment-requests/"+held.PaymentRequestId+"/approve", nil))
+	if request.Status != "executed" || request.TransactionId.String() != held.TransactionId {
+		t.Fatalf("approved payment request = %+v, want it executed as %s", request, held.TransactionId)
+	}
+	if transaction, err := c.GetTransaction(alice, &bankpb.GetTransactionRequest{Id: held.TransactionId}); err != nil || transaction.Amount != "20.00" {
+		t.Fatalf("GetTransaction of the approved transfer = %v, %v", transaction, err)
+	}
+}
+
+func TestGRPCWatchAccountTransactions(t *testing.T) {
+	interval := grpc_feed_interval
+	grpc_feed_interval = 10 * time.Millisecond
+	t.Cleanup(func() { grpc_feed_interval = interval })
+
+	s, router := newTestServer(t)
+	c := newGRPCClient(t, s)
+	signUp(t, router, "alice@broke.bank")
+	signUp(t, router, "bob@broke.bank")
+	alice, _ := apiKeyContext(t, s, "alice@broke.bank")
+	bob, _ := apiKeyContext(t, s, "bob@broke.bank")
+
+	if _, err := c.CreateAccount(alice, &bankpb.CreateAccountRequest{Name: "Checking"}); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := c.ListAccounts(alice, &bankpb.ListAccountsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checking := accounts.Accounts[0].Id
+
+	for _, amount := range []string{"1", "2"} {
+		if _, err = c.Deposit(alice, &bankpb.DepositRequest{Amount: amount, ToAccountId: checking}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(alice, 5*time.Second)
+	defer cancel()
+	stream, err := c.WatchAccountTransactions(ctx, &bankpb.WatchAccountTransactionsRequest{AccountId: checking, Backlog: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The backlog only holds the latest deposit, the following ones arrive as they're made.
+	want := []string{"2.00", "3.00", "4.00"}
+	for i, amount := range want {
+		if i > 0 {
+			if _, err = c.Deposit(alice, &bankpb.DepositRequest{Amount: amount, ToAccountId: checking}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		transaction, err := stream.Recv()
+		if err != nil || transaction.Amount != amount {
+			t.Fatalf("transaction %d = %v, %v, want amount %s", i, transaction, err, amount)
+		}
+	}
+
+	cancel()
+	if _, err = stream.Recv(); err == nil || err == io.EOF {
+		t.Fatalf("Recv after cancel = %v", err)
+	}
+
+	// Only the owner can watch an account.
+	stream, err = c.WatchAccountTransactions(bob, &bankpb.WatchAccountTransactionsRequest{AccountId: checking})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	wantCode(t, "WatchAccountTransactions of someone else's account", err, codes.NotFound)
+}
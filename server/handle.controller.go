@@ -0,0 +1,98 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type HandleResponse struct {
+	// With its @, such as @alice.
+	Handle    string    `json:"handle"`
+	AccountId uuid.UUID `json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newHandleResponse(handle *model.Handle) HandleResponse {
+	return HandleResponse{
+		Handle:    "@" + handle.Handle,
+		AccountId: handle.AccountId,
+		CreatedAt: handle.CreatedAt,
+		UpdatedAt: handle.UpdatedAt,
+	}
+}
+
+func (s *Server) GetMyHandle() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetMyHandle] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		handle, err := s.userHandle(ctx.Request.Context(), "GetMyHandle", user)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newHandleResponse(handle)})
+	}
+}
+
+type SetHandleRequest struct {
+	// 3 to 30 letters, digits or underscores starting with a letter, with or without its @, in any case.
+	Handle string `json:"handle" binding:"required"`
+	// An account the user holds, which others pay when they use the handle.
+	AccountId string `json:"account_id" binding:"required"`
+}
+
+// SetHandle gives the user a handle or changes theirs, freeing the previous one.
+func (s *Server) SetHandle() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetHandleRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetHandle] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		handle, err := s.setHandle(ctx.Request.Context(), "SetHandle", user, req.Handle, req.AccountId)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newHandleResponse(handle)})
+	}
+}
+
+func (s *Server) DeleteMyHandle() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [DeleteMyHandle] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		if err = s.deleteHandle(ctx.Request.Context(), "DeleteMyHandle", user); err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Mirrors the check constraint of handle.handle: 3 to 30 letters, digits or underscores, starting with a letter.
+var handle_pattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,29}$`)
+
+var (
+	errHandleNotFound = errors.New("Handle not found")
+	errHandleTaken    = errors.New("This handle belongs to another user")
+	errNotHolder      = errors.New("Handles can only point to accounts you hold")
+)
+
+// normalizeHandle lowercases a handle and drops its @, and isn't ok when it isn't a valid handle.
+func normalizeHandle(handle string) (string, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	return handle, handle_pattern.MatchString(handle)
+}
+
+// handleError translates the errors of the HandleStore, and logs and wraps unexpected ones as message.
+func handleError(caller string, message string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errHandleNotFound
+	case errors.Is(err, repository.ErrHandleTaken):
+		return errHandleTaken
+	}
+
+	log.Printf("[ERROR] [%s] %s: %s\n", caller, message, err)
+	return &failure{message, err}
+}
+
+/*
+resolveReceiver returns the id of the account receiver names, which is either its id, its
+account number or the handle of its holder, such as @alice. Account numbers with wrong check
+digits are errInvalidAccountNumber, and everything else that names no account is
+errReceiverNotFound.
+*/
+func (s *Server) resolveReceiver(ctx context.Context, caller string, receiver string) (string, error) {
+	receiver = strings.TrimSpace(receiver)
+
+	if strings.HasPrefix(receiver, "@") {
+		handle, ok := normalizeHandle(receiver)
+		if !ok {
+			return "", errReceiverNotFound
+		}
+
+		found, err := s.Repositories.HandleRepository.GetHandle(ctx, handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errReceiverNotFound
+		}
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get handle: %s, handle: %s\n", caller, err, handle)
+			return "", &failure{"Failed to get receiver account", err}
+		}
+
+		return found.AccountId.String(), nil
+	}
+
+	// Ids are returned in their canonical form like the ones resolved below, so that callers comparing them see one account once.
+	if id, err := uuid.Parse(receiver); err == nil {
+		return id.String(), nil
+	}
+
+	bank_code, serial, ok, err := parseAccountNumber(receiver)
+	if err != nil {
+		return "", err
+	}
+	// A mistyped id pays nobody, and neither does the number of an account at another bank.
+	if !ok || bank_code != s.bankCode() {
+		return "", errReceiverNotFound
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccountByNumber(ctx, serial)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errReceiverNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account by number: %s, account number: %s\n", caller, err, receiver)
+		return "", &failure{"Failed to get receiver account", err}
+	}
+
+	return account.Id.String(), nil
+}
+
+// accountHandle returns the handle pointing to the account, nil when there's none.
+func (s *Server) accountHandle(ctx context.Context, caller string, account *model.Account) (*model.Handle, error) {
+	handle, err := s.Repositories.HandleRepository.GetAccountHandle(ctx, account.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account handle: %s, account ID: %s\n", caller, err, account.Id)
+		return nil, &failure{"Failed to get account", err}
+	}
+
+	return handle, nil
+}
+
+func (s *Server) userHandle(ctx context.Context, caller string, user *model.User) (*model.Handle, error) {
+	handle, err := s.Repositories.HandleRepository.GetUserHandle(ctx, user.Id)
+	if err != nil {
+		return nil, handleError(caller, "Failed to get handle", err)
+	}
+
+	return handle, nil
+}
+
+/*
+setHandle gives the user a handle, or changes theirs, pointing to account_id. The account has
+to be one they hold, and that can receive money: it's the one others pay when they use it.
+*/
+func (s *Server) setHandle(ctx context.Context, caller string, user *model.User, handle string, account_id string) (*model.Handle, error) {
+	handle, ok := normalizeHandle(handle)
+	if !ok {
+		return nil, errInvalidInput
+	}
+
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+	if account.UserId != user.Id {
+		return nil, errNotHolder
+	}
+	if err = repository.CheckAccountStatus(account.Status, account.FrozenUntil, false); err != nil {
+		return nil, err
+	}
+
+	set, err := s.Repositories.HandleRepository.SetHandle(ctx, model.Handle{Handle: handle, UserId: user.Id, AccountId: account.Id})
+	if err != nil {
+		return nil, handleError(caller, "Failed to set handle", err)
+	}
+
+	return set, nil
+}
+
+// deleteHandle frees the handle of the user, which anyone can then take.
+func (s *Server) deleteHandle(ctx context.Context, caller string, user *model.User) error {
+	if err := s.Repositories.HandleRepository.DeleteHandle(ctx, user.Id); err != nil {
+		return handleError(caller, "Failed to delete handle", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAccountNumber(t *testing.T) {
+	if got := accountNumber("BRKB", 1); got != "BRKB590000000001" {
+		t.Errorf("accountNumber(BRKB, 1) = %q, want BRKB590000000001", got)
+	}
+
+	for _, serial := range []int64{1, 42, 9999999999} {
+		number := accountNumber("ABCD", serial)
+		bank_code, got, ok, err := parseAccountNumber(number)
+		if !ok || err != nil || bank_code != "ABCD" || got != serial {
+			t.Errorf("parseAccountNumber(%q) = %q, %d, %t, %v", number, bank_code, got, ok, err)
+		}
+	}
+
+	if _, serial, ok, err := parseAccountNumber(" brkb 5900 0000 0001 "); !ok || err != nil || serial != 1 {
+		t.Errorf("parsing a spaced lowercase number = %d, %t, %v", serial, ok, err)
+	}
+
+	// A mistyped digit, swapped digits and wrong check digits.
+	for _, number := range []string{"BRKB590000000002", "BRKB590000000010", "BRKB000000000001"} {
+		if _, _, ok, err := parseAccountNumber(number); !ok || !errors.Is(err, errInvalidAccountNumber) {
+			t.Errorf("parseAccountNumber(%q) = %t, %v, want errInvalidAccountNumber", number, ok, err)
+		}
+	}
+
+	for _, receiver := range []string{"", "@alice", "BRKB59000000001", "0190c5d6-0000-7000-8000-000000000000"} {
+		if _, _, ok, _ := parseAccountNumber(receiver); ok {
+			t.Errorf("parseAccountNumber(%q) is ok, want not an account number", receiver)
+		}
+	}
+}
+
+func TestHandles(t *testing.T) {
+	_, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	checking := alice.createAccount("Checking")
+	bob := signUp(t, router, "bob@broke.bank")
+	bob.prefix = "/v2"
+	rent := bob.createAccount("Rent")
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "500.00", "to_account_id": checking})
+
+	transfer := func(to string) int {
+		t.Helper()
+		return alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": to}).Code
+	}
+
+	number := decodePayload[GetAccountResponse](t, bob.do("GET", "/account/"+rent, nil)).Number
+	t.Run("accounts are paid by number", func(t *testing.T) {
+		if _, _, ok, err := parseAccountNumber(number); !ok || err != nil {
+			t.Fatalf("account number %q doesn't parse: %v", number, err)
+		}
+		if code := transfer(number); code != 200 {
+			t.Errorf("transfer to %q = %d, want 200", number, code)
+		}
+		if code := transfer(number[:len(number)-1] + "9"); code != 422 {
+			t.Errorf("transfer to a mistyped number = %d, want 422", code)
+		}
+		if code := transfer(accountNumber("ABCD", 2)); code != 404 {
+			t.Errorf("transfer to another bank = %d, want 404", code)
+		}
+
+		got := decodePayload[ConfirmPayeeResponse](t, alice.do("GET", "/confirmation-of-payee?account_id="+number, nil))
+		if got.Owner != "b***@broke.bank" {
+			t.Errorf("confirmation by number = %+v", got)
+		}
+	})
+
+	t.Run("handles point to accounts their user holds", func(t *testing.T) {
+		if w := bob.do("PUT", "/me/handle", map[string]string{"handle": "@b", "account_id": rent}); w.Code != 422 {
+			t.Errorf("setting a too short handle = %d, want 422", w.Code)
+		}
+		if w := bob.do("PUT", "/me/handle", map[string]string{"handle": "@bob", "account_id": checking}); w.Code != 404 {
+			t.Errorf("pointing a handle to someone else's account = %d, want 404", w.Code)
+		}
+
+		set := decodePayload[HandleResponse](t, bob.do("PUT", "/me/handle", map[string]string{"handle": "@Bob", "account_id": rent}))
+		if set.Handle != "@bob" || set.AccountId.String() != rent {
+			t.Errorf("PUT /me/handle = %+v", set)
+		}
+		if w := alice.do("PUT", "/me/handle", map[string]string{"handle": "bob", "account_id": checking}); w.Code != 409 {
+			t.Errorf("taking someone else's handle = %d, want 409", w.Code)
+		}
+
+		shown := decodePayload[GetAccountResponse](t, bob.do("GET", "/account/"+rent, nil))
+		if shown.Handle == nil || *shown.Handle != "@bob" || shown.Number != number {
+			t.Errorf("GET /account/%s = %+v", rent, shown)
+		}
+	})
+
+	t.Run("accounts are paid by handle", func(t *testing.T) {
+		if code := transfer("@BOB"); code != 200 {
+			t.Errorf("transfer to @BOB = %d, want 200", code)
+		}
+		if code := transfer("@carol"); code != 404 {
+			t.Errorf("transfer to an unknown handle = %d, want 404", code)
+		}
+
+		// A retry replays the first transfer even after the handle was pointed elsewhere.
+		savings := bob.createAccount("Savings")
+		req := map[string]string{"amount": "2.00", "from_account_id": checking, "to_account_id": "@bob"}
+		if w := alice.doWithHeaders("POST", "/transaction/transfer", req, map[string]string{IdempotencyKeyHeader: "gift"}); w.Code != 200 {
+			t.Fatalf("transfer to @bob = %d: %s", w.Code, w.Body)
+		}
+		bob.do("PUT", "/me/handle", map[string]string{"handle": "bob", "account_id": savings})
+		if w := alice.doWithHeaders("POST", "/transaction/transfer", req, map[string]string{IdempotencyKeyHeader: "gift"}); w.Code != 200 || w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("retry after re-pointing the handle = %d: %s", w.Code, w.Body)
+		}
+		if balance := bob.balance(savings); balance != "0.00" {
+			t.Errorf("balance of the account the handle points to now = %s, want 0.00", balance)
+		}
+
+		if w := bob.do("DELETE", "/me/handle", nil); w.Code != 200 {
+			t.Fatalf("DELETE /me/handle = %d", w.Code)
+		}
+		if code := transfer("@bob"); code != 404 {
+			t.Errorf("transfer to a deleted handle = %d, want 404", code)
+		}
+		if w := bob.do("GET", "/me/handle", nil); w.Code != 404 {
+			t.Errorf("GET /me/handle after deleting it = %d, want 404", w.Code)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"broke-bank/model"
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Transaction ids derived from idempotency keys live in their own UUID namespace.
+var idempotency_namespace = uuid.MustParse("0b7e6d0c-52c4-4d59-8f0f-6a4d9f1f3c21")
+
+var errInvalidIdempotencyKey = errors.New("Idempotency-Key must be at most 255 characters")
+
+/*
+newTransactionId returns the id of the transaction a money movement request creates. With an
+idempotency key the id is derived from the user and the key, so every retry of a request maps
+to the transaction the first attempt created, and the primary key rejects duplicates.
+*/
+func newTransactionId(user *model.User, key string) (id uuid.UUID, idempotent bool, err error) {
+	if key == "" {
+		id, err = uuid.NewV7()
+		return id, false, err
+	}
+
+	if len(key) > 255 {
+		return uuid.Nil, true, errInvalidIdempotencyKey
+	}
+
+	return uuid.NewSHA1(idempotency_namespace, []byte(user.Id.String()+":"+key)), true, nil
+}
+
+func sameAccount(stored *uuid.UUID, requested string) bool {
+	if stored == nil || requested == "" {
+		return stored == nil && requested == ""
+	}
+
+	id, err := uuid.Parse(requested)
+	return err == nil && id == *stored
+}
+
+/*
+sameReceiver reports whether the receiver of a retried transfer, as submitted, names the stored
+account. Handles can be pointed to another account between two attempts, so a handle names the
+account it resolved to on the first one: the idempotency key keeps it.
+*/
+func (s *Server) sameReceiver(ctx context.Context, caller string, stored *uuid.UUID, receiver string) (bool, error) {
+	if stored == nil {
+		return false, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(receiver), "@") {
+		return true, nil
+	}
+
+	// Ids and account numbers always name the same account.
+	resolved, err := s.resolveReceiver(ctx, caller, receiver)
+	if errors.Is(err, errReceiverNotFound) || errors.Is(err, errInvalidAccountNumber) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return sameAccount(stored, resolved), nil
+}
+
+/*
+replayMovement reports whether the transaction of a movement already exists. A retried
+idempotent request is replayed, while reusing a key for a different movement is rejected.
+*/
+func (s *Server) replayMovement(ctx context.Context, caller string, transaction_id uuid.UUID, idempotent bool, m movement) (bool, error) {
+	tx, err := s.Repositories.TransactionRepository.GetTransaction(ctx, transaction_id.String())
+	if err != nil || tx == nil {
+		return false, nil
+	}
+
+	if !idempotent {
+		log.Printf("[ERROR] [%s] duplicated transaction: %s\n", caller, transaction_id)
+		return false, errDuplicatedTransaction
+	}
+
+	same_receiver := sameAccount(tx.ToAccountId, m.to_account_id)
+	if m.kind == "transfer" {
+		if same_receiver, err = s.sameReceiver(ctx, caller, tx.ToAccountId, m.to_account_id); err != nil {
+			return false, err
+		}
+	}
+	if tx.Type != m.kind || !tx.Amount.Equal(m.amount.Round(2)) || !sameAccount(tx.FromAccountId, m.from_account_id) || !same_receiver {
+		return false, errIdempotencyKeyReused
+	}
+
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"broke-bank/repository"
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+const default_ledger_checkpoint_interval = time.Hour
+
+func ledgerCheckpointIntervalFromEnv() time.Duration {
+	raw := os.Getenv("LEDGER_CHECKPOINT_INTERVAL")
+	if raw == "" {
+		return default_ledger_checkpoint_interval
+	}
+
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		log.Fatalf("Invalid LEDGER_CHECKPOINT_INTERVAL env: %q", raw)
+	}
+
+	return interval
+}
+
+func (s *Server) ledgerCheckpointInterval() time.Duration {
+	if s.LedgerCheckpointInterval <= 0 {
+		return default_ledger_checkpoint_interval
+	}
+
+	return s.LedgerCheckpointInterval
+}
+
+/*
+RunLedgerCheckpoints signs a checkpoint of the ledger every LedgerCheckpointInterval until ctx is
+done. Every instance can run it: a checkpoint is skipped while the latest one, whoever made it,
+is more recent than the interval.
+*/
+func (s *Server) RunLedgerCheckpoints(ctx context.Context) {
+	if s.LedgerSigner == nil {
+		return
+	}
+
+	// Instances started together check again at different times.
+	ticker := time.NewTicker(s.ledgerCheckpointInterval() / 10)
+	defer ticker.Stop()
+
+	for {
+		s.checkpointLedger(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) checkpointLedger(ctx context.Context) {
+	latest, err := s.Repositories.LedgerRepository.GetLedgerCheckpoints(ctx, 1, 0)
+	if err != nil {
+		log.Printf("[ERROR] [RunLedgerCheckpoints] failed to get the latest checkpoint: %s\n", err)
+		return
+	}
+	if len(*latest) > 0 && time.Since((*latest)[0].CreatedAt) < s.ledgerCheckpointInterval() {
+		return
+	}
+
+	if _, err = repository.CreateLedgerCheckpoint(ctx, s.Repositories.LedgerRepository, s.LedgerSigner); err != nil {
+		log.Printf("[ERROR] [RunLedgerCheckpoints] failed to checkpoint the ledger: %s\n", err)
+	}
+}
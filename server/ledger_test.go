@@ -0,0 +1,47 @@
+package server
+
+import (
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestLedgerCheckpoints(t *testing.T) {
+	s, router := newTestServer(t)
+	signer, err := utils.NewSigner(bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LedgerSigner = signer
+
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+	savings := alice.createAccount("Savings")
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "40.00", "from_account_id": checking, "to_account_id": savings}); w.Code != 200 {
+		t.Fatalf("POST /transaction/transfer = %d: %s", w.Code, w.Body)
+	}
+
+	// The second run finds a checkpoint younger than the interval.
+	s.checkpointLedger(context.Background())
+	s.checkpointLedger(context.Background())
+
+	checkpoints, err := s.Repositories.LedgerRepository.GetLedgerCheckpoints(context.Background(), 10, 0)
+	if err != nil || len(*checkpoints) != 1 {
+		t.Fatalf("GetLedgerCheckpoints = %+v, %v, want one", checkpoints, err)
+	}
+	checkpoint := (*checkpoints)[0]
+	if checkpoint.Accounts != 2 || checkpoint.Links != 3 || checkpoint.KeyId != signer.KeyId {
+		t.Fatalf("checkpoint = %+v, want 2 accounts and 3 links signed by %s", checkpoint, signer.KeyId)
+	}
+	if err = repository.VerifyCheckpoint(checkpoint); err != nil {
+		t.Fatalf("VerifyCheckpoint: %s", err)
+	}
+
+	report, err := repository.VerifyLedger(context.Background(), s.Repositories.LedgerRepository, nil, *checkpoints)
+	if err != nil || report.Links != 3 || len(report.Broken) != 0 {
+		t.Fatalf("VerifyLedger = %+v, %v, want 3 intact links", report, err)
+	}
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type AccountMemberResponse struct {
+	UserId uuid.UUID `json:"user_id"`
+	// 'owner' | 'spender' | 'viewer'
+	Role string `json:"role"`
+	// Largest amount a spender can move out of the account in one transaction, null for other roles.
+	SpendLimit *string   `json:"spend_limit"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type InvitationResponse struct {
+	Id        uuid.UUID `json:"id"`
+	AccountId uuid.UUID `json:"account_id"`
+	Email     string    `json:"email"`
+	// 'owner' | 'spender' | 'viewer'
+	Role       string    `json:"role"`
+	SpendLimit *string   `json:"spend_limit"`
+	InvitedBy  uuid.UUID `json:"invited_by"`
+	// 'pending' | 'accepted' | 'declined'
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+type MemberRemovalResponse struct {
+	Id        uuid.UUID `json:"id"`
+	AccountId uuid.UUID `json:"account_id"`
+	// The member to remove.
+	UserId      uuid.UUID `json:"user_id"`
+	RequestedBy uuid.UUID `json:"requested_by"`
+	// 'pending' | 'approved' | 'rejected'
+	Status    string     `json:"status"`
+	DecidedBy *uuid.UUID `json:"decided_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+func spendLimitString(spend_limit *decimal.Decimal) *string {
+	if spend_limit == nil {
+		return nil
+	}
+
+	limit := spend_limit.StringFixed(2)
+	return &limit
+}
+
+func newInvitationResponse(invitation *model.AccountInvitation) InvitationResponse {
+	return InvitationResponse{
+		Id:         invitation.Id,
+		AccountId:  invitation.AccountId,
+		Email:      invitation.Email,
+		Role:       invitation.Role,
+		SpendLimit: spendLimitString(invitation.SpendLimit),
+		InvitedBy:  invitation.InvitedBy,
+		Status:     invitation.Status,
+		CreatedAt:  invitation.CreatedAt,
+		DecidedAt:  invitation.DecidedAt,
+	}
+}
+
+func newMemberRemovalResponse(removal *model.MemberRemoval) MemberRemovalResponse {
+	return MemberRemovalResponse{
+		Id:          removal.Id,
+		AccountId:   removal.AccountId,
+		UserId:      removal.UserId,
+		RequestedBy: removal.RequestedBy,
+		Status:      removal.Status,
+		DecidedBy:   removal.DecidedBy,
+		CreatedAt:   removal.CreatedAt,
+		DecidedAt:   removal.DecidedAt,
+	}
+}
+
+// GetAccountMembers lists the members of an account, oldest first.
+func (s *Server) GetAccountMembers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountMembers] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_members, err := s.accountMembers(ctx.Request.Context(), "GetAccountMembers", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		members := []AccountMemberResponse{}
+		for _, member := range raw_members {
+			members = append(members, AccountMemberResponse{member.UserId, member.Role, spendLimitString(member.SpendLimit), member.CreatedAt})
+		}
+
+		ctx.JSON(200, gin.H{"payload": members})
+	}
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required"`
+	// 'owner' | 'spender' | 'viewer'
+	Role string `json:"role" binding:"required"`
+	// Required for spenders, forbidden for other roles.
+	SpendLimit *decimal.Decimal `json:"spend_limit"`
+}
+
+// CreateInvitation invites whoever has an email to an account, for one of its owners.
+func (s *Server) CreateInvitation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CreateInvitationRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreateInvitation] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		invitation, err := s.inviteMember(ctx.Request.Context(), "CreateInvitation", user, ctx.Param("id"), req.Email, req.Role, req.SpendLimit)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newInvitationResponse(invitation)})
+	}
+}
+
+type GetAccountInvitationsRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// GetAccountInvitations lists the invitations to an account, newest first, for one of its owners.
+func (s *Server) GetAccountInvitations() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetAccountInvitationsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountInvitations] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_invitations, err := s.accountInvitations(ctx.Request.Context(), "GetAccountInvitations", user, ctx.Param("id"), req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		invitations := []InvitationResponse{}
+		for i := range raw_invitations {
+			invitations = append(invitations, newInvitationResponse(&raw_invitations[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": invitations})
+	}
+}
+
+// GetMyInvitations lists the pending invitations to the user's email, newest first.
+func (s *Server) GetMyInvitations() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetMyInvitations] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_invitations, err := s.pendingInvitations(ctx.Request.Context(), "GetMyInvitations", user)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		invitations := []InvitationResponse{}
+		for i := range raw_invitations {
+			invitations = append(invitations, newInvitationResponse(&raw_invitations[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": invitations})
+	}
+}
+
+func (s *Server) decideInvitationHandler(caller string, accept bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get user from context: %s\n", caller, err)
+			ctx.Status(401)
+			return
+		}
+
+		invitation, err := s.decideInvitation(ctx.Request.Context(), caller, user, ctx.Param("id"), accept)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newInvitationResponse(invitation)})
+	}
+}
+
+// AcceptInvitation makes the user a member of the account with the role they were invited for.
+func (s *Server) AcceptInvitation() gin.HandlerFunc {
+	return s.decideInvitationHandler("AcceptInvitation", true)
+}
+
+func (s *Server) DeclineInvitation() gin.HandlerFunc {
+	return s.decideInvitationHandler("DeclineInvitation", false)
+}
+
+// RequestMemberRemoval asks to remove a member, which is done at once when an owner asks to remove a non-owner.
+func (s *Server) RequestMemberRemoval() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [RequestMemberRemoval] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		removal, err := s.requestMemberRemoval(ctx.Request.Context(), "RequestMemberRemoval", user, ctx.Param("id"), ctx.Param("user_id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newMemberRemovalResponse(removal)})
+	}
+}
+
+type GetMemberRemovalsRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// GetMemberRemovals lists the removal requests of an account, newest first.
+func (s *Server) GetMemberRemovals() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetMemberRemovalsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetMemberRemovals] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_removals, err := s.memberRemovals(ctx.Request.Context(), "GetMemberRemovals", user, ctx.Param("id"), req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		removals := []MemberRemovalResponse{}
+		for i := range raw_removals {
+			removals = append(removals, newMemberRemovalResponse(&raw_removals[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": removals})
+	}
+}
+
+func (s *Server) decideMemberRemovalHandler(caller string, approve bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get user from context: %s\n", caller, err)
+			ctx.Status(401)
+			return
+		}
+
+		removal, err := s.decideMemberRemoval(ctx.Request.Context(), caller, user, ctx.Param("id"), ctx.Param("removal_id"), approve)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newMemberRemovalResponse(removal)})
+	}
+}
+
+// ApproveMemberRemoval removes the member, for an owner other than the one who asked to remove an owner.
+func (s *Server) ApproveMemberRemoval() gin.HandlerFunc {
+	return s.decideMemberRemovalHandler("ApproveMemberRemoval", true)
+}
+
+func (s *Server) RejectMemberRemoval() gin.HandlerFunc {
+	return s.decideMemberRemovalHandler("RejectMemberRemoval", false)
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const max_invitation_email_length = 254
+
+var (
+	errOwnersOnly          = errors.New("Only owners of the account can do this")
+	errViewerCantSpend     = errors.New("Viewers can't move money out of this account")
+	errOverSpendLimit      = errors.New("Amount is over your spending limit on this account")
+	errMemberNotFound      = errors.New("Member not found")
+	errInvitationNotFound  = errors.New("Invitation not found")
+	errRemovalNotFound     = errors.New("Removal request not found")
+	errAlreadyMember       = errors.New("User is already a member of this account")
+	errAlreadyInvited      = errors.New("User already has a pending invitation to this account")
+	errInvitationDecided   = errors.New("Invitation was already accepted or declined")
+	errLastOwner           = errors.New("The last owner of an account can't be removed")
+	errRemovalPending      = errors.New("Removal of this member is already pending")
+	errRemovalDecided      = errors.New("Removal request was already approved or rejected")
+	errOwnRemovalApproval  = errors.New("Another owner has to approve the removal of an owner")
+	errInvalidMemberChange = errors.New("Spenders need a positive spend limit, other roles none")
+)
+
+/*
+memberAccount returns an account the user is a member of, with their membership. Like
+ownedAccount did before accounts were shared, unknown accounts fail and accounts of others
+answer errNotAccountOwner.
+*/
+func (s *Server) memberAccount(ctx context.Context, caller string, user *model.User, account_id string) (*model.Account, *model.AccountMember, error) {
+	account, err := s.Repositories.AccountRepository.GetAccount(ctx, account_id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to get account", err}
+	}
+
+	member, err := s.Repositories.MemberRepository.GetAccountMember(ctx, account.Id, user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errNotAccountOwner
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to get account", err}
+	}
+
+	return account, member, nil
+}
+
+/*
+visibleAccount returns an account the user is a member of, with their membership, and
+errAccountNotFound for every other id so that accounts of other users can't be probed.
+*/
+func (s *Server) visibleAccount(ctx context.Context, caller string, user *model.User, account_id string) (*model.Account, *model.AccountMember, error) {
+	id, err := uuid.Parse(account_id)
+	if err != nil {
+		return nil, nil, errAccountNotFound
+	}
+
+	member, err := s.Repositories.MemberRepository.GetAccountMember(ctx, id, user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errAccountNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to get account", err}
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(ctx, account_id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to get account", err}
+	}
+
+	return account, member, nil
+}
+
+// canSpend tells whether member may move amount out of their account in one transaction.
+func canSpend(member *model.AccountMember, amount decimal.Decimal) error {
+	switch member.Role {
+	case model.MemberOwner:
+		return nil
+	case model.MemberSpender:
+		if member.SpendLimit == nil || amount.GreaterThan(*member.SpendLimit) {
+			return errOverSpendLimit
+		}
+		return nil
+	default:
+		return errViewerCantSpend
+	}
+}
+
+// memberError translates the errors of the MemberStore, and logs and wraps unexpected ones as message.
+func memberError(caller string, message string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotOwner):
+		return errOwnersOnly
+	case errors.Is(err, repository.ErrNotMember):
+		return errMemberNotFound
+	case errors.Is(err, repository.ErrAlreadyMember):
+		return errAlreadyMember
+	case errors.Is(err, repository.ErrAlreadyInvited):
+		return errAlreadyInvited
+	case errors.Is(err, repository.ErrInvitationDecided):
+		return errInvitationDecided
+	case errors.Is(err, repository.ErrLastOwner):
+		return errLastOwner
+	case errors.Is(err, repository.ErrRemovalPending):
+		return errRemovalPending
+	case errors.Is(err, repository.ErrRemovalDecided):
+		return errRemovalDecided
+	case errors.Is(err, repository.ErrOwnRemoval):
+		return errOwnRemovalApproval
+	}
+
+	log.Printf("[ERROR] [%s] %s: %s\n", caller, strings.ToLower(message), err)
+	return &failure{message, err}
+}
+
+// accountMembers lists the members of an account to any of its members, oldest first.
+func (s *Server) accountMembers(ctx context.Context, caller string, user *model.User, account_id string) ([]model.AccountMember, error) {
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.Repositories.MemberRepository.GetAccountMembers(ctx, account.Id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account members: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get account members", err}
+	}
+
+	return *members, nil
+}
+
+/*
+inviteMember invites whoever has email, signed up or not, to an account of which the user is an
+owner. Spenders get a per-transaction spend limit, other roles none.
+*/
+func (s *Server) inviteMember(ctx context.Context, caller string, user *model.User, account_id string, email string, role string, spend_limit *decimal.Decimal) (*model.AccountInvitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > max_invitation_email_length || !strings.Contains(email, "@") || !slices.Contains(model.MemberRoles, role) {
+		return nil, errInvalidInput
+	}
+	if (spend_limit != nil) != (role == model.MemberSpender) || (spend_limit != nil && (!spend_limit.IsPositive() || !spend_limit.Equal(spend_limit.Round(2)))) {
+		return nil, errInvalidMemberChange
+	}
+
+	account, member, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != model.MemberOwner {
+		return nil, errOwnersOnly
+	}
+
+	invitation, err := s.Repositories.MemberRepository.CreateInvitation(ctx, model.AccountInvitation{
+		AccountId:  account.Id,
+		Email:      email,
+		Role:       role,
+		SpendLimit: spend_limit,
+		InvitedBy:  user.Id,
+	})
+	if err != nil {
+		return nil, memberError(caller, "Failed to create invitation", err)
+	}
+
+	return invitation, nil
+}
+
+// accountInvitations lists the invitations to an account to its owners, newest first.
+func (s *Server) accountInvitations(ctx context.Context, caller string, user *model.User, account_id string, limit int, offset int) ([]model.AccountInvitation, error) {
+	if limit < 0 || offset < 0 || limit > 100 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	account, member, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != model.MemberOwner {
+		return nil, errOwnersOnly
+	}
+
+	invitations, err := s.Repositories.MemberRepository.GetAccountInvitations(ctx, account.Id, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get invitations: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get invitations", err}
+	}
+
+	return *invitations, nil
+}
+
+// pendingInvitations lists the invitations to the user's email still waiting for an answer, newest first.
+func (s *Server) pendingInvitations(ctx context.Context, caller string, user *model.User) ([]model.AccountInvitation, error) {
+	invitations, err := s.Repositories.MemberRepository.GetPendingInvitations(ctx, strings.ToLower(user.Email))
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get invitations: %s\n", caller, err)
+		return nil, &failure{"Failed to get invitations", err}
+	}
+
+	return *invitations, nil
+}
+
+/*
+decideInvitation accepts or declines an invitation to the user's email, and
+errInvitationNotFound for every other id so that invitations of others can't be probed.
+*/
+func (s *Server) decideInvitation(ctx context.Context, caller string, user *model.User, invitation_id string, accept bool) (*model.AccountInvitation, error) {
+	id, err := uuid.Parse(invitation_id)
+	if err != nil {
+		return nil, errInvitationNotFound
+	}
+
+	invitation, err := s.Repositories.MemberRepository.GetInvitation(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && invitation.Email != strings.ToLower(user.Email)) {
+		return nil, errInvitationNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get invitation: %s, invitation ID: %s\n", caller, err, invitation_id)
+		return nil, &failure{"Failed to get invitation", err}
+	}
+
+	invitation, err = s.Repositories.MemberRepository.DecideInvitation(ctx, id, user.Id, accept)
+	if err != nil {
+		return nil, memberError(caller, "Failed to decide on invitation", err)
+	}
+
+	return invitation, nil
+}
+
+/*
+requestMemberRemoval asks to remove member_id from an account. Owners may ask for anyone, other
+members only for themselves. The request of an owner approves itself, except for other owners,
+whose removal another owner has to approve.
+*/
+func (s *Server) requestMemberRemoval(ctx context.Context, caller string, user *model.User, account_id string, member_id string) (*model.MemberRemoval, error) {
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(member_id)
+	if err != nil {
+		return nil, errMemberNotFound
+	}
+
+	removal, err := s.Repositories.MemberRepository.RequestMemberRemoval(ctx, model.MemberRemoval{AccountId: account.Id, UserId: id, RequestedBy: user.Id})
+	if err != nil {
+		return nil, memberError(caller, "Failed to request member removal", err)
+	}
+
+	return removal, nil
+}
+
+// memberRemovals lists the removal requests of an account to any of its members, newest first.
+func (s *Server) memberRemovals(ctx context.Context, caller string, user *model.User, account_id string, limit int, offset int) ([]model.MemberRemoval, error) {
+	if limit < 0 || offset < 0 || limit > 100 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	removals, err := s.Repositories.MemberRepository.GetMemberRemovals(ctx, account.Id, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get member removals: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get member removals", err}
+	}
+
+	return *removals, nil
+}
+
+// decideMemberRemoval approves or rejects a removal request on behalf of an owner of the account.
+func (s *Server) decideMemberRemoval(ctx context.Context, caller string, user *model.User, account_id string, removal_id string, approve bool) (*model.MemberRemoval, error) {
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(removal_id)
+	if err != nil {
+		return nil, errRemovalNotFound
+	}
+
+	removal, err := s.Repositories.MemberRepository.GetMemberRemoval(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && removal.AccountId != account.Id) {
+		return nil, errRemovalNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get member removal: %s, removal ID: %s\n", caller, err, removal_id)
+		return nil, &failure{"Failed to get member removal", err}
+	}
+
+	removal, err = s.Repositories.MemberRepository.DecideMemberRemoval(ctx, id, user.Id, approve)
+	if err != nil {
+		return nil, memberError(caller, "Failed to decide on member removal", err)
+	}
+
+	return removal, nil
+}
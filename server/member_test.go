@@ -0,0 +1,143 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestAccountMembers(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	joint := alice.createAccount("Joint")
+	bob := signUp(t, router, "Bob@broke.bank")
+	bob.prefix = "/v2"
+	carol := signUp(t, router, "carol@broke.bank")
+	carol.prefix = "/v2"
+	dave := signUp(t, router, "dave@broke.bank")
+	dave.prefix = "/v2"
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": joint})
+
+	t.Run("owners invite with a role", func(t *testing.T) {
+		cases := []struct {
+			body map[string]any
+			want int
+		}{
+			{map[string]any{"email": "bob@broke.bank", "role": "spender"}, 422},
+			{map[string]any{"email": "bob@broke.bank", "role": "viewer", "spend_limit": "10"}, 422},
+			{map[string]any{"email": "bob@broke.bank", "role": "admin"}, 422},
+			{map[string]any{"email": "not-an-email", "role": "viewer"}, 422},
+			{map[string]any{"email": "alice@broke.bank", "role": "viewer"}, 409},
+		}
+		for _, c := range cases {
+			if w := alice.do("POST", "/account/"+joint+"/invitations", c.body); w.Code != c.want {
+				t.Errorf("inviting %v = %d, want %d: %s", c.body, w.Code, c.want, w.Body)
+			}
+		}
+		if w := dave.do("POST", "/account/"+joint+"/invitations", map[string]any{"email": "dave@broke.bank", "role": "owner"}); w.Code != 404 {
+			t.Errorf("inviting to someone else's account = %d, want 404", w.Code)
+		}
+
+		invitation := decodePayload[InvitationResponse](t, alice.do("POST", "/account/"+joint+"/invitations", map[string]any{"email": "BOB@broke.bank", "role": "spender", "spend_limit": "20"}))
+		if invitation.Email != "bob@broke.bank" || invitation.Status != "pending" || invitation.SpendLimit == nil || *invitation.SpendLimit != "20.00" {
+			t.Fatalf("POST /account/:id/invitations = %+v", invitation)
+		}
+		if w := alice.do("POST", "/account/"+joint+"/invitations", map[string]any{"email": "bob@broke.bank", "role": "viewer"}); w.Code != 409 {
+			t.Errorf("inviting twice = %d, want 409", w.Code)
+		}
+		alice.do("POST", "/account/"+joint+"/invitations", map[string]any{"email": "carol@broke.bank", "role": "viewer"})
+		if invitations := decodePayload[[]InvitationResponse](t, alice.do("GET", "/account/"+joint+"/invitations", nil)); len(invitations) != 2 {
+			t.Errorf("GET /account/:id/invitations = %+v, want both invitations", invitations)
+		}
+	})
+
+	t.Run("invitees accept their own invitations", func(t *testing.T) {
+		invitations := decodePayload[[]InvitationResponse](t, bob.do("GET", "/invitations", nil))
+		if len(invitations) != 1 || invitations[0].AccountId.String() != joint {
+			t.Fatalf("GET /invitations = %+v, want the invitation to the joint account", invitations)
+		}
+		id := invitations[0].Id.String()
+
+		if w := dave.do("POST", "/invitations/"+id+"/accept", nil); w.Code != 404 {
+			t.Errorf("accepting someone else's invitation = %d, want 404", w.Code)
+		}
+		if accepted := decodePayload[InvitationResponse](t, bob.do("POST", "/invitations/"+id+"/accept", nil)); accepted.Status != "accepted" {
+			t.Fatalf("POST /invitations/:id/accept = %+v", accepted)
+		}
+		if w := bob.do("POST", "/invitations/"+id+"/decline", nil); w.Code != 409 {
+			t.Errorf("declining an accepted invitation = %d, want 409", w.Code)
+		}
+
+		carols := decodePayload[[]InvitationResponse](t, carol.do("GET", "/invitations", nil))
+		carol.do("POST", "/invitations/"+carols[0].Id.String()+"/accept", nil)
+
+		members := decodePayload[[]AccountMemberResponse](t, bob.do("GET", "/account/"+joint+"/members", nil))
+		if len(members) != 3 || members[0].Role != "owner" || members[1].Role != "spender" || members[2].Role != "viewer" {
+			t.Fatalf("GET /account/:id/members = %+v, want the owner, spender and viewer", members)
+		}
+		accounts := decodePayload[[]GetAccountsResponse](t, bob.do("GET", "/myAccounts", nil))
+		if len(accounts) != 1 || accounts[0].Id.String() != joint {
+			t.Errorf("GET /myAccounts of a member = %+v, want the joint account", accounts)
+		}
+		if balance := carol.balance(joint); balance != "100.00" {
+			t.Errorf("balance seen by a viewer = %s, want 100.00", balance)
+		}
+	})
+
+	t.Run("roles limit what members move out", func(t *testing.T) {
+		bobs := bob.createAccount("Bob's")
+
+		if w := bob.do("POST", "/transaction/withdrawal", map[string]string{"amount": "20.00", "from_account_id": joint}); w.Code != 200 {
+			t.Errorf("withdrawing within the spend limit = %d: %s", w.Code, w.Body)
+		}
+		if w := bob.do("POST", "/transaction/transfer", map[string]string{"amount": "20.01", "from_account_id": joint, "to_account_id": bobs}); w.Code != 403 {
+			t.Errorf("transferring over the spend limit = %d, want 403", w.Code)
+		}
+		if w := carol.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1.00", "from_account_id": joint}); w.Code != 403 {
+			t.Errorf("withdrawing as a viewer = %d, want 403", w.Code)
+		}
+		if w := bob.do("POST", "/account/"+joint+"/close", map[string]string{"to_account_id": bobs}); w.Code != 403 {
+			t.Errorf("closing as a spender = %d, want 403", w.Code)
+		}
+		if w := carol.do("GET", "/account/"+joint+"/transactions", nil); w.Code != 200 {
+			t.Errorf("listing transactions as a viewer = %d: %s", w.Code, w.Body)
+		}
+		if balance := alice.balance(joint); balance != "80.00" {
+			t.Errorf("balance = %s, want 80.00", balance)
+		}
+	})
+
+	t.Run("removals need an owner", func(t *testing.T) {
+		bob_id, carol_id := getUserId(t, s, "Bob@broke.bank"), getUserId(t, s, "carol@broke.bank")
+
+		if w := bob.do("POST", "/account/"+joint+"/members/"+carol_id.String()+"/removals", nil); w.Code != 403 {
+			t.Errorf("removing another member as a spender = %d, want 403", w.Code)
+		}
+
+		removal := decodePayload[MemberRemovalResponse](t, alice.do("POST", "/account/"+joint+"/members/"+carol_id.String()+"/removals", nil))
+		if removal.Status != "approved" {
+			t.Fatalf("removing a viewer as an owner = %+v, want it approved", removal)
+		}
+		if w := carol.do("GET", "/account/"+joint+"/members", nil); w.Code != 404 {
+			t.Errorf("members of a left account = %d, want 404", w.Code)
+		}
+
+		// Members may ask to leave, which an owner approves.
+		removal = decodePayload[MemberRemovalResponse](t, bob.do("POST", "/account/"+joint+"/members/"+bob_id.String()+"/removals", nil))
+		if removal.Status != "pending" {
+			t.Fatalf("asking to leave = %+v, want it pending", removal)
+		}
+		if w := bob.do("POST", "/account/"+joint+"/removals/"+removal.Id.String()+"/approve", nil); w.Code != 403 {
+			t.Errorf("approving as a spender = %d, want 403", w.Code)
+		}
+		if approved := decodePayload[MemberRemovalResponse](t, alice.do("POST", "/account/"+joint+"/removals/"+removal.Id.String()+"/approve", nil)); approved.Status != "approved" {
+			t.Fatalf("POST /account/:id/removals/:removal_id/approve = %+v", approved)
+		}
+		if removals := decodePayload[[]MemberRemovalResponse](t, alice.do("GET", "/account/"+joint+"/removals", nil)); len(removals) != 2 {
+			t.Errorf("GET /account/:id/removals = %+v, want both removals", removals)
+		}
+		if w := bob.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1.00", "from_account_id": joint}); w.Code == 200 {
+			t.Error("a removed member withdrew from the account")
+		}
+	})
+}
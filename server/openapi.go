@@ -0,0 +1,45 @@
+package server
+
+import (
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+openapi_spec documents every route in SetupRouter. It is maintained by hand next to the
+handlers; openapi_test.go checks it against the routes, the Go request and response types and
+the responses the handlers actually send.
+*/
+//go:embed openapi.json
+var openapi_spec []byte
+
+// Swagger UI is loaded from a CDN so that the binary doesn't carry its assets.
+const docs_page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Broke Bank API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui", withCredentials: true });
+  </script>
+</body>
+</html>
+`
+
+func (s *Server) OpenAPI() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(200, "application/json", openapi_spec)
+	}
+}
+
+func (s *Server) Docs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(200, "text/html; charset=utf-8", []byte(docs_page))
+	}
+}
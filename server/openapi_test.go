@@ -0,0 +1,697 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/ratelimit"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func loadSpec(t *testing.T) map[string]any {
+	t.Helper()
+
+	spec := map[string]any{}
+	if err := json.Unmarshal(openapi_spec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %s", err)
+	}
+
+	return spec
+}
+
+func specOperations(spec map[string]any) map[string]map[string]any {
+	operations := map[string]map[string]any{}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method, operation := range item.(map[string]any) {
+			operations[strings.ToUpper(method)+" "+path] = operation.(map[string]any)
+		}
+	}
+
+	return operations
+}
+
+var path_param = regexp.MustCompile(`:(\w+)`)
+
+// legacyPath returns the /v1 path a deprecated unversioned path is an alias of.
+func legacyPath(path string) (string, bool) {
+	for _, prefix := range []string{"/v1/", "/v2/", "/health-check", "/openapi.json", "/docs"} {
+		if strings.HasPrefix(path, prefix) {
+			return path, false
+		}
+	}
+
+	return "/v1" + path, true
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	_, router := newTestServer(t)
+	operations := specOperations(loadSpec(t))
+
+	routes := map[string]bool{}
+	for _, route := range router.Routes() {
+		path, legacy := legacyPath(path_param.ReplaceAllString(route.Path, "{$1}"))
+		key := route.Method + " " + path
+		if legacy {
+			if operations[key] == nil {
+				t.Errorf("legacy route %s %s is not an alias of a /v1 route", route.Method, route.Path)
+			}
+			continue
+		}
+		routes[key] = true
+		if operations[key] == nil {
+			t.Errorf("route %s is missing from openapi.json", key)
+		}
+	}
+
+	for key := range operations {
+		if !routes[key] {
+			t.Errorf("openapi.json documents %s, which isn't routed", key)
+		}
+	}
+}
+
+func jsonFields(typ reflect.Type) []string {
+	fields := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		// Like encoding/json, the fields of embedded structs are promoted.
+		if name == "" && typ.Field(i).Anonymous {
+			fields = append(fields, jsonFields(typ.Field(i).Type)...)
+			continue
+		}
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+func TestOpenAPISchemasMatchGoTypes(t *testing.T) {
+	schemas := loadSpec(t)["components"].(map[string]any)["schemas"].(map[string]any)
+
+	types := map[string]any{
+		"RegisterRequest":                RegisterRequest{},
+		"LoginRequest":                   LoginRequest{},
+		"CloseAccountRequest":            CloseAccountRequest{},
+		"CloseAccountResponse":           CloseAccountResponse{},
+		"CreateAccountRequest":           CreateAccountRequest{},
+		"DepositTransactionRequest":      DepositTransactionRequest{},
+		"WithdrawalTransactionRequest":   WithdrawalTransactionRequest{},
+		"TransferTransactionRequest":     TransferTransactionRequest{},
+		"MeResponse":                     MeResponse{},
+		"GetAccountsResponse":            GetAccountsResponse{},
+		"GetAccountResponse":             GetAccountResponse{},
+		"Transaction":                    model.Transaction{},
+		"GetTransactionResponse":         GetTransactionResponse{},
+		"Event":                          model.Event{},
+		"BalanceChangedEvent":            BalanceChangedEvent{},
+		"AccountDisabledEvent":           AccountDisabledEvent{},
+		"AccountStatusChangedEvent":      AccountStatusChangedEvent{},
+		"CreateWebhookRequest":           CreateWebhookRequest{},
+		"WebhookResponse":                WebhookResponse{},
+		"CreateWebhookResponse":          CreateWebhookResponse{},
+		"WebhookDeliveryResponse":        WebhookDeliveryResponse{},
+		"WebhookAttemptResponse":         WebhookAttemptResponse{},
+		"GetWebhookDeliveryResponse":     GetWebhookDeliveryResponse{},
+		"WebhookPayload":                 WebhookPayload{},
+		"ProcessorEvent":                 ProcessorEvent{},
+		"ProcessorChargeData":            ProcessorChargeData{},
+		"AuditEventResponse":             AuditEventResponse{},
+		"ReceiptTransaction":             ReceiptTransaction{},
+		"ReceiptResponse":                ReceiptResponse{},
+		"VerifyReceiptRequest":           VerifyReceiptRequest{},
+		"VerifyReceiptResponse":          VerifyReceiptResponse{},
+		"ReceiptKeyResponse":             ReceiptKeyResponse{},
+		"AdminUserResponse":              AdminUserResponse{},
+		"AdminAccountResponse":           AdminAccountResponse{},
+		"AdminFreezeAccountRequest":      AdminFreezeAccountRequest{},
+		"AdminLogoutUserResponse":        AdminLogoutUserResponse{},
+		"AdminSetUserRoleRequest":        AdminSetUserRoleRequest{},
+		"AdjustmentResponse":             AdjustmentResponse{},
+		"AdjustmentDecisionResponse":     AdjustmentDecisionResponse{},
+		"GetAdjustmentResponse":          GetAdjustmentResponse{},
+		"CreateAdjustmentRequest":        CreateAdjustmentRequest{},
+		"DecideAdjustmentRequest":        DecideAdjustmentRequest{},
+		"AccountMemberResponse":          AccountMemberResponse{},
+		"CreateInvitationRequest":        CreateInvitationRequest{},
+		"InvitationResponse":             InvitationResponse{},
+		"MemberRemovalResponse":          MemberRemovalResponse{},
+		"ApprovalPolicyResponse":         ApprovalPolicyResponse{},
+		"SetApprovalPolicyRequest":       SetApprovalPolicyRequest{},
+		"PaymentRequestResponse":         PaymentRequestResponse{},
+		"PaymentRequestDecisionResponse": PaymentRequestDecisionResponse{},
+		"GetPaymentRequestResponse":      GetPaymentRequestResponse{},
+		"DecidePaymentRequestRequest":    DecidePaymentRequestRequest{},
+		"PayeeResponse":                  PayeeResponse{},
+		"CreatePayeeResponse":            CreatePayeeResponse{},
+		"CreatePayeeRequest":             CreatePayeeRequest{},
+		"RenamePayeeRequest":             RenamePayeeRequest{},
+		"ConfirmPayeeResponse":           ConfirmPayeeResponse{},
+		"HandleResponse":                 HandleResponse{},
+		"SetHandleRequest":               SetHandleRequest{},
+	}
+
+	for name, value := range types {
+		schema, ok := schemas[name].(map[string]any)
+		if !ok {
+			t.Errorf("schema %s is missing from openapi.json", name)
+			continue
+		}
+
+		properties := []string{}
+		for property := range schema["properties"].(map[string]any) {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		if fields := jsonFields(reflect.TypeOf(value)); fmt.Sprint(fields) != fmt.Sprint(properties) {
+			t.Errorf("schema %s has properties %v, but the Go type has fields %v", name, properties, fields)
+		}
+	}
+}
+
+/*
+contract validates every response a testClient receives against openapi.json and remembers
+which operations were exercised.
+*/
+type contract struct {
+	t       *testing.T
+	spec    map[string]any
+	covered map[string]bool
+}
+
+func newContract(t *testing.T) *contract {
+	return &contract{t: t, spec: loadSpec(t), covered: map[string]bool{}}
+}
+
+// operation finds the documented operation serving a request, preferring literal paths over templated ones.
+func (c *contract) operation(method string, path string) (string, map[string]any) {
+	path, _, _ = strings.Cut(path, "?")
+
+	var (
+		found_key string
+		found     map[string]any
+	)
+	for key, operation := range specOperations(c.spec) {
+		operation_method, template, _ := strings.Cut(key, " ")
+		pattern := "^" + regexp.MustCompile(`\\\{\w+\\\}`).ReplaceAllString(regexp.QuoteMeta(template), `[^/]+`) + "$"
+		if operation_method != method || !regexp.MustCompile(pattern).MatchString(path) {
+			continue
+		}
+		if found == nil || !strings.Contains(key, "{") {
+			found_key, found = key, operation
+		}
+	}
+
+	return found_key, found
+}
+
+func (c *contract) resolve(schema map[string]any) map[string]any {
+	for schema["$ref"] != nil {
+		var target any = c.spec
+		for _, part := range strings.Split(strings.TrimPrefix(schema["$ref"].(string), "#/"), "/") {
+			target = target.(map[string]any)[part]
+		}
+		schema = target.(map[string]any)
+	}
+
+	return schema
+}
+
+// validate supports the subset of OpenAPI 3.0 schemas used by openapi.json.
+func (c *contract) validate(schema map[string]any, value any, at string) error {
+	schema = c.resolve(schema)
+
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", at)
+	}
+
+	if all_of, ok := schema["allOf"].([]any); ok {
+		for _, sub_schema := range all_of {
+			if err := c.validate(sub_schema.(map[string]any), value, at); err != nil {
+				return err
+			}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		allowed := false
+		for _, option := range enum {
+			allowed = allowed || option == value
+		}
+		if !allowed {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", at, value)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		for name, property := range object {
+			property_schema, ok := properties[name].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+				continue
+			}
+			if err := c.validate(property_schema, property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", at, value)
+		}
+		for i, item := range array {
+			if err := c.validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %T", at, value)
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			return fmt.Errorf("%s: %q doesn't match %s", at, str, pattern)
+		}
+		switch schema["format"] {
+		case "uuid":
+			if _, err := uuid.Parse(str); err != nil {
+				return fmt.Errorf("%s: %q is not a uuid", at, str)
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected a number, got %T", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", at, value)
+		}
+	}
+
+	return nil
+}
+
+func (c *contract) check(method string, path string, w *httptest.ResponseRecorder) {
+	c.t.Helper()
+
+	path, legacy := legacyPath(path)
+	if legacy && (w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") == "") {
+		c.t.Errorf("legacy %s %s answered without Deprecation and Sunset headers", method, path)
+	}
+
+	key, operation := c.operation(method, path)
+	if operation == nil {
+		c.t.Errorf("%s %s is not documented", method, path)
+		return
+	}
+	c.covered[key] = true
+
+	status := fmt.Sprint(w.Code)
+	response, ok := operation["responses"].(map[string]any)[status].(map[string]any)
+	if !ok {
+		c.t.Errorf("%s: status %s is not documented (body %s)", key, status, w.Body)
+		return
+	}
+	response = c.resolve(response)
+
+	content, _ := response["content"].(map[string]any)
+	if w.Body.Len() == 0 {
+		if content != nil {
+			c.t.Errorf("%s %s: documented with a body, but the response is empty", key, status)
+		}
+		return
+	}
+
+	media, ok := content["application/json"].(map[string]any)
+	if !ok {
+		// Non JSON bodies, such as the Swagger UI page, are only checked for their content type.
+		for media_type := range content {
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), media_type) {
+				c.t.Errorf("%s %s: Content-Type %q, documented as %s", key, status, w.Header().Get("Content-Type"), media_type)
+			}
+		}
+		if content == nil {
+			c.t.Errorf("%s %s: undocumented body %s", key, status, w.Body)
+		}
+		return
+	}
+
+	var body any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		c.t.Errorf("%s %s: body is not JSON: %s", key, status, err)
+		return
+	}
+	if err := c.validate(media["schema"].(map[string]any), body, "body"); err != nil {
+		c.t.Errorf("%s %s: response drifted from openapi.json: %s", key, status, err)
+	}
+}
+
+/*
+exerciseAPI sends requests covering every operation of an API version, including the error
+responses that are easy to trigger. Responses are checked by the clients' contract.
+*/
+func exerciseAPI(t *testing.T, s *Server, spec *contract, prefix string) {
+	router := s.SetupRouter()
+	suffix := strings.ReplaceAll(prefix, "/", "")
+
+	anonymous := &testClient{t: t, router: router, contract: spec, prefix: prefix}
+	anonymous.do("POST", "/register", map[string]string{"email": "dave" + suffix + "@broke.bank"})
+	anonymous.do("GET", "/me", nil)
+
+	alice := signUp(t, router, "alice"+suffix+"@broke.bank")
+	alice.contract, alice.prefix = spec, prefix
+	bob := signUp(t, router, "bob"+suffix+"@broke.bank")
+	bob.contract, bob.prefix = spec, prefix
+
+	anonymous.do("POST", "/register", map[string]string{"email": "alice" + suffix + "@broke.bank", "password": "password123"})
+	anonymous.do("POST", "/login", map[string]string{"email": "alice" + suffix + "@broke.bank", "password": "wrong-password"})
+	anonymous.do("POST", "/login", map[string]string{"email": "alice" + suffix + "@broke.bank", "password": "password123"})
+
+	alice.do("GET", "/me", nil)
+	alice.do("POST", "/account/create", map[string]string{})
+	checking := alice.createAccount("Checking")
+	empty := alice.createAccount("Empty")
+	savings := bob.createAccount("Savings")
+	alice.do("GET", "/myAccounts?limit=1", nil)
+	alice.do("GET", "/myAccounts?limit=x", nil)
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "-1", "to_account_id": checking})
+	alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "10.00", "from_account_id": checking})
+	alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1000.00", "from_account_id": checking})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": checking})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": uuid.NewString()})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": "BRKB000000000001"})
+
+	s.Sandbox = false
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": checking})
+	s.Sandbox = true
+
+	alice.do("GET", "/account/"+checking, nil)
+	bob.do("GET", "/account/"+checking, nil)
+
+	transactions, err := s.Repositories.TransactionRepository.GetAccountTransactions(context.Background(), checking, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, transaction := range *transactions {
+		alice.do("GET", "/transaction/"+transaction.Id.String(), nil)
+	}
+	alice.do("GET", "/transaction/"+uuid.NewString(), nil)
+
+	if prefix == "/v2" {
+		alice.do("GET", "/account/"+checking+"/transactions?limit=2", nil)
+		alice.do("GET", "/account/"+checking+"/transactions?limit=x", nil)
+		bob.do("GET", "/account/"+checking+"/transactions", nil)
+
+		alice.doStreaming("/events", map[string]string{"Last-Event-ID": "0-0"}, 100*time.Millisecond)
+		alice.doStreaming("/events?last_event_id=latest", nil, 100*time.Millisecond)
+
+		// Nothing listens there, so the deliveries fail and have attempts to show.
+		alice.do("POST", "/webhooks", map[string]any{"url": "ftp://partner.example", "event_types": []string{}})
+		created := decodePayload[CreateWebhookResponse](t, alice.do("POST", "/webhooks", map[string]any{"url": "http://127.0.0.1:1/hook", "event_types": []string{EventTransactionCreated}}))
+		webhook := created.Id.String()
+		alice.do("GET", "/webhooks", nil)
+		s.processWebhooks(context.Background())
+
+		deliveries := decodePayload[[]WebhookDeliveryResponse](t, alice.do("GET", "/webhooks/"+webhook+"/deliveries?limit=1", nil))
+		if len(deliveries) != 1 {
+			t.Fatalf("GET /webhooks/%s/deliveries = %+v, want a delivery", webhook, deliveries)
+		}
+		delivery := deliveries[0].Id.String()
+		alice.do("GET", "/webhooks/"+webhook+"/deliveries?limit=x", nil)
+		bob.do("GET", "/webhooks/"+webhook+"/deliveries", nil)
+		alice.do("GET", "/webhooks/"+webhook+"/deliveries/"+delivery, nil)
+		bob.do("GET", "/webhooks/"+webhook+"/deliveries/"+delivery, nil)
+		alice.do("POST", "/webhooks/"+webhook+"/deliveries/"+delivery+"/redeliver", nil)
+		alice.do("POST", "/webhooks/"+webhook+"/deliveries/"+uuid.NewString()+"/redeliver", nil)
+		bob.do("DELETE", "/webhooks/"+webhook, nil)
+		alice.do("DELETE", "/webhooks/"+webhook, nil)
+
+		charge := ProcessorEvent{Id: "evt_contract", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_contract", Amount: decimal.RequireFromString("5.00"), AccountId: checking}}
+		s.ProcessorSecret = ""
+		sendProcessorEvent(anonymous, "whsec_processor", charge)
+		s.ProcessorSecret = "whsec_processor"
+		sendProcessorEvent(anonymous, "whsec_processor", charge)
+		sendProcessorEvent(anonymous, "whsec_forged", charge)
+		charge.Data.Amount = decimal.RequireFromString("-5.00")
+		sendProcessorEvent(anonymous, "whsec_processor", charge)
+
+		alice.do("GET", "/audit-events?limit=5&action=transaction.transfer&since=2026-01-01T00:00:00Z", nil)
+		alice.do("GET", "/audit-events?since=yesterday", nil)
+
+		transaction_id := (*transactions)[0].Id.String()
+		signer := s.Receipts.Signer
+		s.Receipts.Signer = nil
+		alice.do("GET", "/transaction/"+transaction_id+"/receipt", nil)
+		s.Receipts.Signer = signer
+		receipt := decodePayload[ReceiptResponse](t, alice.do("GET", "/transaction/"+transaction_id+"/receipt", nil))
+		bob.do("GET", "/transaction/"+transaction_id+"/receipt", nil)
+		anonymous.do("POST", "/receipts/verify", VerifyReceiptRequest{Transaction: receipt.Transaction, KeyId: receipt.KeyId, Signature: receipt.Signature})
+		anonymous.do("POST", "/receipts/verify", map[string]string{"key_id": receipt.KeyId})
+		anonymous.do("GET", "/receipts/keys", nil)
+
+		closing := alice.createAccount("Closing")
+		alice.do("POST", "/transaction/deposit", map[string]string{"amount": "5.00", "to_account_id": closing})
+		alice.do("POST", "/account/"+closing+"/close", map[string]string{})
+		alice.do("POST", "/account/"+closing+"/close", map[string]string{"to_account_id": savings})
+		alice.do("POST", "/account/"+closing+"/close", map[string]string{"to_account_id": checking})
+		alice.do("POST", "/account/"+closing+"/close", map[string]string{"to_account_id": checking})
+		alice.do("POST", "/account/"+closing+"/reopen", nil)
+		alice.do("POST", "/account/"+closing+"/reopen", nil)
+		bob.do("POST", "/account/"+closing+"/reopen", nil)
+
+		alice.do("POST", "/account/"+checking+"/invitations", map[string]any{"email": "bob" + suffix + "@broke.bank", "role": "spender"})
+		alice.do("POST", "/account/"+checking+"/invitations", map[string]any{"email": "alice" + suffix + "@broke.bank", "role": "viewer"})
+		bob.do("POST", "/account/"+checking+"/invitations", map[string]any{"email": "bob" + suffix + "@broke.bank", "role": "owner"})
+		alice.do("POST", "/account/"+checking+"/invitations", map[string]any{"email": "bob" + suffix + "@broke.bank", "role": "spender", "spend_limit": "5.00"})
+		alice.do("GET", "/account/"+checking+"/invitations?limit=1", nil)
+		alice.do("GET", "/account/"+checking+"/invitations?limit=x", nil)
+		invitations := decodePayload[[]InvitationResponse](t, bob.do("GET", "/invitations", nil))
+		if len(invitations) != 1 {
+			t.Fatalf("GET /invitations = %+v, want an invitation", invitations)
+		}
+		invitation := invitations[0].Id.String()
+		alice.do("POST", "/invitations/"+invitation+"/accept", nil)
+		bob.do("POST", "/invitations/"+invitation+"/accept", nil)
+		bob.do("POST", "/invitations/"+invitation+"/decline", nil)
+		bob.do("GET", "/account/"+checking+"/invitations", nil)
+		bob.do("GET", "/account/"+checking+"/members", nil)
+		anonymous.do("GET", "/account/"+checking+"/members", nil)
+		bob.do("POST", "/transaction/withdrawal", map[string]string{"amount": "6.00", "from_account_id": checking})
+		bob.do("POST", "/transaction/transfer", map[string]string{"amount": "6.00", "from_account_id": checking, "to_account_id": savings})
+		bob.do("PATCH", "/account/disable/"+checking, nil)
+		bob.do("POST", "/account/"+checking+"/close", map[string]string{"to_account_id": savings})
+		bob.do("POST", "/account/"+checking+"/reopen", nil)
+
+		owner_id, spender_id := getUserId(t, s, "alice"+suffix+"@broke.bank"), getUserId(t, s, "bob"+suffix+"@broke.bank")
+		bob.do("POST", "/account/"+checking+"/members/"+owner_id.String()+"/removals", nil)
+		alice.do("POST", "/account/"+checking+"/members/"+owner_id.String()+"/removals", nil)
+		alice.do("POST", "/account/"+checking+"/members/"+uuid.NewString()+"/removals", nil)
+		removal := decodePayload[MemberRemovalResponse](t, bob.do("POST", "/account/"+checking+"/members/"+spender_id.String()+"/removals", nil))
+		bob.do("POST", "/account/"+checking+"/members/"+spender_id.String()+"/removals", nil)
+		bob.do("GET", "/account/"+checking+"/removals?limit=1", nil)
+		bob.do("GET", "/account/"+checking+"/removals?limit=x", nil)
+		bob.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/approve", nil)
+		alice.do("POST", "/account/"+checking+"/removals/"+uuid.NewString()+"/approve", nil)
+		alice.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/reject", nil)
+		alice.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/approve", nil)
+		alice.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/reject", nil)
+		removal = decodePayload[MemberRemovalResponse](t, bob.do("POST", "/account/"+checking+"/members/"+spender_id.String()+"/removals", nil))
+		alice.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/approve", nil)
+		bob.do("POST", "/account/"+checking+"/removals/"+removal.Id.String()+"/reject", nil)
+
+		business := alice.createAccount("Business")
+		alice.do("POST", "/transaction/deposit", map[string]string{"amount": "20.00", "to_account_id": business})
+		alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "1.00", "required_approvals": 1})
+		alice.do("POST", "/account/"+business+"/invitations", map[string]any{"email": "bob" + suffix + "@broke.bank", "role": "owner"})
+		invitations = decodePayload[[]InvitationResponse](t, bob.do("GET", "/invitations", nil))
+		bob.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+		alice.do("GET", "/account/"+business+"/approval-policy", nil)
+		alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "-1", "required_approvals": 1})
+		alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "1.00", "required_approvals": 1})
+		bob.do("GET", "/account/"+business+"/approval-policy", nil)
+		anonymous.do("GET", "/account/"+business+"/approval-policy", nil)
+
+		request := decodePayload[PaymentRequestResponse](t, alice.do("POST", "/transaction/transfer", map[string]string{"amount": "5.00", "from_account_id": business, "to_account_id": savings}))
+		rejected := decodePayload[PaymentRequestResponse](t, alice.do("POST", "/transaction/transfer", map[string]string{"amount": "6.00", "from_account_id": business, "to_account_id": savings}))
+		alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "3.00", "from_account_id": business})
+		alice.do("POST", "/account/"+business+"/close", map[string]string{"to_account_id": checking})
+		alice.do("GET", "/account/"+business+"/payment-requests?status=pending&limit=1", nil)
+		alice.do("GET", "/account/"+business+"/payment-requests?status=paid", nil)
+		alice.do("GET", "/account/"+business+"/payment-requests?limit=x", nil)
+		alice.do("GET", "/payment-requests/"+request.Id.String(), nil)
+		alice.do("GET", "/payment-requests/"+uuid.NewString(), nil)
+		alice.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", map[string]string{"comment": "Invoice checked"})
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", map[string]any{"comment": 1})
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/reject", nil)
+		bob.do("POST", "/payment-requests/"+uuid.NewString()+"/reject", nil)
+		alice.do("POST", "/payment-requests/"+rejected.Id.String()+"/reject", nil)
+		bob.do("POST", "/payment-requests/"+rejected.Id.String()+"/reject", nil)
+		bob.do("GET", "/payment-requests/"+request.Id.String(), nil)
+		bob.do("DELETE", "/account/"+checking+"/approval-policy", nil)
+		bob.do("DELETE", "/account/"+business+"/approval-policy", nil)
+		bob.do("DELETE", "/account/"+business+"/approval-policy", nil)
+
+		alice.do("GET", "/confirmation-of-payee?account_id="+savings+"&email=bob"+suffix+"@broke.bank", nil)
+		alice.do("GET", "/confirmation-of-payee?account_id="+uuid.NewString(), nil)
+		alice.do("GET", "/confirmation-of-payee", nil)
+		payee := decodePayload[CreatePayeeResponse](t, alice.do("POST", "/payees", map[string]string{"account_id": savings, "nickname": "Bob"}))
+		alice.do("POST", "/payees", map[string]string{"account_id": savings, "nickname": "Bobby"})
+		alice.do("POST", "/payees", map[string]string{"account_id": business, "nickname": "Mine"})
+		alice.do("POST", "/payees", map[string]string{"account_id": uuid.NewString(), "nickname": "Nobody"})
+		alice.do("GET", "/payees?limit=1", nil)
+		alice.do("GET", "/payees?limit=x", nil)
+		alice.do("GET", "/payees/"+payee.Id.String(), nil)
+		bob.do("GET", "/payees/"+payee.Id.String(), nil)
+		alice.do("PATCH", "/payees/"+payee.Id.String(), map[string]string{"nickname": "Bob B."})
+		alice.do("PATCH", "/payees/"+payee.Id.String(), map[string]string{"nickname": ""})
+		alice.do("PATCH", "/payees/"+uuid.NewString(), map[string]string{"nickname": "Bob"})
+		s.PayeeCoolingOffLimit = decimal.RequireFromString("1.00")
+		alice.do("POST", "/transaction/transfer", map[string]string{"amount": "2.00", "from_account_id": business, "to_account_id": savings})
+		s.PayeeCoolingOffLimit = decimal.Zero
+		alice.do("DELETE", "/payees/"+payee.Id.String(), nil)
+		alice.do("DELETE", "/payees/"+payee.Id.String(), nil)
+
+		bob.do("GET", "/me/handle", nil)
+		bob.do("PUT", "/me/handle", map[string]string{"handle": "@Bob", "account_id": savings})
+		bob.do("PUT", "/me/handle", map[string]string{"handle": "@b", "account_id": savings})
+		bob.do("PUT", "/me/handle", map[string]string{"handle": "bob", "account_id": business})
+		alice.do("PUT", "/me/handle", map[string]string{"handle": "bob", "account_id": checking})
+		alice.do("PUT", "/me/handle", map[string]string{"handle": "alice", "account_id": savings})
+		bob.do("GET", "/me/handle", nil)
+		number := decodePayload[GetAccountResponse](t, bob.do("GET", "/account/"+savings, nil)).Number
+		alice.do("GET", "/confirmation-of-payee?account_id="+number, nil)
+		alice.do("GET", "/confirmation-of-payee?account_id=BRKB000000000001", nil)
+		alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": "@bob"})
+		bob.do("DELETE", "/me/handle", nil)
+		bob.do("DELETE", "/me/handle", nil)
+
+		admin := signUp(t, router, "admin"+suffix+"@broke.bank")
+		admin.contract, admin.prefix = spec, prefix
+		grantRole(t, s, "admin"+suffix+"@broke.bank", model.RoleAdmin)
+		reason := map[string]string{AdminReasonHeader: "Contract test"}
+		alice_id := getUserId(t, s, "alice"+suffix+"@broke.bank").String()
+
+		alice.doWithHeaders("GET", "/admin/users?q=alice", nil, reason)
+		admin.do("GET", "/admin/users?q=alice", nil)
+		admin.doWithHeaders("GET", "/admin/users?q=alice&limit=1", nil, reason)
+		admin.doWithHeaders("GET", "/admin/users?q=alice&limit=-1", nil, reason)
+		admin.doWithHeaders("GET", "/admin/users/"+alice_id, nil, reason)
+		admin.doWithHeaders("GET", "/admin/users/"+uuid.NewString(), nil, reason)
+		admin.doWithHeaders("GET", "/admin/users/"+alice_id+"/accounts", nil, reason)
+		admin.doWithHeaders("GET", "/admin/users/"+alice_id+"/accounts?limit=x", nil, reason)
+		admin.doWithHeaders("GET", "/admin/users/"+uuid.NewString()+"/accounts", nil, reason)
+		admin.doWithHeaders("GET", "/admin/accounts/"+savings, nil, reason)
+		admin.doWithHeaders("GET", "/admin/accounts/"+uuid.NewString(), nil, reason)
+		admin.doWithHeaders("GET", "/admin/accounts/"+checking+"/transactions?limit=2", nil, reason)
+		admin.doWithHeaders("GET", "/admin/accounts/"+checking+"/transactions?limit=x", nil, reason)
+		admin.doWithHeaders("GET", "/admin/accounts/"+uuid.NewString()+"/transactions", nil, reason)
+		freeze := map[string]string{"status": model.AccountFrozenAll, "status_reason": "other"}
+		admin.doWithHeaders("POST", "/admin/accounts/"+savings+"/unfreeze", nil, reason)
+		admin.doWithHeaders("POST", "/admin/accounts/"+savings+"/freeze", map[string]string{"status": model.AccountFrozenAll, "status_reason": "bored"}, reason)
+		admin.doWithHeaders("POST", "/admin/accounts/"+savings+"/freeze", freeze, reason)
+		admin.doWithHeaders("POST", "/admin/accounts/"+savings+"/freeze", freeze, reason)
+		admin.doWithHeaders("POST", "/admin/accounts/"+uuid.NewString()+"/freeze", freeze, reason)
+		alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "1.00", "from_account_id": savings})
+		admin.doWithHeaders("POST", "/admin/accounts/"+savings+"/unfreeze", nil, reason)
+		admin.doWithHeaders("POST", "/admin/accounts/"+uuid.NewString()+"/unfreeze", nil, reason)
+		admin.doWithHeaders("PUT", "/admin/users/"+alice_id+"/role", map[string]string{"role": "root"}, reason)
+		admin.doWithHeaders("PUT", "/admin/users/"+uuid.NewString()+"/role", map[string]string{"role": model.RoleSupport}, reason)
+		admin.doWithHeaders("PUT", "/admin/users/"+alice_id+"/role", map[string]string{"role": model.RoleSupport}, reason)
+		admin.doWithHeaders("PUT", "/admin/users/"+alice_id+"/role", map[string]string{"role": model.RoleCustomer}, reason)
+		admin.doWithHeaders("POST", "/admin/users/"+uuid.NewString()+"/logout", nil, reason)
+		admin.doWithHeaders("POST", "/admin/users/"+getUserId(t, s, "bob"+suffix+"@broke.bank").String()+"/logout", nil, reason)
+
+		checker := signUp(t, router, "checker"+suffix+"@broke.bank")
+		checker.contract, checker.prefix = spec, prefix
+		grantRole(t, s, "checker"+suffix+"@broke.bank", model.RoleCompliance)
+		admin.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "0", "reason": "Typo", "evidence": "Ticket #1"}, reason)
+		admin.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": uuid.NewString(), "amount": "1.00", "reason": "Typo", "evidence": "Ticket #1"}, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "1.00", "reason": "Typo", "evidence": "Ticket #1"}, reason)
+		credit := decodePayload[AdjustmentResponse](t, admin.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "1.00", "reason": "Typo", "evidence": "Ticket #1"}, reason))
+		overdraft := decodePayload[AdjustmentResponse](t, admin.doWithHeaders("POST", "/admin/adjustments", map[string]string{"account_id": checking, "amount": "-900.00", "reason": "Typo", "evidence": "Ticket #2"}, reason))
+		admin.doWithHeaders("GET", "/admin/adjustments?status=pending&account_id="+checking, nil, reason)
+		admin.doWithHeaders("GET", "/admin/adjustments?status=done", nil, reason)
+		admin.doWithHeaders("POST", "/admin/adjustments/"+credit.Id.String()+"/approve", nil, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+uuid.NewString()+"/approve", nil, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+credit.Id.String()+"/approve", map[string]any{"comment": 1}, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+credit.Id.String()+"/approve", map[string]string{"comment": "Checked"}, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+credit.Id.String()+"/reject", nil, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+overdraft.Id.String()+"/approve", nil, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+uuid.NewString()+"/reject", nil, reason)
+		admin.doWithHeaders("POST", "/admin/adjustments/"+overdraft.Id.String()+"/reject", map[string]any{"comment": 1}, reason)
+		admin.doWithHeaders("POST", "/admin/adjustments/"+overdraft.Id.String()+"/reject", nil, reason)
+		checker.doWithHeaders("POST", "/admin/adjustments/"+overdraft.Id.String()+"/reject", nil, reason)
+		admin.doWithHeaders("GET", "/admin/adjustments/"+credit.Id.String(), nil, reason)
+		admin.doWithHeaders("GET", "/admin/adjustments/"+uuid.NewString(), nil, reason)
+	}
+
+	alice.do("PATCH", "/account/disable/"+checking, nil)
+	alice.do("PATCH", "/account/disable/"+empty, nil)
+
+	limiter, limits := s.Limiter, s.RateLimits
+	s.Limiter = ratelimit.NewMemoryLimiter()
+	s.RateLimits = ratelimit.Config{ratelimit.GroupDefault: {ratelimit.ScopeUser: {Requests: 1, Window: time.Minute}}}
+	alice.do("GET", "/me", nil)
+	alice.do("GET", "/me", nil)
+	s.Limiter, s.RateLimits = limiter, limits
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	s, router := newTestServer(t)
+	spec := newContract(t)
+
+	anonymous := &testClient{t: t, router: router, contract: spec}
+	anonymous.do("GET", "/health-check", nil)
+	anonymous.do("GET", "/openapi.json", nil)
+	anonymous.do("GET", "/docs", nil)
+
+	// The unversioned aliases are checked against the /v1 operations.
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		exerciseAPI(t, s, spec, prefix)
+	}
+
+	for key := range specOperations(spec.spec) {
+		if !spec.covered[key] {
+			t.Errorf("%s is not exercised by the contract test", key)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PayeeResponse struct {
+	Id        uuid.UUID `json:"id"`
+	AccountId uuid.UUID `json:"account_id"`
+	Nickname  string    `json:"nickname"`
+	// Transfers to the payee are limited until then, see PAYEE_COOLING_OFF_LIMIT.
+	CoolingOffUntil time.Time `json:"cooling_off_until"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (s *Server) newPayeeResponse(payee *model.Payee) PayeeResponse {
+	return PayeeResponse{
+		Id:              payee.Id,
+		AccountId:       payee.AccountId,
+		Nickname:        payee.Nickname,
+		CoolingOffUntil: s.coolingOffUntil(payee),
+		CreatedAt:       payee.CreatedAt,
+		UpdatedAt:       payee.UpdatedAt,
+	}
+}
+
+type CreatePayeeResponse struct {
+	PayeeResponse
+	// Masked email of the account owner, to check the account is the intended one.
+	Owner string `json:"owner"`
+}
+
+type ConfirmPayeeResponse struct {
+	AccountId uuid.UUID `json:"account_id"`
+	// Masked email of the account owner, such as a***e@broke.bank.
+	Owner string `json:"owner"`
+	// Whether the owner has the email given, null when none was.
+	EmailMatches *bool `json:"email_matches"`
+	// Whether the account can be transferred to now.
+	CanReceive bool `json:"can_receive"`
+}
+
+type ConfirmPayeeRequest struct {
+	// Id, account number or handle of the account, like the receiver of a transfer.
+	AccountId string `form:"account_id" binding:"required"`
+	// Email the user expects the owner to have, compared ignoring case.
+	Email string `form:"email"`
+}
+
+/*
+ConfirmPayee is the confirmation-of-payee lookup: it shows who owns an account without revealing
+their email, before any money is sent to it.
+*/
+func (s *Server) ConfirmPayee() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := ConfirmPayeeRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		account, owner, err := s.confirmPayee(ctx.Request.Context(), "ConfirmPayee", req.AccountId)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		res := ConfirmPayeeResponse{
+			AccountId:  account.Id,
+			Owner:      maskEmail(owner.Email),
+			CanReceive: repository.CheckAccountStatus(account.Status, account.FrozenUntil, false) == nil,
+		}
+		if email := strings.TrimSpace(req.Email); email != "" {
+			matches := strings.EqualFold(email, owner.Email)
+			res.EmailMatches = &matches
+		}
+
+		ctx.JSON(200, gin.H{"payload": res})
+	}
+}
+
+type CreatePayeeRequest struct {
+	// Id, account number or handle of the account, like the receiver of a transfer.
+	AccountId string `json:"account_id" binding:"required"`
+	Nickname  string `json:"nickname" binding:"required"`
+}
+
+// CreatePayee saves an account for the user under a nickname, which starts its cooling-off period.
+func (s *Server) CreatePayee() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CreatePayeeRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreatePayee] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		payee, owner, err := s.createPayee(ctx.Request.Context(), "CreatePayee", user, req.AccountId, req.Nickname)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": CreatePayeeResponse{PayeeResponse: s.newPayeeResponse(payee), Owner: maskEmail(owner.Email)}})
+	}
+}
+
+type GetPayeesRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// GetPayees lists the user's payees by nickname.
+func (s *Server) GetPayees() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetPayeesRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetPayees] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_payees, err := s.userPayees(ctx.Request.Context(), "GetPayees", user, req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		payees := []PayeeResponse{}
+		for i := range raw_payees {
+			payees = append(payees, s.newPayeeResponse(&raw_payees[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": payees})
+	}
+}
+
+func (s *Server) GetPayee() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetPayee] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		payee, err := s.ownedPayee(ctx.Request.Context(), "GetPayee", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": s.newPayeeResponse(payee)})
+	}
+}
+
+type RenamePayeeRequest struct {
+	Nickname string `json:"nickname" binding:"required"`
+}
+
+// RenamePayee changes the nickname of one of the user's payees, which doesn't restart its cooling-off period.
+func (s *Server) RenamePayee() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := RenamePayeeRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [RenamePayee] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		payee, err := s.renamePayee(ctx.Request.Context(), "RenamePayee", user, ctx.Param("id"), req.Nickname)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": s.newPayeeResponse(payee)})
+	}
+}
+
+func (s *Server) DeletePayee() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [DeletePayee] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		if err = s.deletePayee(ctx.Request.Context(), "DeletePayee", user, ctx.Param("id")); err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	default_payee_cooling_off = 24 * time.Hour
+	max_payee_nickname_length = 50
+)
+
+var default_payee_cooling_off_limit = decimal.RequireFromString("100.00")
+
+var (
+	errPayeeNotFound       = errors.New("Payee not found")
+	errPayeeExists         = errors.New("This account is already one of your payees")
+	errNicknameTaken       = errors.New("Another of your payees has this nickname")
+	errOwnAccountPayee     = errors.New("Accounts you're a member of can't be saved as payees")
+	errReceiverNotFound    = errors.New("Receiver account not found")
+	errOverCoolingOffLimit = errors.New("Amount is over the limit of transfers to accounts that aren't established payees")
+)
+
+func payeeCoolingOffFromEnv() time.Duration {
+	raw := os.Getenv("PAYEE_COOLING_OFF")
+	if raw == "" {
+		return default_payee_cooling_off
+	}
+
+	cooling_off, err := time.ParseDuration(raw)
+	if err != nil || cooling_off <= 0 {
+		log.Fatalf("Invalid PAYEE_COOLING_OFF env: %q", raw)
+	}
+
+	return cooling_off
+}
+
+func payeeCoolingOffLimitFromEnv() decimal.Decimal {
+	raw := os.Getenv("PAYEE_COOLING_OFF_LIMIT")
+	if raw == "" {
+		return default_payee_cooling_off_limit
+	}
+
+	limit, err := decimal.NewFromString(raw)
+	if err != nil || !limit.IsPositive() {
+		log.Fatalf("Invalid PAYEE_COOLING_OFF_LIMIT env: %q", raw)
+	}
+
+	return limit
+}
+
+func (s *Server) payeeCoolingOff() time.Duration {
+	if s.PayeeCoolingOff <= 0 {
+		return default_payee_cooling_off
+	}
+
+	return s.PayeeCoolingOff
+}
+
+func (s *Server) payeeCoolingOffLimit() decimal.Decimal {
+	if !s.PayeeCoolingOffLimit.IsPositive() {
+		return default_payee_cooling_off_limit
+	}
+
+	return s.PayeeCoolingOffLimit
+}
+
+// coolingOffUntil is when transfers to payee stop being limited.
+func (s *Server) coolingOffUntil(payee *model.Payee) time.Time {
+	return payee.CreatedAt.Add(s.payeeCoolingOff())
+}
+
+/*
+checkCoolingOff limits the transfers of a user to receiver_id unless it's an established payee:
+one they saved longer than the cooling-off period ago. Whoever takes over a session can then
+neither add their own account nor send to it unsaved, and empty the user's at once. Deleting a
+payee brings its limit back. Accounts the user is a member of aren't limited.
+*/
+func (s *Server) checkCoolingOff(ctx context.Context, caller string, user_id uuid.UUID, receiver_id uuid.UUID, amount decimal.Decimal) error {
+	if !amount.GreaterThan(s.payeeCoolingOffLimit()) {
+		return nil
+	}
+
+	_, err := s.Repositories.MemberRepository.GetAccountMember(ctx, receiver_id, user_id)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, receiver_id)
+		return &failure{"Failed to complete transfer transaction", err}
+	}
+
+	payee, err := s.Repositories.PayeeRepository.GetPayeeByAccount(ctx, user_id, receiver_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errOverCoolingOffLimit
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get payee: %s, account ID: %s\n", caller, err, receiver_id)
+		return &failure{"Failed to complete transfer transaction", err}
+	}
+
+	if time.Now().Before(s.coolingOffUntil(payee)) {
+		return errOverCoolingOffLimit
+	}
+
+	return nil
+}
+
+// maskEmail keeps enough of an email for its owner to be recognized, and not enough to learn it: a***e@broke.bank.
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+
+	runes := []rune(local)
+	masked := "***"
+	if len(runes) > 0 {
+		masked = string(runes[0]) + masked
+	}
+	if len(runes) > 3 {
+		masked += string(runes[len(runes)-1])
+	}
+	if found {
+		masked += "@" + domain
+	}
+
+	return masked
+}
+
+func validNickname(nickname string) bool {
+	return nickname != "" && utf8.RuneCountInString(nickname) <= max_payee_nickname_length
+}
+
+// payeeError translates the errors of the PayeeStore, and logs and wraps unexpected ones as message.
+func payeeError(caller string, message string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errPayeeNotFound
+	case errors.Is(err, repository.ErrPayeeExists):
+		return errPayeeExists
+	case errors.Is(err, repository.ErrNicknameTaken):
+		return errNicknameTaken
+	}
+
+	log.Printf("[ERROR] [%s] %s: %s\n", caller, message, err)
+	return &failure{message, err}
+}
+
+/*
+confirmPayee looks up the account a user is about to pay, with its owner, so that they can
+check it's the one they meant before sending anything. The account is named like the receiver
+of a transfer, see resolveReceiver, and unknown ones are errAccountNotFound.
+*/
+func (s *Server) confirmPayee(ctx context.Context, caller string, receiver string) (*model.Account, *model.User, error) {
+	account_id, err := s.resolveReceiver(ctx, caller, receiver)
+	if errors.Is(err, errReceiverNotFound) {
+		return nil, nil, errAccountNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(ctx, account_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errAccountNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to confirm payee", err}
+	}
+
+	owner, err := s.Repositories.UserRepository.GetUserById(ctx, account.UserId)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account owner: %s, account ID: %s\n", caller, err, account_id)
+		return nil, nil, &failure{"Failed to confirm payee", err}
+	}
+
+	return account, owner, nil
+}
+
+// ownedPayee returns one of the user's payees, and errPayeeNotFound for every other id.
+func (s *Server) ownedPayee(ctx context.Context, caller string, user *model.User, payee_id string) (*model.Payee, error) {
+	id, err := uuid.Parse(payee_id)
+	if err != nil {
+		return nil, errPayeeNotFound
+	}
+
+	payee, err := s.Repositories.PayeeRepository.GetPayee(ctx, id)
+	if err == nil && payee.UserId != user.Id {
+		return nil, errPayeeNotFound
+	}
+	if err != nil {
+		return nil, payeeError(caller, "Failed to get payee", err)
+	}
+
+	return payee, nil
+}
+
+// createPayee saves an account for the user, returning its owner as confirmPayee does.
+func (s *Server) createPayee(ctx context.Context, caller string, user *model.User, account_id string, nickname string) (*model.Payee, *model.User, error) {
+	nickname = strings.TrimSpace(nickname)
+	if !validNickname(nickname) {
+		return nil, nil, errInvalidInput
+	}
+
+	account, owner, err := s.confirmPayee(ctx, caller, account_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = s.Repositories.MemberRepository.GetAccountMember(ctx, account.Id, user.Id)
+	if err == nil {
+		return nil, nil, errOwnAccountPayee
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, account.Id)
+		return nil, nil, &failure{"Failed to create payee", err}
+	}
+
+	payee, err := s.Repositories.PayeeRepository.CreatePayee(ctx, model.Payee{UserId: user.Id, AccountId: account.Id, Nickname: nickname})
+	if err != nil {
+		return nil, nil, payeeError(caller, "Failed to create payee", err)
+	}
+
+	return payee, owner, nil
+}
+
+// userPayees lists the user's payees by nickname.
+func (s *Server) userPayees(ctx context.Context, caller string, user *model.User, limit int, offset int) ([]model.Payee, error) {
+	if limit < 0 || offset < 0 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	payees, err := s.Repositories.PayeeRepository.GetUserPayees(ctx, user.Id, limit, offset)
+	if err != nil {
+		return nil, payeeError(caller, "Failed to get payees", err)
+	}
+
+	return *payees, nil
+}
+
+// renamePayee changes the nickname of a payee, without restarting its cooling-off period.
+func (s *Server) renamePayee(ctx context.Context, caller string, user *model.User, payee_id string, nickname string) (*model.Payee, error) {
+	nickname = strings.TrimSpace(nickname)
+	if !validNickname(nickname) {
+		return nil, errInvalidInput
+	}
+
+	payee, err := s.ownedPayee(ctx, caller, user, payee_id)
+	if err != nil {
+		return nil, err
+	}
+
+	renamed, err := s.Repositories.PayeeRepository.RenamePayee(ctx, payee.Id, nickname)
+	if err != nil {
+		return nil, payeeError(caller, "Failed to rename payee", err)
+	}
+
+	return renamed, nil
+}
+
+// deletePayee forgets a payee. Saving its account again starts a new cooling-off period.
+func (s *Server) deletePayee(ctx context.Context, caller string, user *model.User, payee_id string) error {
+	payee, err := s.ownedPayee(ctx, caller, user, payee_id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Repositories.PayeeRepository.DeletePayee(ctx, payee.Id); err != nil {
+		return payeeError(caller, "Failed to delete payee", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestMaskEmail(t *testing.T) {
+	for email, want := range map[string]string{
+		"alice@broke.bank": "a***e@broke.bank",
+		"bob@broke.bank":   "b***@broke.bank",
+		"@broke.bank":      "***@broke.bank",
+		"émilie@broke.fr":  "é***e@broke.fr",
+	} {
+		if got := maskEmail(email); got != want {
+			t.Errorf("maskEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
+
+func TestPayees(t *testing.T) {
+	s, router := newTestServer(t)
+	s.PayeeCoolingOffLimit = decimal.RequireFromString("50.00")
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	checking := alice.createAccount("Checking")
+	bob := signUp(t, router, "bob@broke.bank")
+	bob.prefix = "/v2"
+	rent := bob.createAccount("Rent")
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "500.00", "to_account_id": checking})
+
+	transfer := func(amount string) int {
+		t.Helper()
+		return alice.do("POST", "/transaction/transfer", map[string]string{"amount": amount, "from_account_id": checking, "to_account_id": rent}).Code
+	}
+
+	t.Run("mistyped receivers are not found", func(t *testing.T) {
+		for _, to := range []string{uuid.NewString(), rent[:len(rent)-1]} {
+			if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": to}); w.Code != 404 {
+				t.Errorf("transfer to %q = %d, want 404", to, w.Code)
+			}
+		}
+	})
+
+	t.Run("payees are confirmed before being paid", func(t *testing.T) {
+		got := decodePayload[ConfirmPayeeResponse](t, alice.do("GET", "/confirmation-of-payee?account_id="+rent+"&email=BOB@broke.bank", nil))
+		if got.Owner != "b***@broke.bank" || got.EmailMatches == nil || !*got.EmailMatches || !got.CanReceive {
+			t.Errorf("confirmation of the right email = %+v", got)
+		}
+		got = decodePayload[ConfirmPayeeResponse](t, alice.do("GET", "/confirmation-of-payee?account_id="+rent+"&email=carol@broke.bank", nil))
+		if got.EmailMatches == nil || *got.EmailMatches {
+			t.Errorf("confirmation of another email = %+v, want no match", got)
+		}
+		if w := alice.do("GET", "/confirmation-of-payee?account_id="+uuid.NewString(), nil); w.Code != 404 {
+			t.Errorf("confirmation of an unknown account = %d, want 404", w.Code)
+		}
+	})
+
+	var payee CreatePayeeResponse
+	t.Run("payees are saved once under a nickname", func(t *testing.T) {
+		if w := alice.do("POST", "/payees", map[string]string{"account_id": checking, "nickname": "Me"}); w.Code != 422 {
+			t.Errorf("saving one's own account = %d, want 422", w.Code)
+		}
+
+		payee = decodePayload[CreatePayeeResponse](t, alice.do("POST", "/payees", map[string]string{"account_id": rent, "nickname": "  Landlord "}))
+		if payee.Nickname != "Landlord" || payee.Owner != "b***@broke.bank" || !payee.CoolingOffUntil.Equal(payee.CreatedAt.Add(24*time.Hour)) {
+			t.Fatalf("POST /payees = %+v", payee)
+		}
+		if w := alice.do("POST", "/payees", map[string]string{"account_id": rent, "nickname": "Rent"}); w.Code != 409 {
+			t.Errorf("saving an account twice = %d, want 409", w.Code)
+		}
+		if w := bob.do("GET", "/payees/"+payee.Id.String(), nil); w.Code != 404 {
+			t.Errorf("getting someone else's payee = %d, want 404", w.Code)
+		}
+
+		renamed := decodePayload[PayeeResponse](t, alice.do("PATCH", "/payees/"+payee.Id.String(), map[string]string{"nickname": "Bob's rent"}))
+		if renamed.Nickname != "Bob's rent" || !renamed.CoolingOffUntil.Equal(payee.CoolingOffUntil) {
+			t.Errorf("PATCH /payees/:id = %+v, want the same cooling-off period", renamed)
+		}
+		if payees := decodePayload[[]PayeeResponse](t, alice.do("GET", "/payees", nil)); len(payees) != 1 || payees[0].Id != payee.Id {
+			t.Errorf("GET /payees = %+v", payees)
+		}
+	})
+
+	t.Run("new payees are paid up to the cooling-off limit", func(t *testing.T) {
+		if code := transfer("50.01"); code != 403 {
+			t.Errorf("transfer over the limit = %d, want 403", code)
+		}
+		if code := transfer("50.00"); code != 200 {
+			t.Errorf("transfer at the limit = %d, want 200", code)
+		}
+
+		s.PayeeCoolingOff = time.Nanosecond
+		defer func() { s.PayeeCoolingOff = 0 }()
+		if code := transfer("200.00"); code != 200 {
+			t.Errorf("transfer after the cooling-off period = %d, want 200", code)
+		}
+	})
+
+	t.Run("accounts that aren't payees are paid up to the cooling-off limit", func(t *testing.T) {
+		other := bob.createAccount("Other")
+		if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "50.01", "from_account_id": checking, "to_account_id": other}); w.Code != 403 {
+			t.Errorf("transfer over the limit to an account that isn't a payee = %d, want 403", w.Code)
+		}
+
+		savings := alice.createAccount("Savings")
+		if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "100.00", "from_account_id": checking, "to_account_id": savings}); w.Code != 200 {
+			t.Errorf("transfer to one's own account = %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("saving a deleted payee again starts over", func(t *testing.T) {
+		if w := alice.do("DELETE", "/payees/"+payee.Id.String(), nil); w.Code != 200 {
+			t.Fatalf("DELETE /payees/:id = %d: %s", w.Code, w.Body)
+		}
+		if code := transfer("60.00"); code != 403 {
+			t.Errorf("transfer over the limit to an account that isn't a payee anymore = %d, want 403", code)
+		}
+		if code := transfer("50.00"); code != 200 {
+			t.Errorf("transfer at the limit to an account that isn't a payee = %d, want 200", code)
+		}
+
+		alice.do("POST", "/payees", map[string]string{"account_id": rent, "nickname": "Landlord"})
+		if code := transfer("60.00"); code != 403 {
+			t.Errorf("transfer over the limit to a payee saved again = %d, want 403", code)
+		}
+	})
+}
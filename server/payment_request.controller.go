@@ -0,0 +1,274 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type ApprovalPolicyResponse struct {
+	AccountId uuid.UUID `json:"account_id"`
+	// Withdrawals, transfers and closures debiting more than this amount out of the account need approvals.
+	Threshold string `json:"threshold"`
+	// Approvals of owners other than the requester a held debit needs.
+	RequiredApprovals int       `json:"required_approvals"`
+	UpdatedBy         uuid.UUID `json:"updated_by"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func newApprovalPolicyResponse(policy *model.ApprovalPolicy) ApprovalPolicyResponse {
+	return ApprovalPolicyResponse{
+		AccountId:         policy.AccountId,
+		Threshold:         policy.Threshold.StringFixed(2),
+		RequiredApprovals: policy.RequiredApprovals,
+		UpdatedBy:         policy.UpdatedBy,
+		CreatedAt:         policy.CreatedAt,
+		UpdatedAt:         policy.UpdatedAt,
+	}
+}
+
+type PaymentRequestResponse struct {
+	Id uuid.UUID `json:"id"`
+	// 'transfer' | 'withdrawal' | 'closure'
+	Kind string `json:"kind"`
+	// Id of the movement once executed.
+	TransactionId uuid.UUID `json:"transaction_id"`
+	FromAccountId uuid.UUID `json:"from_account_id"`
+	// Null for withdrawals, the account closures sweep the balance to.
+	ToAccountId       *uuid.UUID `json:"to_account_id"`
+	Amount            string     `json:"amount"`
+	RequestedBy       uuid.UUID  `json:"requested_by"`
+	RequiredApprovals int        `json:"required_approvals"`
+	// 'pending' | 'approved' | 'executed' | 'failed' | 'rejected' | 'expired'
+	Status string `json:"status"`
+	// 'insufficient_balance' | 'account_frozen' | 'account_closed' | 'account_overdrawn' | 'balance_changed' |
+	// 'requester_removed' | 'requester_not_owner' | 'over_spend_limit' | 'cooling_off', set when failed.
+	FailureReason *string   `json:"failure_reason"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newPaymentRequestResponse(request *model.PaymentRequest) PaymentRequestResponse {
+	return PaymentRequestResponse{
+		Id:                request.Id,
+		Kind:              request.Kind,
+		TransactionId:     request.TransactionId,
+		FromAccountId:     request.FromAccountId,
+		ToAccountId:       request.ToAccountId,
+		Amount:            request.Amount.StringFixed(2),
+		RequestedBy:       request.RequestedBy,
+		RequiredApprovals: request.RequiredApprovals,
+		Status:            request.Status,
+		FailureReason:     request.FailureReason,
+		ExpiresAt:         request.ExpiresAt,
+		CreatedAt:         request.CreatedAt,
+		UpdatedAt:         request.UpdatedAt,
+	}
+}
+
+// respondHeld answers with the payment request holding a debit, and reports whether err was one.
+func respondHeld(ctx *gin.Context, err error) bool {
+	var held *debitHeld
+	if !errors.As(err, &held) {
+		return false
+	}
+
+	if held.replayed {
+		ctx.Header("Idempotent-Replayed", "true")
+	}
+	ctx.JSON(202, gin.H{"payload": newPaymentRequestResponse(held.request)})
+	return true
+}
+
+type PaymentRequestDecisionResponse struct {
+	Id     uuid.UUID `json:"id"`
+	UserId uuid.UUID `json:"user_id"`
+	// 'approved' | 'rejected'
+	Decision  string    `json:"decision"`
+	Comment   *string   `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GetPaymentRequestResponse struct {
+	PaymentRequestResponse
+	// Oldest first.
+	Decisions []PaymentRequestDecisionResponse `json:"decisions"`
+}
+
+// GetApprovalPolicy returns the approval policy of an account, for any of its members.
+func (s *Server) GetApprovalPolicy() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetApprovalPolicy] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		policy, err := s.approvalPolicy(ctx.Request.Context(), "GetApprovalPolicy", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newApprovalPolicyResponse(policy)})
+	}
+}
+
+type SetApprovalPolicyRequest struct {
+	Threshold         decimal.Decimal `json:"threshold" binding:"required"`
+	RequiredApprovals int             `json:"required_approvals" binding:"required"`
+}
+
+// SetApprovalPolicy creates or replaces the approval policy of an account, for one of its owners.
+func (s *Server) SetApprovalPolicy() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetApprovalPolicyRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetApprovalPolicy] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		policy, err := s.setApprovalPolicy(ctx.Request.Context(), "SetApprovalPolicy", user, ctx.Param("id"), req.Threshold, req.RequiredApprovals)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newApprovalPolicyResponse(policy)})
+	}
+}
+
+// DeleteApprovalPolicy stops holding debits, pending requests still need their approvals.
+func (s *Server) DeleteApprovalPolicy() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [DeleteApprovalPolicy] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		if err = s.deleteApprovalPolicy(ctx.Request.Context(), "DeleteApprovalPolicy", user, ctx.Param("id")); err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+type GetPaymentRequestsRequest struct {
+	Status string `form:"status"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// GetPaymentRequests lists the payment requests out of an account, newest first.
+func (s *Server) GetPaymentRequests() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetPaymentRequestsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetPaymentRequests] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		raw_requests, err := s.accountPaymentRequests(ctx.Request.Context(), "GetPaymentRequests", user, ctx.Param("id"), req.Status, req.Limit, req.Offset)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		requests := []PaymentRequestResponse{}
+		for i := range raw_requests {
+			requests = append(requests, newPaymentRequestResponse(&raw_requests[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": requests})
+	}
+}
+
+// GetPaymentRequest returns a payment request with the decisions of the owners on it.
+func (s *Server) GetPaymentRequest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetPaymentRequest] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		request, decisions, err := s.visiblePaymentRequest(ctx.Request.Context(), "GetPaymentRequest", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		res := GetPaymentRequestResponse{PaymentRequestResponse: newPaymentRequestResponse(request), Decisions: []PaymentRequestDecisionResponse{}}
+		for _, decision := range decisions {
+			res.Decisions = append(res.Decisions, PaymentRequestDecisionResponse{decision.Id, decision.UserId, decision.Decision, decision.Comment, decision.CreatedAt})
+		}
+
+		ctx.JSON(200, gin.H{"payload": res})
+	}
+}
+
+type DecidePaymentRequestRequest struct {
+	Comment *string `json:"comment"`
+}
+
+func (s *Server) decidePaymentRequestHandler(caller string, decision string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := DecidePaymentRequestRequest{}
+		if ctx.Request.ContentLength != 0 && ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get user from context: %s\n", caller, err)
+			ctx.Status(401)
+			return
+		}
+
+		request, err := s.decidePaymentRequest(ctx.Request.Context(), caller, user, ctx.Param("id"), decision, req.Comment)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": newPaymentRequestResponse(request)})
+	}
+}
+
+// ApprovePaymentRequest executes the debit when it's the last approval it required.
+func (s *Server) ApprovePaymentRequest() gin.HandlerFunc {
+	return s.decidePaymentRequestHandler("ApprovePaymentRequest", "approved")
+}
+
+func (s *Server) RejectPaymentRequest() gin.HandlerFunc {
+	return s.decidePaymentRequestHandler("RejectPaymentRequest", "rejected")
+}
@@ -0,0 +1,529 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	default_payment_request_ttl = 72 * time.Hour
+	payment_request_interval    = time.Minute
+	// Approved requests executed per run, the rest wait for the next one.
+	payment_request_batch_size = 50
+)
+
+var (
+	errPolicyNotFound         = errors.New("Approval policy not found")
+	errPaymentRequestNotFound = errors.New("Payment request not found")
+	errPaymentRequestDecided  = errors.New("Payment request isn't pending anymore")
+	errPaymentRequestExpired  = errors.New("Payment request expired")
+	errPaymentRequestTwice    = errors.New("You already decided on this payment request")
+	errOwnPaymentRequest      = errors.New("Another owner has to decide on your payment request")
+	errTooManyApprovals       = errors.New("Required approvals can't exceed the owners of the account but one")
+)
+
+/*
+debitHeld is returned for withdrawals, transfers and closures held by the approval policy of
+their account, with the payment request holding them. It's no failure: the debit executes once
+approved.
+*/
+type debitHeld struct {
+	request  *model.PaymentRequest
+	replayed bool
+}
+
+func (h *debitHeld) Error() string {
+	return "Debit is pending approval as payment request " + h.request.Id.String()
+}
+
+func paymentRequestTTLFromEnv() time.Duration {
+	raw := os.Getenv("PAYMENT_REQUEST_TTL")
+	if raw == "" {
+		return default_payment_request_ttl
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		log.Fatalf("Invalid PAYMENT_REQUEST_TTL env: %q", raw)
+	}
+
+	return ttl
+}
+
+func (s *Server) paymentRequestTTL() time.Duration {
+	if s.PaymentRequestTTL <= 0 {
+		return default_payment_request_ttl
+	}
+
+	return s.PaymentRequestTTL
+}
+
+// paymentRequestError translates the errors of the PaymentRequestStore, and logs and wraps unexpected ones as message.
+func paymentRequestError(caller string, message string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errPaymentRequestNotFound
+	case errors.Is(err, repository.ErrRequestDecided):
+		return errPaymentRequestDecided
+	case errors.Is(err, repository.ErrRequestExpired):
+		return errPaymentRequestExpired
+	case errors.Is(err, repository.ErrOwnRequest):
+		return errOwnPaymentRequest
+	case errors.Is(err, repository.ErrRequestTwice):
+		return errPaymentRequestTwice
+	case errors.Is(err, repository.ErrNotOwner):
+		return errOwnersOnly
+	}
+
+	log.Printf("[ERROR] [%s] %s: %s\n", caller, message, err)
+	return &failure{message, err}
+}
+
+func (s *Server) approvalPolicy(ctx context.Context, caller string, user *model.User, account_id string) (*model.ApprovalPolicy, error) {
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := s.Repositories.PaymentRequestRepository.GetApprovalPolicy(ctx, account.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errPolicyNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get approval policy: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get approval policy", err}
+	}
+
+	return policy, nil
+}
+
+/*
+setApprovalPolicy holds the debits of more than threshold out of an account of which the user
+is an owner until required_approvals other owners approve them. Requests already pending keep
+the approvals they were submitted with.
+*/
+func (s *Server) setApprovalPolicy(ctx context.Context, caller string, user *model.User, account_id string, threshold decimal.Decimal, required_approvals int) (*model.ApprovalPolicy, error) {
+	if threshold.IsNegative() || !threshold.Equal(threshold.Round(2)) || required_approvals <= 0 {
+		return nil, errInvalidInput
+	}
+
+	account, member, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != model.MemberOwner {
+		return nil, errOwnersOnly
+	}
+
+	members, err := s.Repositories.MemberRepository.GetAccountMembers(ctx, account.Id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account members: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to set approval policy", err}
+	}
+
+	// Owners don't approve their own requests, so quorum must be reachable without one of them.
+	owners := 0
+	for _, member := range *members {
+		if member.Role == model.MemberOwner {
+			owners++
+		}
+	}
+	if required_approvals > owners-1 {
+		return nil, errTooManyApprovals
+	}
+
+	policy, err := s.Repositories.PaymentRequestRepository.SetApprovalPolicy(ctx, model.ApprovalPolicy{
+		AccountId:         account.Id,
+		Threshold:         threshold,
+		RequiredApprovals: required_approvals,
+		UpdatedBy:         user.Id,
+	})
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to set approval policy: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to set approval policy", err}
+	}
+
+	return policy, nil
+}
+
+func (s *Server) deleteApprovalPolicy(ctx context.Context, caller string, user *model.User, account_id string) error {
+	account, member, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return err
+	}
+	if member.Role != model.MemberOwner {
+		return errOwnersOnly
+	}
+
+	err = s.Repositories.PaymentRequestRepository.DeleteApprovalPolicy(ctx, account.Id, user.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errPolicyNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to delete approval policy: %s, account ID: %s\n", caller, err, account_id)
+		return &failure{"Failed to delete approval policy", err}
+	}
+
+	return nil
+}
+
+/*
+holdingPolicy returns the approval policy of an account when it holds a debit of amount out of
+it, and nil when the debit can execute right away.
+*/
+func (s *Server) holdingPolicy(ctx context.Context, caller string, account_id uuid.UUID, amount decimal.Decimal) (*model.ApprovalPolicy, error) {
+	policy, err := s.Repositories.PaymentRequestRepository.GetApprovalPolicy(ctx, account_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get approval policy: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get approval policy", err}
+	}
+	if !amount.GreaterThan(policy.Threshold) {
+		return nil, nil
+	}
+
+	return policy, nil
+}
+
+// submitPaymentRequest holds request for the approvals policy requires.
+func (s *Server) submitPaymentRequest(ctx context.Context, policy *model.ApprovalPolicy, request model.PaymentRequest) (*model.PaymentRequest, error) {
+	request.RequiredApprovals = policy.RequiredApprovals
+	request.ExpiresAt = time.Now().Add(s.paymentRequestTTL())
+
+	return s.Repositories.PaymentRequestRepository.CreatePaymentRequest(ctx, request)
+}
+
+/*
+holdDebit submits the withdrawal or transfer m as a payment request when the approval policy of
+its account holds it, and answers with nil otherwise. A retried submission finds the request of
+the first one.
+*/
+func (s *Server) holdDebit(ctx context.Context, caller string, user *model.User, transaction_id uuid.UUID, m movement) error {
+	from_account_id, err := uuid.Parse(m.from_account_id)
+	if err != nil {
+		return errInvalidInput
+	}
+
+	policy, err := s.holdingPolicy(ctx, caller, from_account_id, m.amount)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	var to_account_id *uuid.UUID
+	if m.kind == "transfer" {
+		id, err := uuid.Parse(m.to_account_id)
+		if err != nil {
+			return errInvalidInput
+		}
+		to_account_id = &id
+	}
+
+	request, err := s.submitPaymentRequest(ctx, policy, model.PaymentRequest{
+		Kind:          m.kind,
+		TransactionId: transaction_id,
+		FromAccountId: from_account_id,
+		ToAccountId:   to_account_id,
+		Amount:        m.amount,
+		RequestedBy:   user.Id,
+	})
+	if err != nil {
+		// A concurrent retry of the same idempotent request may have submitted it first.
+		if replay_err := s.replayPaymentRequest(ctx, caller, transaction_id, m); replay_err != nil {
+			return replay_err
+		}
+		log.Printf("[ERROR] [%s] failed to create payment request: %s, account ID: %s\n", caller, err, m.from_account_id)
+		return &failure{"Failed to complete " + m.kind + " transaction", err}
+	}
+
+	return &debitHeld{request: request}
+}
+
+/*
+replayPaymentRequest answers a retried withdrawal or transfer that was held with its payment
+request, as a replayed debitHeld, and with nil when it wasn't held.
+*/
+func (s *Server) replayPaymentRequest(ctx context.Context, caller string, transaction_id uuid.UUID, m movement) error {
+	request, err := s.Repositories.PaymentRequestRepository.GetPaymentRequestByTransaction(ctx, transaction_id)
+	if err != nil {
+		return nil
+	}
+
+	same_receiver := request.ToAccountId == nil && m.to_account_id == ""
+	if m.kind == "transfer" {
+		if same_receiver, err = s.sameReceiver(ctx, caller, request.ToAccountId, m.to_account_id); err != nil {
+			return err
+		}
+	}
+	if request.Kind != m.kind || !request.Amount.Equal(m.amount.Round(2)) || !sameAccount(&request.FromAccountId, m.from_account_id) || !same_receiver {
+		return errIdempotencyKeyReused
+	}
+
+	return &debitHeld{request: request, replayed: true}
+}
+
+// visiblePaymentRequest returns a request out of an account the user is a member of, with its decisions.
+func (s *Server) visiblePaymentRequest(ctx context.Context, caller string, user *model.User, request_id string) (*model.PaymentRequest, []model.PaymentRequestDecision, error) {
+	id, err := uuid.Parse(request_id)
+	if err != nil {
+		return nil, nil, errPaymentRequestNotFound
+	}
+
+	request, err := s.Repositories.PaymentRequestRepository.GetPaymentRequest(ctx, id)
+	if err != nil {
+		return nil, nil, paymentRequestError(caller, "Failed to get payment request", err)
+	}
+
+	if _, err = s.Repositories.MemberRepository.GetAccountMember(ctx, request.FromAccountId, user.Id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, errPaymentRequestNotFound
+		}
+		log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, request.FromAccountId)
+		return nil, nil, &failure{"Failed to get payment request", err}
+	}
+
+	decisions, err := s.Repositories.PaymentRequestRepository.GetPaymentRequestDecisions(ctx, id)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get payment request decisions: %s, payment request ID: %s\n", caller, err, request_id)
+		return nil, nil, &failure{"Failed to get payment request", err}
+	}
+
+	return request, *decisions, nil
+}
+
+func (s *Server) accountPaymentRequests(ctx context.Context, caller string, user *model.User, account_id string, status string, limit int, offset int) ([]model.PaymentRequest, error) {
+	switch status {
+	case "", "pending", "approved", "executed", "failed", "rejected", "expired":
+	default:
+		return nil, errInvalidInput
+	}
+	if limit < 0 || offset < 0 || limit > 100 {
+		return nil, errInvalidInput
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	account, _, err := s.visibleAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := s.Repositories.PaymentRequestRepository.GetPaymentRequests(ctx, account.Id, status, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get payment requests: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get payment requests", err}
+	}
+
+	return *requests, nil
+}
+
+/*
+decidePaymentRequest approves or rejects a payment request on behalf of an owner of its account
+other than its requester. The approval reaching quorum executes the transfer right away, and
+the background job retries it when that fails for a transient reason.
+*/
+func (s *Server) decidePaymentRequest(ctx context.Context, caller string, user *model.User, request_id string, decision string, comment *string) (*model.PaymentRequest, error) {
+	if comment != nil && len(*comment) > max_adjustment_text_length {
+		return nil, errInvalidInput
+	}
+
+	request, _, err := s.visiblePaymentRequest(ctx, caller, user, request_id)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err = s.Repositories.PaymentRequestRepository.DecidePaymentRequest(ctx, model.PaymentRequestDecision{
+		PaymentRequestId: request.Id,
+		UserId:           user.Id,
+		Decision:         decision,
+		Comment:          comment,
+	})
+	if err != nil {
+		return nil, paymentRequestError(caller, "Failed to decide on payment request", err)
+	}
+
+	if request.Status == "approved" {
+		if executed := s.executePaymentRequest(ctx, caller, request); executed != nil {
+			request = executed
+		}
+	}
+
+	return request, nil
+}
+
+var (
+	// errBalanceChanged fails closures whose account holds more than was approved when they execute.
+	errBalanceChanged = errors.New("balance changed")
+	// errRequesterRemoved fails requests whose requester isn't a member of the account anymore.
+	errRequesterRemoved = errors.New("requester removed")
+)
+
+/*
+checkRequester checks again, once approved, what was checked of the requester when they
+submitted the request: that they're still a member allowed to move its amount, an owner for
+closures, and that the receiver of a transfer is still one of theirs or an established payee
+when over the cooling-off limit.
+Approvals don't lift these limits, they only add to them.
+*/
+func (s *Server) checkRequester(ctx context.Context, caller string, request *model.PaymentRequest) error {
+	member, err := s.Repositories.MemberRepository.GetAccountMember(ctx, request.FromAccountId, request.RequestedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errRequesterRemoved
+	}
+	if err != nil {
+		return err
+	}
+
+	switch request.Kind {
+	case "closure":
+		if member.Role != model.MemberOwner {
+			return errOwnersOnly
+		}
+		return nil
+	case "transfer":
+		if err = canSpend(member, request.Amount); err != nil {
+			return err
+		}
+		return s.checkCoolingOff(ctx, caller, request.RequestedBy, *request.ToAccountId, request.Amount)
+	default:
+		return canSpend(member, request.Amount)
+	}
+}
+
+// executeDebit moves the money of an approved request as its kind of movement.
+func (s *Server) executeDebit(ctx context.Context, request *model.PaymentRequest) (closed *model.Account, err error) {
+	switch request.Kind {
+	case "withdrawal":
+		return nil, s.Repositories.TransactionRepository.WithdrawalTransaction(ctx, request.TransactionId, request.FromAccountId.String(), request.Amount)
+	case "closure":
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx, request.FromAccountId.String())
+		if err != nil {
+			return nil, err
+		}
+		// The sweep moves the whole balance, which owners approved up to the amount of the request.
+		if account.Balance.GreaterThan(request.Amount) {
+			return nil, errBalanceChanged
+		}
+		closed, _, err = s.Repositories.AccountRepository.CloseAccount(ctx, request.TransactionId, request.FromAccountId.String(), request.ToAccountId.String())
+		return closed, err
+	default:
+		return nil, s.Repositories.TransactionRepository.TransferTransaction(ctx, request.TransactionId, request.FromAccountId.String(), request.ToAccountId.String(), request.Amount)
+	}
+}
+
+/*
+executePaymentRequest moves the money of an approved request with its transaction id, so that
+it moves once however many times it runs, and completes the request, failing it when its
+requester can't move the money anymore. It answers with nil when the request stays approved, to
+be retried.
+*/
+func (s *Server) executePaymentRequest(ctx context.Context, caller string, request *model.PaymentRequest) *model.PaymentRequest {
+	var closed *model.Account
+
+	// An earlier run may have moved the money and failed to complete the request.
+	executed, err := s.Repositories.TransactionRepository.GetTransaction(ctx, request.TransactionId.String())
+	if err != nil || executed == nil {
+		if err = s.checkRequester(ctx, caller, request); err == nil {
+			for i := 0; i < 5; i++ {
+				closed, err = s.executeDebit(ctx, request)
+				if err == nil || !repository.IsRetryable(err) {
+					break
+				}
+				time.Sleep(time.Millisecond * time.Duration(300*i))
+			}
+		}
+	}
+
+	reason := ""
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		reason = "insufficient_balance"
+	case errors.Is(err, repository.ErrAccountFrozen):
+		reason = "account_frozen"
+	case errors.Is(err, repository.ErrAccountClosed):
+		reason = "account_closed"
+	case errors.Is(err, repository.ErrAccountOverdrawn):
+		reason = "account_overdrawn"
+	case errors.Is(err, errBalanceChanged):
+		reason = "balance_changed"
+	case errors.Is(err, errRequesterRemoved):
+		reason = "requester_removed"
+	case errors.Is(err, errOwnersOnly):
+		reason = "requester_not_owner"
+	case errors.Is(err, errOverSpendLimit), errors.Is(err, errViewerCantSpend):
+		reason = "over_spend_limit"
+	case errors.Is(err, errOverCoolingOffLimit):
+		reason = "cooling_off"
+	default:
+		log.Printf("[ERROR] [%s] failed to execute payment request: %s, payment request ID: %s\n", caller, err, request.Id)
+		return nil
+	}
+
+	var failure_reason *string
+	if reason != "" {
+		failure_reason = &reason
+	}
+
+	completed, err := s.Repositories.PaymentRequestRepository.CompletePaymentRequest(ctx, request.Id, failure_reason)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to complete payment request: %s, payment request ID: %s\n", caller, err, request.Id)
+		return nil
+	}
+
+	if completed.Status == "executed" {
+		s.publishMovementEvents(ctx, caller, completed.TransactionId)
+	}
+	if closed != nil {
+		s.publishAccountStatus(ctx, caller, closed)
+	}
+
+	return completed
+}
+
+/*
+RunPaymentRequests expires the payment requests that didn't reach quorum in time, and executes
+the approved ones that couldn't execute when approved, until ctx is done. Every instance can run
+it, a request completes once.
+*/
+func (s *Server) RunPaymentRequests(ctx context.Context) {
+	ticker := time.NewTicker(payment_request_interval)
+	defer ticker.Stop()
+
+	for {
+		s.processPaymentRequests(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) processPaymentRequests(ctx context.Context) {
+	if _, err := s.Repositories.PaymentRequestRepository.ExpirePaymentRequests(ctx); err != nil {
+		log.Printf("[ERROR] [RunPaymentRequests] failed to expire payment requests: %s\n", err)
+	}
+
+	requests, err := s.Repositories.PaymentRequestRepository.GetApprovedPaymentRequests(ctx, payment_request_batch_size)
+	if err != nil {
+		log.Printf("[ERROR] [RunPaymentRequests] failed to get approved payment requests: %s\n", err)
+		return
+	}
+
+	for i := range *requests {
+		s.executePaymentRequest(ctx, "RunPaymentRequests", &(*requests)[i])
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPaymentRequests(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	alice.prefix = "/v2"
+	business := alice.createAccount("Business")
+	payroll := alice.createAccount("Payroll")
+	bob := signUp(t, router, "bob@broke.bank")
+	bob.prefix = "/v2"
+	carol := signUp(t, router, "carol@broke.bank")
+	carol.prefix = "/v2"
+	mallory := signUp(t, router, "mallory@broke.bank")
+	mallory.prefix = "/v2"
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1000.00", "to_account_id": business})
+	for email, owner := range map[string]*testClient{"bob@broke.bank": bob, "carol@broke.bank": carol} {
+		alice.do("POST", "/account/"+business+"/invitations", map[string]any{"email": email, "role": "owner"})
+		invitations := decodePayload[[]InvitationResponse](t, owner.do("GET", "/invitations", nil))
+		owner.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+	}
+
+	transfer := func(amount string, key string) (int, PaymentRequestResponse) {
+		t.Helper()
+		w := alice.doWithHeaders("POST", "/transaction/transfer", map[string]string{"amount": amount, "from_account_id": business, "to_account_id": payroll}, map[string]string{IdempotencyKeyHeader: key})
+		if w.Code != 202 {
+			return w.Code, PaymentRequestResponse{}
+		}
+		return w.Code, decodePayload[PaymentRequestResponse](t, w)
+	}
+
+	t.Run("owners set a reachable policy", func(t *testing.T) {
+		if w := alice.do("GET", "/account/"+business+"/approval-policy", nil); w.Code != 404 {
+			t.Errorf("policy of an account without one = %d, want 404", w.Code)
+		}
+		if w := alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "100", "required_approvals": 3}); w.Code != 422 {
+			t.Errorf("requiring more approvals than other owners = %d, want 422", w.Code)
+		}
+		if w := mallory.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "100", "required_approvals": 1}); w.Code != 404 {
+			t.Errorf("setting the policy of someone else's account = %d, want 404", w.Code)
+		}
+
+		policy := decodePayload[ApprovalPolicyResponse](t, alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "100", "required_approvals": 2}))
+		if policy.Threshold != "100.00" || policy.RequiredApprovals != 2 {
+			t.Fatalf("PUT /account/:id/approval-policy = %+v", policy)
+		}
+		if got := decodePayload[ApprovalPolicyResponse](t, bob.do("GET", "/account/"+business+"/approval-policy", nil)); got != policy {
+			t.Errorf("GET /account/:id/approval-policy = %+v, want %+v", got, policy)
+		}
+	})
+
+	t.Run("transfers over the threshold wait for quorum", func(t *testing.T) {
+		if code, _ := transfer("100.00", "at-threshold"); code != 200 {
+			t.Fatalf("transfer at the threshold = %d, want 200", code)
+		}
+
+		code, request := transfer("300.00", "supplier")
+		if code != 202 || request.Status != "pending" || request.RequiredApprovals != 2 {
+			t.Fatalf("transfer over the threshold = %d %+v, want a pending payment request", code, request)
+		}
+		w := alice.doWithHeaders("POST", "/transaction/transfer", map[string]string{"amount": "300.00", "from_account_id": business, "to_account_id": payroll}, map[string]string{IdempotencyKeyHeader: "supplier"})
+		if w.Code != 202 || w.Header().Get("Idempotent-Replayed") != "true" || decodePayload[PaymentRequestResponse](t, w).Id != request.Id {
+			t.Fatalf("retried transfer = %d %s, want the same payment request replayed", w.Code, w.Body)
+		}
+		if balance := alice.balance(business); balance != "900.00" {
+			t.Fatalf("balance while pending = %s, want 900.00", balance)
+		}
+
+		id := request.Id.String()
+		if w := alice.do("POST", "/payment-requests/"+id+"/approve", nil); w.Code != 403 {
+			t.Errorf("approving one's own request = %d, want 403", w.Code)
+		}
+		if w := mallory.do("POST", "/payment-requests/"+id+"/approve", nil); w.Code != 404 {
+			t.Errorf("approving someone else's request = %d, want 404", w.Code)
+		}
+		if first := decodePayload[PaymentRequestResponse](t, bob.do("POST", "/payment-requests/"+id+"/approve", map[string]string{"comment": "Invoice checked"})); first.Status != "pending" {
+			t.Fatalf("first approval = %+v, want it pending", first)
+		}
+		if w := bob.do("POST", "/payment-requests/"+id+"/approve", nil); w.Code != 409 {
+			t.Errorf("approving twice = %d, want 409", w.Code)
+		}
+		if executed := decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+id+"/approve", nil)); executed.Status != "executed" {
+			t.Fatalf("approval reaching quorum = %+v, want it executed", executed)
+		}
+		if balance := alice.balance(payroll); balance != "400.00" {
+			t.Errorf("balance after the execution = %s, want 400.00", balance)
+		}
+
+		got := decodePayload[GetPaymentRequestResponse](t, alice.do("GET", "/payment-requests/"+id, nil))
+		if len(got.Decisions) != 2 || got.Decisions[0].Comment == nil || *got.Decisions[0].Comment != "Invoice checked" {
+			t.Errorf("GET /payment-requests/:id = %+v, want both approvals", got)
+		}
+		if w := alice.doWithHeaders("POST", "/transaction/transfer", map[string]string{"amount": "300.00", "from_account_id": business, "to_account_id": payroll}, map[string]string{IdempotencyKeyHeader: "supplier"}); w.Code != 200 {
+			t.Errorf("retrying an executed transfer = %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("a rejection ends the request", func(t *testing.T) {
+		_, request := transfer("200.00", "rejected")
+		if rejected := decodePayload[PaymentRequestResponse](t, bob.do("POST", "/payment-requests/"+request.Id.String()+"/reject", nil)); rejected.Status != "rejected" {
+			t.Fatalf("POST /payment-requests/:id/reject = %+v", rejected)
+		}
+		if w := carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil); w.Code != 409 {
+			t.Errorf("approving a rejected request = %d, want 409", w.Code)
+		}
+	})
+
+	t.Run("approved transfers fail when they can't execute", func(t *testing.T) {
+		_, request := transfer("550.00", "too-much")
+		alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "100.00", "from_account_id": business})
+
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+		failed := decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil))
+		if failed.Status != "failed" || failed.FailureReason == nil || *failed.FailureReason != "insufficient_balance" {
+			t.Fatalf("approving a transfer over the balance = %+v, want it failed", failed)
+		}
+	})
+
+	t.Run("withdrawals over the threshold wait for quorum", func(t *testing.T) {
+		withdraw := func() *httptest.ResponseRecorder {
+			return alice.doWithHeaders("POST", "/transaction/withdrawal", map[string]string{"amount": "150.00", "from_account_id": business}, map[string]string{IdempotencyKeyHeader: "cash"})
+		}
+		w := withdraw()
+		request := decodePayload[PaymentRequestResponse](t, w)
+		if w.Code != 202 || request.Kind != "withdrawal" || request.ToAccountId != nil || request.Status != "pending" {
+			t.Fatalf("withdrawal over the threshold = %d %+v, want a pending payment request", w.Code, request)
+		}
+		if w = withdraw(); w.Code != 202 || w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("retried withdrawal = %d %s, want the payment request replayed", w.Code, w.Body)
+		}
+
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+		if executed := decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)); executed.Status != "executed" {
+			t.Fatalf("approval reaching quorum = %+v, want it executed", executed)
+		}
+		if balance := alice.balance(business); balance != "350.00" {
+			t.Errorf("balance after the withdrawal = %s, want 350.00", balance)
+		}
+	})
+
+	t.Run("approved requests fail when their requester can't move the money anymore", func(t *testing.T) {
+		approve := func(request PaymentRequestResponse) PaymentRequestResponse {
+			t.Helper()
+			bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+			return decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil))
+		}
+		failedWith := func(request PaymentRequestResponse, reason string) {
+			t.Helper()
+			if request.Status != "failed" || request.FailureReason == nil || *request.FailureReason != reason {
+				t.Errorf("approved request = %+v, want it failed with %s", request, reason)
+			}
+		}
+
+		alice.do("POST", "/account/"+business+"/invitations", map[string]any{"email": "mallory@broke.bank", "role": "spender", "spend_limit": "500"})
+		invitations := decodePayload[[]InvitationResponse](t, mallory.do("GET", "/invitations", nil))
+		mallory.do("POST", "/invitations/"+invitations[0].Id.String()+"/accept", nil)
+		w := mallory.do("POST", "/transaction/withdrawal", map[string]string{"amount": "200.00", "from_account_id": business})
+		if w.Code != 202 {
+			t.Fatalf("spender withdrawal over the threshold = %d %s, want 202", w.Code, w.Body)
+		}
+		request := decodePayload[PaymentRequestResponse](t, w)
+		alice.do("POST", "/account/"+business+"/members/"+getUserId(t, s, "mallory@broke.bank").String()+"/removals", nil)
+		failedWith(approve(request), "requester_removed")
+
+		// Deleting the payee after submitting brings its limit back.
+		savings := mallory.createAccount("Savings")
+		payee := decodePayload[CreatePayeeResponse](t, alice.do("POST", "/payees", map[string]string{"account_id": savings, "nickname": "Mallory"}))
+		s.PayeeCoolingOff = time.Nanosecond
+		request = decodePayload[PaymentRequestResponse](t, alice.do("POST", "/transaction/transfer", map[string]string{"amount": "150.00", "from_account_id": business, "to_account_id": savings}))
+		s.PayeeCoolingOff = 0
+		alice.do("DELETE", "/payees/"+payee.Id.String(), nil)
+		failedWith(approve(request), "cooling_off")
+
+		if balance := alice.balance(business); balance != "350.00" {
+			t.Errorf("balance after failed requests = %s, want 350.00", balance)
+		}
+	})
+
+	t.Run("requests expire without quorum", func(t *testing.T) {
+		s.PaymentRequestTTL = time.Nanosecond
+		defer func() { s.PaymentRequestTTL = 0 }()
+
+		_, request := transfer("150.00", "expiring")
+		s.processPaymentRequests(context.Background())
+
+		if got := decodePayload[GetPaymentRequestResponse](t, alice.do("GET", "/payment-requests/"+request.Id.String(), nil)); got.Status != "expired" {
+			t.Fatalf("request after its expiry = %+v, want it expired", got)
+		}
+		if w := bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil); w.Code != 409 {
+			t.Errorf("approving an expired request = %d, want 409", w.Code)
+		}
+
+		requests := decodePayload[[]PaymentRequestResponse](t, carol.do("GET", "/account/"+business+"/payment-requests?status=expired", nil))
+		if len(requests) != 1 || requests[0].Id != request.Id {
+			t.Errorf("GET /account/:id/payment-requests?status=expired = %+v", requests)
+		}
+	})
+
+	t.Run("deleting the policy stops holding transfers", func(t *testing.T) {
+		if w := bob.do("DELETE", "/account/"+business+"/approval-policy", nil); w.Code != 200 {
+			t.Fatalf("DELETE /account/:id/approval-policy = %d: %s", w.Code, w.Body)
+		}
+		if code, _ := transfer("150.00", "unheld"); code != 200 {
+			t.Errorf("transfer without a policy = %d, want 200", code)
+		}
+	})
+
+	t.Run("closures sweeping over the threshold wait for quorum", func(t *testing.T) {
+		alice.do("PUT", "/account/"+business+"/approval-policy", map[string]any{"threshold": "100", "required_approvals": 2})
+		closure := func() PaymentRequestResponse {
+			t.Helper()
+			w := alice.do("POST", "/account/"+business+"/close", map[string]string{"to_account_id": payroll})
+			request := decodePayload[PaymentRequestResponse](t, w)
+			if w.Code != 202 || request.Kind != "closure" || request.ToAccountId == nil || request.ToAccountId.String() != payroll {
+				t.Fatalf("closing an account over the threshold = %d %+v, want a pending payment request", w.Code, request)
+			}
+			return request
+		}
+
+		// Owners approve the sweep of the balance they saw, not of more.
+		request := closure()
+		alice.do("POST", "/transaction/deposit", map[string]string{"amount": "10.00", "to_account_id": business})
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+		failed := decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil))
+		if failed.Status != "failed" || failed.FailureReason == nil || *failed.FailureReason != "balance_changed" {
+			t.Fatalf("approving a closure after a deposit = %+v, want it failed", failed)
+		}
+
+		request = closure()
+		if request.Amount != "210.00" {
+			t.Errorf("closure amount = %s, want the balance of 210.00", request.Amount)
+		}
+		bob.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)
+		if executed := decodePayload[PaymentRequestResponse](t, carol.do("POST", "/payment-requests/"+request.Id.String()+"/approve", nil)); executed.Status != "executed" {
+			t.Fatalf("approval reaching quorum = %+v, want it executed", executed)
+		}
+		if account := decodePayload[GetAccountResponse](t, alice.do("GET", "/account/"+business, nil)); account.Status != "closed" || account.Balance != "0.00" {
+			t.Errorf("account after the closure = %+v, want it closed and empty", account)
+		}
+		if balance := alice.balance(payroll); balance != "760.00" {
+			t.Errorf("balance the closure swept to = %s, want 760.00", balance)
+		}
+	})
+}
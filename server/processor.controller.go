@@ -0,0 +1,156 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// The payment processor signs its webhooks like ours, see utils.SignWebhook, with ProcessorSecret.
+const ProcessorSignatureHeader = "Processor-Signature"
+
+// Older signatures are refused, so that a captured request can't be replayed later on.
+const processor_signature_tolerance = 5 * time.Minute
+
+const max_processor_event_size = 64 * 1024
+
+// Deposit ids are derived from charge ids, so that a charge can only ever create one transaction.
+var processor_namespace = uuid.MustParse("6f0c2a47-8d0e-4f4a-9a55-2f4f1c8e7b19")
+
+// Status each charge event moves its charge to, other event types are acknowledged and ignored.
+var processor_charge_statuses = map[string]string{
+	"charge.pending":   "pending",
+	"charge.succeeded": "succeeded",
+	"charge.failed":    "failed",
+}
+
+// ProcessorEvent is the body of the payment processor's webhooks.
+type ProcessorEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	// Unix seconds.
+	Created int64               `json:"created"`
+	Data    ProcessorChargeData `json:"data"`
+}
+
+type ProcessorChargeData struct {
+	Id     string          `json:"id"`
+	Amount decimal.Decimal `json:"amount"`
+	// The account topped up, given to the processor when the charge was created.
+	AccountId      string  `json:"account_id"`
+	FailureMessage *string `json:"failure_message"`
+}
+
+func (event ProcessorEvent) valid() bool {
+	if event.Id == "" || len(event.Id) > 255 || event.Data.Id == "" || len(event.Data.Id) > 255 {
+		return false
+	}
+
+	if _, err := uuid.Parse(event.Data.AccountId); err != nil {
+		return false
+	}
+
+	return event.Data.Amount.IsPositive() && event.Data.Amount.Equal(event.Data.Amount.Round(2))
+}
+
+/*
+ProcessorWebhook applies the payment processor's charge events: a charge is deposited once it
+succeeds, however many times and in whichever order its events arrive. Requests must be signed
+with ProcessorSecret within processor_signature_tolerance, and each event id is only applied
+once, so replayed requests are acknowledged without effect.
+*/
+func (s *Server) ProcessorWebhook() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if s.ProcessorSecret == "" {
+			log.Println("[ERROR] [ProcessorWebhook] PROCESSOR_WEBHOOK_SECRET is not set")
+			ctx.JSON(503, gin.H{"error": "Payment processor is not configured"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, max_processor_event_size+1))
+		if err != nil || len(body) > max_processor_event_size {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if err = utils.VerifyWebhook(s.ProcessorSecret, ctx.GetHeader(ProcessorSignatureHeader), body, processor_signature_tolerance, time.Now()); err != nil {
+			log.Printf("[ERROR] [ProcessorWebhook] refused webhook: %s\n", err)
+			ctx.JSON(401, gin.H{"error": "Invalid signature"})
+			return
+		}
+
+		setAuditActor(ctx, "processor")
+
+		event := ProcessorEvent{}
+		if json.Unmarshal(body, &event) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		status, ok := processor_charge_statuses[event.Type]
+		if !ok {
+			ctx.Status(200)
+			return
+		}
+
+		if !event.valid() {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx.Request.Context(), event.Data.AccountId)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] [ProcessorWebhook] unknown account: %s, charge ID: %s\n", event.Data.AccountId, event.Data.Id)
+			ctx.JSON(422, gin.H{"error": "Account not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] [ProcessorWebhook] failed to get account: %s, account ID: %s\n", err, event.Data.AccountId)
+			ctx.JSON(500, gin.H{"error": "Failed to get account"})
+			return
+		}
+
+		charge := model.ProcessorCharge{Id: event.Data.Id, AccountId: account.Id, Amount: event.Data.Amount, Status: status, FailureMessage: event.Data.FailureMessage}
+		transaction_id := uuid.NewSHA1(processor_namespace, []byte(charge.Id))
+
+		applied, changed, err := s.Repositories.ProcessorRepository.ApplyChargeEvent(ctx.Request.Context(), event.Id, event.Type, charge, transaction_id)
+		switch {
+		case errors.Is(err, repository.ErrEventReplayed):
+			ctx.Status(200)
+			return
+		case errors.Is(err, repository.ErrChargeMismatch), errors.Is(err, repository.ErrChargeTransition):
+			log.Printf("[ERROR] [ProcessorWebhook] refused charge event: %s, event ID: %s, charge ID: %s\n", err, event.Id, charge.Id)
+			ctx.JSON(422, gin.H{"error": "Charge conflicts with its earlier events"})
+			return
+		// The processor retries the event until the account is unfrozen.
+		case errors.Is(err, repository.ErrAccountFrozen):
+			log.Printf("[ERROR] [ProcessorWebhook] account is frozen: %s, charge ID: %s\n", charge.AccountId, charge.Id)
+			ctx.JSON(503, gin.H{"error": "Account is frozen"})
+			return
+		case errors.Is(err, repository.ErrLockTimeout), errors.Is(err, repository.ErrQueryTimeout):
+			log.Printf("[ERROR] [ProcessorWebhook] timed out: %s\n", err)
+			ctx.JSON(503, gin.H{"error": errAccountBusy.Error()})
+			return
+		case err != nil:
+			log.Printf("[ERROR] [ProcessorWebhook] failed to apply charge event: %s, event ID: %s\n", err, event.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to apply charge event"})
+			return
+		}
+
+		if changed && applied.TransactionId != nil {
+			s.publishMovementEvents(ctx.Request.Context(), "ProcessorWebhook", *applied.TransactionId)
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"broke-bank/repository"
+	"broke-bank/utils"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// sendProcessorEvent posts an event to the processor webhook, signed with secret, with a client prefixed by /v2.
+func sendProcessorEvent(c *testClient, secret string, event ProcessorEvent) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return c.doWithHeaders("POST", "/processor/webhook", event, map[string]string{ProcessorSignatureHeader: utils.SignWebhook(secret, time.Now(), body)})
+}
+
+func TestProcessorWebhook(t *testing.T) {
+	s, router := newTestServer(t)
+	s.ProcessorSecret = "whsec_processor"
+
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+	processor := &testClient{t: t, router: router, prefix: "/v2"}
+
+	data := ProcessorChargeData{Id: "ch_1", Amount: decimal.RequireFromString("25.00"), AccountId: checking}
+	pending := ProcessorEvent{Id: "evt_1", Type: "charge.pending", Created: time.Now().Unix(), Data: data}
+	succeeded := ProcessorEvent{Id: "evt_2", Type: "charge.succeeded", Created: time.Now().Unix(), Data: data}
+
+	if w := sendProcessorEvent(processor, "whsec_processor", pending); w.Code != 200 {
+		t.Fatalf("charge.pending = %d: %s", w.Code, w.Body)
+	}
+	if got := alice.balance(checking); got != "0.00" {
+		t.Fatalf("balance after charge.pending = %s, want 0.00", got)
+	}
+
+	// Retries of the event and later events of the charge only deposit it once.
+	for _, event := range []ProcessorEvent{succeeded, succeeded, {Id: "evt_3", Type: "charge.succeeded", Data: data}, pending} {
+		if w := sendProcessorEvent(processor, "whsec_processor", event); w.Code != 200 {
+			t.Fatalf("%s %s = %d: %s", event.Type, event.Id, w.Code, w.Body)
+		}
+	}
+	if got := alice.balance(checking); got != "25.00" {
+		t.Fatalf("balance after charge.succeeded = %s, want 25.00", got)
+	}
+
+	charge, err := s.Repositories.ProcessorRepository.GetProcessorCharge(context.Background(), "ch_1")
+	if err != nil || charge.Status != "succeeded" || charge.TransactionId == nil {
+		t.Fatalf("charge = %+v, %v, want succeeded with its deposit", charge, err)
+	}
+	transactions := decodePayload[[]GetTransactionResponse](t, alice.do("GET", "/v2/account/"+checking+"/transactions", nil))
+	if len(transactions) != 1 || transactions[0].Id != *charge.TransactionId || transactions[0].Type != "deposit" || transactions[0].Amount != "25.00" {
+		t.Fatalf("transactions = %+v, want the charge's deposit", transactions)
+	}
+
+	failed := ProcessorEvent{Id: "evt_4", Type: "charge.failed", Data: data}
+	if w := sendProcessorEvent(processor, "whsec_processor", failed); w.Code != 422 {
+		t.Fatalf("charge.failed after charge.succeeded = %d, want 422", w.Code)
+	}
+	other_amount := ProcessorEvent{Id: "evt_5", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_1", Amount: decimal.RequireFromString("2500.00"), AccountId: checking}}
+	if w := sendProcessorEvent(processor, "whsec_processor", other_amount); w.Code != 422 {
+		t.Fatalf("charge.succeeded with another amount = %d, want 422", w.Code)
+	}
+
+	message := "card_declined"
+	declined := ProcessorEvent{Id: "evt_6", Type: "charge.failed", Data: ProcessorChargeData{Id: "ch_2", Amount: decimal.RequireFromString("10.00"), AccountId: checking, FailureMessage: &message}}
+	if w := sendProcessorEvent(processor, "whsec_processor", declined); w.Code != 200 {
+		t.Fatalf("charge.failed = %d: %s", w.Code, w.Body)
+	}
+	if got := alice.balance(checking); got != "25.00" {
+		t.Fatalf("balance after a failed charge = %s, want 25.00", got)
+	}
+
+	// Other event types are acknowledged, so that the processor doesn't retry them.
+	if w := sendProcessorEvent(processor, "whsec_processor", ProcessorEvent{Id: "evt_7", Type: "payout.paid"}); w.Code != 200 {
+		t.Fatalf("payout.paid = %d, want 200", w.Code)
+	}
+
+	for _, event := range []ProcessorEvent{
+		{Id: "evt_8", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_3", Amount: decimal.RequireFromString("1.001"), AccountId: checking}},
+		{Id: "evt_9", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_3", Amount: decimal.RequireFromString("1.00"), AccountId: "not-an-id"}},
+		{Id: "", Type: "charge.succeeded", Data: data},
+	} {
+		if w := sendProcessorEvent(processor, "whsec_processor", event); w.Code != 422 {
+			t.Errorf("invalid %+v = %d, want 422", event, w.Code)
+		}
+	}
+
+	// Charges for frozen accounts are retried by the processor until they're unfrozen.
+	reason := "court_order"
+	if _, err = s.Repositories.AccountRepository.SetAccountStatus(context.Background(), checking, repository.AccountStatusChange{From: []string{"active"}, Status: "frozen_all", StatusReason: &reason}); err != nil {
+		t.Fatal(err)
+	}
+	frozen := ProcessorEvent{Id: "evt_10", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_4", Amount: decimal.RequireFromString("5.00"), AccountId: checking}}
+	if w := sendProcessorEvent(processor, "whsec_processor", frozen); w.Code != 503 {
+		t.Fatalf("charge.succeeded for a frozen account = %d, want 503", w.Code)
+	}
+	if _, err = s.Repositories.AccountRepository.SetAccountStatus(context.Background(), checking, repository.AccountStatusChange{From: []string{"frozen_all"}, Status: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := sendProcessorEvent(processor, "whsec_processor", frozen); w.Code != 200 {
+		t.Fatalf("retried charge.succeeded once unfrozen = %d: %s", w.Code, w.Body)
+	}
+	if got := alice.balance(checking); got != "30.00" {
+		t.Fatalf("balance after the retried charge = %s, want 30.00", got)
+	}
+
+	// Those for closed accounts fail, to be refunded.
+	spare := alice.createAccount("Spare")
+	alice.do("POST", "/v2/account/"+spare+"/close", map[string]string{"to_account_id": checking})
+	closed := ProcessorEvent{Id: "evt_11", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_5", Amount: decimal.RequireFromString("5.00"), AccountId: spare}}
+	if w := sendProcessorEvent(processor, "whsec_processor", closed); w.Code != 200 {
+		t.Fatalf("charge.succeeded for a closed account = %d: %s", w.Code, w.Body)
+	}
+	charge, err = s.Repositories.ProcessorRepository.GetProcessorCharge(context.Background(), "ch_5")
+	if err != nil || charge.Status != "failed" || charge.TransactionId != nil || charge.FailureMessage == nil || *charge.FailureMessage != repository.ChargeRefundMessage {
+		t.Fatalf("charge for a closed account = %+v, %v, want it failed for a refund", charge, err)
+	}
+}
+
+func TestProcessorWebhookSignature(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+	processor := &testClient{t: t, router: router, prefix: "/v2"}
+
+	event := ProcessorEvent{Id: "evt_1", Type: "charge.succeeded", Data: ProcessorChargeData{Id: "ch_1", Amount: decimal.RequireFromString("25.00"), AccountId: checking}}
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a secret, no signature can be right.
+	if w := sendProcessorEvent(processor, "", event); w.Code != 503 {
+		t.Fatalf("webhook without a configured secret = %d, want 503", w.Code)
+	}
+
+	s.ProcessorSecret = "whsec_processor"
+	for name, signature := range map[string]string{
+		"missing":   "",
+		"forged":    utils.SignWebhook("whsec_forged", time.Now(), body),
+		"expired":   utils.SignWebhook("whsec_processor", time.Now().Add(-10*time.Minute), body),
+		"malformed": "v1=deadbeef",
+	} {
+		if w := processor.doWithHeaders("POST", "/processor/webhook", event, map[string]string{ProcessorSignatureHeader: signature}); w.Code != 401 {
+			t.Errorf("%s signature = %d, want 401", name, w.Code)
+		}
+	}
+	if got := alice.balance(checking); got != "0.00" {
+		t.Fatalf("balance after refused webhooks = %s, want 0.00", got)
+	}
+}
+
+func TestDepositsRequireSandbox(t *testing.T) {
+	s, router := newTestServer(t)
+	s.Sandbox = false
+
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+
+	if w := alice.do("POST", "/v2/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking}); w.Code != 403 {
+		t.Fatalf("POST /v2/transaction/deposit outside of sandbox mode = %d, want 403", w.Code)
+	}
+	if got := alice.balance(checking); got != "0.00" {
+		t.Fatalf("balance = %s, want 0.00", got)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"broke-bank/ratelimit"
+	"broke-bank/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+/*
+RateLimitMiddleware limits requests to a route group by client IP, API key (ApiKeyHeader)
+and, on authenticated routes, by user. Every applicable limit has to allow the request. The
+RateLimit-* headers describe the limit closest to running out.
+
+Errors from the limiter let the request through: an outage of the limiter shouldn't take
+the API down with it.
+*/
+func (s *Server) RateLimitMiddleware(group string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if s.Limiter == nil {
+			ctx.Next()
+			return
+		}
+
+		identities := map[ratelimit.Scope]string{ratelimit.ScopeIP: ctx.ClientIP()}
+		if api_key := ctx.GetHeader(ApiKeyHeader); api_key != "" {
+			// Keys are never stored as is.
+			hash := sha256.Sum256([]byte(api_key))
+			identities[ratelimit.ScopeApiKey] = hex.EncodeToString(hash[:16])
+		}
+		if ctx.GetString("user") != "" {
+			if user, err := utils.GetUser(ctx); err == nil {
+				identities[ratelimit.ScopeUser] = user.Id.String()
+			}
+		}
+
+		var (
+			tightest        *ratelimit.Result
+			tightest_window time.Duration
+		)
+		for _, scope := range ratelimit.Scopes {
+			limit, ok := s.RateLimits[group][scope]
+			identity, identified := identities[scope]
+			if !ok || !identified {
+				continue
+			}
+
+			key := fmt.Sprintf("%s:%s:%s", group, scope, identity)
+			result, err := s.Limiter.Take(ctx.Request.Context(), key, limit)
+			if err != nil {
+				log.Println("[ERROR] [RateLimitMiddleware] failed to take a token: ", err)
+				continue
+			}
+
+			if tightest == nil || !result.Allowed || result.Remaining < tightest.Remaining {
+				tightest, tightest_window = &result, limit.Window
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			ctx.Next()
+			return
+		}
+
+		header := ctx.Writer.Header()
+		header.Set("RateLimit-Limit", fmt.Sprint(tightest.Limit))
+		header.Set("RateLimit-Remaining", fmt.Sprint(tightest.Remaining))
+		header.Set("RateLimit-Reset", fmt.Sprint(seconds(tightest.Reset)))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", tightest.Limit, seconds(tightest_window)))
+
+		if !tightest.Allowed {
+			header.Set("Retry-After", fmt.Sprint(seconds(tightest.RetryAfter)))
+			ctx.JSON(429, gin.H{"error": "Too many requests"})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"broke-bank/utils"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTransactionReceipt signs a receipt of one of the user's transactions, to show to third parties.
+func (s *Server) GetTransactionReceipt() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		transaction_id := ctx.Param("id")
+		if transaction_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing id param"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReceipt] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		receipt, err := s.receipt(ctx.Request.Context(), "GetTransactionReceipt", user, transaction_id)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": receipt})
+	}
+}
+
+type VerifyReceiptRequest struct {
+	Transaction ReceiptTransaction `json:"transaction"`
+	KeyId       string             `json:"key_id" binding:"required"`
+	Signature   string             `json:"signature" binding:"required"`
+}
+
+/*
+VerifyReceipt lets anyone check a receipt, as returned by GetTransactionReceipt. A well-formed
+request is answered with 200 whether the receipt is valid or not, receipts of transactions
+reversed since they were signed aren't.
+*/
+func (s *Server) VerifyReceipt() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := VerifyReceiptRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		result, err := s.verifyReceipt(ctx.Request.Context(), "VerifyReceipt", req.Transaction, req.KeyId, req.Signature)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": result})
+	}
+}
+
+// GetReceiptKeys publishes the keys receipts are verified with, including retired ones.
+func (s *Server) GetReceiptKeys() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(200, gin.H{"payload": s.receiptKeys()})
+	}
+}
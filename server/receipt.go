@@ -0,0 +1,236 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errReceiptsDisabled = errors.New("Receipts are not available")
+
+const receipt_algorithm = "Ed25519"
+
+// Microseconds, the precision transactions are stored with, always in UTC.
+const receipt_time_format = "2006-01-02T15:04:05.000000Z"
+
+/*
+ReceiptKeys sign transaction receipts. Rotating the signing key keeps the receipts signed by the
+previous one verifiable: its public key moves to Retired, and both are published with their key
+ids by GET /v2/receipts/keys.
+*/
+type ReceiptKeys struct {
+	// Signs new receipts, none are issued while nil.
+	Signer *utils.Signer
+	// Public keys of the previous signing keys, by key id.
+	Retired map[string]ed25519.PublicKey
+}
+
+/*
+ReceiptKeysFromEnv reads the signing key from RECEIPT_SIGNING_KEY, a base64 seed, and the retired
+keys from RECEIPT_RETIRED_KEYS, comma separated base64 public keys.
+*/
+func ReceiptKeysFromEnv() (ReceiptKeys, error) {
+	signer, err := utils.SignerFromEnv("RECEIPT_SIGNING_KEY")
+	if err != nil {
+		return ReceiptKeys{}, err
+	}
+
+	keys := ReceiptKeys{Signer: signer, Retired: map[string]ed25519.PublicKey{}}
+	for _, raw := range strings.Split(os.Getenv("RECEIPT_RETIRED_KEYS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		public_key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(public_key) != ed25519.PublicKeySize {
+			return ReceiptKeys{}, fmt.Errorf("invalid RECEIPT_RETIRED_KEYS public key %q", raw)
+		}
+		keys.Retired[utils.KeyId(public_key)] = public_key
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the public key of key_id, and whether it's the one signing new receipts.
+func (k ReceiptKeys) publicKey(key_id string) (ed25519.PublicKey, bool, bool) {
+	if k.Signer != nil && k.Signer.KeyId == key_id {
+		return k.Signer.PublicKey(), true, true
+	}
+
+	public_key, ok := k.Retired[key_id]
+	return public_key, false, ok
+}
+
+/*
+ReceiptTransaction is what a receipt vouches for. Its JSON encoding, with the fields in this
+(alphabetical) order and no whitespace, is the canonical form the signature covers. The reversal
+fields are left out when null, so receipts of transactions that were never reversed keep the
+form they had before those fields existed.
+*/
+type ReceiptTransaction struct {
+	// With 2 decimal places.
+	Amount string `json:"amount"`
+	// UTC, with microseconds.
+	DateIssued    string     `json:"date_issued"`
+	FromAccountId *uuid.UUID `json:"from_account_id"`
+	Id            uuid.UUID  `json:"id"`
+	// The transaction this one reverses.
+	ReversalOf *uuid.UUID `json:"reversal_of,omitempty"`
+	// The transaction reversing this one, when it was reversed by the time the receipt was signed.
+	ReversedBy  *uuid.UUID `json:"reversed_by,omitempty"`
+	ToAccountId *uuid.UUID `json:"to_account_id"`
+	// 'deposit' | 'withdrawal' | 'transfer' | 'adjustment'
+	Type string `json:"type"`
+}
+
+func newReceiptTransaction(transaction *model.Transaction, reversed_by *uuid.UUID) ReceiptTransaction {
+	return ReceiptTransaction{
+		Amount:        transaction.Amount.StringFixed(2),
+		DateIssued:    transaction.DateIssued.UTC().Truncate(time.Microsecond).Format(receipt_time_format),
+		FromAccountId: transaction.FromAccountId,
+		Id:            transaction.Id,
+		ReversalOf:    transaction.ReversalOf,
+		ReversedBy:    reversed_by,
+		ToAccountId:   transaction.ToAccountId,
+		Type:          transaction.Type,
+	}
+}
+
+func (r ReceiptTransaction) canonical() []byte {
+	// Marshaling a struct of strings and ids can't fail.
+	encoded, _ := json.Marshal(r)
+	return encoded
+}
+
+type ReceiptResponse struct {
+	Transaction ReceiptTransaction `json:"transaction"`
+	// The exact bytes signed, the canonical JSON of Transaction.
+	Canonical string `json:"canonical"`
+	// Always 'Ed25519'.
+	Algorithm string `json:"algorithm"`
+	KeyId     string `json:"key_id"`
+	// Base64.
+	Signature string `json:"signature"`
+}
+
+/*
+receipt signs a receipt of one of the user's transactions, with its reversal if it was reversed,
+so that the receipt of a reversed transaction can't be passed off as the proof of a payment.
+Signatures are deterministic, so a receipt is the same every time it's asked for until the
+signing key is rotated or the transaction reversed.
+*/
+func (s *Server) receipt(ctx context.Context, caller string, user *model.User, transaction_id string) (*ReceiptResponse, error) {
+	if s.Receipts.Signer == nil {
+		return nil, errReceiptsDisabled
+	}
+
+	transaction, err := s.visibleTransaction(ctx, caller, user, transaction_id)
+	if err != nil {
+		return nil, err
+	}
+
+	var reversed_by *uuid.UUID
+	reversal, err := s.Repositories.TransactionRepository.GetReversal(ctx, transaction.Id.String())
+	if err == nil {
+		reversed_by = &reversal.Id
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[ERROR] [%s] failed to get reversal: %s, transaction ID: %s\n", caller, err, transaction.Id)
+		return nil, &failure{"Failed to get receipt", err}
+	}
+
+	receipt := newReceiptTransaction(transaction, reversed_by)
+	canonical := receipt.canonical()
+
+	return &ReceiptResponse{
+		Transaction: receipt,
+		Canonical:   string(canonical),
+		Algorithm:   receipt_algorithm,
+		KeyId:       s.Receipts.Signer.KeyId,
+		Signature:   base64.StdEncoding.EncodeToString(s.Receipts.Signer.Sign(canonical)),
+	}, nil
+}
+
+type VerifyReceiptResponse struct {
+	Valid bool `json:"valid"`
+	// Why the receipt isn't valid.
+	Reason *string `json:"reason"`
+	// Whether the key still signs new receipts, false for retired keys.
+	ActiveKey bool `json:"active_key"`
+	// The transaction reversing this one since the receipt was signed.
+	ReversedBy *uuid.UUID `json:"reversed_by"`
+}
+
+/*
+verifyReceipt checks a receipt's signature, and that the transaction wasn't reversed since it was
+signed: a receipt fetched before the reversal would otherwise still vouch for money that went back.
+*/
+func (s *Server) verifyReceipt(ctx context.Context, caller string, receipt ReceiptTransaction, key_id string, raw_signature string) (*VerifyReceiptResponse, error) {
+	invalid := func(reason string) *VerifyReceiptResponse {
+		return &VerifyReceiptResponse{Reason: &reason}
+	}
+
+	public_key, active, ok := s.Receipts.publicKey(key_id)
+	if !ok {
+		return invalid("Unknown key"), nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(raw_signature)
+	if err != nil || utils.VerifySignature(public_key, receipt.canonical(), signature) != nil {
+		return invalid("Invalid signature"), nil
+	}
+
+	if receipt.ReversedBy == nil {
+		reversal, err := s.Repositories.TransactionRepository.GetReversal(ctx, receipt.Id.String())
+		if err == nil {
+			stale := invalid("Transaction was reversed after the receipt was signed")
+			stale.ActiveKey, stale.ReversedBy = active, &reversal.Id
+			return stale, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] [%s] failed to get reversal: %s, transaction ID: %s\n", caller, err, receipt.Id)
+			return nil, &failure{"Failed to verify receipt", err}
+		}
+	}
+
+	return &VerifyReceiptResponse{Valid: true, ActiveKey: active, ReversedBy: receipt.ReversedBy}, nil
+}
+
+type ReceiptKeyResponse struct {
+	KeyId string `json:"key_id"`
+	// Always 'Ed25519'.
+	Algorithm string `json:"algorithm"`
+	// Base64.
+	PublicKey string `json:"public_key"`
+	// Whether new receipts are signed with it.
+	Active bool `json:"active"`
+}
+
+// receiptKeys lists the active key first, then the retired ones by key id.
+func (s *Server) receiptKeys() []ReceiptKeyResponse {
+	keys := []ReceiptKeyResponse{}
+	if s.Receipts.Signer != nil {
+		keys = append(keys, ReceiptKeyResponse{s.Receipts.Signer.KeyId, receipt_algorithm, base64.StdEncoding.EncodeToString(s.Receipts.Signer.PublicKey()), true})
+	}
+
+	retired := []ReceiptKeyResponse{}
+	for key_id, public_key := range s.Receipts.Retired {
+		retired = append(retired, ReceiptKeyResponse{key_id, receipt_algorithm, base64.StdEncoding.EncodeToString(public_key), false})
+	}
+	slices.SortFunc(retired, func(a, b ReceiptKeyResponse) int { return strings.Compare(a.KeyId, b.KeyId) })
+
+	return append(keys, retired...)
+}
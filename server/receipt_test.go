@@ -0,0 +1,123 @@
+package server
+
+import (
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReceipts(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+	alice.prefix, bob.prefix = "/v2", "/v2"
+	anonymous := &testClient{t: t, router: router, prefix: "/v2"}
+
+	checking := alice.createAccount("Checking")
+	savings := bob.createAccount("Savings")
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings})
+	transfer := decodePayload[[]GetTransactionResponse](t, alice.do("GET", "/account/"+checking+"/transactions?limit=1", nil))[0]
+
+	// Both sides of a transfer can get its receipt, and it's the same.
+	receipt := decodePayload[ReceiptResponse](t, alice.do("GET", "/transaction/"+transfer.Id.String()+"/receipt", nil))
+	if bobs := decodePayload[ReceiptResponse](t, bob.do("GET", "/transaction/"+transfer.Id.String()+"/receipt", nil)); bobs.Canonical != receipt.Canonical || bobs.Signature != receipt.Signature {
+		t.Fatalf("bob's receipt %+v differs from alice's %+v", bobs, receipt)
+	}
+	if receipt.Transaction.Amount != "25.50" || receipt.Transaction.Type != "transfer" || receipt.Transaction.FromAccountId.String() != checking || receipt.Algorithm != "Ed25519" {
+		t.Fatalf("receipt = %+v", receipt)
+	}
+
+	// Third parties can check it offline against the published key.
+	keys := decodePayload[[]ReceiptKeyResponse](t, anonymous.do("GET", "/receipts/keys", nil))
+	if len(keys) != 1 || keys[0].KeyId != receipt.KeyId || !keys[0].Active {
+		t.Fatalf("GET /v2/receipts/keys = %+v, want the signing key", keys)
+	}
+	public_key, _ := base64.StdEncoding.DecodeString(keys[0].PublicKey)
+	signature, _ := base64.StdEncoding.DecodeString(receipt.Signature)
+	if !ed25519.Verify(public_key, []byte(receipt.Canonical), signature) {
+		t.Fatal("receipt signature doesn't verify offline")
+	}
+	canonical, _ := json.Marshal(map[string]any{
+		"amount": "25.50", "date_issued": receipt.Transaction.DateIssued, "from_account_id": checking,
+		"id": transfer.Id, "to_account_id": savings, "type": "transfer",
+	})
+	if receipt.Canonical != string(canonical) {
+		t.Fatalf("canonical = %s, want the sorted JSON %s", receipt.Canonical, canonical)
+	}
+
+	verify := func(request VerifyReceiptRequest) VerifyReceiptResponse {
+		t.Helper()
+		return decodePayload[VerifyReceiptResponse](t, anonymous.do("POST", "/receipts/verify", request))
+	}
+	valid := VerifyReceiptRequest{Transaction: receipt.Transaction, KeyId: receipt.KeyId, Signature: receipt.Signature}
+	if result := verify(valid); !result.Valid || !result.ActiveKey {
+		t.Fatalf("POST /v2/receipts/verify = %+v, want a valid receipt", result)
+	}
+
+	tampered := valid
+	tampered.Transaction.Amount = "2550.00"
+	if result := verify(tampered); result.Valid || result.Reason == nil || *result.Reason != "Invalid signature" {
+		t.Fatalf("POST /v2/receipts/verify with a tampered amount = %+v", result)
+	}
+	unknown := valid
+	unknown.KeyId = "0000000000000000"
+	if result := verify(unknown); result.Valid || result.Reason == nil || *result.Reason != "Unknown key" {
+		t.Fatalf("POST /v2/receipts/verify with an unknown key = %+v", result)
+	}
+
+	// After a rotation, old receipts still verify with the retired key, and new ones use the new key.
+	previous := s.Receipts.Signer
+	next, err := utils.NewSigner(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Receipts = ReceiptKeys{Signer: next, Retired: map[string]ed25519.PublicKey{previous.KeyId: previous.PublicKey()}}
+
+	if result := verify(valid); !result.Valid || result.ActiveKey {
+		t.Fatalf("POST /v2/receipts/verify after the rotation = %+v, want a valid receipt of a retired key", result)
+	}
+	rotated := decodePayload[ReceiptResponse](t, alice.do("GET", "/transaction/"+transfer.Id.String()+"/receipt", nil))
+	if rotated.KeyId != next.KeyId || rotated.Canonical != receipt.Canonical {
+		t.Fatalf("receipt after the rotation = %+v, want the same transaction signed by %s", rotated, next.KeyId)
+	}
+	if keys := decodePayload[[]ReceiptKeyResponse](t, anonymous.do("GET", "/receipts/keys", nil)); len(keys) != 2 || keys[0].KeyId != next.KeyId || keys[1].KeyId != previous.KeyId || keys[1].Active {
+		t.Fatalf("GET /v2/receipts/keys after the rotation = %+v", keys)
+	}
+
+	// Once reversed, receipts name the reversal, which the earlier receipt can't be edited to hide.
+	reversal, err := s.Repositories.TransactionRepository.ReverseTransaction(context.Background(), uuid.New(), transfer.Id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := verify(valid); result.Valid || result.ReversedBy == nil || *result.ReversedBy != reversal.Id {
+		t.Fatalf("POST /v2/receipts/verify of a receipt signed before the reversal = %+v, want it rejected naming the reversal", result)
+	}
+	reversed := decodePayload[ReceiptResponse](t, alice.do("GET", "/transaction/"+transfer.Id.String()+"/receipt", nil))
+	if reversed.Transaction.ReversedBy == nil || *reversed.Transaction.ReversedBy != reversal.Id || !strings.Contains(reversed.Canonical, `"reversed_by":"`+reversal.Id.String()+`"`) {
+		t.Fatalf("receipt of a reversed transaction = %+v, want its reversal signed", reversed)
+	}
+	if result := verify(VerifyReceiptRequest{Transaction: reversed.Transaction, KeyId: reversed.KeyId, Signature: reversed.Signature}); !result.Valid || result.ReversedBy == nil || *result.ReversedBy != reversal.Id {
+		t.Fatalf("POST /v2/receipts/verify of a reversed transaction = %+v, want a valid receipt", result)
+	}
+	hidden := VerifyReceiptRequest{Transaction: reversed.Transaction, KeyId: reversed.KeyId, Signature: reversed.Signature}
+	hidden.Transaction.ReversedBy = nil
+	if result := verify(hidden); result.Valid {
+		t.Fatal("POST /v2/receipts/verify without the reversal of a reversed receipt is valid")
+	}
+	if of_reversal := decodePayload[ReceiptResponse](t, bob.do("GET", "/transaction/"+reversal.Id.String()+"/receipt", nil)); of_reversal.Transaction.ReversalOf == nil || *of_reversal.Transaction.ReversalOf != transfer.Id {
+		t.Fatalf("receipt of the reversal = %+v, want the transaction it reverses", of_reversal)
+	}
+
+	s.Receipts.Signer = nil
+	if w := alice.do("GET", "/transaction/"+transfer.Id.String()+"/receipt", nil); w.Code != 503 {
+		t.Fatalf("GET receipt without a signing key = %d, want 503", w.Code)
+	}
+}
@@ -1,45 +1,275 @@
 package server
 
 import (
+	"broke-bank/ratelimit"
 	"broke-bank/repository"
+	"broke-bank/utils"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 type Server struct {
 	Repositories repository.Repositories
+	// Nil disables rate limiting.
+	Limiter    ratelimit.Limiter
+	RateLimits ratelimit.Config
+	// Sends webhook deliveries, nil uses http.DefaultClient.
+	WebhookClient *http.Client
+	// Lets users deposit money themselves. Otherwise deposits only come from the payment processor.
+	Sandbox bool
+	// Shared with the payment processor to sign its webhooks, none are accepted while empty.
+	ProcessorSecret string
+	// Sign transaction receipts.
+	Receipts ReceiptKeys
+	// Signs ledger checkpoints, none are made while nil.
+	LedgerSigner *utils.Signer
+	// How often a checkpoint is made, across every instance.
+	LedgerCheckpointInterval time.Duration
+	// Adjustments of at least this amount, either way, need 2 approvals.
+	AdjustmentDualApprovalThreshold decimal.Decimal
+	// How long owners can reopen the accounts they closed.
+	AccountReopenGracePeriod time.Duration
+	// How long a transfer held by an approval policy waits for its approvals.
+	PaymentRequestTTL time.Duration
+	// Transfers to accounts of other users are limited to PayeeCoolingOffLimit per transaction,
+	// unless they're payees saved longer than PayeeCoolingOff ago.
+	PayeeCoolingOff      time.Duration
+	PayeeCoolingOffLimit decimal.Decimal
+	// Four letters starting every account number, see accountNumber.
+	BankCode string
+	// Addresses or CIDRs of the proxies whose X-Forwarded-For is believed. None are by default, so the
+	// client IP used by rate limits and audit events is the address of the connection.
+	TrustedProxies []string
 }
 
 func New() Server {
 	repos := repository.New()
 
-	return Server{Repositories: repos}
+	ledger_signer, err := utils.SignerFromEnv("LEDGER_SIGNING_KEY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	receipts, err := ReceiptKeysFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return Server{
+		Repositories: repos,
+		Limiter:      ratelimit.New(repos.Valkey),
+		RateLimits:   ratelimit.ConfigFromEnv(),
+		// Private addresses are only reachable when testing webhooks locally.
+		WebhookClient:   NewWebhookClient(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"),
+		Sandbox:         os.Getenv("SANDBOX") == "true",
+		ProcessorSecret: os.Getenv("PROCESSOR_WEBHOOK_SECRET"),
+		Receipts:        receipts,
+
+		LedgerSigner:             ledger_signer,
+		LedgerCheckpointInterval: ledgerCheckpointIntervalFromEnv(),
+
+		AdjustmentDualApprovalThreshold: AdjustmentDualApprovalThresholdFromEnv(),
+		AccountReopenGracePeriod:        accountReopenGracePeriodFromEnv(),
+		PaymentRequestTTL:               paymentRequestTTLFromEnv(),
+		PayeeCoolingOff:                 payeeCoolingOffFromEnv(),
+		PayeeCoolingOffLimit:            payeeCoolingOffLimitFromEnv(),
+		BankCode:                        bankCodeFromEnv(),
+		TrustedProxies:                  trustedProxiesFromEnv(),
+	}
 }
 
-func (s *Server) SetupRouter() *gin.Engine {
-	router := gin.Default()
-	router.Use(CorsMiddleware())
+func trustedProxiesFromEnv() []string {
+	proxies := []string{}
+	for _, raw := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
 
-	router.GET("/health-check", func(ctx *gin.Context) { ctx.JSON(200, gin.H{"message": "Broke Bank"}) })
-	router.POST("/register", s.Register())
-	router.POST("/login", s.Login())
+		if _, _, err := net.ParseCIDR(raw); err != nil && net.ParseIP(raw) == nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES env: %q", raw)
+		}
+		proxies = append(proxies, raw)
+	}
+
+	return proxies
+}
+
+/*
+Unversioned routes are aliases of /v1, kept for clients built before versioning. They answer
+with Deprecation and Sunset headers and stop working at legacy_sunset.
+*/
+var (
+	legacy_deprecated_at = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacy_sunset        = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+type route struct {
+	method string
+	path   string
+	// Rate limit group, see ratelimit.Config.
+	group string
+	// Public routes don't require a session.
+	public bool
+	// Staff routes require a role with this permission, see AdminMiddleware.
+	permission permission
+	handler    gin.HandlerFunc
+}
+
+func (s *Server) v1Routes() []route {
+	return []route{
+		// User endpoints
+		{method: "POST", path: "/register", group: ratelimit.GroupAuth, public: true, handler: s.Register()},
+		{method: "POST", path: "/login", group: ratelimit.GroupAuth, public: true, handler: s.Login()},
+		{method: "GET", path: "/me", group: ratelimit.GroupDefault, handler: s.Me()},
+		{method: "GET", path: "/myAccounts", group: ratelimit.GroupDefault, handler: s.GetMyAccounts()},
+
+		// Account endpoints
+		{method: "GET", path: "/account/:id", group: ratelimit.GroupDefault, handler: s.GetAccount()},
+		{method: "POST", path: "/account/create", group: ratelimit.GroupDefault, handler: s.CreateAccount()},
+		{method: "PATCH", path: "/account/disable/:id", group: ratelimit.GroupDefault, handler: s.DisableAccount()},
+
+		// Transaction endpoints
+		{method: "GET", path: "/transaction/:id", group: ratelimit.GroupTransaction, handler: s.GetTransaction()},
+		{method: "POST", path: "/transaction/deposit", group: ratelimit.GroupTransaction, handler: s.DepositTransaction()},
+		{method: "POST", path: "/transaction/withdrawal", group: ratelimit.GroupTransaction, handler: s.WithdrawalTransaction()},
+		{method: "POST", path: "/transaction/transfer", group: ratelimit.GroupTransaction, handler: s.TransferTransaction()},
+	}
+}
+
+// v2Routes are the v1 routes, with the handlers whose request or response changed replaced.
+func (s *Server) v2Routes() []route {
+	return override(s.v1Routes(), []route{
+		{method: "GET", path: "/transaction/:id", group: ratelimit.GroupTransaction, handler: s.GetTransactionV2()},
+		{method: "GET", path: "/account/:id/transactions", group: ratelimit.GroupDefault, handler: s.GetAccountTransactions()},
+		{method: "POST", path: "/account/:id/close", group: ratelimit.GroupTransaction, handler: s.CloseAccount()},
+		{method: "POST", path: "/account/:id/reopen", group: ratelimit.GroupDefault, handler: s.ReopenAccount()},
+		{method: "GET", path: "/transaction/:id/receipt", group: ratelimit.GroupTransaction, handler: s.GetTransactionReceipt()},
+		{method: "GET", path: "/events", group: ratelimit.GroupDefault, handler: s.Events()},
+		{method: "GET", path: "/audit-events", group: ratelimit.GroupDefault, handler: s.GetAuditEvents()},
+
+		// Account member endpoints
+		{method: "GET", path: "/account/:id/members", group: ratelimit.GroupDefault, handler: s.GetAccountMembers()},
+		{method: "POST", path: "/account/:id/invitations", group: ratelimit.GroupDefault, handler: s.CreateInvitation()},
+		{method: "GET", path: "/account/:id/invitations", group: ratelimit.GroupDefault, handler: s.GetAccountInvitations()},
+		{method: "GET", path: "/invitations", group: ratelimit.GroupDefault, handler: s.GetMyInvitations()},
+		{method: "POST", path: "/invitations/:id/accept", group: ratelimit.GroupDefault, handler: s.AcceptInvitation()},
+		{method: "POST", path: "/invitations/:id/decline", group: ratelimit.GroupDefault, handler: s.DeclineInvitation()},
+		{method: "POST", path: "/account/:id/members/:user_id/removals", group: ratelimit.GroupDefault, handler: s.RequestMemberRemoval()},
+		{method: "GET", path: "/account/:id/removals", group: ratelimit.GroupDefault, handler: s.GetMemberRemovals()},
+		{method: "POST", path: "/account/:id/removals/:removal_id/approve", group: ratelimit.GroupDefault, handler: s.ApproveMemberRemoval()},
+		{method: "POST", path: "/account/:id/removals/:removal_id/reject", group: ratelimit.GroupDefault, handler: s.RejectMemberRemoval()},
+		{method: "GET", path: "/account/:id/approval-policy", group: ratelimit.GroupDefault, handler: s.GetApprovalPolicy()},
+		{method: "PUT", path: "/account/:id/approval-policy", group: ratelimit.GroupDefault, handler: s.SetApprovalPolicy()},
+		{method: "DELETE", path: "/account/:id/approval-policy", group: ratelimit.GroupDefault, handler: s.DeleteApprovalPolicy()},
+		{method: "GET", path: "/account/:id/payment-requests", group: ratelimit.GroupDefault, handler: s.GetPaymentRequests()},
+		{method: "GET", path: "/payment-requests/:id", group: ratelimit.GroupDefault, handler: s.GetPaymentRequest()},
+		{method: "POST", path: "/payment-requests/:id/approve", group: ratelimit.GroupTransaction, handler: s.ApprovePaymentRequest()},
+		{method: "POST", path: "/payment-requests/:id/reject", group: ratelimit.GroupDefault, handler: s.RejectPaymentRequest()},
 
-	router.Use(s.AuthMiddleware())
+		// Payee endpoints
+		{method: "GET", path: "/confirmation-of-payee", group: ratelimit.GroupTransaction, handler: s.ConfirmPayee()},
+		{method: "POST", path: "/payees", group: ratelimit.GroupDefault, handler: s.CreatePayee()},
+		{method: "GET", path: "/payees", group: ratelimit.GroupDefault, handler: s.GetPayees()},
+		{method: "GET", path: "/payees/:id", group: ratelimit.GroupDefault, handler: s.GetPayee()},
+		{method: "PATCH", path: "/payees/:id", group: ratelimit.GroupDefault, handler: s.RenamePayee()},
+		{method: "DELETE", path: "/payees/:id", group: ratelimit.GroupDefault, handler: s.DeletePayee()},
 
-	// User endpoints
-	router.GET("/me", s.Me())
-	router.GET("/myAccounts", s.GetMyAccounts())
+		// Handle endpoints
+		{method: "GET", path: "/me/handle", group: ratelimit.GroupDefault, handler: s.GetMyHandle()},
+		{method: "PUT", path: "/me/handle", group: ratelimit.GroupDefault, handler: s.SetHandle()},
+		{method: "DELETE", path: "/me/handle", group: ratelimit.GroupDefault, handler: s.DeleteMyHandle()},
 
-	// Account endpoints
-	router.GET("/account/:id", s.GetAccount())
-	router.POST("/account/create", s.CreateAccount())
-	router.PATCH("/account/disable/:id", s.DisableAccount())
+		// Webhook endpoints
+		{method: "POST", path: "/webhooks", group: ratelimit.GroupDefault, handler: s.CreateWebhook()},
+		{method: "GET", path: "/webhooks", group: ratelimit.GroupDefault, handler: s.GetWebhooks()},
+		{method: "DELETE", path: "/webhooks/:id", group: ratelimit.GroupDefault, handler: s.DeleteWebhook()},
+		{method: "GET", path: "/webhooks/:id/deliveries", group: ratelimit.GroupDefault, handler: s.GetWebhookDeliveries()},
+		{method: "GET", path: "/webhooks/:id/deliveries/:delivery_id", group: ratelimit.GroupDefault, handler: s.GetWebhookDelivery()},
+		{method: "POST", path: "/webhooks/:id/deliveries/:delivery_id/redeliver", group: ratelimit.GroupDefault, handler: s.RedeliverWebhook()},
+
+		// Receipt endpoints, public so that anyone shown a receipt can check it
+		{method: "POST", path: "/receipts/verify", group: ratelimit.GroupDefault, public: true, handler: s.VerifyReceipt()},
+		{method: "GET", path: "/receipts/keys", group: ratelimit.GroupDefault, public: true, handler: s.GetReceiptKeys()},
+
+		// Payment processor endpoints, authenticated by their signature
+		{method: "POST", path: "/processor/webhook", group: ratelimit.GroupDefault, public: true, handler: s.ProcessorWebhook()},
+
+		// Admin endpoints, for staff
+		{method: "GET", path: "/admin/users", group: ratelimit.GroupDefault, permission: permissionReadUsers, handler: s.AdminSearchUsers()},
+		{method: "GET", path: "/admin/users/:id", group: ratelimit.GroupDefault, permission: permissionReadUsers, handler: s.AdminGetUser()},
+		{method: "GET", path: "/admin/users/:id/accounts", group: ratelimit.GroupDefault, permission: permissionReadAccounts, handler: s.AdminGetUserAccounts()},
+		{method: "POST", path: "/admin/users/:id/logout", group: ratelimit.GroupDefault, permission: permissionRevokeSessions, handler: s.AdminLogoutUser()},
+		{method: "PUT", path: "/admin/users/:id/role", group: ratelimit.GroupDefault, permission: permissionWriteRoles, handler: s.AdminSetUserRole()},
+		{method: "GET", path: "/admin/accounts/:id", group: ratelimit.GroupDefault, permission: permissionReadAccounts, handler: s.AdminGetAccount()},
+		{method: "GET", path: "/admin/accounts/:id/transactions", group: ratelimit.GroupDefault, permission: permissionReadAccounts, handler: s.AdminGetAccountTransactions()},
+		{method: "POST", path: "/admin/accounts/:id/freeze", group: ratelimit.GroupDefault, permission: permissionFreezeAccounts, handler: s.AdminFreezeAccount()},
+		{method: "POST", path: "/admin/accounts/:id/unfreeze", group: ratelimit.GroupDefault, permission: permissionFreezeAccounts, handler: s.AdminUnfreezeAccount()},
+		{method: "POST", path: "/admin/adjustments", group: ratelimit.GroupDefault, permission: permissionProposeAdjustments, handler: s.CreateAdjustment()},
+		{method: "GET", path: "/admin/adjustments", group: ratelimit.GroupDefault, permission: permissionReadAccounts, handler: s.GetAdjustments()},
+		{method: "GET", path: "/admin/adjustments/:id", group: ratelimit.GroupDefault, permission: permissionReadAccounts, handler: s.GetAdjustment()},
+		{method: "POST", path: "/admin/adjustments/:id/approve", group: ratelimit.GroupTransaction, permission: permissionApproveAdjustments, handler: s.ApproveAdjustment()},
+		{method: "POST", path: "/admin/adjustments/:id/reject", group: ratelimit.GroupDefault, permission: permissionApproveAdjustments, handler: s.RejectAdjustment()},
+	})
+}
+
+func override(base []route, overrides []route) []route {
+	routes := append([]route{}, base...)
+	for _, o := range overrides {
+		replaced := false
+		for i, r := range routes {
+			if r.method == o.method && r.path == o.path {
+				routes[i], replaced = o, true
+			}
+		}
+		if !replaced {
+			routes = append(routes, o)
+		}
+	}
+
+	return routes
+}
+
+// mount registers routes on group behind the middleware every version shares.
+func (s *Server) mount(group *gin.RouterGroup, routes []route) {
+	authenticated := group.Group("", s.AuthMiddleware())
+
+	for _, r := range routes {
+		target := authenticated
+		if r.public {
+			target = group
+		}
+
+		handlers := []gin.HandlerFunc{s.RateLimitMiddleware(r.group)}
+		if r.permission != "" {
+			handlers = append(handlers, s.AdminMiddleware(r.permission))
+		}
+
+		target.Handle(r.method, r.path, append(handlers, r.handler)...)
+	}
+}
+
+func (s *Server) SetupRouter() *gin.Engine {
+	router := gin.Default()
+	// gin trusts every proxy unless told otherwise, letting anyone pick their IP with X-Forwarded-For.
+	if err := router.SetTrustedProxies(s.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
+	router.Use(CorsMiddleware(), AuditMiddleware())
+
+	router.GET("/health-check", func(ctx *gin.Context) { ctx.JSON(200, gin.H{"message": "Broke Bank"}) })
+	router.GET("/openapi.json", s.OpenAPI())
+	router.GET("/docs", s.Docs())
 
-	// Transaction endpoints
-	router.GET("/transaction/:id", s.GetTransaction())
-	router.POST("/transaction/deposit", s.DepositTransaction())
-	router.POST("/transaction/withdrawal", s.WithdrawalTransaction())
-	router.POST("/transaction/transfer", s.TransferTransaction())
+	s.mount(router.Group("/v1"), s.v1Routes())
+	s.mount(router.Group("/v2"), s.v2Routes())
+	s.mount(router.Group("", DeprecationMiddleware(legacy_deprecated_at, legacy_sunset, "/v1")), s.v1Routes())
 
 	return router
 }
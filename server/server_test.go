@@ -0,0 +1,372 @@
+package server
+
+import (
+	"broke-bank/ratelimit"
+	"broke-bank/repository/memory"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testClient struct {
+	t      *testing.T
+	router *gin.Engine
+	cookie *http.Cookie
+	// When set, every response is checked against openapi.json.
+	contract *contract
+	// Prepended to every path, e.g. "/v1".
+	prefix string
+}
+
+func newTestServer(t *testing.T) (*Server, *gin.Engine) {
+	t.Helper()
+	t.Setenv("ACCESS_CONTROL_ORIGIN", "http://localhost")
+	gin.SetMode(gin.TestMode)
+
+	receipt_signer, err := utils.NewSigner(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Repositories: memory.New(), Sandbox: true, Receipts: ReceiptKeys{Signer: receipt_signer}}
+	return s, s.SetupRouter()
+}
+
+func (c *testClient) do(method string, path string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	return c.doWithHeaders(method, path, body, nil)
+}
+
+func (c *testClient) doWithHeaders(method string, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	path = c.prefix + path
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+
+	if c.contract != nil {
+		c.contract.check(method, path, w)
+	}
+
+	return w
+}
+
+/*
+doStreaming requests a streaming endpoint, which only answers once the client disconnects,
+disconnecting after timeout.
+*/
+func (c *testClient) doStreaming(path string, headers map[string]string, timeout time.Duration) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	path = c.prefix + path
+	req := httptest.NewRequestWithContext(ctx, "GET", path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+
+	if c.contract != nil {
+		c.contract.check("GET", path, w)
+	}
+
+	return w
+}
+
+// signUp registers and logs in a new user, keeping the session cookie for later requests.
+func signUp(t *testing.T, router *gin.Engine, email string) *testClient {
+	t.Helper()
+
+	c := &testClient{t: t, router: router}
+	credentials := map[string]string{"email": email, "password": "password123"}
+
+	if w := c.do("POST", "/register", credentials); w.Code != 200 {
+		t.Fatalf("POST /register = %d: %s", w.Code, w.Body)
+	}
+
+	w := c.do("POST", "/login", credentials)
+	if w.Code != 200 {
+		t.Fatalf("POST /login = %d: %s", w.Code, w.Body)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "sessionId" {
+			c.cookie = cookie
+		}
+	}
+	if c.cookie == nil {
+		t.Fatal("POST /login did not set the sessionId cookie")
+	}
+
+	return c
+}
+
+func decodePayload[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	body := struct {
+		Payload T `json:"payload"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response body %s: %s", w.Body, err)
+	}
+
+	return body.Payload
+}
+
+// createAccount creates an account for the client's user and returns its id.
+func (c *testClient) createAccount(name string) string {
+	c.t.Helper()
+
+	if w := c.do("POST", "/account/create", map[string]string{"name": name}); w.Code != 200 {
+		c.t.Fatalf("POST /account/create = %d: %s", w.Code, w.Body)
+	}
+
+	accounts := decodePayload[[]GetAccountsResponse](c.t, c.do("GET", "/myAccounts?limit=100", nil))
+	for _, account := range accounts {
+		if account.Name == name {
+			return account.Id.String()
+		}
+	}
+
+	c.t.Fatalf("account %q not found in /myAccounts", name)
+	return ""
+}
+
+func (c *testClient) balance(account_id string) string {
+	c.t.Helper()
+
+	w := c.do("GET", "/account/"+account_id, nil)
+	if w.Code != 200 {
+		c.t.Fatalf("GET /account/%s = %d: %s", account_id, w.Code, w.Body)
+	}
+
+	return decodePayload[GetAccountResponse](c.t, w).Balance
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	_, router := newTestServer(t)
+	c := signUp(t, router, "alice@broke.bank")
+
+	w := c.do("GET", "/me", nil)
+	if w.Code != 200 {
+		t.Fatalf("GET /me = %d: %s", w.Code, w.Body)
+	}
+	if me := decodePayload[MeResponse](t, w); me.Email != "alice@broke.bank" {
+		t.Fatalf("GET /me email = %s", me.Email)
+	}
+
+	anonymous := &testClient{t: t, router: router}
+	if w = anonymous.do("POST", "/register", map[string]string{"email": "alice@broke.bank", "password": "password123"}); w.Code != 409 {
+		t.Fatalf("registering a taken email = %d, want 409", w.Code)
+	}
+	if w = anonymous.do("POST", "/login", map[string]string{"email": "alice@broke.bank", "password": "wrong-password"}); w.Code != 409 {
+		t.Fatalf("login with a wrong password = %d, want 409", w.Code)
+	}
+	if w = anonymous.do("GET", "/me", nil); w.Code != 401 {
+		t.Fatalf("GET /me without session = %d, want 401", w.Code)
+	}
+}
+
+func TestDisabledUserIsLoggedOut(t *testing.T) {
+	s, router := newTestServer(t)
+	c := signUp(t, router, "bob@broke.bank")
+
+	user, err := s.Repositories.UserRepository.GetUserByEmail(context.Background(), "bob@broke.bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Repositories.UserRepository.DisableUser(context.Background(), user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := c.do("GET", "/me", nil); w.Code != 401 {
+		t.Fatalf("GET /me for a disabled user = %d, want 401", w.Code)
+	}
+	if w := c.do("POST", "/login", map[string]string{"email": "bob@broke.bank", "password": "password123"}); w.Code != 403 {
+		t.Fatalf("login for a disabled user = %d, want 403", w.Code)
+	}
+}
+
+func TestMoneyMovements(t *testing.T) {
+	_, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+
+	checking := alice.createAccount("Checking")
+	savings := bob.createAccount("Savings")
+
+	if w := alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking}); w.Code != 200 {
+		t.Fatalf("deposit = %d: %s", w.Code, w.Body)
+	}
+	if w := alice.do("POST", "/transaction/withdrawal", map[string]string{"amount": "10.00", "from_account_id": checking}); w.Code != 200 {
+		t.Fatalf("withdrawal = %d: %s", w.Code, w.Body)
+	}
+	if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings}); w.Code != 200 {
+		t.Fatalf("transfer = %d: %s", w.Code, w.Body)
+	}
+
+	if balance := alice.balance(checking); balance != "64.50" {
+		t.Fatalf("checking balance = %s, want 64.50", balance)
+	}
+	if balance := bob.balance(savings); balance != "25.50" {
+		t.Fatalf("savings balance = %s, want 25.50", balance)
+	}
+
+	if w := alice.do("POST", "/transaction/transfer", map[string]string{"amount": "1000.00", "from_account_id": checking, "to_account_id": savings}); w.Code == 200 {
+		t.Fatal("transfer above the balance succeeded")
+	}
+	if w := bob.do("POST", "/transaction/transfer", map[string]string{"amount": "1.00", "from_account_id": checking, "to_account_id": savings}); w.Code == 200 {
+		t.Fatal("transfer from someone else's account succeeded")
+	}
+	if w := bob.do("GET", "/account/"+checking, nil); w.Code == 200 {
+		t.Fatal("reading someone else's account succeeded")
+	}
+
+	if balance := alice.balance(checking); balance != "64.50" {
+		t.Fatalf("checking balance after rejected transfers = %s, want 64.50", balance)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s, router := newTestServer(t)
+	limiter := ratelimit.NewMemoryLimiter()
+	// A frozen clock, so that no token refills between requests however slow the run.
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+	s.Limiter = limiter
+	s.RateLimits = ratelimit.Config{ratelimit.GroupAuth: {ratelimit.ScopeIP: {Requests: 2, Window: time.Minute}}}
+
+	anonymous := &testClient{t: t, router: router}
+	credentials := map[string]string{"email": "carol@broke.bank", "password": "password123"}
+
+	w := anonymous.do("POST", "/register", credentials)
+	if w.Code != 200 || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("POST /register = %d with headers %v", w.Code, w.Header())
+	}
+	if w = anonymous.do("POST", "/login", credentials); w.Code != 200 {
+		t.Fatalf("POST /login = %d: %s", w.Code, w.Body)
+	}
+
+	w = anonymous.do("POST", "/login", credentials)
+	if w.Code != 429 || w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Fatalf("POST /login over the limit = %d with headers %v", w.Code, w.Header())
+	}
+
+	// Without trusted proxies, X-Forwarded-For can't pass for another client.
+	if w = anonymous.doWithHeaders("POST", "/login", credentials, map[string]string{"X-Forwarded-For": "203.0.113.7"}); w.Code != 429 {
+		t.Fatalf("POST /login with a forged X-Forwarded-For = %d: %s", w.Code, w.Body)
+	}
+
+	// One token refills every 30 seconds.
+	now = now.Add(30 * time.Second)
+	if w = anonymous.do("POST", "/login", credentials); w.Code != 200 {
+		t.Fatalf("POST /login after the refill = %d: %s", w.Code, w.Body)
+	}
+
+	// Routes outside the group aren't affected.
+	if w = anonymous.do("GET", "/health-check", nil); w.Code != 200 {
+		t.Fatalf("GET /health-check = %d", w.Code)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	s, _ := newTestServer(t)
+	limiter := ratelimit.NewMemoryLimiter()
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+	s.Limiter = limiter
+	s.RateLimits = ratelimit.Config{ratelimit.GroupAuth: {ratelimit.ScopeIP: {Requests: 1, Window: time.Minute}}}
+	// httptest requests come from 192.0.2.1.
+	s.TrustedProxies = []string{"192.0.2.0/24"}
+	router := s.SetupRouter()
+
+	anonymous := &testClient{t: t, router: router}
+	credentials := map[string]string{"email": "carol@broke.bank", "password": "password123"}
+
+	for _, ip := range []string{"203.0.113.7", "203.0.113.8"} {
+		if w := anonymous.doWithHeaders("POST", "/register", credentials, map[string]string{"X-Forwarded-For": ip}); w.Code == 429 {
+			t.Fatalf("POST /register through the proxy for %s = %d", ip, w.Code)
+		}
+	}
+	if w := anonymous.doWithHeaders("POST", "/login", credentials, map[string]string{"X-Forwarded-For": "203.0.113.7"}); w.Code != 429 {
+		t.Fatalf("POST /login through the proxy over the limit = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+
+	w := alice.do("GET", "/me", nil)
+	if w.Code != 200 || w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") == "" || w.Header().Get("Link") != `</v1/me>; rel="successor-version"` {
+		t.Fatalf("legacy GET /me = %d with headers %v", w.Code, w.Header())
+	}
+
+	alice.prefix, bob.prefix = "/v1", "/v1"
+	if w = alice.do("GET", "/me", nil); w.Code != 200 || w.Header().Get("Deprecation") != "" {
+		t.Fatalf("GET /v1/me = %d with headers %v", w.Code, w.Header())
+	}
+
+	checking := alice.createAccount("Checking")
+	if w = alice.do("POST", "/transaction/deposit", map[string]string{"amount": "12.5", "to_account_id": checking}); w.Code != 200 {
+		t.Fatalf("deposit = %d: %s", w.Code, w.Body)
+	}
+	transactions, err := s.Repositories.TransactionRepository.GetAccountTransactions(context.Background(), checking, 1, 0)
+	if err != nil || len(*transactions) != 1 {
+		t.Fatalf("GetAccountTransactions = %v, %v", transactions, err)
+	}
+	path := "/transaction/" + (*transactions)[0].Id.String()
+
+	// v1 returns the raw row to anyone, v2 only to the owner and with a stable shape.
+	if w = bob.do("GET", path, nil); w.Code != 200 {
+		t.Fatalf("GET /v1%s by another user = %d", path, w.Code)
+	}
+
+	alice.prefix, bob.prefix = "/v2", "/v2"
+	if w = bob.do("GET", path, nil); w.Code != 404 {
+		t.Fatalf("GET /v2%s by another user = %d, want 404", path, w.Code)
+	}
+	w = alice.do("GET", path, nil)
+	if w.Code != 200 {
+		t.Fatalf("GET /v2%s = %d: %s", path, w.Code, w.Body)
+	}
+	if transaction := decodePayload[GetTransactionResponse](t, w); transaction.Amount != "12.50" || transaction.Type != "deposit" || transaction.IssuedAt.IsZero() {
+		t.Fatalf("GET /v2%s = %+v", path, transaction)
+	}
+}
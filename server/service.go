@@ -0,0 +1,342 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+/*
+The operations below are shared by the REST handlers and the gRPC service, so that both APIs
+apply the same rules. Each API only decodes its requests and translates the errors, see
+restError and grpcError.
+*/
+
+// Expected errors, whose messages are the ones both APIs answer with.
+var (
+	errInvalidInput          = errors.New("Invalid input")
+	errNotAccountOwner       = errors.New("This account does not belongs to the user")
+	errAccountNotFound       = errors.New("Account not found")
+	errTransactionNotFound   = errors.New("Transaction not found")
+	errAccountHasBalance     = errors.New("Account still has balance and cannot be deleted")
+	errAccountBusy           = errors.New("Account is busy, try again later")
+	errDuplicatedTransaction = errors.New("Duplicated transaction")
+	errIdempotencyKeyReused  = errors.New("Idempotency key reused with a different request")
+	errWebhookNotFound       = errors.New("Webhook not found")
+	errDeliveryNotFound      = errors.New("Webhook delivery not found")
+	errTooManyWebhooks       = errors.New("Too many webhooks")
+	errDepositsDisabled      = errors.New("Deposits only come from the payment processor outside of sandbox mode")
+)
+
+// failure is an unexpected error, answered with message while err is only logged.
+type failure struct {
+	message string
+	err     error
+}
+
+func (f *failure) Error() string {
+	return f.message + ": " + f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// ownedAccount returns an account of which the user is an owner, see memberAccount.
+func (s *Server) ownedAccount(ctx context.Context, caller string, user *model.User, account_id string) (*model.Account, error) {
+	account, member, err := s.memberAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if member.Role != model.MemberOwner {
+		return nil, errOwnersOnly
+	}
+
+	return account, nil
+}
+
+func (s *Server) createAccount(ctx context.Context, caller string, user *model.User, name string) error {
+	err := s.Repositories.AccountRepository.CreateAccount(ctx, user.Id.String(), name, "active")
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to create account: %s\n", caller, err)
+		return &failure{"Failed to create account", err}
+	}
+
+	return nil
+}
+
+/*
+disableAccount only disables empty accounts, so that no money is left unreachable and no debt
+forgotten. Accounts with money in them are closed instead, see closeAccount.
+*/
+func (s *Server) disableAccount(ctx context.Context, caller string, user *model.User, account_id string) error {
+	account, err := s.ownedAccount(ctx, caller, user, account_id)
+	if err != nil {
+		return err
+	}
+
+	if !account.Balance.IsZero() {
+		return errAccountHasBalance
+	}
+
+	// Owners can't get rid of a frozen account, even an empty one.
+	if err = repository.CheckAccountStatus(account.Status, account.FrozenUntil, true); errors.Is(err, repository.ErrAccountFrozen) {
+		return err
+	}
+
+	if err = s.Repositories.AccountRepository.DisableAccount(ctx, account_id); err != nil {
+		log.Printf("[ERROR] [%s] failed to disable account: %s\n", caller, err)
+		return &failure{"Failed to disable account", err}
+	}
+
+	s.publishAccountEvent(ctx, caller, account.Id, EventAccountDisabled, AccountDisabledEvent{AccountId: account.Id})
+
+	return nil
+}
+
+/*
+visibleTransaction returns a transaction touching an account the user is a member of, and
+errTransactionNotFound for every other id so that ids of other users can't be probed.
+*/
+func (s *Server) visibleTransaction(ctx context.Context, caller string, user *model.User, transaction_id string) (*model.Transaction, error) {
+	transaction, err := s.Repositories.TransactionRepository.GetTransaction(ctx, transaction_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTransactionNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get transaction: %s, transaction ID: %s\n", caller, err, transaction_id)
+		return nil, &failure{"Failed to get transaction", err}
+	}
+
+	for _, account_id := range []*uuid.UUID{transaction.FromAccountId, transaction.ToAccountId} {
+		if account_id == nil {
+			continue
+		}
+
+		_, err := s.Repositories.MemberRepository.GetAccountMember(ctx, *account_id, user.Id)
+		if err == nil {
+			return transaction, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, account_id)
+			return nil, &failure{"Failed to get transaction", err}
+		}
+	}
+
+	return nil, errTransactionNotFound
+}
+
+// accountTransactions lists the transactions of an account the user is a member of, newest first.
+func (s *Server) accountTransactions(ctx context.Context, caller string, user *model.User, account_id string, limit int, offset int) ([]model.Transaction, error) {
+	if limit < 0 || offset < 0 {
+		return nil, errInvalidInput
+	}
+
+	if limit == 0 {
+		limit = 10
+	}
+
+	if _, _, err := s.visibleAccount(ctx, caller, user, account_id); err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.Repositories.TransactionRepository.GetAccountTransactions(ctx, account_id, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get transactions: %s, account ID: %s\n", caller, err, account_id)
+		return nil, &failure{"Failed to get transactions", err}
+	}
+
+	return *transactions, nil
+}
+
+// movement is a deposit, withdrawal or transfer requested by a user.
+type movement struct {
+	// 'deposit' | 'withdrawal' | 'transfer'
+	kind            string
+	amount          decimal.Decimal
+	from_account_id string
+	to_account_id   string
+}
+
+func (m movement) valid() bool {
+	if m.amount.LessThan(decimal.NewFromInt(0)) {
+		return false
+	}
+
+	if m.kind != "transfer" {
+		return true
+	}
+
+	// Ids are compared parsed, so that one account spelled in a different case isn't taken for two.
+	from_id, from_err := uuid.Parse(m.from_account_id)
+	to_id, to_err := uuid.Parse(m.to_account_id)
+	if from_err != nil || to_err != nil {
+		return m.from_account_id != m.to_account_id
+	}
+
+	return from_id != to_id
+}
+
+/*
+move executes a money movement and returns the id of its transaction. With an idempotency key,
+a movement that was already executed is replayed: it succeeds again without moving money.
+Withdrawals and transfers held by the approval policy of their account fail with a *debitHeld
+instead.
+*/
+func (s *Server) move(ctx context.Context, caller string, user *model.User, idempotency_key string, m movement) (transaction_id uuid.UUID, replayed bool, err error) {
+	if !m.valid() {
+		return uuid.Nil, false, errInvalidInput
+	}
+
+	if m.kind == "deposit" && !s.Sandbox {
+		return uuid.Nil, false, errDepositsDisabled
+	}
+
+	transaction_id, idempotent, err := newTransactionId(user, idempotency_key)
+	if errors.Is(err, errInvalidIdempotencyKey) {
+		return uuid.Nil, false, errInvalidInput
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] an unexpected error occurred while creating transaction ID: %s\n", caller, err)
+		return uuid.Nil, false, &failure{"Failed to complete " + m.kind + " transaction", err}
+	}
+
+	// Replays are answered first: the balance checked below may already include the original movement.
+	if replayed, err = s.replayMovement(ctx, caller, transaction_id, idempotent, m); replayed || err != nil {
+		return transaction_id, replayed, err
+	}
+	// Held debits are replayed with their payment request until it executes, then like the others.
+	if m.kind != "deposit" && idempotent {
+		if err = s.replayPaymentRequest(ctx, caller, transaction_id, m); err != nil {
+			return transaction_id, false, err
+		}
+	}
+
+	// Receivers may be named by account number or handle, from here on they're ids.
+	if m.kind == "transfer" {
+		if m.to_account_id, err = s.resolveReceiver(ctx, caller, m.to_account_id); err != nil {
+			return transaction_id, false, err
+		}
+		// A number or handle may name the sender itself.
+		if !m.valid() {
+			return transaction_id, false, errInvalidInput
+		}
+	}
+
+	if m.kind != "deposit" {
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx, m.from_account_id)
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get sender account: %s, account ID: %s\n", caller, err, m.from_account_id)
+			message := "Failed to get sender account"
+			if m.kind == "withdrawal" {
+				message = "Failed to get account"
+			}
+			return transaction_id, false, &failure{message, err}
+		}
+
+		member, err := s.Repositories.MemberRepository.GetAccountMember(ctx, account.Id, user.Id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return transaction_id, false, errNotAccountOwner
+		}
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get account member: %s, account ID: %s\n", caller, err, m.from_account_id)
+			return transaction_id, false, &failure{"Failed to complete " + m.kind + " transaction", err}
+		}
+
+		// Owners spend without limit, spenders up to theirs per transaction and viewers not at all.
+		if err = canSpend(member, m.amount); err != nil {
+			return transaction_id, false, err
+		}
+
+		if err = repository.CheckAccountStatus(account.Status, account.FrozenUntil, true); err != nil {
+			return transaction_id, false, err
+		}
+
+		if account.Balance.LessThan(m.amount) {
+			return transaction_id, false, repository.ErrInsufficientBalance
+		}
+	}
+
+	if m.kind == "transfer" {
+		receiver, err := s.Repositories.AccountRepository.GetAccount(ctx, m.to_account_id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return transaction_id, false, errReceiverNotFound
+		}
+		if err != nil {
+			log.Printf("[ERROR] [%s] failed to get receiver account: %s, account ID: %s\n", caller, err, m.to_account_id)
+			return transaction_id, false, &failure{"Failed to get receiver account", err}
+		}
+
+		if err = repository.CheckAccountStatus(receiver.Status, receiver.FrozenUntil, false); err != nil {
+			return transaction_id, false, err
+		}
+
+		if err = s.checkCoolingOff(ctx, caller, user.Id, receiver.Id, m.amount); err != nil {
+			return transaction_id, false, err
+		}
+	}
+
+	// Only debits that could execute now are held, they're checked again once approved.
+	if m.kind != "deposit" {
+		if err = s.holdDebit(ctx, caller, user, transaction_id, m); err != nil {
+			return transaction_id, false, err
+		}
+	}
+
+	// Any movement can lose a serialization race, even on one account against a concurrent transfer or closure sweep.
+	const max_retries = 5
+
+	for i := 0; i < max_retries; i++ {
+		switch m.kind {
+		case "deposit":
+			err = s.Repositories.TransactionRepository.DepositTransaction(ctx, transaction_id, m.to_account_id, m.amount)
+		case "withdrawal":
+			err = s.Repositories.TransactionRepository.WithdrawalTransaction(ctx, transaction_id, m.from_account_id, m.amount)
+		case "transfer":
+			err = s.Repositories.TransactionRepository.TransferTransaction(ctx, transaction_id, m.from_account_id, m.to_account_id, m.amount)
+		}
+		if err == nil {
+			s.publishMovementEvents(ctx, caller, transaction_id)
+			return transaction_id, false, nil
+		}
+
+		if errors.Is(err, repository.ErrSameAccount) {
+			return transaction_id, false, errInvalidInput
+		}
+
+		// The balance and statuses may have changed since they were checked above.
+		if errors.Is(err, repository.ErrInsufficientBalance) || errors.Is(err, repository.ErrAccountFrozen) || errors.Is(err, repository.ErrAccountClosed) {
+			return transaction_id, false, err
+		}
+
+		// Waiting again for a lock that just timed out would only hold the request longer.
+		if errors.Is(err, repository.ErrLockTimeout) || errors.Is(err, repository.ErrQueryTimeout) {
+			log.Printf("[ERROR] [%s] timed out: %s\n", caller, err)
+			return transaction_id, false, errAccountBusy
+		}
+
+		// A concurrent retry of the same idempotent request may have won the race.
+		if idempotent {
+			if replayed, replay_err := s.replayMovement(ctx, caller, transaction_id, idempotent, m); replayed || replay_err != nil {
+				return transaction_id, replayed, replay_err
+			}
+		}
+
+		if !repository.IsRetryable(err) || (i+1) == max_retries {
+			break
+		}
+
+		time.Sleep(time.Millisecond * time.Duration(300*i))
+	}
+
+	log.Printf("[ERROR] [%s] failed to complete %s transaction: %s\n", caller, m.kind, err)
+	return transaction_id, false, &failure{"Failed to complete " + m.kind + " transaction", err}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"broke-bank/model"
 	"broke-bank/utils"
 	"log"
 	"time"
@@ -18,7 +19,7 @@ func (s *Server) GetTransaction() gin.HandlerFunc {
 			return
 		}
 
-		transaction, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id)
+		transaction, err := s.Repositories.TransactionRepository.GetTransaction(ctx.Request.Context(), transaction_id)
 		if err != nil {
 			log.Printf("[ERROR] [GetTransaction] failed to get transaction: %s, transaction ID: %s\n", err, transaction_id)
 			ctx.JSON(500, gin.H{"error": "Failed to get transaction"})
@@ -29,183 +30,219 @@ func (s *Server) GetTransaction() gin.HandlerFunc {
 	}
 }
 
-type DepositTransactionRequest struct {
-	Amount      decimal.Decimal `json:"amount"`
-	ToAccountId string          `json:"to_account_id"`
+type GetTransactionResponse struct {
+	Id uuid.UUID `json:"id"`
+	// 'deposit' | 'withdrawal' | 'transfer' | 'adjustment'
+	Type string `json:"type"`
+	// Amount with 2 decimal places.
+	Amount        string     `json:"amount"`
+	FromAccountId *uuid.UUID `json:"from_account_id"`
+	ToAccountId   *uuid.UUID `json:"to_account_id"`
+	IssuedAt      time.Time  `json:"issued_at"`
+	// Set when this transaction reverses another one.
+	ReversalOf *uuid.UUID `json:"reversal_of"`
 }
 
-func (s *Server) DepositTransaction() gin.HandlerFunc {
+/*
+GetTransactionV2 only shows transactions touching an account the user is a member of, answering 404
+for every other id, and returns a GetTransactionResponse instead of the raw transaction row.
+*/
+func (s *Server) GetTransactionV2() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		req := DepositTransactionRequest{}
-		if ctx.ShouldBindJSON(&req) != nil || req.Amount.LessThan(decimal.NewFromInt(0)) {
-			ctx.JSON(422, gin.H{"error": "Invalid input"})
+		transaction_id := ctx.Param("id")
+		if transaction_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing id param"})
 			return
 		}
 
-		transaction_id, err := uuid.NewV7()
+		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Println("[ERROR] [DepositTransaction] an unexpected error occurred while creating transaction ID: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete deposit transaction"})
-			return
-		}
-
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			log.Println("[ERROR] [DepositTransaction] duplicated transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
+			log.Println("[ERROR] [GetTransactionV2] failed to get user from context: ", err)
+			ctx.Status(401)
 			return
 		}
 
-		err = s.Repositories.TransactionRepository.DepositTransaction(transaction_id, req.ToAccountId, req.Amount)
+		transaction, err := s.visibleTransaction(ctx.Request.Context(), "GetTransactionV2", user, transaction_id)
 		if err != nil {
-			log.Println("[ERROR] [DepositTransaction] failed to complete deposit transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete deposit transaction"})
+			restError(ctx, err)
 			return
 		}
 
-		ctx.Status(200)
+		ctx.JSON(200, gin.H{"payload": newTransactionResponse(transaction)})
 	}
 }
 
-type WithdrawalTransactionRequest struct {
-	Amount        decimal.Decimal `json:"amount"`
-	FromAccountId string          `json:"from_account_id"`
+func newTransactionResponse(transaction *model.Transaction) GetTransactionResponse {
+	return GetTransactionResponse{
+		Id:            transaction.Id,
+		Type:          transaction.Type,
+		Amount:        transaction.Amount.StringFixed(2),
+		FromAccountId: transaction.FromAccountId,
+		ToAccountId:   transaction.ToAccountId,
+		IssuedAt:      transaction.DateIssued,
+		ReversalOf:    transaction.ReversalOf,
+	}
 }
 
-func (s *Server) WithdrawalTransaction() gin.HandlerFunc {
+type GetAccountTransactionsRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// GetAccountTransactions lists the transactions of an account the user is a member of, newest first.
+func (s *Server) GetAccountTransactions() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		req := WithdrawalTransactionRequest{}
-		if ctx.ShouldBindJSON(&req) != nil || req.Amount.LessThan(decimal.NewFromInt(0)) {
-			ctx.JSON(422, gin.H{"error": "Invalid input"})
+		account_id := ctx.Param("id")
+		if account_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing id param"})
+			return
+		}
+
+		req := GetAccountTransactionsRequest{}
+		if ctx.ShouldBindQuery(&req) != nil || req.Limit < 0 || req.Offset < 0 {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
 			return
 		}
 
 		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Println("[ERROR] [WithdrawalTransaction] failed to get user from context: ", err)
+			log.Println("[ERROR] [GetAccountTransactions] failed to get user from context: ", err)
 			ctx.Status(401)
 			return
 		}
 
-		account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
+		raw_transactions, err := s.accountTransactions(ctx.Request.Context(), "GetAccountTransactions", user, account_id, req.Limit, req.Offset)
 		if err != nil {
-			log.Printf("[ERROR] [WithdrawalTransaction] failed to get account: %s, account ID: %s\n", err, req.FromAccountId)
-			ctx.JSON(500, gin.H{"error": "Failed to get account"})
+			restError(ctx, err)
 			return
 		}
 
-		if account.UserId != user.Id {
-			ctx.JSON(500, gin.H{"error": "This account does not belongs to the user"})
-			return
+		transactions := []GetTransactionResponse{}
+		for i := range raw_transactions {
+			transactions = append(transactions, newTransactionResponse(&raw_transactions[i]))
 		}
 
-		if account.Balance.LessThan(req.Amount) {
-			ctx.JSON(500, gin.H{"error": "Insufficient account balance"})
-			return
-		}
+		ctx.JSON(200, gin.H{"payload": transactions})
+	}
+}
 
-		transaction_id, err := uuid.NewV7()
-		if err != nil {
-			log.Println("[ERROR] [WithdrawalTransaction] an unexpected error occurred while creating transaction ID: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
+type DepositTransactionRequest struct {
+	Amount      decimal.Decimal `json:"amount"`
+	ToAccountId string          `json:"to_account_id"`
+}
+
+func (s *Server) DepositTransaction() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := DepositTransactionRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
 			return
 		}
 
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			log.Println("[ERROR] [WithdrawalTransaction] duplicated transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [DepositTransaction] failed to get user from context: ", err)
+			ctx.Status(401)
 			return
 		}
 
-		err = s.Repositories.TransactionRepository.WithdrawalTransaction(transaction_id, req.FromAccountId, req.Amount)
+		_, replayed, err := s.move(ctx.Request.Context(), "DepositTransaction", user, ctx.GetHeader(IdempotencyKeyHeader), movement{
+			kind:          "deposit",
+			amount:        req.Amount,
+			to_account_id: req.ToAccountId,
+		})
 		if err != nil {
-			log.Println("[ERROR] [WithdrawalTransaction] failed to complete withdrawal transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
+			restError(ctx, err)
 			return
 		}
 
+		if replayed {
+			ctx.Header("Idempotent-Replayed", "true")
+		}
 		ctx.Status(200)
 	}
 }
 
-type TransferTransactionRequest struct {
+type WithdrawalTransactionRequest struct {
 	Amount        decimal.Decimal `json:"amount"`
 	FromAccountId string          `json:"from_account_id"`
-	ToAccountId   string          `json:"to_account_id"`
 }
 
-func (s *Server) TransferTransaction() gin.HandlerFunc {
+func (s *Server) WithdrawalTransaction() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		req := TransferTransactionRequest{}
-		if ctx.ShouldBindJSON(&req) != nil || req.Amount.LessThan(decimal.NewFromInt(0)) || req.FromAccountId == req.ToAccountId {
+		req := WithdrawalTransactionRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
 			ctx.JSON(422, gin.H{"error": "Invalid input"})
 			return
 		}
 
 		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to get user from context: ", err)
+			log.Println("[ERROR] [WithdrawalTransaction] failed to get user from context: ", err)
 			ctx.Status(401)
 			return
 		}
 
-		from_account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
+		_, replayed, err := s.move(ctx.Request.Context(), "WithdrawalTransaction", user, ctx.GetHeader(IdempotencyKeyHeader), movement{
+			kind:            "withdrawal",
+			amount:          req.Amount,
+			from_account_id: req.FromAccountId,
+		})
+		// Like transfers, withdrawals held by the approval policy of their account execute once approved.
+		if respondHeld(ctx, err) {
+			return
+		}
 		if err != nil {
-			log.Printf("[ERROR] [TransferTransaction] failed to get sender account: %s, account ID: %s\n", err, req.FromAccountId)
-			ctx.JSON(500, gin.H{"error": "Failed to get sender account"})
+			restError(ctx, err)
 			return
 		}
 
-		if from_account.UserId != user.Id {
-			ctx.JSON(500, gin.H{"error": "This account does not belongs to the user"})
-			return
+		if replayed {
+			ctx.Header("Idempotent-Replayed", "true")
 		}
+		ctx.Status(200)
+	}
+}
 
-		if from_account.Balance.LessThan(req.Amount) {
-			ctx.JSON(500, gin.H{"error": "Insufficient account balance"})
+type TransferTransactionRequest struct {
+	Amount        decimal.Decimal `json:"amount"`
+	FromAccountId string          `json:"from_account_id"`
+	ToAccountId   string          `json:"to_account_id"`
+}
+
+func (s *Server) TransferTransaction() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := TransferTransactionRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
 			return
 		}
 
-		_, err = s.Repositories.AccountRepository.GetAccount(req.ToAccountId)
+		user, err := utils.GetUser(ctx)
 		if err != nil {
-			log.Printf("[ERROR] [TransferTransaction] failed to get receiver account: %s, account ID: %s\n", err, req.ToAccountId)
-			ctx.JSON(500, gin.H{"error": "Failed to get receiver account"})
+			log.Println("[ERROR] [TransferTransaction] failed to get user from context: ", err)
+			ctx.Status(401)
 			return
 		}
 
-		transaction_id, err := uuid.NewV7()
-		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] an unexpected error occurred while creating transaction ID: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
+		_, replayed, err := s.move(ctx.Request.Context(), "TransferTransaction", user, ctx.GetHeader(IdempotencyKeyHeader), movement{
+			kind:            "transfer",
+			amount:          req.Amount,
+			from_account_id: req.FromAccountId,
+			to_account_id:   req.ToAccountId,
+		})
+		// Transfers held by the approval policy of their account are accepted, to execute once approved.
+		if respondHeld(ctx, err) {
 			return
 		}
-
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			log.Println("[ERROR] [TransferTransaction] duplicated transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
+		if err != nil {
+			restError(ctx, err)
 			return
 		}
 
-		max_retries := 5
-
-		for i := 0; i < max_retries; i++ {
-			err = s.Repositories.TransactionRepository.TransferTransaction(transaction_id, req.FromAccountId, req.ToAccountId, req.Amount)
-			if err == nil {
-				ctx.Status(200)
-				return
-			}
-
-			if (i + 1) == max_retries {
-				log.Println("[ERROR] [TransferTransaction] failed to complete transfer transaction: ", err)
-				ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
-				return
-			}
-
-			time.Sleep(time.Millisecond * time.Duration(300*i))
+		if replayed {
+			ctx.Header("Idempotent-Replayed", "true")
 		}
-
 		ctx.Status(200)
 	}
 }
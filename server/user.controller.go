@@ -1,9 +1,12 @@
 package server
 
 import (
+	"broke-bank/model"
+	"broke-bank/repository"
 	"broke-bank/utils"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -29,9 +32,9 @@ func (s *Server) Register() gin.HandlerFunc {
 			ctx.JSON(500, gin.H{"error": "Failed to hash password"})
 			return
 		}
-		_, err = s.Repositories.UserRepository.GetUserByEmail(req.Email)
+		_, err = s.Repositories.UserRepository.GetUserByEmail(ctx.Request.Context(), req.Email)
 		if err != nil && err == sql.ErrNoRows {
-			err := s.Repositories.UserRepository.CreateUser(req.Email, string(encrypted_password))
+			err := s.Repositories.UserRepository.CreateUser(ctx.Request.Context(), req.Email, string(encrypted_password))
 			if err != nil {
 				log.Println("[ERROR] [Register] failed to create user: ", err)
 				ctx.JSON(500, gin.H{"error": "Failed to create user"})
@@ -51,6 +54,12 @@ func (s *Server) Register() gin.HandlerFunc {
 	}
 }
 
+// Details of user.login_failed audit events.
+type loginFailure struct {
+	// 'unknown_email' | 'wrong_password' | 'disabled'
+	Failure string `json:"failure"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required"`
 	Password string `json:"password" validate:"required,min=8,max=255"`
@@ -65,18 +74,30 @@ func (s *Server) Login() gin.HandlerFunc {
 			return
 		}
 
-		user, err := s.Repositories.UserRepository.GetUserByEmail(req.Email)
+		user, err := s.Repositories.UserRepository.GetUserByEmail(ctx.Request.Context(), req.Email)
 		if err != nil {
+			s.audit(ctx.Request.Context(), "Login", model.AuditEvent{Action: "user.login_failed", TargetType: "user", TargetId: req.Email}, loginFailure{"unknown_email"})
 			ctx.JSON(409, gin.H{"error": "Email not registered"})
 			return
 		}
 
+		login_event := model.AuditEvent{TargetType: "user", TargetId: user.Id.String(), UserId: &user.Id}
+
 		err = bcrypt.CompareHashAndPassword([]byte(user.EncryptedPassword), []byte(req.Password))
 		if err != nil {
+			login_event.Action = "user.login_failed"
+			s.audit(ctx.Request.Context(), "Login", login_event, loginFailure{"wrong_password"})
 			ctx.JSON(409, gin.H{"error": "Wrong password"})
 			return
 		}
 
+		if user.DisabledAt != nil {
+			login_event.Action = "user.login_failed"
+			s.audit(ctx.Request.Context(), "Login", login_event, loginFailure{"disabled"})
+			ctx.JSON(403, gin.H{"error": "User is disabled"})
+			return
+		}
+
 		session_id, err := uuid.NewV7()
 		if err != nil {
 			log.Println("[ERROR] [Login] an unexpected error occurred while creating session ID: ", err)
@@ -84,15 +105,22 @@ func (s *Server) Login() gin.HandlerFunc {
 			return
 		}
 
-		valkey := s.Repositories.Valkey
-		err = valkey.Do(ctx, valkey.B().Set().Key(session_id.String()).Value(user.Id.String()).Nx().Build()).Error()
+		// Logins are audited before the session exists, so that none can be used without a trace.
+		setAuditActor(ctx, "user:"+user.Id.String())
+		login_event.Action = "user.login"
+		if s.audit(ctx.Request.Context(), "Login", login_event, nil) != nil {
+			ctx.JSON(500, gin.H{"error": "Unexpected error :("})
+			return
+		}
+
+		err = s.Repositories.SessionRepository.CreateSession(ctx.Request.Context(), session_id.String(), user.Id.String())
 		if err != nil {
 			log.Println("[ERROR] [Login] an unexpected error occurred while storing user session: ", err)
 			ctx.JSON(500, gin.H{"error": "Unexpected error :("})
 			return
 		}
 
-		ctx.SetCookie("sessionId", session_id.String(), 3600*24, "/", "localhost", true, true)
+		ctx.SetCookie("sessionId", session_id.String(), int(repository.SessionTTL.Seconds()), "/", "localhost", true, true)
 		ctx.Status(200)
 	}
 }
@@ -123,8 +151,12 @@ type GetAccountsResponse struct {
 	Id      uuid.UUID `json:"id"`
 	Name    string    `json:"name"`
 	Balance string    `json:"balance"`
-	// 'active' | 'inactive'
+	// 'active' | 'inactive' | 'frozen_debit' | 'frozen_all' | 'closed'
 	Status string `json:"status"`
+	// End of a freeze, null when indefinite or not frozen.
+	FrozenUntil *time.Time `json:"frozen_until"`
+	// Such as BRKB590000000001, accepted like the id by transfers.
+	Number string `json:"number"`
 }
 
 func (s *Server) GetMyAccounts() gin.HandlerFunc {
@@ -148,7 +180,7 @@ func (s *Server) GetMyAccounts() gin.HandlerFunc {
 			return
 		}
 
-		raw_accounts, err := s.Repositories.AccountRepository.GetMyAccounts(user.Id.String(), req.Limit, req.Offset)
+		raw_accounts, err := s.Repositories.AccountRepository.GetMyAccounts(ctx.Request.Context(), user.Id.String(), req.Limit, req.Offset)
 		if err != nil {
 			log.Println("[ERROR] [GetMyAccounts] failed to retrieve accounts: ", err)
 			ctx.JSON(500, gin.H{"error": "Failed to retrieve accounts"})
@@ -158,10 +190,12 @@ func (s *Server) GetMyAccounts() gin.HandlerFunc {
 		accounts := []GetAccountsResponse{}
 		for _, value := range *raw_accounts {
 			accounts = append(accounts, GetAccountsResponse{
-				Id:      value.Id,
-				Name:    value.Name,
-				Balance: value.Balance.StringFixed(2),
-				Status:  value.Status,
+				Id:          value.Id,
+				Name:        value.Name,
+				Balance:     value.Balance.StringFixed(2),
+				Status:      value.Status,
+				FrozenUntil: value.FrozenUntil,
+				Number:      s.accountNumber(&value),
 			})
 		}
 
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Endpoints a user may register at once.
+const max_webhooks = 10
+
+type CreateWebhookRequest struct {
+	Url string `json:"url"`
+	// Event types to deliver, every type when empty.
+	EventTypes []string `json:"event_types"`
+}
+
+func (req CreateWebhookRequest) valid() bool {
+	parsed, err := url.Parse(req.Url)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || len(req.Url) > 2048 {
+		return false
+	}
+
+	for _, event_type := range req.EventTypes {
+		if !slices.Contains(webhook_event_types, event_type) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type WebhookResponse struct {
+	Id         uuid.UUID `json:"id"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateWebhookResponse struct {
+	WebhookResponse
+	// Signs the deliveries, only returned when the webhook is created.
+	Secret string `json:"secret"`
+}
+
+func newWebhookResponse(endpoint *model.WebhookEndpoint) WebhookResponse {
+	event_types := []string{}
+	event_types = append(event_types, endpoint.EventTypes...)
+
+	return WebhookResponse{Id: endpoint.Id, Url: endpoint.Url, EventTypes: event_types, CreatedAt: endpoint.CreatedAt}
+}
+
+type WebhookDeliveryResponse struct {
+	Id        uuid.UUID `json:"id"`
+	EventId   uuid.UUID `json:"event_id"`
+	EventType string    `json:"event_type"`
+	// 'pending' | 'succeeded' | 'dead'
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newWebhookDeliveryResponse(delivery *model.WebhookDelivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		Id:            delivery.Id,
+		EventId:       delivery.EventId,
+		EventType:     delivery.EventType,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreatedAt:     delivery.CreatedAt,
+		UpdatedAt:     delivery.UpdatedAt,
+	}
+}
+
+type WebhookAttemptResponse struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	// Null when no response was received.
+	StatusCode *int    `json:"status_code"`
+	Error      *string `json:"error"`
+	DurationMs int     `json:"duration_ms"`
+}
+
+type GetWebhookDeliveryResponse struct {
+	WebhookDeliveryResponse
+	// Oldest first.
+	AttemptLog []WebhookAttemptResponse `json:"attempt_log"`
+}
+
+// ownedWebhook returns one of the user's webhooks, and errWebhookNotFound for every other id.
+func (s *Server) ownedWebhook(ctx context.Context, caller string, user *model.User, webhook_id string) (*model.WebhookEndpoint, error) {
+	id, err := uuid.Parse(webhook_id)
+	if err != nil {
+		return nil, errWebhookNotFound
+	}
+
+	endpoint, err := s.Repositories.WebhookRepository.GetWebhookEndpoint(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && endpoint.UserId != user.Id) {
+		return nil, errWebhookNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get webhook: %s, webhook ID: %s\n", caller, err, webhook_id)
+		return nil, &failure{"Failed to get webhook", err}
+	}
+
+	return endpoint, nil
+}
+
+// ownedDelivery returns a delivery of one of the user's webhooks.
+func (s *Server) ownedDelivery(ctx *gin.Context, caller string, user *model.User) (*model.WebhookDelivery, error) {
+	endpoint, err := s.ownedWebhook(ctx.Request.Context(), caller, user, ctx.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(ctx.Param("delivery_id"))
+	if err != nil {
+		return nil, errDeliveryNotFound
+	}
+
+	delivery, err := s.Repositories.WebhookRepository.GetWebhookDelivery(ctx.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && delivery.EndpointId != endpoint.Id) {
+		return nil, errDeliveryNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get webhook delivery: %s, delivery ID: %s\n", caller, err, id)
+		return nil, &failure{"Failed to get webhook delivery", err}
+	}
+
+	return delivery, nil
+}
+
+/*
+CreateWebhook registers an endpoint the user's events are delivered to, see RunWebhooks. The
+answer holds the secret deliveries are signed with, which can't be read again afterwards.
+*/
+func (s *Server) CreateWebhook() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CreateWebhookRequest{}
+		if ctx.ShouldBindJSON(&req) != nil || !req.valid() {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreateWebhook] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		endpoints, err := s.Repositories.WebhookRepository.GetUserWebhookEndpoints(ctx.Request.Context(), user.Id)
+		if err != nil {
+			log.Printf("[ERROR] [CreateWebhook] failed to get webhooks: %s\n", err)
+			ctx.JSON(500, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		if len(*endpoints) >= max_webhooks {
+			restError(ctx, errTooManyWebhooks)
+			return
+		}
+
+		secret, err := utils.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("[ERROR] [CreateWebhook] failed to generate secret: %s\n", err)
+			ctx.JSON(500, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+
+		endpoint, err := s.Repositories.WebhookRepository.CreateWebhookEndpoint(ctx.Request.Context(), user.Id, req.Url, secret, req.EventTypes)
+		if err != nil {
+			log.Printf("[ERROR] [CreateWebhook] failed to create webhook: %s\n", err)
+			ctx.JSON(500, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": CreateWebhookResponse{WebhookResponse: newWebhookResponse(endpoint), Secret: secret}})
+	}
+}
+
+func (s *Server) GetWebhooks() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetWebhooks] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		endpoints, err := s.Repositories.WebhookRepository.GetUserWebhookEndpoints(ctx.Request.Context(), user.Id)
+		if err != nil {
+			log.Printf("[ERROR] [GetWebhooks] failed to get webhooks: %s\n", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get webhooks"})
+			return
+		}
+
+		webhooks := []WebhookResponse{}
+		for i := range *endpoints {
+			webhooks = append(webhooks, newWebhookResponse(&(*endpoints)[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": webhooks})
+	}
+}
+
+// DeleteWebhook stops the deliveries to an endpoint, including the pending ones.
+func (s *Server) DeleteWebhook() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [DeleteWebhook] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		endpoint, err := s.ownedWebhook(ctx.Request.Context(), "DeleteWebhook", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		if err = s.Repositories.WebhookRepository.DeleteWebhookEndpoint(ctx.Request.Context(), endpoint.Id); err != nil {
+			log.Printf("[ERROR] [DeleteWebhook] failed to delete webhook: %s, webhook ID: %s\n", err, endpoint.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to delete webhook"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+type GetWebhookDeliveriesRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+// GetWebhookDeliveries lists the deliveries to one of the user's webhooks, newest first.
+func (s *Server) GetWebhookDeliveries() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := GetWebhookDeliveriesRequest{}
+		if ctx.ShouldBindQuery(&req) != nil || req.Limit < 0 || req.Offset < 0 {
+			ctx.JSON(400, gin.H{"error": "Invalid input"})
+			return
+		}
+		if req.Limit == 0 {
+			req.Limit = 10
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetWebhookDeliveries] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		endpoint, err := s.ownedWebhook(ctx.Request.Context(), "GetWebhookDeliveries", user, ctx.Param("id"))
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		raw_deliveries, err := s.Repositories.WebhookRepository.GetEndpointDeliveries(ctx.Request.Context(), endpoint.Id, req.Limit, req.Offset)
+		if err != nil {
+			log.Printf("[ERROR] [GetWebhookDeliveries] failed to get deliveries: %s, webhook ID: %s\n", err, endpoint.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to get webhook deliveries"})
+			return
+		}
+
+		deliveries := []WebhookDeliveryResponse{}
+		for i := range *raw_deliveries {
+			deliveries = append(deliveries, newWebhookDeliveryResponse(&(*raw_deliveries)[i]))
+		}
+
+		ctx.JSON(200, gin.H{"payload": deliveries})
+	}
+}
+
+// GetWebhookDelivery returns a delivery along with the log of its attempts.
+func (s *Server) GetWebhookDelivery() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetWebhookDelivery] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		delivery, err := s.ownedDelivery(ctx, "GetWebhookDelivery", user)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		attempts, err := s.Repositories.WebhookRepository.GetDeliveryAttempts(ctx.Request.Context(), delivery.Id)
+		if err != nil {
+			log.Printf("[ERROR] [GetWebhookDelivery] failed to get attempts: %s, delivery ID: %s\n", err, delivery.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to get webhook delivery"})
+			return
+		}
+
+		res := GetWebhookDeliveryResponse{WebhookDeliveryResponse: newWebhookDeliveryResponse(delivery), AttemptLog: []WebhookAttemptResponse{}}
+		for _, attempt := range *attempts {
+			res.AttemptLog = append(res.AttemptLog, WebhookAttemptResponse{
+				AttemptedAt: attempt.AttemptedAt,
+				StatusCode:  attempt.StatusCode,
+				Error:       attempt.Error,
+				DurationMs:  attempt.DurationMs,
+			})
+		}
+
+		ctx.JSON(200, gin.H{"payload": res})
+	}
+}
+
+/*
+RedeliverWebhook sends a delivery again with the next run of RunWebhooks, whatever its status.
+Dead deliveries get one more attempt, and are dead again if it fails.
+*/
+func (s *Server) RedeliverWebhook() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [RedeliverWebhook] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		delivery, err := s.ownedDelivery(ctx, "RedeliverWebhook", user)
+		if err != nil {
+			restError(ctx, err)
+			return
+		}
+
+		if err = s.Repositories.WebhookRepository.RedeliverWebhook(ctx.Request.Context(), delivery.Id); err != nil {
+			log.Printf("[ERROR] [RedeliverWebhook] failed to redeliver: %s, delivery ID: %s\n", err, delivery.Id)
+			ctx.JSON(500, gin.H{"error": "Failed to redeliver webhook"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
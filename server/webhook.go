@@ -0,0 +1,226 @@
+package server
+
+import (
+	"broke-bank/model"
+	"broke-bank/utils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookSignatureHeader = "Broke-Bank-Signature"
+	WebhookEventHeader     = "Broke-Bank-Event"
+	WebhookDeliveryHeader  = "Broke-Bank-Delivery"
+)
+
+// Event types partners can subscribe to, see model.OutboxEvent.
+var webhook_event_types = []string{EventTransactionCreated, EventAccountBalanceChanged, EventAccountDisabled, EventAccountStatusChanged}
+
+/*
+Delivery schedule. A failed attempt is retried after webhook_backoff, doubled after each further
+failure up to webhook_max_backoff, and the delivery is dead after webhook_max_attempts: it is
+only sent again when redelivered by hand.
+*/
+var (
+	webhook_poll_interval = time.Second
+	webhook_timeout       = 10 * time.Second
+	webhook_backoff       = 30 * time.Second
+	webhook_max_backoff   = 6 * time.Hour
+	webhook_max_attempts  = 10
+)
+
+const (
+	webhook_batch = 100
+	// Long enough for every delivery of a batch to time out before another instance claims it again.
+	webhook_lease = time.Minute
+)
+
+// WebhookPayload is the body of every delivery. Id is the event's, so redeliveries can be recognized.
+type WebhookPayload struct {
+	Id        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+var errPrivateWebhookAddress = errors.New("webhooks can't be delivered to private addresses")
+
+/*
+NewWebhookClient returns the client deliveries are sent with. It doesn't follow redirects and,
+unless allow_private is set, refuses to connect to loopback, private and link-local addresses,
+so that endpoint URLs can't be used to reach internal services.
+*/
+func NewWebhookClient(allow_private bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhook_timeout}
+	if !allow_private {
+		// Checked on the resolved address, so that a public name pointing to a private address is refused too.
+		dialer.Control = func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return errPrivateWebhookAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be dialed instead of the endpoint, bypassing the address check.
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       webhook_timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+func (s *Server) webhookClient() *http.Client {
+	if s.WebhookClient == nil {
+		return http.DefaultClient
+	}
+
+	return s.WebhookClient
+}
+
+/*
+RunWebhooks delivers webhooks until ctx is done. Every instance can run it: outbox events and due
+deliveries are claimed with row locks, so each of them is handled by a single instance.
+*/
+func (s *Server) RunWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(webhook_poll_interval)
+	defer ticker.Stop()
+
+	for {
+		s.processWebhooks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processWebhooks turns the pending outbox events into deliveries, then sends the deliveries that are due.
+func (s *Server) processWebhooks(ctx context.Context) {
+	for {
+		dispatched, err := s.Repositories.WebhookRepository.DispatchOutboxEvents(ctx, webhook_batch)
+		if err != nil {
+			log.Printf("[ERROR] [RunWebhooks] failed to dispatch outbox events: %s\n", err)
+			break
+		}
+		if dispatched < webhook_batch {
+			break
+		}
+	}
+
+	deliveries, err := s.Repositories.WebhookRepository.ClaimDueDeliveries(ctx, webhook_batch, webhook_lease)
+	if err != nil {
+		log.Printf("[ERROR] [RunWebhooks] failed to claim deliveries: %s\n", err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for _, delivery := range *deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliverWebhook(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// webhookBackoff returns how long to wait before retrying a delivery that failed attempts times.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhook_backoff
+	for i := 1; i < attempts && backoff < webhook_max_backoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, webhook_max_backoff)
+}
+
+func (s *Server) deliverWebhook(ctx context.Context, delivery model.WebhookDelivery) {
+	endpoint, err := s.Repositories.WebhookRepository.GetWebhookEndpoint(ctx, delivery.EndpointId)
+	if err != nil {
+		log.Printf("[ERROR] [RunWebhooks] failed to get webhook endpoint: %s, delivery ID: %s\n", err, delivery.Id)
+		return
+	}
+
+	body, err := json.Marshal(WebhookPayload{Id: delivery.EventId, Type: delivery.EventType, CreatedAt: delivery.EventCreatedAt, Data: json.RawMessage(delivery.EventData)})
+	if err != nil {
+		log.Printf("[ERROR] [RunWebhooks] failed to encode webhook: %s, delivery ID: %s\n", err, delivery.Id)
+		return
+	}
+
+	attempt := model.WebhookDeliveryAttempt{DeliveryId: delivery.Id}
+	start := time.Now()
+	status_code, err := s.postWebhook(ctx, endpoint, delivery, body)
+	attempt.DurationMs = int(time.Since(start).Milliseconds())
+
+	if status_code != 0 {
+		attempt.StatusCode = &status_code
+	}
+	if err != nil {
+		message := err.Error()
+		attempt.Error = &message
+	}
+
+	status, next_attempt_at := "succeeded", time.Now()
+	if err != nil {
+		status, next_attempt_at = "pending", time.Now().Add(webhookBackoff(delivery.Attempts+1))
+		if delivery.Attempts+1 >= webhook_max_attempts {
+			status = "dead"
+		}
+	}
+
+	if err = s.Repositories.WebhookRepository.RecordDeliveryAttempt(context.WithoutCancel(ctx), attempt, status, next_attempt_at); err != nil {
+		log.Printf("[ERROR] [RunWebhooks] failed to record delivery attempt: %s, delivery ID: %s\n", err, delivery.Id)
+	}
+}
+
+// postWebhook sends a delivery, which only succeeds with a 2xx answer.
+func (s *Server) postWebhook(ctx context.Context, endpoint *model.WebhookEndpoint, delivery model.WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "broke-bank-webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.Id.String())
+	req.Header.Set(WebhookSignatureHeader, utils.SignWebhook(endpoint.Secret, time.Now(), body))
+
+	res, err := s.webhookClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Drained so that the connection can be reused, within reason.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint answered %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"broke-bank/utils"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type receivedWebhook struct {
+	header  http.Header
+	payload WebhookPayload
+	err     error
+}
+
+// webhookReceiver records the deliveries it gets and answers them with status.
+type webhookReceiver struct {
+	*httptest.Server
+	status   atomic.Int32
+	mu       sync.Mutex
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, secret *string) *webhookReceiver {
+	t.Helper()
+
+	r := &webhookReceiver{}
+	r.status.Store(200)
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		received := receivedWebhook{header: req.Header}
+		received.err = utils.VerifyWebhook(*secret, req.Header.Get(WebhookSignatureHeader), body, 5*time.Minute, time.Now())
+		if err := json.Unmarshal(body, &received.payload); err != nil && received.err == nil {
+			received.err = err
+		}
+
+		r.mu.Lock()
+		r.received = append(r.received, received)
+		r.mu.Unlock()
+
+		w.WriteHeader(int(r.status.Load()))
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *webhookReceiver) take() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	received := r.received
+	r.received = nil
+	return received
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	s, router := newTestServer(t)
+
+	alice := signUp(t, router, "alice@broke.bank")
+	bob := signUp(t, router, "bob@broke.bank")
+	checking := alice.createAccount("Checking")
+	savings := bob.createAccount("Savings")
+
+	secret := ""
+	receiver := newWebhookReceiver(t, &secret)
+
+	w := alice.do("POST", "/v2/webhooks", map[string]any{"url": receiver.URL + "/hook", "event_types": []string{EventTransactionCreated, EventAccountBalanceChanged}})
+	if w.Code != 200 {
+		t.Fatalf("POST /v2/webhooks = %d: %s", w.Code, w.Body)
+	}
+	created := decodePayload[CreateWebhookResponse](t, w)
+	secret = created.Secret
+
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "100.00", "to_account_id": checking})
+	alice.do("POST", "/transaction/transfer", map[string]string{"amount": "25.50", "from_account_id": checking, "to_account_id": savings})
+	s.processWebhooks(context.Background())
+
+	received := receiver.take()
+	if len(received) != 4 {
+		t.Fatalf("received %d webhooks, want 2 transaction.created and 2 account.balance_changed", len(received))
+	}
+
+	balances := []string{}
+	for _, webhook := range received {
+		if webhook.err != nil {
+			t.Fatalf("invalid webhook: %s", webhook.err)
+		}
+		if webhook.header.Get(WebhookEventHeader) != webhook.payload.Type || webhook.header.Get(WebhookDeliveryHeader) == "" {
+			t.Fatalf("webhook headers = %v, want the %s event and a delivery id", webhook.header, webhook.payload.Type)
+		}
+
+		switch webhook.payload.Type {
+		case EventTransactionCreated:
+			transaction := GetTransactionResponse{}
+			if err := json.Unmarshal(webhook.payload.Data, &transaction); err != nil || (transaction.Type != "deposit" && transaction.Type != "transfer") {
+				t.Fatalf("transaction.created data = %s, want the deposit or the transfer", webhook.payload.Data)
+			}
+		case EventAccountBalanceChanged:
+			balance := BalanceChangedEvent{}
+			if err := json.Unmarshal(webhook.payload.Data, &balance); err != nil || balance.AccountId.String() != checking {
+				t.Fatalf("account.balance_changed data = %s, want checking", webhook.payload.Data)
+			}
+			balances = append(balances, balance.Balance)
+		default:
+			t.Fatalf("got a %s webhook, which isn't subscribed to", webhook.payload.Type)
+		}
+	}
+	if len(balances) != 2 {
+		t.Fatalf("account.balance_changed balances = %v, want 2 of them", balances)
+	}
+
+	// Delivered once only.
+	s.processWebhooks(context.Background())
+	if received := receiver.take(); len(received) != 0 {
+		t.Fatalf("received %d webhooks again", len(received))
+	}
+
+	// Bob's deposits aren't sent to alice, and he can't see her webhooks.
+	bob.do("POST", "/transaction/deposit", map[string]string{"amount": "5.00", "to_account_id": savings})
+	s.processWebhooks(context.Background())
+	if received := receiver.take(); len(received) != 0 {
+		t.Fatalf("received %d webhooks for bob's deposit", len(received))
+	}
+	if w := bob.do("GET", "/v2/webhooks/"+created.Id.String()+"/deliveries", nil); w.Code != 404 {
+		t.Fatalf("bob's GET /v2/webhooks/%s/deliveries = %d, want 404", created.Id, w.Code)
+	}
+	if webhooks := decodePayload[[]WebhookResponse](t, bob.do("GET", "/v2/webhooks", nil)); len(webhooks) != 0 {
+		t.Fatalf("bob's webhooks = %+v, want none", webhooks)
+	}
+
+	// Deleted webhooks get nothing more.
+	if w := alice.do("DELETE", "/v2/webhooks/"+created.Id.String(), nil); w.Code != 200 {
+		t.Fatalf("DELETE /v2/webhooks/%s = %d", created.Id, w.Code)
+	}
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "1.00", "to_account_id": checking})
+	s.processWebhooks(context.Background())
+	if received := receiver.take(); len(received) != 0 {
+		t.Fatalf("received %d webhooks after deleting the webhook", len(received))
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	backoff, max_attempts := webhook_backoff, webhook_max_attempts
+	t.Cleanup(func() { webhook_backoff, webhook_max_attempts = backoff, max_attempts })
+	webhook_backoff, webhook_max_attempts = time.Millisecond, 3
+
+	s, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+	checking := alice.createAccount("Checking")
+
+	secret := ""
+	receiver := newWebhookReceiver(t, &secret)
+	receiver.status.Store(503)
+
+	created := decodePayload[CreateWebhookResponse](t, alice.do("POST", "/v2/webhooks", map[string]any{"url": receiver.URL, "event_types": []string{EventTransactionCreated}}))
+	secret = created.Secret
+	alice.do("POST", "/transaction/deposit", map[string]string{"amount": "10.00", "to_account_id": checking})
+
+	deliveries_path := "/v2/webhooks/" + created.Id.String() + "/deliveries"
+	for attempt := 1; attempt <= 5; attempt++ {
+		s.processWebhooks(context.Background())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	deliveries := decodePayload[[]WebhookDeliveryResponse](t, alice.do("GET", deliveries_path, nil))
+	if len(deliveries) != 1 || deliveries[0].Status != "dead" || deliveries[0].Attempts != 3 {
+		t.Fatalf("deliveries = %+v, want a dead delivery after 3 attempts", deliveries)
+	}
+	if received := receiver.take(); len(received) != 3 {
+		t.Fatalf("received %d webhooks, want 3 attempts", len(received))
+	}
+
+	delivery_path := deliveries_path + "/" + deliveries[0].Id.String()
+	delivery := decodePayload[GetWebhookDeliveryResponse](t, alice.do("GET", delivery_path, nil))
+	if len(delivery.AttemptLog) != 3 || delivery.AttemptLog[0].StatusCode == nil || *delivery.AttemptLog[0].StatusCode != 503 || delivery.AttemptLog[0].Error == nil {
+		t.Fatalf("attempt log = %+v, want 3 failed attempts answered with 503", delivery.AttemptLog)
+	}
+
+	// Redelivering a dead delivery sends it again.
+	receiver.status.Store(204)
+	if w := alice.do("POST", delivery_path+"/redeliver", nil); w.Code != 200 {
+		t.Fatalf("POST %s/redeliver = %d", delivery_path, w.Code)
+	}
+	s.processWebhooks(context.Background())
+
+	received := receiver.take()
+	if len(received) != 1 || received[0].err != nil || received[0].payload.Id != delivery.EventId {
+		t.Fatalf("received %+v after redelivering, want the same event", received)
+	}
+	if delivery = decodePayload[GetWebhookDeliveryResponse](t, alice.do("GET", delivery_path, nil)); delivery.Status != "succeeded" || len(delivery.AttemptLog) != 4 {
+		t.Fatalf("delivery = %+v, want succeeded after 4 attempts", delivery)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 30: 6 * time.Hour} {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestWebhookRequests(t *testing.T) {
+	_, router := newTestServer(t)
+	alice := signUp(t, router, "alice@broke.bank")
+
+	for _, req := range []map[string]any{
+		{"url": "ftp://partner.example/hook"},
+		{"url": "https://"},
+		{"url": "https://partner.example/hook", "event_types": []string{"account.created"}},
+	} {
+		if w := alice.do("POST", "/v2/webhooks", req); w.Code != 422 {
+			t.Errorf("POST /v2/webhooks %v = %d, want 422", req, w.Code)
+		}
+	}
+
+	for range max_webhooks {
+		if w := alice.do("POST", "/v2/webhooks", map[string]any{"url": "https://partner.example/hook"}); w.Code != 200 {
+			t.Fatalf("POST /v2/webhooks = %d: %s", w.Code, w.Body)
+		}
+	}
+	if w := alice.do("POST", "/v2/webhooks", map[string]any{"url": "https://partner.example/hook"}); w.Code != 422 {
+		t.Fatalf("POST /v2/webhooks past the limit = %d, want 422", w.Code)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	t.Cleanup(ts.Close)
+
+	if res, err := NewWebhookClient(false).Post(ts.URL, "application/json", nil); err == nil {
+		res.Body.Close()
+		t.Fatal("webhook client connected to a loopback address")
+	}
+
+	res, err := NewWebhookClient(true).Post(ts.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("webhook client allowing private networks: %s", err)
+	}
+	res.Body.Close()
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const api_key_prefix = "bb_"
+
+// GenerateApiKey returns a new random API key, its display prefix and the hash to store.
+func GenerateApiKey() (key string, prefix string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+
+	key = api_key_prefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, key[:len(api_key_prefix)+8], HashApiKey(key), nil
+}
+
+// HashApiKey returns the hex SHA-256 of key. Keys are random, so a plain hash is enough to store them.
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
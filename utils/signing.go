@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer signs with an Ed25519 key, whose public half is published for verifiers.
+type Signer struct {
+	KeyId string
+	key   ed25519.PrivateKey
+}
+
+func NewSigner(seed []byte) (*Signer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be a %d bytes seed, got %d", ed25519.SeedSize, len(seed))
+	}
+
+	key := ed25519.NewKeyFromSeed(seed)
+	return &Signer{KeyId: KeyId(key.Public().(ed25519.PublicKey)), key: key}, nil
+}
+
+// GenerateSigningKey returns a new random seed, base64 encoded like SignerFromEnv expects it.
+func GenerateSigningKey() (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(seed), nil
+}
+
+// SignerFromEnv reads a base64 seed from env, and returns nil when it isn't set.
+func SignerFromEnv(env string) (*Signer, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return nil, nil
+	}
+
+	signer, err := ParseSigningKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", env, err)
+	}
+
+	return signer, nil
+}
+
+// ParseSigningKey reads a base64 seed, as returned by GenerateSigningKey.
+func ParseSigningKey(raw string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigner(seed)
+}
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func (s *Signer) Sign(message []byte) []byte {
+	return ed25519.Sign(s.key, message)
+}
+
+// KeyId identifies a public key by the first 8 bytes of its SHA-256, in hex.
+func KeyId(public_key ed25519.PublicKey) string {
+	hash := sha256.Sum256(public_key)
+	return hex.EncodeToString(hash[:8])
+}
+
+func VerifySignature(public_key []byte, message []byte, signature []byte) error {
+	if len(public_key) != ed25519.PublicKeySize || !ed25519.Verify(public_key, message, signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const webhook_secret_prefix = "whsec_"
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrExpiredWebhookSignature = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// GenerateWebhookSecret returns a new random secret to sign webhooks with.
+func GenerateWebhookSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return webhook_secret_prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func webhookMAC(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
+
+/*
+SignWebhook returns the signature header of a webhook body: `t=<unix seconds>,v1=<signature>`,
+where the signature is the hex HMAC-SHA256 of `<unix seconds>.<body>` keyed with the secret.
+Signing the timestamp lets receivers reject replays of old requests.
+*/
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	unix := timestamp.Unix()
+	return "t=" + strconv.FormatInt(unix, 10) + ",v1=" + hex.EncodeToString(webhookMAC(secret, unix, body))
+}
+
+/*
+VerifyWebhook checks a header made by SignWebhook, and that its timestamp is within tolerance
+of now. Several v1 signatures may be listed, for instance while a secret is rotated.
+*/
+func VerifyWebhook(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp int64 = -1
+	signatures := [][]byte{}
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidWebhookSignature
+			}
+			timestamp = parsed
+		case "v1":
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidWebhookSignature
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+
+	if timestamp < 0 || len(signatures) == 0 {
+		return ErrInvalidWebhookSignature
+	}
+
+	expected := webhookMAC(secret, timestamp, body)
+	valid := false
+	for _, signature := range signatures {
+		valid = valid || hmac.Equal(signature, expected)
+	}
+	if !valid {
+		return ErrInvalidWebhookSignature
+	}
+
+	if age := now.Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrExpiredWebhookSignature
+	}
+
+	return nil
+}